@@ -0,0 +1,306 @@
+// Package acl evaluates the .goshs access control files placed in the served
+// directory tree. It is shared by the HTTP, WebDAV, SFTP and SMB servers so
+// every protocol applies the same rules.
+//
+// A .goshs file applies to its directory and, unless a deeper .goshs file
+// exists, to everything below it. It looks like
+//
+//	{
+//	  "auth": "admin:$2a$14$...",
+//	  "users": {"alice": "$2a$14$...", "bob": "plaintext"},
+//	  "block": ["*.key", "private/"],
+//	  "rules": [
+//	    {"deny": ["delete"], "users": ["bob"]},
+//	    {"allow": ["*"], "ips": ["10.0.0.0/8"]},
+//	    {"deny": ["upload", "mkdir"], "paths": ["releases/*"]}
+//	  ]
+//	}
+//
+// auth and users list the credentials required to access the directory.
+// block hides matching names from listings and downloads; a trailing slash
+// matches directories only. rules are checked in order and the first rule
+// whose conditions match and which names the method decides; without a
+// matching rule access is allowed.
+package acl
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// FileName is the name of the ACL file.
+const FileName = ".goshs"
+
+// Method is an operation checked against the rules.
+type Method string
+
+const (
+	List   Method = "list"
+	Read   Method = "read"
+	Upload Method = "upload"
+	Delete Method = "delete"
+	Mkdir  Method = "mkdir"
+)
+
+var methods = []Method{List, Read, Upload, Delete, Mkdir}
+
+// Decision is the outcome of a check.
+type Decision int
+
+const (
+	// Allowed grants the request.
+	Allowed Decision = iota
+	// Unauthorized means the credentials required by the file are missing
+	// or wrong.
+	Unauthorized
+	// Forbidden means a rule denied the request.
+	Forbidden
+	// Hidden means the target is blocked and should look like it does not
+	// exist.
+	Hidden
+)
+
+// Rule allows or denies methods when all of its conditions match. Empty
+// conditions match everything.
+type Rule struct {
+	Allow []string `json:"allow,omitempty"` // methods, "*" for all
+	Deny  []string `json:"deny,omitempty"`  // methods, "*" for all
+	Users []string `json:"users,omitempty"` // user names, "*" for any authenticated user
+	Paths []string `json:"paths,omitempty"` // glob patterns relative to the .goshs directory
+	IPs   []string `json:"ips,omitempty"`   // addresses or CIDR ranges
+
+	nets []*net.IPNet
+}
+
+// File is a parsed .goshs file.
+type File struct {
+	Auth  string            `json:"auth"`
+	Users map[string]string `json:"users,omitempty"`
+	Block []string          `json:"block"`
+	Rules []Rule            `json:"rules,omitempty"`
+
+	dir     string // directory holding the file, set by the Store
+	invalid bool   // the file could not be parsed and denies everything
+}
+
+// Request describes an operation on Path.
+type Request struct {
+	Method Method
+	Path   string // absolute local path of the target
+	IsDir  bool
+	IP     net.IP
+	// User is the identity the server already authenticated, "" for
+	// anonymous access. It is used by rules when the file has no users of
+	// its own.
+	User string
+	// Username and Password are the credentials checked against the users
+	// of the file. Protocols that cannot provide a password leave them
+	// empty and are denied access to protected directories.
+	Username string
+	Password string
+}
+
+// Parse reads a .goshs file.
+func Parse(data []byte) (*File, error) {
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if f.Auth != "" && !strings.Contains(f.Auth, ":") {
+		return nil, fmt.Errorf("auth must be user:hash")
+	}
+	for _, pattern := range f.Block {
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+			return nil, fmt.Errorf("block %q: %w", pattern, err)
+		}
+	}
+	for i := range f.Rules {
+		if err := f.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	return &f, nil
+}
+
+func (r *Rule) compile() error {
+	if len(r.Allow) == 0 && len(r.Deny) == 0 {
+		return fmt.Errorf("needs allow or deny")
+	}
+	for _, m := range slices.Concat(r.Allow, r.Deny) {
+		if m != "*" && !slices.Contains(methods, Method(m)) {
+			return fmt.Errorf("unknown method %q", m)
+		}
+	}
+	for _, pattern := range r.Paths {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("path %q: %w", pattern, err)
+		}
+	}
+	r.nets = r.nets[:0]
+	for _, s := range r.IPs {
+		if !strings.Contains(s, "/") {
+			if strings.Contains(s, ":") {
+				s += "/128"
+			} else {
+				s += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return fmt.Errorf("ip %q: %w", s, err)
+		}
+		r.nets = append(r.nets, n)
+	}
+	return nil
+}
+
+// Empty reports whether the file defines nothing, in which case a .goshs
+// file further up applies.
+func (f *File) Empty() bool {
+	return f.Auth == "" && len(f.Users) == 0 && len(f.Block) == 0 && len(f.Rules) == 0 && !f.invalid
+}
+
+// RequiresAuth reports whether the directory is protected by credentials.
+func (f *File) RequiresAuth() bool {
+	return f.Auth != "" || len(f.Users) > 0 || f.invalid
+}
+
+// Authenticate checks user and password against auth and users. Secrets
+// starting with $2a$, $2b$ or $2y$ are bcrypt hashes; users entries may
+// also be plaintext.
+func (f *File) Authenticate(user, password string) bool {
+	if f.invalid {
+		return false
+	}
+	if name, hash, ok := strings.Cut(f.Auth, ":"); ok && name == user {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return true
+		}
+	}
+	secret, ok := f.Users[user]
+	if !ok {
+		return false
+	}
+	if strings.HasPrefix(secret, "$2a$") || strings.HasPrefix(secret, "$2b$") || strings.HasPrefix(secret, "$2y$") {
+		return bcrypt.CompareHashAndPassword([]byte(secret), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(password)) == 1
+}
+
+// Blocked reports whether name is hidden by the block list.
+func (f *File) Blocked(name string, isDir bool) bool {
+	if name == FileName {
+		return true
+	}
+	name = strings.TrimSuffix(name, "/")
+	for _, pattern := range f.Block {
+		dirOnly := strings.HasSuffix(pattern, "/")
+		if dirOnly != isDir {
+			continue
+		}
+		if ok, _ := path.Match(strings.TrimSuffix(pattern, "/"), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed evaluates the rules for req. user is the identity established for
+// the request: a user of the file if it has any, otherwise req.User.
+func (f *File) Allowed(req Request, user string) bool {
+	if f.invalid {
+		return false
+	}
+	rel := f.rel(req.Path)
+	for i := range f.Rules {
+		r := &f.Rules[i]
+		if !r.matches(rel, user, req.IP) {
+			continue
+		}
+		if r.names(r.Deny, req.Method) {
+			return false
+		}
+		if r.names(r.Allow, req.Method) {
+			return true
+		}
+	}
+	return true
+}
+
+// Decide runs the complete check of req against the file: block list,
+// credentials and rules.
+func (f *File) Decide(req Request) Decision {
+	if req.Method != List || !req.IsDir {
+		if f.Blocked(filepath.Base(req.Path), req.IsDir) {
+			return Hidden
+		}
+	}
+	user := req.User
+	if f.RequiresAuth() {
+		if !f.Authenticate(req.Username, req.Password) {
+			return Unauthorized
+		}
+		user = req.Username
+	}
+	if !f.Allowed(req, user) {
+		return Forbidden
+	}
+	return Allowed
+}
+
+// rel returns the slash separated path of p below the .goshs directory, or
+// its base name if the directory is unknown.
+func (f *File) rel(p string) string {
+	if f.dir != "" {
+		if rel, err := filepath.Rel(f.dir, p); err == nil && filepath.IsLocal(rel) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Base(p)
+}
+
+func (r *Rule) names(list []string, m Method) bool {
+	return slices.Contains(list, "*") || slices.Contains(list, string(m))
+}
+
+func (r *Rule) matches(rel, user string, ip net.IP) bool {
+	if len(r.Users) > 0 && !slices.Contains(r.Users, user) && (user == "" || !slices.Contains(r.Users, "*")) {
+		return false
+	}
+	if len(r.nets) > 0 && !slices.ContainsFunc(r.nets, func(n *net.IPNet) bool { return ip != nil && n.Contains(ip) }) {
+		return false
+	}
+	if len(r.Paths) > 0 && !slices.ContainsFunc(r.Paths, func(pattern string) bool { return matchPath(pattern, rel) }) {
+		return false
+	}
+	return true
+}
+
+// matchPath reports whether pattern matches rel or one of its parents, so a
+// rule for a directory covers its content. Patterns without a slash are
+// matched against every path element.
+func matchPath(pattern, rel string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		for elem := range strings.SplitSeq(rel, "/") {
+			if ok, _ := path.Match(pattern, elem); ok {
+				return true
+			}
+		}
+		return false
+	}
+	for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
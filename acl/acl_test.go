@@ -0,0 +1,100 @@
+package acl
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func mustParse(t *testing.T, data string) *File {
+	t.Helper()
+	f, err := Parse([]byte(data))
+	require.NoError(t, err)
+	return f
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, data := range []string{
+		`{`,
+		`{"auth":"nocolon"}`,
+		`{"block":["[a"]}`,
+		`{"rules":[{"users":["bob"]}]}`,
+		`{"rules":[{"deny":["chmod"]}]}`,
+		`{"rules":[{"deny":["*"],"paths":["[a"]}]}`,
+		`{"rules":[{"deny":["*"],"ips":["not-an-ip"]}]}`,
+	} {
+		_, err := Parse([]byte(data))
+		require.Error(t, err, data)
+	}
+}
+
+func TestBlocked(t *testing.T) {
+	f := mustParse(t, `{"block":["*.key","private/"]}`)
+
+	require.True(t, f.Blocked("id.key", false))
+	require.False(t, f.Blocked("id.key", true))
+	require.True(t, f.Blocked("private", true))
+	require.True(t, f.Blocked("private/", true))
+	require.False(t, f.Blocked("private", false))
+	require.True(t, f.Blocked(FileName, false))
+	require.False(t, f.Blocked("readme.txt", false))
+}
+
+func TestAuthenticate(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	f := mustParse(t, `{"auth":"admin:`+string(hash)+`","users":{"alice":"`+string(hash)+`","bob":"plain"}}`)
+
+	require.True(t, f.RequiresAuth())
+	require.True(t, f.Authenticate("admin", "secret"))
+	require.True(t, f.Authenticate("alice", "secret"))
+	require.True(t, f.Authenticate("bob", "plain"))
+	require.False(t, f.Authenticate("bob", "secret"))
+	require.False(t, f.Authenticate("carol", "secret"))
+}
+
+func TestAllowed_Rules(t *testing.T) {
+	f := mustParse(t, `{"rules":[
+		{"deny":["delete"],"users":["bob"]},
+		{"allow":["*"],"ips":["10.0.0.0/8"]},
+		{"deny":["upload","mkdir"],"paths":["releases/*"]},
+		{"deny":["read"],"users":["*"],"paths":["*.bak"]}
+	]}`)
+	f.dir = "/srv"
+	req := func(m Method, p, ip string) Request {
+		return Request{Method: m, Path: p, IP: net.ParseIP(ip)}
+	}
+
+	require.False(t, f.Allowed(req(Delete, "/srv/a.txt", "192.168.1.1"), "bob"))
+	require.True(t, f.Allowed(req(Delete, "/srv/a.txt", "192.168.1.1"), "alice"))
+
+	// First matching rule wins
+	require.True(t, f.Allowed(req(Upload, "/srv/releases/v1.zip", "10.1.2.3"), ""))
+	require.False(t, f.Allowed(req(Upload, "/srv/releases/v1.zip", "192.168.1.1"), ""))
+	require.False(t, f.Allowed(req(Mkdir, "/srv/releases/v1/sub", "192.168.1.1"), ""))
+	require.True(t, f.Allowed(req(Upload, "/srv/other/v1.zip", "192.168.1.1"), ""))
+
+	// "*" only matches authenticated users
+	require.False(t, f.Allowed(req(Read, "/srv/deep/db.bak", "192.168.1.1"), "alice"))
+	require.True(t, f.Allowed(req(Read, "/srv/deep/db.bak", "192.168.1.1"), ""))
+}
+
+func TestDecide(t *testing.T) {
+	f := mustParse(t, `{"users":{"bob":"pw"},"block":["*.key"],"rules":[{"deny":["delete"]}]}`)
+	f.dir = "/srv"
+
+	require.Equal(t, Hidden, f.Decide(Request{Method: Read, Path: "/srv/id.key", Username: "bob", Password: "pw"}))
+	require.Equal(t, Unauthorized, f.Decide(Request{Method: Read, Path: "/srv/a.txt", User: "bob"}))
+	require.Equal(t, Allowed, f.Decide(Request{Method: Read, Path: "/srv/a.txt", Username: "bob", Password: "pw"}))
+	require.Equal(t, Forbidden, f.Decide(Request{Method: Delete, Path: "/srv/a.txt", Username: "bob", Password: "pw"}))
+}
+
+func TestMatchPath(t *testing.T) {
+	require.True(t, matchPath("releases", "releases/v1/a.zip"))
+	require.True(t, matchPath("releases/*", "releases/v1/a.zip"))
+	require.True(t, matchPath("*.bak", filepath.ToSlash("a/b/c.bak")))
+	require.False(t, matchPath("releases/*", "other/releases"))
+}
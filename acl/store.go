@@ -0,0 +1,147 @@
+package acl
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"goshs.de/goshs/v2/logger"
+)
+
+// Store caches parsed .goshs files and reloads them when they change on
+// disk, so edits apply to the next request without a restart. A nil *Store
+// is valid and reads the files on every call.
+type Store struct {
+	mu    sync.Mutex
+	files map[string]cached // keyed by directory
+}
+
+type cached struct {
+	modTime time.Time
+	size    int64
+	file    *File
+	err     error
+}
+
+// NewStore returns an empty Store.
+func NewStore() *Store {
+	return &Store{files: map[string]cached{}}
+}
+
+// Read returns the .goshs file in dir. It is empty if there is none. A file
+// that cannot be parsed is returned together with the error and denies all
+// access until it is fixed.
+func (s *Store) Read(dir string) (*File, error) {
+	if _, err := os.Stat(dir); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &File{}, err
+		}
+		return &File{dir: dir, invalid: true}, err
+	}
+	p := filepath.Join(dir, FileName)
+	info, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		if s != nil {
+			s.mu.Lock()
+			delete(s.files, dir)
+			s.mu.Unlock()
+		}
+		return &File{}, nil
+	}
+	if err != nil {
+		return &File{dir: dir, invalid: true}, err
+	}
+
+	if s != nil {
+		s.mu.Lock()
+		c, ok := s.files[dir]
+		s.mu.Unlock()
+		if ok && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+			return c.file, c.err
+		}
+	}
+
+	// disable G304 (CWE-22): Potential file inclusion via variable
+	// #nosec G304
+	data, err := os.ReadFile(p)
+	var f *File
+	if err == nil {
+		f, err = Parse(data)
+	}
+	if err != nil {
+		logger.Warnf("%s is invalid and denies all access until fixed: %+v", p, err)
+		f = &File{invalid: true}
+	}
+	f.dir = dir
+
+	if s != nil {
+		s.mu.Lock()
+		if _, reload := s.files[dir]; reload && err == nil {
+			logger.Infof("Reloaded ACL %s", p)
+		}
+		s.files[dir] = cached{modTime: info.ModTime(), size: info.Size(), file: f, err: err}
+		s.mu.Unlock()
+	}
+	return f, err
+}
+
+// Effective walks up from dir toward root and returns the nearest .goshs
+// file that defines anything. A .goshs file in a parent directory therefore
+// applies to all subdirectories without leaking above root.
+func (s *Store) Effective(root, dir string) (*File, error) {
+	root = filepath.Clean(root)
+	current := filepath.Clean(dir)
+	if rel, err := filepath.Rel(root, current); err != nil || !filepath.IsLocal(rel) {
+		return &File{}, nil
+	}
+	for {
+		f, err := s.Read(current)
+		// Directories that do not exist yet (uploads, mkdir -p) inherit
+		// from their parents
+		if (err != nil && !errors.Is(err, fs.ErrNotExist)) || !f.Empty() {
+			return f, err
+		}
+		// Stop once we have checked root itself
+		if current == root {
+			break
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			// Reached filesystem root – guard against infinite loop
+			break
+		}
+		current = parent
+	}
+	return &File{}, nil
+}
+
+// Check evaluates req against the .goshs files below root. The target is
+// hidden if the file governing its parent blocks it; listing a directory is
+// checked against the directory's own effective file, everything else
+// against the one of the parent directory.
+func (s *Store) Check(root string, req Request) Decision {
+	// Errors are logged by Read and leave a file that denies everything
+	parent := &File{}
+	if filepath.Clean(req.Path) != filepath.Clean(root) {
+		parent, _ = s.Effective(root, filepath.Dir(req.Path))
+		if parent.Blocked(filepath.Base(req.Path), req.IsDir) {
+			return Hidden
+		}
+	}
+	f := parent
+	if req.Method == List && req.IsDir {
+		f, _ = s.Effective(root, req.Path)
+	}
+	return f.Decide(req)
+}
+
+// Visible returns a filter for the entries of dir that hides blocked names.
+func (s *Store) Visible(root, dir string) func(name string, isDir bool) bool {
+	f, _ := s.Effective(root, dir)
+	return func(name string, isDir bool) bool {
+		return !f.Blocked(name, isDir)
+	}
+}
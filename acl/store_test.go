@@ -0,0 +1,81 @@
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Reload(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, FileName)
+	s := NewStore()
+
+	f, err := s.Read(dir)
+	require.NoError(t, err)
+	require.True(t, f.Empty())
+
+	require.NoError(t, os.WriteFile(p, []byte(`{"block":["a.txt"]}`), 0644))
+	f, err = s.Read(dir)
+	require.NoError(t, err)
+	require.True(t, f.Blocked("a.txt", false))
+
+	// Cached until the file changes
+	again, _ := s.Read(dir)
+	require.Same(t, f, again)
+
+	require.NoError(t, os.WriteFile(p, []byte(`{"block":["b.txt"]}`), 0644))
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(p, later, later))
+	f, err = s.Read(dir)
+	require.NoError(t, err)
+	require.False(t, f.Blocked("a.txt", false))
+	require.True(t, f.Blocked("b.txt", false))
+
+	require.NoError(t, os.Remove(p))
+	f, err = s.Read(dir)
+	require.NoError(t, err)
+	require.True(t, f.Empty())
+}
+
+func TestStore_InvalidFileDeniesAll(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, FileName), []byte(`{"rules":[{"deny":["nope"]}]}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0644))
+
+	var s *Store
+	f, err := s.Read(dir)
+	require.Error(t, err)
+	require.False(t, f.Empty())
+	require.Equal(t, Unauthorized, s.Check(dir, Request{Method: Read, Path: filepath.Join(dir, "a.txt"), Username: "x", Password: "y"}))
+}
+
+func TestStore_Check(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "pub", "hidden"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "pub", "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "pub", FileName), []byte(`{"block":["hidden/"],"rules":[{"deny":["upload"],"ips":["10.0.0.0/8"]}]}`), 0644))
+
+	s := NewStore()
+	check := func(m Method, rel string, isDir bool) Decision {
+		return s.Check(root, Request{Method: m, Path: filepath.Join(root, rel), IsDir: isDir})
+	}
+
+	require.Equal(t, Allowed, check(List, ".", true))
+	require.Equal(t, Hidden, check(List, "pub/hidden", true))
+	// Only the directory itself is hidden
+	require.Equal(t, Allowed, check(Read, "pub/hidden/file.txt", false))
+	// Rules of the parent apply to subdirectories that do not exist yet
+	require.Equal(t, Allowed, check(Upload, "pub/sub/new/file.txt", false))
+
+	d := s.Check(root, Request{Method: Upload, Path: filepath.Join(root, "pub", "sub", "x"), IP: []byte{10, 0, 0, 1}})
+	require.Equal(t, Forbidden, d)
+
+	visible := s.Visible(root, filepath.Join(root, "pub"))
+	require.False(t, visible("hidden", true))
+	require.False(t, visible(FileName, false))
+	require.True(t, visible("sub", true))
+}
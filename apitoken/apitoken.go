@@ -0,0 +1,112 @@
+// Package apitoken keeps the bearer tokens scripts use instead of the basic
+// auth password. Only a hash of every token is stored, next to the scope it
+// is limited to and an optional expiry.
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Prefix starts every token so leaked ones are easy to recognise.
+const Prefix = "goshs_"
+
+// Scope is what a token may be used for.
+type Scope string
+
+const (
+	// ScopeUpload may only upload files (POST /upload, PUT).
+	ScopeUpload Scope = "upload"
+	// ScopeRead may list and download below the path of the token.
+	ScopeRead Scope = "read"
+	// ScopeEvents may read the collaborator events.
+	ScopeEvents Scope = "events"
+	// ScopeCatcher may control the reverse shell catcher.
+	ScopeCatcher Scope = "catcher"
+	// ScopeMetrics may scrape /metrics.
+	ScopeMetrics Scope = "metrics"
+)
+
+// Scopes lists all scopes for help texts and completion.
+var Scopes = []Scope{ScopeUpload, ScopeRead, ScopeEvents, ScopeCatcher, ScopeMetrics}
+
+// ParseScope returns the scope named s.
+func ParseScope(s string) (Scope, error) {
+	for _, scope := range Scopes {
+		if strings.EqualFold(s, string(scope)) {
+			return scope, nil
+		}
+	}
+	return "", fmt.Errorf("unknown scope %q, use one of %v", s, Scopes)
+}
+
+// Token is one entry of the tokens file.
+type Token struct {
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash,omitempty"` // hex SHA-256 of the token
+	Scope   Scope     `json:"scope"`
+	Path    string    `json:"path,omitempty"` // read scope only, "/" for everything
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires,omitzero"` // zero never expires
+}
+
+// Expired reports whether the token is expired at t.
+func (t *Token) Expired(now time.Time) bool {
+	return !t.Expires.IsZero() && now.After(t.Expires)
+}
+
+// Covers reports whether the URL path p is below the path of the token.
+func (t *Token) Covers(p string) bool {
+	if t.Path == "" || t.Path == "/" {
+		return true
+	}
+	p = path.Clean("/" + p)
+	return p == t.Path || strings.HasPrefix(p, t.Path+"/")
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9._@-]+$`)
+
+// New returns a token named name with a fresh secret. The secret is only
+// returned here, the token keeps its hash.
+func New(name string, scope Scope, p string, ttl time.Duration) (*Token, string, error) {
+	if !validName.MatchString(name) {
+		return nil, "", fmt.Errorf("invalid token name %q, use letters, digits and ._@-", name)
+	}
+	if p != "" && scope != ScopeRead {
+		return nil, "", errors.New("only read tokens can be limited to a path")
+	}
+	if ttl < 0 {
+		return nil, "", errors.New("expiry must not be negative")
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, "", err
+	}
+	secret := Prefix + base64.RawURLEncoding.EncodeToString(key)
+	t := &Token{
+		Name:    name,
+		Hash:    hash(secret),
+		Scope:   scope,
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+	if scope == ScopeRead {
+		t.Path = path.Clean("/" + p)
+	}
+	if ttl > 0 {
+		t.Expires = t.Created.Add(ttl)
+	}
+	return t, secret, nil
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,96 @@
+package apitoken
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tok, secret, err := New("ci", ScopeRead, "loot/", time.Hour)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(secret, Prefix))
+	require.NotContains(t, tok.Hash, secret)
+	require.Equal(t, "/loot", tok.Path)
+	require.Equal(t, tok.Created.Add(time.Hour), tok.Expires)
+
+	_, _, err = New("bad name", ScopeUpload, "", 0)
+	require.Error(t, err)
+	_, _, err = New("up", ScopeUpload, "/loot", 0)
+	require.Error(t, err)
+
+	tok, _, err = New("up", ScopeUpload, "", 0)
+	require.NoError(t, err)
+	require.True(t, tok.Expires.IsZero())
+	require.False(t, tok.Expired(time.Now().Add(24*365*time.Hour)))
+}
+
+func TestParseScope(t *testing.T) {
+	s, err := ParseScope("Catcher")
+	require.NoError(t, err)
+	require.Equal(t, ScopeCatcher, s)
+	_, err = ParseScope("admin")
+	require.Error(t, err)
+}
+func TestToken_Covers(t *testing.T) {
+	tok := &Token{Scope: ScopeRead, Path: "/loot"}
+	require.True(t, tok.Covers("/loot"))
+	require.True(t, tok.Covers("/loot/a/b.txt"))
+	require.False(t, tok.Covers("/lootbox"))
+	require.False(t, tok.Covers("/loot/../etc"))
+	require.True(t, (&Token{Path: "/"}).Covers("/anything"))
+}
+
+func TestStore(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "tokens.json")
+	s, err := Load(p)
+	require.NoError(t, err)
+
+	tok, secret, err := New("ci", ScopeUpload, "", 0)
+	require.NoError(t, err)
+	require.NoError(t, s.Add(tok))
+	require.Error(t, s.Add(tok))
+
+	data, err := os.ReadFile(p)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), secret)
+	fi, err := os.Stat(p)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	got := s.Authenticate(secret, time.Now())
+	require.NotNil(t, got)
+	require.Equal(t, "ci", got.Name)
+	require.Nil(t, s.Authenticate(secret+"x", time.Now()))
+
+	list, err := s.List()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Empty(t, list[0].Hash)
+
+	// Expired tokens are refused
+	old, oldSecret, err := New("old", ScopeEvents, "", time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, s.Add(old))
+	require.NotNil(t, s.Authenticate(oldSecret, time.Now()))
+	require.Nil(t, s.Authenticate(oldSecret, time.Now().Add(2*time.Minute)))
+
+	// A second store, like the command line, revokes for the running one
+	cli, err := Load(p)
+	require.NoError(t, err)
+	require.NoError(t, cli.Revoke("ci"))
+	require.ErrorIs(t, cli.Revoke("ci"), ErrNotFound)
+	require.Nil(t, s.Authenticate(secret, time.Now()))
+	require.NotNil(t, s.Authenticate(oldSecret, time.Now()))
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "tokens.json")
+	require.NoError(t, os.WriteFile(p, []byte("{"), 0o600))
+	_, err := Load(p)
+	require.Error(t, err)
+}
@@ -0,0 +1,174 @@
+package apitoken
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for unknown token names.
+var ErrNotFound = errors.New("token not found")
+
+// Store is the tokens file. It is read again whenever it changes on disk,
+// so tokens created or revoked with the command line apply to a running
+// server.
+type Store struct {
+	path string
+
+	mu      sync.Mutex
+	tokens  []*Token
+	modTime time.Time
+	size    int64
+}
+
+// Load reads the tokens file at path. A missing file is an empty store and
+// is created with the first token.
+func Load(path string) (*Store, error) {
+	s := &Store{path: path}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reload rereads the file if it changed since the last read.
+func (s *Store) reload() error {
+	fi, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.tokens, s.modTime, s.size = nil, time.Time{}, 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.tokens != nil && fi.ModTime().Equal(s.modTime) && fi.Size() == s.size {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	tokens := []*Token{}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	s.tokens, s.modTime, s.size = tokens, fi.ModTime(), fi.Size()
+	return nil
+}
+
+// write replaces the file atomically with mode 0600. On failure the next
+// call rereads the file.
+func (s *Store) write() (err error) {
+	defer func() {
+		if err != nil {
+			s.tokens = nil
+		}
+	}()
+	data, err := json.MarshalIndent(s.tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".goshs-tokens-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.modTime, s.size = fi.ModTime(), fi.Size()
+	return nil
+}
+
+// Authenticate returns the unexpired token matching secret, or nil.
+func (s *Store) Authenticate(secret string, now time.Time) *Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return nil
+	}
+	h := []byte(hash(secret))
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare(h, []byte(t.Hash)) == 1 {
+			if t.Expired(now) {
+				return nil
+			}
+			c := *t
+			return &c
+		}
+	}
+	return nil
+}
+
+// List returns all tokens sorted by name, without their hashes.
+func (s *Store) List() ([]Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	list := make([]Token, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		c := *t
+		c.Hash = ""
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Add stores a copy of t. Names are unique.
+func (s *Store) Add(t *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return err
+	}
+	for _, existing := range s.tokens {
+		if existing.Name == t.Name {
+			return fmt.Errorf("a token named %q exists already", t.Name)
+		}
+	}
+	c := *t
+	s.tokens = append(s.tokens, &c)
+	return s.write()
+}
+
+// Revoke deletes the token named name.
+func (s *Store) Revoke(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return err
+	}
+	for i, t := range s.tokens {
+		if t.Name == name {
+			s.tokens = append(s.tokens[:i:i], s.tokens[i+1:]...)
+			return s.write()
+		}
+	}
+	return ErrNotFound
+}
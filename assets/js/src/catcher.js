@@ -201,6 +201,21 @@ function renameListenerTab(tabId, labelEl) {
   };
 }
 
+// A listener forwarded through the tunnel is reached at its public endpoint
+function usePublicEndpoint(endpoint) {
+  let url;
+  try {
+    url = new URL(endpoint);
+  } catch {
+    return;
+  }
+  const ipInput = document.getElementById("gen-ip");
+  const portInput = document.getElementById("gen-port");
+  if (ipInput) ipInput.value = url.hostname;
+  if (portInput) portInput.value = url.port;
+  updateGeneratorOutput();
+}
+
 export function startCatcherListener(tabId) {
   const portInput = document.getElementById(`setup-port-${tabId}`);
   const port = parseInt(portInput?.value, 10);
@@ -230,6 +245,7 @@ export function startCatcherListener(tabId) {
     })
     .then((info) => {
       CT.listeners[tabId] = { id: info.id, ip: info.ip, port, sessions: [] };
+      if (info.public) usePublicEndpoint(info.public);
 
       // Update tab label to show port if user hasn't renamed it
       const tab = document.getElementById(`ctab-${tabId}`);
@@ -242,7 +258,7 @@ export function startCatcherListener(tabId) {
         setupEl.className = "catcher-listener-header";
         setupEl.removeAttribute("id");
         setupEl.innerHTML = `
-            <span>Listening on <strong>0.0.0.0:${port}</strong></span>
+            <span>Listening on <strong>0.0.0.0:${port}</strong>${info.public ? ` — public <strong>${esc(info.public)}</strong>` : ""}</span>
             <div class="catcher-header-actions">
               <button class="catcher-restart-btn" onclick="restartCatcherListener('${tabId}')">Restart</button>
               <button class="catcher-stop-btn" onclick="stopCatcherListener('${tabId}')">Stop</button>
@@ -330,6 +330,8 @@ function renderHTTP() {
       (e.method || "").toLowerCase().includes(filter) ||
       (e.source || "").toLowerCase().includes(filter) ||
       (e.useragent || "").toLowerCase().includes(filter) ||
+      (e.user || "").toLowerCase().includes(filter) ||
+      (e.certificate || "").toLowerCase().includes(filter) ||
       String(e.status || "").includes(filter),
   );
 
@@ -398,6 +400,15 @@ function renderHTTP() {
           <span class="http-detail-label">Source IP</span>
           <div class="http-detail-value">${esc(e.source || "—")}</div>
         </div>
+        ${
+          e.user || e.certificate
+            ? `
+        <div class="http-detail-field">
+          <span class="http-detail-label">User</span>
+          <div class="http-detail-value">${esc(e.user || "—")}${e.certificate ? ` (certificate ${esc(e.certificate)})` : ""}</div>
+        </div>`
+            : ""
+        }
         <div class="http-detail-field">
           <span class="http-detail-label">Status</span>
           <div class="http-detail-value">${esc(String(e.status || "—"))}</div>
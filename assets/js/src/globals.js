@@ -32,6 +32,7 @@ import {
   showRestartForm, connectCatcherSession, killCatcherSession,
   resizeCatcherTerm, toggleLineMode, upgradeCatcherUnix, upgradeCatcherWindows,
 } from "./catcher.js";
+import { loadServices, serviceAction } from "./services.js";
 
 Object.assign(window, {
   toggleTheme, switchPanel, switchCollab,
@@ -52,4 +53,5 @@ Object.assign(window, {
   startCatcherListener, restartCatcherListener, stopCatcherListener,
   showRestartForm, connectCatcherSession, killCatcherSession,
   resizeCatcherTerm, toggleLineMode, upgradeCatcherUnix, upgradeCatcherWindows,
+  loadServices, serviceAction,
 });
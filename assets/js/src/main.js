@@ -11,6 +11,7 @@ import { initCatcher } from './catcher.js';
 import { initContextMenu } from './context-menu.js';
 import { initSharedLinks } from './share.js';
 import { initPreview } from './preview.js';
+import { initServices } from './services.js';
 
 document.addEventListener("DOMContentLoaded", () => {
   const activeTab = sessionStorage.getItem("activeTab");
@@ -27,6 +28,7 @@ document.addEventListener("DOMContentLoaded", () => {
   initContextMenu();
   initSharedLinks();
   initCatcher();
+  initServices();
 
   // Register WS handlers before connecting
   const collabHandlers = initCollab();
@@ -0,0 +1,75 @@
+// ══ SERVICES ══
+import { esc } from './state.js';
+import { toast } from './modals.js';
+
+function renderServices(list) {
+  const wrap = document.getElementById("service-cards");
+  if (!wrap) return;
+  wrap.innerHTML = list
+    .map((s) => {
+      const state = s.running
+        ? `<span style="color: var(--accent)">● running since ${esc(new Date(s.since).toLocaleString())}</span>`
+        : `<span style="color: var(--text2)">○ stopped</span>`;
+      const actions = s.running
+        ? `<button class="btn btn-sm" onclick="serviceAction('restart', '${esc(s.name)}')">Restart</button>
+           <button class="btn btn-sm btn-danger" onclick="serviceAction('stop', '${esc(s.name)}')">Stop</button>`
+        : `<button class="btn btn-sm btn-accent" onclick="serviceAction('start', '${esc(s.name)}')">Start</button>`;
+      return `
+        <div class="share-card" id="service-${esc(s.name)}">
+          <div class="share-card-header">
+            <div class="share-card-title">
+              <span class="share-card-path">${esc(s.name.toUpperCase())}</span>
+            </div>
+            <div class="share-card-actions">${actions}</div>
+          </div>
+          <div class="share-card-body">
+            <div class="share-card-meta">
+              <div class="share-meta-item">${state}</div>
+              <div class="share-meta-item">
+                <label for="service-port-${esc(s.name)}">Port</label>
+                <input type="number" id="service-port-${esc(s.name)}" value="${s.port}" min="1" max="65535" />
+              </div>
+              ${s.error ? `<div class="share-meta-item" style="color: var(--danger)">${esc(s.error)}</div>` : ""}
+            </div>
+          </div>
+        </div>`;
+    })
+    .join("");
+}
+
+export function loadServices() {
+  fetch("/?services-api=status")
+    .then((r) => (r.ok ? r.json() : []))
+    .then(renderServices)
+    .catch(() => {});
+}
+
+export function serviceAction(action, name) {
+  const port = document.getElementById(`service-port-${name}`)?.value || "";
+  const csrf = document.querySelector('meta[name="csrf-token"]')?.content || "";
+  const params = new URLSearchParams({ "services-api": action, service: name, port });
+  fetch("/?" + params, {
+    method: "POST",
+    headers: { "X-CSRF-Token": csrf },
+  })
+    .then((r) => {
+      if (!r.ok)
+        return r.json().then((e) => {
+          throw new Error(e.error || "Failed");
+        });
+      return r.json();
+    })
+    .then((list) => {
+      renderServices(list);
+      toast(`${name.toUpperCase()} ${action === "stop" ? "stopped" : "started"}`, "success");
+    })
+    .catch((e) => {
+      toast(e.message, "error");
+      loadServices();
+    });
+}
+
+export function initServices() {
+  if (!document.getElementById("panel-services")) return;
+  loadServices();
+}
@@ -0,0 +1,50 @@
+package ca
+
+import (
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
+)
+
+// TXTRecords is a DNS server that serves TXT records, like the goshs DNS
+// server answering the DNS-01 challenges.
+type TXTRecords interface {
+	AddTXT(fqdn, value string)
+	RemoveTXT(fqdn, value string)
+}
+
+// dnsProvider solves DNS-01 challenges by serving the record itself.
+type dnsProvider struct {
+	records TXTRecords
+}
+
+func (p dnsProvider) Present(domain, _, keyAuth string) error {
+	info := dns01.GetChallengeInfo(domain, keyAuth)
+	p.records.AddTXT(info.EffectiveFQDN, info.Value)
+	return nil
+}
+
+func (p dnsProvider) CleanUp(domain, _, keyAuth string) error {
+	info := dns01.GetChallengeInfo(domain, keyAuth)
+	p.records.RemoveTXT(info.EffectiveFQDN, info.Value)
+	return nil
+}
+
+// alpnProvider solves TLS-ALPN-01 challenges on the listener already
+// serving the KeyPair, for renewals while goshs holds the TLS port.
+type alpnProvider struct {
+	pair *KeyPair
+}
+
+func (p alpnProvider) Present(domain, _, keyAuth string) error {
+	cert, err := tlsalpn01.ChallengeCert(domain, keyAuth)
+	if err != nil {
+		return err
+	}
+	p.pair.setChallenge(domain, cert)
+	return nil
+}
+
+func (p alpnProvider) CleanUp(domain, _, _ string) error {
+	p.pair.setChallenge(domain, nil)
+	return nil
+}
@@ -0,0 +1,26 @@
+package ca
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type txtRecords map[string][]string
+
+func (r txtRecords) AddTXT(fqdn, value string) { r[fqdn] = append(r[fqdn], value) }
+
+func (r txtRecords) RemoveTXT(fqdn, _ string) { delete(r, fqdn) }
+
+func TestDNSProvider(t *testing.T) {
+	t.Setenv("LEGO_DISABLE_CNAME_SUPPORT", "true")
+	records := txtRecords{}
+	provider := dnsProvider{records: records}
+
+	require.NoError(t, provider.Present("files.lab", "token", "token.key"))
+	require.Len(t, records["_acme-challenge.files.lab."], 1)
+	require.NotEqual(t, "token.key", records["_acme-challenge.files.lab."][0])
+
+	require.NoError(t, provider.CleanUp("files.lab", "token", "token.key"))
+	require.Empty(t, records)
+}
@@ -0,0 +1,461 @@
+package ca
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"goshs.de/goshs/v2/config"
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+const (
+	authorityCertFile = "ca.crt"
+	authorityKeyFile  = "ca.key"
+	serverCertFile    = "server.crt"
+	serverKeyFile     = "server.key"
+	issuedFile        = "issued.json"
+
+	// serverRenewal is how long before expiry a server certificate is reissued.
+	serverRenewal = 30 * 24 * time.Hour
+)
+
+// ErrClientRequest is wrapped by the errors IssueClient returns for invalid
+// arguments.
+var ErrClientRequest = errors.New("invalid client certificate request")
+
+var subject = pkix.Name{
+	Organization:       []string{"hesec.de"},
+	OrganizationalUnit: []string{"hesec.de"},
+	CommonName:         "goshs - SimpleHTTPServer",
+	Country:            []string{"DE"},
+	Province:           []string{"BW"},
+	Locality:           []string{"Althengstett"},
+	StreetAddress:      []string{"Gopher-Street"},
+	PostalCode:         []string{"75382"},
+}
+
+// Authority is the self-signed CA of goshs, kept on disk so its server
+// certificate and fingerprints stay the same across restarts.
+type Authority struct {
+	dir  string
+	mu   sync.Mutex
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+// IssuedCert records a client certificate the authority signed.
+type IssuedCert struct {
+	Serial      string     `json:"serial"`
+	Name        string     `json:"name"`
+	Created     time.Time  `json:"created"`
+	Expires     time.Time  `json:"expires"`
+	Fingerprint string     `json:"fingerprint"` // SHA-256
+	Revoked     *time.Time `json:"revoked,omitempty"`
+}
+
+// Open loads the authority in dir and creates it on first use. An empty dir
+// selects the ca directory below config.Dir().
+func Open(dir string) (*Authority, error) {
+	dir, err := resolveDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating ca directory %s: %w", dir, err)
+	}
+
+	a := &Authority{dir: dir}
+	cert, key, err := loadPair(filepath.Join(dir, authorityCertFile), filepath.Join(dir, authorityKeyFile))
+	switch {
+	case err == nil:
+		if !cert.IsCA {
+			return nil, fmt.Errorf("%s is no CA certificate", filepath.Join(dir, authorityCertFile))
+		}
+		a.cert, a.key = cert, key
+	case errors.Is(err, os.ErrNotExist):
+		if err := a.create(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	return a, nil
+}
+
+func resolveDir(dir string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	base, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "ca"), nil
+}
+
+func (a *Authority) create() error {
+	key, err := rsa.GenerateKey(rand.Reader, 4096)
+	if err != nil {
+		return err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	if err := writePair(filepath.Join(a.dir, authorityCertFile), filepath.Join(a.dir, authorityKeyFile), der, key); err != nil {
+		return err
+	}
+	a.cert, a.key = cert, key
+	return nil
+}
+
+// Dir returns the directory the authority is kept in.
+func (a *Authority) Dir() string { return a.dir }
+
+// CertFile returns the path of the CA certificate, as taken by -ca.
+func (a *Authority) CertFile() string { return CertPath(a.dir) }
+
+// CertPath returns the path of the CA certificate of the authority in dir.
+func CertPath(dir string) string { return filepath.Join(dir, authorityCertFile) }
+
+// Certificate returns the CA certificate.
+func (a *Authority) Certificate() *x509.Certificate { return a.cert }
+
+// CertPEM returns the PEM encoded CA certificate.
+func (a *Authority) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.cert.Raw})
+}
+
+// ServerTLSConfig returns the TLS config with the server certificate of the
+// authority. The certificate is reused while it covers the local addresses
+// and hosts and is reissued, keeping its names, otherwise.
+func (a *Authority) ServerTLSConfig(hosts []string) (serverTLSConf *tls.Config, sha256s, sha1s string, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ips, names := wantedNames(hosts)
+	certPath, keyPath := filepath.Join(a.dir, serverCertFile), filepath.Join(a.dir, serverKeyFile)
+	cert, key, err := loadPair(certPath, keyPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, "", "", err
+	}
+	if err != nil || !a.covers(cert, ips, names) {
+		if cert != nil {
+			ips = mergeIPs(ips, cert.IPAddresses)
+			names = mergeNames(names, cert.DNSNames)
+		}
+		if cert, key, err = a.issueServer(ips, names); err != nil {
+			return nil, "", "", err
+		}
+		if err := writePair(certPath, keyPath, cert.Raw, key); err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	serverTLSConf = &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{cert.Raw, a.cert.Raw},
+			PrivateKey:  key,
+			Leaf:        cert,
+		}},
+		MinVersion: tls.VersionTLS12,
+	}
+	sha256s, sha1s = Sum(cert.Raw)
+	return serverTLSConf, sha256s, sha1s, nil
+}
+
+// covers reports whether cert is a current certificate of the authority for
+// all of ips and names.
+func (a *Authority) covers(cert *x509.Certificate, ips []net.IP, names []string) bool {
+	if cert.CheckSignatureFrom(a.cert) != nil || time.Until(cert.NotAfter) < serverRenewal {
+		return false
+	}
+	for _, ip := range ips {
+		if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+			return false
+		}
+	}
+	for _, name := range names {
+		if !slices.Contains(cert.DNSNames, name) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *Authority) issueServer(ips []net.IP, names []string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	tmpl := &x509.Certificate{
+		Subject:     subject,
+		IPAddresses: ips,
+		DNSNames:    names,
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().AddDate(2, 0, 0),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	return a.sign(tmpl, 4096)
+}
+
+// IssueClient signs a client certificate for name, valid for days, and
+// returns it with its key and the CA as PKCS#12 protected by password.
+func (a *Authority) IssueClient(name string, days int, password string) ([]byte, *IssuedCert, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, nil, fmt.Errorf("%w: a name is required", ErrClientRequest)
+	}
+	if days <= 0 {
+		return nil, nil, fmt.Errorf("%w: the validity must be at least one day", ErrClientRequest)
+	}
+	if password == "" {
+		return nil, nil, fmt.Errorf("%w: a password is required", ErrClientRequest)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name, Organization: subject.Organization},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.AddDate(0, 0, days),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}
+	cert, key, err := a.sign(tmpl, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	p12, err := pkcs12.Modern.Encode(key, cert, []*x509.Certificate{a.cert}, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fingerprint, _ := Sum(cert.Raw)
+	issued := &IssuedCert{
+		Serial:      cert.SerialNumber.Text(16),
+		Name:        name,
+		Created:     now.UTC().Truncate(time.Second),
+		Expires:     cert.NotAfter.UTC(),
+		Fingerprint: strings.ReplaceAll(strings.TrimSpace(fingerprint), " ", ""),
+	}
+	list, err := a.readIssued()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := a.writeIssued(append(list, *issued)); err != nil {
+		return nil, nil, err
+	}
+	return p12, issued, nil
+}
+
+// MarkRevoked records in the list of issued certificates that serial was
+// revoked. Serials the authority did not issue are ignored.
+func (a *Authority) MarkRevoked(serial string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	list, err := a.readIssued()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	changed := false
+	for i := range list {
+		if list[i].Serial == serial && list[i].Revoked == nil {
+			list[i].Revoked = &now
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return a.writeIssued(list)
+}
+
+// RevokedFile returns the path of the serial blocklist next to the CA.
+func (a *Authority) RevokedFile() string { return filepath.Join(a.dir, RevokedFile) }
+
+// Issued lists the client certificates the authority signed.
+func (a *Authority) Issued() ([]IssuedCert, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.readIssued()
+}
+
+func (a *Authority) readIssued() ([]IssuedCert, error) {
+	data, err := os.ReadFile(filepath.Join(a.dir, issuedFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return []IssuedCert{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []IssuedCert
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", issuedFile, err)
+	}
+	return list, nil
+}
+
+func (a *Authority) writeIssued(list []IssuedCert) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(a.dir, issuedFile), append(data, '\n'), 0600)
+}
+
+func (a *Authority) sign(tmpl *x509.Certificate, bits int) (*x509.Certificate, *rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tmpl.SerialNumber, err = serialNumber(); err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.cert, &key.PublicKey, a.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// serialNumber returns a random 128 bit serial number.
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// wantedNames splits hosts into addresses and names and adds the loopback
+// and the addresses of all local interfaces.
+func wantedNames(hosts []string) ([]net.IP, []string) {
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	names := []string{"localhost"}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+				ips = mergeIPs(ips, []net.IP{ipNet.IP})
+			}
+		}
+	}
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			ips = mergeIPs(ips, []net.IP{ip})
+		} else {
+			names = mergeNames(names, []string{strings.ToLower(host)})
+		}
+	}
+	return ips, names
+}
+
+func mergeIPs(ips []net.IP, more []net.IP) []net.IP {
+	for _, ip := range more {
+		if !slices.ContainsFunc(ips, ip.Equal) {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+func mergeNames(names []string, more []string) []string {
+	for _, name := range more {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func loadPair(certPath, keyPath string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, nil, fmt.Errorf("failed to decode PEM block from %s", certPath)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf("failed to decode PEM block from %s", keyPath)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+func writePair(certPath, keyPath string, der []byte, key *rsa.PrivateKey) error {
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := writeFile(keyPath, keyPEM, 0600); err != nil {
+		return err
+	}
+	return writeFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// writeFile replaces path atomically.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".goshs-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
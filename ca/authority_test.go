@@ -0,0 +1,141 @@
+package ca
+
+import (
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+func TestAuthority_Persists(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ca")
+	a, err := Open(dir)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "ca.crt"), a.CertFile())
+	require.Equal(t, a.CertFile(), CertPath(dir))
+	require.True(t, a.cert.IsCA)
+
+	info, err := os.Stat(filepath.Join(dir, "ca.key"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	conf, sha256s, _, err := a.ServerTLSConfig([]string{"files.lab", "10.13.37.1"})
+	require.NoError(t, err)
+	leaf := conf.Certificates[0].Leaf
+	require.Contains(t, leaf.DNSNames, "files.lab")
+	require.Contains(t, leaf.DNSNames, "localhost")
+	require.True(t, containsIP(leaf.IPAddresses, net.ParseIP("10.13.37.1")))
+	require.True(t, containsIP(leaf.IPAddresses, net.ParseIP("127.0.0.1")))
+	require.NoError(t, leaf.CheckSignatureFrom(a.cert))
+
+	// A restart reuses the CA and the server certificate
+	again, err := Open(dir)
+	require.NoError(t, err)
+	require.Equal(t, a.CertPEM(), again.CertPEM())
+	_, reused, _, err := again.ServerTLSConfig([]string{"FILES.lab"})
+	require.NoError(t, err)
+	require.Equal(t, sha256s, reused)
+
+	// A new host reissues the certificate and keeps the old names
+	conf, changed, _, err := again.ServerTLSConfig([]string{"other.lab"})
+	require.NoError(t, err)
+	require.NotEqual(t, sha256s, changed)
+	leaf = conf.Certificates[0].Leaf
+	require.Contains(t, leaf.DNSNames, "files.lab")
+	require.Contains(t, leaf.DNSNames, "other.lab")
+	require.True(t, containsIP(leaf.IPAddresses, net.ParseIP("10.13.37.1")))
+}
+
+func TestAuthority_NoCA(t *testing.T) {
+	dir := t.TempDir()
+	a, err := Open(dir)
+	require.NoError(t, err)
+	_, _, _, err = a.ServerTLSConfig(nil)
+	require.NoError(t, err)
+	require.NoError(t, os.Rename(filepath.Join(dir, "server.crt"), filepath.Join(dir, "ca.crt")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.key")))
+
+	_, err = Open(dir)
+	require.ErrorContains(t, err, "no CA certificate")
+}
+
+func TestAuthority_IssueClient(t *testing.T) {
+	a, err := Open(t.TempDir())
+	require.NoError(t, err)
+
+	p12, issued, err := a.IssueClient("alice", 30, "s3cret")
+	require.NoError(t, err)
+	require.Equal(t, "alice", issued.Name)
+
+	key, cert, chain, err := pkcs12.DecodeChain(p12, "s3cret")
+	require.NoError(t, err)
+	require.NotNil(t, key)
+	require.Equal(t, "alice", cert.Subject.CommonName)
+	require.Equal(t, issued.Serial, cert.SerialNumber.Text(16))
+	require.Len(t, chain, 1)
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(a.CertPEM())
+	_, err = cert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	require.NoError(t, err)
+
+	_, _, _, err = pkcs12.DecodeChain(p12, "wrong")
+	require.Error(t, err)
+
+	list, err := a.Issued()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, *issued, list[0])
+
+	require.NoError(t, a.MarkRevoked(issued.Serial))
+	require.NoError(t, a.MarkRevoked("abc"))
+	list, err = a.Issued()
+	require.NoError(t, err)
+	require.NotNil(t, list[0].Revoked)
+
+	for _, tc := range []struct {
+		name, password string
+		days           int
+	}{
+		{"", "pw", 1},
+		{"bob", "pw", 0},
+		{"bob", "", 1},
+	} {
+		_, _, err := a.IssueClient(tc.name, tc.days, tc.password)
+		require.ErrorIs(t, err, ErrClientRequest)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	t.Cleanup(func() {
+		persist.Lock()
+		persist.enabled = false
+		persist.authority = nil
+		persist.Unlock()
+	})
+	dir := t.TempDir()
+	Persist(dir, []string{"files.lab"})
+
+	_, sha256s, _, err := Setup()
+	require.NoError(t, err)
+	_, again, _, err := Setup()
+	require.NoError(t, err)
+	require.Equal(t, sha256s, again)
+
+	a, err := Persisted()
+	require.NoError(t, err)
+	require.Equal(t, CertPath(dir), a.CertFile())
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
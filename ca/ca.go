@@ -21,6 +21,7 @@ import (
 	"math/big"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"goshs.de/goshs/v2/logger"
@@ -98,8 +99,57 @@ func ParseAndSum(cert string) (sha256s, sha1s string, err error) {
 	return sha256s, sha1s, nil
 }
 
+var persist struct {
+	sync.Mutex
+	enabled   bool
+	dir       string
+	hosts     []string
+	authority *Authority
+}
+
+// Persist makes Setup use the Authority in dir, with a server certificate
+// for hosts next to the local addresses, instead of a new CA on every call.
+func Persist(dir string, hosts []string) {
+	persist.Lock()
+	defer persist.Unlock()
+	persist.enabled = true
+	persist.dir = dir
+	persist.hosts = hosts
+	persist.authority = nil
+}
+
+// Persisted returns the Authority set up by Persist, nil without Persist.
+func Persisted() (*Authority, error) {
+	a, _, err := persisted()
+	return a, err
+}
+
+func persisted() (*Authority, []string, error) {
+	persist.Lock()
+	defer persist.Unlock()
+	if !persist.enabled {
+		return nil, nil, nil
+	}
+	if persist.authority == nil {
+		a, err := Open(persist.dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		persist.authority = a
+	}
+	return persist.authority, persist.hosts, nil
+}
+
 // Setup will deliver a fully initialized CA and server cert
 func Setup() (serverTLSConf *tls.Config, sha256s, sha1s string, err error) {
+	a, hosts, err := persisted()
+	if err != nil {
+		return nil, "", "", err
+	}
+	if a != nil {
+		return a.ServerTLSConfig(hosts)
+	}
+
 	randInt, err := randomSerial()
 	if err != nil {
 		logger.Errorf("when creating certificate: %+v", err)
@@ -0,0 +1,79 @@
+package ca
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/howeyc/gopass"
+	"goshs.de/goshs/v2/logger"
+)
+
+// ClientCertCommand issues a client certificate for name, asks for the
+// password of the PKCS#12 file and writes it to out. It exits when done.
+func ClientCertCommand(dir, name, out string, days int) {
+	a, err := Open(dir)
+	if err != nil {
+		logger.Fatalf("error opening the goshs CA: %+v", err)
+	}
+	if out == "" {
+		out = name + ".p12"
+	}
+
+	fmt.Printf("Enter password for %s: ", out)
+	password, err := gopass.GetPasswdMasked()
+	if err != nil {
+		logger.Fatalf("error reading password from stdin: %+v", err)
+	}
+	fmt.Printf("Repeat password: ")
+	repeated, err := gopass.GetPasswdMasked()
+	if err != nil {
+		logger.Fatalf("error reading password from stdin: %+v", err)
+	}
+	if string(password) != string(repeated) {
+		logger.Fatal("The passwords do not match.")
+	}
+
+	p12, issued, err := a.IssueClient(name, days, string(password))
+	if err != nil {
+		logger.Fatalf("error issuing client certificate: %+v", err)
+	}
+	if err := os.WriteFile(out, p12, 0600); err != nil {
+		logger.Fatalf("error writing %s: %+v", out, err)
+	}
+	fmt.Printf("Issued client certificate %s (serial %s) valid until %s: %s\n", issued.Name, issued.Serial, issued.Expires.Local().Format("2006-01-02"), out)
+	fmt.Printf("Require it with: goshs -s -ss -ca self (CA certificate: %s)\n", a.CertFile())
+	os.Exit(0)
+}
+
+// RevokeCommand adds serial to the blocklist serialsFile, by default the one
+// of the CA in dir, and marks it revoked in the list of issued certificates.
+// It exits when done.
+func RevokeCommand(dir, serialsFile, serial string) {
+	dir, err := resolveDir(dir)
+	if err != nil {
+		logger.Fatalf("error locating the goshs CA: %+v", err)
+	}
+	if serialsFile == "" {
+		serialsFile = filepath.Join(dir, RevokedFile)
+	}
+	r, err := LoadRevocations(serialsFile, "", nil)
+	if err != nil {
+		logger.Fatalf("error reading revoked serials: %+v", err)
+	}
+	revoked, err := r.Revoke(serial)
+	if err != nil {
+		logger.Fatalf("error revoking client certificate: %+v", err)
+	}
+	if _, err := os.Stat(CertPath(dir)); err == nil {
+		a, err := Open(dir)
+		if err != nil {
+			logger.Fatalf("error opening the goshs CA: %+v", err)
+		}
+		if err := a.MarkRevoked(revoked); err != nil {
+			logger.Warnf("error updating the issued certificates: %+v", err)
+		}
+	}
+	fmt.Printf("Revoked client certificate %s in %s\n", revoked, serialsFile)
+	os.Exit(0)
+}
@@ -0,0 +1,114 @@
+package ca
+
+import (
+	"bufio"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"goshs.de/goshs/v2/users"
+)
+
+// Identity names a client certificate: its common name or, without one,
+// the first email address, DNS name or URI it was issued for.
+func Identity(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if names := identities(cert); len(names) > 0 {
+		return names[0]
+	}
+	return cert.SerialNumber.Text(16)
+}
+
+// identities lists every name of cert a mapping may match.
+func identities(cert *x509.Certificate) []string {
+	var names []string
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.EmailAddresses...)
+	names = append(names, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return names
+}
+
+// Mapping assigns the certificates with a common name or SAN of Identity to
+// a user. An empty Role leaves the role to the users file.
+type Mapping struct {
+	Identity string
+	User     string
+	Role     users.Role
+}
+
+// IdentityMap maps client certificates to users, read from a file with one
+// "identity user [role]" per line.
+type IdentityMap struct {
+	mappings []Mapping
+}
+
+// LoadIdentityMap reads the mapping file at path.
+func LoadIdentityMap(path string) (*IdentityMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := ParseIdentityMap(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// ParseIdentityMap parses the lines of a mapping file. Empty lines and lines
+// starting with # are skipped.
+func ParseIdentityMap(r io.Reader) (*IdentityMap, error) {
+	m := &IdentityMap{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected identity user [role]", line)
+		}
+		mapping := Mapping{Identity: fields[0], User: fields[1]}
+		if len(fields) == 3 {
+			mapping.Role = users.Role(strings.ToLower(fields[2]))
+			switch mapping.Role {
+			case users.RoleRead, users.RoleUpload, users.RoleFull, users.RoleAdmin:
+			default:
+				return nil, fmt.Errorf("line %d: unknown role %q", line, fields[2])
+			}
+		}
+		m.mappings = append(m.mappings, mapping)
+	}
+	return m, scanner.Err()
+}
+
+// Lookup returns the first mapping matching the common name or a SAN of
+// cert, ignoring case, or nil.
+func (m *IdentityMap) Lookup(cert *x509.Certificate) *Mapping {
+	names := identities(cert)
+	for i := range m.mappings {
+		for _, name := range names {
+			if strings.EqualFold(m.mappings[i].Identity, name) {
+				return &m.mappings[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Len returns the number of mappings.
+func (m *IdentityMap) Len() int { return len(m.mappings) }
@@ -0,0 +1,66 @@
+package ca
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/users"
+)
+
+func TestIdentity(t *testing.T) {
+	cert := &x509.Certificate{SerialNumber: big.NewInt(0xff), Subject: pkix.Name{CommonName: "laptop-01"}}
+	require.Equal(t, "laptop-01", Identity(cert))
+
+	cert.Subject.CommonName = ""
+	cert.EmailAddresses = []string{"alice@example.com"}
+	require.Equal(t, "alice@example.com", Identity(cert))
+
+	cert.EmailAddresses = nil
+	require.Equal(t, "ff", Identity(cert))
+}
+
+func TestIdentityMap(t *testing.T) {
+	m, err := ParseIdentityMap(strings.NewReader(`
+# identity user [role]
+laptop-01          alice admin
+bob@example.com    bob
+spiffe://lab/ci    ci     READ
+`))
+	require.NoError(t, err)
+	require.Equal(t, 3, m.Len())
+
+	mapping := m.Lookup(&x509.Certificate{Subject: pkix.Name{CommonName: "Laptop-01"}})
+	require.NotNil(t, mapping)
+	require.Equal(t, "alice", mapping.User)
+	require.Equal(t, users.RoleAdmin, mapping.Role)
+
+	mapping = m.Lookup(&x509.Certificate{Subject: pkix.Name{CommonName: "phone"}, EmailAddresses: []string{"bob@example.com"}})
+	require.NotNil(t, mapping)
+	require.Equal(t, "bob", mapping.User)
+	require.Empty(t, mapping.Role)
+
+	uri, _ := url.Parse("spiffe://lab/ci")
+	mapping = m.Lookup(&x509.Certificate{URIs: []*url.URL{uri}})
+	require.NotNil(t, mapping)
+	require.Equal(t, users.RoleRead, mapping.Role)
+
+	require.Nil(t, m.Lookup(&x509.Certificate{Subject: pkix.Name{CommonName: "stranger"}}))
+}
+
+func TestIdentityMap_Errors(t *testing.T) {
+	for _, in := range []string{
+		"laptop-01",
+		"laptop-01 alice admin extra",
+		"laptop-01 alice root",
+	} {
+		_, err := ParseIdentityMap(strings.NewReader(in))
+		require.Error(t, err, in)
+	}
+	_, err := LoadIdentityMap("/nonexistent/ca-map")
+	require.Error(t, err)
+}
@@ -0,0 +1,185 @@
+package ca
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"goshs.de/goshs/v2/logger"
+)
+
+// keyPairCheck is how often a handshake looks for changed files at most.
+const keyPairCheck = 5 * time.Second
+
+// acmeTLS1Protocol is the ALPN protocol of the ACME TLS-ALPN-01 challenge.
+const acmeTLS1Protocol = "acme-tls/1"
+
+// KeyPair serves a certificate and key from disk via GetCertificate and
+// loads them again when either file changes, so a renewed or rotated
+// certificate needs no restart. It also answers TLS-ALPN-01 challenges on the
+// listener it is used for.
+type KeyPair struct {
+	certFile string
+	keyFile  string
+
+	mu         sync.RWMutex
+	cert       *tls.Certificate
+	reloaded   []func(*x509.Certificate)
+	certMod    time.Time
+	keyMod     time.Time
+	checked    time.Time
+	challenges map[string]*tls.Certificate
+}
+
+// LoadKeyPair loads the PEM encoded certificate and key.
+func LoadKeyPair(certFile, keyFile string) (*KeyPair, error) {
+	k := &KeyPair{certFile: certFile, keyFile: keyFile}
+	if _, err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+var keyPairs = struct {
+	sync.Mutex
+	m map[[2]string]*KeyPair
+}{m: map[[2]string]*KeyPair{}}
+
+// SharedKeyPair returns the KeyPair of certFile and keyFile, loaded once for
+// every listener serving them.
+func SharedKeyPair(certFile, keyFile string) (*KeyPair, error) {
+	keyPairs.Lock()
+	defer keyPairs.Unlock()
+	id := [2]string{certFile, keyFile}
+	if k := keyPairs.m[id]; k != nil {
+		return k, nil
+	}
+	k, err := LoadKeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPairs.m[id] = k
+	return k, nil
+}
+
+// OnReload registers fn to be called with the new certificate after a
+// reload.
+func (k *KeyPair) OnReload(fn func(*x509.Certificate)) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.reloaded = append(k.reloaded, fn)
+}
+
+// Leaf returns the certificate currently served.
+func (k *KeyPair) Leaf() *x509.Certificate {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.cert.Leaf
+}
+
+// Reload loads the files again if they changed since the last load and
+// reports whether they did. A broken pair keeps the previous certificate.
+func (k *KeyPair) Reload() (bool, error) {
+	certInfo, err := os.Stat(k.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyInfo, err := os.Stat(k.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	k.mu.Lock()
+	k.checked = time.Now()
+	unchanged := k.cert != nil && certInfo.ModTime().Equal(k.certMod) && keyInfo.ModTime().Equal(k.keyMod)
+	k.mu.Unlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(k.certFile, k.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	k.mu.Lock()
+	k.cert = &cert
+	k.certMod, k.keyMod = certInfo.ModTime(), keyInfo.ModTime()
+	reloaded := k.reloaded
+	k.mu.Unlock()
+
+	for _, fn := range reloaded {
+		fn(cert.Leaf)
+	}
+	return true, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (k *KeyPair) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if slices.Contains(hello.SupportedProtos, acmeTLS1Protocol) {
+		k.mu.RLock()
+		cert := k.challenges[strings.ToLower(hello.ServerName)]
+		k.mu.RUnlock()
+		if cert == nil {
+			return nil, errors.New("no ACME challenge for " + hello.ServerName)
+		}
+		return cert, nil
+	}
+
+	k.mu.RLock()
+	stale := time.Since(k.checked) > keyPairCheck
+	k.mu.RUnlock()
+	if stale {
+		if changed, err := k.Reload(); err != nil {
+			logger.Warnf("keeping the previous TLS certificate: %+v", err)
+		} else if changed {
+			logger.Infof("Reloaded TLS certificate %s", k.certFile)
+		}
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.cert, nil
+}
+
+// TLSConfig returns a server config serving the key pair. net/http adds its
+// own protocols to NextProtos. TLS-ALPN-01 validations get a config of
+// their own, so they pass even when client certificates are required.
+func (k *KeyPair) TLSConfig() *tls.Config {
+	challenge := &tls.Config{
+		GetCertificate: k.GetCertificate,
+		NextProtos:     []string{acmeTLS1Protocol},
+		MinVersion:     tls.VersionTLS12,
+	}
+	return &tls.Config{
+		GetCertificate: k.GetCertificate,
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			if slices.Contains(hello.SupportedProtos, acmeTLS1Protocol) {
+				return challenge, nil
+			}
+			return nil, nil
+		},
+		NextProtos: []string{acmeTLS1Protocol},
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+// setChallenge serves cert to TLS-ALPN-01 validations of domain, nil
+// removes it.
+func (k *KeyPair) setChallenge(domain string, cert *tls.Certificate) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.challenges == nil {
+		k.challenges = map[string]*tls.Certificate{}
+	}
+	if cert == nil {
+		delete(k.challenges, strings.ToLower(domain))
+		return
+	}
+	k.challenges[strings.ToLower(domain)] = cert
+}
@@ -0,0 +1,147 @@
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeyPair writes a self-signed certificate for name, valid for
+// validity, and its key.
+func writeKeyPair(t *testing.T, certFile, keyFile, name string, validity time.Duration) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validity),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+func TestKeyPair_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert"), filepath.Join(dir, "key")
+	writeKeyPair(t, certFile, keyFile, "old.lab", 90*24*time.Hour)
+
+	pair, err := LoadKeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	require.Equal(t, "old.lab", pair.Leaf().Subject.CommonName)
+
+	var reloaded []string
+	pair.OnReload(func(leaf *x509.Certificate) { reloaded = append(reloaded, leaf.Subject.CommonName) })
+
+	changed, err := pair.Reload()
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	// A renewed pair is served by the next handshake
+	writeKeyPair(t, certFile, keyFile, "new.lab", 90*24*time.Hour)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	require.NoError(t, os.Chtimes(keyFile, later, later))
+	pair.checked = time.Time{}
+
+	cert, err := pair.GetCertificate(&tls.ClientHelloInfo{ServerName: "new.lab"})
+	require.NoError(t, err)
+	require.Equal(t, "new.lab", cert.Leaf.Subject.CommonName)
+	require.Equal(t, []string{"new.lab"}, reloaded)
+
+	// A broken pair keeps the previous certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+	require.NoError(t, os.Chtimes(keyFile, later.Add(time.Minute), later.Add(time.Minute)))
+	_, err = pair.Reload()
+	require.Error(t, err)
+	require.Equal(t, "new.lab", pair.Leaf().Subject.CommonName)
+}
+
+func TestKeyPair_ALPNChallenge(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert"), filepath.Join(dir, "key")
+	writeKeyPair(t, certFile, keyFile, "files.lab", 90*24*time.Hour)
+	pair, err := LoadKeyPair(certFile, keyFile)
+	require.NoError(t, err)
+
+	conf := pair.TLSConfig()
+	conf.ClientAuth = tls.RequireAndVerifyClientCert
+	hello := &tls.ClientHelloInfo{ServerName: "files.lab", SupportedProtos: []string{acmeTLS1Protocol}}
+
+	// Validations do not need a client certificate
+	challengeConf, err := conf.GetConfigForClient(hello)
+	require.NoError(t, err)
+	require.Equal(t, tls.NoClientCert, challengeConf.ClientAuth)
+	plain, err := conf.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "files.lab", SupportedProtos: []string{"h2"}})
+	require.NoError(t, err)
+	require.Nil(t, plain)
+
+	_, err = challengeConf.GetCertificate(hello)
+	require.Error(t, err)
+
+	provider := alpnProvider{pair: pair}
+	require.NoError(t, provider.Present("Files.lab", "token", "token.key"))
+	cert, err := challengeConf.GetCertificate(hello)
+	require.NoError(t, err)
+	require.NotEqual(t, pair.Leaf().Raw, cert.Certificate[0])
+
+	require.NoError(t, provider.CleanUp("files.lab", "token", "token.key"))
+	_, err = challengeConf.GetCertificate(hello)
+	require.Error(t, err)
+}
+
+func TestSharedKeyPair(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert"), filepath.Join(dir, "key")
+	writeKeyPair(t, certFile, keyFile, "files.lab", 90*24*time.Hour)
+
+	a, err := SharedKeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	b, err := SharedKeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	require.Same(t, a, b)
+
+	_, err = SharedKeyPair(filepath.Join(dir, "missing"), keyFile)
+	require.Error(t, err)
+}
+
+func TestRenewalDue(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert"), filepath.Join(dir, "key")
+
+	writeKeyPair(t, certFile, keyFile, "files.lab", 90*24*time.Hour)
+	due, err := RenewalDue(certFile)
+	require.NoError(t, err)
+	require.False(t, due)
+
+	writeKeyPair(t, certFile, keyFile, "files.lab", 10*24*time.Hour)
+	due, err = RenewalDue(certFile)
+	require.NoError(t, err)
+	require.True(t, due)
+
+	// A current certificate is not requested again
+	u := &LetsEncryptUser{Domains: []string{"files.lab"}}
+	writeKeyPair(t, certFile, keyFile, "files.lab", 90*24*time.Hour)
+	require.NoError(t, u.EnsureCertificate(certFile, keyFile))
+	require.Nil(t, u.Client)
+
+	_, err = RenewalDue(filepath.Join(dir, "missing"))
+	require.Error(t, err)
+}
@@ -6,12 +6,20 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-acme/lego/v4/certcrypto"
 	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/challenge/dns01"
 	"github.com/go-acme/lego/v4/challenge/http01"
 	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
 	"github.com/go-acme/lego/v4/lego"
@@ -19,6 +27,20 @@ import (
 	"goshs.de/goshs/v2/logger"
 )
 
+const (
+	// leRenewBefore is how long before it expires a certificate is renewed.
+	leRenewBefore = 30 * 24 * time.Hour
+	// leRenewCheck is how often the renewal loop looks at the certificate.
+	leRenewCheck = 12 * time.Hour
+)
+
+// The ACME challenges goshs can solve, selected with -le-challenges.
+const (
+	ChallengeHTTP = "http"
+	ChallengeTLS  = "tls"
+	ChallengeDNS  = "dns"
+)
+
 // LetsEncryptUser is the struct of all information needed to rollout a lets encrypt certificate
 type LetsEncryptUser struct {
 	Email        string
@@ -29,6 +51,17 @@ type LetsEncryptUser struct {
 	Domains      []string
 	Config       *lego.Config
 	Client       *lego.Client
+
+	// DirectoryURL is the ACME directory, Let's Encrypt production if empty
+	DirectoryURL string
+	// CACert is a PEM file with the CA of the ACME server, like Pebble's
+	CACert string
+	// Challenges lists the challenges to solve, http and tls if empty
+	Challenges []string
+	// DNS serves the DNS-01 challenges
+	DNS TXTRecords
+	// Serving answers TLS-ALPN-01 challenges while goshs holds the TLS port
+	Serving *KeyPair
 }
 
 // GetEmail will return the Users Email
@@ -46,42 +79,99 @@ func (u *LetsEncryptUser) GetPrivateKey() crypto.PrivateKey {
 	return u.Key
 }
 
-func (u *LetsEncryptUser) RequestCertificate() ([]byte, []byte) {
+// client registers a new account with the ACME server once.
+func (u *LetsEncryptUser) client() error {
+	if u.Client != nil {
+		return nil
+	}
+
 	// Create a user. New accounts need an email and private key to start.
 	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		logger.Fatalf("error generating private key for lets encrypt: %+v", err)
+		return fmt.Errorf("generating private key: %w", err)
 	}
-
 	u.Key = privateKey
 
 	u.Config = lego.NewConfig(u)
-
-	// This CA URL is configured for a local dev instance of Boulder running in Docker in a VM.
+	if u.DirectoryURL != "" {
+		u.Config.CADirURL = u.DirectoryURL
+	}
 	u.Config.Certificate.KeyType = certcrypto.RSA2048
+	if u.CACert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pemBytes, err := os.ReadFile(u.CACert)
+		if err != nil {
+			return err
+		}
+		if !pool.AppendCertsFromPEM(pemBytes) {
+			return fmt.Errorf("no certificate found in %s", u.CACert)
+		}
+		if transport, ok := u.Config.HTTPClient.Transport.(*http.Transport); ok {
+			transport.TLSClientConfig.RootCAs = pool
+		}
+	}
 
 	// A client facilitates communication with the CA server.
-	u.Client, err = lego.NewClient(u.Config)
+	client, err := lego.NewClient(u.Config)
 	if err != nil {
-		logger.Fatalf("error retrieving client for communication with lets encrypt acme server: %+v", err)
+		return fmt.Errorf("creating client for the ACME server: %w", err)
 	}
 
-	err = u.Client.Challenge.SetTLSALPN01Provider(tlsalpn01.NewProviderServer("", u.TLSPort))
+	// New users will need to register
+	reg, err := client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
 	if err != nil {
-		logger.Fatalf("error setting tls alpn provider for lets encrypt: %+v", err)
+		return fmt.Errorf("registering new user with the ACME server: %w", err)
 	}
+	u.Client, u.Registration = client, reg
+	return nil
+}
 
-	err = u.Client.Challenge.SetHTTP01Provider(http01.NewProviderServer("", u.HTTPPort))
-	if err != nil {
-		logger.Fatalf("error setting http provider for lets encrypt: %+v", err)
+// setProviders sets up the selected challenges. TLS-ALPN-01 is answered by
+// the goshs listener when it holds the TLS port, else by its own server.
+func (u *LetsEncryptUser) setProviders() error {
+	challenges := u.Challenges
+	if len(challenges) == 0 {
+		challenges = []string{ChallengeHTTP, ChallengeTLS}
 	}
+	for _, c := range challenges {
+		var err error
+		switch strings.TrimSpace(c) {
+		case ChallengeHTTP:
+			err = u.Client.Challenge.SetHTTP01Provider(http01.NewProviderServer("", u.HTTPPort))
+		case ChallengeTLS:
+			var provider challenge.Provider = tlsalpn01.NewProviderServer("", u.TLSPort)
+			if u.Serving != nil {
+				provider = alpnProvider{pair: u.Serving}
+			}
+			err = u.Client.Challenge.SetTLSALPN01Provider(provider)
+		case ChallengeDNS:
+			if u.DNS == nil {
+				return errors.New("the dns challenge needs the goshs DNS server (-dns)")
+			}
+			// The record is served by goshs itself, there is nothing to propagate
+			err = u.Client.Challenge.SetDNS01Provider(dnsProvider{records: u.DNS}, dns01.PropagationWait(0, true))
+		default:
+			return fmt.Errorf("unknown ACME challenge %q", c)
+		}
+		if err != nil {
+			return fmt.Errorf("setting %s challenge provider: %w", c, err)
+		}
+	}
+	return nil
+}
 
-	// New users will need to register
-	reg, err := u.Client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
-	if err != nil {
-		logger.Fatalf("error registering new user with lets encrypt: %+v", err)
+// Obtain requests a certificate for the domains and returns its private key
+// and the certificate bundle in PEM.
+func (u *LetsEncryptUser) Obtain() (key []byte, cert []byte, err error) {
+	if err := u.client(); err != nil {
+		return nil, nil, err
+	}
+	if err := u.setProviders(); err != nil {
+		return nil, nil, err
 	}
-	u.Registration = reg
 
 	request := certificate.ObtainRequest{
 		Domains: u.Domains,
@@ -90,13 +180,109 @@ func (u *LetsEncryptUser) RequestCertificate() ([]byte, []byte) {
 
 	certificates, err := u.Client.Certificate.Obtain(request)
 	if err != nil {
-		logger.Fatalf("error registering domain(s) with lets encrypt: %+v", err)
+		return nil, nil, fmt.Errorf("obtaining certificate for %s: %w", strings.Join(u.Domains, ","), err)
+	}
+
+	return certificates.PrivateKey, certificates.Certificate, nil
+}
+
+// RequestCertificate obtains a certificate and exits on failure.
+func (u *LetsEncryptUser) RequestCertificate() ([]byte, []byte) {
+	key, cert, err := u.Obtain()
+	if err != nil {
+		logger.Fatalf("error requesting certificate from lets encrypt: %+v", err)
+	}
+	return key, cert
+}
+
+// WriteCertificate obtains a certificate and replaces certFile and keyFile
+// with it. Listeners serving them via a KeyPair pick it up by themselves.
+func (u *LetsEncryptUser) WriteCertificate(certFile, keyFile string) error {
+	key, cert, err := u.Obtain()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(keyFile, key); err != nil {
+		return err
+	}
+	return writeFileAtomic(certFile, cert)
+}
+
+// EnsureCertificate writes a certificate to certFile and keyFile unless
+// they hold one that is not due for renewal yet, so a restart does not
+// request a new certificate.
+func (u *LetsEncryptUser) EnsureCertificate(certFile, keyFile string) error {
+	if _, err := os.Stat(keyFile); err == nil {
+		if due, err := RenewalDue(certFile); err == nil && !due {
+			logger.Infof("Using the existing certificate %s", certFile)
+			return nil
+		}
+	}
+	return u.WriteCertificate(certFile, keyFile)
+}
+
+// KeepRenewed renews the certificate in certFile and keyFile in the
+// background once it is due. It does not return.
+func (u *LetsEncryptUser) KeepRenewed(certFile, keyFile string) {
+	ticker := time.NewTicker(leRenewCheck)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		due, err := RenewalDue(certFile)
+		if err != nil {
+			logger.Warnf("error checking certificate %s for renewal: %+v", certFile, err)
+		}
+		if !due && err == nil {
+			continue
+		}
+		logger.Infof("Renewing the certificate for %s", strings.Join(u.Domains, ","))
+		if err := u.WriteCertificate(certFile, keyFile); err != nil {
+			logger.Errorf("error renewing certificate, retrying in %s: %+v", leRenewCheck, err)
+			continue
+		}
+		logger.Infof("Renewed the certificate for %s", strings.Join(u.Domains, ","))
+	}
+}
+
+// RenewalDue reports whether the certificate in certFile expires within
+// the renewal window.
+func RenewalDue(certFile string) (bool, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return false, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false, fmt.Errorf("failed to decode PEM block from %s", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false, err
 	}
+	return time.Until(cert.NotAfter) < leRenewBefore, nil
+}
 
-	return certificates.PrivateKey, certificates.Certificate
+// writeFileAtomic replaces path, so a reload never sees half a file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
 
-func GetLECertificateAndKey(email string, domains []string, httpPort string, tlsPort string) {
+// AskLetsEncrypt asks for the email and the comma separated domains on
+// stdin if they are not provided.
+func AskLetsEncrypt(email string, domains string) (string, string) {
 	// Get email if none provided
 	if email == "" {
 		reader := bufio.NewReader(os.Stdin)
@@ -109,34 +295,15 @@ func GetLECertificateAndKey(email string, domains []string, httpPort string, tls
 	}
 
 	// Get domains if none are provided
-	if domains[0] == "" {
+	if domains == "" {
 		reader := bufio.NewReader(os.Stdin)
 		fmt.Print("Provide domain(s) to request with Let's Encrypt: ")
 		resultDomains, err := reader.ReadString('\n')
 		if err != nil {
 			logger.Fatalf("error reading domains from stdin: %+v", err)
 		}
-		resultDomains = strings.Trim(resultDomains, "\n")
-		domains = strings.Split(resultDomains, ",")
-	}
-
-	// construct letsencrypt user object
-	letsencryptUser := LetsEncryptUser{
-		Email:    email,
-		HTTPPort: httpPort,
-		TLSPort:  tlsPort,
-		Domains:  domains,
+		domains = strings.Trim(resultDomains, "\n")
 	}
 
-	key, cert := letsencryptUser.RequestCertificate()
-
-	err := os.WriteFile("key", key, 0600)
-	if err != nil {
-		logger.Fatalf("error writing file 'key': %+v", err)
-	}
-
-	err = os.WriteFile("cert", cert, 0600)
-	if err != nil {
-		logger.Fatalf("error writing file 'cert': %+v", err)
-	}
+	return email, domains
 }
@@ -0,0 +1,215 @@
+package ca
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"goshs.de/goshs/v2/logger"
+)
+
+// RevokedFile is the serial blocklist kept next to the persistent CA.
+const RevokedFile = "revoked.txt"
+
+// Revocations rejects client certificates by serial, listed one per line in
+// a blocklist file, or by a CRL signed by one of the issuers. Both files are
+// read again when they change, so revoking needs no restart.
+type Revocations struct {
+	serialsFile string
+	crlFile     string
+	issuers     []*x509.Certificate
+
+	mu         sync.Mutex
+	serials    map[string]bool
+	serialsMod time.Time
+	crl        map[string]bool
+	crlMod     time.Time
+}
+
+// LoadRevocations reads the serial blocklist and the CRL. Either may be
+// empty, a missing blocklist counts as empty. The CRL has to be signed by one
+// of issuers.
+func LoadRevocations(serialsFile, crlFile string, issuers []*x509.Certificate) (*Revocations, error) {
+	r := &Revocations{serialsFile: serialsFile, crlFile: crlFile, issuers: issuers}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SerialsFile returns the path of the serial blocklist.
+func (r *Revocations) SerialsFile() string { return r.serialsFile }
+
+// Revoked reports whether cert is listed in the blocklist or the CRL.
+func (r *Revocations) Revoked(cert *x509.Certificate) bool {
+	if err := r.reload(); err != nil {
+		logger.Warnf("[CA] keeping previous revocations: %+v", err)
+	}
+	serial := cert.SerialNumber.Text(16)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.serials[serial] || r.crl[serial]
+}
+
+// Revoke adds serial to the blocklist file.
+func (r *Revocations) Revoke(serial string) (string, error) {
+	if r.serialsFile == "" {
+		return "", errors.New("no file for revoked serials configured")
+	}
+	n, err := ParseSerial(serial)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.serialsFile), 0700); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(r.serialsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := fmt.Fprintln(f, n); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return n, r.reload()
+}
+
+func (r *Revocations) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.serialsFile != "" {
+		info, err := os.Stat(r.serialsFile)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			r.serials, r.serialsMod = nil, time.Time{}
+		case err != nil:
+			return err
+		case !info.ModTime().Equal(r.serialsMod) || r.serials == nil:
+			serials, err := readSerials(r.serialsFile)
+			if err != nil {
+				return err
+			}
+			r.serials, r.serialsMod = serials, info.ModTime()
+		}
+	}
+
+	if r.crlFile != "" {
+		info, err := os.Stat(r.crlFile)
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Equal(r.crlMod) || r.crl == nil {
+			crl, err := readCRL(r.crlFile, r.issuers)
+			if err != nil {
+				return err
+			}
+			r.crl, r.crlMod = crl, info.ModTime()
+		}
+	}
+	return nil
+}
+
+// ReadCertificates reads the PEM encoded certificates in path, like the CA
+// bundle taken by -ca.
+func ReadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return certs, nil
+}
+
+// ParseSerial normalizes a hex serial as printed by goshs or openssl, with
+// or without colons, to lower case hex without leading zeros.
+func ParseSerial(s string) (string, error) {
+	clean := strings.NewReplacer(":", "", " ", "").Replace(strings.TrimSpace(s))
+	clean = strings.TrimPrefix(strings.ToLower(clean), "0x")
+	n, ok := new(big.Int).SetString(clean, 16)
+	if !ok || clean == "" {
+		return "", fmt.Errorf("invalid serial %q", s)
+	}
+	return n.Text(16), nil
+}
+
+func readSerials(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	serials := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		serial, err := ParseSerial(strings.Fields(text)[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		serials[serial] = true
+	}
+	return serials, scanner.Err()
+}
+
+func readCRL(path string, issuers []*x509.Certificate) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	list, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CRL %s: %w", path, err)
+	}
+	signed := false
+	for _, issuer := range issuers {
+		if list.CheckSignatureFrom(issuer) == nil {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return nil, fmt.Errorf("CRL %s is not signed by the client CA", path)
+	}
+	crl := map[string]bool{}
+	for _, entry := range list.RevokedCertificateEntries {
+		crl[entry.SerialNumber.Text(16)] = true
+	}
+	return crl, nil
+}
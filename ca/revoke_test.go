@@ -0,0 +1,134 @@
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testIssuer returns a small CA to sign client certificates and CRLs with.
+func testIssuer(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func testClient(serial int64) *x509.Certificate {
+	return &x509.Certificate{SerialNumber: big.NewInt(serial)}
+}
+
+func TestParseSerial(t *testing.T) {
+	for in, want := range map[string]string{
+		"1a2b":          "1a2b",
+		"00:1A:2B":      "1a2b",
+		"0x1A2B":        "1a2b",
+		" 00 1a 2b ":    "1a2b",
+		"DEADBEEF":      "deadbeef",
+		"0000000000001": "1",
+	} {
+		got, err := ParseSerial(in)
+		require.NoError(t, err, in)
+		require.Equal(t, want, got, in)
+	}
+	for _, in := range []string{"", "xyz", "0x"} {
+		_, err := ParseSerial(in)
+		require.Error(t, err, in)
+	}
+}
+
+func TestRevocations_Serials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revoked.txt")
+	r, err := LoadRevocations(path, "", nil)
+	require.NoError(t, err)
+	require.False(t, r.Revoked(testClient(0x1a)))
+
+	serial, err := r.Revoke("00:1A")
+	require.NoError(t, err)
+	require.Equal(t, "1a", serial)
+	require.True(t, r.Revoked(testClient(0x1a)))
+	require.False(t, r.Revoked(testClient(0x1b)))
+
+	// Edits of the file apply without a restart
+	require.NoError(t, os.WriteFile(path, []byte("# lost laptop\n1B lost 2026-10-01\n"), 0o600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	require.False(t, r.Revoked(testClient(0x1a)))
+	require.True(t, r.Revoked(testClient(0x1b)))
+
+	// A broken file keeps the previous list
+	require.NoError(t, os.WriteFile(path, []byte("not-a-serial\n"), 0o600))
+	later = later.Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	require.True(t, r.Revoked(testClient(0x1b)))
+
+	_, err = LoadRevocations(path, "", nil)
+	require.ErrorContains(t, err, "revoked.txt:1")
+
+	_, err = (&Revocations{}).Revoke("1a")
+	require.Error(t, err)
+}
+
+func TestRevocations_CRL(t *testing.T) {
+	issuer, key := testIssuer(t)
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number: big.NewInt(1),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(0x2a), RevocationTime: time.Now()},
+		},
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, issuer, key)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "ca.crl")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o600))
+
+	r, err := LoadRevocations("", path, []*x509.Certificate{issuer})
+	require.NoError(t, err)
+	require.True(t, r.Revoked(testClient(0x2a)))
+	require.False(t, r.Revoked(testClient(0x2b)))
+
+	other, _ := testIssuer(t)
+	_, err = LoadRevocations("", path, []*x509.Certificate{other})
+	require.ErrorContains(t, err, "not signed")
+}
+
+func TestReadCertificates(t *testing.T) {
+	first, _ := testIssuer(t)
+	second, _ := testIssuer(t)
+	path := filepath.Join(t.TempDir(), "bundle.pem")
+	bundle := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: first.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: second.Raw})...)
+	require.NoError(t, os.WriteFile(path, bundle, 0o600))
+
+	certs, err := ReadCertificates(path)
+	require.NoError(t, err)
+	require.Len(t, certs, 2)
+
+	require.NoError(t, os.WriteFile(path, []byte("nothing"), 0o600))
+	_, err = ReadCertificates(path)
+	require.Error(t, err)
+}
@@ -0,0 +1,34 @@
+package ca
+
+import (
+	"crypto/tls"
+	"sync"
+)
+
+var (
+	serviceOnce sync.Once
+	serviceConf *tls.Config
+	serviceErr  error
+)
+
+// ServiceTLSConfig returns the TLS config for the mail services: the goshs
+// certificate when certFile and keyFile are given, reloaded when they
+// change, otherwise a certificate issued by the self-signed CA. The
+// self-signed setup is generated once and shared by every caller.
+func ServiceTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if certFile != "" && keyFile != "" {
+		pair, err := SharedKeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return pair.TLSConfig(), nil
+	}
+
+	serviceOnce.Do(func() {
+		serviceConf, _, _, serviceErr = Setup()
+	})
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	return serviceConf.Clone(), nil
+}
@@ -2,8 +2,12 @@ package catcher
 
 import (
 	"encoding/json"
+	"fmt"
 	"sync"
 
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/metrics"
+	"goshs.de/goshs/v2/webhook"
 	"goshs.de/goshs/v2/ws"
 )
 
@@ -12,6 +16,8 @@ type Manager struct {
 	listeners map[string]*Listener
 	sessions  map[string]*Session
 	hub       *ws.Hub
+	watchers  []func(info ListenerInfo, running bool)
+	Webhook   webhook.Webhook
 }
 
 func NewManager(hub *ws.Hub) *Manager {
@@ -22,29 +28,48 @@ func NewManager(hub *ws.Hub) *Manager {
 	}
 }
 
-func (m *Manager) StartListener(ip string, port int) (*ListenerInfo, error) {
+// Watch calls fn after a listener was started or stopped.
+func (m *Manager) Watch(fn func(info ListenerInfo, running bool)) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.watchers = append(m.watchers, fn)
+}
 
+func (m *Manager) notify(info ListenerInfo, running bool) {
+	m.mu.RLock()
+	watchers := m.watchers
+	m.mu.RUnlock()
+	for _, fn := range watchers {
+		fn(info, running)
+	}
+}
+
+func (m *Manager) StartListener(ip string, port int) (*ListenerInfo, error) {
+	m.mu.Lock()
 	ln, err := newListener(m, ip, port)
 	if err != nil {
+		m.mu.Unlock()
 		return nil, err
 	}
 
 	m.listeners[ln.ID] = ln
-	return &ListenerInfo{
+	metrics.CatcherListeners.Inc()
+	m.mu.Unlock()
+
+	info := &ListenerInfo{
 		ID:   ln.ID,
 		IP:   ln.IP,
 		Port: ln.Port,
-	}, nil
+	}
+	m.notify(*info, true)
+	return info, nil
 }
 
 func (m *Manager) StopListener(id string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	ln, ok := m.listeners[id]
 	if !ok {
+		m.mu.Unlock()
 		return ErrNotFound
 	}
 
@@ -57,6 +82,10 @@ func (m *Manager) StopListener(id string) error {
 
 	ln.Stop()
 	delete(m.listeners, id)
+	metrics.CatcherListeners.Dec()
+	m.mu.Unlock()
+
+	m.notify(ListenerInfo{ID: ln.ID, IP: ln.IP, Port: ln.Port}, false)
 	return nil
 }
 
@@ -100,6 +129,9 @@ func (m *Manager) GetSession(id string) *Session {
 }
 
 func (m *Manager) registerSession(s *Session) {
+	metrics.CatcherSessionsTotal.Inc()
+	metrics.CatcherSessions.Inc()
+
 	m.mu.Lock()
 	m.sessions[s.ID] = s
 	m.mu.Unlock()
@@ -112,4 +144,9 @@ func (m *Manager) registerSession(s *Session) {
 		"remoteAddr": s.RemoteAddr,
 	})
 	m.hub.Broadcast <- msg
+
+	e := webhook.NewEvent("catcher", fmt.Sprintf("[CATCHER] New session %s on listener %s from %s", s.ID, s.ListenerID, s.RemoteAddr))
+	e.Remote = s.RemoteAddr
+	e.Fields = map[string]string{"listener": s.ListenerID, "session": s.ID}
+	logger.HandleWebhookEvent(e, m.Webhook)
 }
@@ -235,6 +235,39 @@ func TestManager_StopListener_CleansUp(t *testing.T) {
 	require.Empty(t, mgr.GetListeners())
 }
 
+func TestManager_Watch(t *testing.T) {
+	hub := newTestHub()
+	mgr := NewManager(hub)
+
+	var started, stopped []ListenerInfo
+	mgr.Watch(func(info ListenerInfo, running bool) {
+		// The watcher may query the manager
+		if running {
+			require.Len(t, mgr.GetListeners(), 1)
+			started = append(started, info)
+		} else {
+			require.Empty(t, mgr.GetListeners())
+			stopped = append(stopped, info)
+		}
+	})
+
+	info, err := mgr.StartListener("127.0.0.1", 0)
+	require.NoError(t, err)
+	require.Equal(t, []ListenerInfo{*info}, started)
+
+	require.NoError(t, mgr.StopListener(info.ID))
+	require.Len(t, stopped, 1)
+	require.Equal(t, info.ID, stopped[0].ID)
+	require.Equal(t, info.Port, stopped[0].Port)
+
+	// Failed starts and stops are not reported
+	_, err = mgr.StartListener("127.0.0.1", 99999)
+	require.Error(t, err)
+	require.ErrorIs(t, mgr.StopListener(info.ID), ErrNotFound)
+	require.Len(t, started, 1)
+	require.Len(t, stopped, 1)
+}
+
 // ─── Manager: session registration ─────────────────────────────────────────────
 
 func TestManager_RegisterSession_Broadcasts(t *testing.T) {
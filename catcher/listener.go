@@ -132,6 +132,7 @@ type ListenerInfo struct {
 	ID       string        `json:"id"`
 	IP       string        `json:"ip"`
 	Port     int           `json:"port"`
+	Public   string        `json:"public,omitempty"` // endpoint of the tunnel
 	Sessions []SessionInfo `json:"sessions"`
 }
 
@@ -3,6 +3,8 @@ package catcher
 import (
 	"net"
 	"sync"
+
+	"goshs.de/goshs/v2/metrics"
 )
 
 type Session struct {
@@ -39,6 +41,7 @@ func (s *Session) Close() {
 		return
 	}
 	s.closed = true
+	metrics.CatcherSessions.Dec()
 	if s.conn != nil {
 		s.conn.Close()
 	}
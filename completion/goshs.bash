@@ -8,20 +8,31 @@ _goshs() {
 
     local flags="--completion \
 -i --ip -p --port -d --dir -w --webdav -wp --webdav-port \
--ro --read-only -uo --upload-only -uf --upload-folder -mu --max-upload \
+-ro --read-only -uo --upload-only -uf --upload-folder -mu --max-upload -share-file \
 -nc --no-clipboard -nd --no-delete -si --silent -I --invisible \
 -c --cli --catcher -rc -e --embedded -o --output -t --tunnel \
--s --ssl -ss --self-signed -sk --server-key -sc --server-cert \
+-tunnel-server -tunnel-user -tunnel-key -tunnel-host-key \
+--log-format --log-max-size --log-max-age --log-keep \
+-s --ssl -ss --self-signed -ss-hosts -ca-dir -sk --server-key -sc --server-cert \
 -p12 --pkcs12 -p12np --p12-no-pass -sl --lets-encrypt \
 -sld --le-domains -sle --le-email -slh --le-http -slt --le-tls \
+-sla --le-acme-url -le-acme-ca -slc --le-challenges \
 -sftp -sp --sftp-port -skf --sftp-keyfile -shk --sftp-host-keyfile \
 -smb -smb-port -smb-domain -smb-share -smb-wordlist \
 -ldap -ldap-port -ldap-jndi -ldap-jndi-base -ldap-wordlist \
--b --basic-auth -ca --cert-auth -H --hash \
+-wpad --wpad-server -wpad-port -wpad-host -wpad-auth -wpad-forward \
+-relay -relay-port -relay-keys -relay-host-key -relay-domain -relay-http-port -relay-ports \
+-crack-workers -crack-rules -crack-mask -crack-mask-max \
+-b --basic-auth -ca --cert-auth -client-cert -client-cert-out -client-cert-days \
+-client-cert-revoke -ca-revoked -ca-crl -ca-map \
+-U --users -H --hash \
+-oidc-issuer -oidc-client-id -oidc-client-secret -oidc-redirect-url -oidc-emails -oidc-groups \
+-totp -totp-basic-upload -totp-enroll -tokens -token-create -token-expiry -token-revoke -token-list \
 -ipw --ip-whitelist -tpw --trusted-proxy-whitelist \
--dns -dns-port -dns-ip -smtp -smtp-port -smtp-domain \
+-dns -dns-port -dns-ip -smtp -smtp-port -smtp-domain -smtps-port -smtp-mail-dir -smtp-forward -pop3 --pop3-server -pop3-port -imap --imap-server -imap-port \
 -W --webhook -Wu --webhook-url -We --webhook-events -Wp --webhook-provider \
--C --config -P --print-config -u --user --update -m --mdns -V --verbose -v"
+-webhook-template -webhook-headers -webhook-secret -webhook-retries \
+-C --config --check-config -P --print-config -u --user --update -m --mdns --metrics --metrics-port -V --verbose -v"
 
     # --completion flag: offer shell names as values
     if [[ $prev == "--completion" ]]; then
@@ -29,12 +40,25 @@ _goshs() {
         return 0
     fi
 
+    # Log formats
+    if [[ $prev == "--log-format" ]]; then
+        COMPREPLY=( $(compgen -W "text json clf combined" -- "$cur") )
+        return 0
+    fi
+
+    # WPAD proxy auth schemes
+    if [[ $prev == "-wpad-auth" ]]; then
+        COMPREPLY=( $(compgen -W "ntlm basic" -- "$cur") )
+        return 0
+    fi
+
     # File-completing flags
     case "$prev" in
-        -d|--dir|-uf|--upload-folder|-o|--output|-C|--config|\
+        -d|--dir|-uf|--upload-folder|-o|--output|-C|--config|--check-config|\
         -sk|--server-key|-sc|--server-cert|-p12|--pkcs12|\
-        -ca|--cert-auth|-skf|--sftp-keyfile|-shk|--sftp-host-keyfile|\
-        -smb-wordlist|-ldap-wordlist)
+        -ca|--cert-auth|-U|--users|-skf|--sftp-keyfile|-shk|--sftp-host-keyfile|\
+        -smb-wordlist|-ldap-wordlist|-crack-rules|-smtp-mail-dir|-share-file|-webhook-template|-ca-dir|-le-acme-ca|-client-cert-out|\
+        -ca-revoked|-ca-crl|-ca-map|-tunnel-key|-relay-keys|-relay-host-key)
             _filedir
             return 0
             ;;
@@ -16,6 +16,7 @@ complete -c goshs -l read-only          -d 'Read only mode'
 complete -c goshs -l upload-only        -d 'Upload only mode'
 complete -c goshs -l upload-folder      -d 'Specify a different upload folder' -r -F
 complete -c goshs -l max-upload         -d 'Maximum upload size in bytes (0=unlimited)'
+complete -c goshs -l share-file         -d 'Keep shared links in this file across restarts' -r -F
 complete -c goshs -l no-clipboard       -d 'Disable clipboard sharing'
 complete -c goshs -l no-delete          -d 'Disable delete option'
 complete -c goshs -l silent             -d 'Run without directory listing'
@@ -24,11 +25,21 @@ complete -c goshs -s c -l cli           -d 'Enable CLI (requires auth and TLS)'
 complete -c goshs -l catcher            -d 'Enable reverse shell catcher'
 complete -c goshs -s e -l embedded      -d 'Show embedded files in UI'
 complete -c goshs -s o -l output        -d 'Write output to logfile' -r -F
+complete -c goshs -l log-format         -d 'Log format' -x -a 'text json clf combined'
+complete -c goshs -l log-max-size       -d 'Rotate the logfile at this size in MB'
+complete -c goshs -l log-max-age        -d 'Rotate the logfile at this age, like 24h or 7d'
+complete -c goshs -l log-keep           -d 'Number of rotated logfiles to keep'
 complete -c goshs -s t -l tunnel        -d 'Enable tunnel'
+complete -c goshs -l tunnel-server      -d 'Open the tunnel on this goshs relay (host:port)'
+complete -c goshs -l tunnel-user        -d 'User of the goshs relay'
+complete -c goshs -l tunnel-key         -d 'Private key for the goshs relay' -r -F
+complete -c goshs -l tunnel-host-key    -d 'Pinned host key of the goshs relay'
 
 # TLS
 complete -c goshs -s s -l ssl           -d 'Use TLS'
 complete -c goshs -l self-signed         -d 'Use a self-signed certificate'
+complete -c goshs -l ss-hosts            -d 'Hostnames and IPs for the self-signed certificate' -r
+complete -c goshs -l ca-dir              -d 'Directory of the goshs CA' -r -F
 complete -c goshs -l server-key          -d 'Path to server key' -r -F
 complete -c goshs -l server-cert         -d 'Path to server certificate' -r -F
 complete -c goshs -l pkcs12              -d 'Path to server p12' -r -F
@@ -38,6 +49,9 @@ complete -c goshs -l le-domains          -d 'Domains for Let\'s Encrypt (comma s
 complete -c goshs -l le-email            -d 'Email for Let\'s Encrypt'
 complete -c goshs -l le-http             -d 'Port for Let\'s Encrypt HTTP challenge (default: 80)'
 complete -c goshs -l le-tls              -d 'Port for Let\'s Encrypt TLS ALPN challenge (default: 443)'
+complete -c goshs -l le-acme-url         -d 'ACME directory URL (default: Let\'s Encrypt)'
+complete -c goshs -l le-acme-ca          -d 'CA certificate of the ACME server' -r -F
+complete -c goshs -l le-challenges       -d 'ACME challenges to solve (default: http,tls)'
 
 # SFTP
 complete -c goshs -l sftp                -d 'Activate SFTP server'
@@ -59,9 +73,53 @@ complete -c goshs -l ldap-jndi           -d 'Enable JNDI mode for Log4Shell'
 complete -c goshs -l ldap-jndi-base      -d 'Override codeBase URL for JNDI payloads'
 complete -c goshs -l ldap-wordlist       -d 'Wordlist for LDAP NTLM hash cracking' -r -F
 
+# WPAD
+complete -c goshs -l wpad                -d 'Serve wpad.dat and run a credential capturing proxy'
+complete -c goshs -l wpad-port           -d 'WPAD proxy port (default: 3128)'
+complete -c goshs -l wpad-host           -d 'Proxy host announced in the PAC file'
+complete -c goshs -l wpad-auth           -d 'Proxy auth scheme to demand' -x -a 'ntlm basic'
+complete -c goshs -l wpad-forward        -d 'Forward requests after capture'
+
+# Tunnel relay
+complete -c goshs -l relay               -d 'Run a tunnel relay for goshs clients'
+complete -c goshs -l relay-port          -d 'Tunnel relay SSH port (default: 2222)'
+complete -c goshs -l relay-keys          -d 'Authorized_keys file of the relay clients' -r -F
+complete -c goshs -l relay-host-key      -d 'Host key file of the relay' -r -F
+complete -c goshs -l relay-domain        -d 'Domain to issue subdomains of'
+complete -c goshs -l relay-http-port     -d 'Port the subdomains are served on (default: 8080)'
+complete -c goshs -l relay-ports         -d 'Ports issued for the other tunnels (default: 20000-20099)'
+
+# Hash cracking
+complete -c goshs -l crack-workers       -d 'Number of hash cracking workers'
+complete -c goshs -l crack-rules         -d 'Hashcat rule file or builtin' -r -F
+complete -c goshs -l crack-mask          -d 'Mask to try after capture'
+complete -c goshs -l crack-mask-max      -d 'Maximum number of mask positions (default: 8)'
+
 # Auth
 complete -c goshs -s b -l basic-auth     -d 'Basic auth (user:pass)'
 complete -c goshs -l cert-auth            -d 'Certificate based authentication' -r -F
+complete -c goshs -l client-cert         -d 'Issue a client certificate for this name' -r
+complete -c goshs -l client-cert-out     -d 'File to write the client certificate to' -r -F
+complete -c goshs -l client-cert-days    -d 'Validity of the client certificate in days' -r
+complete -c goshs -l client-cert-revoke  -d 'Revoke the client certificate with this serial' -r
+complete -c goshs -l ca-revoked          -d 'File with revoked client certificate serials' -r -F
+complete -c goshs -l ca-crl              -d 'CRL to reject revoked client certificates' -r -F
+complete -c goshs -l ca-map              -d 'File mapping client certificates to users' -r -F
+complete -c goshs -s U -l users          -d 'Users file with per-user roles' -r -F
+complete -c goshs -l oidc-issuer         -d 'OpenID Connect issuer URL for web UI login' -r
+complete -c goshs -l oidc-client-id      -d 'OIDC client id' -r
+complete -c goshs -l oidc-client-secret  -d 'OIDC client secret' -r
+complete -c goshs -l oidc-redirect-url   -d 'OIDC redirect URL' -r
+complete -c goshs -l oidc-emails         -d 'Comma separated emails or @domains allowed to log in' -r
+complete -c goshs -l oidc-groups         -d 'Comma separated groups allowed to log in' -r
+complete -c goshs -l totp                -d 'TOTP secrets file, requires a code for web UI logins' -r -F
+complete -c goshs -l totp-basic-upload   -d 'Accept basic auth without TOTP for uploads'
+complete -c goshs -l totp-enroll         -d 'Enroll a user in the TOTP secrets file and exit' -r
+complete -c goshs -l tokens              -d 'API tokens file for bearer auth' -r -F
+complete -c goshs -l token-create        -d 'Create an API token name:scope[:path] and exit' -r
+complete -c goshs -l token-expiry        -d 'Lifetime of the created token, e.g. 12h or 30d' -r
+complete -c goshs -l token-revoke        -d 'Revoke the named API token and exit' -r
+complete -c goshs -l token-list          -d 'List the API tokens and exit'
 complete -c goshs -s H -l hash           -d 'Hash a password for file based ACLs'
 
 # Restrictions
@@ -75,18 +133,32 @@ complete -c goshs -l dns-ip               -d 'DNS server reply IP (default: 127.
 complete -c goshs -l smtp                 -d 'Enable SMTP server'
 complete -c goshs -l smtp-port            -d 'SMTP server port (default: 2525)'
 complete -c goshs -l smtp-domain          -d 'SMTP server domain'
+complete -c goshs -l smtps-port           -d 'SMTPS implicit TLS port (default: 4465)'
+complete -c goshs -l smtp-mail-dir        -d 'Directory mail is stored in as .eml' -r -F
+complete -c goshs -l smtp-forward         -d 'Copy mail to mbox:<file> or maildir:<dir>'
+complete -c goshs -l pop3                 -d 'Enable POP3 server'
+complete -c goshs -l pop3-port            -d 'POP3 server port (default: 1110)'
+complete -c goshs -l imap                 -d 'Enable IMAP server'
+complete -c goshs -l imap-port            -d 'IMAP server port (default: 1143)'
 
 # Webhook
 complete -c goshs -s W -l webhook         -d 'Enable webhook support'
 complete -c goshs -l webhook-url           -d 'URL to send webhook requests to'
 complete -c goshs -l webhook-events        -d 'Comma separated list of events to notify'
-complete -c goshs -l webhook-provider      -d 'Webhook provider' -a 'Discord Mattermost Slack'
+complete -c goshs -l webhook-provider      -d 'Webhook provider' -a 'Discord Mattermost Slack Teams Telegram ntfy Gotify Generic'
+complete -c goshs -l webhook-template      -d 'Go text/template file for the Generic body' -r -F
+complete -c goshs -l webhook-headers       -d 'Comma separated "Name: value" headers for Generic, ntfy and Gotify'
+complete -c goshs -l webhook-secret        -d 'Sign Generic bodies with HMAC-SHA256'
+complete -c goshs -l webhook-retries       -d 'Retries of a failed notification'
 
 # Misc
-complete -c goshs -s C -l config          -d 'Config file path' -r -F
+complete -c goshs -s C -l config          -d 'Config file path (JSON, YAML or TOML)' -r -F
+complete -c goshs -l check-config         -d 'Validate a config file and report unknown keys' -r -F
 complete -c goshs -s P -l print-config    -d 'Print sample config to STDOUT'
 complete -c goshs -s u -l user            -d 'Drop privs to user (unix only)'
 complete -c goshs -l update               -d 'Update goshs to most recent version'
 complete -c goshs -s m -l mdns            -d 'Enable zeroconf mDNS registration'
+complete -c goshs -l metrics              -d 'Serve Prometheus metrics at /metrics'
+complete -c goshs -l metrics-port         -d 'Serve the metrics on their own port'
 complete -c goshs -s V -l verbose         -d 'Activate verbose log output'
 complete -c goshs -s v                    -d 'Print the current goshs version'
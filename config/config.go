@@ -2,12 +2,16 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 
 	"goshs.de/goshs/v2/logger"
 	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/webhook"
 )
 
 // Dir returns the path to ~/.config/goshs and creates it if it does not exist.
@@ -23,155 +27,223 @@ func Dir() (string, error) {
 	return dir, nil
 }
 
+// Config is the config file of goshs. Every key is written either flat by
+// its json tag, like "smb_port", or nested in the section of its key tag,
+// like "port" in "smb". The opt tag names the field of options.Options the
+// key sets, it is overridden by the environment variable GOSHS_<KEY> and by
+// the flag setting the same field.
 type Config struct {
-	Interface           string   `json:"interface"`
-	Port                int      `json:"port"`
-	Directory           string   `json:"directory"`
-	UploadFolder        string   `json:"upload_folder"`
-	SSL                 bool     `json:"ssl"`
-	SelfSigned          bool     `json:"self_signed"`
-	PrivateKey          string   `json:"private_key"`
-	Certificate         string   `json:"certificate"`
-	P12                 string   `json:"p12"`
-	P12NoPass           bool     `json:"p12_no_pass"`
-	LetsEncrypt         bool     `json:"letsencrypt"`
-	LetsEncryptDomain   string   `json:"letsencrypt_domain"`
-	LetsEncryptEmail    string   `json:"letsencrypt_email"`
-	LetsEncryptHTTPPort string   `json:"letsencrypt_http_port"`
-	LetsEncryptTLSPort  string   `json:"letsencrypt_tls_port"`
-	AuthUsername        string   `json:"auth_username"`
-	AuthPassword        string   `json:"auth_password"`
-	CertificateAuth     string   `json:"certificate_auth"`
-	Webdav              bool     `json:"webdav"`
-	WebdavPort          int      `json:"webdav_port"`
-	UploadOnly          bool     `json:"upload_only"`
-	ReadOnly            bool     `json:"read_only"`
-	NoClipboard         bool     `json:"no_clipboard"`
-	NoDelete            bool     `json:"no_delete"`
-	Verbose             bool     `json:"verbose"`
-	Silent              bool     `json:"silent"`
-	Invisible           bool     `json:"invisible"`
-	RunningUser         string   `json:"running_user"`
-	CLI                 bool     `json:"cli"`
-	Embedded            bool     `json:"embedded"`
-	Output              string   `json:"output"`
-	WebhookEnabled      bool     `json:"webhook_enabled"`
-	WebhookURL          string   `json:"webhook_url"`
-	WebhookProvider     string   `json:"webhook_provider"`
-	WebhookEvents       []string `json:"webhook_events"`
-	SFTP                bool     `json:"sftp"`
-	SFTPPort            int      `json:"sftp_port"`
-	SFTPKeyFile         string   `json:"sftp_keyfile"`
-	SFTPHostKeyFile     string   `json:"sftp_host_keyfile"`
-	Whitelist           string   `json:"whitelist"`
-	TrustedProxies      string   `json:"trusted_proxies"`
-	Tunnel              bool     `json:"tunnel"`
-	DNSServer           bool     `json:"dns_server"`
-	DNSPort             int      `json:"dns_port"`
-	DNSIP               string   `json:"dns_ip"`
-	SMTPServer          bool     `json:"smtp_server"`
-	SMTPPort            int      `json:"smtp_port"`
-	SMTPDomain          string   `json:"smtp_domain"`
-	SMBServer           bool     `json:"smb_server"`
-	SMBPort             int      `json:"smb_port"`
-	SMBDomain           string   `json:"smb_domain"`
-	SMBShare            string   `json:"smb_share"`
-	SMBWordlist         string   `json:"smb_wordlist"`
-	MaxUploadSize       int64    `json:"max_upload_size"`
-	Catcher             bool     `json:"catcher"`
-	LDAP                bool     `json:"ldap"`
-	LDAPPort            int      `json:"ldap_port"`
-	LDAPJNDIEnabled     bool     `json:"ldap_jndi"`
-	LDAPJNDIBase        string   `json:"ldap_jndi_base"`
-	LDAPWordlist        string   `json:"ldap_wordlist"`
+	Interface           string   `json:"interface" key:"interface" opt:"IP"`
+	Port                int      `json:"port" key:"http.port" opt:"Port"`
+	Directory           string   `json:"directory" key:"http.directory" opt:"Webroot"`
+	UploadFolder        string   `json:"upload_folder" key:"http.upload_folder" opt:"UploadFolder"`
+	SSL                 bool     `json:"ssl" key:"tls.enabled" opt:"SSL"`
+	SelfSigned          bool     `json:"self_signed" key:"tls.self_signed" opt:"SelfSigned"`
+	SelfSignedHosts     string   `json:"self_signed_hosts" key:"tls.self_signed_hosts" opt:"SelfSignedHosts"`
+	CADir               string   `json:"ca_dir" key:"tls.ca_dir" opt:"CADir"`
+	PrivateKey          string   `json:"private_key" key:"tls.private_key" opt:"MyKey"`
+	Certificate         string   `json:"certificate" key:"tls.certificate" opt:"MyCert"`
+	P12                 string   `json:"p12" key:"tls.p12" opt:"MyP12"`
+	P12NoPass           bool     `json:"p12_no_pass" key:"tls.p12_no_pass" opt:"P12NoPass"`
+	LetsEncrypt         bool     `json:"letsencrypt" key:"letsencrypt.enabled" opt:"LetsEncrypt"`
+	LetsEncryptDomain   string   `json:"letsencrypt_domain" key:"letsencrypt.domain" opt:"LEDomains"`
+	LetsEncryptEmail    string   `json:"letsencrypt_email" key:"letsencrypt.email" opt:"LEEmail"`
+	LetsEncryptHTTPPort string   `json:"letsencrypt_http_port" key:"letsencrypt.http_port" opt:"LEHTTPPort"`
+	LetsEncryptTLSPort  string   `json:"letsencrypt_tls_port" key:"letsencrypt.tls_port" opt:"LETLSPort"`
+	LetsEncryptACMEURL  string   `json:"letsencrypt_acme_url" key:"letsencrypt.acme_url" opt:"LEDirectory"`
+	LetsEncryptACMECA   string   `json:"letsencrypt_acme_ca" key:"letsencrypt.acme_ca" opt:"LEACMECA"`
+	LetsEncryptSolvers  string   `json:"letsencrypt_challenges" key:"letsencrypt.challenges" opt:"LEChallenges"`
+	AuthUsername        string   `json:"auth_username" key:"auth.username"`
+	AuthPassword        string   `json:"auth_password" key:"auth.password"`
+	CertificateAuth     string   `json:"certificate_auth" key:"auth.certificate" opt:"CertAuth"`
+	CARevoked           string   `json:"ca_revoked" key:"auth.ca_revoked" opt:"CARevoked"`
+	CACRL               string   `json:"ca_crl" key:"auth.ca_crl" opt:"CACRL"`
+	CAMap               string   `json:"ca_map" key:"auth.ca_map" opt:"CAMap"`
+	UsersFile           string   `json:"users_file" key:"auth.users_file" opt:"UsersFile"`
+	OIDCIssuer          string   `json:"oidc_issuer" key:"oidc.issuer" opt:"OIDCIssuer"`
+	OIDCClientID        string   `json:"oidc_client_id" key:"oidc.client_id" opt:"OIDCClientID"`
+	OIDCClientSecret    string   `json:"oidc_client_secret" key:"oidc.client_secret" opt:"OIDCClientSecret"`
+	OIDCRedirectURL     string   `json:"oidc_redirect_url" key:"oidc.redirect_url" opt:"OIDCRedirectURL"`
+	OIDCEmails          string   `json:"oidc_emails" key:"oidc.emails" opt:"OIDCEmails"`
+	OIDCGroups          string   `json:"oidc_groups" key:"oidc.groups" opt:"OIDCGroups"`
+	TOTPFile            string   `json:"totp_file" key:"auth.totp_file" opt:"TOTPFile"`
+	TOTPBasicUpload     bool     `json:"totp_basic_upload" key:"auth.totp_basic_upload" opt:"TOTPBasicUpload"`
+	TokensFile          string   `json:"tokens_file" key:"auth.tokens_file" opt:"TokensFile"`
+	Webdav              bool     `json:"webdav" key:"webdav.enabled" opt:"WebDav"`
+	WebdavPort          int      `json:"webdav_port" key:"webdav.port" opt:"WebDavPort"`
+	UploadOnly          bool     `json:"upload_only" key:"http.upload_only" opt:"UploadOnly"`
+	ReadOnly            bool     `json:"read_only" key:"http.read_only" opt:"ReadOnly"`
+	NoClipboard         bool     `json:"no_clipboard" key:"http.no_clipboard" opt:"NoClipboard"`
+	NoDelete            bool     `json:"no_delete" key:"http.no_delete" opt:"NoDelete"`
+	Verbose             bool     `json:"verbose" key:"log.verbose" opt:"Verbose"`
+	Silent              bool     `json:"silent" key:"http.silent" opt:"Silent"`
+	Invisible           bool     `json:"invisible" key:"http.invisible" opt:"Invisible"`
+	RunningUser         string   `json:"running_user" key:"running_user" opt:"DropUser"`
+	CLI                 bool     `json:"cli" key:"http.cli" opt:"CLI"`
+	Embedded            bool     `json:"embedded" key:"http.embedded" opt:"Embedded"`
+	Output              string   `json:"output" key:"log.output" opt:"Output"`
+	LogFormat           string   `json:"log_format" key:"log.format" opt:"LogFormat"`
+	LogMaxSize          int      `json:"log_max_size" key:"log.max_size" opt:"LogMaxSize"`
+	LogMaxAge           string   `json:"log_max_age" key:"log.max_age" opt:"LogMaxAge"`
+	LogKeep             int      `json:"log_keep" key:"log.keep" opt:"LogKeep"`
+	WebhookEnabled      bool     `json:"webhook_enabled" key:"webhook.enabled" opt:"WebhookEnabled"`
+	WebhookURL          string   `json:"webhook_url" key:"webhook.url" opt:"WebhookURL"`
+	WebhookProvider     string   `json:"webhook_provider" key:"webhook.provider" opt:"WebhookProvider"`
+	WebhookEvents       []string `json:"webhook_events" key:"webhook.events" opt:"WebhookEvents"`
+	WebhookTemplate     string   `json:"webhook_template" key:"webhook.template" opt:"WebhookTemplate"`
+	WebhookHeaders      []string `json:"webhook_headers" key:"webhook.headers" opt:"WebhookHeaders"`
+	WebhookSecret       string   `json:"webhook_secret" key:"webhook.secret" opt:"WebhookSecret"`
+	WebhookRetries      int      `json:"webhook_retries" key:"webhook.retries" opt:"WebhookRetries"`
+	SFTP                bool     `json:"sftp" key:"sftp.enabled" opt:"SFTP"`
+	SFTPPort            int      `json:"sftp_port" key:"sftp.port" opt:"SFTPPort"`
+	SFTPKeyFile         string   `json:"sftp_keyfile" key:"sftp.keyfile" opt:"SFTPKeyFile"`
+	SFTPHostKeyFile     string   `json:"sftp_host_keyfile" key:"sftp.host_keyfile" opt:"SFTPHostKeyFile"`
+	Whitelist           string   `json:"whitelist" key:"whitelist" opt:"Whitelist"`
+	TrustedProxies      string   `json:"trusted_proxies" key:"trusted_proxies" opt:"TrustedProxies"`
+	Tunnel              bool     `json:"tunnel" key:"tunnel.enabled" opt:"Tunnel"`
+	TunnelServer        string   `json:"tunnel_server" key:"tunnel.server" opt:"TunnelServer"`
+	TunnelUser          string   `json:"tunnel_user" key:"tunnel.user" opt:"TunnelUser"`
+	TunnelKey           string   `json:"tunnel_key" key:"tunnel.key" opt:"TunnelKey"`
+	TunnelHostKey       string   `json:"tunnel_host_key" key:"tunnel.host_key" opt:"TunnelHostKey"`
+	Relay               bool     `json:"relay" key:"relay.enabled" opt:"Relay"`
+	RelayPort           int      `json:"relay_port" key:"relay.port" opt:"RelayPort"`
+	RelayHTTPPort       int      `json:"relay_http_port" key:"relay.http_port" opt:"RelayHTTPPort"`
+	RelayDomain         string   `json:"relay_domain" key:"relay.domain" opt:"RelayDomain"`
+	RelayPorts          string   `json:"relay_ports" key:"relay.ports" opt:"RelayPorts"`
+	RelayKeys           string   `json:"relay_keys" key:"relay.keys" opt:"RelayKeys"`
+	RelayHostKey        string   `json:"relay_host_key" key:"relay.host_key" opt:"RelayHostKey"`
+	DNSServer           bool     `json:"dns_server" key:"dns.enabled" opt:"DNS"`
+	DNSPort             int      `json:"dns_port" key:"dns.port" opt:"DNSPort"`
+	DNSIP               string   `json:"dns_ip" key:"dns.ip" opt:"DNSIP"`
+	SMTPServer          bool     `json:"smtp_server" key:"smtp.enabled" opt:"SMTP"`
+	SMTPPort            int      `json:"smtp_port" key:"smtp.port" opt:"SMTPPort"`
+	SMTPDomain          string   `json:"smtp_domain" key:"smtp.domain" opt:"SMTPDomain"`
+	SMTPSPort           int      `json:"smtps_port" key:"smtp.smtps_port" opt:"SMTPSPort"`
+	SMTPMailDir         string   `json:"smtp_mail_dir" key:"smtp.mail_dir" opt:"SMTPMailDir"`
+	SMTPForward         string   `json:"smtp_forward" key:"smtp.forward" opt:"SMTPForward"`
+	POP3Server          bool     `json:"pop3_server" key:"pop3.enabled" opt:"POP3"`
+	POP3Port            int      `json:"pop3_port" key:"pop3.port" opt:"POP3Port"`
+	IMAPServer          bool     `json:"imap_server" key:"imap.enabled" opt:"IMAP"`
+	IMAPPort            int      `json:"imap_port" key:"imap.port" opt:"IMAPPort"`
+	SMBServer           bool     `json:"smb_server" key:"smb.enabled" opt:"SMB"`
+	SMBPort             int      `json:"smb_port" key:"smb.port" opt:"SMBPort"`
+	SMBDomain           string   `json:"smb_domain" key:"smb.domain" opt:"SMBDomain"`
+	SMBShare            string   `json:"smb_share" key:"smb.share" opt:"SMBShare"`
+	SMBWordlist         string   `json:"smb_wordlist" key:"smb.wordlist" opt:"SMBWordlist"`
+	MaxUploadSize       int64    `json:"max_upload_size" key:"http.max_upload_size" opt:"MaxUploadSize"`
+	ShareFile           string   `json:"share_file" key:"http.share_file" opt:"ShareFile"`
+	Catcher             bool     `json:"catcher" key:"catcher" opt:"Catcher"`
+	LDAP                bool     `json:"ldap" key:"ldap.enabled" opt:"LDAP"`
+	LDAPPort            int      `json:"ldap_port" key:"ldap.port" opt:"LDAPPort"`
+	LDAPJNDIEnabled     bool     `json:"ldap_jndi" key:"ldap.jndi" opt:"LDAPJNDIEnabled"`
+	LDAPJNDIBase        string   `json:"ldap_jndi_base" key:"ldap.jndi_base" opt:"LDAPJNDIBase"`
+	LDAPWordlist        string   `json:"ldap_wordlist" key:"ldap.wordlist" opt:"LDAPWordlist"`
+	WPAD                bool     `json:"wpad" key:"wpad.enabled" opt:"WPAD"`
+	WPADPort            int      `json:"wpad_port" key:"wpad.port" opt:"WPADPort"`
+	WPADHost            string   `json:"wpad_host" key:"wpad.host" opt:"WPADHost"`
+	WPADAuth            string   `json:"wpad_auth" key:"wpad.auth" opt:"WPADAuth"`
+	WPADForward         bool     `json:"wpad_forward" key:"wpad.forward" opt:"WPADForward"`
+	CrackWorkers        int      `json:"crack_workers" key:"crack.workers" opt:"CrackWorkers"`
+	CrackRules          string   `json:"crack_rules" key:"crack.rules" opt:"CrackRules"`
+	CrackMask           string   `json:"crack_mask" key:"crack.mask" opt:"CrackMask"`
+	CrackMaskMaxLen     int      `json:"crack_mask_max" key:"crack.mask_max" opt:"CrackMaskMaxLen"`
+	Metrics             bool     `json:"metrics" key:"metrics.enabled" opt:"Metrics"`
+	MetricsPort         int      `json:"metrics_port" key:"metrics.port" opt:"MetricsPort"`
+
+	// Webhooks are further destinations next to webhook_url, each with its
+	// own provider and events
+	Webhooks []webhook.Destination `json:"webhooks" key:"webhook.destinations" opt:"Webhooks"`
+
+	// set are the keys given by the file or the environment, a Config not
+	// read by Read sets all of them. environ are the variables used.
+	set     map[string]bool
+	environ []string
 }
 
+// LoadConfig applies the config file of -C, if any, and the GOSHS_<KEY>
+// environment variables to opts. Flags given on the command line win over
+// both, the environment wins over the file.
 func LoadConfig(opts *options.Options) (*options.Options, error) {
-	var cfg Config
+	if opts.ConfigFile != "" {
+		absPath, err := filepath.Abs(opts.ConfigFile)
+		if err != nil {
+			logger.Fatalf("Failed to get absolute path of config file: %+v", err)
+			return opts, err
+		}
+		logger.Infof("Using config file %s", absPath)
+		opts.ConfigPath = absPath
+	}
 
-	absPath, err := filepath.Abs(opts.ConfigFile)
+	cfg, err := Read(opts.ConfigPath)
 	if err != nil {
-		logger.Fatalf("Failed to get absolute path of config file: %+v", err)
 		return opts, err
 	}
-	logger.Infof("Using config file %s", absPath)
-	opts.ConfigPath = absPath
+	if len(cfg.environ) > 0 {
+		logger.Infof("Using %s from the environment", strings.Join(cfg.environ, ", "))
+	}
+	cfg.Apply(opts)
 
-	cfile, err := os.ReadFile(absPath)
-	if err != nil {
-		return opts, err
+	return opts, nil
+}
+
+// Apply sets the options of the keys given by the file or the environment
+// in opts, unless a flag on the command line set them.
+func (cfg *Config) Apply(opts *options.Options) {
+	webroot := opts.Webroot
+	src, dst := reflect.ValueOf(cfg).Elem(), reflect.ValueOf(opts).Elem()
+	for _, f := range fields {
+		if f.opt == "" || !cfg.has(f.key) || opts.Given[f.opt] {
+			continue
+		}
+		from, to := src.Field(f.index), dst.FieldByName(f.opt)
+		if from.Kind() == reflect.Slice && to.Kind() == reflect.String {
+			to.SetString(strings.Join(from.Interface().([]string), ","))
+			continue
+		}
+		to.Set(from)
 	}
 
-	if err = json.Unmarshal(cfile, &cfg); err != nil {
-		return opts, err
+	if cfg.has("webhook_events") && !opts.Given["WebhookEvents"] {
+		opts.WebhookEventsParsed = cfg.WebhookEvents
+	}
+	if (cfg.has("auth_username") || cfg.has("auth_password")) && !opts.Given["BasicAuth"] {
+		user, pass, _ := strings.Cut(opts.BasicAuth, ":")
+		if cfg.has("auth_username") {
+			user = cfg.AuthUsername
+		}
+		if cfg.has("auth_password") {
+			pass = cfg.AuthPassword
+		}
+		opts.BasicAuth = user + ":" + pass
 	}
 
-	// Set the config values
-	opts.IP = cfg.Interface
-	opts.Port = cfg.Port
-	opts.Webroot = cfg.Directory
-	opts.UploadFolder = cfg.UploadFolder
-	opts.SSL = cfg.SSL
-	opts.SelfSigned = cfg.SelfSigned
-	opts.MyKey = cfg.PrivateKey
-	opts.MyCert = cfg.Certificate
-	opts.MyP12 = cfg.P12
-	opts.P12NoPass = cfg.P12NoPass
-	opts.LetsEncrypt = cfg.LetsEncrypt
-	opts.LEDomains = cfg.LetsEncryptDomain
-	opts.LEEmail = cfg.LetsEncryptEmail
-	opts.LEHTTPPort = cfg.LetsEncryptHTTPPort
-	opts.LETLSPort = cfg.LetsEncryptTLSPort
-	opts.BasicAuth = cfg.AuthUsername + ":" + cfg.AuthPassword
-	opts.CertAuth = cfg.CertificateAuth
-	opts.WebDav = cfg.Webdav
-	opts.WebDavPort = cfg.WebdavPort
-	opts.UploadOnly = cfg.UploadOnly
-	opts.ReadOnly = cfg.ReadOnly
-	opts.NoClipboard = cfg.NoClipboard
-	opts.NoDelete = cfg.NoDelete
-	opts.Verbose = cfg.Verbose
-	opts.Silent = cfg.Silent
-	opts.DropUser = cfg.RunningUser
-	opts.CLI = cfg.CLI
-	opts.Embedded = cfg.Embedded
-	opts.Output = cfg.Output
-	opts.WebhookEnabled = cfg.WebhookEnabled
-	opts.WebhookURL = cfg.WebhookURL
-	opts.WebhookProvider = cfg.WebhookProvider
-	opts.WebhookEventsParsed = cfg.WebhookEvents
-	opts.SFTP = cfg.SFTP
-	opts.SFTPPort = cfg.SFTPPort
-	opts.SFTPKeyFile = cfg.SFTPKeyFile
-	opts.SFTPHostKeyFile = cfg.SFTPHostKeyFile
-	opts.Whitelist = cfg.Whitelist
-	opts.TrustedProxies = cfg.TrustedProxies
-	opts.Invisible = cfg.Invisible
-	opts.Tunnel = cfg.Tunnel
-	opts.DNS = cfg.DNSServer
-	opts.DNSPort = cfg.DNSPort
-	opts.DNSIP = cfg.DNSIP
-	opts.SMTP = cfg.SMTPServer
-	opts.SMTPPort = cfg.SMTPPort
-	opts.SMTPDomain = cfg.SMTPDomain
-	opts.SMB = cfg.SMBServer
-	opts.SMBPort = cfg.SMBPort
-	opts.SMBDomain = cfg.SMBDomain
-	opts.SMBShare = cfg.SMBShare
-	opts.SMBWordlist = cfg.SMBWordlist
-	opts.MaxUploadSize = cfg.MaxUploadSize
-	opts.Catcher = cfg.Catcher
-	opts.LDAP = cfg.LDAP
-	opts.LDAPPort = cfg.LDAPPort
-	opts.LDAPJNDIEnabled = cfg.LDAPJNDIEnabled
-	opts.LDAPJNDIBase = cfg.LDAPJNDIBase
-
-	// Default upload folder to webroot if not set in config
-	if opts.UploadFolder == "" {
+	// The upload folder follows the webroot unless it is set itself
+	if opts.UploadFolder == "" || opts.UploadFolder == webroot && !cfg.has("upload_folder") && !opts.Given["UploadFolder"] {
 		opts.UploadFolder = opts.Webroot
 	}
+}
 
-	return opts, nil
+// ErrNoConfigFile is returned by a reload if goshs runs without -C.
+var ErrNoConfigFile = errors.New("goshs runs without a config file")
+
+// Change lists the changed keys of a reloaded config file by whether they
+// were applied to the running servers or need a restart.
+type Change struct {
+	Applied []string `json:"applied"`
+	Restart []string `json:"restart"`
+}
+
+// Diff returns the keys of the config file whose values differ between old
+// and next.
+func Diff(old, next *Config) []string {
+	var keys []string
+	a, b := reflect.ValueOf(*old), reflect.ValueOf(*next)
+	for _, f := range fields {
+		if !reflect.DeepEqual(a.Field(f.index).Interface(), b.Field(f.index).Interface()) {
+			keys = append(keys, f.key)
+		}
+	}
+	return keys
 }
 
 func PrintExample() (string, error) {
@@ -182,6 +254,8 @@ func PrintExample() (string, error) {
 		UploadFolder:        ".",
 		SSL:                 false,
 		SelfSigned:          false,
+		SelfSignedHosts:     "",
+		CADir:               "",
 		PrivateKey:          "",
 		Certificate:         "",
 		P12:                 "",
@@ -191,9 +265,25 @@ func PrintExample() (string, error) {
 		LetsEncryptEmail:    "",
 		LetsEncryptHTTPPort: "80",
 		LetsEncryptTLSPort:  "443",
+		LetsEncryptACMEURL:  "",
+		LetsEncryptACMECA:   "",
+		LetsEncryptSolvers:  "http,tls",
 		AuthUsername:        "",
 		AuthPassword:        "",
 		CertificateAuth:     "",
+		CARevoked:           "",
+		CACRL:               "",
+		CAMap:               "",
+		UsersFile:           "",
+		OIDCIssuer:          "",
+		OIDCClientID:        "",
+		OIDCClientSecret:    "",
+		OIDCRedirectURL:     "",
+		OIDCEmails:          "",
+		OIDCGroups:          "",
+		TOTPFile:            "",
+		TOTPBasicUpload:     false,
+		TokensFile:          "",
 		Webdav:              false,
 		WebdavPort:          8001,
 		UploadOnly:          false,
@@ -207,10 +297,18 @@ func PrintExample() (string, error) {
 		CLI:                 false,
 		Embedded:            false,
 		Output:              "",
+		LogFormat:           "text",
+		LogMaxSize:          0,
+		LogMaxAge:           "",
+		LogKeep:             0,
 		WebhookEnabled:      false,
 		WebhookURL:          "",
 		WebhookProvider:     "discord",
 		WebhookEvents:       []string{"all"},
+		WebhookTemplate:     "",
+		WebhookHeaders:      []string{},
+		WebhookSecret:       "",
+		WebhookRetries:      3,
 		SFTP:                false,
 		SFTPPort:            2022,
 		SFTPKeyFile:         "",
@@ -218,23 +316,54 @@ func PrintExample() (string, error) {
 		Whitelist:           "",
 		TrustedProxies:      "",
 		Tunnel:              false,
+		TunnelServer:        "",
+		TunnelUser:          "",
+		TunnelKey:           "",
+		TunnelHostKey:       "",
+		Relay:               false,
+		RelayPort:           2222,
+		RelayHTTPPort:       8080,
+		RelayDomain:         "",
+		RelayPorts:          "20000-20099",
+		RelayKeys:           "",
+		RelayHostKey:        "",
 		DNSServer:           false,
 		DNSPort:             8053,
 		DNSIP:               "127.0.0.1",
 		SMTPServer:          false,
 		SMTPPort:            2525,
 		SMTPDomain:          "",
+		SMTPSPort:           4465,
+		SMTPMailDir:         "",
+		SMTPForward:         "",
+		POP3Server:          false,
+		POP3Port:            1110,
+		IMAPServer:          false,
+		IMAPPort:            1143,
 		SMBServer:           false,
 		SMBPort:             445,
 		SMBDomain:           "",
 		SMBShare:            "",
 		SMBWordlist:         "",
 		MaxUploadSize:       0,
+		ShareFile:           "",
 		Catcher:             false,
 		LDAP:                false,
 		LDAPPort:            389,
 		LDAPJNDIEnabled:     false,
 		LDAPJNDIBase:        "",
+		WPAD:                false,
+		WPADPort:            3128,
+		WPADHost:            "",
+		WPADAuth:            "ntlm",
+		WPADForward:         false,
+		CrackWorkers:        0,
+		CrackRules:          "",
+		CrackMask:           "",
+		CrackMaskMaxLen:     8,
+		Metrics:             false,
+		MetricsPort:         0,
+		Webhooks:            []webhook.Destination{},
 	}
 
 	b, err := json.MarshalIndent(defaultConfig, "", "  ")
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/webhook"
 	"github.com/stretchr/testify/require"
 )
 
@@ -84,6 +85,9 @@ func TestLoadConfig_WebhookFields(t *testing.T) {
 		WebhookURL:      "https://hooks.example.com/abc",
 		WebhookProvider: "slack",
 		WebhookEvents:   []string{"upload", "download"},
+		WebhookHeaders:  []string{"Authorization: Bearer x", "X-Env: lab"},
+		WebhookSecret:   "s3cret",
+		WebhookRetries:  5,
 	}
 	path := writeTempConfig(t, cfg)
 	opts := &options.Options{ConfigFile: path}
@@ -93,6 +97,35 @@ func TestLoadConfig_WebhookFields(t *testing.T) {
 	require.Equal(t, "https://hooks.example.com/abc", result.WebhookURL)
 	require.Equal(t, "slack", result.WebhookProvider)
 	require.Equal(t, []string{"upload", "download"}, result.WebhookEventsParsed)
+	require.Equal(t, "Authorization: Bearer x,X-Env: lab", result.WebhookHeaders)
+	require.Equal(t, "s3cret", result.WebhookSecret)
+	require.Equal(t, 5, result.WebhookRetries)
+}
+
+func TestLoadConfig_Webhooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goshs.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"webhooks": [
+		{"provider": "teams", "url": "https://example.com/private", "events": ["smb", "catcher"]},
+		{"provider": "slack", "url": "https://example.com/team", "events": ["upload"], "retries": 0}
+	]}`), 0o600))
+	result, err := LoadConfig(&options.Options{ConfigFile: path})
+	require.NoError(t, err)
+	require.Len(t, result.Webhooks, 2)
+	require.Equal(t, "teams", result.Webhooks[0].Provider)
+	require.Equal(t, []string{"smb", "catcher"}, result.Webhooks[0].Events)
+	require.Nil(t, result.Webhooks[0].Retries)
+	require.Equal(t, 0, *result.Webhooks[1].Retries)
+}
+
+func TestDiff(t *testing.T) {
+	old := &Config{Port: 8000, Whitelist: "10.0.0.0/8", Webhooks: []webhook.Destination{{Provider: "slack"}}}
+	next := &Config{Port: 8000, Whitelist: "10.0.0.0/8", Webhooks: []webhook.Destination{{Provider: "slack"}}}
+	require.Empty(t, Diff(old, next))
+
+	next.Port = 9000
+	next.ReadOnly = true
+	next.Webhooks[0].Events = []string{"upload"}
+	require.Equal(t, []string{"port", "read_only", "webhooks"}, Diff(old, next))
 }
 
 func TestLoadConfig_ConfigPathIsAbsolute(t *testing.T) {
@@ -262,6 +295,9 @@ func TestLoadConfig_LetsEncryptFields(t *testing.T) {
 		LetsEncryptEmail:    "admin@example.com",
 		LetsEncryptHTTPPort: "80",
 		LetsEncryptTLSPort:  "443",
+		LetsEncryptACMEURL:  "https://localhost:14000/dir",
+		LetsEncryptACMECA:   "pebble.minica.pem",
+		LetsEncryptSolvers:  "dns",
 	}
 	path := writeTempConfig(t, cfg)
 	opts := &options.Options{ConfigFile: path}
@@ -272,4 +308,35 @@ func TestLoadConfig_LetsEncryptFields(t *testing.T) {
 	require.Equal(t, "admin@example.com", result.LEEmail)
 	require.Equal(t, "80", result.LEHTTPPort)
 	require.Equal(t, "443", result.LETLSPort)
+	require.Equal(t, "https://localhost:14000/dir", result.LEDirectory)
+	require.Equal(t, "pebble.minica.pem", result.LEACMECA)
+	require.Equal(t, "dns", result.LEChallenges)
+}
+
+func TestLoadConfig_LogFields(t *testing.T) {
+	cfg := Config{
+		Output:     "goshs.log",
+		LogFormat:  "json",
+		LogMaxSize: 50,
+		LogMaxAge:  "7d",
+		LogKeep:    3,
+	}
+	path := writeTempConfig(t, cfg)
+	opts := &options.Options{ConfigFile: path}
+	result, err := LoadConfig(opts)
+	require.NoError(t, err)
+	require.Equal(t, "goshs.log", result.Output)
+	require.Equal(t, "json", result.LogFormat)
+	require.Equal(t, 50, result.LogMaxSize)
+	require.Equal(t, "7d", result.LogMaxAge)
+	require.Equal(t, 3, result.LogKeep)
+}
+
+func TestLoadConfig_MetricsFields(t *testing.T) {
+	path := writeTempConfig(t, Config{Metrics: true, MetricsPort: 9100})
+	opts := &options.Options{ConfigFile: path}
+	result, err := LoadConfig(opts)
+	require.NoError(t, err)
+	require.True(t, result.Metrics)
+	require.Equal(t, 9100, result.MetricsPort)
 }
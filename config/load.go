@@ -0,0 +1,400 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"goshs.de/goshs/v2/logger"
+)
+
+// field is a key of the config file.
+type field struct {
+	index int
+	key   string // flat, like smb_port
+	path  string // nested, like smb.port
+	opt   string // the field of options.Options it sets
+}
+
+var (
+	fields   = configFields()
+	byKey    = map[string]field{}
+	byPath   = map[string]field{}
+	sections = map[string]bool{}
+)
+
+func init() {
+	for _, f := range fields {
+		byKey[f.key] = f
+		byPath[f.path] = f
+		if section, _, ok := strings.Cut(f.path, "."); ok {
+			sections[section] = true
+		}
+	}
+}
+
+func configFields() []field {
+	var fs []field
+	t := reflect.TypeFor[Config]()
+	for i := range t.NumField() {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		fs = append(fs, field{index: i, key: key, path: t.Field(i).Tag.Get("key"), opt: t.Field(i).Tag.Get("opt")})
+	}
+	return fs
+}
+
+// EnvName returns the environment variable of a config key, like
+// GOSHS_SMB_PORT for smb_port.
+func EnvName(key string) string {
+	return "GOSHS_" + strings.ToUpper(key)
+}
+
+// Issue is an unknown key or an invalid value of a config file.
+type Issue struct {
+	Line    int
+	Key     string
+	Message string
+	Unknown bool
+}
+
+// at returns where the issue is in the config file at path. TOML files are
+// decoded without lines.
+func (i Issue) at(path string) string {
+	if i.Line > 0 {
+		return fmt.Sprintf("%s:%d", path, i.Line)
+	}
+	return path
+}
+
+func unknownKey(line int, key string) Issue {
+	return Issue{Line: line, Key: key, Message: "unknown key", Unknown: true}
+}
+
+// has reports whether the file or the environment gave key.
+func (cfg *Config) has(key string) bool {
+	return cfg.set == nil || cfg.set[key]
+}
+
+// readFile sets the keys of the config file at path in cfg and returns
+// its issues. An error means the file could not be parsed at all.
+func (cfg *Config) readFile(path string) ([]Issue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parse(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return cfg.decode(root), nil
+}
+
+// decode sets the keys of root, flat or nested in their section. The keys
+// of an issue are skipped, all others are set nonetheless.
+func (cfg *Config) decode(root *node) []Issue {
+	t, ok := root.value.(*table)
+	if !ok {
+		return []Issue{{Line: root.line, Message: "the config file is no table of keys"}}
+	}
+
+	var issues []Issue
+	for _, e := range t.entries {
+		// sftp, webdav and the like are a flat key and a section
+		if sub, ok := e.node.value.(*table); ok && sections[e.key] {
+			for _, se := range sub.entries {
+				path := e.key + "." + se.key
+				f, ok := byPath[path]
+				if !ok {
+					issues = append(issues, unknownKey(se.line, path))
+					continue
+				}
+				issues = append(issues, cfg.assign(f, path, se)...)
+			}
+			continue
+		}
+
+		f, ok := byKey[e.key]
+		if !ok {
+			f, ok = byPath[e.key]
+		}
+		switch {
+		case ok:
+			issues = append(issues, cfg.assign(f, e.key, e)...)
+		case sections[e.key]:
+			issues = append(issues, Issue{Line: e.line, Key: e.key, Message: "expected a section of keys"})
+		default:
+			issues = append(issues, unknownKey(e.line, e.key))
+		}
+	}
+	return issues
+}
+
+func (cfg *Config) assign(f field, key string, e entry) []Issue {
+	dst := reflect.ValueOf(cfg).Elem().Field(f.index)
+	issues := unknownIn(dst.Type(), e.node, key)
+	if err := setValue(dst, e.node); err != nil {
+		return append(issues, Issue{Line: e.line, Key: key, Message: err.Error()})
+	}
+	cfg.set[f.key] = true
+	return issues
+}
+
+// unknownIn returns the keys of the tables in n the elements of a struct
+// slice have no json tag for, like a typo in a webhook destination.
+func unknownIn(typ reflect.Type, n *node, key string) []Issue {
+	if typ.Kind() != reflect.Slice || typ.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	known := map[string]bool{}
+	for i := range typ.Elem().NumField() {
+		name, _, _ := strings.Cut(typ.Elem().Field(i).Tag.Get("json"), ",")
+		known[name] = true
+	}
+
+	var issues []Issue
+	list, _ := n.value.([]*node)
+	for _, item := range list {
+		if t, ok := item.value.(*table); ok {
+			for _, e := range t.entries {
+				if !known[e.key] {
+					issues = append(issues, unknownKey(e.line, key+"."+e.key))
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// setValue sets dst to the value of n. Values are converted where nothing
+// is lost: numbers and booleans may be quoted, lists may be given as comma
+// separated strings and the other way round.
+func setValue(dst reflect.Value, n *node) error {
+	switch dst.Kind() {
+	case reflect.String:
+		s, err := text(n)
+		if err != nil {
+			return err
+		}
+		dst.SetString(s)
+	case reflect.Int, reflect.Int64:
+		switch v := n.value.(type) {
+		case nil:
+			dst.SetInt(0)
+		case int64:
+			dst.SetInt(v)
+		case float64:
+			if v != math.Trunc(v) {
+				return fmt.Errorf("expected a whole number, got %v", v)
+			}
+			dst.SetInt(int64(v))
+		case string:
+			i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return fmt.Errorf("expected a number, got %q", v)
+			}
+			dst.SetInt(i)
+		default:
+			return fmt.Errorf("expected a number, got %s", kind(n))
+		}
+	case reflect.Bool:
+		switch v := n.value.(type) {
+		case nil:
+			dst.SetBool(false)
+		case bool:
+			dst.SetBool(v)
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return fmt.Errorf("expected true or false, got %q", v)
+			}
+			dst.SetBool(b)
+		default:
+			return fmt.Errorf("expected true or false, got %s", kind(n))
+		}
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.String {
+			list, err := texts(n)
+			if err != nil {
+				return err
+			}
+			dst.Set(reflect.ValueOf(list))
+			return nil
+		}
+		// Anything else, like the webhook destinations, as encoding/json does
+		b, err := json.Marshal(n.plain())
+		if err != nil {
+			return err
+		}
+		v := reflect.New(dst.Type())
+		if err := json.Unmarshal(b, v.Interface()); err != nil {
+			return fmt.Errorf("invalid value: %w", err)
+		}
+		dst.Set(v.Elem())
+	default:
+		return fmt.Errorf("unsupported type %s", dst.Type())
+	}
+	return nil
+}
+
+// text returns a scalar as a string, a list joined by commas.
+func text(n *node) (string, error) {
+	switch v := n.value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case int64, float64, bool:
+		return fmt.Sprint(v), nil
+	case []*node:
+		list, err := texts(n)
+		return strings.Join(list, ","), err
+	default:
+		return "", fmt.Errorf("expected a value, got %s", kind(n))
+	}
+}
+
+// texts returns a list of scalars, or a comma separated string split.
+func texts(n *node) ([]string, error) {
+	switch v := n.value.(type) {
+	case nil:
+		return []string{}, nil
+	case []*node:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if _, ok := item.value.([]*node); ok {
+				return nil, fmt.Errorf("expected a list of values, got a nested list")
+			}
+			s, err := text(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	case *table:
+		return nil, fmt.Errorf("expected a list, got %s", kind(n))
+	default:
+		s, _ := text(n)
+		list := []string{}
+		for item := range strings.SplitSeq(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	}
+}
+
+func kind(n *node) string {
+	switch n.value.(type) {
+	case *table:
+		return "a section of keys"
+	case []*node:
+		return "a list"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	default:
+		return "a number"
+	}
+}
+
+// env sets the keys given as GOSHS_<KEY> environment variables and returns
+// their names. The webhook destinations are given as JSON.
+func (cfg *Config) env() ([]string, error) {
+	var names []string
+	for _, f := range fields {
+		name := EnvName(f.key)
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		n := &node{value: s}
+		dst := reflect.ValueOf(cfg).Elem().Field(f.index)
+		if dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() != reflect.String {
+			parsed, err := parseJSON([]byte(s))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			n = parsed
+		}
+		if err := setValue(dst, n); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		cfg.set[f.key] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Read reads the config file at path, as JSON, YAML or TOML by its
+// extension, and the GOSHS_<KEY> environment variables on top of it. An
+// empty path reads the environment only. Unknown keys are logged, invalid
+// values are an error.
+func Read(path string) (*Config, error) {
+	cfg := &Config{set: map[string]bool{}}
+
+	if path != "" {
+		issues, err := cfg.readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, issue := range issues {
+			if !issue.Unknown {
+				return nil, fmt.Errorf("%s: %s: %s", issue.at(path), issue.Key, issue.Message)
+			}
+		}
+		for _, issue := range issues {
+			logger.Warnf("[CONFIG] %s: unknown key %s, see --check-config", issue.at(path), issue.Key)
+		}
+	}
+
+	names, err := cfg.env()
+	if err != nil {
+		return nil, err
+	}
+	cfg.environ = names
+	return cfg, nil
+}
+
+// Check validates the config file at path, without the environment. It
+// returns the unknown keys and invalid values, and an error if the file
+// cannot be parsed at all.
+func Check(path string) ([]Issue, error) {
+	cfg := &Config{set: map[string]bool{}}
+	issues, err := cfg.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ReadOnly && cfg.UploadOnly {
+		issues = append(issues, Issue{Key: "read_only", Message: "cannot be combined with upload_only"})
+	}
+	return issues, nil
+}
+
+// CheckCommand prints the issues of the config file at path for
+// --check-config and exits, with 1 if there are any.
+func CheckCommand(path string) {
+	issues, err := Check(path)
+	if err != nil {
+		logger.Fatalf("error reading the config file: %+v", err)
+	}
+	for _, issue := range issues {
+		fmt.Printf("%s: %s: %s\n", issue.at(path), issue.Key, issue.Message)
+	}
+	if len(issues) > 0 {
+		fmt.Printf("%s has %d issue(s)\n", path, len(issues))
+		os.Exit(1)
+	}
+	fmt.Printf("%s is valid\n", path)
+	os.Exit(0)
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/webhook"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+const yamlConfig = `# goshs
+interface: 127.0.0.1
+http:
+  port: 9000
+  directory: /srv/web
+  read_only: true
+smb:
+  enabled: true
+  port: "4445"
+smtp_server: true
+webhook:
+  enabled: true
+  events: [upload, smb]
+  headers: "X-One: 1, X-Two: 2"
+  destinations:
+    - provider: slack
+      url: https://example.com/hook
+      events: [all]
+`
+
+const tomlConfig = `# goshs
+interface = "127.0.0.1"
+smtp_server = true
+
+[http]
+port = 9_000
+directory = '/srv/web'
+read_only = true
+
+[smb]
+enabled = true
+port = "4445"
+
+[webhook]
+enabled = true
+events = [
+  "upload", # uploads
+  "smb",
+]
+headers = "X-One: 1, X-Two: 2"
+
+[[webhook.destinations]]
+provider = "slack"
+url = "https://example.com/hook"
+events = ["all"]
+`
+
+func TestRead_Formats(t *testing.T) {
+	for name, content := range map[string]string{"goshs.yaml": yamlConfig, "goshs.toml": tomlConfig} {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := Read(writeFile(t, name, content))
+			require.NoError(t, err)
+			require.Equal(t, "127.0.0.1", cfg.Interface)
+			require.Equal(t, 9000, cfg.Port)
+			require.Equal(t, "/srv/web", cfg.Directory)
+			require.True(t, cfg.ReadOnly)
+			require.True(t, cfg.SMBServer)
+			require.Equal(t, 4445, cfg.SMBPort)
+			require.True(t, cfg.SMTPServer)
+			require.True(t, cfg.WebhookEnabled)
+			require.Equal(t, []string{"upload", "smb"}, cfg.WebhookEvents)
+			require.Equal(t, []string{"X-One: 1", "X-Two: 2"}, cfg.WebhookHeaders)
+			require.Equal(t, []webhook.Destination{{Provider: "slack", URL: "https://example.com/hook", Events: []string{"all"}}}, cfg.Webhooks)
+		})
+	}
+}
+
+func TestRead_ParseErrorLine(t *testing.T) {
+	for name, content := range map[string]string{
+		"goshs.json": "{\n  \"port\": 8000,\n  \"ssl\": tru\n}",
+		"goshs.yaml": "http:\n  port: 8000\n  ssl: : true\n",
+		"goshs.toml": "[http]\nport = 8000\nssl = tru\n",
+	} {
+		_, err := Read(writeFile(t, name, content))
+		require.ErrorContains(t, err, "line 3", name)
+	}
+}
+
+func TestRead_InvalidValue(t *testing.T) {
+	_, err := Read(writeFile(t, "goshs.yaml", "http:\n  port: 8000\nsmb:\n  port: many\n"))
+	require.ErrorContains(t, err, ":4: smb.port: expected a number")
+}
+
+func TestCheck(t *testing.T) {
+	path := writeFile(t, "goshs.yaml", `http:
+  port: 8000
+  prot: 8001
+smb:
+  enabled: true
+  port: many
+verbos: true
+webhook:
+  destinations:
+    - provider: slack
+      urll: https://example.com
+`)
+	issues, err := Check(path)
+	require.NoError(t, err)
+	require.Equal(t, []Issue{
+		{Line: 3, Key: "http.prot", Message: "unknown key", Unknown: true},
+		{Line: 6, Key: "smb.port", Message: `expected a number, got "many"`},
+		{Line: 7, Key: "verbos", Message: "unknown key", Unknown: true},
+		{Line: 11, Key: "webhook.destinations.urll", Message: "unknown key", Unknown: true},
+	}, issues)
+
+	// Unknown keys are only a warning when goshs starts
+	cfg, err := Read(writeFile(t, "goshs.json", `{"port": 9000, "prot": 1}`))
+	require.NoError(t, err)
+	require.Equal(t, 9000, cfg.Port)
+
+	issues, err = Check(writeFile(t, "goshs.toml", tomlConfig))
+	require.NoError(t, err)
+	require.Empty(t, issues)
+
+	// TOML issues come without a line
+	issues, err = Check(writeFile(t, "goshs.toml", "verbos = true\n[http]\nport = 8000\nprot = 8001\n"))
+	require.NoError(t, err)
+	require.Equal(t, []Issue{
+		{Key: "verbos", Message: "unknown key", Unknown: true},
+		{Key: "http.prot", Message: "unknown key", Unknown: true},
+	}, issues)
+}
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	path := writeFile(t, "goshs.yaml", "http:\n  port: 9000\n  directory: /srv/web\nsmb:\n  port: 4445\n  domain: CORP\n")
+	t.Setenv("GOSHS_SMB_PORT", "5445")
+	t.Setenv("GOSHS_VERBOSE", "true")
+
+	// Defaults as set by the flags, -p given on the command line
+	opts := &options.Options{
+		ConfigFile:   path,
+		Port:         7000,
+		Webroot:      "/cwd",
+		UploadFolder: "/cwd",
+		SMBPort:      445,
+		SMBShare:     "goshs",
+		Given:        map[string]bool{"Port": true},
+	}
+	result, err := LoadConfig(opts)
+	require.NoError(t, err)
+	require.Equal(t, 7000, result.Port, "flag wins over the file")
+	require.Equal(t, 5445, result.SMBPort, "environment wins over the file")
+	require.True(t, result.Verbose, "environment wins over the default")
+	require.Equal(t, "CORP", result.SMBDomain, "file wins over the default")
+	require.Equal(t, "goshs", result.SMBShare, "absent keys keep the default")
+	require.Equal(t, "/srv/web", result.UploadFolder, "upload folder follows the webroot")
+}
+
+func TestLoadConfig_EnvOnly(t *testing.T) {
+	t.Setenv("GOSHS_PORT", "8443")
+	t.Setenv("GOSHS_AUTH_PASSWORD", "s3cret")
+	t.Setenv("GOSHS_WEBHOOKS", `[{"provider": "ntfy", "url": "https://ntfy.sh/goshs"}]`)
+
+	opts := &options.Options{Port: 8000, BasicAuth: "admin:old"}
+	result, err := LoadConfig(opts)
+	require.NoError(t, err)
+	require.Empty(t, result.ConfigPath)
+	require.Equal(t, 8443, result.Port)
+	require.Equal(t, "admin:s3cret", result.BasicAuth)
+	require.Equal(t, "ntfy", result.Webhooks[0].Provider)
+
+	t.Setenv("GOSHS_PORT", "http")
+	_, err = LoadConfig(&options.Options{})
+	require.ErrorContains(t, err, "GOSHS_PORT")
+}
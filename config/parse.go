@@ -0,0 +1,298 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// node is a value of a config file with the line it is on, so that issues
+// can point to it whatever the format.
+type node struct {
+	line  int
+	value any // nil, string, bool, int64, float64, []*node or *table
+}
+
+// table is a section of keys in the order of the file.
+type table struct {
+	entries []entry
+}
+
+type entry struct {
+	key  string
+	line int
+	node *node
+}
+
+func (t *table) get(key string) *node {
+	for _, e := range t.entries {
+		if e.key == key {
+			return e.node
+		}
+	}
+	return nil
+}
+
+func (t *table) add(key string, line int, n *node) {
+	t.entries = append(t.entries, entry{key: key, line: line, node: n})
+}
+
+// plain returns the value of n as encoding/json would decode it.
+func (n *node) plain() any {
+	switch v := n.value.(type) {
+	case *table:
+		m := make(map[string]any, len(v.entries))
+		for _, e := range v.entries {
+			m[e.key] = e.node.plain()
+		}
+		return m
+	case []*node:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = item.plain()
+		}
+		return list
+	default:
+		return v
+	}
+}
+
+// parse parses a config file by the extension of its name: YAML for .yaml
+// and .yml, TOML for .toml and JSON for everything else.
+func parse(name string, data []byte) (*node, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		return parseYAML(data)
+	case ".toml":
+		return parseTOML(data)
+	default:
+		return parseJSON(data)
+	}
+}
+
+func lineAt(data []byte, offset int64) int {
+	return bytes.Count(data[:min(int(offset), len(data))], []byte("\n")) + 1
+}
+
+type jsonParser struct {
+	dec  *json.Decoder
+	data []byte
+}
+
+func parseJSON(data []byte) (*node, error) {
+	p := &jsonParser{dec: json.NewDecoder(bytes.NewReader(data)), data: data}
+	p.dec.UseNumber()
+
+	n, err := p.value()
+	if err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			// The offset is behind the offending byte
+			return nil, fmt.Errorf("line %d: %w", lineAt(data, syntax.Offset-1), err)
+		}
+		return nil, fmt.Errorf("line %d: %w", p.line(), err)
+	}
+	if _, err := p.dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("line %d: unexpected data after the closing bracket", p.line())
+	}
+	return n, nil
+}
+
+func (p *jsonParser) line() int {
+	return lineAt(p.data, p.dec.InputOffset())
+}
+
+func (p *jsonParser) value() (*node, error) {
+	tok, err := p.dec.Token()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	n := &node{line: p.line()}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '[' {
+			list := []*node{}
+			for p.dec.More() {
+				item, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, item)
+			}
+			n.value = list
+		} else {
+			t := &table{}
+			for p.dec.More() {
+				key, err := p.dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				line := p.line()
+				val, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				t.add(key.(string), line, val)
+			}
+			n.value = t
+		}
+		// The closing bracket
+		if _, err := p.dec.Token(); err != nil {
+			return nil, err
+		}
+	case json.Number:
+		if i, err := tok.Int64(); err == nil {
+			n.value = i
+		} else {
+			n.value, _ = tok.Float64()
+		}
+	default:
+		n.value = tok
+	}
+	return n, nil
+}
+
+func parseYAML(data []byte) (*node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return &node{line: 1, value: &table{}}, nil
+	}
+	return fromYAML(doc.Content[0])
+}
+
+func fromYAML(y *yaml.Node) (*node, error) {
+	n := &node{line: y.Line}
+
+	switch y.Kind {
+	case yaml.AliasNode:
+		alias, err := fromYAML(y.Alias)
+		if err != nil {
+			return nil, err
+		}
+		n.value = alias.value
+	case yaml.SequenceNode:
+		list := []*node{}
+		for _, c := range y.Content {
+			item, err := fromYAML(c)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		n.value = list
+	case yaml.MappingNode:
+		t := &table{}
+		for i := 0; i+1 < len(y.Content); i += 2 {
+			val, err := fromYAML(y.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			t.add(y.Content[i].Value, y.Content[i].Line, val)
+		}
+		n.value = t
+	case yaml.ScalarNode:
+		var err error
+		switch y.ShortTag() {
+		case "!!null":
+		case "!!bool":
+			var b bool
+			err = y.Decode(&b)
+			n.value = b
+		case "!!int":
+			var i int64
+			err = y.Decode(&i)
+			n.value = i
+		case "!!float":
+			var f float64
+			err = y.Decode(&f)
+			n.value = f
+		default:
+			n.value = y.Value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", y.Line, err)
+		}
+	default:
+		return nil, fmt.Errorf("line %d: unsupported YAML node", y.Line)
+	}
+	return n, nil
+}
+
+// parseTOML decodes data with the toml package. It does not tell where a key
+// is, so the nodes have no line and the keys are put in the order of the
+// file as listed by its metadata.
+func parseTOML(data []byte) (*node, error) {
+	var doc map[string]any
+	md, err := toml.Decode(string(data), &doc)
+	if err != nil {
+		var perr toml.ParseError
+		if errors.As(err, &perr) {
+			return nil, fmt.Errorf("line %d: %s", perr.Position.Line, perr.Message)
+		}
+		return nil, err
+	}
+	order := map[string]int{}
+	for i, key := range md.Keys() {
+		if _, ok := order[key.String()]; !ok {
+			order[key.String()] = i
+		}
+	}
+	return fromTOML(doc, nil, order), nil
+}
+
+func fromTOML(v any, path toml.Key, order map[string]int) *node {
+	n := &node{}
+
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.SortFunc(keys, func(a, b string) int {
+			return order[child(path, a).String()] - order[child(path, b).String()]
+		})
+		t := &table{}
+		for _, key := range keys {
+			t.add(key, 0, fromTOML(v[key], child(path, key), order))
+		}
+		n.value = t
+	case []map[string]any:
+		list := make([]*node, len(v))
+		for i, item := range v {
+			list[i] = fromTOML(item, path, order)
+		}
+		n.value = list
+	case []any:
+		list := make([]*node, len(v))
+		for i, item := range v {
+			list[i] = fromTOML(item, path, order)
+		}
+		n.value = list
+	case string, bool, int64, float64:
+		n.value = v
+	default:
+		// Dates and times
+		n.value = fmt.Sprint(v)
+	}
+	return n
+}
+
+func child(path toml.Key, key string) toml.Key {
+	return append(path[:len(path):len(path)], key)
+}
@@ -1,7 +1,9 @@
 package dnsserver
 
 import (
+	"context"
 	"net"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -114,6 +116,32 @@ func TestDNSHandler_TXTRecord(t *testing.T) {
 	require.True(t, strings.HasPrefix(txt.Txt[1], "src="), "second TXT string should carry src= attribution")
 }
 
+func TestDNSHandler_StoredTXTRecord(t *testing.T) {
+	s := newTestServer()
+	s.AddTXT("_acme-challenge.Example.com.", "token-a")
+	s.AddTXT("_acme-challenge.example.com", "token-b")
+	s.AddTXT("_acme-challenge.example.com.", "token-b")
+
+	req := new(dns.Msg)
+	req.SetQuestion("_acme-challenge.example.com.", dns.TypeTXT)
+
+	w := &mockResponseWriter{}
+	s.handler(w, req)
+
+	require.NotNil(t, w.written)
+	require.Len(t, w.written.Answer, 2)
+	require.Equal(t, []string{"token-a"}, w.written.Answer[0].(*dns.TXT).Txt)
+	require.Equal(t, []string{"token-b"}, w.written.Answer[1].(*dns.TXT).Txt)
+
+	// Without stored records the query is echoed again
+	s.RemoveTXT("_acme-challenge.example.com.", "token-a")
+	s.RemoveTXT("_acme-challenge.example.com.", "token-b")
+	w = &mockResponseWriter{}
+	s.handler(w, req)
+	require.Len(t, w.written.Answer, 1)
+	require.True(t, strings.HasPrefix(w.written.Answer[0].(*dns.TXT).Txt[1], "src="))
+}
+
 func TestDNSHandler_UnknownType_NoAnswer(t *testing.T) {
 	s := newTestServer()
 
@@ -168,3 +196,34 @@ func TestDNSHandler_ReplyIPFallback(t *testing.T) {
 	a := w.written.Answer[0].(*dns.A)
 	require.Equal(t, "192.168.0.1", a.A.String())
 }
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestListenShutdown(t *testing.T) {
+	s := newTestServer()
+
+	// A stopped server listens again, on another port as well
+	for range 2 {
+		s.Port = freePort(t)
+		require.NoError(t, s.Listen())
+
+		req := new(dns.Msg)
+		req.SetQuestion("example.com.", dns.TypeA)
+		for _, network := range []string{"udp", "tcp"} {
+			c := &dns.Client{Net: network}
+			resp, _, err := c.Exchange(req, net.JoinHostPort(s.IP, strconv.Itoa(s.Port)))
+			require.NoError(t, err, network)
+			require.Len(t, resp.Answer, 1, network)
+		}
+
+		require.NoError(t, s.Shutdown(context.Background()))
+		_, err := net.Dial("tcp", net.JoinHostPort(s.IP, strconv.Itoa(s.Port)))
+		require.Error(t, err)
+	}
+}
@@ -1,13 +1,19 @@
 package dnsserver
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/miekg/dns"
 	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/metrics"
 	"goshs.de/goshs/v2/options"
 	"goshs.de/goshs/v2/webhook"
 	"goshs.de/goshs/v2/ws"
@@ -20,6 +26,13 @@ type DNSServer struct {
 	Hub     *ws.Hub
 	Silent  bool
 	WebHook *webhook.Webhook
+
+	// TXT records served instead of the echo, like ACME DNS-01 challenges
+	txtMu sync.Mutex
+	txt   map[string][]string
+
+	serversMu sync.Mutex
+	servers   []*dns.Server // udp and tcp while listening
 }
 
 func NewDNSServer(opts *options.Options, hub *ws.Hub, wh *webhook.Webhook) *DNSServer {
@@ -53,9 +66,15 @@ func (d *DNSServer) handler(w dns.ResponseWriter, r *dns.Msg) {
 			return
 		}
 		d.Hub.Broadcast <- eventBytes
+		metrics.DNSQueries.Inc(dnsType(q.Qtype))
+		logger.Access{Protocol: "dns", Client: event.Source, Event: "query", Method: event.QType, Path: event.Name}.
+			Infof("[DNS] %s query for %s from %s", event.QType, event.Name, event.Source)
 
 		// If webhook is enabled, send the DNS query to the webhook endpoint
-		logger.HandleWebhookSend(fmt.Sprintf("[DNS] - Source: %s - Type: %s - Query: %s", event.Source, event.QType, event.Name), "dns", *d.WebHook)
+		e := webhook.NewEvent("dns", fmt.Sprintf("[DNS] - Source: %s - Type: %s - Query: %s", event.Source, event.QType, event.Name))
+		e.Remote = event.Source
+		e.Fields = map[string]string{"name": event.Name, "qtype": event.QType}
+		logger.HandleWebhookEvent(e, *d.WebHook)
 
 		// If ReplyIP is not set, use the same IP as the DNS server
 		if d.ReplyIP == "" {
@@ -75,6 +94,15 @@ func (d *DNSServer) handler(w dns.ResponseWriter, r *dns.Msg) {
 				Mx:         "mail." + q.Name,
 			})
 		case dns.TypeTXT:
+			if values := d.txtRecords(q.Name); len(values) > 0 {
+				for _, value := range values {
+					m.Answer = append(m.Answer, &dns.TXT{
+						Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 1},
+						Txt: []string{value},
+					})
+				}
+				continue
+			}
 			m.Answer = append(m.Answer, &dns.TXT{
 				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 1},
 				Txt: []string{q.Name, "src=" + w.RemoteAddr().String()},
@@ -85,12 +113,90 @@ func (d *DNSServer) handler(w dns.ResponseWriter, r *dns.Msg) {
 	_ = w.WriteMsg(m)
 }
 
-func (d *DNSServer) Start() {
+// AddTXT serves value in the TXT records of fqdn.
+func (d *DNSServer) AddTXT(fqdn, value string) {
+	d.txtMu.Lock()
+	defer d.txtMu.Unlock()
+	if d.txt == nil {
+		d.txt = map[string][]string{}
+	}
+	name := dns.CanonicalName(fqdn)
+	if !slices.Contains(d.txt[name], value) {
+		d.txt[name] = append(d.txt[name], value)
+	}
+}
+
+// RemoveTXT stops serving value in the TXT records of fqdn.
+func (d *DNSServer) RemoveTXT(fqdn, value string) {
+	d.txtMu.Lock()
+	defer d.txtMu.Unlock()
+	name := dns.CanonicalName(fqdn)
+	d.txt[name] = slices.DeleteFunc(d.txt[name], func(v string) bool { return v == value })
+	if len(d.txt[name]) == 0 {
+		delete(d.txt, name)
+	}
+}
+
+func (d *DNSServer) txtRecords(name string) []string {
+	d.txtMu.Lock()
+	defer d.txtMu.Unlock()
+	return slices.Clone(d.txt[strings.ToLower(name)])
+}
+
+// Listen binds udp and tcp and answers queries in the background.
+func (d *DNSServer) Listen() error {
 	addr := net.JoinHostPort(d.IP, strconv.Itoa(d.Port))
-	udpServer := &dns.Server{Addr: addr, Net: "udp", Handler: dns.HandlerFunc(d.handler)}
-	tcpServer := &dns.Server{Addr: addr, Net: "tcp", Handler: dns.HandlerFunc(d.handler)}
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		_ = pc.Close()
+		return err
+	}
+
+	// Shutdown fails on servers not yet started
+	var started sync.WaitGroup
+	started.Add(2)
+	servers := []*dns.Server{
+		{PacketConn: pc, Handler: dns.HandlerFunc(d.handler), NotifyStartedFunc: started.Done},
+		{Listener: ln, Handler: dns.HandlerFunc(d.handler), NotifyStartedFunc: started.Done},
+	}
+	for _, srv := range servers {
+		go func() { _ = srv.ActivateAndServe() }()
+	}
+	started.Wait()
+
+	d.serversMu.Lock()
+	d.servers = servers
+	d.serversMu.Unlock()
+
 	logger.Infof("DNS server listening on udp/tcp %s:%d", d.IP, d.Port)
+	return nil
+}
 
-	go func() { _ = udpServer.ListenAndServe() }()
-	go func() { _ = tcpServer.ListenAndServe() }()
+// Shutdown stops answering queries.
+func (d *DNSServer) Shutdown(ctx context.Context) error {
+	d.serversMu.Lock()
+	servers := d.servers
+	d.servers = nil
+	d.serversMu.Unlock()
+
+	var errs []error
+	for _, srv := range servers {
+		if err := srv.ShutdownContext(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// dnsType names the query type qtype for the metrics, unknown types are
+// counted together.
+func dnsType(qtype uint16) string {
+	if name, ok := dns.TypeToString[qtype]; ok {
+		return name
+	}
+	return "other"
 }
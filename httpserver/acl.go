@@ -0,0 +1,172 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"golang.org/x/net/webdav"
+	"goshs.de/goshs/v2/acl"
+	"goshs.de/goshs/v2/logger"
+)
+
+// aclRequest describes req as an operation on the local path p.
+func (fs *FileServer) aclRequest(req *http.Request, method acl.Method, p string, isDir bool) acl.Request {
+	username, password, _ := req.BasicAuth()
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		ip = req.RemoteAddr
+	}
+	if fs.Whitelist != nil {
+		ip = GetClientIP(req, fs.Whitelist)
+	}
+	r := acl.Request{
+		Method:   method,
+		Path:     p,
+		IsDir:    isDir,
+		IP:       net.ParseIP(ip),
+		Username: username,
+		Password: password,
+	}
+	if a := namedAccount(req); a != nil {
+		r.User = a.Name
+	} else if s := oidcFromContext(req); s != nil {
+		r.User = s.Identity()
+	} else if s := totpFromContext(req); s != nil {
+		r.User = s.User
+	} else if fs.basicAuthEnabled() {
+		r.User = username
+	}
+	return r
+}
+
+// aclAllowed evaluates the rules of config for the request. The identity is
+// the .goshs user if the file has any, otherwise the server login.
+func (fs *FileServer) aclAllowed(req *http.Request, config configFile, method acl.Method, p string, isDir bool) bool {
+	r := fs.aclRequest(req, method, p, isDir)
+	user := r.User
+	if config.RequiresAuth() {
+		user = r.Username
+	}
+	return config.Allowed(r, user)
+}
+
+// applyACLRules answers the request with 403 if the rules of config deny
+// it. Credentials and the block list are checked by the callers before.
+func (fs *FileServer) applyACLRules(w http.ResponseWriter, req *http.Request, config configFile, method acl.Method, p string, isDir bool) bool {
+	if fs.aclAllowed(req, config, method, p, isDir) {
+		return true
+	}
+	logger.Warnf("[ACL] %s denied on %s", method, p)
+	fs.handleError(w, req, fmt.Errorf("%s not allowed by ACL", method), http.StatusForbidden)
+	return false
+}
+
+// readableByACL reports whether the .goshs files allow the request to
+// download p. Used where files are skipped instead of rejected.
+func (fs *FileServer) readableByACL(req *http.Request, root, p string, isDir bool) bool {
+	method := acl.Read
+	if isDir {
+		method = acl.List
+	}
+	return fs.ACL.Check(root, fs.aclRequest(req, method, p, isDir)) == acl.Allowed
+}
+
+// enforceACL runs the complete .goshs check for p below root and answers the
+// request if it is not allowed. Used by WebDAV, which does not render the
+// HTML error pages.
+func (fs *FileServer) enforceACL(w http.ResponseWriter, req *http.Request, root string, method acl.Method, p string, isDir bool) bool {
+	switch fs.ACL.Check(root, fs.aclRequest(req, method, p, isDir)) {
+	case acl.Unauthorized:
+		if !fs.Invisible {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Filebased Restricted"`)
+		}
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return false
+	case acl.Forbidden:
+		logger.Warnf("[ACL] %s denied on %s", method, p)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	case acl.Hidden:
+		http.NotFound(w, req)
+		return false
+	}
+	return true
+}
+
+// webdavACL maps a WebDAV request onto the ACL methods and enforces them for
+// the source and, for COPY and MOVE, the destination below root.
+func (fs *FileServer) webdavACL(w http.ResponseWriter, r *http.Request, root string) bool {
+	local := func(p string) (string, bool) {
+		name := filepath.Join(root, filepath.FromSlash(path.Clean("/"+p)))
+		info, err := os.Stat(name)
+		return name, err == nil && info.IsDir()
+	}
+	src, isDir := local(r.URL.Path)
+	create := acl.Upload
+	if isDir {
+		create = acl.Mkdir
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, "PROPFIND":
+		method := acl.Read
+		if isDir {
+			method = acl.List
+		}
+		return fs.enforceACL(w, r, root, method, src, isDir)
+	case http.MethodPut, "PROPPATCH", "LOCK", "UNLOCK":
+		return fs.enforceACL(w, r, root, acl.Upload, src, false)
+	case "MKCOL":
+		return fs.enforceACL(w, r, root, acl.Mkdir, src, true)
+	case http.MethodDelete:
+		return fs.enforceACL(w, r, root, acl.Delete, src, isDir)
+	case "COPY", "MOVE":
+		method := acl.Read
+		if r.Method == "MOVE" {
+			method = acl.Delete
+		}
+		if !fs.enforceACL(w, r, root, method, src, isDir) {
+			return false
+		}
+		u, err := url.Parse(r.Header.Get("Destination"))
+		if err != nil {
+			http.Error(w, "Bad Destination", http.StatusBadRequest)
+			return false
+		}
+		dst, _ := local(u.Path)
+		return fs.enforceACL(w, r, root, create, dst, isDir)
+	}
+	return true
+}
+
+// aclDir is a webdav.Dir that leaves blocked entries out of listings.
+type aclDir struct {
+	webdav.Dir
+	store *acl.Store
+}
+
+func (d aclDir) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	f, err := d.Dir.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	root := string(d.Dir)
+	return aclFile{File: f, visible: d.store.Visible(root, filepath.Join(root, filepath.FromSlash(path.Clean("/"+name))))}, nil
+}
+
+type aclFile struct {
+	webdav.File
+	visible func(name string, isDir bool) bool
+}
+
+func (f aclFile) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(count)
+	return slices.DeleteFunc(infos, func(i os.FileInfo) bool { return !f.visible(i.Name(), i.IsDir()) }), err
+}
@@ -0,0 +1,101 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+	"goshs.de/goshs/v2/acl"
+)
+
+// newACLFileServer returns a file server whose webroot has a .goshs file with
+// two users, bob may not delete and nobody may upload into releases.
+func newACLFileServer(t *testing.T) *FileServer {
+	t.Helper()
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "releases"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "id.key"), []byte("key"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, acl.FileName), []byte(`{
+		"users": {"alice": "pw", "bob": "pw"},
+		"block": ["*.key"],
+		"rules": [
+			{"deny": ["delete"], "users": ["bob"]},
+			{"deny": ["upload", "mkdir"], "paths": ["releases"]}
+		]
+	}`), 0644))
+
+	fs, cleanup := newTestFileServer(t, root)
+	t.Cleanup(cleanup)
+	fs.ACL = acl.NewStore()
+	return fs
+}
+
+func aclRequestAs(user, method, target string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	r.Header.Set("Authorization", basicAuthHeader(user, "pw"))
+	r.Header.Set("X-CSRF-Token", "test-csrf")
+	return r
+}
+
+func TestACLRules_PerUserDelete(t *testing.T) {
+	fs := newACLFileServer(t)
+
+	w := httptest.NewRecorder()
+	fs.deleteFile(w, aclRequestAs("bob", http.MethodDelete, "/a.txt"))
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.FileExists(t, filepath.Join(fs.Webroot, "a.txt"))
+
+	w = httptest.NewRecorder()
+	fs.deleteFile(w, aclRequestAs("carol", http.MethodDelete, "/a.txt"))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	fs.deleteFile(w, aclRequestAs("alice", http.MethodDelete, "/a.txt"))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoFileExists(t, filepath.Join(fs.Webroot, "a.txt"))
+}
+
+func TestACLRules_PathRule(t *testing.T) {
+	fs := newACLFileServer(t)
+
+	w := httptest.NewRecorder()
+	fs.handleMkdir(w, aclRequestAs("alice", http.MethodPost, "/releases/v1/"))
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.NoDirExists(t, filepath.Join(fs.Webroot, "releases", "v1"))
+
+	w = httptest.NewRecorder()
+	fs.handleMkdir(w, aclRequestAs("alice", http.MethodPost, "/other/"))
+	require.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestACLRules_Webdav(t *testing.T) {
+	fs := newACLFileServer(t)
+	h := fs.webdavAccess(&webdav.Handler{
+		FileSystem: webdav.Dir(fs.Webroot),
+		LockSystem: webdav.NewMemLS(),
+	})
+	do := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusUnauthorized, do(httptest.NewRequest(http.MethodGet, "/a.txt", nil)).Code)
+	require.Equal(t, http.StatusOK, do(aclRequestAs("bob", http.MethodGet, "/a.txt")).Code)
+	require.Equal(t, http.StatusNotFound, do(aclRequestAs("bob", http.MethodGet, "/id.key")).Code)
+	require.Equal(t, http.StatusForbidden, do(aclRequestAs("bob", http.MethodDelete, "/a.txt")).Code)
+	require.Equal(t, http.StatusForbidden, do(aclRequestAs("alice", http.MethodPut, "/releases/x.zip")).Code)
+
+	r := aclRequestAs("bob", "PROPFIND", "/")
+	r.Header.Set("Depth", "1")
+	w := do(r)
+	require.Equal(t, http.StatusMultiStatus, w.Code)
+	require.Contains(t, w.Body.String(), "a.txt")
+	require.NotContains(t, w.Body.String(), "id.key")
+	require.NotContains(t, w.Body.String(), acl.FileName)
+}
@@ -0,0 +1,257 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"goshs.de/goshs/v2/apitoken"
+	"goshs.de/goshs/v2/duration"
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/users"
+)
+
+type apiTokenKey struct{}
+
+func tokenFromContext(r *http.Request) *apitoken.Token {
+	t, _ := r.Context().Value(apiTokenKey{}).(*apitoken.Token)
+	return t
+}
+
+// byToken names the API token or upload request of r in log and webhook
+// messages.
+func byToken(r *http.Request) string {
+	if t := tokenFromContext(r); t != nil {
+		return fmt.Sprintf(" (token %s)", t.Name)
+	}
+	if u := uploadRequestFromContext(r); u != nil {
+		return fmt.Sprintf(" (upload request %s)", u.path)
+	}
+	return ""
+}
+
+// tokenAccount is the account a token acts as, so the role checks of the
+// handlers apply to it. What it may reach at all is decided by tokenAllows,
+// the administrative APIs let in the tokens of their scope.
+func tokenAccount(t *apitoken.Token) *users.Account {
+	a := &users.Account{Name: t.Name, Role: users.RoleNone}
+	switch t.Scope {
+	case apitoken.ScopeUpload:
+		a.Role = users.RoleUpload
+	case apitoken.ScopeRead:
+		a.Role = users.RoleRead
+	}
+	return a
+}
+
+// tokenAllows reports whether r is within the scope of t.
+func tokenAllows(t *apitoken.Token, r *http.Request, webdav bool) bool {
+	q := r.URL.Query()
+	switch t.Scope {
+	case apitoken.ScopeUpload:
+		if webdav {
+			return r.Method == http.MethodPut || r.Method == "MKCOL"
+		}
+		return isUploadRequest(r)
+
+	case apitoken.ScopeRead:
+		if !t.Covers(r.URL.Path) {
+			return false
+		}
+		if webdav {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+				return true
+			}
+			return false
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			return false
+		}
+		for k, files := range q {
+			switch k {
+			case "json", "download", "bulk":
+			case "file":
+				for _, f := range files {
+					if !t.Covers(f) {
+						return false
+					}
+				}
+			default:
+				return false
+			}
+		}
+		return true
+
+	case apitoken.ScopeEvents:
+		return !webdav && r.Method == http.MethodGet && len(q) == 1 && q.Has("events-api")
+
+	case apitoken.ScopeCatcher:
+		// Only the catcher keys, the handlers ahead of them would serve others
+		if webdav {
+			return false
+		}
+		if len(q) == 1 && q.Has("catcher-api") {
+			return true
+		}
+		return q.Has("catcher-ws") && (len(q) == 1 || (len(q) == 2 && q.Has("session")))
+
+	case apitoken.ScopeMetrics:
+		return !webdav && (r.Method == http.MethodGet || r.Method == http.MethodHead) && r.URL.Path == metricsPath && len(q) == 0
+	}
+	return false
+}
+
+// TokenMiddleware accepts API tokens sent as "Authorization: Bearer" and
+// limits the request to the scope of the token. Requests without a token
+// are left to the other auth middlewares.
+func (fs *FileServer) TokenMiddleware(next http.Handler) http.Handler {
+	return fs.tokenMiddleware(next, false)
+}
+
+func (fs *FileServer) tokenMiddleware(next http.Handler, webdav bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || fs.Tokens == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		clientIP := failureAddr(r)
+		if fs.authLocked(clientIP) {
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+		t := fs.Tokens.Authenticate(strings.TrimSpace(secret), time.Now())
+		if t == nil {
+			fs.authFailed(clientIP)
+			logDenied(r, eventAuthFailure, http.StatusUnauthorized, "", "[TOKEN] invalid or expired token from %s", clientIP)
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+		if !tokenAllows(t, r, webdav) {
+			logger.Warnf("[TOKEN] %s (%s) denied %s %s", t.Name, t.Scope, r.Method, r.URL.RequestURI())
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		logger.Infof("[TOKEN] %s: %s %s", t.Name, r.Method, r.URL.RequestURI())
+		ctx := context.WithValue(r.Context(), apiTokenKey{}, t)
+		next.ServeHTTP(w, r.WithContext(users.NewContext(ctx, tokenAccount(t))))
+	})
+}
+
+// handleTokenAPI lists, creates and revokes API tokens.
+func (fs *FileServer) handleTokenAPI(w http.ResponseWriter, req *http.Request, action string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if fs.Tokens == nil {
+		http.Error(w, `{"error":"api tokens not enabled"}`, http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "list":
+		list, err := fs.Tokens.List()
+		if err != nil {
+			logger.Errorf("token api: %v", err)
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(list)
+
+	case "create":
+		if req.Method != http.MethodPost {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		if !fs.checkCSRF(w, req) {
+			return
+		}
+		var body struct {
+			Name    string `json:"name"`
+			Scope   string `json:"scope"`
+			Path    string `json:"path"`
+			Expires string `json:"expires"` // lifetime like 12h or 30d
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			return
+		}
+		scope, err := apitoken.ParseScope(body.Scope)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		ttl, err := duration.Parse(body.Expires)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		t, secret, err := apitoken.New(body.Name, scope, body.Path, ttl)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		if err := fs.Tokens.Add(t); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusConflict)
+			return
+		}
+		logger.Infof("[TOKEN] created %s token %s", t.Scope, t.Name)
+		t.Hash = ""
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(struct {
+			apitoken.Token
+			Secret string `json:"token"`
+		}{*t, secret})
+
+	case "revoke":
+		if req.Method != http.MethodPost && req.Method != http.MethodDelete {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		if !fs.checkCSRF(w, req) {
+			return
+		}
+		name := req.URL.Query().Get("name")
+		if err := fs.Tokens.Revoke(name); err != nil {
+			if errors.Is(err, apitoken.ErrNotFound) {
+				http.Error(w, `{"error":"token not found"}`, http.StatusNotFound)
+				return
+			}
+			logger.Errorf("token api: %v", err)
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		logger.Infof("[TOKEN] revoked token %s", name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, `{"error":"unknown action"}`, http.StatusBadRequest)
+	}
+}
+
+// handleEventsAPI serves the collaborator history for scripts polling it
+// instead of holding the websocket open.
+func (fs *FileServer) handleEventsAPI(w http.ResponseWriter, req *http.Request, action string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch action {
+	case "list":
+		data, err := fs.Hub.Catchup()
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		if _, err := w.Write(data); err != nil {
+			logger.Error(err)
+		}
+
+	default:
+		http.Error(w, `{"error":"unknown action"}`, http.StatusBadRequest)
+	}
+}
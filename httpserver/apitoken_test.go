@@ -0,0 +1,171 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/apitoken"
+	"goshs.de/goshs/v2/catcher"
+	"goshs.de/goshs/v2/options"
+)
+
+func newTokenFileServer(t *testing.T, what string) (*FileServer, *CustomMux, string) {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "loot"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "loot", "a.txt"), []byte("loot"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0o644))
+
+	fs, cleanup := newTestFileServer(t, dir)
+	t.Cleanup(cleanup)
+	fs.User, fs.Pass = "admin", "pw"
+	fs.Options = &options.Options{}
+	fs.CatcherMgr = catcher.NewManager(fs.Hub)
+	store, err := apitoken.Load(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	fs.Tokens = store
+
+	mux := NewCustomMux()
+	_ = fs.SetupMux(mux, what)
+	return fs, mux, dir
+}
+
+func addToken(t *testing.T, fs *FileServer, name string, scope apitoken.Scope, p string) string {
+	t.Helper()
+	tok, secret, err := apitoken.New(name, scope, p, 0)
+	require.NoError(t, err)
+	require.NoError(t, fs.Tokens.Add(tok))
+	return secret
+}
+
+func tokenRequest(h http.Handler, method, target, secret string) *httptest.ResponseRecorder {
+	var body io.Reader
+	if method == http.MethodPut {
+		body = strings.NewReader("data")
+	}
+	r := httptest.NewRequest(method, target, body)
+	if secret != "" {
+		r.Header.Set("Authorization", "Bearer "+secret)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestAPIToken_Scopes(t *testing.T) {
+	fs, mux, dir := newTokenFileServer(t, modeWeb)
+	up := addToken(t, fs, "up", apitoken.ScopeUpload, "")
+	read := addToken(t, fs, "read", apitoken.ScopeRead, "/loot")
+	events := addToken(t, fs, "events", apitoken.ScopeEvents, "")
+	catch := addToken(t, fs, "catch", apitoken.ScopeCatcher, "")
+
+	require.Equal(t, http.StatusUnauthorized, tokenRequest(mux, http.MethodGet, "/", "").Code)
+	require.Equal(t, http.StatusUnauthorized, tokenRequest(mux, http.MethodGet, "/", apitoken.Prefix+"nope").Code)
+
+	// Upload tokens only upload
+	require.Equal(t, http.StatusOK, tokenRequest(mux, http.MethodPut, "/new.txt", up).Code)
+	data, err := os.ReadFile(filepath.Join(dir, "new.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "data", string(data))
+	require.Equal(t, http.StatusForbidden, tokenRequest(mux, http.MethodGet, "/secret.txt", up).Code)
+	require.Equal(t, http.StatusForbidden, tokenRequest(mux, http.MethodGet, "/?json", up).Code)
+	require.Equal(t, http.StatusForbidden, tokenRequest(mux, http.MethodPut, "/x.txt?catcher-api=start", up).Code)
+
+	// Read tokens stay below their path
+	w := tokenRequest(mux, http.MethodGet, "/loot/a.txt", read)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "loot", w.Body.String())
+	require.Equal(t, http.StatusOK, tokenRequest(mux, http.MethodGet, "/loot/?json", read).Code)
+	require.Equal(t, http.StatusForbidden, tokenRequest(mux, http.MethodGet, "/secret.txt", read).Code)
+	require.Equal(t, http.StatusForbidden, tokenRequest(mux, http.MethodGet, "/loot/a.txt?share", read).Code)
+	require.Equal(t, http.StatusForbidden, tokenRequest(mux, http.MethodGet, "/loot/?bulk&file=/secret.txt", read).Code)
+	require.Equal(t, http.StatusForbidden, tokenRequest(mux, http.MethodPut, "/loot/b.txt", read).Code)
+
+	// Events tokens read the collaborator history and nothing else
+	w = tokenRequest(mux, http.MethodGet, "/?events-api=list", events)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, json.Valid(w.Body.Bytes()))
+	require.Equal(t, http.StatusForbidden, tokenRequest(mux, http.MethodGet, "/?ws", events).Code)
+	require.Equal(t, http.StatusForbidden, tokenRequest(mux, http.MethodGet, "/?token-api=list", events).Code)
+
+	// Catcher tokens control the catcher
+	w = tokenRequest(mux, http.MethodGet, "/?catcher-api=list", catch)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, http.StatusForbidden, tokenRequest(mux, http.MethodGet, "/?events-api=list", catch).Code)
+
+	require.NotEqual(t, http.StatusForbidden, tokenRequest(mux, http.MethodGet, "/?catcher-ws&session=x", catch).Code)
+
+	// The handlers ahead of the catcher API are not reached with it
+	for _, target := range []string{"/?goshs-info&catcher-api=list", "/?ws&catcher-api", "/?smtp=x&catcher-api", "/?json&catcher-ws"} {
+		require.Equal(t, http.StatusForbidden, tokenRequest(mux, http.MethodGet, target, catch).Code, target)
+	}
+	require.Equal(t, http.StatusForbidden, tokenRequest(mux, http.MethodGet, "/?goshs-info&events-api=list", events).Code)
+
+	// Scoped tokens have no file access of their own
+	for _, secret := range []string{events, catch} {
+		require.False(t, tokenAccount(fs.Tokens.Authenticate(secret, time.Now())).CanRead())
+		require.False(t, tokenAccount(fs.Tokens.Authenticate(secret, time.Now())).IsAdmin())
+	}
+}
+
+func TestAPIToken_API(t *testing.T) {
+	fs, mux, _ := newTokenFileServer(t, modeWeb)
+	admin := func(method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", basicAuthHeader("admin", "pw"))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := admin(http.MethodPost, "/?token-api=create", `{"name":"ci","scope":"read","path":"loot","expires":"7d"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		apitoken.Token
+		Secret string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.Equal(t, "/loot", created.Path)
+	require.Empty(t, created.Hash)
+	require.False(t, created.Expires.IsZero())
+	require.True(t, strings.HasPrefix(created.Secret, apitoken.Prefix), w.Body.String())
+
+	require.Equal(t, http.StatusConflict, admin(http.MethodPost, "/?token-api=create", `{"name":"ci","scope":"read"}`).Code)
+	require.Equal(t, http.StatusBadRequest, admin(http.MethodPost, "/?token-api=create", `{"name":"x","scope":"admin"}`).Code)
+
+	w = admin(http.MethodGet, "/?token-api=list", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"name":"ci"`)
+	require.NotContains(t, w.Body.String(), "hash")
+
+	require.Equal(t, http.StatusOK, tokenRequest(mux, http.MethodGet, "/loot/a.txt", created.Secret).Code)
+	require.Equal(t, http.StatusNoContent, admin(http.MethodDelete, "/?token-api=revoke&name=ci", "").Code)
+	require.Equal(t, http.StatusNotFound, admin(http.MethodDelete, "/?token-api=revoke&name=ci", "").Code)
+	require.Equal(t, http.StatusUnauthorized, tokenRequest(mux, http.MethodGet, "/loot/a.txt", created.Secret).Code)
+
+	fs.Tokens = nil
+	require.Equal(t, http.StatusNotFound, admin(http.MethodGet, "/?token-api=list", "").Code)
+}
+
+func TestAPIToken_WebDAV(t *testing.T) {
+	fs, mux, dir := newTokenFileServer(t, "webdav")
+	up := addToken(t, fs, "up", apitoken.ScopeUpload, "")
+	read := addToken(t, fs, "read", apitoken.ScopeRead, "/loot")
+
+	require.Equal(t, http.StatusCreated, tokenRequest(mux, http.MethodPut, "/new.txt", up).Code)
+	require.FileExists(t, filepath.Join(dir, "new.txt"))
+	require.Equal(t, http.StatusForbidden, tokenRequest(mux, "PROPFIND", "/", up).Code)
+
+	require.Equal(t, http.StatusMultiStatus, tokenRequest(mux, "PROPFIND", "/loot/", read).Code)
+	require.Equal(t, http.StatusOK, tokenRequest(mux, http.MethodGet, "/loot/a.txt", read).Code)
+	require.Equal(t, http.StatusForbidden, tokenRequest(mux, http.MethodGet, "/secret.txt", read).Code)
+	require.Equal(t, http.StatusForbidden, tokenRequest(mux, http.MethodDelete, "/loot/a.txt", read).Code)
+}
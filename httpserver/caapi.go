@@ -0,0 +1,108 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"goshs.de/goshs/v2/ca"
+	"goshs.de/goshs/v2/logger"
+)
+
+// handleCAAPI hands out the certificate of the persistent goshs CA, issues
+// client certificates for certificate authentication and revokes them.
+func (fs *FileServer) handleCAAPI(w http.ResponseWriter, req *http.Request, action string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if fs.CA == nil {
+		http.Error(w, `{"error":"goshs CA not in use"}`, http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "cert":
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Header().Set("Content-Disposition", `attachment; filename="goshs-ca.crt"`)
+		w.Write(fs.CA.CertPEM())
+
+	case "list":
+		list, err := fs.CA.Issued()
+		if err != nil {
+			logger.Errorf("ca api: %v", err)
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(list)
+
+	case "issue":
+		if req.Method != http.MethodPost {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		if !fs.checkCSRF(w, req) {
+			return
+		}
+		body := struct {
+			Name     string `json:"name"`
+			Password string `json:"password"` // protects the PKCS#12 file
+			Days     int    `json:"days"`
+		}{Days: 365}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			return
+		}
+		p12, issued, err := fs.CA.IssueClient(body.Name, body.Days, body.Password)
+		if err != nil {
+			if errors.Is(err, ca.ErrClientRequest) {
+				http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+				return
+			}
+			logger.Errorf("ca api: %v", err)
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		logger.Infof("[CA] issued client certificate %s for %s", issued.Serial, issued.Name)
+		w.Header().Set("Content-Type", "application/x-pkcs12")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", issued.Name+".p12"))
+		w.Header().Set("X-Goshs-Serial", issued.Serial)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(p12)
+
+	case "revoke":
+		if req.Method != http.MethodPost && req.Method != http.MethodDelete {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		if !fs.checkCSRF(w, req) {
+			return
+		}
+		revocations := fs.Revocations
+		if revocations == nil || revocations.SerialsFile() == "" {
+			var err error
+			if revocations, err = ca.LoadRevocations(fs.CA.RevokedFile(), "", nil); err != nil {
+				logger.Errorf("ca api: %v", err)
+				http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+				return
+			}
+		}
+		serial, err := ca.ParseSerial(req.URL.Query().Get("serial"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		if _, err := revocations.Revoke(serial); err != nil {
+			logger.Errorf("ca api: %v", err)
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		if err := fs.CA.MarkRevoked(serial); err != nil {
+			logger.Warnf("ca api: %v", err)
+		}
+		logger.Infof("[CA] revoked client certificate %s", serial)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, `{"error":"unknown action"}`, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,69 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/apitoken"
+	"goshs.de/goshs/v2/ca"
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+func TestCAAPI(t *testing.T) {
+	fs, mux, _ := newTokenFileServer(t, modeWeb)
+	admin := func(method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", basicAuthHeader("admin", "pw"))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusNotFound, admin(http.MethodGet, "/?ca-api=cert", "").Code)
+
+	authority, err := ca.Open(t.TempDir())
+	require.NoError(t, err)
+	fs.CA = authority
+
+	w := admin(http.MethodGet, "/?ca-api=cert", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, authority.CertPEM(), w.Body.Bytes())
+
+	w = admin(http.MethodPost, "/?ca-api=issue", `{"name":"alice","password":"s3cret","days":7}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.Equal(t, "application/x-pkcs12", w.Header().Get("Content-Type"))
+	require.Contains(t, w.Header().Get("Content-Disposition"), `"alice.p12"`)
+	_, cert, _, err := pkcs12.DecodeChain(w.Body.Bytes(), "s3cret")
+	require.NoError(t, err)
+	require.Equal(t, "alice", cert.Subject.CommonName)
+	require.Equal(t, cert.SerialNumber.Text(16), w.Header().Get("X-Goshs-Serial"))
+
+	require.Equal(t, http.StatusBadRequest, admin(http.MethodPost, "/?ca-api=issue", `{"name":"bob"}`).Code)
+	require.Equal(t, http.StatusMethodNotAllowed, admin(http.MethodGet, "/?ca-api=issue", "").Code)
+
+	w = admin(http.MethodGet, "/?ca-api=list", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list []ca.IssuedCert
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	require.Equal(t, "alice", list[0].Name)
+
+	serial := list[0].Serial
+	require.Equal(t, http.StatusBadRequest, admin(http.MethodDelete, "/?ca-api=revoke&serial=xyz", "").Code)
+	require.Equal(t, http.StatusNoContent, admin(http.MethodDelete, "/?ca-api=revoke&serial="+serial, "").Code)
+	require.True(t, fs.CA.Certificate().IsCA)
+	revocations, err := ca.LoadRevocations(authority.RevokedFile(), "", nil)
+	require.NoError(t, err)
+	require.True(t, revocations.Revoked(cert))
+	list, err = authority.Issued()
+	require.NoError(t, err)
+	require.NotNil(t, list[0].Revoked)
+
+	// API tokens never reach the CA
+	read := addToken(t, fs, "ro", apitoken.ScopeRead, "")
+	require.Equal(t, http.StatusForbidden, tokenRequest(mux, http.MethodGet, "/?ca-api=list", read).Code)
+}
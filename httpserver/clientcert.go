@@ -0,0 +1,93 @@
+package httpserver
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+
+	"goshs.de/goshs/v2/ca"
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/users"
+)
+
+// clientCert returns the verified client certificate of r, nil without
+// certificate auth.
+func clientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+// verifyClientCert rejects revoked client certificates during the handshake.
+func (fs *FileServer) verifyClientCert(_ [][]byte, chains [][]*x509.Certificate) error {
+	for _, chain := range chains {
+		if len(chain) > 0 && fs.Revocations.Revoked(chain[0]) {
+			logger.Warnf("[AUTH] revoked client certificate %s (serial %s) rejected", ca.Identity(chain[0]), chain[0].SerialNumber.Text(16))
+			return fmt.Errorf("client certificate %s is revoked", chain[0].SerialNumber.Text(16))
+		}
+	}
+	return nil
+}
+
+// certAccount returns the account -ca-map assigns to cert, taken from the
+// users file if it has one of that name, or nil.
+func (fs *FileServer) certAccount(cert *x509.Certificate) *users.Account {
+	m := fs.CertMap.Lookup(cert)
+	if m == nil {
+		return nil
+	}
+	a := &users.Account{Name: m.User, Role: users.RoleFull}
+	if fs.Users != nil {
+		if u := fs.Users.Lookup(m.User); u != nil {
+			copied := *u
+			a = &copied
+		}
+	}
+	if m.Role != "" {
+		a.Role = m.Role
+	}
+	return a
+}
+
+// ClientCertMiddleware names the client certificate of the request in the
+// logs, denies certificates revoked while their connection was open and,
+// with -ca-map, acts as the mapped account unless the request logged in.
+func (fs *FileServer) ClientCertMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cert := clientCert(r)
+		if cert == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		identity := ca.Identity(cert)
+
+		if fs.Revocations != nil && fs.Revocations.Revoked(cert) {
+			logDenied(r, eventDenied, http.StatusForbidden, identity, "[AUTH] revoked client certificate %s (serial %s) denied access to %s", identity, cert.SerialNumber.Text(16), r.URL.RequestURI())
+			fs.denyClientCert(w)
+			return
+		}
+		r = logger.WithIdentity(r, identity)
+
+		if fs.CertMap != nil {
+			a := fs.certAccount(cert)
+			if a == nil {
+				logDenied(r, eventDenied, http.StatusForbidden, identity, "[AUTH] client certificate %s is not mapped to a user", identity)
+				fs.denyClientCert(w)
+				return
+			}
+			if namedAccount(r) == nil {
+				r = r.WithContext(users.NewContext(r.Context(), a))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (fs *FileServer) denyClientCert(w http.ResponseWriter) {
+	if fs.Invisible {
+		fs.handleInvisible(w)
+		return
+	}
+	http.Error(w, "Forbidden", http.StatusForbidden)
+}
@@ -0,0 +1,92 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/ca"
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/users"
+)
+
+func certRequest(cn string, serial int64) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+	}}}
+	return r
+}
+
+func TestClientCertMiddleware(t *testing.T) {
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	defer cleanup()
+
+	var seen *http.Request
+	h := fs.ClientCertMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r
+	}))
+	serve := func(r *http.Request) int {
+		seen = nil
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Without certificate the request passes unchanged
+	require.Equal(t, http.StatusOK, serve(httptest.NewRequest(http.MethodGet, "/", nil)))
+	require.Nil(t, namedAccount(seen))
+
+	// Without mapping the certificate is only named
+	require.Equal(t, http.StatusOK, serve(certRequest("laptop-01", 0x10)))
+	require.Nil(t, namedAccount(seen))
+	require.True(t, strings.HasSuffix(logger.Client(seen), "(laptop-01)"))
+
+	// Revoked certificates are denied
+	revoked := filepath.Join(t.TempDir(), "revoked.txt")
+	revocations, err := ca.LoadRevocations(revoked, "", nil)
+	require.NoError(t, err)
+	_, err = revocations.Revoke("10")
+	require.NoError(t, err)
+	fs.Revocations = revocations
+	require.Equal(t, http.StatusForbidden, serve(certRequest("laptop-01", 0x10)))
+	require.Nil(t, seen)
+	require.Error(t, fs.verifyClientCert(nil, [][]*x509.Certificate{certRequest("laptop-01", 0x10).TLS.PeerCertificates}))
+	require.NoError(t, fs.verifyClientCert(nil, [][]*x509.Certificate{certRequest("laptop-02", 0x11).TLS.PeerCertificates}))
+
+	// The mapping assigns accounts and denies unmapped certificates
+	u, err := users.Parse(strings.NewReader("bob:pw:read:bob\n"))
+	require.NoError(t, err)
+	fs.Users = u
+	m, err := ca.ParseIdentityMap(strings.NewReader("laptop-02 alice admin\nphone bob\ntablet bob full\n"))
+	require.NoError(t, err)
+	fs.CertMap = m
+
+	require.Equal(t, http.StatusOK, serve(certRequest("laptop-02", 0x11)))
+	require.Equal(t, "alice", namedAccount(seen).Name)
+	require.Equal(t, users.RoleAdmin, namedAccount(seen).Role)
+
+	require.Equal(t, http.StatusOK, serve(certRequest("phone", 0x12)))
+	require.Equal(t, users.RoleRead, namedAccount(seen).Role)
+	require.Equal(t, "bob", namedAccount(seen).Home)
+
+	require.Equal(t, http.StatusOK, serve(certRequest("tablet", 0x13)))
+	require.Equal(t, users.RoleFull, namedAccount(seen).Role)
+	require.Equal(t, users.RoleRead, u.Lookup("bob").Role)
+
+	require.Equal(t, http.StatusForbidden, serve(certRequest("stranger", 0x14)))
+
+	// A basic auth login keeps its own account
+	r := certRequest("laptop-02", 0x11)
+	r = r.WithContext(users.NewContext(r.Context(), u.Lookup("bob")))
+	require.Equal(t, http.StatusOK, serve(r))
+	require.Equal(t, "bob", namedAccount(seen).Name)
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"goshs.de/goshs/v2/ca"
 	"goshs.de/goshs/v2/logger"
 	"goshs.de/goshs/v2/ws"
 )
@@ -20,11 +21,18 @@ func (fs *FileServer) emitCollabEvent(r *http.Request, status int) []byte {
 	defer r.Body.Close()
 
 	// Flatten headers into a simple map (join multi-value headers with ", ").
-	// Strip the CSRF token so it is never exposed in the collaborator tab.
+	// Strip the CSRF token so it is never exposed in the collaborator tab,
+	// and with auth enabled the credentials and session cookies, which
+	// event token holders must not learn.
 	headers := make(map[string]string, len(r.Header))
 	for k, v := range r.Header {
-		if http.CanonicalHeaderKey(k) == "X-Csrf-Token" {
+		switch http.CanonicalHeaderKey(k) {
+		case "X-Csrf-Token":
 			continue
+		case "Authorization", "Cookie":
+			if fs.authEnabled() {
+				continue
+			}
 		}
 		headers[k] = strings.Join(v, ", ")
 	}
@@ -41,6 +49,12 @@ func (fs *FileServer) emitCollabEvent(r *http.Request, status int) []byte {
 		Status:     status,
 		Timestamp:  time.Now(),
 	}
+	if a := namedAccount(r); a != nil {
+		event.User = a.Name
+	}
+	if cert := clientCert(r); cert != nil {
+		event.Certificate = ca.Identity(cert)
+	}
 	eventBytes, err := json.Marshal(event)
 	if err != nil {
 		logger.Errorf("Error marshalling dns query event: %v", err)
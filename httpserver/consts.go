@@ -1,6 +1,7 @@
 package httpserver
 
 const (
-	modeWeb   string = "web"
-	chunkSize int    = 16 << 24
+	modeWeb     string = "web"
+	modeMetrics string = "metrics"
+	chunkSize   int    = 16 << 24
 )
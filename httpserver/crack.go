@@ -0,0 +1,104 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"goshs.de/goshs/v2/smbserver"
+)
+
+func (fs *FileServer) handleCrackAPI(w http.ResponseWriter, req *http.Request, action string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if fs.Cracker == nil {
+		http.Error(w, `{"error":"cracker not enabled"}`, http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "hashes":
+		json.NewEncoder(w).Encode(fs.Cracker.Hashes())
+
+	case "jobs":
+		json.NewEncoder(w).Encode(fs.Cracker.Jobs())
+
+	case "job":
+		job, ok := fs.Cracker.Job(req.URL.Query().Get("id"))
+		if !ok {
+			http.Error(w, `{"error":"job not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(job)
+
+	case "queue":
+		if req.Method != http.MethodPost {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		if !fs.checkCSRF(w, req) {
+			return
+		}
+		var body struct {
+			HashID string `json:"hashId"`
+			smbserver.CrackAttack
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			return
+		}
+		job, err := fs.Cracker.Enqueue(body.HashID, body.CrackAttack)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(job)
+
+	case "cancel":
+		if req.Method != http.MethodPost {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		if !fs.checkCSRF(w, req) {
+			return
+		}
+		var body struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			return
+		}
+		if err := fs.Cracker.Cancel(body.ID); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case "requeue":
+		if req.Method != http.MethodPost {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		if !fs.checkCSRF(w, req) {
+			return
+		}
+		var body struct {
+			ID     string                 `json:"id"`
+			Attack *smbserver.CrackAttack `json:"attack"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			return
+		}
+		job, err := fs.Cracker.Requeue(body.ID, body.Attack)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(job)
+
+	default:
+		http.Error(w, `{"error":"unknown action"}`, http.StatusBadRequest)
+	}
+}
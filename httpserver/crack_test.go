@@ -0,0 +1,102 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/smbserver"
+)
+
+func TestCrackAPI_Disabled(t *testing.T) {
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	defer cleanup()
+
+	rec := httptest.NewRecorder()
+	fs.handleCrackAPI(rec, httptest.NewRequest(http.MethodGet, "/?crack-api=jobs", nil), "jobs")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestCrackAPI_QueueListCancel(t *testing.T) {
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	defer cleanup()
+	fs.Cracker = smbserver.NewCracker(&options.Options{CrackWorkers: 1}, fs.Hub)
+	defer fs.Cracker.Stop()
+
+	hashID := fs.Cracker.Submit(&smbserver.CapturedHash{
+		Username: "alice",
+		Domain:   "CORP",
+		Protocol: smbserver.ProtoNTLMv2,
+	}, "smb", "10.0.0.1:445", "", "", nil)
+
+	// hashes
+	rec := httptest.NewRecorder()
+	fs.handleCrackAPI(rec, httptest.NewRequest(http.MethodGet, "/?crack-api=hashes", nil), "hashes")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var hashes []smbserver.CrackHash
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &hashes))
+	require.Len(t, hashes, 1)
+	require.Equal(t, hashID, hashes[0].ID)
+
+	// cross-origin requests without the CSRF token are rejected
+	body := `{"hashId":"` + hashID + `","mask":"?a?a?a?a"}`
+	req := httptest.NewRequest(http.MethodPost, "/?crack-api=queue", strings.NewReader(body))
+	req.Header.Set("Origin", "http://evil.example")
+	rec = httptest.NewRecorder()
+	fs.handleCrackAPI(rec, req, "queue")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Empty(t, fs.Cracker.Jobs())
+
+	req = httptest.NewRequest(http.MethodPost, "/?crack-api=queue", strings.NewReader(body))
+	req.Header.Set("X-CSRF-Token", "test-csrf")
+	rec = httptest.NewRecorder()
+	fs.handleCrackAPI(rec, req, "queue")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var job smbserver.CrackJob
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+	require.Equal(t, hashID, job.HashID)
+	require.Equal(t, "?a?a?a?a", job.Attack.Mask)
+
+	// bad mask
+	req = httptest.NewRequest(http.MethodPost, "/?crack-api=queue", strings.NewReader(`{"hashId":"`+hashID+`","mask":"?q"}`))
+	req.Header.Set("X-CSRF-Token", "test-csrf")
+	rec = httptest.NewRecorder()
+	fs.handleCrackAPI(rec, req, "queue")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// job
+	rec = httptest.NewRecorder()
+	fs.handleCrackAPI(rec, httptest.NewRequest(http.MethodGet, "/?crack-api=job&id="+job.ID, nil), "job")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// cancel
+	req = httptest.NewRequest(http.MethodPost, "/?crack-api=cancel", strings.NewReader(`{"id":"`+job.ID+`"}`))
+	req.Header.Set("X-CSRF-Token", "test-csrf")
+	rec = httptest.NewRecorder()
+	fs.handleCrackAPI(rec, req, "cancel")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	// requeue with a different attack
+	require.Eventually(t, func() bool {
+		j, _ := fs.Cracker.Job(job.ID)
+		return j.Status == smbserver.CrackCancelled
+	}, 5*time.Second, 10*time.Millisecond)
+	req = httptest.NewRequest(http.MethodPost, "/?crack-api=requeue", strings.NewReader(`{"id":"`+job.ID+`","attack":{"mask":"?d"}}`))
+	req.Header.Set("X-CSRF-Token", "test-csrf")
+	rec = httptest.NewRecorder()
+	fs.handleCrackAPI(rec, req, "requeue")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	fs.handleCrackAPI(rec, httptest.NewRequest(http.MethodGet, "/?crack-api=jobs", nil), "jobs")
+	var jobs []smbserver.CrackJob
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &jobs))
+	require.Len(t, jobs, 2)
+	require.Equal(t, "?d", jobs[1].Attack.Mask)
+}
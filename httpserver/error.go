@@ -35,7 +35,7 @@ func (fs *FileServer) handleError(w http.ResponseWriter, req *http.Request, err
 
 	// Log to console
 	body := fs.emitCollabEvent(req, status)
-	logger.LogRequest(req, status, fs.Verbose, fs.Webhook, body)
+	logger.LogRequest(req, status, fs.verbose(), fs.Webhook, body)
 
 	// Construct error for template filling
 	if fs.Silent {
@@ -114,6 +114,8 @@ func (fs *FileServer) logStart(what string) {
 		} else {
 			logger.Infof("Serving WEBDAV on %+v:%+v from %+v\n", fs.IP, fs.WebdavPort, fs.Webroot)
 		}
+	case modeMetrics:
+		logger.Infof("Serving metrics via %s on %+v:%+v%s\n", protocol, fs.IP, fs.MetricsPort, metricsPath)
 	default:
 	}
 }
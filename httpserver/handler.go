@@ -17,9 +17,12 @@ import (
 	"strings"
 	"time"
 
+	"goshs.de/goshs/v2/acl"
+	"goshs.de/goshs/v2/apitoken"
 	"goshs.de/goshs/v2/catcher"
 	"goshs.de/goshs/v2/logger"
 	"goshs.de/goshs/v2/smtpattach"
+	"goshs.de/goshs/v2/users"
 	"goshs.de/goshs/v2/utils"
 	"goshs.de/goshs/v2/ws"
 )
@@ -79,7 +82,7 @@ func (fs *FileServer) doDir(file *os.File, w http.ResponseWriter, req *http.Requ
 	// Get foldername
 	_, foldername := filepath.Split(file.Name())
 
-	if slices.Contains(parentConfig.Block, fmt.Sprintf("%s/", foldername)) {
+	if parentConfig.Blocked(foldername, true) {
 		fs.handleError(w, req, fmt.Errorf("open %s: no such file or directory", file.Name()), 404)
 		return
 	}
@@ -149,40 +152,93 @@ func (fs *FileServer) checkCSRF(w http.ResponseWriter, req *http.Request) bool {
 
 func (fs *FileServer) earlyBreakParameters(w http.ResponseWriter, req *http.Request) bool {
 	if _, ok := req.URL.Query()["smtp"]; ok {
-		if denyForTokenAccess(w, req) {
+		if denyForTokenAccess(w, req) || fs.denyNonAdmin(w, req) {
 			return true
 		}
 		fs.handleSMTPAttachment(w, req)
 		return true
 	}
 	if _, ok := req.URL.Query()["goshs-info"]; ok {
-		if denyForTokenAccess(w, req) {
+		if denyForTokenAccess(w, req) || fs.denyNonAdmin(w, req) {
 			return true
 		}
 		fs.handleInfo(w)
 		return true
 	}
 	if _, ok := req.URL.Query()["ws"]; ok {
-		if denyForTokenAccess(w, req) {
+		if denyForTokenAccess(w, req) || fs.denyNonAdmin(w, req) {
 			return true
 		}
 		fs.socket(w, req)
 		return true
 	}
 	if _, ok := req.URL.Query()["catcher-ws"]; ok {
-		if denyForTokenAccess(w, req) {
+		if denyForTokenAccess(w, req) || fs.denyNonAdmin(w, req, apitoken.ScopeCatcher) {
 			return true
 		}
 		catcher.ServeCatcherWS(fs.CatcherMgr, w, req)
 		return true
 	}
 	if apiAction, ok := req.URL.Query()["catcher-api"]; ok {
-		if denyForTokenAccess(w, req) {
+		if denyForTokenAccess(w, req) || fs.denyNonAdmin(w, req, apitoken.ScopeCatcher) {
 			return true
 		}
 		fs.handleCatcherAPI(w, req, apiAction[0])
 		return true
 	}
+	if apiAction, ok := req.URL.Query()["crack-api"]; ok {
+		if denyForTokenAccess(w, req) || fs.denyNonAdmin(w, req) {
+			return true
+		}
+		fs.handleCrackAPI(w, req, apiAction[0])
+		return true
+	}
+	if apiAction, ok := req.URL.Query()["mail-api"]; ok {
+		if denyForTokenAccess(w, req) || fs.denyNonAdmin(w, req) {
+			return true
+		}
+		fs.handleMailAPI(w, req, apiAction[0])
+		return true
+	}
+	if apiAction, ok := req.URL.Query()["token-api"]; ok {
+		if denyForTokenAccess(w, req) || fs.denyNonAdmin(w, req) {
+			return true
+		}
+		fs.handleTokenAPI(w, req, apiAction[0])
+		return true
+	}
+	if apiAction, ok := req.URL.Query()["ca-api"]; ok {
+		if denyForTokenAccess(w, req) || fs.denyNonAdmin(w, req) {
+			return true
+		}
+		fs.handleCAAPI(w, req, apiAction[0])
+		return true
+	}
+	if apiAction, ok := req.URL.Query()["services-api"]; ok {
+		if denyForTokenAccess(w, req) || fs.denyNonAdmin(w, req) {
+			return true
+		}
+		fs.handleServicesAPI(w, req, apiAction[0])
+		return true
+	}
+	if apiAction, ok := req.URL.Query()["share-api"]; ok {
+		if denyForTokenAccess(w, req) {
+			return true
+		}
+		if !fs.Invisible {
+			fs.handleShareAPI(w, req, apiAction[0])
+		} else {
+			fs.handleInvisible(w)
+		}
+		return true
+	}
+	if apiAction, ok := req.URL.Query()["events-api"]; ok {
+		if denyForTokenAccess(w, req) || fs.denyNonAdmin(w, req, apitoken.ScopeEvents) {
+			return true
+		}
+		fs.handleEventsAPI(w, req, apiAction[0])
+		return true
+	}
 	if _, ok := req.URL.Query()["cbDown"]; ok {
 		if denyForTokenAccess(w, req) {
 			return true
@@ -221,14 +277,14 @@ func (fs *FileServer) earlyBreakParameters(w http.ResponseWriter, req *http.Requ
 		if err := fs.embedded(w, req); err != nil {
 			if !fs.Invisible {
 				body := fs.emitCollabEvent(req, http.StatusNotFound)
-				logger.LogRequest(req, http.StatusNotFound, fs.Verbose, fs.Webhook, body)
+				logger.LogRequest(req, http.StatusNotFound, fs.verbose(), fs.Webhook, body)
 			} else {
 				fs.handleInvisible(w)
 			}
 			return true
 		}
 		body := fs.emitCollabEvent(req, http.StatusOK)
-		logger.LogRequest(req, http.StatusOK, fs.Verbose, fs.Webhook, body)
+		logger.LogRequest(req, http.StatusOK, fs.verbose(), fs.Webhook, body)
 		return true
 	}
 	if _, ok := req.URL.Query()["share"]; ok {
@@ -245,6 +301,20 @@ func (fs *FileServer) earlyBreakParameters(w http.ResponseWriter, req *http.Requ
 		}
 		return true
 	}
+	if _, ok := req.URL.Query()["upload-request"]; ok {
+		if denyForTokenAccess(w, req) {
+			return true
+		}
+		if !fs.checkCSRF(w, req) {
+			return true
+		}
+		if !fs.Invisible {
+			fs.CreateUploadRequestHandler(w, req)
+		} else {
+			fs.handleInvisible(w)
+		}
+		return true
+	}
 	if _, ok := req.URL.Query()["redirect"]; ok {
 		if denyForTokenAccess(w, req) {
 			return true
@@ -283,6 +353,11 @@ func (fs *FileServer) handler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Serve the PAC file for WPAD clients
+	if fs.servePAC(w, req) {
+		return
+	}
+
 	// Define if to return json instead of html parsing
 	json := false
 	if _, ok := req.URL.Query()["json"]; ok {
@@ -294,13 +369,14 @@ func (fs *FileServer) handler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	open, err := sanitizePath(fs.Webroot, req.URL.Path)
+	root := fs.root(req)
+	open, err := sanitizePath(root, req.URL.Path)
 	if err != nil {
 		fs.handleError(w, req, err, http.StatusBadRequest)
 		return
 	}
 	// Relative path used by templates
-	upath := strings.TrimPrefix(open, filepath.Clean(fs.Webroot))
+	upath := strings.TrimPrefix(open, filepath.Clean(root))
 	if upath == "" {
 		upath = "/"
 	}
@@ -335,10 +411,10 @@ func (fs *FileServer) handler(w http.ResponseWriter, req *http.Request) {
 	if !stat.IsDir() {
 		targetDir = filepath.Dir(open)
 	}
-	acl, _ := fs.findEffectiveACL(targetDir)
-	if acl.Auth == "" {
+	config, _ := fs.findEffectiveACL(targetDir)
+	if !config.RequiresAuth() {
 		body := fs.emitCollabEvent(req, http.StatusOK)
-		logger.LogRequest(req, http.StatusOK, fs.Verbose, fs.Webhook, body)
+		logger.LogRequest(req, http.StatusOK, fs.verbose(), fs.Webhook, body)
 	}
 
 	if stat.IsDir() {
@@ -349,8 +425,8 @@ func (fs *FileServer) handler(w http.ResponseWriter, req *http.Request) {
 }
 
 // Applies custom auth for file based acls
-func (fileS *FileServer) applyCustomAuth(w http.ResponseWriter, req *http.Request, acl configFile) bool {
-	if acl.Auth != "" {
+func (fileS *FileServer) applyCustomAuth(w http.ResponseWriter, req *http.Request, config configFile) bool {
+	if config.RequiresAuth() {
 		if !fileS.Invisible {
 			w.Header().Set("WWW-Authenticate", `Basic realm="Filebased Restricted"`)
 		}
@@ -361,13 +437,12 @@ func (fileS *FileServer) applyCustomAuth(w http.ResponseWriter, req *http.Reques
 			return false
 		}
 
-		user, passwordHash, ok := strings.Cut(acl.Auth, ":")
-		if !ok {
+		if config.Auth != "" && !strings.Contains(config.Auth, ":") {
 			fileS.handleError(w, req, fmt.Errorf("%s", "invalid auth format in config file"), http.StatusInternalServerError)
 			return false
 		}
 
-		if username != user || !checkPasswordHash(password, passwordHash) {
+		if !config.Authenticate(username, password) {
 			fileS.handleError(w, req, fmt.Errorf("%s", "not authorized"), http.StatusUnauthorized)
 			return false
 		}
@@ -439,7 +514,7 @@ func (fileS *FileServer) constructSilent(w http.ResponseWriter) {
 	}
 }
 
-func (fileS *FileServer) constructDefault(w http.ResponseWriter, relpath string, items []item, embeddedItems []item) {
+func (fileS *FileServer) constructDefault(w http.ResponseWriter, req *http.Request, relpath string, items []item, embeddedItems []item) {
 	var subdirectory bool
 	// Windows upload compatibility
 	if relpath == "\\" {
@@ -472,7 +547,7 @@ func (fileS *FileServer) constructDefault(w http.ResponseWriter, relpath string,
 			LastModRaw: item.SortLastModified,
 			Extension:  item.Ext,
 			QRCode:     qrcode,
-			Auth:       fileS.Pass != "" || fileS.CACert != "",
+			Auth:       fileS.authEnabled(),
 		})
 	}
 
@@ -489,7 +564,7 @@ func (fileS *FileServer) constructDefault(w http.ResponseWriter, relpath string,
 			LastModRaw: item.SortLastModified,
 			Extension:  item.Ext,
 			QRCode:     qrcode,
-			Auth:       fileS.Pass != "" || fileS.CACert != "",
+			Auth:       fileS.authEnabled(),
 		})
 	}
 
@@ -519,25 +594,27 @@ func (fileS *FileServer) constructDefault(w http.ResponseWriter, relpath string,
 	}
 
 	qrcodeRoot := GenerateQRCode(fmt.Sprintf("%s://%s:%d", proto, ip, port))
+	admin := fileS.account(req).IsAdmin()
 	uiData := UIData{
 		GoshsVersion:    fileS.Version,
-		AbsPath:         fileS.Webroot,
+		AbsPath:         fileS.root(req),
 		QRCode:          qrcodeRoot,
 		BreadcrumbParts: breadcrumbParts,
 		Subdirectory:    subdirectory,
-		ReadOnly:        fileS.ReadOnly,
-		UploadOnly:      fileS.UploadOnly,
+		ReadOnly:        fileS.readOnly(req),
+		UploadOnly:      fileS.uploadOnly(req),
 		NoClipboard:     fileS.NoClipboard,
-		NoDelete:        fileS.NoDelete,
-		CLI:             fileS.CLI,
+		NoDelete:        fileS.noDelete(req),
+		CLI:             fileS.CLI && admin,
 		Embedded:        fileS.Embedded,
-		Catcher:         fileS.Options != nil && fileS.Options.Catcher,
+		Catcher:         fileS.Options != nil && fileS.Options.Catcher && admin,
+		Services:        fileS.Services != nil && admin,
 		Items:           fileItems,
 		EmbeddedItems:   embeddedFiles,
 		Clipboard:       clipEntries,
-		SharedLinks:     fileS.snapshotSharedLinks(),
+		SharedLinks:     fileS.visibleSharedLinks(req),
 		CSRFToken:       fileS.CSRFToken,
-		MaxUpload:       fileS.MaxUpload,
+		MaxUpload:       fileS.maxUpload(),
 	}
 
 	err := renderIndex(w, uiData)
@@ -546,7 +623,7 @@ func (fileS *FileServer) constructDefault(w http.ResponseWriter, relpath string,
 	}
 }
 
-func (fileS *FileServer) constructItems(fis []fs.FileInfo, relpath string, acl configFile, r *http.Request) []item {
+func (fileS *FileServer) constructItems(fis []fs.FileInfo, relpath string, config configFile, r *http.Request) []item {
 	var err error
 	// Create empty slice
 	items := make([]item, 0, len(fis))
@@ -576,7 +653,7 @@ func (fileS *FileServer) constructItems(fis []fs.FileInfo, relpath string, acl c
 		}
 		url := fmt.Sprintf("%s://%s/%s", scheme, r.Host, strings.TrimPrefix(item.URI, "%2F"))
 		item.QRCode = template.URL(GenerateQRCode(url))
-		if fileS.Pass != "" || fileS.CACert != "" {
+		if fileS.authEnabled() {
 			item.AuthEnabled = true
 		} else {
 			item.AuthEnabled = false
@@ -585,12 +662,12 @@ func (fileS *FileServer) constructItems(fis []fs.FileInfo, relpath string, acl c
 		item.SortSize = fi.Size()
 		item.DisplayLastModified = fi.ModTime().Format("Mon Jan _2 15:04:05 2006")
 		item.SortLastModified = fi.ModTime().UTC().UnixMilli()
-		item.ReadOnly = fileS.ReadOnly
-		item.NoDelete = fileS.NoDelete
+		item.ReadOnly = fileS.readOnly(r)
+		item.NoDelete = fileS.noDelete(r)
 		// Check and resolve symlink
 		if fi.Mode()&os.ModeSymlink != 0 {
 			item.IsSymlink = true
-			item.SymlinkTarget, err = os.Readlink(filepath.Join(fileS.Webroot, relpath, fi.Name()))
+			item.SymlinkTarget, err = os.Readlink(filepath.Join(fileS.root(r), relpath, fi.Name()))
 			if err != nil {
 				logger.Errorf("resolving symlink: %+v", err)
 			}
@@ -600,11 +677,9 @@ func (fileS *FileServer) constructItems(fis []fs.FileInfo, relpath string, acl c
 	}
 
 	// Remove 'block' files from items
-	if len(acl.Block) > 0 {
-		for _, i := range acl.Block {
-			items = removeItem(items, i)
-		}
-	}
+	items = slices.DeleteFunc(items, func(i item) bool {
+		return config.Blocked(i.Name, i.IsDir)
+	})
 
 	// Sort slice all lowercase
 	sort.Slice(items, func(i, j int) bool {
@@ -615,7 +690,7 @@ func (fileS *FileServer) constructItems(fis []fs.FileInfo, relpath string, acl c
 
 }
 
-func (fileS *FileServer) processDir(w http.ResponseWriter, req *http.Request, file *os.File, relpath string, jsonOutput bool, acl configFile) {
+func (fileS *FileServer) processDir(w http.ResponseWriter, req *http.Request, file *os.File, relpath string, jsonOutput bool, config configFile) {
 	// Early break for invisible mode
 	if fileS.Invisible {
 		fileS.handleInvisible(w)
@@ -632,13 +707,16 @@ func (fileS *FileServer) processDir(w http.ResponseWriter, req *http.Request, fi
 	relpath = strings.TrimLeft(relpath, "\\")
 
 	// Apply Custom Auth if there is any due to file based acl
-	if ok := fileS.applyCustomAuth(w, req, acl); !ok {
+	if ok := fileS.applyCustomAuth(w, req, config); !ok {
 		fileS.handleError(w, req, fmt.Errorf("unauthorized"), http.StatusUnauthorized)
 		return
 	}
+	if !fileS.applyACLRules(w, req, config, acl.List, file.Name(), true) {
+		return
+	}
 
 	// Construct items list
-	items := fileS.constructItems(fis, relpath, acl, req)
+	items := fileS.constructItems(fis, relpath, config, req)
 
 	// Handle embedded files
 	embeddedItems := fileS.constructEmbedded()
@@ -656,38 +734,19 @@ func (fileS *FileServer) processDir(w http.ResponseWriter, req *http.Request, fi
 	if fileS.Silent {
 		fileS.constructSilent(w)
 	} else {
-		fileS.constructDefault(w, relpath, items, embeddedItems)
+		fileS.constructDefault(w, req, relpath, items, embeddedItems)
 	}
 }
 
-func (fs *FileServer) sendFile(w http.ResponseWriter, req *http.Request, file *os.File, acl configFile) {
-	if fs.UploadOnly {
+func (fs *FileServer) sendFile(w http.ResponseWriter, req *http.Request, file *os.File, config configFile) {
+	if fs.uploadOnly(req) {
 		fs.handleError(w, req, fmt.Errorf("%s", "Download not allowed due to 'upload only' option"), http.StatusForbidden)
 		return
 	}
 
 	// Apply Custom Auth if there
-	if acl.Auth != "" {
-		if !fs.Invisible {
-			w.Header().Set("WWW-Authenticate", `Basic realm="Filebased Restricted"`)
-		}
-
-		username, password, authOK := req.BasicAuth()
-		if !authOK {
-			fs.handleError(w, req, fmt.Errorf("%s", "not authorized"), http.StatusUnauthorized)
-			return
-		}
-
-		user, passwordHash, ok := strings.Cut(acl.Auth, ":")
-		if !ok {
-			fs.handleError(w, req, fmt.Errorf("%s", "invalid auth format in config file"), http.StatusInternalServerError)
-			return
-		}
-
-		if username != user || !checkPasswordHash(password, passwordHash) {
-			fs.handleError(w, req, fmt.Errorf("%s", "not authorized"), http.StatusUnauthorized)
-			return
-		}
+	if !fs.applyCustomAuth(w, req, config) {
+		return
 	}
 
 	// Never serve .goshs file and return same error message if it was not there
@@ -700,10 +759,13 @@ func (fs *FileServer) sendFile(w http.ResponseWriter, req *http.Request, file *o
 	}
 
 	// Check if file is in block list and discard
-	if slices.Contains(acl.Block, filename) {
+	if config.Blocked(filename, false) {
 		fs.handleError(w, req, fmt.Errorf("open %s: no such file or directory", file.Name()), 404)
 		return
 	}
+	if !fs.applyACLRules(w, req, config, acl.Read, file.Name(), false) {
+		return
+	}
 
 	// Extract download parameter
 	download := req.URL.Query()
@@ -722,7 +784,8 @@ func (fs *FileServer) sendFile(w http.ResponseWriter, req *http.Request, file *o
 		}
 
 		// Send webhook message
-		logger.HandleWebhookSend(fmt.Sprintf("[WEB] File downloaded: %s", filepath.Join(fs.Webroot, req.URL.Path)), "download", fs.Webhook)
+		fpath := filepath.Join(fs.root(req), req.URL.Path)
+		fs.notify(req, "download", fpath, fmt.Sprintf("[WEB] File downloaded: %s%s", fpath, byToken(req)))
 
 	} else {
 		// Write to browser
@@ -736,7 +799,8 @@ func (fs *FileServer) sendFile(w http.ResponseWriter, req *http.Request, file *o
 		}
 
 		// Send webhook message
-		logger.HandleWebhookSend(fmt.Sprintf("[WEB] File viewed: %s", filepath.Join(fs.Webroot, req.URL.Path)), "view", fs.Webhook)
+		fpath := filepath.Join(fs.root(req), req.URL.Path)
+		fs.notify(req, "view", fpath, fmt.Sprintf("[WEB] File viewed: %s%s", fpath, byToken(req)))
 	}
 }
 
@@ -751,11 +815,11 @@ func (fs *FileServer) socket(w http.ResponseWriter, req *http.Request) {
 
 // deleteFile will delete a file
 func (fs *FileServer) deleteFile(w http.ResponseWriter, req *http.Request) {
-	deletePath, err := sanitizePath(fs.Webroot, req.URL.Path)
+	deletePath, err := sanitizePath(fs.root(req), req.URL.Path)
 	if err != nil {
 		http.Error(w, "Cannot delete file", http.StatusBadRequest)
 		body := fs.emitCollabEvent(req, http.StatusBadRequest)
-		logger.LogRequest(req, http.StatusBadRequest, fs.Verbose, fs.Webhook, body)
+		logger.LogRequest(req, http.StatusBadRequest, fs.verbose(), fs.Webhook, body)
 		return
 	}
 
@@ -767,11 +831,20 @@ func (fs *FileServer) deleteFile(w http.ResponseWriter, req *http.Request) {
 
 	// Enforce .goshs ACL (recursive: walks up to webroot)
 	aclDir := filepath.Dir(deletePath)
-	acl, aclErr := fs.findEffectiveACL(aclDir)
+	config, aclErr := fs.findEffectiveACL(aclDir)
 	if aclErr != nil {
 		logger.Errorf("error reading file based access config: %+v", aclErr)
 	}
-	if ok := fs.applyCustomAuth(w, req, acl); !ok {
+	if ok := fs.applyCustomAuth(w, req, config); !ok {
+		return
+	}
+	stat, err := os.Lstat(deletePath)
+	isDir := err == nil && stat.IsDir()
+	if config.Blocked(filepath.Base(deletePath), isDir) {
+		fs.handleError(w, req, fmt.Errorf("open %s: no such file or directory", deletePath), http.StatusNotFound)
+		return
+	}
+	if !fs.applyACLRules(w, req, config, acl.Delete, deletePath, isDir) {
 		return
 	}
 
@@ -781,10 +854,10 @@ func (fs *FileServer) deleteFile(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// Send webhook message
-	logger.HandleWebhookSend(fmt.Sprintf("[WEB] File deleted: %s", deletePath), "delete", fs.Webhook)
+	fs.notify(req, "delete", deletePath, fmt.Sprintf("[WEB] File deleted: %s%s", deletePath, byToken(req)))
 
 	body := fs.emitCollabEvent(req, http.StatusResetContent)
-	logger.LogRequest(req, http.StatusResetContent, fs.Verbose, fs.Webhook, body)
+	logger.LogRequest(req, http.StatusResetContent, fs.verbose(), fs.Webhook, body)
 }
 
 // handleRedirect issues an HTTP redirect to the URL given in the ?url= query
@@ -825,7 +898,7 @@ func (fs *FileServer) handleRedirect(w http.ResponseWriter, req *http.Request) {
 
 	logger.HandleWebhookSend(fmt.Sprintf("[WEB] Redirect followed: %s → %s", req.RemoteAddr, target), "redirect", fs.Webhook)
 	body := fs.emitCollabEvent(req, status)
-	logger.LogRequest(req, status, fs.Verbose, fs.Webhook, body)
+	logger.LogRequest(req, status, fs.verbose(), fs.Webhook, body)
 }
 
 func (fs *FileServer) CreateShareHandler(w http.ResponseWriter, r *http.Request) {
@@ -835,21 +908,30 @@ func (fs *FileServer) CreateShareHandler(w http.ResponseWriter, r *http.Request)
 	var stat os.FileInfo
 
 	// If Auth is not used there is no sharing
-	if fs.Pass == "" && fs.CACert == "" {
+	if !fs.authEnabled() {
 		body := fs.emitCollabEvent(r, 403)
-		logger.LogRequest(r, 403, fs.Verbose, fs.Webhook, body)
+		logger.LogRequest(r, 403, fs.verbose(), fs.Webhook, body)
 		http.Error(w, "Sharing disabled when auth is disabled", http.StatusForbidden)
 		return
 	}
 
-	fpath, err := sanitizePath(fs.Webroot, r.URL.Path)
+	// Sharing hands out downloads, so the account has to be allowed to read
+	if fs.uploadOnly(r) {
+		body := fs.emitCollabEvent(r, http.StatusForbidden)
+		logger.LogRequest(r, http.StatusForbidden, fs.verbose(), fs.Webhook, body)
+		http.Error(w, "Sharing not allowed due to 'upload only' option", http.StatusForbidden)
+		return
+	}
+
+	root := fs.root(r)
+	fpath, err := sanitizePath(root, r.URL.Path)
 	if err != nil {
 		body := fs.emitCollabEvent(r, http.StatusBadRequest)
-		logger.LogRequest(r, http.StatusBadRequest, fs.Verbose, fs.Webhook, body)
+		logger.LogRequest(r, http.StatusBadRequest, fs.verbose(), fs.Webhook, body)
 		http.Error(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
-	upath := strings.TrimPrefix(fpath, filepath.Clean(fs.Webroot))
+	upath := strings.TrimPrefix(fpath, filepath.Clean(root))
 	if upath == "" {
 		upath = "/"
 	}
@@ -866,7 +948,7 @@ func (fs *FileServer) CreateShareHandler(w http.ResponseWriter, r *http.Request)
 		seconds, err := strconv.Atoi(r.URL.Query()["expires"][0])
 		if err != nil {
 			body := fs.emitCollabEvent(r, 400)
-			logger.LogRequest(r, 400, fs.Verbose, fs.Webhook, body)
+			logger.LogRequest(r, 400, fs.verbose(), fs.Webhook, body)
 			http.Error(w, "expires needs to be integer in seconds", http.StatusBadRequest)
 		}
 		expires = now.Add(time.Duration(seconds) * time.Second)
@@ -880,12 +962,18 @@ func (fs *FileServer) CreateShareHandler(w http.ResponseWriter, r *http.Request)
 		limit, err := strconv.Atoi(r.URL.Query()["limit"][0])
 		if err != nil {
 			body := fs.emitCollabEvent(r, 400)
-			logger.LogRequest(r, 400, fs.Verbose, fs.Webhook, body)
+			logger.LogRequest(r, 400, fs.verbose(), fs.Webhook, body)
 			http.Error(w, "limit needs to be integer", http.StatusBadRequest)
 		}
 		downloadLimit = limit
 	}
 
+	// Optional password and allowed networks
+	passwordHash, cidr, ok := fs.shareRestrictions(w, r)
+	if !ok {
+		return
+	}
+
 	// Get stat for file
 	stat, err = os.Stat(fpath)
 	if err != nil {
@@ -895,59 +983,31 @@ func (fs *FileServer) CreateShareHandler(w http.ResponseWriter, r *http.Request)
 
 	// Fetch token
 	token := GenerateToken()
-
-	interfaceAdresses := make(map[string]string)
-	// Return share URL
-	if fs.IP == "0.0.0.0" {
-		interfaceAdresses, err = utils.GetAllIPAddresses()
-		if err != nil {
-			logger.Errorf("There has been an error fetching the interface addresses: %+v\n", err)
-		}
-	} else {
-		interfaceAdresses["0"] = "0.0.0.0"
-	}
-
-	protocol := "http://"
-	if fs.SSL {
-		protocol = "https://"
-	}
-
-	for _, ip := range interfaceAdresses {
-		if fs.Port != 80 && fs.Port != 443 {
-			url := fmt.Sprintf("%s%s:%d%s?token=%s", protocol, ip, fs.Port, upath, token)
-			shareURLs = append(shareURLs, url)
-			downloadEntry := DownloadEntry{
-				DownloadURL: url,
-				QRCode:      template.URL(GenerateQRCode(url)),
-			}
-			downloadEntries = append(downloadEntries, downloadEntry)
-		} else {
-			url := fmt.Sprintf("%s%s%s?token=%s", protocol, ip, upath, token)
-			shareURLs = append(shareURLs, url)
-			downloadEntry := DownloadEntry{
-				DownloadURL: url,
-				QRCode:      template.URL(GenerateQRCode(url)),
-			}
-			downloadEntries = append(downloadEntries, downloadEntry)
-		}
-	}
+	shareURLs, downloadEntries = fs.shareURLs(upath, token)
 
 	sl := SharedLink{
 		FilePath:        upath,
 		DownloadEntries: downloadEntries,
 		IsDir:           stat.IsDir(),
+		Created:         now.UTC().Truncate(time.Second),
 		Expires:         expires,
 		Downloaded:      0,
 		DownloadLimit:   downloadLimit,
+		PasswordHash:    passwordHash,
+		CIDR:            cidr,
+	}
+	if a := namedAccount(r); a != nil {
+		sl.Owner = a.Name
 	}
 
 	// Add to map
 	fs.sharedLinksMu.Lock()
 	fs.SharedLinks[token] = sl
+	fs.saveSharedLinksLocked()
 	fs.sharedLinksMu.Unlock()
 
 	body := fs.emitCollabEvent(r, http.StatusOK)
-	logger.LogRequest(r, http.StatusOK, fs.Verbose, fs.Webhook, body)
+	logger.LogRequest(r, http.StatusOK, fs.verbose(), fs.Webhook, body)
 	logger.Debugf("A file was shared: %s", shareURLs[0])
 
 	response := map[string][]string{
@@ -981,6 +1041,24 @@ func (fs *FileServer) ShareHandler(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	if !fs.shareAccess(w, r, entry) {
+		return
+	}
+	if entry.Upload {
+		fs.renderUploadRequest(w, token, entry)
+		return
+	}
+	download := fs.shareDownloadOf(r)
+
+	// Serve the link from the home directory of the account that created it
+	if entry.Owner != "" && fs.Users != nil {
+		owner := fs.Users.Lookup(entry.Owner)
+		if owner == nil {
+			http.NotFound(w, r)
+			return
+		}
+		r = r.WithContext(users.NewContext(r.Context(), owner))
+	}
 
 	// Only send if download limit not reached
 	if entry.DownloadLimit > 0 || entry.DownloadLimit == -1 {
@@ -991,7 +1069,7 @@ func (fs *FileServer) ShareHandler(w http.ResponseWriter, r *http.Request) {
 			r.URL.RawQuery = q.Encode()
 			fs.bulkDownload(w, r)
 		} else {
-			file, err := os.Open(filepath.Join(fs.Webroot, entry.FilePath))
+			file, err := os.Open(filepath.Join(fs.root(r), entry.FilePath))
 			if err != nil {
 				logger.Errorf("error opening shared file: %s", entry.FilePath)
 				fs.handleError(w, r, err, http.StatusInternalServerError)
@@ -1008,11 +1086,16 @@ func (fs *FileServer) ShareHandler(w http.ResponseWriter, r *http.Request) {
 	fs.sharedLinksMu.Lock()
 	if current, exists := fs.SharedLinks[token]; exists {
 		current.Downloaded++
+		current.Downloads = append(current.Downloads, download)
+		if len(current.Downloads) > shareMaxDownloads {
+			current.Downloads = current.Downloads[len(current.Downloads)-shareMaxDownloads:]
+		}
 		if current.DownloadLimit != -1 && current.Downloaded >= current.DownloadLimit {
 			delete(fs.SharedLinks, token)
 		} else {
 			fs.SharedLinks[token] = current
 		}
+		fs.saveSharedLinksLocked()
 	}
 	fs.sharedLinksMu.Unlock()
 }
@@ -1027,6 +1110,25 @@ func (fs *FileServer) snapshotSharedLinks() map[string]SharedLink {
 	return snapshot
 }
 
+// visibleSharedLinks returns the shared links shown to the request: all of
+// them for admins, otherwise only those created by its account.
+func (fs *FileServer) visibleSharedLinks(req *http.Request) map[string]SharedLink {
+	links := fs.snapshotSharedLinks()
+	if fs.account(req).IsAdmin() {
+		return links
+	}
+	maps.DeleteFunc(links, func(_ string, link SharedLink) bool {
+		return !fs.ownsLink(req, link)
+	})
+	return links
+}
+
+// ownsLink reports whether the request may manage link.
+func (fs *FileServer) ownsLink(req *http.Request, link SharedLink) bool {
+	a := fs.account(req)
+	return a.IsAdmin() || (a != nil && link.Owner == a.Name)
+}
+
 func (fs *FileServer) sharedLinksCount() int {
 	fs.sharedLinksMu.RLock()
 	n := len(fs.SharedLinks)
@@ -1042,11 +1144,17 @@ func (fs *FileServer) DeleteShareHandler(w http.ResponseWriter, r *http.Request)
 
 	token := r.URL.Query().Get("token")
 	fs.sharedLinksMu.Lock()
+	if link, ok := fs.SharedLinks[token]; ok && !fs.ownsLink(r, link) {
+		fs.sharedLinksMu.Unlock()
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 	delete(fs.SharedLinks, token)
+	fs.saveSharedLinksLocked()
 	fs.sharedLinksMu.Unlock()
 
 	fs.emitCollabEvent(r, http.StatusNoContent)
-	logger.LogRequest(r, http.StatusNoContent, fs.Verbose, fs.Webhook, nil)
+	logger.LogRequest(r, http.StatusNoContent, fs.verbose(), fs.Webhook, nil)
 
 	w.WriteHeader(204)
 	_, err := w.Write([]byte("shared link deleted successfully"))
@@ -1058,13 +1166,13 @@ func (fs *FileServer) DeleteShareHandler(w http.ResponseWriter, r *http.Request)
 func (fs *FileServer) handleMkdir(w http.ResponseWriter, r *http.Request) {
 	if !fs.Invisible {
 		// if not read only or upload only create directory from mkdir query param
-		if fs.ReadOnly || fs.UploadOnly {
+		if fs.readOnly(r) || fs.uploadOnly(r) {
 			http.Error(w, "read only or upload only mode", http.StatusForbidden)
 			return
 		}
 
 		// Get and sanitize path
-		finalPath, err := sanitizePath(fs.Webroot, r.URL.Path)
+		finalPath, err := sanitizePath(fs.root(r), r.URL.Path)
 		if err != nil {
 			http.Error(w, "Invalid path", http.StatusBadRequest)
 			return
@@ -1072,11 +1180,14 @@ func (fs *FileServer) handleMkdir(w http.ResponseWriter, r *http.Request) {
 
 		// Enforce .goshs ACL (recursive: walks up to webroot)
 		parentDir := filepath.Dir(finalPath)
-		acl, aclErr := fs.findEffectiveACL(parentDir)
+		config, aclErr := fs.findEffectiveACL(parentDir)
 		if aclErr != nil {
 			logger.Errorf("error reading file based access config: %+v", aclErr)
 		}
-		if ok := fs.applyCustomAuth(w, r, acl); !ok {
+		if ok := fs.applyCustomAuth(w, r, config); !ok {
+			return
+		}
+		if !fs.applyACLRules(w, r, config, acl.Mkdir, finalPath, true) {
 			return
 		}
 
@@ -1084,13 +1195,13 @@ func (fs *FileServer) handleMkdir(w http.ResponseWriter, r *http.Request) {
 		err = os.MkdirAll(finalPath, 0755)
 		if err != nil {
 			body := fs.emitCollabEvent(r, http.StatusInternalServerError)
-			logger.LogRequest(r, http.StatusInternalServerError, fs.Verbose, fs.Webhook, body)
+			logger.LogRequest(r, http.StatusInternalServerError, fs.verbose(), fs.Webhook, body)
 			logger.Errorf("Error creating directory %s: %+v", finalPath, err)
 			return
 		}
 
 		body := fs.emitCollabEvent(r, http.StatusCreated)
-		logger.LogRequest(r, http.StatusCreated, fs.Verbose, fs.Webhook, body)
+		logger.LogRequest(r, http.StatusCreated, fs.verbose(), fs.Webhook, body)
 		// Send success response
 		w.WriteHeader(http.StatusCreated)
 		_, err = w.Write([]byte("directory created successfully"))
@@ -1107,7 +1218,7 @@ func (fs *FileServer) handleSMTPAttachment(w http.ResponseWriter, r *http.Reques
 	id := r.URL.Query().Get("id")
 	if id == "" {
 		body := fs.emitCollabEvent(r, http.StatusNotFound)
-		logger.LogRequest(r, http.StatusNotFound, fs.Verbose, fs.Webhook, body)
+		logger.LogRequest(r, http.StatusNotFound, fs.verbose(), fs.Webhook, body)
 		http.NotFound(w, r)
 		return
 	}
@@ -1133,6 +1244,9 @@ func (fs *FileServer) handleCatcherAPI(w http.ResponseWriter, req *http.Request,
 	switch action {
 	case "list":
 		listeners := fs.CatcherMgr.GetListeners()
+		for i := range listeners {
+			listeners[i].Public = fs.tunnelEndpoint("catcher-" + listeners[i].ID)
+		}
 		json.NewEncoder(w).Encode(listeners)
 
 	case "start":
@@ -1159,6 +1273,7 @@ func (fs *FileServer) handleCatcherAPI(w http.ResponseWriter, req *http.Request,
 			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
 			return
 		}
+		info.Public = fs.tunnelEndpoint("catcher-" + info.ID)
 		json.NewEncoder(w).Encode(info)
 
 	case "stop":
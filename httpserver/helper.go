@@ -74,6 +74,12 @@ func (files *FileServer) AddCertAuth(server *http.Server) {
 
 	server.TLSConfig.ClientCAs = caCertPool
 	server.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	if files.Revocations != nil {
+		server.TLSConfig.VerifyPeerCertificate = files.verifyClientCert
+	}
+	if files.CertMap != nil {
+		logger.Infof("Mapping client certificates to users with %d entries", files.CertMap.Len())
+	}
 }
 
 func GenerateToken() string {
@@ -4,12 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"goshs.de/goshs/v2/logger"
 )
 
 func (fs *FileServer) handleInfo(w http.ResponseWriter) {
 	if !fs.Invisible && !fs.Silent {
+		fs.settingsMu.RLock()
+		uploadOnly, readOnly, noDelete, verbose := fs.UploadOnly, fs.ReadOnly, fs.NoDelete, fs.Verbose
+		fs.settingsMu.RUnlock()
+
 		// Return server info as json blob
 		info := map[string]string{
 			"version":           fs.Version,
@@ -19,25 +24,39 @@ func (fs *FileServer) handleInfo(w http.ResponseWriter) {
 			"fingerprint256":    fs.Fingerprint256,
 			"fingerprint1":      fs.Fingerprint1,
 			"tunnel":            fmt.Sprintf("%t", fs.Tunnel),
-			"tunnel-url":        fs.TunnelURL,
+			"tunnel-url":        fs.PublicURL(),
+			"tunnel-endpoints":  fs.tunnelEndpointList(),
+			"tunnel-server":     fs.Options.TunnelServer,
 			"cli":               fmt.Sprintf("%t", fs.CLI),
 			"webdav-port":       fmt.Sprintf("%d", fs.WebdavPort),
 			"upload-folder":     fs.UploadFolder,
 			"self-signed":       fmt.Sprintf("%t", fs.SelfSigned),
+			"ca-dir":            fs.Options.CADir,
 			"lets-encrypt":      fmt.Sprintf("%t", fs.LetsEncrypt),
+			"le-acme-url":       fs.Options.LEDirectory,
+			"le-challenges":     fs.Options.LEChallenges,
 			"my-key":            fs.MyKey,
 			"my-cert":           fs.MyCert,
 			"my-p12":            fs.MyP12,
 			"p12-no-pass":       fmt.Sprintf("%t", fs.P12NoPass),
-			"auth":              fmt.Sprintf("%t", fs.Pass != "" || fs.CACert != ""),
+			"auth":              fmt.Sprintf("%t", fs.authEnabled()),
 			"ca-cert":           fs.CACert,
+			"ca-revoked":        fs.Options.CARevoked,
+			"ca-crl":            fs.Options.CACRL,
+			"ca-map":            fmt.Sprintf("%t", fs.CertMap != nil),
+			"users":             fmt.Sprintf("%d", fs.accountCount()),
+			"oidc-issuer":       fs.Options.OIDCIssuer,
+			"totp":              fmt.Sprintf("%t", fs.TOTP != nil),
+			"api-tokens":        fmt.Sprintf("%t", fs.Tokens != nil),
+			"metrics":           fmt.Sprintf("%t", fs.Metrics),
+			"metrics-port":      fmt.Sprintf("%d", fs.MetricsPort),
 			"process-user":      fs.DropUser,
-			"upload-only":       fmt.Sprintf("%t", fs.UploadOnly),
-			"read-only":         fmt.Sprintf("%t", fs.ReadOnly),
+			"upload-only":       fmt.Sprintf("%t", uploadOnly),
+			"read-only":         fmt.Sprintf("%t", readOnly),
 			"no-clipboard":      fmt.Sprintf("%t", fs.NoClipboard),
-			"no-delete":         fmt.Sprintf("%t", fs.NoDelete),
+			"no-delete":         fmt.Sprintf("%t", noDelete),
 			"embedded":          fmt.Sprintf("%t", fs.Embedded),
-			"verbose":           fmt.Sprintf("%t", fs.Verbose),
+			"verbose":           fmt.Sprintf("%t", verbose),
 			"webroot":           fs.Webroot,
 			"shared-links":      fmt.Sprintf("%d", fs.sharedLinksCount()),
 			"dns":               fmt.Sprintf("%t", fs.Options.DNS),
@@ -46,17 +65,31 @@ func (fs *FileServer) handleInfo(w http.ResponseWriter) {
 			"smtp":              fmt.Sprintf("%t", fs.Options.SMTP),
 			"smtp-port":         fmt.Sprintf("%d", fs.Options.SMTPPort),
 			"smtp-domain":       fs.Options.SMTPDomain,
+			"smtps-port":        fmt.Sprintf("%d", fs.Options.SMTPSPort),
+			"smtp-mail-dir":     fs.Options.SMTPMailDir,
+			"pop3":              fmt.Sprintf("%t", fs.Options.POP3),
+			"pop3-port":         fmt.Sprintf("%d", fs.Options.POP3Port),
+			"imap":              fmt.Sprintf("%t", fs.Options.IMAP),
+			"imap-port":         fmt.Sprintf("%d", fs.Options.IMAPPort),
 			"smb":               fmt.Sprintf("%t", fs.Options.SMB),
 			"smb-port":          fmt.Sprintf("%d", fs.Options.SMBPort),
 			"smb-domain":        fs.Options.SMBDomain,
 			"smb-share":         fs.Options.SMBShare,
 			"max-upload-size":   fmt.Sprintf("%d", fs.Options.MaxUploadSize),
+			"share-file":        fs.ShareFile,
 			"catcher":           fmt.Sprintf("%t", fs.CatcherMgr != nil),
 			"ldap":              fmt.Sprintf("%t", fs.Options.LDAP),
 			"ldap-port":         fmt.Sprintf("%d", fs.Options.LDAPPort),
 			"ldap-jndi-enabled": fmt.Sprintf("%t", fs.Options.LDAPJNDIEnabled),
 			"ldap-jndi-base":    fs.Options.LDAPJNDIBase,
 			"ldap-wordlist":     fs.Options.LDAPWordlist,
+			"wpad":              fmt.Sprintf("%t", fs.Options.WPAD),
+			"wpad-port":         fmt.Sprintf("%d", fs.Options.WPADPort),
+			"wpad-auth":         fs.Options.WPADAuth,
+			"relay":             fmt.Sprintf("%t", fs.Options.Relay),
+			"relay-port":        fmt.Sprintf("%d", fs.Options.RelayPort),
+			"relay-domain":      fs.Options.RelayDomain,
+			"relay-tunnels":     fs.relayTunnels(),
 		}
 
 		err := json.NewEncoder(w).Encode(info)
@@ -68,3 +101,15 @@ func (fs *FileServer) handleInfo(w http.ResponseWriter) {
 
 	fs.handleInvisible(w)
 }
+
+// relayTunnels lists the public URLs of the tunnels open on the relay.
+func (fs *FileServer) relayTunnels() string {
+	if fs.Relay == nil {
+		return ""
+	}
+	var urls []string
+	for _, t := range fs.Relay.Tunnels() {
+		urls = append(urls, t.URL)
+	}
+	return strings.Join(urls, ",")
+}
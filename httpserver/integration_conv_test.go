@@ -229,7 +229,7 @@ func TestConstructDefault_NoClipboard(t *testing.T) {
 	fs.NoClipboard = true
 
 	w := httptest.NewRecorder()
-	fs.constructDefault(w, "/", nil, nil)
+	fs.constructDefault(w, httptest.NewRequest(http.MethodGet, "/", nil), "/", nil, nil)
 	require.Equal(t, http.StatusOK, w.Code)
 
 	// The response should not contain clipboard UI elements
@@ -245,7 +245,7 @@ func TestConstructDefault_WithClipboard(t *testing.T) {
 	fs.Port = 8080
 
 	w := httptest.NewRecorder()
-	fs.constructDefault(w, "/", nil, nil)
+	fs.constructDefault(w, httptest.NewRequest(http.MethodGet, "/", nil), "/", nil, nil)
 	require.Equal(t, http.StatusOK, w.Code)
 
 	// Should contain clipboard UI elements when not disabled
@@ -6,9 +6,26 @@ import (
 	"goshs.de/goshs/v2/logger"
 )
 
+// The events of denied requests in the structured log entries.
+const (
+	eventAuthFailure = "auth_failure"
+	eventDenied      = "denied"
+)
+
+// logDenied logs a failed login or a denied request of r with its
+// structured fields. An empty user keeps the one of the request.
+func logDenied(r *http.Request, event string, status int, user string, format string, args ...any) {
+	a := logger.RequestAccess(r, status)
+	a.Event = event
+	if user != "" {
+		a.User = user
+	}
+	a.Warnf(format, args...)
+}
+
 func (fs *FileServer) logOnly(w http.ResponseWriter, req *http.Request) {
 	body := fs.emitCollabEvent(req, http.StatusOK)
-	logger.LogRequest(req, http.StatusOK, fs.Verbose, fs.Webhook, body)
+	logger.LogRequest(req, http.StatusOK, fs.verbose(), fs.Webhook, body)
 	if fs.Invisible {
 		// In invisible mode, do not respond
 		fs.handleInvisible(w)
@@ -0,0 +1,94 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/mailstore"
+	"goshs.de/goshs/v2/smtpserver"
+)
+
+func (fs *FileServer) handleMailAPI(w http.ResponseWriter, req *http.Request, action string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if fs.Mailbox == nil {
+		http.Error(w, `{"error":"mail store not enabled"}`, http.StatusNotFound)
+		return
+	}
+
+	id := req.URL.Query().Get("id")
+	mailError := func(err error) {
+		if errors.Is(err, mailstore.ErrNotFound) {
+			http.Error(w, `{"error":"message not found"}`, http.StatusNotFound)
+			return
+		}
+		logger.Errorf("mail api: %v", err)
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+	}
+
+	switch action {
+	case "list":
+		msgs, err := fs.Mailbox.List(req.URL.Query().Get("rcpt"))
+		if err != nil {
+			mailError(err)
+			return
+		}
+		json.NewEncoder(w).Encode(msgs)
+
+	case "raw":
+		raw, err := fs.Mailbox.Raw(id)
+		if err != nil {
+			mailError(err)
+			return
+		}
+		w.Header().Set("Content-Type", "message/rfc822")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.eml"`, id))
+		w.Header().Set("Content-Length", strconv.Itoa(len(raw)))
+		if _, err := w.Write(raw); err != nil {
+			logger.Error(err)
+		}
+
+	case "parsed":
+		m, err := fs.Mailbox.Get(id)
+		if err != nil {
+			mailError(err)
+			return
+		}
+		raw, err := fs.Mailbox.Raw(id)
+		if err != nil {
+			mailError(err)
+			return
+		}
+		event, err := smtpserver.ParseMessage(raw)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusUnprocessableEntity)
+			return
+		}
+		event.ID = m.ID
+		event.From = m.From
+		event.To = m.To
+		event.Timestamp = m.ReceivedAt
+		json.NewEncoder(w).Encode(event)
+
+	case "delete":
+		if req.Method != http.MethodPost && req.Method != http.MethodDelete {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		if !fs.checkCSRF(w, req) {
+			return
+		}
+		if err := fs.Mailbox.Delete(id); err != nil {
+			mailError(err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, `{"error":"unknown action"}`, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,97 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"goshs.de/goshs/v2/mailstore"
+	"goshs.de/goshs/v2/ws"
+)
+
+const testMailMessage = "From: alice@example.com\r\nTo: bob@corp.local\r\nSubject: Invoice\r\nContent-Type: text/plain\r\n\r\nPlease pay\r\n"
+
+func TestMailAPI_Disabled(t *testing.T) {
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	defer cleanup()
+
+	rec := httptest.NewRecorder()
+	fs.handleMailAPI(rec, httptest.NewRequest(http.MethodGet, "/?mail-api=list", nil), "list")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestMailAPI_ListRawParsedDelete(t *testing.T) {
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	defer cleanup()
+	mb, err := mailstore.Open(t.TempDir())
+	require.NoError(t, err)
+	fs.Mailbox = mb
+
+	m, err := mb.Save("alice@example.com", []string{"bob@corp.local"}, []byte(testMailMessage))
+	require.NoError(t, err)
+
+	// list
+	rec := httptest.NewRecorder()
+	fs.handleMailAPI(rec, httptest.NewRequest(http.MethodGet, "/?mail-api=list&rcpt=bob@corp.local", nil), "list")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var msgs []mailstore.Message
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &msgs))
+	require.Len(t, msgs, 1)
+	require.Equal(t, m.ID, msgs[0].ID)
+	require.Equal(t, "Invoice", msgs[0].Subject)
+
+	// raw
+	rec = httptest.NewRecorder()
+	fs.handleMailAPI(rec, httptest.NewRequest(http.MethodGet, "/?mail-api=raw&id="+m.ID, nil), "raw")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "message/rfc822", rec.Header().Get("Content-Type"))
+	require.Contains(t, rec.Body.String(), "Subject: Invoice")
+
+	// parsed
+	rec = httptest.NewRecorder()
+	fs.handleMailAPI(rec, httptest.NewRequest(http.MethodGet, "/?mail-api=parsed&id="+m.ID, nil), "parsed")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var event ws.SMTPEvent
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &event))
+	require.Equal(t, m.ID, event.ID)
+	require.Equal(t, "alice@example.com", event.From)
+	require.Equal(t, []string{"bob@corp.local"}, event.To)
+	require.Equal(t, "Invoice", event.Subject)
+	require.Contains(t, event.Body, "Please pay")
+
+	// delete needs a mutating method and the CSRF token
+	rec = httptest.NewRecorder()
+	fs.handleMailAPI(rec, httptest.NewRequest(http.MethodGet, "/?mail-api=delete&id="+m.ID, nil), "delete")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	req := httptest.NewRequest(http.MethodDelete, "/?mail-api=delete&id="+m.ID, nil)
+	req.Header.Set("Origin", "http://evil.example")
+	rec = httptest.NewRecorder()
+	fs.handleMailAPI(rec, req, "delete")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	req = httptest.NewRequest(http.MethodDelete, "/?mail-api=delete&id="+m.ID, nil)
+	req.Header.Set("X-CSRF-Token", "test-csrf")
+	rec = httptest.NewRecorder()
+	fs.handleMailAPI(rec, req, "delete")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = httptest.NewRecorder()
+	fs.handleMailAPI(rec, httptest.NewRequest(http.MethodGet, "/?mail-api=raw&id="+m.ID, nil), "raw")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestMailAPI_UnknownID(t *testing.T) {
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	defer cleanup()
+	mb, err := mailstore.Open(t.TempDir())
+	require.NoError(t, err)
+	fs.Mailbox = mb
+
+	rec := httptest.NewRecorder()
+	fs.handleMailAPI(rec, httptest.NewRequest(http.MethodGet, "/?mail-api=parsed&id=../../etc/passwd", nil), "parsed")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,33 @@
+package httpserver
+
+import (
+	"net/http"
+
+	"goshs.de/goshs/v2/apitoken"
+	"goshs.de/goshs/v2/metrics"
+)
+
+// metricsPath serves the metrics, on the web port or on -metrics-port.
+const metricsPath = "/metrics"
+
+// handleMetrics serves the metrics in the Prometheus text format to admins
+// and metrics tokens.
+func (fs *FileServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if denyForTokenAccess(w, r) || fs.denyNonAdmin(w, r, apitoken.ScopeMetrics) {
+		return
+	}
+	metrics.Handler().ServeHTTP(w, r)
+}
+
+// requireMetricsToken refuses requests without an API token. The metrics
+// listener cannot offer an OIDC login, so only tokens open it.
+func requireMetricsToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tokenFromContext(r) == nil {
+			logDenied(r, eventAuthFailure, http.StatusUnauthorized, "", "[METRICS] request without a token from %s", failureAddr(r))
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,88 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/apitoken"
+	"goshs.de/goshs/v2/metrics"
+	"goshs.de/goshs/v2/options"
+)
+
+func newMetricsFileServer(t *testing.T, what string, port int) (*FileServer, *CustomMux) {
+	t.Helper()
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	t.Cleanup(cleanup)
+	fs.User, fs.Pass = "admin", "pw"
+	fs.Options = &options.Options{}
+	fs.Metrics, fs.MetricsPort = true, port
+	store, err := apitoken.Load(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	fs.Tokens = store
+
+	mux := NewCustomMux()
+	_ = fs.SetupMux(mux, what)
+	return fs, mux
+}
+
+func TestMetrics_WebPort(t *testing.T) {
+	fs, mux := newMetricsFileServer(t, modeWeb, 0)
+	metricsSecret := addToken(t, fs, "prometheus", apitoken.ScopeMetrics, "")
+	readSecret := addToken(t, fs, "reader", apitoken.ScopeRead, "")
+
+	// Protected like the rest of the web server
+	w := tokenRequest(mux, http.MethodGet, metricsPath, "")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = tokenRequest(mux, http.MethodGet, metricsPath, metricsSecret)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, metrics.ContentType, w.Header().Get("Content-Type"))
+	require.Contains(t, w.Body.String(), "# TYPE goshs_http_requests_total counter")
+
+	// The request itself is counted
+	before := metrics.HTTPRequests.Value(modeWeb, http.MethodGet, "200")
+	tokenRequest(mux, http.MethodGet, metricsPath, metricsSecret)
+	require.Equal(t, before+1, metrics.HTTPRequests.Value(modeWeb, http.MethodGet, "200"))
+
+	// Metrics tokens cannot read files, other tokens cannot read metrics
+	w = tokenRequest(mux, http.MethodGet, "/", metricsSecret)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = tokenRequest(mux, http.MethodGet, metricsPath, readSecret)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	r := httptest.NewRequest(http.MethodGet, metricsPath, nil)
+	r.SetBasicAuth("admin", "pw")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMetrics_OwnPort(t *testing.T) {
+	fs, mux := newMetricsFileServer(t, modeMetrics, 9100)
+	secret := addToken(t, fs, "prometheus", apitoken.ScopeMetrics, "")
+
+	w := tokenRequest(mux, http.MethodGet, metricsPath, "")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	w = tokenRequest(mux, http.MethodGet, metricsPath, secret)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Nothing but the metrics is served
+	w = tokenRequest(mux, http.MethodGet, "/", secret)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMetrics_OIDCNeedsToken(t *testing.T) {
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	t.Cleanup(cleanup)
+	fs.Options = &options.Options{}
+	fs.Metrics, fs.MetricsPort = true, 9100
+	fs.OIDC = &OIDCAuth{}
+	mux := NewCustomMux()
+	_ = fs.SetupMux(mux, modeMetrics)
+
+	w := tokenRequest(mux, http.MethodGet, metricsPath, "")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
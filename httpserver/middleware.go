@@ -19,8 +19,8 @@ const (
 )
 
 // verifyCredentials checks the Authorization header against the configured
-// username/password (plaintext or bcrypt). Returns the raw header value on
-// success so it can be cached, or an empty string on failure.
+// username/password (plaintext or bcrypt) or the users file. Returns the raw
+// header value on success so it can be cached, or an empty string on failure.
 // Repeated failures from the same IP are rate-limited.
 func (fs *FileServer) verifyCredentials(r *http.Request) (authVal string, ok bool) {
 	auth := r.Header.Get("Authorization")
@@ -38,59 +38,23 @@ func (fs *FileServer) verifyCredentials(r *http.Request) (authVal string, ok boo
 	}
 
 	// Rate-limit check: reject IPs that have exceeded the failure threshold
-	clientIP, _, _ := net.SplitHostPort(r.RemoteAddr)
-	if clientIP == "" {
-		clientIP = r.RemoteAddr
-	}
-	fs.authFailMu.Lock()
-	if fs.authFailures == nil {
-		fs.authFailures = make(map[string]*authFailEntry)
-	}
-	entry := fs.authFailures[clientIP]
-	if entry != nil && time.Now().Before(entry.lockedUntil) {
-		fs.authFailMu.Unlock()
-		logger.Warnf("[AUTH] %s is locked out due to repeated failures", clientIP)
+	clientIP := failureAddr(r)
+	if fs.authLocked(clientIP) {
 		return "", false
 	}
-	fs.authFailMu.Unlock()
 
 	username, password, authOK := r.BasicAuth()
 	if !authOK {
 		return "", false
 	}
-
-	var verified bool
-	if strings.HasPrefix(fs.Pass, "$2a$") {
-		if username == fs.User {
-			verified = bcrypt.CompareHashAndPassword([]byte(fs.Pass), []byte(password)) == nil
-		}
-	} else {
-		verified = subtle.ConstantTimeCompare([]byte(username), []byte(fs.User)) == 1 &&
-			subtle.ConstantTimeCompare([]byte(password), []byte(fs.Pass)) == 1
-	}
-
-	if !verified {
-		fs.authFailMu.Lock()
-		if fs.authFailures == nil {
-			fs.authFailures = make(map[string]*authFailEntry)
-		}
-		if entry == nil {
-			entry = &authFailEntry{}
-			fs.authFailures[clientIP] = entry
-		}
-		entry.count++
-		if entry.count >= authMaxFailures {
-			entry.lockedUntil = time.Now().Add(authLockDuration)
-			logger.Warnf("[AUTH] %s locked out after %d failed attempts", clientIP, entry.count)
-		}
-		fs.authFailMu.Unlock()
+	if _, verified := fs.checkPassword(username, password); !verified {
+		fs.authFailed(clientIP)
+		logDenied(r, eventAuthFailure, http.StatusUnauthorized, username, "[AUTH] failed login of %q from %s", username, clientIP)
 		return "", false
 	}
 
 	// Success: clear failure record and cache the credential
-	fs.authFailMu.Lock()
-	delete(fs.authFailures, clientIP)
-	fs.authFailMu.Unlock()
+	fs.authSucceeded(clientIP)
 
 	fs.authCacheMu.Lock()
 	if fs.authCache == nil {
@@ -102,24 +66,96 @@ func (fs *FileServer) verifyCredentials(r *http.Request) (authVal string, ok boo
 	return authVal, true
 }
 
+// checkPassword verifies a login against the configured username/password
+// (plaintext or bcrypt) or the users file and returns the user name to use
+// for the session.
+func (fs *FileServer) checkPassword(username, password string) (string, bool) {
+	if fs.Users != nil {
+		if a := fs.Users.Authenticate(username, password); a != nil {
+			return a.Name, true
+		}
+		return "", false
+	}
+	user, pass := fs.credentials()
+	if strings.HasPrefix(pass, "$2a$") {
+		return username, username == user && bcrypt.CompareHashAndPassword([]byte(pass), []byte(password)) == nil
+	}
+	return username, subtle.ConstantTimeCompare([]byte(username), []byte(user)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(pass)) == 1
+}
+
+// failureAddr is the address failed logins of r are counted for.
+func failureAddr(r *http.Request) string {
+	clientIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+	if clientIP == "" {
+		clientIP = r.RemoteAddr
+	}
+	return clientIP
+}
+
+// authLocked reports whether clientIP exceeded the failure threshold.
+func (fs *FileServer) authLocked(clientIP string) bool {
+	fs.authFailMu.Lock()
+	defer fs.authFailMu.Unlock()
+	entry := fs.authFailures[clientIP]
+	if entry != nil && time.Now().Before(entry.lockedUntil) {
+		logger.Warnf("[AUTH] %s is locked out due to repeated failures", clientIP)
+		return true
+	}
+	return false
+}
+
+// authFailed records a failed login of clientIP and locks it out after
+// authMaxFailures attempts.
+func (fs *FileServer) authFailed(clientIP string) {
+	fs.authFailMu.Lock()
+	defer fs.authFailMu.Unlock()
+	if fs.authFailures == nil {
+		fs.authFailures = make(map[string]*authFailEntry)
+	}
+	entry := fs.authFailures[clientIP]
+	if entry == nil {
+		entry = &authFailEntry{}
+		fs.authFailures[clientIP] = entry
+	}
+	entry.count++
+	if entry.count >= authMaxFailures {
+		entry.lockedUntil = time.Now().Add(authLockDuration)
+		logger.Warnf("[AUTH] %s locked out after %d failed attempts", clientIP, entry.count)
+	}
+}
+
+// authSucceeded clears the failure record of clientIP.
+func (fs *FileServer) authSucceeded(clientIP string) {
+	fs.authFailMu.Lock()
+	delete(fs.authFailures, clientIP)
+	fs.authFailMu.Unlock()
+}
+
+// authExempt reports whether r may skip authentication: ConPtyShell.ps1 for
+// catcher upgrades, the PAC file for WPAD clients and requests already
+// authenticated by TokenMiddleware.
+func (fs *FileServer) authExempt(r *http.Request) bool {
+	return (r.URL.Query().Has("embedded") && r.URL.Path == "/ConPtyShell.ps1") || fs.isPACRequest(r) || tokenFromContext(r) != nil
+}
+
 // BasicAuthMiddleware is a middleware to handle the basic auth
 func (fs *FileServer) BasicAuthMiddleware(next http.Handler) http.Handler {
+	return fs.basicAuth(next, true)
+}
+
+// basicAuth requires basic auth. With shares, requests carrying the token of
+// a shared link are let in, only the web UI serves those.
+func (fs *FileServer) basicAuth(next http.Handler, shares bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Allow unauthenticated access to ConPtyShell.ps1 for catcher upgrades
-		if r.URL.Query().Has("embedded") && r.URL.Path == "/ConPtyShell.ps1" {
+		if fs.authExempt(r) {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		token := r.URL.Query().Get("token")
-		if token != "" {
-			fs.sharedLinksMu.RLock()
-			_, ok := fs.SharedLinks[token]
-			fs.sharedLinksMu.RUnlock()
-			if ok {
-				next.ServeHTTP(w, r)
-				return
-			}
+		if shares && fs.sharedLinkRequest(r) {
+			next.ServeHTTP(w, r)
+			return
 		}
 
 		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
@@ -127,15 +163,42 @@ func (fs *FileServer) BasicAuthMiddleware(next http.Handler) http.Handler {
 			http.Error(w, "Not authorized", http.StatusUnauthorized)
 			return
 		}
+		r, ok := fs.withAccount(r)
+		if !ok {
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// sharedLinkRequest reports whether r may skip the login because it carries
+// the token of a shared link. Download links are only fetched, upload request
+// links only show their upload page and take uploads.
+func (fs *FileServer) sharedLinkRequest(r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	if token == "" || r.URL.Path == metricsPath {
+		return false
+	}
+	fs.sharedLinksMu.RLock()
+	link, ok := fs.SharedLinks[token]
+	fs.sharedLinksMu.RUnlock()
+	if !ok {
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPost:
+		return link.Upload
+	}
+	return false
+}
+
 // InvisibleBasicAuthMiddleware is a middleware to handle basic auth in invisible mode
 func (fs *FileServer) InvisibleBasicAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Allow unauthenticated access to ConPtyShell.ps1 for catcher upgrades
-		if r.URL.Query().Has("embedded") && r.URL.Path == "/ConPtyShell.ps1" {
+		if fs.authExempt(r) {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -144,6 +207,11 @@ func (fs *FileServer) InvisibleBasicAuthMiddleware(next http.Handler) http.Handl
 			fs.handleInvisible(w)
 			return
 		}
+		r, ok := fs.withAccount(r)
+		if !ok {
+			fs.handleInvisible(w)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -169,7 +237,7 @@ func (fs *FileServer) IPWhitelistMiddleware(next http.Handler) http.Handler {
 		clientIP := GetClientIP(r, fs.Whitelist)
 
 		if !fs.Whitelist.IsAllowed(clientIP) {
-			logger.Warnf("[WHITELIST] Access denied for IP: %s", clientIP)
+			logDenied(r, eventDenied, http.StatusForbidden, "", "[WHITELIST] Access denied for IP: %s", clientIP)
 			if !fs.Invisible {
 				http.Error(w, "Access Denied", http.StatusForbidden)
 				return
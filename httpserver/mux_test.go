@@ -1237,7 +1237,7 @@ func TestConstructDefault(t *testing.T) {
 		{Name: "a.txt", IsDir: false, Ext: ".txt", DisplaySize: "10 B", SortSize: 10},
 	}
 	w := httptest.NewRecorder()
-	fs.constructDefault(w, "/", items, nil)
+	fs.constructDefault(w, httptest.NewRequest(http.MethodGet, "/", nil), "/", items, nil)
 	require.Equal(t, http.StatusOK, w.Code)
 }
 
@@ -1249,7 +1249,7 @@ func TestConstructDefault_Subdirectory(t *testing.T) {
 	fs.Port = 8080
 
 	w := httptest.NewRecorder()
-	fs.constructDefault(w, "/subdir", nil, nil)
+	fs.constructDefault(w, httptest.NewRequest(http.MethodGet, "/", nil), "/subdir", nil, nil)
 	require.Equal(t, http.StatusOK, w.Code)
 }
 
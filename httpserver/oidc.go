@@ -0,0 +1,327 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/users"
+)
+
+const (
+	oidcSessionCookie   = "goshs_session"
+	oidcLoginCookie     = "goshs_oidc"
+	oidcSessionLifetime = 12 * time.Hour
+	oidcLoginLifetime   = 10 * time.Minute
+)
+
+// OIDCAuth logs users of the web UI in with the OpenID Connect authorization
+// code flow and keeps them logged in with a signed session cookie.
+type OIDCAuth struct {
+	verifier    *oidc.IDTokenVerifier
+	config      oauth2.Config
+	redirectURL string   // "" derives it from the request
+	emails      []string // allowed addresses, "@domain" for whole domains
+	groups      []string // allowed values of the groups claim
+	cookies     cookieSigner
+}
+
+// oidcSession is the identity kept in the session cookie.
+type oidcSession struct {
+	Subject string   `json:"sub"`
+	Email   string   `json:"email,omitempty"` // only if verified by the issuer
+	Name    string   `json:"name,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	Expires int64    `json:"exp"`
+}
+
+// oidcLogin is the state of a pending login, kept in a short-lived cookie.
+type oidcLogin struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Return   string `json:"return"`
+	Expires  int64  `json:"exp"`
+}
+
+type oidcSessionKey struct{}
+
+// NewOIDCAuth discovers the issuer of opts and prepares the login flow.
+func NewOIDCAuth(ctx context.Context, opts *options.Options) (*OIDCAuth, error) {
+	provider, err := oidc.NewProvider(ctx, opts.OIDCIssuer)
+	if err != nil {
+		return nil, fmt.Errorf("discovering %s: %w", opts.OIDCIssuer, err)
+	}
+	cookies, err := newCookieSigner()
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCAuth{
+		verifier: provider.Verifier(&oidc.Config{ClientID: opts.OIDCClientID}),
+		config: oauth2.Config{
+			ClientID:     opts.OIDCClientID,
+			ClientSecret: opts.OIDCClientSecret,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		redirectURL: opts.OIDCRedirectURL,
+		emails:      splitList(opts.OIDCEmails),
+		groups:      splitList(opts.OIDCGroups),
+		cookies:     cookies,
+	}, nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Identity is the name used for logging, share link ownership and ACLs.
+func (s *oidcSession) Identity() string {
+	if s.Email != "" {
+		return s.Email
+	}
+	return s.Subject
+}
+
+func oidcFromContext(r *http.Request) *oidcSession {
+	s, _ := r.Context().Value(oidcSessionKey{}).(*oidcSession)
+	return s
+}
+
+// allowed reports whether the claims pass the configured email and group
+// lists. Without any list every user of the issuer is allowed.
+func (o *OIDCAuth) allowed(s *oidcSession) bool {
+	if len(o.emails) == 0 && len(o.groups) == 0 {
+		return true
+	}
+	if s.Email != "" {
+		email := strings.ToLower(s.Email)
+		for _, allowed := range o.emails {
+			allowed = strings.ToLower(allowed)
+			if email == allowed || (strings.HasPrefix(allowed, "@") && strings.HasSuffix(email, allowed)) {
+				return true
+			}
+		}
+	}
+	return slices.ContainsFunc(s.Groups, func(g string) bool { return slices.Contains(o.groups, g) })
+}
+
+// session returns the valid session of the request, if any.
+func (o *OIDCAuth) session(r *http.Request) *oidcSession {
+	c, err := r.Cookie(oidcSessionCookie)
+	if err != nil {
+		return nil
+	}
+	var s oidcSession
+	if err := o.cookies.verify(oidcSessionCookie, c.Value, &s); err != nil || s.Subject == "" || time.Now().Unix() > s.Expires {
+		return nil
+	}
+	return &s
+}
+
+// oauthConfig returns the client configuration with the redirect URL for r.
+func (o *OIDCAuth) oauthConfig(r *http.Request) *oauth2.Config {
+	cfg := o.config
+	cfg.RedirectURL = o.redirectURL
+	if cfg.RedirectURL == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		cfg.RedirectURL = scheme + "://" + r.Host + "/?oidc-callback"
+	}
+	return &cfg
+}
+
+// login starts the authorization code flow and returns to the requested
+// page afterwards.
+func (o *OIDCAuth) login(w http.ResponseWriter, r *http.Request) {
+	l := oidcLogin{
+		State:    oauth2.GenerateVerifier(),
+		Nonce:    oauth2.GenerateVerifier(),
+		Verifier: oauth2.GenerateVerifier(),
+		Return:   r.URL.RequestURI(),
+		Expires:  time.Now().Add(oidcLoginLifetime).Unix(),
+	}
+	if err := o.cookies.setCookie(w, r, oidcLoginCookie, l, oidcLoginLifetime); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	url := o.oauthConfig(r).AuthCodeURL(l.State, oidc.Nonce(l.Nonce), oauth2.S256ChallengeOption(l.Verifier))
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// callback finishes the login started by login.
+func (o *OIDCAuth) callback(w http.ResponseWriter, r *http.Request) {
+	fail := func(status int, format string, args ...any) {
+		logDenied(r, eventAuthFailure, status, "", "[OIDC] login failed: "+format, args...)
+		http.Error(w, http.StatusText(status), status)
+	}
+
+	c, err := r.Cookie(oidcLoginCookie)
+	if err != nil {
+		fail(http.StatusBadRequest, "no pending login")
+		return
+	}
+	clearCookie(w, oidcLoginCookie)
+	var l oidcLogin
+	if err := o.cookies.verify(oidcLoginCookie, c.Value, &l); err != nil || time.Now().Unix() > l.Expires {
+		fail(http.StatusBadRequest, "invalid or expired login state")
+		return
+	}
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		fail(http.StatusUnauthorized, "issuer returned %s: %s", e, q.Get("error_description"))
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(l.State)) != 1 {
+		fail(http.StatusBadRequest, "state mismatch")
+		return
+	}
+
+	token, err := o.oauthConfig(r).Exchange(r.Context(), q.Get("code"), oauth2.VerifierOption(l.Verifier))
+	if err != nil {
+		fail(http.StatusUnauthorized, "code exchange: %+v", err)
+		return
+	}
+	rawID, ok := token.Extra("id_token").(string)
+	if !ok {
+		fail(http.StatusUnauthorized, "no id_token in token response")
+		return
+	}
+	idToken, err := o.verifier.Verify(r.Context(), rawID)
+	if err != nil {
+		fail(http.StatusUnauthorized, "id token: %+v", err)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(l.Nonce)) != 1 {
+		fail(http.StatusUnauthorized, "nonce mismatch")
+		return
+	}
+
+	var claims struct {
+		Email             string   `json:"email"`
+		EmailVerified     *bool    `json:"email_verified"`
+		Name              string   `json:"name"`
+		PreferredUsername string   `json:"preferred_username"`
+		Groups            []string `json:"groups"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		fail(http.StatusUnauthorized, "claims: %+v", err)
+		return
+	}
+	s := &oidcSession{
+		Subject: idToken.Subject,
+		Name:    claims.PreferredUsername,
+		Groups:  claims.Groups,
+		Expires: time.Now().Add(oidcSessionLifetime).Unix(),
+	}
+	if s.Name == "" {
+		s.Name = claims.Name
+	}
+	// Only verified addresses are allowed by the email list or name an
+	// account of the users file
+	if claims.EmailVerified != nil && *claims.EmailVerified {
+		s.Email = claims.Email
+	}
+	if !o.allowed(s) {
+		logDenied(r, eventDenied, http.StatusForbidden, s.Identity(), "[OIDC] %s is not in the allowed emails or groups", s.Identity())
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if err := o.cookies.setCookie(w, r, oidcSessionCookie, s, oidcSessionLifetime); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	logger.Infof("[OIDC] %s logged in", s.Identity())
+
+	http.Redirect(w, r, localPath(l.Return, "oidc-callback"), http.StatusFound)
+}
+
+// oidcAccount returns the users file account of a session, matched by its
+// verified email. The user name claims are not used, users can usually pick
+// them themselves. It is nil without a users file.
+func (fs *FileServer) oidcAccount(s *oidcSession) (*users.Account, bool) {
+	if fs.Users == nil {
+		return nil, true
+	}
+	if s.Email == "" {
+		return nil, false
+	}
+	a := fs.Users.Lookup(s.Email)
+	return a, a != nil
+}
+
+// OIDCMiddleware requires an OpenID Connect login. Basic auth credentials are
+// still accepted if configured, so scripts keep working.
+func (fs *FileServer) OIDCMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fs.authExempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		q := r.URL.Query()
+		switch {
+		case q.Has("oidc-callback"):
+			fs.OIDC.callback(w, r)
+			return
+		case q.Has("oidc-logout"):
+			clearCookie(w, oidcSessionCookie)
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+
+		if fs.sharedLinkRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if s := fs.OIDC.session(r); s != nil {
+			a, ok := fs.oidcAccount(s)
+			if !ok {
+				logDenied(r, eventDenied, http.StatusForbidden, s.Identity(), "[OIDC] %s has no account in the users file", s.Identity())
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			ctx := context.WithValue(r.Context(), oidcSessionKey{}, s)
+			if a != nil {
+				ctx = users.NewContext(ctx, a)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		if _, _, ok := r.BasicAuth(); ok && fs.basicAuthEnabled() {
+			if _, ok := fs.verifyCredentials(r); ok {
+				if r, ok := fs.withAccount(r); ok {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		// Browsers are sent to the issuer, API clients get a plain 401
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			fs.OIDC.login(w, r)
+			return
+		}
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,283 @@
+package httpserver
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/users"
+)
+
+// mockIdP is a minimal OpenID Connect issuer. It hands out an ID token for
+// the claims of the next login and checks the PKCE verifier.
+type mockIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	claims    map[string]any
+	nonce     string
+	challenge string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idp := &mockIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                idp.URL,
+			"authorization_endpoint":                idp.URL + "/auth",
+			"token_endpoint":                        idp.URL + "/token",
+			"jwks_uri":                              idp.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		claims := map[string]any{
+			"iss":   idp.URL,
+			"aud":   "goshs",
+			"sub":   "1234",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": idp.nonce,
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     idp.sign(t, claims),
+		})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *mockIdP) sign(t *testing.T, claims map[string]any) string {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, sum[:])
+	require.NoError(t, err)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// login runs the authorization code flow against h as a browser and returns
+// the final response.
+func (idp *mockIdP) login(t *testing.T, h http.Handler, claims map[string]any) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/docs/?json", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusFound, w.Code)
+
+	auth, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(auth.String(), idp.URL+"/auth"))
+	q := auth.Query()
+	require.Equal(t, "http://example.com/?oidc-callback", q.Get("redirect_uri"))
+	require.Equal(t, "S256", q.Get("code_challenge_method"))
+
+	idp.mu.Lock()
+	idp.claims, idp.nonce, idp.challenge = claims, q.Get("nonce"), q.Get("code_challenge")
+	idp.mu.Unlock()
+
+	r = httptest.NewRequest(http.MethodGet, "/?oidc-callback&code=good-code&state="+url.QueryEscape(q.Get("state")), nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func newOIDCFileServer(t *testing.T, opts *options.Options) (*FileServer, *mockIdP, http.Handler) {
+	t.Helper()
+	idp := newMockIdP(t)
+	opts.OIDCIssuer = idp.URL
+	opts.OIDCClientID = "goshs"
+	opts.OIDCClientSecret = "secret"
+	auth, err := NewOIDCAuth(context.Background(), opts)
+	require.NoError(t, err)
+
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	t.Cleanup(cleanup)
+	fs.OIDC = auth
+	fs.Options = opts
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s := oidcFromContext(r); s != nil {
+			name := ""
+			if a := namedAccount(r); a != nil {
+				name = a.Name
+			}
+			_, _ = w.Write([]byte(s.Identity() + ":" + name))
+		}
+	})
+	return fs, idp, fs.OIDCMiddleware(next)
+}
+
+func sessionCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcSessionCookie && c.Value != "" {
+			return c
+		}
+	}
+	t.Fatal("no session cookie")
+	return nil
+}
+
+func TestOIDC_LoginFlow(t *testing.T) {
+	_, idp, h := newOIDCFileServer(t, &options.Options{OIDCEmails: "@example.com"})
+
+	// API clients are not redirected
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?json", nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = idp.login(t, h, map[string]any{"email": "alice@example.com", "email_verified": true})
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Equal(t, "/docs/?json", w.Header().Get("Location"))
+	c := sessionCookie(t, w)
+	require.True(t, c.HttpOnly)
+	require.Equal(t, http.SameSiteLaxMode, c.SameSite)
+
+	r := httptest.NewRequest(http.MethodGet, "/?json", nil)
+	r.AddCookie(c)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "alice@example.com:", w.Body.String())
+
+	// A tampered cookie is rejected
+	r = httptest.NewRequest(http.MethodGet, "/?json", nil)
+	r.AddCookie(&http.Cookie{Name: oidcSessionCookie, Value: "x" + c.Value})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestOIDC_AllowedClaims(t *testing.T) {
+	_, idp, h := newOIDCFileServer(t, &options.Options{OIDCEmails: "bob@corp.test", OIDCGroups: "goshs-users"})
+
+	w := idp.login(t, h, map[string]any{"email": "mallory@example.com"})
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	// Unverified addresses do not count, neither do those the issuer does
+	// not say anything about
+	w = idp.login(t, h, map[string]any{"email": "bob@corp.test", "email_verified": false})
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = idp.login(t, h, map[string]any{"email": "bob@corp.test"})
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = idp.login(t, h, map[string]any{"email": "carol@example.com", "groups": []string{"goshs-users"}})
+	require.Equal(t, http.StatusFound, w.Code)
+	sessionCookie(t, w)
+}
+
+func TestOIDC_CallbackRejectsBadState(t *testing.T) {
+	_, _, h := newOIDCFileServer(t, &options.Options{})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?oidc-callback&code=good-code&state=x", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	r = httptest.NewRequest(http.MethodGet, "/?oidc-callback&code=good-code&state=wrong", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOIDC_UsersFileAccount(t *testing.T) {
+	fs, idp, h := newOIDCFileServer(t, &options.Options{})
+	u, err := users.Parse(strings.NewReader("alice@example.com:pw:read\nadmin:pw:admin\n"))
+	require.NoError(t, err)
+	fs.Users = u
+
+	w := idp.login(t, h, map[string]any{"email": "alice@example.com", "email_verified": true})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(sessionCookie(t, w))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, "alice@example.com:alice@example.com", w.Body.String())
+
+	// An unverified address does not name the account
+	w = idp.login(t, h, map[string]any{"email": "alice@example.com"})
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(sessionCookie(t, w))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	// User name claims do not name an account, users can set them
+	w = idp.login(t, h, map[string]any{"email": "mallory@example.com", "email_verified": true, "preferred_username": "admin", "name": "admin"})
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(sessionCookie(t, w))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	// Sessions without an account are refused when a users file is in use
+	w = idp.login(t, h, map[string]any{"email": "bob@example.com", "email_verified": true})
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(sessionCookie(t, w))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	// Basic auth keeps working next to OIDC
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", basicAuthHeader("alice@example.com", "pw"))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+}
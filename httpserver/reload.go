@@ -0,0 +1,79 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"goshs.de/goshs/v2/config"
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/options"
+)
+
+// Reconfigure applies the options a config reload changes to the running
+// server: basic auth, read-only, upload-only, no-delete, the upload limit
+// and verbose logging. Logins cached with the old credentials are dropped.
+func (fs *FileServer) Reconfigure(opts *options.Options) {
+	fs.settingsMu.Lock()
+	fs.User = opts.Username
+	fs.Pass = opts.Password
+	fs.ReadOnly = opts.ReadOnly
+	fs.UploadOnly = opts.UploadOnly
+	fs.NoDelete = opts.NoDelete
+	fs.MaxUpload = opts.MaxUploadSize
+	fs.Verbose = opts.Verbose
+	fs.settingsMu.Unlock()
+
+	fs.authCacheMu.Lock()
+	fs.authCache = make(map[string]bool)
+	fs.authCacheMu.Unlock()
+}
+
+// credentials returns the basic auth user and password.
+func (fs *FileServer) credentials() (string, string) {
+	fs.settingsMu.RLock()
+	defer fs.settingsMu.RUnlock()
+	return fs.User, fs.Pass
+}
+
+func (fs *FileServer) verbose() bool {
+	fs.settingsMu.RLock()
+	defer fs.settingsMu.RUnlock()
+	return fs.Verbose
+}
+
+func (fs *FileServer) maxUpload() int64 {
+	fs.settingsMu.RLock()
+	defer fs.settingsMu.RUnlock()
+	return fs.MaxUpload
+}
+
+// handleConfigAPI reloads the config file like a SIGHUP does.
+func (fs *FileServer) handleConfigAPI(w http.ResponseWriter, req *http.Request, action string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if action != "reload" {
+		http.Error(w, `{"error":"unknown action"}`, http.StatusBadRequest)
+		return
+	}
+	if !fs.checkCSRF(w, req) {
+		return
+	}
+	if fs.ReloadConfig == nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, config.ErrNoConfigFile.Error()), http.StatusConflict)
+		return
+	}
+
+	change, err := fs.ReloadConfig()
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, config.ErrNoConfigFile) {
+			status = http.StatusConflict
+		}
+		logger.Errorf("[CONFIG] reload requested by %s failed: %+v", logger.RequestUser(req), err)
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), status)
+		return
+	}
+	json.NewEncoder(w).Encode(change)
+}
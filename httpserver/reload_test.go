@@ -0,0 +1,71 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/config"
+	"goshs.de/goshs/v2/options"
+)
+
+func TestReconfigure(t *testing.T) {
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	t.Cleanup(cleanup)
+	fs.User, fs.Pass = "admin", "old"
+	fs.Options = &options.Options{}
+	mux := NewCustomMux()
+	_ = fs.SetupMux(mux, modeWeb)
+
+	login := func(pass string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.SetBasicAuth("admin", pass)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w.Code
+	}
+	require.Equal(t, http.StatusOK, login("old"))
+
+	// The cached login with the old password is dropped
+	fs.Reconfigure(&options.Options{Username: "admin", Password: "new", ReadOnly: true, MaxUploadSize: 1024, Verbose: true})
+	require.Equal(t, http.StatusUnauthorized, login("old"))
+	require.Equal(t, http.StatusOK, login("new"))
+	require.True(t, fs.readOnly(httptest.NewRequest(http.MethodGet, "/", nil)))
+	require.Equal(t, int64(1024), fs.maxUpload())
+	require.True(t, fs.verbose())
+}
+
+func TestConfigAPI(t *testing.T) {
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	t.Cleanup(cleanup)
+	fs.Options = &options.Options{}
+	mux := NewCustomMux()
+	_ = fs.SetupMux(mux, modeWeb)
+
+	reload := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/?config-api=reload", nil))
+		return w
+	}
+
+	// Without a config file there is nothing to reload
+	require.Equal(t, http.StatusConflict, reload().Code)
+
+	fs.ReloadConfig = func() (*config.Change, error) {
+		return &config.Change{Applied: []string{"read_only"}, Restart: []string{"port"}}, nil
+	}
+	w := reload()
+	require.Equal(t, http.StatusOK, w.Code)
+	var change config.Change
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&change))
+	require.Equal(t, []string{"read_only"}, change.Applied)
+	require.Equal(t, []string{"port"}, change.Restart)
+
+	fs.ReloadConfig = func() (*config.Change, error) { return nil, errors.New("invalid CIDR") }
+	w = reload()
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "invalid CIDR")
+}
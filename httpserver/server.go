@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -12,7 +13,6 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -20,26 +20,30 @@ import (
 
 	"github.com/howeyc/gopass"
 	"golang.org/x/net/webdav"
+	"goshs.de/goshs/v2/apitoken"
 	"goshs.de/goshs/v2/ca"
 	"goshs.de/goshs/v2/catcher"
 	"goshs.de/goshs/v2/clipboard"
-	"goshs.de/goshs/v2/config"
 	"goshs.de/goshs/v2/goshsversion"
 	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/metrics"
 	"goshs.de/goshs/v2/options"
-	"goshs.de/goshs/v2/tunnel"
 	"goshs.de/goshs/v2/webhook"
 	"goshs.de/goshs/v2/ws"
 	"software.sslmate.com/src/go-pkcs12"
 )
 
 // Shutdown gracefully stops the HTTP server, waiting up to ctx's deadline for
-// in-flight requests to complete.
+// in-flight requests to complete. The connections still open then are closed.
 func (fs *FileServer) Shutdown(ctx context.Context) error {
 	if fs.httpServer == nil {
 		return nil
 	}
-	return fs.httpServer.Shutdown(ctx)
+	err := fs.httpServer.Shutdown(ctx)
+	if err != nil {
+		_ = fs.httpServer.Close()
+	}
+	return err
 }
 
 // logServeResult treats http.ErrServerClosed as a clean exit (graceful
@@ -88,6 +92,8 @@ func NewHttpServer(opts *options.Options, hub *ws.Hub, clip *clipboard.Clipboard
 		Embedded:     opts.Embedded,
 		Verbose:      opts.Verbose,
 		Tunnel:       opts.Tunnel,
+		Metrics:      opts.Metrics,
+		MetricsPort:  opts.MetricsPort,
 		Version:      goshsversion.GoshsVersion,
 		MaxUpload:    opts.MaxUploadSize,
 		Options:      opts,
@@ -101,6 +107,7 @@ func NewHttpServer(opts *options.Options, hub *ws.Hub, clip *clipboard.Clipboard
 	fs.Webhook = wh
 	fs.Whitelist = wl
 	fs.CatcherMgr = catcher.NewManager(hub)
+	fs.CatcherMgr.Webhook = wh
 
 	return fs
 }
@@ -109,12 +116,41 @@ func (fs *FileServer) SetupMux(mux *CustomMux, what string) string {
 	var addr string
 	switch what {
 	case modeWeb:
-		// Check Basic Auth and use middleware
-		if (fs.User != "" || fs.Pass != "") && what == modeWeb {
+		// Requests are counted for the metrics and measured for their
+		// access log entries
+		mux.Use(metrics.Middleware(modeWeb))
+		mux.Use(logger.AccessLog)
+
+		// API tokens are checked first, the auth middlewares let them pass
+		if fs.Tokens != nil {
+			mux.Use(fs.TokenMiddleware)
+		}
+
+		// Check OIDC or Basic Auth and use middleware
+		if fs.OIDC != nil {
+			if !fs.SSL {
+				logger.Warnf("You are using OIDC login without SSL. Session cookies will be transferred in cleartext. Consider using -s, too.")
+			}
+			logger.Infof("Using OIDC login with issuer %s", fs.Options.OIDCIssuer)
+			mux.Use(fs.OIDCMiddleware)
+		} else if fs.TOTP != nil {
+			if !fs.SSL {
+				logger.Warnf("You are using TOTP login without SSL. Credentials and session cookies will be transferred in cleartext. Consider using -s, too.")
+			}
+			logger.Infof("Using password and TOTP login with secrets from %s", fs.Options.TOTPFile)
+			if fs.TOTP.basicUpload {
+				logger.Warnf("Basic auth without TOTP is still accepted for uploads (-totp-basic-upload)")
+			}
+			mux.Use(fs.TOTPMiddleware)
+		} else if fs.basicAuthEnabled() && what == modeWeb {
 			if !fs.SSL {
 				logger.Warnf("You are using basic auth without SSL. Your credentials will be transferred in cleartext. Consider using -s, too.")
 			}
-			logger.Infof("Using basic auth with user '%s' and password '%s'", fs.User, fs.Pass)
+			if fs.Users != nil {
+				logger.Infof("Using basic auth with %d accounts from the users file", fs.accountCount())
+			} else {
+				logger.Infof("Using basic auth with user '%s' and password '%s'", fs.User, fs.Pass)
+			}
 			if fs.Invisible {
 				// Use invisible basic auth middleware
 				mux.Use(fs.InvisibleBasicAuthMiddleware)
@@ -124,6 +160,11 @@ func (fs *FileServer) SetupMux(mux *CustomMux, what string) string {
 			}
 		}
 
+		// Client certificates name the request and may map it to an account
+		if fs.CACert != "" {
+			mux.Use(fs.ClientCertMiddleware)
+		}
+
 		// IP Whitelist Middleware
 		mux.Use(fs.IPWhitelistMiddleware)
 
@@ -131,14 +172,75 @@ func (fs *FileServer) SetupMux(mux *CustomMux, what string) string {
 		mux.Use(fs.ServerHeaderMiddleware)
 
 		// Define routes
+		if fs.Metrics && fs.MetricsPort == 0 {
+			logger.Infof("Serving metrics at %s", metricsPath)
+			mux.HandleFunc("GET "+metricsPath, fs.handleMetrics)
+		}
 		mux.HandleFunc("POST /", func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.URL.Query()["token"]; ok {
+				if fs.Invisible {
+					fs.handleInvisible(w)
+					return
+				}
+				fs.uploadRequestUpload(w, r)
+				return
+			}
 			if action, ok := r.URL.Query()["catcher-api"]; ok {
-				if denyForTokenAccess(w, r) {
+				if denyForTokenAccess(w, r) || fs.denyNonAdmin(w, r, apitoken.ScopeCatcher) {
 					return
 				}
 				fs.handleCatcherAPI(w, r, action[0])
 				return
 			}
+			if action, ok := r.URL.Query()["crack-api"]; ok {
+				if denyForTokenAccess(w, r) || fs.denyNonAdmin(w, r) {
+					return
+				}
+				fs.handleCrackAPI(w, r, action[0])
+				return
+			}
+			if action, ok := r.URL.Query()["mail-api"]; ok {
+				if denyForTokenAccess(w, r) || fs.denyNonAdmin(w, r) {
+					return
+				}
+				fs.handleMailAPI(w, r, action[0])
+				return
+			}
+			if action, ok := r.URL.Query()["token-api"]; ok {
+				if denyForTokenAccess(w, r) || fs.denyNonAdmin(w, r) {
+					return
+				}
+				fs.handleTokenAPI(w, r, action[0])
+				return
+			}
+			if action, ok := r.URL.Query()["ca-api"]; ok {
+				if denyForTokenAccess(w, r) || fs.denyNonAdmin(w, r) {
+					return
+				}
+				fs.handleCAAPI(w, r, action[0])
+				return
+			}
+			if action, ok := r.URL.Query()["config-api"]; ok {
+				if denyForTokenAccess(w, r) || fs.denyNonAdmin(w, r) {
+					return
+				}
+				fs.handleConfigAPI(w, r, action[0])
+				return
+			}
+			if action, ok := r.URL.Query()["services-api"]; ok {
+				if denyForTokenAccess(w, r) || fs.denyNonAdmin(w, r) {
+					return
+				}
+				fs.handleServicesAPI(w, r, action[0])
+				return
+			}
+			if action, ok := r.URL.Query()["share-api"]; ok {
+				if denyForTokenAccess(w, r) {
+					return
+				}
+				fs.handleShareAPI(w, r, action[0])
+				return
+			}
 			if strings.HasSuffix(r.URL.Path, "/upload") {
 				if denyForTokenAccess(w, r) {
 					return
@@ -165,12 +267,40 @@ func (fs *FileServer) SetupMux(mux *CustomMux, what string) string {
 		})
 		mux.HandleFunc("DELETE /", func(w http.ResponseWriter, r *http.Request) {
 			if action, ok := r.URL.Query()["catcher-api"]; ok {
-				if denyForTokenAccess(w, r) {
+				if denyForTokenAccess(w, r) || fs.denyNonAdmin(w, r, apitoken.ScopeCatcher) {
 					return
 				}
 				fs.handleCatcherAPI(w, r, action[0])
 				return
 			}
+			if action, ok := r.URL.Query()["mail-api"]; ok {
+				if denyForTokenAccess(w, r) || fs.denyNonAdmin(w, r) {
+					return
+				}
+				fs.handleMailAPI(w, r, action[0])
+				return
+			}
+			if action, ok := r.URL.Query()["token-api"]; ok {
+				if denyForTokenAccess(w, r) || fs.denyNonAdmin(w, r) {
+					return
+				}
+				fs.handleTokenAPI(w, r, action[0])
+				return
+			}
+			if action, ok := r.URL.Query()["ca-api"]; ok {
+				if denyForTokenAccess(w, r) || fs.denyNonAdmin(w, r) {
+					return
+				}
+				fs.handleCAAPI(w, r, action[0])
+				return
+			}
+			if action, ok := r.URL.Query()["share-api"]; ok {
+				if denyForTokenAccess(w, r) {
+					return
+				}
+				fs.handleShareAPI(w, r, action[0])
+				return
+			}
 			if _, ok := r.URL.Query()["token"]; ok {
 				if !fs.checkCSRF(w, r) {
 					return
@@ -184,7 +314,7 @@ func (fs *FileServer) SetupMux(mux *CustomMux, what string) string {
 			if !fs.checkCSRF(w, r) {
 				return
 			}
-			if fs.ReadOnly || fs.UploadOnly || fs.NoDelete {
+			if fs.readOnly(r) || fs.uploadOnly(r) || fs.noDelete(r) {
 				fs.handleError(w, r, fmt.Errorf("delete not allowed"), http.StatusForbidden)
 				return
 			}
@@ -205,6 +335,11 @@ func (fs *FileServer) SetupMux(mux *CustomMux, what string) string {
 
 		addr = net.JoinHostPort(fs.IP, strconv.Itoa(fs.Port))
 	case "webdav":
+		// Requests are counted for the metrics and measured for their
+		// access log entries
+		mux.Use(metrics.Middleware("webdav"))
+		mux.Use(logger.AccessLog)
+
 		// IP Whitelist Middleware
 		mux.Use(fs.IPWhitelistMiddleware)
 
@@ -215,25 +350,66 @@ func (fs *FileServer) SetupMux(mux *CustomMux, what string) string {
 			FileSystem: webdav.Dir(fs.Webroot),
 			LockSystem: webdav.NewMemLS(),
 			Logger: func(r *http.Request, e error) {
-				if e != nil && r.Method != "PROPFIND" {
-					logger.HandleWebhookSend(fmt.Sprintf("[WEBDAV] ERROR: %s - - \"%s %s %s\"", r.RemoteAddr, r.Method, r.URL.Path, r.Proto), "webdav", fs.Webhook)
-					logger.Errorf("WEBDAV: %s - - \"%s %s %s\"", r.RemoteAddr, r.Method, r.URL.Path, r.Proto)
+				if r.Method == "PROPFIND" {
 					return
-				} else if r.Method != "PROPFIND" {
-					logger.HandleWebhookSend(fmt.Sprintf("[WEBDAV]: %s - - \"%s %s %s\"", r.RemoteAddr, r.Method, r.URL.Path, r.Proto), "webdav", fs.Webhook)
-					logger.Infof("WEBDAV:  %s - - \"%s %s %s\"", r.RemoteAddr, r.Method, r.URL.Path, r.Proto)
 				}
+				if e == nil && r.Method == http.MethodPut {
+					metrics.Uploads.Inc("webdav")
+					metrics.UploadBytes.Add(float64(r.ContentLength), "webdav")
+				}
+				if e != nil {
+					logger.HandleWebhookSend(fmt.Sprintf("[WEBDAV] ERROR: %s - - \"%s %s %s\"%s", logger.Client(r), r.Method, r.URL.Path, r.Proto, byToken(r)), "webdav", fs.Webhook)
+				} else {
+					logger.HandleWebhookSend(fmt.Sprintf("[WEBDAV]: %s - - \"%s %s %s\"%s", logger.Client(r), r.Method, r.URL.Path, r.Proto, byToken(r)), "webdav", fs.Webhook)
+				}
+				logger.Defer(r, func(bytes int64, d time.Duration) {
+					a := logger.Access{Protocol: "webdav", Client: r.RemoteAddr, User: logger.RequestUser(r), Method: r.Method, Path: r.URL.Path, Proto: r.Proto, Bytes: bytes, Duration: d, UserAgent: r.UserAgent()}
+					if e != nil {
+						a.Errorf("WEBDAV: %s - - \"%s %s %s\"", logger.Client(r), r.Method, r.URL.Path, r.Proto)
+						return
+					}
+					a.Infof("WEBDAV:  %s - - \"%s %s %s\"", logger.Client(r), r.Method, r.URL.Path, r.Proto)
+				})
 			},
 		}
 
 		// Check Basic Auth and use middleware
-		if fs.User != "" || fs.Pass != "" {
-			authHandler := fs.BasicAuthMiddleware(wdHandler)
-			mux.Handle("/", authHandler)
-		} else {
-			mux.Handle("/", wdHandler)
+		handler := fs.webdavAccess(wdHandler)
+		if fs.CACert != "" {
+			handler = fs.ClientCertMiddleware(handler)
+		}
+		if fs.basicAuthEnabled() {
+			handler = fs.basicAuth(handler, false)
 		}
+		if fs.Tokens != nil {
+			handler = fs.tokenMiddleware(handler, true)
+		}
+		mux.Handle("/", handler)
 		addr = net.JoinHostPort(fs.IP, strconv.Itoa(fs.WebdavPort))
+	case modeMetrics:
+		// IP Whitelist Middleware
+		mux.Use(fs.IPWhitelistMiddleware)
+
+		// Add custom server header middleware
+		mux.Use(fs.ServerHeaderMiddleware)
+
+		// The same credentials as for the web server, scrapers cannot log
+		// in with OIDC and need a token then
+		var handler http.Handler = http.HandlerFunc(fs.handleMetrics)
+		if fs.OIDC != nil && !fs.basicAuthEnabled() {
+			handler = requireMetricsToken(handler)
+		}
+		if fs.CACert != "" {
+			handler = fs.ClientCertMiddleware(handler)
+		}
+		if fs.basicAuthEnabled() {
+			handler = fs.basicAuth(handler, false)
+		}
+		if fs.Tokens != nil {
+			handler = fs.TokenMiddleware(handler)
+		}
+		mux.Handle("GET "+metricsPath, handler)
+		addr = net.JoinHostPort(fs.IP, strconv.Itoa(fs.MetricsPort))
 	default:
 	}
 
@@ -241,7 +417,6 @@ func (fs *FileServer) SetupMux(mux *CustomMux, what string) string {
 }
 
 func (fs *FileServer) StartListener(server *http.Server, what string, listener net.Listener) {
-	var err error
 	// Check if ssl
 	if fs.SSL {
 		// Check if selfsigned
@@ -275,7 +450,6 @@ func (fs *FileServer) StartListener(server *http.Server, what string, listener n
 				}
 			}
 
-			var cert tls.Certificate
 			var fingerprint256, fingerprint1 string
 
 			if fs.MyP12 != "" {
@@ -299,28 +473,31 @@ func (fs *FileServer) StartListener(server *http.Server, what string, listener n
 					logger.Fatalf("error parsing the p12 file: %+v", err)
 				}
 
-				cert = tls.Certificate{
+				cert := tls.Certificate{
 					Certificate: [][]byte{certificate.Raw},
 					PrivateKey:  privKey,
 					Leaf:        certificate,
 				}
 
 				fingerprint256, fingerprint1 = ca.Sum(certificate.Raw)
-			} else {
-				fingerprint256, fingerprint1, err = ca.ParseAndSum(fs.MyCert)
-				if err != nil {
-					logger.Fatalf("Unable to start SSL enabled server: %+v\n", err)
-				}
 
-				cert, err = tls.LoadX509KeyPair(fs.MyCert, fs.MyKey)
+				server.TLSConfig = &tls.Config{
+					Certificates: []tls.Certificate{cert},
+					MinVersion:   tls.VersionTLS12,
+				}
+			} else {
+				// Served from disk and reloaded when the files change
+				pair, err := ca.SharedKeyPair(fs.MyCert, fs.MyKey)
 				if err != nil {
 					logger.Fatalf("Failed to load provided key or certificate: %+v\n", err)
 				}
-			}
+				fingerprint256, fingerprint1 = ca.Sum(pair.Leaf().Raw)
+				pair.OnReload(func(leaf *x509.Certificate) {
+					fs.Fingerprint256, fs.Fingerprint1 = ca.Sum(leaf.Raw)
+					logger.Infof("%s now serves the certificate with SHA-256 fingerprint %s", what, fs.Fingerprint256)
+				})
 
-			server.TLSConfig = &tls.Config{
-				Certificates: []tls.Certificate{cert},
-				MinVersion:   tls.VersionTLS12,
+				server.TLSConfig = pair.TLSConfig()
 			}
 
 			// If client-cert auth add it to TLS Config of server
@@ -355,6 +532,26 @@ func (fs *FileServer) StartListener(server *http.Server, what string, listener n
 
 // Start will start the file server
 func (fs *FileServer) Start(what string) {
+	server, listener, err := fs.listen(what)
+	if err != nil {
+		logger.Fatalf("Error binding to listener: %+v", err)
+	}
+	fs.serve(server, what, listener)
+}
+
+// Listen binds the listener of what and serves it in the background. A
+// server that was shut down listens again, WebDAV is started and stopped
+// this way by the service registry.
+func (fs *FileServer) Listen(what string) error {
+	server, listener, err := fs.listen(what)
+	if err != nil {
+		return err
+	}
+	go fs.serve(server, what, listener)
+	return nil
+}
+
+func (fs *FileServer) listen(what string) (*http.Server, net.Listener, error) {
 	// Setup routing with gorilla/mux
 	mux := NewCustomMux()
 
@@ -363,13 +560,8 @@ func (fs *FileServer) Start(what string) {
 	// construct and bind listener
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
-		logger.Fatalf("Error binding to listener '%s': %+v", addr, err)
+		return nil, nil, err
 	}
-	defer func() {
-		if err := listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
-			logger.Errorf("error closing tcp listener: %+v", err)
-		}
-	}()
 
 	// construct server
 	server := &http.Server{
@@ -379,6 +571,15 @@ func (fs *FileServer) Start(what string) {
 		// Against good practice no timeouts here, otherwise big files would be terminated when downloaded
 	}
 	fs.httpServer = server
+	return server, listener, nil
+}
+
+func (fs *FileServer) serve(server *http.Server, what string, listener net.Listener) {
+	defer func() {
+		if err := listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			logger.Errorf("error closing tcp listener: %+v", err)
+		}
+	}()
 
 	// Print silent banner
 	if fs.Silent {
@@ -388,48 +589,43 @@ func (fs *FileServer) Start(what string) {
 	// Print all embedded files as info to the console
 	fs.PrintEmbeddedFiles()
 
-	// Start tunnel if enabled
-	if fs.Tunnel {
-		configDir, err := config.Dir()
-		if err != nil {
-			logger.Errorf("tunnel: cannot resolve config directory: %+v", err)
-		} else {
-			knownHostsFile := filepath.Join(configDir, "known_hosts")
-			t, err := tunnel.Start(fs.IP, fs.Port, knownHostsFile)
-			if err != nil {
-				var mismatch *tunnel.HostKeyMismatchError
-				if errors.As(err, &mismatch) {
-					logger.Fatalf("tunnel: %v", mismatch)
-				}
-				logger.Errorf("error starting tunnel: %+v", err)
-			} else {
-				defer t.Close()
-				logger.Infof("Public tunnel URL: %s", t.PublicURL)
-				fs.TunnelURL = t.PublicURL
-			}
+	// Start tunnel if enabled, the protocol servers share the one of the web server
+	if fs.Tunnel && what == modeWeb {
+		if t := fs.startTunnel(); t != nil {
+			defer fs.stopTunnel(t)
 		}
 	}
 
-	// Create SharedLinks map
-	fs.SharedLinks = make(map[string]SharedLink)
-
-	// Go routine to cleanup SharedLinks when expired
-	go func() {
-		ticker := time.NewTicker(1 * time.Minute)
-		defer ticker.Stop()
-		for range ticker.C {
-			now := time.Now()
-			fs.sharedLinksMu.Lock()
-			for token, link := range fs.SharedLinks {
-				if link.Expires.Before(now) {
-					delete(fs.SharedLinks, token)
-					logger.Debugf("Expired shared link removed: %s", token)
-				}
-			}
-			fs.sharedLinksMu.Unlock()
-		}
-	}()
+	// Create SharedLinks map, persisted links are loaded again
+	if err := fs.loadSharedLinks(); err != nil {
+		logger.Fatalf("error loading shared links: %+v", err)
+	}
+
+	// Go routine to cleanup SharedLinks when expired, once for all listens
+	fs.cleanupOnce.Do(func() { go fs.cleanupSharedLinks() })
 
 	// Start listener
 	fs.StartListener(server, what, listener)
 }
+
+// cleanupSharedLinks removes the expired shared links every minute.
+func (fs *FileServer) cleanupSharedLinks() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		fs.sharedLinksMu.Lock()
+		removed := false
+		for token, link := range fs.SharedLinks {
+			if link.Expires.Before(now) {
+				delete(fs.SharedLinks, token)
+				removed = true
+				logger.Debugf("Expired shared link removed: %s", token)
+			}
+		}
+		if removed {
+			fs.saveSharedLinksLocked()
+		}
+		fs.sharedLinksMu.Unlock()
+	}
+}
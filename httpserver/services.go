@@ -0,0 +1,87 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/service"
+)
+
+// serviceStopTimeout is how long a stop waits for the open connections of a
+// service before closing them.
+const serviceStopTimeout = 10 * time.Second
+
+// handleServicesAPI lists the protocol servers and starts, stops or
+// restarts them, a start or restart optionally on another port.
+func (fs *FileServer) handleServicesAPI(w http.ResponseWriter, req *http.Request, action string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if fs.Services == nil {
+		http.Error(w, `{"error":"services not available"}`, http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "status":
+		json.NewEncoder(w).Encode(fs.Services.Status())
+		return
+	case "start", "stop", "restart":
+	default:
+		http.Error(w, `{"error":"unknown action"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	if !fs.checkCSRF(w, req) {
+		return
+	}
+
+	name := req.URL.Query().Get("service")
+	port := 0
+	if p := req.URL.Query().Get("port"); p != "" && action != "stop" {
+		var err error
+		if port, err = strconv.Atoi(p); err != nil {
+			http.Error(w, `{"error":"invalid port"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// A stop outlives the request, the client might give up waiting
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), serviceStopTimeout)
+	defer cancel()
+
+	logger.Infof("[SERVICE] %s of %s requested by %s", action, name, logger.RequestUser(req))
+	var err error
+	switch action {
+	case "start":
+		err = fs.Services.Start(name, port)
+	case "stop":
+		err = fs.Services.Stop(ctx, name)
+	case "restart":
+		err = fs.Services.Restart(ctx, name, port)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, service.ErrUnknown):
+			status = http.StatusNotFound
+		case errors.Is(err, service.ErrRunning), errors.Is(err, service.ErrNotRunning):
+			status = http.StatusConflict
+		case errors.Is(err, service.ErrPortOutOfRange):
+			status = http.StatusBadRequest
+		}
+		logger.Errorf("[SERVICE] %s of %s failed: %+v", action, name, err)
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), status)
+		return
+	}
+	json.NewEncoder(w).Encode(fs.Services.Status())
+}
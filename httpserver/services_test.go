@@ -0,0 +1,73 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/service"
+)
+
+type testService struct {
+	listening bool
+}
+
+func (s *testService) Listen() error {
+	s.listening = true
+	return nil
+}
+
+func (s *testService) Shutdown(ctx context.Context) error {
+	s.listening = false
+	return nil
+}
+
+func TestServicesAPI(t *testing.T) {
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	t.Cleanup(cleanup)
+	fs.Options = &options.Options{}
+	mux := NewCustomMux()
+	_ = fs.SetupMux(mux, modeWeb)
+
+	call := func(method, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, "/?"+query, nil))
+		return w
+	}
+
+	// Without a registry there is nothing to control
+	require.Equal(t, http.StatusNotFound, call(http.MethodGet, "services-api=status").Code)
+
+	port := 445
+	smb := &testService{}
+	fs.Services = service.NewRegistry()
+	fs.Services.Register("smb", &port, smb)
+
+	w := call(http.MethodPost, "services-api=start&service=smb&port=4445")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, smb.listening)
+	require.Equal(t, 4445, port)
+
+	w = call(http.MethodGet, "services-api=status")
+	require.Equal(t, http.StatusOK, w.Code)
+	var status []service.Status
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	require.Len(t, status, 1)
+	require.Equal(t, "smb", status[0].Name)
+	require.True(t, status[0].Running)
+	require.Equal(t, 4445, status[0].Port)
+
+	require.Equal(t, http.StatusConflict, call(http.MethodPost, "services-api=start&service=smb").Code)
+	require.Equal(t, http.StatusMethodNotAllowed, call(http.MethodGet, "services-api=stop&service=smb").Code)
+	require.Equal(t, http.StatusOK, call(http.MethodPost, "services-api=stop&service=smb").Code)
+	require.False(t, smb.listening)
+
+	require.Equal(t, http.StatusNotFound, call(http.MethodPost, "services-api=start&service=dns").Code)
+	require.Equal(t, http.StatusBadRequest, call(http.MethodPost, "services-api=start&service=smb&port=http").Code)
+	require.Equal(t, http.StatusBadRequest, call(http.MethodPost, "services-api=start&service=smb&port=99999").Code)
+	require.Equal(t, http.StatusBadRequest, call(http.MethodPost, "services-api=toggle&service=smb").Code)
+}
@@ -0,0 +1,102 @@
+package httpserver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// cookieSigner keeps login state in cookies protected by an HMAC. The key
+// is new on every start, which logs everyone out on restart.
+type cookieSigner struct {
+	key []byte
+}
+
+func newCookieSigner() (cookieSigner, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return cookieSigner{}, err
+	}
+	return cookieSigner{key: key}, nil
+}
+
+// mac authenticates payload for the cookie name, so a value of one cookie
+// cannot be replayed as another.
+func (c cookieSigner) mac(name string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(name + "\x00"))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// sign encodes v as the value of the cookie name protected by an HMAC.
+func (c cookieSigner) sign(name string, v any) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(c.mac(name, payload)), nil
+}
+
+// verify decodes a value of the cookie name written by sign.
+func (c cookieSigner) verify(name, value string, v any) error {
+	p, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return errors.New("malformed cookie")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		return err
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(got, c.mac(name, payload)) {
+		return errors.New("invalid signature")
+	}
+	return json.Unmarshal(payload, v)
+}
+
+func (c cookieSigner) setCookie(w http.ResponseWriter, r *http.Request, name string, v any, lifetime time.Duration) error {
+	value, err := c.sign(name, v)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(lifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		// Lax so the cookies are sent on the redirect back from an issuer
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{Name: name, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+}
+
+// localPath returns target if it is a path on this server, otherwise "/".
+// Targets containing one of the login endpoints are replaced, too, so a
+// login never returns to itself.
+func localPath(target string, endpoints ...string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/"
+	}
+	for _, e := range endpoints {
+		if strings.Contains(target, e) {
+			return "/"
+		}
+	}
+	return target
+}
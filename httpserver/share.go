@@ -0,0 +1,400 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/utils"
+)
+
+// shareMaxDownloads is how many downloads are kept per link for the API.
+const shareMaxDownloads = 100
+
+// ShareDownload is one download of a shared link.
+type ShareDownload struct {
+	Time time.Time `json:"time"`
+	IP   string    `json:"ip"`
+	User string    `json:"user,omitempty"`
+}
+
+// loadSharedLinks reads the links persisted in ShareFile. Expired links are
+// dropped and the QR codes, which are not stored, are generated again.
+func (fs *FileServer) loadSharedLinks() error {
+	fs.sharedLinksMu.Lock()
+	defer fs.sharedLinksMu.Unlock()
+	fs.SharedLinks = make(map[string]SharedLink)
+	if fs.ShareFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(fs.ShareFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	links := map[string]SharedLink{}
+	if err := json.Unmarshal(data, &links); err != nil {
+		return fmt.Errorf("%s: %w", fs.ShareFile, err)
+	}
+	now := time.Now()
+	for token, link := range links {
+		if link.Expires.Before(now) {
+			continue
+		}
+		for i, e := range link.DownloadEntries {
+			link.DownloadEntries[i].QRCode = template.URL(GenerateQRCode(e.DownloadURL))
+		}
+		fs.SharedLinks[token] = link
+	}
+	logger.Infof("Loaded %d shared links from %s", len(fs.SharedLinks), fs.ShareFile)
+	return nil
+}
+
+// saveSharedLinksLocked persists the links to ShareFile. The caller holds
+// sharedLinksMu.
+func (fs *FileServer) saveSharedLinksLocked() {
+	if fs.ShareFile == "" {
+		return
+	}
+	if err := fs.writeSharedLinks(); err != nil {
+		logger.Errorf("error saving shared links: %+v", err)
+	}
+}
+
+func (fs *FileServer) writeSharedLinks() error {
+	data, err := json.MarshalIndent(fs.SharedLinks, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fs.ShareFile), ".goshs-shares-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fs.ShareFile)
+}
+
+// hashSharePassword returns the bcrypt hash stored for a link password.
+func hashSharePassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// checkShareNetworks validates the comma separated networks of a link.
+func checkShareNetworks(cidr string) error {
+	if cidr == "" {
+		return nil
+	}
+	_, err := NewIPWhitelist(cidr, true, "")
+	return err
+}
+
+// shareRestrictions reads the optional password and allowed networks of a
+// new link from the request.
+func (fs *FileServer) shareRestrictions(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	passwordHash, err := hashSharePassword(r.FormValue("password"))
+	if err != nil {
+		logger.Errorf("error hashing share password: %+v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return "", "", false
+	}
+	cidr := r.FormValue("cidr")
+	if err := checkShareNetworks(cidr); err != nil {
+		body := fs.emitCollabEvent(r, http.StatusBadRequest)
+		logger.LogRequest(r, http.StatusBadRequest, fs.verbose(), fs.Webhook, body)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", "", false
+	}
+	return passwordHash, cidr, true
+}
+
+// shareURLs returns the URLs of the link token for upath, one per address
+// the server listens on.
+func (fs *FileServer) shareURLs(upath, token string) ([]string, []DownloadEntry) {
+	var shareURLs []string
+	var downloadEntries []DownloadEntry
+	var err error
+
+	interfaceAdresses := make(map[string]string)
+	// Return share URL
+	if fs.IP == "0.0.0.0" {
+		interfaceAdresses, err = utils.GetAllIPAddresses()
+		if err != nil {
+			logger.Errorf("There has been an error fetching the interface addresses: %+v\n", err)
+		}
+	} else {
+		interfaceAdresses["0"] = "0.0.0.0"
+	}
+
+	protocol := "http://"
+	if fs.SSL {
+		protocol = "https://"
+	}
+
+	for _, ip := range interfaceAdresses {
+		if fs.Port != 80 && fs.Port != 443 {
+			url := fmt.Sprintf("%s%s:%d%s?token=%s", protocol, ip, fs.Port, upath, token)
+			shareURLs = append(shareURLs, url)
+			downloadEntry := DownloadEntry{
+				DownloadURL: url,
+				QRCode:      template.URL(GenerateQRCode(url)),
+			}
+			downloadEntries = append(downloadEntries, downloadEntry)
+		} else {
+			url := fmt.Sprintf("%s%s%s?token=%s", protocol, ip, upath, token)
+			shareURLs = append(shareURLs, url)
+			downloadEntry := DownloadEntry{
+				DownloadURL: url,
+				QRCode:      template.URL(GenerateQRCode(url)),
+			}
+			downloadEntries = append(downloadEntries, downloadEntry)
+		}
+	}
+	return shareURLs, downloadEntries
+}
+
+// shareAccess checks the network and password restrictions of link. Links
+// with a password are opened with basic auth and any user name.
+func (fs *FileServer) shareAccess(w http.ResponseWriter, r *http.Request, link SharedLink) bool {
+	if link.CIDR != "" {
+		clientIP := GetClientIP(r, fs.Whitelist)
+		wl, err := NewIPWhitelist(link.CIDR, true, "")
+		if err != nil || !wl.IsAllowed(clientIP) {
+			logger.Warnf("[SHARE] Access denied for IP: %s", clientIP)
+			http.Error(w, "Access Denied", http.StatusForbidden)
+			return false
+		}
+	}
+
+	if link.PasswordHash == "" {
+		return true
+	}
+	clientIP := failureAddr(r)
+	if fs.authLocked(clientIP) {
+		http.Error(w, "Too many failed attempts", http.StatusTooManyRequests)
+		return false
+	}
+	_, password, ok := r.BasicAuth()
+	if ok && checkPasswordHash(password, link.PasswordHash) {
+		fs.authSucceeded(clientIP)
+		return true
+	}
+	if ok {
+		fs.authFailed(clientIP)
+		logDenied(r, eventAuthFailure, http.StatusUnauthorized, "", "[AUTH] wrong password for a shared link from %s", clientIP)
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="Shared link"`)
+	http.Error(w, "Not authorized", http.StatusUnauthorized)
+	return false
+}
+
+// shareDownloadOf describes the download of r for the link history.
+func (fs *FileServer) shareDownloadOf(r *http.Request) ShareDownload {
+	d := ShareDownload{Time: time.Now().UTC().Truncate(time.Second), IP: GetClientIP(r, fs.Whitelist)}
+	if a := namedAccount(r); a != nil {
+		d.User = a.Name
+	} else if username, _, ok := r.BasicAuth(); ok {
+		d.User = username
+	}
+	return d
+}
+
+// shareInfo is a shared link as returned by the share API.
+type shareInfo struct {
+	Link          string          `json:"link"`
+	Path          string          `json:"path"`
+	IsDir         bool            `json:"is_dir"`
+	Owner         string          `json:"owner,omitempty"`
+	Created       time.Time       `json:"created,omitzero"`
+	Expires       time.Time       `json:"expires"`
+	DownloadLimit int             `json:"download_limit"` // -1 is unlimited
+	Downloaded    int             `json:"downloaded"`
+	Password      bool            `json:"password"`
+	CIDR          string          `json:"cidr,omitempty"`
+	Upload        bool            `json:"upload,omitempty"` // upload request
+	MaxFiles      int             `json:"max_files,omitempty"`
+	MaxSize       int64           `json:"max_size,omitempty"`
+	Uploaded      int             `json:"uploaded,omitempty"`
+	URLs          []string        `json:"urls"`
+	Downloads     []ShareDownload `json:"downloads,omitempty"` // uploads for upload requests
+}
+
+func newShareInfo(token string, link SharedLink, details bool) shareInfo {
+	info := shareInfo{
+		Link:          token,
+		Path:          link.FilePath,
+		IsDir:         link.IsDir,
+		Owner:         link.Owner,
+		Created:       link.Created,
+		Expires:       link.Expires,
+		DownloadLimit: link.DownloadLimit,
+		Downloaded:    link.Downloaded,
+		Password:      link.PasswordHash != "",
+		CIDR:          link.CIDR,
+		Upload:        link.Upload,
+		MaxFiles:      link.MaxFiles,
+		MaxSize:       link.MaxSize,
+		Uploaded:      link.Uploaded,
+		URLs:          []string{},
+	}
+	for _, e := range link.DownloadEntries {
+		info.URLs = append(info.URLs, e.DownloadURL)
+	}
+	if details {
+		info.Downloads = link.Downloads
+	}
+	return info
+}
+
+// handleShareAPI lists, inspects, extends and revokes shared links. Admins
+// see every link, other accounts their own.
+func (fs *FileServer) handleShareAPI(w http.ResponseWriter, req *http.Request, action string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch action {
+	case "list":
+		links := fs.visibleSharedLinks(req)
+		list := make([]shareInfo, 0, len(links))
+		for _, token := range slices.Sorted(maps.Keys(links)) {
+			list = append(list, newShareInfo(token, links[token], false))
+		}
+		json.NewEncoder(w).Encode(list)
+
+	case "get":
+		token := req.URL.Query().Get("link")
+		link, ok := fs.visibleSharedLinks(req)[token]
+		if !ok {
+			http.Error(w, `{"error":"link not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(newShareInfo(token, link, true))
+
+	case "extend":
+		if req.Method != http.MethodPost {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		if !fs.checkCSRF(w, req) {
+			return
+		}
+		var body struct {
+			Link     string  `json:"link"`
+			Expires  int     `json:"expires"` // seconds from now, 0 keeps the expiry
+			Limit    *int    `json:"limit"`   // downloads, -1 is unlimited
+			Files    *int    `json:"files"`   // upload requests only
+			Size     *int64  `json:"size"`    // upload requests only, per file
+			Password *string `json:"password"`
+			CIDR     *string `json:"cidr"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			return
+		}
+		if body.Expires < 0 || (body.Limit != nil && *body.Limit < -1) || (body.Files != nil && *body.Files <= 0) || (body.Size != nil && *body.Size < 0) {
+			http.Error(w, `{"error":"expires, limit, files and size must not be negative"}`, http.StatusBadRequest)
+			return
+		}
+		var passwordHash string
+		if body.Password != nil {
+			hash, err := hashSharePassword(*body.Password)
+			if err != nil {
+				http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+				return
+			}
+			passwordHash = hash
+		}
+		if body.CIDR != nil {
+			if err := checkShareNetworks(*body.CIDR); err != nil {
+				http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+				return
+			}
+		}
+
+		fs.sharedLinksMu.Lock()
+		link, ok := fs.SharedLinks[body.Link]
+		if !ok || !fs.ownsLink(req, link) {
+			fs.sharedLinksMu.Unlock()
+			http.Error(w, `{"error":"link not found"}`, http.StatusNotFound)
+			return
+		}
+		if body.Expires > 0 {
+			link.Expires = time.Now().Add(time.Duration(body.Expires) * time.Second)
+		}
+		if body.Limit != nil {
+			link.DownloadLimit = *body.Limit
+		}
+		if link.Upload && body.Files != nil {
+			link.MaxFiles = *body.Files
+		}
+		if link.Upload && body.Size != nil {
+			link.MaxSize = *body.Size
+		}
+		if body.Password != nil {
+			link.PasswordHash = passwordHash
+		}
+		if body.CIDR != nil {
+			link.CIDR = *body.CIDR
+		}
+		fs.SharedLinks[body.Link] = link
+		fs.saveSharedLinksLocked()
+		fs.sharedLinksMu.Unlock()
+
+		logger.Infof("[SHARE] link for %s changed, expires %s", link.FilePath, link.Expires.Format(time.DateTime))
+		json.NewEncoder(w).Encode(newShareInfo(body.Link, link, true))
+
+	case "revoke":
+		if req.Method != http.MethodPost && req.Method != http.MethodDelete {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		if !fs.checkCSRF(w, req) {
+			return
+		}
+		if !fs.revokeSharedLink(req, req.URL.Query().Get("link")) {
+			http.Error(w, `{"error":"link not found"}`, http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, `{"error":"unknown action"}`, http.StatusBadRequest)
+	}
+}
+
+// revokeSharedLink deletes the link token if the request owns it.
+func (fs *FileServer) revokeSharedLink(req *http.Request, token string) bool {
+	fs.sharedLinksMu.Lock()
+	defer fs.sharedLinksMu.Unlock()
+	link, ok := fs.SharedLinks[token]
+	if !ok || !fs.ownsLink(req, link) {
+		return false
+	}
+	delete(fs.SharedLinks, token)
+	fs.saveSharedLinksLocked()
+	logger.Infof("[SHARE] link for %s revoked", link.FilePath)
+	return true
+}
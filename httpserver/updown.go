@@ -5,41 +5,46 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"goshs.de/goshs/v2/acl"
 	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/metrics"
 )
 
-// prepareWrite enforces the ACL for dir and applies the upload size limit.
-// Returns false if the request has already been rejected.
-func (fs *FileServer) prepareWrite(w http.ResponseWriter, req *http.Request, dir string) bool {
-	acl, aclErr := fs.findEffectiveACL(dir)
+// prepareWrite enforces the ACL credentials for dir and applies the upload
+// size limit. It returns the effective ACL for checking the uploaded files,
+// and false if the request has already been rejected.
+func (fs *FileServer) prepareWrite(w http.ResponseWriter, req *http.Request, dir string) (configFile, bool) {
+	config, aclErr := fs.findEffectiveACL(dir)
 	if aclErr != nil {
 		logger.Errorf("error reading file based access config: %+v", aclErr)
 	}
-	if ok := fs.applyCustomAuth(w, req, acl); !ok {
-		return false
+	if ok := fs.applyCustomAuth(w, req, config); !ok {
+		return config, false
 	}
-	if fs.MaxUpload > 0 {
-		req.Body = http.MaxBytesReader(w, req.Body, fs.MaxUpload)
+	if limit := fs.maxUpload(); limit > 0 {
+		req.Body = http.MaxBytesReader(w, req.Body, limit)
 	}
-	return true
+	return config, true
 }
 
 // put handles the PUT request to upload files
 func (fs *FileServer) put(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
 	if !fs.checkCSRF(w, req) {
 		return
 	}
-	if fs.ReadOnly {
+	if fs.readOnly(req) {
 		fs.handleError(w, req, fmt.Errorf("%s", "Upload not allowed due to 'read only' option"), http.StatusForbidden)
 		return
 	}
-	savepath, err := sanitizePath(fs.UploadFolder, req.URL.Path)
+	savepath, err := sanitizePath(fs.uploadRoot(req), req.URL.Path)
 	if err != nil {
 		fs.handleError(w, req, err, http.StatusBadRequest)
 		return
@@ -52,7 +57,15 @@ func (fs *FileServer) put(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// Enforce .goshs ACL and upload size limit
-	if !fs.prepareWrite(w, req, filepath.Dir(savepath)) {
+	config, ok := fs.prepareWrite(w, req, filepath.Dir(savepath))
+	if !ok {
+		return
+	}
+	if config.Blocked(filepath.Base(savepath), false) {
+		fs.handleError(w, req, fmt.Errorf("cannot upload blocked file"), http.StatusForbidden)
+		return
+	}
+	if !fs.applyACLRules(w, req, config, acl.Upload, savepath, false) {
 		return
 	}
 
@@ -65,12 +78,13 @@ func (fs *FileServer) put(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if _, err := io.Copy(osFile, req.Body); err != nil {
+	written, err := io.Copy(osFile, req.Body)
+	if err != nil {
 		osFile.Close()
 		os.Remove(savepath)
 		var maxErr *http.MaxBytesError
 		if errors.As(err, &maxErr) {
-			fs.handleError(w, req, fmt.Errorf("upload exceeds size limit (%d bytes)", fs.MaxUpload), http.StatusRequestEntityTooLarge)
+			fs.handleError(w, req, fmt.Errorf("upload exceeds size limit (%d bytes)", fs.maxUpload()), http.StatusRequestEntityTooLarge)
 		} else {
 			logger.Errorf("Error writing file %s to disk: %+v", savepath, err)
 			fs.handleError(w, req, err, http.StatusInternalServerError)
@@ -78,34 +92,42 @@ func (fs *FileServer) put(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	osFile.Close()
+	metrics.Uploads.Inc("http")
+	metrics.UploadBytes.Add(float64(written), "http")
+	metrics.UploadDuration.Observe(time.Since(start).Seconds())
 
 	// Log request
 	_ = fs.emitCollabEvent(req, http.StatusOK)
-	logger.LogRequest(req, http.StatusOK, fs.Verbose, fs.Webhook, nil)
+	logger.LogRequest(req, http.StatusOK, fs.verbose(), fs.Webhook, nil)
 }
 
 // upload handles the POST request to upload files
 func (fs *FileServer) upload(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
 	if !fs.checkCSRF(w, req) {
 		return
 	}
-	if fs.ReadOnly {
+	if fs.readOnly(req) {
 		fs.handleError(w, req, fmt.Errorf("%s", "Upload not allowed due to 'read only' option"), http.StatusForbidden)
 		return
 	}
 	// Derive and sanitize the target directory (strip trailing "/upload" from URL).
 	upathDir := strings.TrimSuffix(req.URL.Path, "/upload")
-	targetDir, err := sanitizePath(fs.UploadFolder, upathDir)
+	targetDir, err := sanitizePath(fs.uploadRoot(req), upathDir)
 	if err != nil {
 		fs.handleError(w, req, err, http.StatusBadRequest)
 		return
 	}
 
 	// Enforce .goshs ACL and upload size limit
-	if !fs.prepareWrite(w, req, targetDir) {
+	config, ok := fs.prepareWrite(w, req, targetDir)
+	if !ok {
 		return
 	}
 
+	// Upload request links limit the number and size of files
+	request := uploadRequestFromContext(req)
+
 	reader, err := req.MultipartReader()
 	if err != nil {
 		logger.Errorf("reading multipart request: %+v", err)
@@ -120,7 +142,7 @@ func (fs *FileServer) upload(w http.ResponseWriter, req *http.Request) {
 		if err != nil {
 			var maxErr *http.MaxBytesError
 			if errors.As(err, &maxErr) {
-				fs.handleError(w, req, fmt.Errorf("upload exceeds size limit (%d bytes)", fs.MaxUpload), http.StatusRequestEntityTooLarge)
+				fs.handleError(w, req, fmt.Errorf("upload exceeds size limit (%d bytes)", fs.maxUpload()), http.StatusRequestEntityTooLarge)
 			} else {
 				logger.Errorf("reading multipart part: %+v", err)
 			}
@@ -144,78 +166,132 @@ func (fs *FileServer) upload(w http.ResponseWriter, req *http.Request) {
 		finalPath := filepath.Join(targetDir, filenameClean)
 		tempPath := finalPath + "~"
 
-		// Create temp file
-		dst, err := os.Create(tempPath)
-		if err != nil {
-			logger.Errorf("creating temp file: %+v", err)
-			return
+		// Skip files blocked or denied by the .goshs ACL
+		if config.Blocked(filenameClean, false) || !fs.aclAllowed(req, config, acl.Upload, finalPath, false) {
+			logger.Warnf("[ACL] upload of %s denied", finalPath)
+			continue
 		}
-
-		// Write in chunks
-		buf := make([]byte, chunkSize)
-		var totalWritten int64
-		for {
-			n, readErr := part.Read(buf)
-			if n > 0 {
-				written, writeErr := dst.Write(buf[:n])
-				if writeErr != nil || written != n {
-					dst.Close()
-					os.Remove(tempPath)
-					logger.Errorf("writing file to disk: %+v", writeErr)
-					return
-				}
-				totalWritten += int64(written)
-			}
-			if readErr == io.EOF {
-				break
+		// Upload requests take a file from the link before writing it and
+		// never replace existing files
+		if request != nil {
+			if !fs.reserveUpload(request.token) {
+				logger.Warnf("[SHARE] upload request for %s takes no more files, %s skipped", request.path, filenameClean)
+				continue
 			}
-			if readErr != nil {
-				dst.Close()
-				os.Remove(tempPath)
-				var maxErr *http.MaxBytesError
-				if errors.As(readErr, &maxErr) {
-					fs.handleError(w, req, fmt.Errorf("upload exceeds size limit (%d bytes)", fs.MaxUpload), http.StatusRequestEntityTooLarge)
-				} else {
-					logger.Errorf("reading uploaded data: %+v", readErr)
-				}
+			if finalPath, err = createUnique(finalPath); err != nil {
+				fs.releaseUpload(request.token, false)
+				logger.Errorf("creating file: %+v", err)
 				return
 			}
+			tempPath = finalPath + "~"
 		}
 
-		// Ensure file is flushed and closed
-		if err := dst.Sync(); err != nil {
-			dst.Close()
-			os.Remove(tempPath)
-			logger.Errorf("syncing file: %+v", err)
-			return
+		totalWritten, ok := fs.writeUpload(w, req, part, tempPath, request)
+		if ok {
+			// Atomically rename to final path
+			if err := os.Rename(tempPath, finalPath); err != nil {
+				logger.Errorf("renaming file: %+v", err)
+				ok = false
+			}
 		}
-		if err := dst.Close(); err != nil {
-			os.Remove(tempPath)
-			logger.Errorf("closing file: %+v", err)
+		if request != nil {
+			if !ok {
+				os.Remove(finalPath)
+			}
+			fs.releaseUpload(request.token, ok)
+		}
+		if !ok {
 			return
 		}
 
-		// Atomically rename to final path
-		if err := os.Rename(tempPath, finalPath); err != nil {
-			logger.Errorf("renaming file: %+v", err)
-			return
+		if request != nil {
+			request.files++
 		}
+		metrics.Uploads.Inc("http")
+		metrics.UploadBytes.Add(float64(totalWritten), "http")
 
 		// Webhook
-		logger.HandleWebhookSend(fmt.Sprintf("[WEB] File uploaded: %s", finalPath), "upload", fs.Webhook)
+		fs.notify(req, "upload", finalPath, fmt.Sprintf("[WEB] File uploaded: %s%s", finalPath, byToken(req)))
 	}
 
+	metrics.UploadDuration.Observe(time.Since(start).Seconds())
+
 	// Log request
 	body := fs.emitCollabEvent(req, http.StatusOK)
-	logger.LogRequest(req, http.StatusOK, fs.Verbose, fs.Webhook, body)
+	logger.LogRequest(req, http.StatusOK, fs.verbose(), fs.Webhook, body)
 
 	// Redirect back from where we came from
+	if request != nil {
+		upathDir = "/?token=" + request.token
+	}
 	http.Redirect(w, req, upathDir, http.StatusSeeOther)
 }
 
+// writeUpload writes part to tempPath. It returns false if that failed, the
+// error is answered already where the client has to know about it.
+func (fs *FileServer) writeUpload(w http.ResponseWriter, req *http.Request, part *multipart.Part, tempPath string, request *uploadRequest) (int64, bool) {
+	// Create temp file
+	dst, err := os.Create(tempPath)
+	if err != nil {
+		logger.Errorf("creating temp file: %+v", err)
+		return 0, false
+	}
+
+	// Write in chunks
+	buf := make([]byte, chunkSize)
+	var totalWritten int64
+	for {
+		n, readErr := part.Read(buf)
+		if n > 0 {
+			written, writeErr := dst.Write(buf[:n])
+			if writeErr != nil || written != n {
+				dst.Close()
+				os.Remove(tempPath)
+				logger.Errorf("writing file to disk: %+v", writeErr)
+				return 0, false
+			}
+			totalWritten += int64(written)
+			if request != nil && request.maxSize > 0 && totalWritten > request.maxSize {
+				dst.Close()
+				os.Remove(tempPath)
+				fs.handleError(w, req, fmt.Errorf("upload exceeds size limit of the upload request (%d bytes)", request.maxSize), http.StatusRequestEntityTooLarge)
+				return 0, false
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			dst.Close()
+			os.Remove(tempPath)
+			var maxErr *http.MaxBytesError
+			if errors.As(readErr, &maxErr) {
+				fs.handleError(w, req, fmt.Errorf("upload exceeds size limit (%d bytes)", fs.maxUpload()), http.StatusRequestEntityTooLarge)
+			} else {
+				logger.Errorf("reading uploaded data: %+v", readErr)
+			}
+			return 0, false
+		}
+	}
+
+	// Ensure file is flushed and closed
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		os.Remove(tempPath)
+		logger.Errorf("syncing file: %+v", err)
+		return 0, false
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tempPath)
+		logger.Errorf("closing file: %+v", err)
+		return 0, false
+	}
+	return totalWritten, true
+}
+
 // bulkDownload will provide zip archived download bundle of multiple selected files
 func (fs *FileServer) bulkDownload(w http.ResponseWriter, req *http.Request) {
-	if fs.UploadOnly {
+	if fs.uploadOnly(req) {
 		fs.handleError(w, req, fmt.Errorf("%s", "Bulk download not allowed due to 'upload only' option"), http.StatusForbidden)
 		return
 	}
@@ -230,11 +306,15 @@ func (fs *FileServer) bulkDownload(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// Validate each path and collect absolute paths; skip any traversal attempts
+	root := fs.root(req)
 	for _, file := range files {
-		absPath, err := sanitizePath(fs.Webroot, file)
+		absPath, err := sanitizePath(root, file)
 		if err != nil {
 			continue
 		}
+		if stat, err := os.Stat(absPath); err != nil || !fs.readableByACL(req, root, absPath, stat.IsDir()) {
+			continue
+		}
 		filesCleaned = append(filesCleaned, absPath)
 	}
 
@@ -253,11 +333,19 @@ func (fs *FileServer) bulkDownload(w http.ResponseWriter, req *http.Request) {
 	defer resultZip.Close()
 
 	// Path walker for recursion
+	// The walker parameter shadows the package
+	skipDir := filepath.SkipDir
 	walker := func(filepath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 		if info.IsDir() {
+			if !fs.readableByACL(req, root, filepath, true) {
+				return skipDir
+			}
+			return nil
+		}
+		if !fs.readableByACL(req, root, filepath, false) {
 			return nil
 		}
 
@@ -271,11 +359,11 @@ func (fs *FileServer) bulkDownload(w http.ResponseWriter, req *http.Request) {
 		// #nosec G307
 		defer file.Close()
 
-		// filepath is fs.Webroot + file relative path
+		// filepath is root + file relative path
 		// this would result in a lot of nested folders
-		// so we are stripping fs.Webroot again from the structure of the zip file
+		// so we are stripping root again from the structure of the zip file
 		// Leaving us with the relative path of the file
-		zippath := strings.ReplaceAll(filepath, fs.Webroot, "")
+		zippath := strings.ReplaceAll(filepath, root, "")
 		header := &zip.FileHeader{
 			Name:     zippath[1:],
 			Method:   zip.Deflate,
@@ -307,6 +395,6 @@ func (fs *FileServer) bulkDownload(w http.ResponseWriter, req *http.Request) {
 		logger.Error(err)
 	} else {
 		body := fs.emitCollabEvent(req, http.StatusOK)
-		logger.LogRequest(req, http.StatusOK, fs.Verbose, fs.Webhook, body)
+		logger.LogRequest(req, http.StatusOK, fs.verbose(), fs.Webhook, body)
 	}
 }
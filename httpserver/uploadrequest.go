@@ -0,0 +1,274 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/users"
+	"goshs.de/goshs/v2/utils"
+)
+
+// uploadRequestFiles is the default number of files an upload request takes.
+const uploadRequestFiles = 10
+
+type uploadRequestKey struct{}
+
+// uploadRequest limits one upload through an upload request link.
+type uploadRequest struct {
+	token   string
+	path    string
+	maxSize int64 // per file, 0 is only limited by -mu
+	files   int   // files written by this request
+}
+
+func uploadRequestFromContext(r *http.Request) *uploadRequest {
+	u, _ := r.Context().Value(uploadRequestKey{}).(*uploadRequest)
+	return u
+}
+
+// CreateUploadRequestHandler creates a link anyone holding it can upload
+// files into the requested folder with, like ?share does for downloads.
+func (fs *FileServer) CreateUploadRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if !fs.authEnabled() {
+		body := fs.emitCollabEvent(r, http.StatusForbidden)
+		logger.LogRequest(r, http.StatusForbidden, fs.verbose(), fs.Webhook, body)
+		http.Error(w, "Upload requests disabled when auth is disabled", http.StatusForbidden)
+		return
+	}
+	if fs.readOnly(r) {
+		body := fs.emitCollabEvent(r, http.StatusForbidden)
+		logger.LogRequest(r, http.StatusForbidden, fs.verbose(), fs.Webhook, body)
+		http.Error(w, "Upload requests not allowed due to 'read only' option", http.StatusForbidden)
+		return
+	}
+
+	root := fs.uploadRoot(r)
+	fpath, err := sanitizePath(root, r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	if stat, err := os.Stat(fpath); err != nil || !stat.IsDir() {
+		http.Error(w, "Upload requests need an existing folder", http.StatusBadRequest)
+		return
+	}
+	upath := strings.TrimPrefix(fpath, filepath.Clean(root))
+	if upath == "" {
+		upath = "/"
+	}
+
+	q := r.URL.Query()
+	seconds, maxFiles, maxSize := 3600, uploadRequestFiles, int64(0)
+	if v := q.Get("expires"); v != "" {
+		if seconds, err = strconv.Atoi(v); err != nil || seconds <= 0 {
+			http.Error(w, "expires needs to be a positive integer in seconds", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("files"); v != "" {
+		if maxFiles, err = strconv.Atoi(v); err != nil || maxFiles <= 0 {
+			http.Error(w, "files needs to be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("size"); v != "" {
+		if maxSize, err = strconv.ParseInt(v, 10, 64); err != nil || maxSize < 0 {
+			http.Error(w, "size needs to be an integer in bytes", http.StatusBadRequest)
+			return
+		}
+	}
+	passwordHash, cidr, ok := fs.shareRestrictions(w, r)
+	if !ok {
+		return
+	}
+
+	token := GenerateToken()
+	shareURLs, downloadEntries := fs.shareURLs(upath, token)
+	now := time.Now()
+	link := SharedLink{
+		FilePath:        upath,
+		IsDir:           true,
+		Created:         now.UTC().Truncate(time.Second),
+		Expires:         now.Add(time.Duration(seconds) * time.Second),
+		Upload:          true,
+		MaxFiles:        maxFiles,
+		MaxSize:         maxSize,
+		PasswordHash:    passwordHash,
+		CIDR:            cidr,
+		DownloadEntries: downloadEntries,
+	}
+	if a := namedAccount(r); a != nil {
+		link.Owner = a.Name
+	}
+
+	fs.sharedLinksMu.Lock()
+	fs.SharedLinks[token] = link
+	fs.saveSharedLinksLocked()
+	fs.sharedLinksMu.Unlock()
+
+	body := fs.emitCollabEvent(r, http.StatusOK)
+	logger.LogRequest(r, http.StatusOK, fs.verbose(), fs.Webhook, body)
+	logger.Debugf("An upload request was created for %s", upath)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string][]string{"urls": shareURLs}); err != nil {
+		logger.Error(err)
+	}
+}
+
+type uploadRequestPage struct {
+	GoshsVersion string
+	Action       string
+	Folder       string
+	Remaining    int
+	MaxSize      string
+	Expires      string
+}
+
+// renderUploadRequest shows the minimal upload page of an upload request.
+// It carries its own styles, the static files need authentication.
+func (fs *FileServer) renderUploadRequest(w http.ResponseWriter, token string, link SharedLink) {
+	p := uploadRequestPage{
+		GoshsVersion: fs.Version,
+		Action:       "/upload?token=" + token,
+		Folder:       filepath.Base(link.FilePath),
+		Remaining:    link.MaxFiles - link.Uploaded,
+		Expires:      link.Expires.Format(time.DateTime),
+	}
+	if link.MaxSize > 0 {
+		p.MaxSize = utils.ByteCountDecimal(link.MaxSize)
+	}
+	t, err := template.ParseFS(static, "static/templates/upload-request.html")
+	if err != nil {
+		logger.Errorf("Error parsing templates: %+v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := t.Execute(w, p); err != nil {
+		logger.Errorf("executing the template: %+v", err)
+	}
+}
+
+// uploadRequestUpload writes the files posted to an upload request link
+// through the regular upload into the folder of the link.
+func (fs *FileServer) uploadRequestUpload(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	fs.sharedLinksMu.RLock()
+	link, ok := fs.SharedLinks[token]
+	fs.sharedLinksMu.RUnlock()
+	if !ok || !link.Upload || time.Now().After(link.Expires) || link.Uploaded >= link.MaxFiles {
+		http.NotFound(w, r)
+		return
+	}
+	if !fs.shareAccess(w, r, link) {
+		return
+	}
+
+	uploader := fs.shareDownloadOf(r)
+
+	// Upload as the account that created the link
+	ctx := r.Context()
+	if link.Owner != "" && fs.Users != nil {
+		owner := fs.Users.Lookup(link.Owner)
+		if owner == nil {
+			http.NotFound(w, r)
+			return
+		}
+		ctx = users.NewContext(ctx, owner)
+	}
+	u := &uploadRequest{
+		token:   token,
+		path:    link.FilePath,
+		maxSize: link.MaxSize,
+	}
+	r = r.WithContext(context.WithValue(ctx, uploadRequestKey{}, u))
+	target := *r.URL
+	target.Path = strings.TrimSuffix(link.FilePath, "/") + "/upload"
+	r.URL = &target
+	fs.upload(w, r)
+
+	if u.files == 0 {
+		return
+	}
+	fs.sharedLinksMu.Lock()
+	if current, exists := fs.SharedLinks[token]; exists {
+		current.Downloads = append(current.Downloads, uploader)
+		if len(current.Downloads) > shareMaxDownloads {
+			current.Downloads = current.Downloads[len(current.Downloads)-shareMaxDownloads:]
+		}
+		if current.Uploaded >= current.MaxFiles {
+			delete(fs.SharedLinks, token)
+			logger.Infof("[SHARE] upload request for %s received all %d files", current.FilePath, current.MaxFiles)
+		} else {
+			fs.SharedLinks[token] = current
+		}
+		fs.saveSharedLinksLocked()
+	}
+	fs.sharedLinksMu.Unlock()
+}
+
+// reserveUpload takes one of the files the upload request link token still
+// accepts before it is written, so that concurrent uploads cannot exceed
+// MaxFiles together.
+func (fs *FileServer) reserveUpload(token string) bool {
+	fs.sharedLinksMu.Lock()
+	defer fs.sharedLinksMu.Unlock()
+	link, ok := fs.SharedLinks[token]
+	if !ok || time.Now().After(link.Expires) || link.Uploaded+link.reserved >= link.MaxFiles {
+		return false
+	}
+	link.reserved++
+	fs.SharedLinks[token] = link
+	return true
+}
+
+// releaseUpload gives back a file taken with reserveUpload. It counts as
+// uploaded if written is true.
+func (fs *FileServer) releaseUpload(token string, written bool) {
+	fs.sharedLinksMu.Lock()
+	defer fs.sharedLinksMu.Unlock()
+	link, ok := fs.SharedLinks[token]
+	if !ok {
+		return
+	}
+	link.reserved--
+	if written {
+		link.Uploaded++
+	}
+	fs.SharedLinks[token] = link
+}
+
+// createUnique creates an empty file at path, or at "name (n).ext" if path
+// is taken, and returns the path it created. Upload requests write into it
+// so that they never replace existing files.
+func createUnique(path string) (string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 0; n < 1000; n++ {
+		candidate := path
+		if n > 0 {
+			candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+		}
+		// #nosec G304
+		f, err := os.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return candidate, f.Close()
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no free file name for %s", path)
+}
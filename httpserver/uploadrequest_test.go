@@ -0,0 +1,201 @@
+package httpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func postFiles(t *testing.T, h http.Handler, target string, files map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for name, content := range files {
+		part, err := mw.CreateFormFile("files", name)
+		require.NoError(t, err)
+		_, err = part.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+	r := httptest.NewRequest(http.MethodPost, target, body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestUploadRequest(t *testing.T) {
+	fs := newShareFileServer(t)
+	require.NoError(t, os.Mkdir(filepath.Join(fs.Webroot, "drop"), 0o755))
+	mux := NewCustomMux()
+	_ = fs.SetupMux(mux, modeWeb)
+
+	admin := func(target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.SetBasicAuth("admin", "pw")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusBadRequest, admin("/loot.txt?upload-request").Code)
+	require.Equal(t, http.StatusBadRequest, admin("/drop/?upload-request&files=0").Code)
+
+	w := admin("/drop/?upload-request&files=2&size=10")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp map[string][]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.NotEmpty(t, resp["urls"])
+	token, link := shareLink(t, fs)
+	require.True(t, link.Upload)
+	require.Equal(t, "/drop", link.FilePath)
+	require.Equal(t, 2, link.MaxFiles)
+	require.Equal(t, int64(10), link.MaxSize)
+
+	// The listing shows the request next to the shares
+	w = admin("/")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "Upload request: 0 / 2 files")
+
+	// Anyone with the link gets the upload page but no files
+	r := httptest.NewRequest(http.MethodGet, "/drop?token="+token, nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `action="/upload?token=`+token+`"`)
+	require.NotContains(t, w.Body.String(), "loot.txt")
+
+	// Files land in the folder of the link, whatever path is posted to
+	w = postFiles(t, mux, "/elsewhere/upload?token="+token, map[string]string{"../a.txt": "a"})
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/?token="+token, w.Header().Get("Location"))
+	data, err := os.ReadFile(filepath.Join(fs.Webroot, "drop", "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "a", string(data))
+	require.Equal(t, 1, fs.SharedLinks[token].Uploaded)
+	require.Len(t, fs.SharedLinks[token].Downloads, 1)
+
+	w = postFiles(t, mux, "/upload?token="+token, map[string]string{"big.txt": "0123456789x"})
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	require.NoFileExists(t, filepath.Join(fs.Webroot, "drop", "big.txt"))
+	require.Equal(t, 1, fs.SharedLinks[token].Uploaded)
+
+	// The last file uses the link up
+	w = postFiles(t, mux, "/upload?token="+token, map[string]string{"b.txt": "b"})
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.FileExists(t, filepath.Join(fs.Webroot, "drop", "b.txt"))
+	require.Empty(t, fs.SharedLinks)
+	w = postFiles(t, mux, "/upload?token="+token, map[string]string{"c.txt": "c"})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.NoFileExists(t, filepath.Join(fs.Webroot, "drop", "c.txt"))
+}
+
+func TestUploadRequest_FileLimit(t *testing.T) {
+	fs := newShareFileServer(t)
+	fs.SharedLinks["drop"] = SharedLink{FilePath: "/", IsDir: true, Upload: true, MaxFiles: 1, Expires: time.Now().Add(time.Hour)}
+	mux := NewCustomMux()
+	_ = fs.SetupMux(mux, modeWeb)
+
+	w := postFiles(t, mux, "/upload?token=drop", map[string]string{"a.txt": "a", "b.txt": "b"})
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	entries, err := os.ReadDir(fs.Webroot)
+	require.NoError(t, err)
+	require.Len(t, entries, 2) // loot.txt and one of the uploads
+	require.Empty(t, fs.SharedLinks)
+
+	// Download links take no uploads
+	fs.SharedLinks["get"] = SharedLink{FilePath: "/loot.txt", DownloadLimit: 1, Expires: time.Now().Add(time.Hour)}
+	w = postFiles(t, mux, "/upload?token=get", map[string]string{"x.txt": "x"})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.NoFileExists(t, filepath.Join(fs.Webroot, "x.txt"))
+}
+
+func TestUploadRequest_OnlyWebUI(t *testing.T) {
+	fs := newShareFileServer(t)
+	fs.Metrics = true
+	fs.SharedLinks["drop"] = SharedLink{FilePath: "/", IsDir: true, Upload: true, MaxFiles: 3, Expires: time.Now().Add(time.Hour)}
+
+	// The token does not open the WebDAV listener
+	dav := NewCustomMux()
+	_ = fs.SetupMux(dav, "webdav")
+	for _, method := range []string{http.MethodPut, "PROPFIND", http.MethodGet} {
+		r := httptest.NewRequest(method, "/x.txt?token=drop", strings.NewReader("x"))
+		w := httptest.NewRecorder()
+		dav.ServeHTTP(w, r)
+		require.Equal(t, http.StatusUnauthorized, w.Code, method)
+	}
+	require.NoFileExists(t, filepath.Join(fs.Webroot, "x.txt"))
+
+	// Nor the metrics listener
+	metrics := NewCustomMux()
+	_ = fs.SetupMux(metrics, modeMetrics)
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest(http.MethodGet, metricsPath+"?token=drop", nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// On the web UI it only gets to the upload
+	web := NewCustomMux()
+	_ = fs.SetupMux(web, modeWeb)
+	for method, target := range map[string]string{
+		http.MethodPut:    "/x.txt?token=drop",
+		http.MethodDelete: "/loot.txt?token=drop",
+		http.MethodGet:    metricsPath + "?token=drop",
+	} {
+		w := httptest.NewRecorder()
+		web.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		require.Equal(t, http.StatusUnauthorized, w.Code, method)
+	}
+	require.FileExists(t, filepath.Join(fs.Webroot, "loot.txt"))
+}
+
+func TestUploadRequest_NoOverwrite(t *testing.T) {
+	fs := newShareFileServer(t)
+	fs.SharedLinks["drop"] = SharedLink{FilePath: "/", IsDir: true, Upload: true, MaxFiles: 3, Expires: time.Now().Add(time.Hour)}
+	mux := NewCustomMux()
+	_ = fs.SetupMux(mux, modeWeb)
+
+	for _, content := range []string{"first", "second"} {
+		w := postFiles(t, mux, "/upload?token=drop", map[string]string{"loot.txt": content})
+		require.Equal(t, http.StatusSeeOther, w.Code)
+	}
+	data, err := os.ReadFile(filepath.Join(fs.Webroot, "loot.txt"))
+	require.NoError(t, err)
+	require.NotEqual(t, "first", string(data))
+	data, err = os.ReadFile(filepath.Join(fs.Webroot, "loot (1).txt"))
+	require.NoError(t, err)
+	require.Equal(t, "first", string(data))
+	data, err = os.ReadFile(filepath.Join(fs.Webroot, "loot (2).txt"))
+	require.NoError(t, err)
+	require.Equal(t, "second", string(data))
+	require.Equal(t, 2, fs.SharedLinks["drop"].Uploaded)
+}
+
+func TestUploadRequest_ConcurrentLimit(t *testing.T) {
+	fs := newShareFileServer(t)
+	fs.SharedLinks["drop"] = SharedLink{FilePath: "/", IsDir: true, Upload: true, MaxFiles: 3, Expires: time.Now().Add(time.Hour)}
+	mux := NewCustomMux()
+	_ = fs.SetupMux(mux, modeWeb)
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Go(func() {
+			postFiles(t, mux, "/upload?token=drop", map[string]string{fmt.Sprintf("%d.txt", i): "x"})
+		})
+	}
+	wg.Wait()
+	entries, err := os.ReadDir(fs.Webroot)
+	require.NoError(t, err)
+	require.Len(t, entries, 4) // loot.txt and three uploads
+	require.Empty(t, fs.SharedLinks)
+}
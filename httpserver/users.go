@@ -0,0 +1,158 @@
+package httpserver
+
+import (
+	"net/http"
+	"slices"
+
+	"golang.org/x/net/webdav"
+	"goshs.de/goshs/v2/apitoken"
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/users"
+)
+
+// namedAccount returns the users file account the request authenticated as.
+// It is nil with a single -b credential or without auth.
+func namedAccount(r *http.Request) *users.Account {
+	return users.FromContext(r.Context())
+}
+
+// account returns the account the access of the request is checked against:
+// its users file account, or users.Unrestricted without a users file. With a
+// users file a request without an account gets nil, which is allowed nothing.
+func (fs *FileServer) account(r *http.Request) *users.Account {
+	if a := namedAccount(r); a != nil {
+		return a
+	}
+	if fs.Users == nil {
+		return users.Unrestricted
+	}
+	return nil
+}
+
+// withAccount attaches the account behind the basic auth credentials of an
+// already verified request. It fails if the account is gone, e.g. because a
+// reload removed it after the credentials were checked.
+func (fs *FileServer) withAccount(r *http.Request) (*http.Request, bool) {
+	if fs.Users == nil {
+		return r, true
+	}
+	username, _, _ := r.BasicAuth()
+	a := fs.Users.Lookup(username)
+	if a == nil {
+		return r, false
+	}
+	return r.WithContext(users.NewContext(r.Context(), a)), true
+}
+
+// basicAuthEnabled reports whether requests have to carry basic auth.
+func (fs *FileServer) basicAuthEnabled() bool {
+	user, pass := fs.credentials()
+	return user != "" || pass != "" || fs.Users != nil
+}
+
+// authEnabled reports whether any kind of authentication is configured.
+func (fs *FileServer) authEnabled() bool {
+	_, pass := fs.credentials()
+	return pass != "" || fs.CACert != "" || fs.Users != nil || fs.OIDC != nil
+}
+
+func (fs *FileServer) accountCount() int {
+	if fs.Users == nil {
+		return 0
+	}
+	return len(fs.Users.Accounts())
+}
+
+// root is the directory the request is confined to: the webroot or the
+// home directory of its account.
+func (fs *FileServer) root(r *http.Request) string {
+	return fs.account(r).Root(fs.Webroot)
+}
+
+// uploadRoot is where uploads of the request are written to. Accounts with
+// a home directory always upload into it.
+func (fs *FileServer) uploadRoot(r *http.Request) string {
+	if a := fs.account(r); a != nil && a.Home != "" {
+		return a.Root(fs.Webroot)
+	}
+	return fs.UploadFolder
+}
+
+func (fs *FileServer) readOnly(r *http.Request) bool {
+	fs.settingsMu.RLock()
+	defer fs.settingsMu.RUnlock()
+	return fs.ReadOnly || !fs.account(r).CanWrite()
+}
+
+func (fs *FileServer) uploadOnly(r *http.Request) bool {
+	fs.settingsMu.RLock()
+	defer fs.settingsMu.RUnlock()
+	return fs.UploadOnly || !fs.account(r).CanRead()
+}
+
+func (fs *FileServer) noDelete(r *http.Request) bool {
+	fs.settingsMu.RLock()
+	defer fs.settingsMu.RUnlock()
+	return fs.NoDelete || !fs.account(r).CanDelete()
+}
+
+// denyNoAccount rejects a request that passed auth without an account of
+// the users file.
+func (fs *FileServer) denyNoAccount(w http.ResponseWriter, r *http.Request) {
+	logDenied(r, eventDenied, http.StatusForbidden, "", "[AUTH] request without an account denied access to %s", r.URL.RequestURI())
+	http.Error(w, "Forbidden", http.StatusForbidden)
+}
+
+// denyNonAdmin rejects requests to the administrative endpoints (collaborator
+// feed, CLI, catcher, cracker, mailbox) from accounts without the admin role.
+// API tokens of one of scopes are let in, TokenMiddleware limited them to
+// the endpoint of their scope.
+func (fs *FileServer) denyNonAdmin(w http.ResponseWriter, r *http.Request, scopes ...apitoken.Scope) bool {
+	if t := tokenFromContext(r); t != nil && slices.Contains(scopes, t.Scope) {
+		return false
+	}
+	a := fs.account(r)
+	if a == nil {
+		fs.denyNoAccount(w, r)
+		return true
+	}
+	if !a.IsAdmin() {
+		logDenied(r, eventDenied, http.StatusForbidden, a.Name, "[AUTH] %s (%s) denied access to %s", a.Name, a.Role, r.URL.RequestURI())
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return true
+	}
+	return false
+}
+
+// webdavAccess applies the role of the account and the .goshs files to
+// WebDAV methods and serves the request from its home directory.
+func (fs *FileServer) webdavAccess(next *webdav.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := fs.account(r)
+		if a == nil {
+			fs.denyNoAccount(w, r)
+			return
+		}
+		allowed := true
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			allowed = a.CanRead()
+		case http.MethodPut, "MKCOL", "COPY", "PROPPATCH", "LOCK", "UNLOCK":
+			allowed = a.CanWrite()
+		case http.MethodDelete, "MOVE":
+			allowed = a.CanDelete()
+		}
+		if !allowed {
+			logger.Warnf("[WEBDAV] %s (%s) denied %s %s", a.Name, a.Role, r.Method, r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		root := a.Root(fs.Webroot)
+		if !fs.webdavACL(w, r, root) {
+			return
+		}
+		h := *next
+		h.FileSystem = aclDir{Dir: webdav.Dir(root), store: fs.ACL}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,179 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/users"
+)
+
+// newUsersFileServer returns a file server with a users file of an admin, a
+// read-only account confined to team/bob and an upload-only account.
+func newUsersFileServer(t *testing.T) (*FileServer, http.Handler) {
+	t.Helper()
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "secret.txt"), []byte("top secret"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "team", "bob"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "team", "bob", "notes.txt"), []byte("bob notes"), 0644))
+
+	u, err := users.Parse(strings.NewReader("admin:pw:admin\nbob:pw:read:team/bob\nup:pw:upload\n"))
+	require.NoError(t, err)
+
+	fs, cleanup := newTestFileServer(t, root)
+	t.Cleanup(cleanup)
+	fs.Users = u
+	fs.authCache = make(map[string]bool)
+	fs.Options = &options.Options{}
+	fs.IP = "127.0.0.1"
+	fs.Port = 8000
+	return fs, fs.BasicAuthMiddleware(http.HandlerFunc(fs.handler))
+}
+
+func doAs(h http.Handler, user, method, target string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	r.Header.Set("Authorization", basicAuthHeader(user, "pw"))
+	r.Header.Set("X-CSRF-Token", "test-csrf")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestUsers_HomeConfinement(t *testing.T) {
+	_, h := newUsersFileServer(t)
+
+	w := doAs(h, "bob", http.MethodGet, "/notes.txt")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "bob notes", w.Body.String())
+
+	require.Equal(t, http.StatusNotFound, doAs(h, "bob", http.MethodGet, "/secret.txt").Code)
+	require.Equal(t, http.StatusOK, doAs(h, "admin", http.MethodGet, "/secret.txt").Code)
+
+	w = doAs(h, "bob", http.MethodGet, "/?json")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "notes.txt")
+	require.NotContains(t, w.Body.String(), "secret.txt")
+}
+
+func TestUsers_Roles(t *testing.T) {
+	fs, h := newUsersFileServer(t)
+	put := fs.BasicAuthMiddleware(http.HandlerFunc(fs.put))
+
+	require.Equal(t, http.StatusForbidden, doAs(put, "bob", http.MethodPut, "/new.txt").Code)
+	require.Equal(t, http.StatusForbidden, doAs(h, "up", http.MethodGet, "/secret.txt").Code)
+
+	// Upload accounts may write but not delete
+	require.Equal(t, http.StatusOK, doAs(put, "up", http.MethodPut, "/new.txt").Code)
+	require.FileExists(t, filepath.Join(fs.Webroot, "new.txt"))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(users.NewContext(r.Context(), fs.Users.Lookup("up")))
+	require.True(t, fs.noDelete(r))
+	require.True(t, fs.uploadOnly(r))
+	require.False(t, fs.readOnly(r))
+}
+
+func TestUsers_AdminOnlyAPIs(t *testing.T) {
+	_, h := newUsersFileServer(t)
+
+	for _, target := range []string{"/?goshs-info", "/?ws", "/?catcher-api=list", "/?crack-api=jobs", "/?mail-api=list"} {
+		require.Equal(t, http.StatusForbidden, doAs(h, "bob", http.MethodGet, target).Code, target)
+	}
+	require.Equal(t, http.StatusOK, doAs(h, "admin", http.MethodGet, "/?goshs-info").Code)
+}
+
+func TestUsers_RemovedAccount(t *testing.T) {
+	fs, h := newUsersFileServer(t)
+	require.Equal(t, http.StatusOK, doAs(h, "admin", http.MethodGet, "/?goshs-info").Code)
+
+	// A reload removes the account while its credentials are still cached
+	u, err := users.Parse(strings.NewReader("bob:pw:read:team/bob\n"))
+	require.NoError(t, err)
+	fs.Users.Replace(u)
+	require.Equal(t, http.StatusUnauthorized, doAs(h, "admin", http.MethodGet, "/?goshs-info").Code)
+	require.Equal(t, http.StatusUnauthorized, doAs(h, "admin", http.MethodGet, "/secret.txt").Code)
+}
+
+func TestUsers_NoAccount(t *testing.T) {
+	fs, _ := newUsersFileServer(t)
+
+	// Requests that reach the handlers without an account may do nothing
+	r := httptest.NewRequest(http.MethodGet, "/?goshs-info", nil)
+	require.Nil(t, fs.account(r))
+	require.True(t, fs.readOnly(r))
+	require.True(t, fs.uploadOnly(r))
+	require.True(t, fs.noDelete(r))
+	w := httptest.NewRecorder()
+	fs.handler(w, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	// Without a users file they are unrestricted
+	fs.Users = nil
+	require.Equal(t, users.Unrestricted, fs.account(r))
+	require.False(t, fs.readOnly(r))
+}
+
+func TestUsers_ShareOwner(t *testing.T) {
+	fs, h := newUsersFileServer(t)
+
+	require.Equal(t, http.StatusForbidden, doAs(h, "up", http.MethodGet, "/?share").Code)
+	require.Equal(t, http.StatusOK, doAs(h, "bob", http.MethodGet, "/notes.txt?share").Code)
+	require.Len(t, fs.SharedLinks, 1)
+
+	var token string
+	for tok, link := range fs.SharedLinks {
+		token = tok
+		require.Equal(t, "bob", link.Owner)
+	}
+
+	// Only the owner or an admin may revoke it
+	r := httptest.NewRequest(http.MethodDelete, "/?token="+token, nil)
+	r = r.WithContext(users.NewContext(r.Context(), fs.Users.Lookup("up")))
+	w := httptest.NewRecorder()
+	fs.DeleteShareHandler(w, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Len(t, fs.SharedLinks, 1)
+
+	// The link is served from the home directory of its owner
+	w = httptest.NewRecorder()
+	fs.ShareHandler(w, httptest.NewRequest(http.MethodGet, "/?token="+token, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "bob notes", w.Body.String())
+
+	fs.SharedLinks["admin-test"] = SharedLink{Owner: "bob", Expires: time.Now().Add(time.Hour)}
+	r = httptest.NewRequest(http.MethodDelete, "/?token=admin-test", nil)
+	r = r.WithContext(users.NewContext(r.Context(), fs.Users.Lookup("admin")))
+	w = httptest.NewRecorder()
+	fs.DeleteShareHandler(w, r)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.NotContains(t, fs.SharedLinks, "admin-test")
+}
+
+func TestUsers_WebdavAccess(t *testing.T) {
+	fs, _ := newUsersFileServer(t)
+	wd := &webdav.Handler{
+		FileSystem: webdav.Dir(fs.Webroot),
+		LockSystem: webdav.NewMemLS(),
+	}
+	h := fs.BasicAuthMiddleware(fs.webdavAccess(wd))
+
+	w := doAs(h, "bob", http.MethodGet, "/notes.txt")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "bob notes", w.Body.String())
+	require.Equal(t, http.StatusNotFound, doAs(h, "bob", http.MethodGet, "/secret.txt").Code)
+	require.Equal(t, http.StatusForbidden, doAs(h, "bob", http.MethodPut, "/x.txt").Code)
+	require.Equal(t, http.StatusForbidden, doAs(h, "bob", "MKCOL", "/dir").Code)
+
+	require.Equal(t, http.StatusForbidden, doAs(h, "up", http.MethodGet, "/secret.txt").Code)
+	require.Equal(t, http.StatusForbidden, doAs(h, "up", http.MethodDelete, "/secret.txt").Code)
+	require.Equal(t, http.StatusCreated, doAs(h, "up", http.MethodPut, "/x.txt").Code)
+
+	require.Equal(t, http.StatusNoContent, doAs(h, "admin", http.MethodDelete, "/secret.txt").Code)
+}
@@ -0,0 +1,32 @@
+package httpserver
+
+import (
+	"net/http"
+
+	"goshs.de/goshs/v2/ca"
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/webhook"
+)
+
+// notify sends the webhook event of a request on path, naming the client,
+// the account and the client certificate it came from.
+func (fs *FileServer) notify(r *http.Request, event string, path string, message string) {
+	e := webhook.NewEvent(event, message)
+	e.Path = path
+	e.Remote = GetClientIP(r, fs.Whitelist)
+	if a := namedAccount(r); a != nil {
+		e.User = a.Name
+	} else if username, _, ok := r.BasicAuth(); ok {
+		e.User = username
+	}
+	if cert := clientCert(r); cert != nil {
+		if e.User == "" {
+			e.User = ca.Identity(cert)
+		}
+		e.Fields = map[string]string{
+			"certificate":        ca.Identity(cert),
+			"certificate_serial": cert.SerialNumber.Text(16),
+		}
+	}
+	logger.HandleWebhookEvent(e, fs.Webhook)
+}
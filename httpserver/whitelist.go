@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 )
 
 type Whitelist struct {
 	Networks       []*net.IPNet
 	TrustedProxies []*net.IPNet
 	Enabled        bool
+	mu             sync.RWMutex
 }
 
 func NewIPWhitelist(cidrs string, enabled bool, trustedProxies string) (*Whitelist, error) {
@@ -73,7 +75,19 @@ func NewIPWhitelist(cidrs string, enabled bool, trustedProxies string) (*Whiteli
 	return whitelist, nil
 }
 
+// Update replaces the networks and trusted proxies of w with those of next,
+// so a reloaded whitelist applies to the servers sharing w.
+func (w *Whitelist) Update(next *Whitelist) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.Networks = next.Networks
+	w.TrustedProxies = next.TrustedProxies
+	w.Enabled = next.Enabled
+}
+
 func (w *Whitelist) IsAllowed(ipStr string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
 	if !w.Enabled {
 		return true // No whitelist configured, allow all
 	}
@@ -92,6 +106,8 @@ func (w *Whitelist) IsAllowed(ipStr string) bool {
 }
 
 func (w *Whitelist) IsTrustedProxy(ipStr string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
 	parsedIP := net.ParseIP(ipStr)
 	for _, cidr := range w.TrustedProxies {
 		if cidr.Contains(parsedIP) {
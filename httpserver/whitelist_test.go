@@ -144,3 +144,19 @@ func TestGetClientIP_UntrustedProxy_IgnoresHeaders(t *testing.T) {
 	ip := GetClientIP(r, wl)
 	require.Equal(t, "10.0.0.1", ip)
 }
+
+func TestWhitelist_Update(t *testing.T) {
+	wl, err := NewIPWhitelist("192.168.0.0/24", true, "")
+	require.NoError(t, err)
+	require.False(t, wl.IsAllowed("10.0.0.5"))
+
+	next, err := NewIPWhitelist("10.0.0.0/8", true, "10.0.0.1")
+	require.NoError(t, err)
+	wl.Update(next)
+	require.True(t, wl.IsAllowed("10.0.0.5"))
+	require.False(t, wl.IsAllowed("192.168.0.5"))
+	require.True(t, wl.IsTrustedProxy("10.0.0.1"))
+
+	wl.Update(&Whitelist{})
+	require.True(t, wl.IsAllowed("192.168.0.5"))
+}
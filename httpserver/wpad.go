@@ -0,0 +1,51 @@
+package httpserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/wpadserver"
+)
+
+// isPACRequest reports whether r fetches the proxy auto-config file. Browsers
+// and WinHTTP request it without credentials, so it bypasses authentication.
+func (fs *FileServer) isPACRequest(r *http.Request) bool {
+	if fs.Options == nil || !fs.Options.WPAD {
+		return false
+	}
+	return r.URL.Path == "/wpad.dat" || r.URL.Path == "/proxy.pac"
+}
+
+// servePAC answers /wpad.dat and /proxy.pac with a PAC file pointing at the
+// WPAD proxy. It returns false if the request is not a PAC request.
+func (fs *FileServer) servePAC(w http.ResponseWriter, r *http.Request) bool {
+	if !fs.isPACRequest(r) {
+		return false
+	}
+
+	host := fs.Options.WPADHost
+	if host == "" {
+		// Announce the address the client reached us on, that one is routable for it.
+		if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+			host, _, _ = net.SplitHostPort(addr.String())
+		}
+	}
+	if host == "" {
+		host = fs.IP
+	}
+
+	body := fs.emitCollabEvent(r, http.StatusOK)
+	logger.LogRequest(r, http.StatusOK, fs.verbose(), fs.Webhook, body)
+	logger.Infof("[wpad] serving PAC to %s (proxy %s)", r.RemoteAddr, net.JoinHostPort(host, strconv.Itoa(fs.Options.WPADPort)))
+	logger.HandleWebhookSend(fmt.Sprintf("[WPAD] %s fetched %s (User-Agent: %s)", r.RemoteAddr, r.URL.Path, r.UserAgent()), "wpad", fs.Webhook)
+
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := w.Write(wpadserver.GeneratePAC(host, fs.Options.WPADPort)); err != nil {
+		logger.Errorf("Error writing PAC file: %+v", err)
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"goshs.de/goshs/v2/options"
+)
+
+func TestServePAC(t *testing.T) {
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	defer cleanup()
+	fs.IP = "0.0.0.0"
+	fs.Options = &options.Options{WPAD: true, WPADPort: 3128, WPADHost: "10.0.0.5"}
+
+	for _, path := range []string{"/wpad.dat", "/proxy.pac"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		fs.handler(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "application/x-ns-proxy-autoconfig", rec.Header().Get("Content-Type"))
+		require.Contains(t, rec.Body.String(), `"PROXY 10.0.0.5:3128; DIRECT"`)
+	}
+}
+
+func TestServePAC_DisabledFallsThrough(t *testing.T) {
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	defer cleanup()
+	fs.Options = &options.Options{}
+
+	req := httptest.NewRequest(http.MethodGet, "/wpad.dat", nil)
+	rec := httptest.NewRecorder()
+	fs.handler(rec, req)
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestServePAC_BypassesBasicAuth(t *testing.T) {
+	fs, cleanup := newTestFileServer(t, t.TempDir())
+	defer cleanup()
+	fs.User = "user"
+	fs.Pass = "pass"
+	fs.Options = &options.Options{WPAD: true, WPADPort: 3128, WPADHost: "10.0.0.5"}
+
+	h := fs.BasicAuthMiddleware(http.HandlerFunc(fs.handler))
+
+	req := httptest.NewRequest(http.MethodGet, "/wpad.dat", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -1,13 +1,19 @@
 package ldapserver
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"net"
+	"strings"
+	"time"
 
 	"goshs.de/goshs/v2/ca"
 	"goshs.de/goshs/v2/logger"
 	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/service"
+	"goshs.de/goshs/v2/smbserver"
 	"goshs.de/goshs/v2/webhook"
 	"goshs.de/goshs/v2/ws"
 )
@@ -18,13 +24,17 @@ type LDAPServer struct {
 	Port         int
 	Hub          *ws.Hub
 	WebHook      *webhook.Webhook
-	JNDIEnabled  bool   // when true, respond to any search with a JNDI entry using baseDN as class name
-	JNDICodeBase string // HTTP URL where the .class file is served from
-	Wordlist     string // optional path to a wordlist for NTLM hash cracking
+	JNDIEnabled  bool          // when true, respond to any search with a JNDI entry using baseDN as class name
+	JNDICodeBase string        // HTTP URL where the .class file is served from
+	PublicURL    func() string // tunnel URL of the web server, the codeBase unless -ldap-jndi-base is set
+	fixedBase    bool
+	Wordlist     string             // optional path to a wordlist for NTLM hash cracking
+	Cracker      *smbserver.Cracker // optional shared background cracker
 	SSL          bool
 	SelfSigned   bool
 	MyCert       string
 	MyKey        string
+	conns        service.Conns
 }
 
 func NewLDAPServer(opts *options.Options, hub *ws.Hub, wh *webhook.Webhook) *LDAPServer {
@@ -56,6 +66,7 @@ func NewLDAPServer(opts *options.Options, hub *ws.Hub, wh *webhook.Webhook) *LDA
 		WebHook:      wh,
 		JNDIEnabled:  opts.LDAPJNDIEnabled,
 		JNDICodeBase: codeBase,
+		fixedBase:    opts.LDAPJNDIBase != "",
 		Wordlist:     opts.LDAPWordlist,
 		SSL:          opts.SSL,
 		SelfSigned:   opts.SelfSigned,
@@ -85,12 +96,13 @@ func (s *LDAPServer) buildTLSConfig() *tls.Config {
 	}
 }
 
-func (s *LDAPServer) Start() {
+// Listen binds the listener and serves LDAP, or LDAPS with SSL, in the
+// background.
+func (s *LDAPServer) Listen() error {
 	addr := fmt.Sprintf("%s:%d", s.IP, s.Port)
 	ln, err := net.Listen("tcp", addr)
 	if err != nil {
-		logger.Fatalf("LDAP server failed to listen on %s: %v", addr, err)
-		return
+		return err
 	}
 
 	if s.SSL {
@@ -101,15 +113,56 @@ func (s *LDAPServer) Start() {
 	}
 
 	if s.JNDIEnabled {
-		logger.Infof("LDAP JNDI mode enabled: codeBase=%s", s.JNDICodeBase)
+		logger.Infof("LDAP JNDI mode enabled: codeBase=%s", s.codeBase())
 	}
 
-	for {
-		conn, err := ln.Accept()
-		if err != nil {
-			logger.Errorf("LDAP accept error: %v", err)
-			continue
+	s.conns.Serve(ln, func(conn net.Conn) { newSession(conn, s).handle() })
+	return nil
+}
+
+// codeBase returns the URL the JNDI entries point to. Through a tunnel the
+// web server is reached at its public URL.
+func (s *LDAPServer) codeBase() string {
+	if !s.fixedBase && s.PublicURL != nil {
+		if url := s.PublicURL(); url != "" {
+			return strings.TrimSuffix(url, "/") + "/"
 		}
-		go newSession(conn, s).handle()
+	}
+	return s.JNDICodeBase
+}
+
+// Shutdown closes the listener and waits for the open sessions until ctx is
+// done.
+func (s *LDAPServer) Shutdown(ctx context.Context) error {
+	return s.conns.Shutdown(ctx)
+}
+
+// broadcastNTLMCracked reports a hash that was cracked in the background.
+func (s *LDAPServer) broadcastNTLMCracked(c *smbserver.CapturedHash, src, password string) {
+	update := ws.LDAPEvent{
+		Type:            "ldap",
+		Operation:       "ntlm",
+		Username:        c.Username,
+		Domain:          c.Domain,
+		Hash:            c.HashcatLine,
+		HashType:        string(c.Protocol),
+		HashcatMode:     c.HashcatMode,
+		CrackedPassword: password,
+		Source:          src,
+		Timestamp:       time.Now(),
+	}
+	if b, err := json.Marshal(update); err == nil && s.Hub != nil {
+		s.Hub.Broadcast <- b
+	}
+
+	if s.WebHook != nil {
+		msg := fmt.Sprintf("LDAP NTLM cracked from %s\nUser: %s\nDomain: %s\nCracked: %s\n\n%s",
+			src, c.Username, c.Domain, password, c.HashcatLine)
+		e := webhook.NewEvent("ldap", msg)
+		e.Remote = src
+		e.User = c.Username
+		e.Hashes = []string{c.HashcatLine}
+		e.Fields = map[string]string{"domain": c.Domain, "hashcat_mode": c.HashcatMode, "password": password}
+		logger.HandleWebhookEvent(e, *s.WebHook)
 	}
 }
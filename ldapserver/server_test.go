@@ -674,6 +674,30 @@ func TestNewLDAPServer_JNDICodeBase_IPv6Unspecified(t *testing.T) {
 	require.Contains(t, srv.JNDICodeBase, "127.0.0.1")
 }
 
+func TestLDAPServer_CodeBase_Tunnel(t *testing.T) {
+	opts := &options.Options{
+		IP:              "10.0.0.1",
+		Port:            8080,
+		LDAPPort:        389,
+		LDAPJNDIEnabled: true,
+	}
+	srv := NewLDAPServer(opts, nil, nil)
+	require.Equal(t, "http://10.0.0.1:8080/", srv.codeBase())
+
+	// The tunnel URL once it is up
+	var url string
+	srv.PublicURL = func() string { return url }
+	require.Equal(t, "http://10.0.0.1:8080/", srv.codeBase())
+	url = "https://abc.relay.example"
+	require.Equal(t, "https://abc.relay.example/", srv.codeBase())
+
+	// An explicit codeBase wins
+	opts.LDAPJNDIBase = "http://evil.attacker.com/"
+	srv = NewLDAPServer(opts, nil, nil)
+	srv.PublicURL = func() string { return url }
+	require.Equal(t, "http://evil.attacker.com/", srv.codeBase())
+}
+
 func TestNewLDAPServer_Wordlist(t *testing.T) {
 	opts := &options.Options{
 		IP:           "0.0.0.0",
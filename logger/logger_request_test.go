@@ -22,6 +22,19 @@ func TestLogRequest_StatusOK(t *testing.T) {
 	LogRequest(req, http.StatusOK, false, nil, nil)
 }
 
+func TestLogRequest_Identity(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	if got := Client(req); got != "1.2.3.4:1234" {
+		t.Fatalf("Client() = %q", got)
+	}
+	req = WithIdentity(req, "laptop-01")
+	if got := Client(req); got != "1.2.3.4:1234 (laptop-01)" {
+		t.Fatalf("Client() = %q", got)
+	}
+	LogRequest(req, http.StatusOK, false, nil, nil)
+}
+
 func TestLogRequest_StatusNotFound(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
 	req.RemoteAddr = "1.2.3.4:1234"
@@ -0,0 +1,136 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedSuffix is the time layout appended to rotated log files.
+const rotatedSuffix = "20060102-150405"
+
+// RotatingFile is a log file that is moved aside and started anew once it
+// grows beyond MaxSize bytes or gets older than MaxAge. Zero disables
+// either. Keep is the number of rotated files kept, 0 keeps all.
+type RotatingFile struct {
+	path    string
+	MaxSize int64
+	MaxAge  time.Duration
+	Keep    int
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	started time.Time
+}
+
+// OpenRotatingFile opens path for appending, rotating it as configured.
+func OpenRotatingFile(path string, maxSize int64, maxAge time.Duration, keep int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, MaxSize: maxSize, MaxAge: maxAge, Keep: keep}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.started = file, info.Size(), time.Now()
+	if info.Size() > 0 {
+		// The age of a file carried over from an earlier run counts from its last entry
+		f.started = info.ModTime()
+	}
+	return nil
+}
+
+// Write appends p, rotating the file first if it is due.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.due(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) due(next int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.MaxSize > 0 && f.size+next > f.MaxSize {
+		return true
+	}
+	return f.MaxAge > 0 && time.Since(f.started) > f.MaxAge
+}
+
+// rotate moves the file aside with the current time appended and opens a
+// new one.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	rotated := f.path + "." + time.Now().Format(rotatedSuffix)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(rotated); os.IsNotExist(err) {
+			break
+		}
+		rotated = f.path + "." + time.Now().Format(rotatedSuffix) + "." + strconv.Itoa(i)
+	}
+	if err := os.Rename(f.path, rotated); err != nil {
+		return fmt.Errorf("rotating log file %s: %w", f.path, err)
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	return f.prune()
+}
+
+// prune removes the oldest rotated files beyond Keep.
+func (f *RotatingFile) prune() error {
+	if f.Keep <= 0 {
+		return nil
+	}
+	rotated, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return err
+	}
+	rotated = slices.DeleteFunc(rotated, func(name string) bool {
+		suffix := strings.TrimPrefix(name, f.path+".")
+		_, err := time.Parse(rotatedSuffix, suffix[:min(len(suffix), len(rotatedSuffix))])
+		return err != nil
+	})
+	// The time suffix sorts the files from the oldest to the newest
+	slices.Sort(rotated)
+	for len(rotated) > f.Keep {
+		if err := os.Remove(rotated[0]); err != nil {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+// Close closes the current file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,59 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile_Size(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "goshs.log")
+	f, err := OpenRotatingFile(path, 10, 0, 2)
+	require.NoError(t, err)
+	defer f.Close()
+
+	line := []byte("0123456789\n")
+	for range 5 {
+		_, err := f.Write(line)
+		require.NoError(t, err)
+	}
+
+	rotated, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	require.Len(t, rotated, 2)
+	for _, name := range rotated {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		require.Equal(t, string(line), string(data))
+	}
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, string(line), string(data))
+}
+
+func TestRotatingFile_Age(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "goshs.log")
+	require.NoError(t, os.WriteFile(path, []byte("old\n"), 0600))
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(path, old, old))
+
+	f, err := OpenRotatingFile(path, 0, time.Hour, 0)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.Write([]byte("new\n"))
+	require.NoError(t, err)
+
+	rotated, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	require.Len(t, rotated, 1)
+	data, err := os.ReadFile(rotated[0])
+	require.NoError(t, err)
+	require.Equal(t, "old\n", string(data))
+	require.True(t, strings.HasPrefix(filepath.Base(rotated[0]), "goshs.log."))
+}
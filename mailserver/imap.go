@@ -0,0 +1,967 @@
+package mailserver
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/mailstore"
+	"goshs.de/goshs/v2/options"
+)
+
+var imapFlags = []string{`\Answered`, `\Flagged`, `\Deleted`, `\Seen`, `\Draft`}
+
+// idlePoll is how often an IDLE session looks for new mail.
+var idlePoll = time.Second
+
+// IMAPServer is a minimal IMAP4rev1 server (RFC 3501) with a single INBOX
+// per recipient. Flags live in memory; UIDs are assigned in arrival order
+// and UIDVALIDITY changes with every start.
+type IMAPServer struct {
+	config
+
+	mu          sync.Mutex
+	uidValidity uint32
+	uids        map[string]uint32          // message ID → UID
+	nextUID     uint32                     // last assigned UID
+	flags       map[string]map[string]bool // mailbox/message ID → flags
+}
+
+func NewIMAPServer(opts *options.Options, store *mailstore.Store) *IMAPServer {
+	return &IMAPServer{
+		config:      newConfig(opts, opts.IMAPPort, store),
+		uidValidity: uint32(time.Now().Unix()),
+		uids:        map[string]uint32{},
+		flags:       map[string]map[string]bool{},
+	}
+}
+
+// Listen binds the listener and serves IMAP in the background.
+func (s *IMAPServer) Listen() error {
+	if err := s.setupTLS(); err != nil {
+		logger.Warnf("IMAP TLS setup failed, STARTTLS disabled: %v", err)
+	}
+	ln, err := s.listen("IMAP")
+	if err != nil {
+		return err
+	}
+	s.serve(ln)
+	return nil
+}
+
+func (s *IMAPServer) serve(ln net.Listener) {
+	s.conns.Serve(ln, s.handle)
+}
+
+// imapMessage is a message as seen by a selected session.
+type imapMessage struct {
+	*mailstore.Message
+	uid uint32
+}
+
+// uid returns the UID of a message, assigning the next one on first sight.
+func (s *IMAPServer) uid(id string) uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.uids[id]; ok {
+		return u
+	}
+	s.nextUID++
+	s.uids[id] = s.nextUID
+	return s.nextUID
+}
+
+func (s *IMAPServer) uidNext() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nextUID + 1
+}
+
+func flagKey(mailbox, id string) string {
+	return strings.ToLower(mailbox) + "/" + id
+}
+
+func (s *IMAPServer) getFlags(mailbox, id string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, f := range imapFlags {
+		if s.flags[flagKey(mailbox, id)][f] {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func (s *IMAPServer) hasFlag(mailbox, id, flag string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flags[flagKey(mailbox, id)][flag]
+}
+
+// setFlags applies a STORE operation: mode is "+", "-" or "" (replace).
+func (s *IMAPServer) setFlags(mailbox, id, mode string, flags []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := flagKey(mailbox, id)
+	if mode == "" || s.flags[key] == nil {
+		s.flags[key] = map[string]bool{}
+	}
+	for _, f := range flags {
+		f = canonicalFlag(f)
+		if f == "" {
+			continue
+		}
+		if mode == "-" {
+			delete(s.flags[key], f)
+		} else {
+			s.flags[key][f] = true
+		}
+	}
+}
+
+func (s *IMAPServer) forget(mailbox, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.flags, flagKey(mailbox, id))
+}
+
+// canonicalFlag maps a system flag to its canonical spelling, dropping
+// keywords and flags the server cannot store.
+func canonicalFlag(f string) string {
+	for _, known := range imapFlags {
+		if strings.EqualFold(f, known) {
+			return known
+		}
+	}
+	return ""
+}
+
+type imapSession struct {
+	srv      *IMAPServer
+	conn     net.Conn
+	r        *bufio.Reader
+	w        *bufio.Writer
+	user     string
+	selected bool
+	readOnly bool
+	msgs     []*imapMessage
+}
+
+func (s *IMAPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	sess := &imapSession{srv: s, conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	sess.untagged("OK [CAPABILITY " + sess.capabilities() + "] goshs IMAP4rev1 ready")
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(30 * time.Minute))
+		line, err := readIMAPCommand(sess.r, func() { sess.send("+ Ready for literal data") })
+		if err != nil {
+			return
+		}
+		p := &imapParser{s: line}
+		tag := p.atom()
+		if tag == "" || p.done() {
+			sess.send("* BAD missing tag or command")
+			continue
+		}
+		p.skipSpace()
+		cmd := strings.ToUpper(p.atom())
+		if !sess.dispatch(tag, cmd, p) {
+			return
+		}
+	}
+}
+
+func (c *imapSession) send(line string) {
+	c.w.WriteString(line + "\r\n")
+	c.w.Flush()
+}
+
+func (c *imapSession) untagged(line string) { c.send("* " + line) }
+
+func (c *imapSession) isTLS() bool {
+	_, ok := c.conn.(*tls.Conn)
+	return ok
+}
+
+func (c *imapSession) capabilities() string {
+	caps := "IMAP4rev1 AUTH=PLAIN IDLE UNSELECT"
+	if c.srv.tlsConfig != nil && !c.isTLS() {
+		caps += " STARTTLS"
+	}
+	return caps
+}
+
+// dispatch runs a command and reports whether to keep the connection open.
+func (c *imapSession) dispatch(tag, cmd string, p *imapParser) bool {
+	bad := func(msg string) { c.send(tag + " BAD " + msg) }
+
+	args, err := p.args()
+	if err != nil {
+		bad(err.Error())
+		return true
+	}
+
+	switch cmd {
+	case "CAPABILITY":
+		c.untagged("CAPABILITY " + c.capabilities())
+		c.send(tag + " OK CAPABILITY completed")
+		return true
+	case "NOOP", "CHECK":
+		if c.selected {
+			c.refresh()
+		}
+		c.send(tag + " OK " + cmd + " completed")
+		return true
+	case "LOGOUT":
+		c.untagged("BYE goshs IMAP4rev1 server logging out")
+		c.send(tag + " OK LOGOUT completed")
+		return false
+	}
+
+	if c.user == "" {
+		switch cmd {
+		case "STARTTLS":
+			c.startTLS(tag)
+		case "LOGIN":
+			user, ok1 := argString(args, 0)
+			pass, ok2 := argString(args, 1)
+			if !ok1 || !ok2 {
+				bad("LOGIN expects username and password")
+				return true
+			}
+			c.login(tag, user, pass)
+		case "AUTHENTICATE":
+			c.authenticate(tag, args)
+		default:
+			c.send(tag + " NO not authenticated")
+		}
+		return true
+	}
+
+	switch cmd {
+	case "SELECT", "EXAMINE":
+		c.selectMailbox(tag, cmd, args)
+	case "LIST", "LSUB":
+		pattern, _ := argString(args, 1)
+		if pattern == "" {
+			c.untagged(cmd + ` (\Noselect) "/" ""`)
+		} else if pattern == "*" || pattern == "%" || strings.EqualFold(pattern, "INBOX") {
+			c.untagged(cmd + ` () "/" INBOX`)
+		}
+		c.send(tag + " OK " + cmd + " completed")
+	case "STATUS":
+		c.status(tag, args)
+	case "SUBSCRIBE", "UNSUBSCRIBE":
+		c.send(tag + " OK " + cmd + " completed")
+	case "CREATE", "DELETE", "RENAME", "APPEND":
+		c.send(tag + " NO the goshs mailbox is read from SMTP only")
+	case "IDLE":
+		c.idle(tag)
+	default:
+		if !c.selected {
+			c.send(tag + " NO no mailbox selected")
+			return true
+		}
+		c.dispatchSelected(tag, cmd, args)
+	}
+	return true
+}
+
+func (c *imapSession) dispatchSelected(tag, cmd string, args []any) {
+	uid := false
+	if cmd == "UID" {
+		sub, ok := argString(args, 0)
+		if !ok {
+			c.send(tag + " BAD UID expects a command")
+			return
+		}
+		uid, cmd, args = true, strings.ToUpper(sub), args[1:]
+	}
+
+	switch cmd {
+	case "FETCH":
+		c.fetch(tag, args, uid)
+	case "SEARCH":
+		c.search(tag, args, uid)
+	case "STORE":
+		c.store(tag, args, uid)
+	case "EXPUNGE":
+		c.expunge(true)
+		c.send(tag + " OK EXPUNGE completed")
+	case "CLOSE":
+		c.expunge(false)
+		c.selected = false
+		c.msgs = nil
+		c.send(tag + " OK CLOSE completed")
+	case "UNSELECT":
+		c.selected = false
+		c.msgs = nil
+		c.send(tag + " OK UNSELECT completed")
+	case "COPY", "MOVE":
+		c.send(tag + " NO the goshs mailbox has no other folders")
+	default:
+		c.send(tag + " BAD unknown command")
+	}
+}
+
+func (c *imapSession) startTLS(tag string) {
+	if c.srv.tlsConfig == nil || c.isTLS() {
+		c.send(tag + " NO STARTTLS not available")
+		return
+	}
+	c.send(tag + " OK begin TLS negotiation now")
+	tlsConn := tls.Server(c.conn, c.srv.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		logger.Debugf("IMAP STARTTLS handshake with %s failed: %v", c.conn.RemoteAddr(), err)
+		return
+	}
+	c.conn = tlsConn
+	c.r = bufio.NewReader(tlsConn)
+	c.w = bufio.NewWriter(tlsConn)
+}
+
+func (c *imapSession) login(tag, user, pass string) {
+	mailbox, ok := c.srv.checkLogin(remoteIP(c.conn), user, pass)
+	if !ok {
+		logger.Access{Protocol: "imap", Client: c.conn.RemoteAddr().String(), User: user, Event: "auth_failure", Method: "LOGIN"}.
+			Warnf("IMAP failed login for %s from %s", user, c.conn.RemoteAddr())
+		c.send(tag + " NO [AUTHENTICATIONFAILED] invalid credentials")
+		return
+	}
+	c.user = mailbox
+	logger.Access{Protocol: "imap", Client: c.conn.RemoteAddr().String(), User: user, Event: "login", Method: "LOGIN"}.
+		Infof("IMAP login for %s from %s", user, c.conn.RemoteAddr())
+	c.send(tag + " OK [CAPABILITY " + c.capabilities() + "] LOGIN completed")
+}
+
+// authenticate supports AUTH=PLAIN with or without an initial response.
+func (c *imapSession) authenticate(tag string, args []any) {
+	mech, _ := argString(args, 0)
+	if !strings.EqualFold(mech, "PLAIN") {
+		c.send(tag + " NO unsupported authentication mechanism")
+		return
+	}
+	resp, ok := argString(args, 1)
+	if !ok {
+		c.send("+ ")
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		resp = strings.TrimRight(line, "\r\n")
+	}
+	if resp == "*" {
+		c.send(tag + " BAD authentication cancelled")
+		return
+	}
+	raw, err := base64.StdEncoding.DecodeString(resp)
+	if err != nil {
+		c.send(tag + " BAD invalid base64")
+		return
+	}
+	parts := strings.SplitN(string(raw), "\x00", 3)
+	if len(parts) != 3 {
+		c.send(tag + " BAD invalid PLAIN response")
+		return
+	}
+	c.login(tag, parts[1], parts[2])
+}
+
+func (c *imapSession) load() error {
+	msgs, err := c.srv.inbox(c.user)
+	if err != nil {
+		return err
+	}
+	c.msgs = c.msgs[:0]
+	for _, m := range msgs {
+		c.msgs = append(c.msgs, &imapMessage{Message: m, uid: c.srv.uid(m.ID)})
+	}
+	return nil
+}
+
+func (c *imapSession) firstUnseen() int {
+	for i, m := range c.msgs {
+		if !c.srv.hasFlag(c.user, m.ID, `\Seen`) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func (c *imapSession) selectMailbox(tag, cmd string, args []any) {
+	name, _ := argString(args, 0)
+	c.selected = false
+	if !strings.EqualFold(name, "INBOX") {
+		c.send(tag + " NO no such mailbox")
+		return
+	}
+	if err := c.load(); err != nil {
+		c.send(tag + " NO cannot open mailbox")
+		return
+	}
+	c.selected = true
+	c.readOnly = cmd == "EXAMINE"
+
+	flags := strings.Join(imapFlags, " ")
+	c.untagged("FLAGS (" + flags + ")")
+	c.untagged(fmt.Sprintf("%d EXISTS", len(c.msgs)))
+	c.untagged("0 RECENT")
+	if n := c.firstUnseen(); n > 0 {
+		c.untagged(fmt.Sprintf("OK [UNSEEN %d] first unseen message", n))
+	}
+	c.untagged("OK [PERMANENTFLAGS (" + flags + ")] flags are kept until goshs restarts")
+	c.untagged(fmt.Sprintf("OK [UIDVALIDITY %d] UIDs valid", c.srv.uidValidity))
+	c.untagged(fmt.Sprintf("OK [UIDNEXT %d] predicted next UID", c.srv.uidNext()))
+	if c.readOnly {
+		c.send(tag + " OK [READ-ONLY] EXAMINE completed")
+	} else {
+		c.send(tag + " OK [READ-WRITE] SELECT completed")
+	}
+}
+
+func (c *imapSession) status(tag string, args []any) {
+	if len(args) < 2 {
+		c.send(tag + " BAD STATUS expects a mailbox and items")
+		return
+	}
+	name, _ := argString(args, 0)
+	items, ok := args[1].(imapList)
+	if !strings.EqualFold(name, "INBOX") || !ok {
+		c.send(tag + " NO no such mailbox")
+		return
+	}
+	msgs, err := c.srv.inbox(c.user)
+	if err != nil {
+		c.send(tag + " NO cannot open mailbox")
+		return
+	}
+	unseen := 0
+	for _, m := range msgs {
+		c.srv.uid(m.ID)
+		if !c.srv.hasFlag(c.user, m.ID, `\Seen`) {
+			unseen++
+		}
+	}
+
+	var out []string
+	for _, it := range items {
+		item, _ := it.(string)
+		switch strings.ToUpper(item) {
+		case "MESSAGES":
+			out = append(out, fmt.Sprintf("MESSAGES %d", len(msgs)))
+		case "RECENT":
+			out = append(out, "RECENT 0")
+		case "UIDNEXT":
+			out = append(out, fmt.Sprintf("UIDNEXT %d", c.srv.uidNext()))
+		case "UIDVALIDITY":
+			out = append(out, fmt.Sprintf("UIDVALIDITY %d", c.srv.uidValidity))
+		case "UNSEEN":
+			out = append(out, fmt.Sprintf("UNSEEN %d", unseen))
+		}
+	}
+	c.untagged("STATUS INBOX (" + strings.Join(out, " ") + ")")
+	c.send(tag + " OK STATUS completed")
+}
+
+// refresh reports messages removed (EXPUNGE) or added (EXISTS) since the
+// mailbox was loaded.
+func (c *imapSession) refresh() {
+	msgs, err := c.srv.inbox(c.user)
+	if err != nil {
+		return
+	}
+	current := map[string]bool{}
+	for _, m := range msgs {
+		current[m.ID] = true
+	}
+	for i := len(c.msgs) - 1; i >= 0; i-- {
+		if !current[c.msgs[i].ID] {
+			c.untagged(fmt.Sprintf("%d EXPUNGE", i+1))
+			c.msgs = slices.Delete(c.msgs, i, i+1)
+		}
+	}
+
+	known := map[string]bool{}
+	for _, m := range c.msgs {
+		known[m.ID] = true
+	}
+	added := false
+	for _, m := range msgs {
+		if !known[m.ID] {
+			c.msgs = append(c.msgs, &imapMessage{Message: m, uid: c.srv.uid(m.ID)})
+			added = true
+		}
+	}
+	if added {
+		c.untagged(fmt.Sprintf("%d EXISTS", len(c.msgs)))
+	}
+}
+
+// idle implements RFC 2177, polling the store for new mail until DONE.
+func (c *imapSession) idle(tag string) {
+	c.send("+ idling")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			line, err := c.r.ReadString('\n')
+			if err != nil || strings.EqualFold(strings.TrimSpace(line), "DONE") {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(idlePoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			c.send(tag + " OK IDLE terminated")
+			return
+		case <-ticker.C:
+			if c.selected {
+				c.refresh()
+			}
+		}
+	}
+}
+
+// selectedSet returns the indices of the messages a sequence or UID set refers to.
+func (c *imapSession) selectedSet(arg string, uid bool) ([]int, error) {
+	set, err := parseSeqSet(arg)
+	if err != nil {
+		return nil, err
+	}
+	var out []int
+	var maxUID uint32
+	if n := len(c.msgs); n > 0 {
+		maxUID = c.msgs[n-1].uid
+	}
+	for i, m := range c.msgs {
+		if uid && set.contains(m.uid, maxUID) || !uid && set.contains(uint32(i+1), uint32(len(c.msgs))) {
+			out = append(out, i)
+		}
+	}
+	return out, nil
+}
+
+func (c *imapSession) fetch(tag string, args []any, uid bool) {
+	seq, _ := argString(args, 0)
+	if len(args) < 2 {
+		c.send(tag + " BAD FETCH expects a sequence set and items")
+		return
+	}
+	idx, err := c.selectedSet(seq, uid)
+	if err != nil {
+		c.send(tag + " BAD " + err.Error())
+		return
+	}
+
+	var items []string
+	switch it := args[1].(type) {
+	case imapList:
+		for _, v := range it {
+			if s, ok := v.(string); ok {
+				items = append(items, s)
+			}
+		}
+	case string:
+		switch strings.ToUpper(it) {
+		case "ALL":
+			items = []string{"FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE"}
+		case "FAST":
+			items = []string{"FLAGS", "INTERNALDATE", "RFC822.SIZE"}
+		case "FULL":
+			items = []string{"FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE", "BODY"}
+		default:
+			items = []string{it}
+		}
+	}
+	if uid && !slices.ContainsFunc(items, func(s string) bool { return strings.EqualFold(s, "UID") }) {
+		items = append([]string{"UID"}, items...)
+	}
+
+	for _, i := range idx {
+		resp, err := c.fetchMessage(i, items)
+		if err != nil {
+			c.send(tag + " BAD " + err.Error())
+			return
+		}
+		c.untagged(fmt.Sprintf("%d FETCH (%s)", i+1, resp))
+	}
+	c.send(tag + " OK FETCH completed")
+}
+
+func (c *imapSession) fetchMessage(i int, items []string) (string, error) {
+	m := c.msgs[i]
+	var parsed *mimePart
+	msg := func() *mimePart {
+		if parsed == nil {
+			raw, err := c.srv.Store.Raw(m.ID)
+			if err != nil {
+				raw = nil
+			}
+			parsed = parseMIME(crlf(raw))
+		}
+		return parsed
+	}
+
+	var out []string
+	markSeen := false
+	for _, item := range items {
+		name := strings.ToUpper(item)
+		switch {
+		case name == "UID":
+			out = append(out, fmt.Sprintf("UID %d", m.uid))
+		case name == "FLAGS":
+			// rendered last so it reflects \Seen set by this fetch
+		case name == "INTERNALDATE":
+			out = append(out, "INTERNALDATE "+imapQuote(m.ReceivedAt.Format("02-Jan-2006 15:04:05 -0700")))
+		case name == "RFC822.SIZE":
+			out = append(out, fmt.Sprintf("RFC822.SIZE %d", len(msg().header)+len(msg().body)))
+		case name == "ENVELOPE":
+			out = append(out, "ENVELOPE "+msg().envelope())
+		case name == "BODYSTRUCTURE":
+			out = append(out, "BODYSTRUCTURE "+msg().bodyStructure(true))
+		case name == "BODY":
+			out = append(out, "BODY "+msg().bodyStructure(false))
+		case name == "RFC822":
+			data, _ := msg().section("")
+			out = append(out, "RFC822 "+literal(data))
+			markSeen = true
+		case name == "RFC822.HEADER":
+			data, _ := msg().section("HEADER")
+			out = append(out, "RFC822.HEADER "+literal(data))
+		case name == "RFC822.TEXT":
+			data, _ := msg().section("TEXT")
+			out = append(out, "RFC822.TEXT "+literal(data))
+			markSeen = true
+		case strings.HasPrefix(name, "BODY[") || strings.HasPrefix(name, "BODY.PEEK["):
+			peek := strings.HasPrefix(name, "BODY.PEEK[")
+			open := strings.IndexByte(name, '[')
+			closeIdx := strings.LastIndexByte(name, ']')
+			if closeIdx < open {
+				return "", fmt.Errorf("invalid fetch item %s", item)
+			}
+			section := name[open+1 : closeIdx]
+			data, ok := msg().section(section)
+			if !ok {
+				data = nil
+			}
+			key := "BODY[" + section + "]"
+			if partial := name[closeIdx+1:]; partial != "" {
+				start, count, err := parsePartial(partial)
+				if err != nil {
+					return "", err
+				}
+				data = sliceRange(data, start, count)
+				key += fmt.Sprintf("<%d>", start)
+			}
+			out = append(out, key+" "+literal(data))
+			if !peek {
+				markSeen = true
+			}
+		default:
+			return "", fmt.Errorf("unsupported fetch item %s", item)
+		}
+	}
+
+	wantFlags := slices.ContainsFunc(items, func(s string) bool { return strings.EqualFold(s, "FLAGS") })
+	if markSeen && !c.readOnly && !c.srv.hasFlag(c.user, m.ID, `\Seen`) {
+		c.srv.setFlags(c.user, m.ID, "+", []string{`\Seen`})
+		wantFlags = true
+	}
+	if wantFlags {
+		out = append(out, "FLAGS ("+strings.Join(c.srv.getFlags(c.user, m.ID), " ")+")")
+	}
+	return strings.Join(out, " "), nil
+}
+
+func literal(data []byte) string {
+	return fmt.Sprintf("{%d}\r\n%s", len(data), data)
+}
+
+func parsePartial(s string) (int, int, error) {
+	inner := strings.TrimSuffix(strings.TrimPrefix(s, "<"), ">")
+	a, b, ok := strings.Cut(inner, ".")
+	start, err1 := strconv.Atoi(a)
+	count, err2 := strconv.Atoi(b)
+	if !ok || err1 != nil || err2 != nil || start < 0 || count < 0 {
+		return 0, 0, fmt.Errorf("invalid partial %s", s)
+	}
+	return start, count, nil
+}
+
+func sliceRange(data []byte, start, count int) []byte {
+	if start >= len(data) {
+		return nil
+	}
+	return data[start:min(start+count, len(data))]
+}
+
+func (c *imapSession) store(tag string, args []any, uid bool) {
+	seq, _ := argString(args, 0)
+	op, _ := argString(args, 1)
+	if len(args) < 3 {
+		c.send(tag + " BAD STORE expects a sequence set, an operation and flags")
+		return
+	}
+	if c.readOnly {
+		c.send(tag + " NO mailbox is read-only")
+		return
+	}
+	idx, err := c.selectedSet(seq, uid)
+	if err != nil {
+		c.send(tag + " BAD " + err.Error())
+		return
+	}
+
+	op = strings.ToUpper(op)
+	silent := strings.HasSuffix(op, ".SILENT")
+	op = strings.TrimSuffix(op, ".SILENT")
+	mode := ""
+	switch op {
+	case "+FLAGS":
+		mode = "+"
+	case "-FLAGS":
+		mode = "-"
+	case "FLAGS":
+	default:
+		c.send(tag + " BAD unknown STORE operation")
+		return
+	}
+
+	var flags []string
+	switch f := args[2].(type) {
+	case imapList:
+		for _, v := range f {
+			if s, ok := v.(string); ok {
+				flags = append(flags, s)
+			}
+		}
+	case string:
+		flags = strings.Fields(f)
+	}
+
+	for _, i := range idx {
+		m := c.msgs[i]
+		c.srv.setFlags(c.user, m.ID, mode, flags)
+		if !silent {
+			resp := "FLAGS (" + strings.Join(c.srv.getFlags(c.user, m.ID), " ") + ")"
+			if uid {
+				resp = fmt.Sprintf("UID %d %s", m.uid, resp)
+			}
+			c.untagged(fmt.Sprintf("%d FETCH (%s)", i+1, resp))
+		}
+	}
+	c.send(tag + " OK STORE completed")
+}
+
+// expunge removes messages flagged \Deleted from the store.
+func (c *imapSession) expunge(report bool) {
+	if c.readOnly {
+		return
+	}
+	for i := len(c.msgs) - 1; i >= 0; i-- {
+		m := c.msgs[i]
+		if !c.srv.hasFlag(c.user, m.ID, `\Deleted`) {
+			continue
+		}
+		if err := c.srv.Store.Delete(m.ID); err != nil && err != mailstore.ErrNotFound {
+			logger.Warnf("IMAP expunge %s: %v", m.ID, err)
+			continue
+		}
+		c.srv.forget(c.user, m.ID)
+		c.msgs = slices.Delete(c.msgs, i, i+1)
+		if report {
+			c.untagged(fmt.Sprintf("%d EXPUNGE", i+1))
+		}
+	}
+}
+
+func (c *imapSession) search(tag string, args []any, uid bool) {
+	if s, ok := argString(args, 0); ok && strings.EqualFold(s, "CHARSET") {
+		args = args[min(2, len(args)):]
+	}
+	if len(args) == 0 {
+		args = []any{"ALL"}
+	}
+
+	var hits []string
+	for i, m := range c.msgs {
+		match, err := c.matches(i, m, args)
+		if err != nil {
+			c.send(tag + " BAD " + err.Error())
+			return
+		}
+		if match {
+			if uid {
+				hits = append(hits, strconv.FormatUint(uint64(m.uid), 10))
+			} else {
+				hits = append(hits, strconv.Itoa(i+1))
+			}
+		}
+	}
+	c.untagged(strings.TrimSpace("SEARCH " + strings.Join(hits, " ")))
+	c.send(tag + " OK SEARCH completed")
+}
+
+// matches evaluates a list of search keys (implicitly ANDed) for a message.
+func (c *imapSession) matches(i int, m *imapMessage, keys []any) (bool, error) {
+	var parsed *mimePart
+	msg := func() *mimePart {
+		if parsed == nil {
+			raw, _ := c.srv.Store.Raw(m.ID)
+			parsed = parseMIME(crlf(raw))
+		}
+		return parsed
+	}
+	flag := func(f string) bool { return c.srv.hasFlag(c.user, m.ID, f) }
+	contains := func(haystack, needle string) bool {
+		return strings.Contains(strings.ToLower(haystack), strings.ToLower(needle))
+	}
+
+	var eval func(keys []any) (bool, []any, error)
+	eval = func(keys []any) (bool, []any, error) {
+		if list, ok := keys[0].(imapList); ok {
+			res, err := c.matches(i, m, list)
+			return res, keys[1:], err
+		}
+		key := strings.ToUpper(keys[0].(string))
+		rest := keys[1:]
+		str := func() (string, error) {
+			if len(rest) == 0 {
+				return "", fmt.Errorf("search key %s needs an argument", key)
+			}
+			s, ok := rest[0].(string)
+			if !ok {
+				return "", fmt.Errorf("search key %s needs a string", key)
+			}
+			rest = rest[1:]
+			return s, nil
+		}
+
+		switch key {
+		case "ALL", "OLD":
+			return true, rest, nil
+		case "NEW", "UNSEEN":
+			return !flag(`\Seen`), rest, nil
+		case "RECENT":
+			return false, rest, nil
+		case "SEEN", "DELETED", "FLAGGED", "ANSWERED", "DRAFT":
+			return flag(`\` + strings.ToUpper(key[:1]) + strings.ToLower(key[1:])), rest, nil
+		case "UNDELETED", "UNFLAGGED", "UNANSWERED", "UNDRAFT":
+			f := key[2:]
+			return !flag(`\` + f[:1] + strings.ToLower(f[1:])), rest, nil
+		case "FROM", "TO", "CC", "BCC", "SUBJECT":
+			s, err := str()
+			return contains(msg().hdr.Get(key), s), rest, err
+		case "HEADER":
+			field, err := str()
+			if err != nil {
+				return false, rest, err
+			}
+			s, err := str()
+			values := msg().hdr.Values(field)
+			return len(values) > 0 && contains(strings.Join(values, "\n"), s), rest, err
+		case "BODY":
+			s, err := str()
+			return contains(string(msg().body), s), rest, err
+		case "TEXT":
+			s, err := str()
+			return contains(string(msg().header)+string(msg().body), s), rest, err
+		case "LARGER", "SMALLER":
+			s, err := str()
+			if err != nil {
+				return false, rest, err
+			}
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return false, rest, fmt.Errorf("invalid size %q", s)
+			}
+			if key == "LARGER" {
+				return m.Size > n, rest, nil
+			}
+			return m.Size < n, rest, nil
+		case "BEFORE", "ON", "SINCE", "SENTBEFORE", "SENTON", "SENTSINCE":
+			s, err := str()
+			if err != nil {
+				return false, rest, err
+			}
+			day, err := time.Parse("2-Jan-2006", s)
+			if err != nil {
+				return false, rest, fmt.Errorf("invalid date %q", s)
+			}
+			t := m.ReceivedAt
+			if strings.HasPrefix(key, "SENT") {
+				if d, err := mail.ParseDate(msg().hdr.Get("Date")); err == nil {
+					t = d
+				}
+			}
+			d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+			switch strings.TrimPrefix(key, "SENT") {
+			case "BEFORE":
+				return d.Before(day), rest, nil
+			case "ON":
+				return d.Equal(day), rest, nil
+			default:
+				return !d.Before(day), rest, nil
+			}
+		case "UID":
+			s, err := str()
+			if err != nil {
+				return false, rest, err
+			}
+			set, err := parseSeqSet(s)
+			if err != nil {
+				return false, rest, err
+			}
+			return set.contains(m.uid, c.msgs[len(c.msgs)-1].uid), rest, nil
+		case "NOT":
+			if len(rest) == 0 {
+				return false, rest, fmt.Errorf("NOT needs a search key")
+			}
+			res, rest, err := eval(rest)
+			return !res, rest, err
+		case "OR":
+			if len(rest) == 0 {
+				return false, rest, fmt.Errorf("OR needs two search keys")
+			}
+			a, rest, err := eval(rest)
+			if err != nil || len(rest) == 0 {
+				return false, rest, fmt.Errorf("OR needs two search keys")
+			}
+			b, rest, err := eval(rest)
+			return a || b, rest, err
+		}
+
+		// A bare sequence set
+		if set, err := parseSeqSet(key); err == nil {
+			return set.contains(uint32(i+1), uint32(len(c.msgs))), rest, nil
+		}
+		return false, rest, fmt.Errorf("unsupported search key %s", key)
+	}
+
+	for len(keys) > 0 {
+		res, rest, err := eval(keys)
+		if err != nil {
+			return false, err
+		}
+		if !res {
+			return false, nil
+		}
+		keys = rest
+	}
+	return true, nil
+}
@@ -0,0 +1,273 @@
+package mailserver
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/mailstore"
+	"goshs.de/goshs/v2/options"
+)
+
+func startIMAP(t *testing.T, opts *options.Options, store *mailstore.Store) string {
+	t.Helper()
+	srv := NewIMAPServer(opts, store)
+	require.NoError(t, srv.setupTLS())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.serve(ln)
+	t.Cleanup(func() { ln.Close() })
+	return ln.Addr().String()
+}
+
+// response reads an IMAP response line, inlining any literals.
+func (c *lineClient) response() string {
+	c.t.Helper()
+	var sb strings.Builder
+	for {
+		l := c.line()
+		sb.WriteString(l)
+		open := strings.LastIndexByte(l, '{')
+		if !strings.HasSuffix(l, "}") || open < 0 {
+			return sb.String()
+		}
+		n, err := strconv.Atoi(l[open+1 : len(l)-1])
+		require.NoError(c.t, err)
+		buf := make([]byte, n)
+		_, err = io.ReadFull(c.r, buf)
+		require.NoError(c.t, err)
+		sb.WriteString("\r\n")
+		sb.Write(buf)
+	}
+}
+
+// imap sends a tagged command and returns the untagged responses and the
+// tagged completion line.
+func (c *lineClient) imap(tag, cmd string) ([]string, string) {
+	c.t.Helper()
+	_, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, cmd)
+	require.NoError(c.t, err)
+	var untagged []string
+	for {
+		l := c.response()
+		if strings.HasPrefix(l, tag+" ") {
+			return untagged, l
+		}
+		untagged = append(untagged, l)
+	}
+}
+
+func TestIMAP_LoginSelectFetch(t *testing.T) {
+	store := newTestStore(t)
+	c := dial(t, startIMAP(t, &options.Options{Password: "pw"}, store))
+	require.Contains(t, c.line(), "IMAP4rev1")
+
+	_, done := c.imap("a1", "SELECT INBOX")
+	require.Equal(t, "a1 NO not authenticated", done)
+
+	_, done = c.imap("a2", `LOGIN "bob@corp.local" wrong`)
+	require.Contains(t, done, "a2 NO")
+	_, done = c.imap("a3", `LOGIN "bob@corp.local" pw`)
+	require.Contains(t, done, "a3 OK")
+
+	untagged, done := c.imap("a4", "LIST \"\" \"*\"")
+	require.Equal(t, []string{`* LIST () "/" INBOX`}, untagged)
+	require.Contains(t, done, "OK")
+
+	untagged, done = c.imap("a5", "SELECT INBOX")
+	require.Contains(t, done, "a5 OK [READ-WRITE]")
+	require.Contains(t, untagged, "* 1 EXISTS")
+	require.Contains(t, untagged, "* OK [UNSEEN 1] first unseen message")
+
+	untagged, done = c.imap("a6", "SEARCH UNSEEN SUBJECT \"password\"")
+	require.Equal(t, []string{"* SEARCH 1"}, untagged)
+	require.Contains(t, done, "OK")
+
+	untagged, _ = c.imap("a7", "FETCH 1 (UID FLAGS RFC822.SIZE ENVELOPE BODY.PEEK[HEADER.FIELDS (SUBJECT)])")
+	require.Len(t, untagged, 1)
+	require.Contains(t, untagged[0], "* 1 FETCH (UID 1 ")
+	require.Contains(t, untagged[0], `"Reset your password" (("Alice" NIL "alice" "example.com"))`)
+	require.Contains(t, untagged[0], "BODY[HEADER.FIELDS (SUBJECT)] {")
+	require.Contains(t, untagged[0], "Subject: Reset your password\r\n\r\n")
+	require.Contains(t, untagged[0], "FLAGS ()")
+
+	// BODY[] sets \Seen and reports it
+	untagged, _ = c.imap("a8", "UID FETCH 1 (BODY[])")
+	require.Len(t, untagged, 1)
+	require.Contains(t, untagged[0], "Click here\r\n.hidden line")
+	require.Contains(t, untagged[0], `FLAGS (\Seen)`)
+
+	untagged, _ = c.imap("a9", "SEARCH UNSEEN")
+	require.Equal(t, []string{"* SEARCH"}, untagged)
+
+	untagged, _ = c.imap("a10", "FETCH 1 BODYSTRUCTURE")
+	require.Equal(t, []string{`* 1 FETCH (BODYSTRUCTURE ("TEXT" "PLAIN" NIL NIL NIL "7BIT" 31 3 NIL NIL NIL NIL))`}, untagged)
+
+	_, done = c.imap("a11", "LOGOUT")
+	require.Contains(t, done, "OK")
+}
+
+func TestIMAP_StoreExpunge(t *testing.T) {
+	store := newTestStore(t)
+	c := dial(t, startIMAP(t, &options.Options{}, store))
+	c.line()
+
+	c.imap("a1", "LOGIN bob@corp.local x")
+	c.imap("a2", "SELECT INBOX")
+
+	untagged, _ := c.imap("a3", `STORE 1 +FLAGS (\Deleted \Flagged)`)
+	require.Equal(t, []string{`* 1 FETCH (FLAGS (\Flagged \Deleted))`}, untagged)
+
+	untagged, _ = c.imap("a4", `SEARCH DELETED`)
+	require.Equal(t, []string{"* SEARCH 1"}, untagged)
+
+	untagged, done := c.imap("a5", "EXPUNGE")
+	require.Equal(t, []string{"* 1 EXPUNGE"}, untagged)
+	require.Contains(t, done, "OK")
+
+	bob, err := store.List("bob@corp.local")
+	require.NoError(t, err)
+	require.Empty(t, bob)
+	carol, err := store.List("carol@corp.local")
+	require.NoError(t, err)
+	require.Len(t, carol, 1)
+}
+
+func TestIMAP_ExamineIsReadOnly(t *testing.T) {
+	store := newTestStore(t)
+	c := dial(t, startIMAP(t, &options.Options{}, store))
+	c.line()
+
+	c.imap("a1", "LOGIN bob@corp.local x")
+	_, done := c.imap("a2", "EXAMINE INBOX")
+	require.Contains(t, done, "[READ-ONLY]")
+	_, done = c.imap("a3", `STORE 1 +FLAGS (\Deleted)`)
+	require.Contains(t, done, "a3 NO")
+	untagged, _ := c.imap("a4", "FETCH 1 (BODY[TEXT])")
+	require.NotContains(t, untagged[0], `\Seen`)
+}
+
+func TestIMAP_AuthenticatePlainAndStatus(t *testing.T) {
+	store := newTestStore(t)
+	c := dial(t, startIMAP(t, &options.Options{}, store))
+	c.line()
+
+	ir := base64.StdEncoding.EncodeToString([]byte("\x00carol@corp.local\x00x"))
+	_, done := c.imap("a1", "AUTHENTICATE PLAIN "+ir)
+	require.Contains(t, done, "a1 OK")
+
+	untagged, _ := c.imap("a2", "STATUS INBOX (MESSAGES UNSEEN)")
+	require.Equal(t, []string{"* STATUS INBOX (MESSAGES 1 UNSEEN 1)"}, untagged)
+}
+
+func TestIMAP_StartTLSAndLiteralLogin(t *testing.T) {
+	store := newTestStore(t)
+	c := dial(t, startIMAP(t, &options.Options{Password: "pw"}, store))
+	c.line()
+
+	untagged, _ := c.imap("a1", "CAPABILITY")
+	require.Contains(t, untagged[0], "STARTTLS")
+	_, done := c.imap("a2", "STARTTLS")
+	require.Contains(t, done, "a2 OK")
+	c.startTLS()
+
+	untagged, _ = c.imap("a3", "CAPABILITY")
+	require.NotContains(t, untagged[0], "STARTTLS")
+
+	_, err := fmt.Fprintf(c.conn, "a4 LOGIN {14}\r\n")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(c.line(), "+"))
+	_, err = fmt.Fprintf(c.conn, "bob@corp.local pw\r\n")
+	require.NoError(t, err)
+	require.Contains(t, c.line(), "a4 OK")
+}
+
+func TestSeqSet(t *testing.T) {
+	set, err := parseSeqSet("1,3:4,7:*")
+	require.NoError(t, err)
+	require.True(t, set.contains(1, 9))
+	require.False(t, set.contains(2, 9))
+	require.True(t, set.contains(4, 9))
+	require.True(t, set.contains(9, 9))
+
+	_, err = parseSeqSet("0")
+	require.Error(t, err)
+	_, err = parseSeqSet("a:b")
+	require.Error(t, err)
+}
+
+func TestIMAPParser(t *testing.T) {
+	p := &imapParser{s: []byte("\"a \\\"b\\\"\" {3}\r\nxyz (FLAGS BODY[HEADER.FIELDS (TO)]<0.10>) NIL\r\n")}
+	args, err := p.args()
+	require.NoError(t, err)
+	require.Equal(t, []any{`a "b"`, "xyz", imapList{"FLAGS", "BODY[HEADER.FIELDS (TO)]<0.10>"}, "NIL"}, args)
+
+	_, err = (&imapParser{s: []byte("(unterminated")}).args()
+	require.Error(t, err)
+
+	require.Equal(t, `"say \"hi\""`, imapQuote(`say "hi"`))
+	require.Equal(t, "{4}\r\na\r\nb", imapQuote("a\r\nb"))
+	require.Equal(t, "NIL", imapNString(""))
+}
+
+func TestMIMESections(t *testing.T) {
+	raw := "From: a@example.com\r\nSubject: multi\r\nContent-Type: multipart/mixed; boundary=XX\r\n\r\n" +
+		"preamble\r\n--XX\r\nContent-Type: text/plain\r\n\r\nhello\r\n" +
+		"--XX\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=a.pdf\r\n\r\nPDF\r\n--XX--\r\n"
+	m := parseMIME([]byte(raw))
+	require.Len(t, m.children, 2)
+
+	b, ok := m.section("1")
+	require.True(t, ok)
+	require.Equal(t, "hello", string(b))
+
+	b, ok = m.section("2.MIME")
+	require.True(t, ok)
+	require.Contains(t, string(b), "filename=a.pdf")
+
+	b, ok = m.section("HEADER.FIELDS (SUBJECT)")
+	require.True(t, ok)
+	require.Equal(t, "Subject: multi\r\n\r\n", string(b))
+
+	b, ok = m.section("HEADER.FIELDS.NOT (SUBJECT CONTENT-TYPE)")
+	require.True(t, ok)
+	require.Equal(t, "From: a@example.com\r\n\r\n", string(b))
+
+	_, ok = m.section("3")
+	require.False(t, ok)
+
+	bs := m.bodyStructure(true)
+	require.Contains(t, bs, `("TEXT" "PLAIN" NIL NIL NIL "7BIT" 5 0 NIL NIL NIL NIL)`)
+	require.Contains(t, bs, `("ATTACHMENT" ("FILENAME" "a.pdf"))`)
+	require.Contains(t, bs, ` "MIXED" ("BOUNDARY" "XX")`)
+}
+
+func TestIMAP_IdleReportsNewMail(t *testing.T) {
+	old := idlePoll
+	idlePoll = 20 * time.Millisecond
+	defer func() { idlePoll = old }()
+
+	store := newTestStore(t)
+	c := dial(t, startIMAP(t, &options.Options{}, store))
+	c.line()
+	c.imap("a1", "LOGIN bob@corp.local x")
+	c.imap("a2", "SELECT INBOX")
+
+	_, err := fmt.Fprintf(c.conn, "a3 IDLE\r\n")
+	require.NoError(t, err)
+	require.Equal(t, "+ idling", c.line())
+
+	_, err = store.Save("mallory@example.com", []string{"bob@corp.local"}, []byte(testMessage))
+	require.NoError(t, err)
+	require.Equal(t, "* 2 EXISTS", c.line())
+
+	_, err = fmt.Fprintf(c.conn, "DONE\r\n")
+	require.NoError(t, err)
+	require.Equal(t, "a3 OK IDLE terminated", c.line())
+}
@@ -0,0 +1,307 @@
+package mailserver
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// mimePart is a node of a parsed message. header and body are the raw bytes
+// as stored, which is what BODY[section] has to return.
+type mimePart struct {
+	header   []byte
+	body     []byte
+	hdr      textproto.MIMEHeader
+	typ      string // lower case, e.g. "text"
+	subtype  string // lower case, e.g. "plain"
+	params   map[string]string
+	children []*mimePart // multipart/*
+	message  *mimePart   // message/rfc822
+}
+
+// parseMIME splits a CRLF message into its MIME tree.
+func parseMIME(raw []byte) *mimePart {
+	p := &mimePart{}
+	if idx := bytes.Index(raw, []byte("\r\n\r\n")); idx >= 0 {
+		p.header, p.body = raw[:idx+4], raw[idx+4:]
+	} else if bytes.HasPrefix(raw, []byte("\r\n")) {
+		p.header, p.body = raw[:2], raw[2:]
+	} else {
+		p.header = raw
+	}
+
+	p.hdr = make(textproto.MIMEHeader)
+	if msg, err := mail.ReadMessage(bytes.NewReader(append(slices.Clip(p.header), "\r\n"...))); err == nil {
+		p.hdr = textproto.MIMEHeader(msg.Header)
+	}
+	return p.parseContentType(false)
+}
+
+func (p *mimePart) parseContentType(digest bool) *mimePart {
+	p.typ, p.subtype = "text", "plain"
+	if digest {
+		p.typ, p.subtype = "message", "rfc822"
+	}
+	p.params = map[string]string{}
+	if ct := p.hdr.Get("Content-Type"); ct != "" {
+		if mediaType, params, err := mime.ParseMediaType(ct); err == nil {
+			if t, s, ok := strings.Cut(mediaType, "/"); ok {
+				p.typ, p.subtype = t, s
+			}
+			p.params = params
+		}
+	}
+
+	switch {
+	case p.typ == "multipart" && p.params["boundary"] != "":
+		for _, raw := range splitMultipart(p.body, p.params["boundary"]) {
+			child := parseMIME(raw)
+			if p.subtype == "digest" && child.hdr.Get("Content-Type") == "" {
+				child.parseContentType(true)
+			}
+			p.children = append(p.children, child)
+		}
+	case p.typ == "message" && p.subtype == "rfc822":
+		p.message = parseMIME(p.body)
+	}
+	return p
+}
+
+// splitMultipart returns the raw body parts between the boundary delimiters.
+func splitMultipart(body []byte, boundary string) [][]byte {
+	delim := []byte("\r\n--" + boundary)
+	data := append([]byte("\r\n"), body...)
+
+	var parts [][]byte
+	segments := bytes.Split(data, delim)
+	for _, seg := range segments[1:] {
+		if bytes.HasPrefix(seg, []byte("--")) {
+			break
+		}
+		// Skip transport padding up to the end of the delimiter line
+		if idx := bytes.Index(seg, []byte("\r\n")); idx >= 0 {
+			parts = append(parts, seg[idx+2:])
+		}
+	}
+	return parts
+}
+
+// part resolves a section part path such as "1.2".
+func (p *mimePart) part(path []int) *mimePart {
+	cur := p
+	for _, n := range path {
+		if cur.message != nil {
+			cur = cur.message
+		}
+		switch {
+		case cur.children != nil:
+			if n < 1 || n > len(cur.children) {
+				return nil
+			}
+			cur = cur.children[n-1]
+		case n == 1:
+			// The body of a non-multipart message is part 1
+		default:
+			return nil
+		}
+	}
+	return cur
+}
+
+// section returns the content of BODY[section].
+func (p *mimePart) section(spec string) ([]byte, bool) {
+	var path []int
+	rest := spec
+	for rest != "" {
+		num, tail, _ := strings.Cut(rest, ".")
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			break
+		}
+		path = append(path, n)
+		rest = tail
+	}
+
+	target := p.part(path)
+	if target == nil {
+		return nil, false
+	}
+	if rest == "" {
+		if len(path) == 0 {
+			return append(slices.Clip(p.header), p.body...), true
+		}
+		return target.body, true
+	}
+
+	name, fields, _ := strings.Cut(strings.ToUpper(rest), " ")
+	if name == "MIME" {
+		if len(path) == 0 {
+			return nil, false
+		}
+		return target.header, true
+	}
+	// HEADER and TEXT of a part address its encapsulated message
+	if len(path) > 0 {
+		if target.message == nil {
+			return nil, false
+		}
+		target = target.message
+	}
+
+	switch name {
+	case "HEADER":
+		return target.header, true
+	case "TEXT":
+		return target.body, true
+	case "HEADER.FIELDS", "HEADER.FIELDS.NOT":
+		list := strings.Fields(strings.Trim(fields, "()"))
+		return filterHeader(target.header, list, name == "HEADER.FIELDS.NOT"), true
+	}
+	return nil, false
+}
+
+// filterHeader keeps (or with not, drops) the named header fields.
+func filterHeader(header []byte, names []string, not bool) []byte {
+	want := map[string]bool{}
+	for _, n := range names {
+		want[strings.ToLower(strings.Trim(n, `"`))] = true
+	}
+
+	var out []byte
+	keep := false
+	for line := range bytes.Lines(header) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			break
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			name, _, _ := bytes.Cut(line, []byte(":"))
+			keep = want[strings.ToLower(string(bytes.TrimSpace(name)))] != not
+		}
+		if keep {
+			out = append(out, line...)
+		}
+	}
+	return append(out, "\r\n"...)
+}
+
+// bodyStructure renders BODY (ext false) or BODYSTRUCTURE (ext true).
+func (p *mimePart) bodyStructure(ext bool) string {
+	var sb strings.Builder
+	sb.WriteByte('(')
+	if p.children != nil {
+		for _, c := range p.children {
+			sb.WriteString(c.bodyStructure(ext))
+		}
+		sb.WriteString(" " + imapQuote(strings.ToUpper(p.subtype)))
+		if ext {
+			sb.WriteString(" " + paramList(p.params) + " " + p.disposition() + " NIL NIL")
+		}
+		sb.WriteByte(')')
+		return sb.String()
+	}
+
+	encoding := strings.ToUpper(p.hdr.Get("Content-Transfer-Encoding"))
+	if encoding == "" {
+		encoding = "7BIT"
+	}
+	fmt.Fprintf(&sb, "%s %s %s %s %s %s %d",
+		imapQuote(strings.ToUpper(p.typ)), imapQuote(strings.ToUpper(p.subtype)),
+		paramList(p.params), imapNString(p.hdr.Get("Content-ID")),
+		imapNString(p.hdr.Get("Content-Description")), imapQuote(encoding), len(p.body))
+	switch {
+	case p.message != nil:
+		fmt.Fprintf(&sb, " %s %s %d", p.message.envelope(), p.message.bodyStructure(ext), lineCount(p.body))
+	case p.typ == "text":
+		fmt.Fprintf(&sb, " %d", lineCount(p.body))
+	}
+	if ext {
+		sb.WriteString(" NIL " + p.disposition() + " NIL NIL")
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+func (p *mimePart) disposition() string {
+	cd := p.hdr.Get("Content-Disposition")
+	if cd == "" {
+		return "NIL"
+	}
+	disp, params, err := mime.ParseMediaType(cd)
+	if err != nil {
+		return "NIL"
+	}
+	return fmt.Sprintf("(%s %s)", imapQuote(strings.ToUpper(disp)), paramList(params))
+}
+
+func paramList(params map[string]string) string {
+	if len(params) == 0 {
+		return "NIL"
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, imapQuote(strings.ToUpper(k)), imapQuote(params[k]))
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+func lineCount(b []byte) int {
+	return bytes.Count(b, []byte("\n"))
+}
+
+// envelope renders the ENVELOPE structure of a message header.
+func (p *mimePart) envelope() string {
+	dec := new(mime.WordDecoder)
+	decode := func(s string) string {
+		if d, err := dec.DecodeHeader(s); err == nil {
+			return d
+		}
+		return s
+	}
+
+	from := addressList(p.hdr.Get("From"))
+	sender := addressList(p.hdr.Get("Sender"))
+	if sender == "NIL" {
+		sender = from
+	}
+	replyTo := addressList(p.hdr.Get("Reply-To"))
+	if replyTo == "NIL" {
+		replyTo = from
+	}
+	return fmt.Sprintf("(%s %s %s %s %s %s %s %s %s %s)",
+		imapNString(p.hdr.Get("Date")),
+		imapNString(decode(p.hdr.Get("Subject"))),
+		from, sender, replyTo,
+		addressList(p.hdr.Get("To")),
+		addressList(p.hdr.Get("Cc")),
+		addressList(p.hdr.Get("Bcc")),
+		imapNString(p.hdr.Get("In-Reply-To")),
+		imapNString(p.hdr.Get("Message-Id")))
+}
+
+func addressList(value string) string {
+	if value == "" {
+		return "NIL"
+	}
+	addrs, err := mail.ParseAddressList(value)
+	if err != nil || len(addrs) == 0 {
+		return "NIL"
+	}
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for _, a := range addrs {
+		local, host, _ := strings.Cut(a.Address, "@")
+		fmt.Fprintf(&sb, "(%s NIL %s %s)", imapNString(a.Name), imapNString(local), imapNString(host))
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
@@ -0,0 +1,247 @@
+package mailserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// imapList is a parenthesised list in an IMAP command.
+type imapList []any
+
+// readIMAPCommand reads one command line including any literals. For
+// synchronising literals ({n}) the continuation request is sent via cont.
+func readIMAPCommand(r *bufio.Reader, cont func()) ([]byte, error) {
+	var buf []byte
+	for {
+		line, err := r.ReadSlice('\n')
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+			return nil, err
+		}
+		buf = append(buf, line...)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+
+		trimmed := strings.TrimRight(string(line), "\r\n")
+		if !strings.HasSuffix(trimmed, "}") {
+			return buf, nil
+		}
+		open := strings.LastIndexByte(trimmed, '{')
+		if open < 0 {
+			return buf, nil
+		}
+		spec := trimmed[open+1 : len(trimmed)-1]
+		nonSync := strings.HasSuffix(spec, "+")
+		n, err := strconv.Atoi(strings.TrimSuffix(spec, "+"))
+		if err != nil || n < 0 || n > 10<<20 {
+			return buf, nil
+		}
+		if !nonSync {
+			cont()
+		}
+		lit := make([]byte, n)
+		if _, err := io.ReadFull(r, lit); err != nil {
+			return nil, err
+		}
+		buf = append(buf, lit...)
+	}
+}
+
+// imapParser tokenises command arguments into atoms, strings and lists.
+type imapParser struct {
+	s   []byte
+	pos int
+}
+
+func (p *imapParser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *imapParser) done() bool {
+	p.skipSpace()
+	return p.pos >= len(p.s) || p.s[p.pos] == '\r' || p.s[p.pos] == '\n'
+}
+
+// next returns the next argument: a string for atoms, quoted strings and
+// literals, or an imapList.
+func (p *imapParser) next() (any, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return nil, errors.New("missing argument")
+	}
+	switch p.s[p.pos] {
+	case '(':
+		p.pos++
+		var list imapList
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.s) {
+				return nil, errors.New("unterminated list")
+			}
+			if p.s[p.pos] == ')' {
+				p.pos++
+				return list, nil
+			}
+			item, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+	case '"':
+		p.pos++
+		var sb strings.Builder
+		for p.pos < len(p.s) {
+			c := p.s[p.pos]
+			p.pos++
+			switch c {
+			case '\\':
+				if p.pos < len(p.s) {
+					sb.WriteByte(p.s[p.pos])
+					p.pos++
+				}
+			case '"':
+				return sb.String(), nil
+			default:
+				sb.WriteByte(c)
+			}
+		}
+		return nil, errors.New("unterminated quoted string")
+	case '{':
+		end := p.pos
+		for end < len(p.s) && p.s[end] != '}' {
+			end++
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(string(p.s[p.pos+1:end]), "+"))
+		if err != nil || end+3+n > len(p.s) {
+			return nil, errors.New("invalid literal")
+		}
+		start := end + 3 // "}\r\n"
+		p.pos = start + n
+		return string(p.s[start : start+n]), nil
+	}
+	return p.atom(), nil
+}
+
+// atom reads an atom. Brackets are kept together so fetch items such as
+// BODY[HEADER.FIELDS (FROM TO)]<0.100> stay a single token.
+func (p *imapParser) atom() string {
+	start := p.pos
+	depth := 0
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if depth == 0 && (c == ' ' || c == '(' || c == ')' || c == '\r' || c == '\n') {
+			break
+		}
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+		p.pos++
+	}
+	return string(p.s[start:p.pos])
+}
+
+// args parses the remaining arguments.
+func (p *imapParser) args() ([]any, error) {
+	var out []any
+	for !p.done() {
+		a, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// argString returns args[i] if it is a string.
+func argString(args []any, i int) (string, bool) {
+	if i >= len(args) {
+		return "", false
+	}
+	s, ok := args[i].(string)
+	return s, ok
+}
+
+// seqRange is an inclusive range of a sequence set; 0 stands for "*".
+type seqRange struct{ from, to uint32 }
+
+type seqSet []seqRange
+
+func parseSeqSet(s string) (seqSet, error) {
+	var set seqSet
+	for part := range strings.SplitSeq(s, ",") {
+		a, b, isRange := strings.Cut(part, ":")
+		from, err := parseSeqNum(a)
+		if err != nil {
+			return nil, err
+		}
+		to := from
+		if isRange {
+			if to, err = parseSeqNum(b); err != nil {
+				return nil, err
+			}
+		}
+		set = append(set, seqRange{from, to})
+	}
+	return set, nil
+}
+
+func parseSeqNum(s string) (uint32, error) {
+	if s == "*" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid sequence number %q", s)
+	}
+	return uint32(n), nil
+}
+
+// contains reports whether n is in the set, with max substituted for "*".
+func (set seqSet) contains(n, max uint32) bool {
+	for _, r := range set {
+		from, to := r.from, r.to
+		if from == 0 {
+			from = max
+		}
+		if to == 0 {
+			to = max
+		}
+		if from > to {
+			from, to = to, from
+		}
+		if n >= from && n <= to {
+			return true
+		}
+	}
+	return false
+}
+
+// imapQuote renders s as an IMAP string, using a literal when a quoted
+// string cannot carry it.
+func imapQuote(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '\r' || c == '\n' || c == 0 || c >= 0x80 {
+			return fmt.Sprintf("{%d}\r\n%s", len(s), s)
+		}
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// imapNString is imapQuote with NIL for empty strings.
+func imapNString(s string) string {
+	if s == "" {
+		return "NIL"
+	}
+	return imapQuote(s)
+}
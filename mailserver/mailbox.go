@@ -0,0 +1,231 @@
+// Package mailserver gives POP3 and IMAP clients read access to the mail
+// captured by the SMTP server. Every recipient address is its own mailbox;
+// the login name selects it.
+package mailserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"goshs.de/goshs/v2/ca"
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/mailstore"
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/service"
+	"goshs.de/goshs/v2/users"
+)
+
+// Failed logins of an address before it is locked out for loginLockDuration,
+// the same as for the web server.
+const (
+	loginMaxFailures  = 5
+	loginLockDuration = 30 * time.Second
+)
+
+// ErrNoCredentials is returned by Listen when goshs has other auth enabled
+// but neither -b nor a users file to log in to the mailboxes with.
+var ErrNoCredentials = errors.New("the mailboxes need -b or a users file when other auth is enabled")
+
+// config holds what POP3 and IMAP share: the store, the goshs logins and TLS.
+type config struct {
+	IP        string
+	Port      int
+	SSL       bool // implicit TLS on Port, STARTTLS otherwise
+	Username  string
+	Password  string
+	Users     *users.Users // replaces -b if set, reloaded in place
+	OtherAuth bool         // certificate or OIDC auth protects the web server
+	MyCert    string
+	MyKey     string
+	Store     *mailstore.Store
+	tlsConfig *tls.Config
+	conns     service.Conns
+
+	mu       sync.RWMutex // guards Username and Password
+	failMu   sync.Mutex
+	failures map[string]*loginFailures
+}
+
+type loginFailures struct {
+	count       int
+	lockedUntil time.Time
+}
+
+func newConfig(opts *options.Options, port int, store *mailstore.Store) config {
+	return config{
+		IP:        opts.IP,
+		Port:      port,
+		SSL:       opts.SSL,
+		Username:  opts.Username,
+		Password:  opts.Password,
+		OtherAuth: opts.CertAuth != "" || opts.OIDCIssuer != "",
+		MyCert:    opts.MyCert,
+		MyKey:     opts.MyKey,
+		Store:     store,
+	}
+}
+
+// Reconfigure applies the -b login of a config reload. The users file is
+// reloaded in place.
+func (c *config) Reconfigure(opts *options.Options) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Username = opts.Username
+	c.Password = opts.Password
+}
+
+func (c *config) credentials() (string, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Username, c.Password
+}
+
+// checkAuth refuses to serve the mailboxes without a login while the web
+// server requires one.
+func (c *config) checkAuth() error {
+	if _, password := c.credentials(); password == "" && c.Users == nil && c.OtherAuth {
+		return ErrNoCredentials
+	}
+	return nil
+}
+
+// checkLogin validates the login of addr and returns the mailbox it opens.
+// The login is the recipient address whose mail is shown, followed by
+// "*user" to name the goshs user, like the master user logins of Dovecot.
+// With a users file the user is required and has to be an admin, with -b it
+// may be left out. Without any login goshs is open to everyone.
+func (c *config) checkLogin(addr, login, password string) (string, bool) {
+	mailbox, user := login, ""
+	if i := strings.LastIndex(login, "*"); i >= 0 {
+		mailbox, user = login[:i], login[i+1:]
+	}
+	if mailbox == "" || c.Store == nil || c.locked(addr) {
+		return "", false
+	}
+
+	ok := false
+	username, secret := c.credentials()
+	switch {
+	case c.Users != nil:
+		account := c.Users.Authenticate(user, password)
+		ok = account != nil && account.IsAdmin()
+	case secret != "":
+		if user != "" && user != username {
+			break
+		}
+		if strings.HasPrefix(secret, "$2a$") {
+			ok = bcrypt.CompareHashAndPassword([]byte(secret), []byte(password)) == nil
+		} else {
+			ok = subtle.ConstantTimeCompare([]byte(secret), []byte(password)) == 1
+		}
+	default:
+		ok = !c.OtherAuth
+	}
+
+	if !ok {
+		c.loginFailed(addr)
+		return "", false
+	}
+	c.failMu.Lock()
+	delete(c.failures, addr)
+	c.failMu.Unlock()
+	return mailbox, true
+}
+
+func (c *config) locked(addr string) bool {
+	c.failMu.Lock()
+	defer c.failMu.Unlock()
+	entry := c.failures[addr]
+	return entry != nil && time.Now().Before(entry.lockedUntil)
+}
+
+// loginFailed records a failed login of addr and locks it out after
+// loginMaxFailures attempts.
+func (c *config) loginFailed(addr string) {
+	c.failMu.Lock()
+	defer c.failMu.Unlock()
+	if c.failures == nil {
+		c.failures = map[string]*loginFailures{}
+	}
+	entry := c.failures[addr]
+	if entry == nil {
+		entry = &loginFailures{}
+		c.failures[addr] = entry
+	}
+	entry.count++
+	if entry.count >= loginMaxFailures {
+		entry.count = 0
+		entry.lockedUntil = time.Now().Add(loginLockDuration)
+		logger.Warnf("[MAIL] %s locked out after %d failed logins", addr, loginMaxFailures)
+	}
+}
+
+// setupTLS loads the certificate used for STARTTLS and implicit TLS.
+func (c *config) setupTLS() error {
+	conf, err := ca.ServiceTLSConfig(c.MyCert, c.MyKey)
+	if err != nil {
+		return err
+	}
+	c.tlsConfig = conf
+	return nil
+}
+
+// listen binds the listener of name, POP3 or IMAP, with implicit TLS for SSL.
+func (c *config) listen(name string) (net.Listener, error) {
+	if err := c.checkAuth(); err != nil {
+		return nil, err
+	}
+	addr := net.JoinHostPort(c.IP, strconv.Itoa(c.Port))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if c.SSL && c.tlsConfig != nil {
+		ln = tls.NewListener(ln, c.tlsConfig)
+		logger.Infof("%sS server listening on %s", name, addr)
+	} else {
+		logger.Infof("%s server listening on %s", name, addr)
+	}
+	return ln, nil
+}
+
+// Shutdown closes the listener and waits for the open sessions until ctx is
+// done.
+func (c *config) Shutdown(ctx context.Context) error {
+	return c.conns.Shutdown(ctx)
+}
+
+// remoteIP is the address failed logins are counted for.
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// inbox returns the messages delivered to rcpt, oldest first.
+func (c *config) inbox(rcpt string) ([]*mailstore.Message, error) {
+	msgs, err := c.Store.List(rcpt)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(msgs)
+	return msgs, nil
+}
+
+// crlf normalises line endings to CRLF as both protocols require.
+func crlf(raw []byte) []byte {
+	raw = bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(raw, []byte("\n"), []byte("\r\n"))
+}
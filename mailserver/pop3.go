@@ -0,0 +1,309 @@
+package mailserver
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/mailstore"
+	"goshs.de/goshs/v2/options"
+)
+
+// POP3Server implements RFC 1939 with CAPA (RFC 2449) and STLS (RFC 2595).
+type POP3Server struct {
+	config
+}
+
+func NewPOP3Server(opts *options.Options, store *mailstore.Store) *POP3Server {
+	return &POP3Server{config: newConfig(opts, opts.POP3Port, store)}
+}
+
+// Listen binds the listener and serves POP3 in the background.
+func (s *POP3Server) Listen() error {
+	if err := s.setupTLS(); err != nil {
+		logger.Warnf("POP3 TLS setup failed, STLS disabled: %v", err)
+	}
+	ln, err := s.listen("POP3")
+	if err != nil {
+		return err
+	}
+	s.serve(ln)
+	return nil
+}
+
+func (s *POP3Server) serve(ln net.Listener) {
+	s.conns.Serve(ln, s.handle)
+}
+
+type pop3Session struct {
+	srv     *POP3Server
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	user    string
+	authed  bool
+	msgs    []*mailstore.Message
+	deleted map[int]bool
+}
+
+func (s *POP3Server) handle(conn net.Conn) {
+	defer conn.Close()
+	sess := &pop3Session{srv: s, conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	sess.ok("goshs POP3 ready")
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(10 * time.Minute))
+		line, err := sess.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		if !sess.dispatch(strings.ToUpper(cmd), arg) {
+			return
+		}
+	}
+}
+
+func (p *pop3Session) ok(msg string) {
+	fmt.Fprintf(p.w, "+OK %s\r\n", msg)
+	p.w.Flush()
+}
+
+func (p *pop3Session) err(msg string) {
+	fmt.Fprintf(p.w, "-ERR %s\r\n", msg)
+	p.w.Flush()
+}
+
+// multiline writes a dot-stuffed multi-line response body.
+func (p *pop3Session) multiline(data []byte) {
+	for line := range bytes.Lines(data) {
+		if bytes.HasPrefix(line, []byte(".")) {
+			p.w.WriteByte('.')
+		}
+		p.w.Write(line)
+	}
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\r\n")) {
+		p.w.WriteString("\r\n")
+	}
+	p.w.WriteString(".\r\n")
+	p.w.Flush()
+}
+
+// dispatch handles a single command and reports whether to keep the
+// connection open.
+func (p *pop3Session) dispatch(cmd, arg string) bool {
+	switch cmd {
+	case "QUIT":
+		p.update()
+		p.ok("goshs POP3 signing off")
+		return false
+	case "CAPA":
+		fmt.Fprint(p.w, "+OK Capability list follows\r\nUSER\r\nTOP\r\nUIDL\r\n")
+		if p.srv.tlsConfig != nil && !p.isTLS() {
+			fmt.Fprint(p.w, "STLS\r\n")
+		}
+		fmt.Fprint(p.w, "IMPLEMENTATION goshs\r\n.\r\n")
+		p.w.Flush()
+		return true
+	case "NOOP":
+		p.ok("")
+		return true
+	}
+
+	if !p.authed {
+		switch cmd {
+		case "STLS":
+			p.startTLS()
+		case "USER":
+			if arg == "" {
+				p.err("missing username")
+				return true
+			}
+			p.user = arg
+			p.ok("send PASS")
+		case "PASS":
+			p.login(arg)
+		default:
+			p.err("not authenticated")
+		}
+		return true
+	}
+
+	switch cmd {
+	case "STAT":
+		count, size := 0, int64(0)
+		for i, m := range p.msgs {
+			if !p.deleted[i] {
+				count++
+				size += m.Size
+			}
+		}
+		p.ok(fmt.Sprintf("%d %d", count, size))
+	case "LIST", "UIDL":
+		p.list(cmd, arg)
+	case "RETR":
+		i, ok := p.message(arg)
+		if !ok {
+			return true
+		}
+		raw, err := p.srv.Store.Raw(p.msgs[i].ID)
+		if err != nil {
+			p.err("message unavailable")
+			return true
+		}
+		fmt.Fprintf(p.w, "+OK %d octets\r\n", p.msgs[i].Size)
+		p.multiline(crlf(raw))
+	case "TOP":
+		n, lines, _ := strings.Cut(arg, " ")
+		i, ok := p.message(n)
+		if !ok {
+			return true
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(lines))
+		if err != nil || count < 0 {
+			p.err("invalid line count")
+			return true
+		}
+		raw, err := p.srv.Store.Raw(p.msgs[i].ID)
+		if err != nil {
+			p.err("message unavailable")
+			return true
+		}
+		p.w.WriteString("+OK top of message follows\r\n")
+		p.multiline(top(crlf(raw), count))
+	case "DELE":
+		i, ok := p.message(arg)
+		if !ok {
+			return true
+		}
+		p.deleted[i] = true
+		p.ok(fmt.Sprintf("message %d deleted", i+1))
+	case "RSET":
+		p.deleted = map[int]bool{}
+		p.ok("")
+	default:
+		p.err("unknown command")
+	}
+	return true
+}
+
+func (p *pop3Session) isTLS() bool {
+	_, ok := p.conn.(*tls.Conn)
+	return ok
+}
+
+func (p *pop3Session) startTLS() {
+	if p.srv.tlsConfig == nil || p.isTLS() {
+		p.err("STLS not available")
+		return
+	}
+	p.ok("begin TLS negotiation")
+	tlsConn := tls.Server(p.conn, p.srv.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		logger.Debugf("POP3 STLS handshake with %s failed: %v", p.conn.RemoteAddr(), err)
+		return
+	}
+	p.conn = tlsConn
+	p.r = bufio.NewReader(tlsConn)
+	p.w = bufio.NewWriter(tlsConn)
+	p.user = ""
+}
+
+func (p *pop3Session) login(password string) {
+	if p.user == "" {
+		p.err("send USER first")
+		return
+	}
+	mailbox, ok := p.srv.checkLogin(remoteIP(p.conn), p.user, password)
+	if !ok {
+		logger.Access{Protocol: "pop3", Client: p.conn.RemoteAddr().String(), User: p.user, Event: "auth_failure", Method: "PASS"}.
+			Warnf("POP3 failed login for %s from %s", p.user, p.conn.RemoteAddr())
+		p.user = ""
+		p.err("invalid credentials")
+		return
+	}
+	p.user = mailbox
+	msgs, err := p.srv.inbox(p.user)
+	if err != nil {
+		p.err("cannot open mailbox")
+		return
+	}
+	p.authed = true
+	p.msgs = msgs
+	p.deleted = map[int]bool{}
+	logger.Access{Protocol: "pop3", Client: p.conn.RemoteAddr().String(), User: p.user, Event: "login", Method: "PASS"}.
+		Infof("POP3 login for %s from %s (%d messages)", p.user, p.conn.RemoteAddr(), len(msgs))
+	p.ok(fmt.Sprintf("%d messages", len(msgs)))
+}
+
+// message resolves a message number argument, answering -ERR itself if it
+// is invalid or deleted.
+func (p *pop3Session) message(arg string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(arg))
+	if err != nil || n < 1 || n > len(p.msgs) {
+		p.err("no such message")
+		return 0, false
+	}
+	if p.deleted[n-1] {
+		p.err("message deleted")
+		return 0, false
+	}
+	return n - 1, true
+}
+
+func (p *pop3Session) list(cmd, arg string) {
+	entry := func(i int) string {
+		if cmd == "UIDL" {
+			return fmt.Sprintf("%d %s", i+1, p.msgs[i].ID)
+		}
+		return fmt.Sprintf("%d %d", i+1, p.msgs[i].Size)
+	}
+
+	if arg != "" {
+		if i, ok := p.message(arg); ok {
+			p.ok(entry(i))
+		}
+		return
+	}
+	p.w.WriteString("+OK\r\n")
+	for i := range p.msgs {
+		if !p.deleted[i] {
+			p.w.WriteString(entry(i) + "\r\n")
+		}
+	}
+	p.w.WriteString(".\r\n")
+	p.w.Flush()
+}
+
+// update removes the messages marked for deletion (the UPDATE state).
+func (p *pop3Session) update() {
+	for i := range p.deleted {
+		if err := p.srv.Store.Delete(p.msgs[i].ID); err != nil {
+			logger.Warnf("POP3 delete %s: %v", p.msgs[i].ID, err)
+		}
+	}
+}
+
+// top returns the header and the first n body lines of a CRLF message.
+func top(raw []byte, n int) []byte {
+	idx := bytes.Index(raw, []byte("\r\n\r\n"))
+	if idx < 0 {
+		return raw
+	}
+	out := raw[:idx+4]
+	body := raw[idx+4:]
+	for line := range bytes.Lines(body) {
+		if n == 0 {
+			break
+		}
+		out = append(out[:len(out):len(out)], line...)
+		n--
+	}
+	return out
+}
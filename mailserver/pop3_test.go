@@ -0,0 +1,244 @@
+package mailserver
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"goshs.de/goshs/v2/mailstore"
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/users"
+)
+
+const testMessage = "From: Alice <alice@example.com>\r\nTo: bob@corp.local\r\nSubject: Reset your password\r\nDate: Mon, 19 Oct 2026 10:00:00 +0000\r\nContent-Type: text/plain\r\n\r\nClick here\r\n.hidden line\r\nBye\r\n"
+
+func newTestStore(t *testing.T) *mailstore.Store {
+	t.Helper()
+	store, err := mailstore.Open(t.TempDir())
+	require.NoError(t, err)
+	_, err = store.Save("alice@example.com", []string{"bob@corp.local"}, []byte(testMessage))
+	require.NoError(t, err)
+	_, err = store.Save("alice@example.com", []string{"carol@corp.local"}, []byte(testMessage))
+	require.NoError(t, err)
+	return store
+}
+
+type lineClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *lineClient {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return &lineClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *lineClient) line() string {
+	c.t.Helper()
+	l, err := c.r.ReadString('\n')
+	require.NoError(c.t, err)
+	return strings.TrimRight(l, "\r\n")
+}
+
+func (c *lineClient) cmd(s string) string {
+	c.t.Helper()
+	_, err := c.conn.Write([]byte(s + "\r\n"))
+	require.NoError(c.t, err)
+	return c.line()
+}
+
+// multiline reads a POP3 multi-line body up to the terminating dot.
+func (c *lineClient) multiline() []string {
+	var lines []string
+	for {
+		l := c.line()
+		if l == "." {
+			return lines
+		}
+		lines = append(lines, l)
+	}
+}
+
+func (c *lineClient) startTLS() {
+	tlsConn := tls.Client(c.conn, &tls.Config{InsecureSkipVerify: true})
+	require.NoError(c.t, tlsConn.Handshake())
+	c.conn = tlsConn
+	c.r = bufio.NewReader(tlsConn)
+}
+
+func startPOP3(t *testing.T, opts *options.Options, store *mailstore.Store) string {
+	t.Helper()
+	srv := NewPOP3Server(opts, store)
+	require.NoError(t, srv.setupTLS())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.serve(ln)
+	t.Cleanup(func() { ln.Close() })
+	return ln.Addr().String()
+}
+
+func TestPOP3_RetrieveAndDelete(t *testing.T) {
+	store := newTestStore(t)
+	c := dial(t, startPOP3(t, &options.Options{}, store))
+
+	require.True(t, strings.HasPrefix(c.line(), "+OK"))
+	require.True(t, strings.HasPrefix(c.cmd("STAT"), "-ERR"))
+	require.True(t, strings.HasPrefix(c.cmd("USER bob@corp.local"), "+OK"))
+	require.Equal(t, "+OK 1 messages", c.cmd("PASS anything"))
+
+	stat := c.cmd("STAT")
+	require.True(t, strings.HasPrefix(stat, "+OK 1 "), stat)
+
+	require.Equal(t, "+OK", c.cmd("UIDL"))
+	uidl := c.multiline()
+	require.Len(t, uidl, 1)
+
+	require.True(t, strings.HasPrefix(c.cmd("RETR 1"), "+OK"))
+	body := c.multiline()
+	require.Contains(t, body, "Return-Path: <alice@example.com>")
+	require.Contains(t, body, "Subject: Reset your password")
+	require.Contains(t, body, "..hidden line") // dot-stuffed
+
+	require.True(t, strings.HasPrefix(c.cmd("TOP 1 1"), "+OK"))
+	top := c.multiline()
+	require.Equal(t, "Click here", top[len(top)-1])
+
+	require.True(t, strings.HasPrefix(c.cmd("RETR 2"), "-ERR"))
+	require.True(t, strings.HasPrefix(c.cmd("DELE 1"), "+OK"))
+	require.True(t, strings.HasPrefix(c.cmd("RETR 1"), "-ERR"))
+	require.True(t, strings.HasPrefix(c.cmd("QUIT"), "+OK"))
+
+	bob, err := store.List("bob@corp.local")
+	require.NoError(t, err)
+	require.Empty(t, bob)
+	carol, err := store.List("carol@corp.local")
+	require.NoError(t, err)
+	require.Len(t, carol, 1)
+}
+
+func TestPOP3_RsetKeepsMessages(t *testing.T) {
+	store := newTestStore(t)
+	c := dial(t, startPOP3(t, &options.Options{}, store))
+	c.line()
+	c.cmd("USER bob@corp.local")
+	c.cmd("PASS x")
+	require.True(t, strings.HasPrefix(c.cmd("DELE 1"), "+OK"))
+	require.True(t, strings.HasPrefix(c.cmd("RSET"), "+OK"))
+	c.cmd("QUIT")
+
+	bob, err := store.List("bob@corp.local")
+	require.NoError(t, err)
+	require.Len(t, bob, 1)
+}
+
+func TestPOP3_PasswordAndSTLS(t *testing.T) {
+	store := newTestStore(t)
+	c := dial(t, startPOP3(t, &options.Options{Password: "s3cret"}, store))
+	c.line()
+
+	require.Equal(t, "+OK Capability list follows", c.cmd("CAPA"))
+	require.Contains(t, c.multiline(), "STLS")
+
+	require.True(t, strings.HasPrefix(c.cmd("STLS"), "+OK"))
+	c.startTLS()
+
+	c.cmd("USER bob@corp.local")
+	require.True(t, strings.HasPrefix(c.cmd("PASS wrong"), "-ERR"))
+	c.cmd("USER bob@corp.local")
+	require.True(t, strings.HasPrefix(c.cmd("PASS s3cret"), "+OK"))
+}
+
+func TestCheckLogin(t *testing.T) {
+	store := newTestStore(t)
+
+	open := config{Store: store}
+	mailbox, ok := open.checkLogin("192.0.2.1", "bob@corp.local", "")
+	require.True(t, ok)
+	require.Equal(t, "bob@corp.local", mailbox)
+	_, ok = open.checkLogin("192.0.2.1", "", "")
+	require.False(t, ok)
+
+	// Other auth on the web server closes the mailboxes without a login
+	closed := config{Store: store, OtherAuth: true}
+	_, ok = closed.checkLogin("192.0.2.1", "bob@corp.local", "")
+	require.False(t, ok)
+	require.ErrorIs(t, closed.checkAuth(), ErrNoCredentials)
+
+	plain := config{Store: store, Username: "admin", Password: "pw"}
+	_, ok = plain.checkLogin("192.0.2.1", "bob@corp.local", "pw")
+	require.True(t, ok)
+	mailbox, ok = plain.checkLogin("192.0.2.1", "bob@corp.local*admin", "pw")
+	require.True(t, ok)
+	require.Equal(t, "bob@corp.local", mailbox)
+	_, ok = plain.checkLogin("192.0.2.1", "bob@corp.local*other", "pw")
+	require.False(t, ok)
+	_, ok = plain.checkLogin("192.0.2.1", "bob@corp.local", "nope")
+	require.False(t, ok)
+
+	// A reload changes the password
+	plain.Reconfigure(&options.Options{Username: "admin", Password: "new"})
+	_, ok = plain.checkLogin("192.0.2.1", "bob@corp.local", "pw")
+	require.False(t, ok)
+	_, ok = plain.checkLogin("192.0.2.1", "bob@corp.local", "new")
+	require.True(t, ok)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("goshs"), bcrypt.MinCost)
+	require.NoError(t, err)
+	hashed := config{Store: store, Password: string(hash)}
+	_, ok = hashed.checkLogin("192.0.2.1", "bob@corp.local", "goshs")
+	require.True(t, ok)
+	_, ok = hashed.checkLogin("192.0.2.1", "bob@corp.local", "nope")
+	require.False(t, ok)
+}
+
+func TestCheckLogin_Users(t *testing.T) {
+	store := newTestStore(t)
+	file := filepath.Join(t.TempDir(), "users")
+	require.NoError(t, os.WriteFile(file, []byte("boss:pw:admin\nreader:pw:read\n"), 0600))
+	accounts, err := users.Load(file)
+	require.NoError(t, err)
+
+	c := config{Store: store, Users: accounts, Password: "ignored"}
+	mailbox, ok := c.checkLogin("192.0.2.1", "bob@corp.local*boss", "pw")
+	require.True(t, ok)
+	require.Equal(t, "bob@corp.local", mailbox)
+	_, ok = c.checkLogin("192.0.2.1", "bob@corp.local*reader", "pw")
+	require.False(t, ok, "only admins read the mailboxes")
+	_, ok = c.checkLogin("192.0.2.1", "bob@corp.local", "ignored")
+	require.False(t, ok, "-b does not apply next to a users file")
+
+	// A reload of the users file applies to the next login
+	require.NoError(t, os.WriteFile(file, []byte("boss:changed:admin\n"), 0600))
+	next, err := users.Load(file)
+	require.NoError(t, err)
+	accounts.Replace(next)
+	_, ok = c.checkLogin("192.0.2.2", "bob@corp.local*boss", "pw")
+	require.False(t, ok)
+	_, ok = c.checkLogin("192.0.2.2", "bob@corp.local*boss", "changed")
+	require.True(t, ok)
+}
+
+func TestCheckLogin_LockOut(t *testing.T) {
+	c := config{Store: newTestStore(t), Password: "pw"}
+	for range loginMaxFailures {
+		_, ok := c.checkLogin("192.0.2.1", "bob@corp.local", "nope")
+		require.False(t, ok)
+	}
+	// Locked out even with the right password, other addresses are not
+	_, ok := c.checkLogin("192.0.2.1", "bob@corp.local", "pw")
+	require.False(t, ok)
+	_, ok = c.checkLogin("192.0.2.2", "bob@corp.local", "pw")
+	require.True(t, ok)
+}
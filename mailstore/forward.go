@@ -0,0 +1,102 @@
+package mailstore
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Forwarder delivers a copy of every received message to a local mailbox.
+type Forwarder interface {
+	Deliver(from string, raw []byte) error
+	String() string
+}
+
+// ParseForward parses a forwarding target of the form "mbox:<file>" or
+// "maildir:<dir>".
+func ParseForward(spec string) (Forwarder, error) {
+	kind, path, ok := strings.Cut(spec, ":")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("invalid mail forward %q, expected mbox:<file> or maildir:<dir>", spec)
+	}
+	switch strings.ToLower(kind) {
+	case "mbox":
+		return &Mbox{Path: path}, nil
+	case "maildir":
+		return &Maildir{Dir: path}, nil
+	}
+	return nil, fmt.Errorf("invalid mail forward %q, unknown type %q", spec, kind)
+}
+
+// Mbox appends messages to an mboxrd file.
+type Mbox struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (m *Mbox) String() string { return "mbox:" + m.Path }
+
+// Deliver appends raw with a "From " separator line, quoting body lines that
+// start with (any number of '>' followed by) "From ".
+func (m *Mbox) Deliver(from string, raw []byte) error {
+	if from == "" {
+		from = "MAILER-DAEMON"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From %s %s\n", from, time.Now().UTC().Format(time.ANSIC))
+	for line := range strings.SplitSeq(strings.ReplaceAll(string(raw), "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			buf.WriteByte('>')
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Maildir delivers messages into the new/ folder of a Maildir, creating the
+// tmp/new/cur layout on first use.
+type Maildir struct {
+	Dir string
+}
+
+var maildirSeq atomic.Uint64
+
+func (m *Maildir) String() string { return "maildir:" + m.Dir }
+
+func (m *Maildir) Deliver(_ string, raw []byte) error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(m.Dir, sub), 0700); err != nil {
+			return err
+		}
+	}
+
+	host, _ := os.Hostname()
+	host = strings.NewReplacer("/", "\\057", ":", "\\072").Replace(host)
+	now := time.Now()
+	name := fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), maildirSeq.Add(1), host)
+
+	tmp := filepath.Join(m.Dir, "tmp", name)
+	if err := os.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(m.Dir, "new", name))
+}
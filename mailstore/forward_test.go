@@ -0,0 +1,64 @@
+package mailstore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseForward(t *testing.T) {
+	f, err := ParseForward("mbox:/tmp/goshs.mbox")
+	require.NoError(t, err)
+	require.Equal(t, "mbox:/tmp/goshs.mbox", f.String())
+
+	f, err = ParseForward("Maildir:/tmp/Maildir")
+	require.NoError(t, err)
+	require.Equal(t, "maildir:/tmp/Maildir", f.String())
+
+	for _, spec := range []string{"", "mbox", "mbox:", "imap:/tmp/x"} {
+		_, err := ParseForward(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestMbox_Deliver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goshs.mbox")
+	m := &Mbox{Path: path}
+
+	require.NoError(t, m.Deliver("alice@example.com", []byte("Subject: one\r\n\r\nFrom here on\r\n>From quoted\r\n")))
+	require.NoError(t, m.Deliver("", []byte("Subject: two\r\n\r\nbody\r\n")))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	content := string(data)
+	require.True(t, strings.HasPrefix(content, "From alice@example.com "))
+	require.Contains(t, content, "\n>From here on\n")
+	require.Contains(t, content, "\n>>From quoted\n")
+	require.Contains(t, content, "\nFrom MAILER-DAEMON ")
+	require.NotContains(t, content, "\r")
+	require.Equal(t, 2, strings.Count(content, "\nSubject: "))
+}
+
+func TestMaildir_Deliver(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Maildir")
+	m := &Maildir{Dir: dir}
+
+	require.NoError(t, m.Deliver("alice@example.com", []byte(testMail)))
+	require.NoError(t, m.Deliver("alice@example.com", []byte(testMail)))
+
+	entries, err := os.ReadDir(filepath.Join(dir, "new"))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	data, err := os.ReadFile(filepath.Join(dir, "new", entries[0].Name()))
+	require.NoError(t, err)
+	require.Equal(t, testMail, string(data))
+
+	for _, sub := range []string{"tmp", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	}
+}
@@ -0,0 +1,232 @@
+// Package mailstore persists mail received by the SMTP server as RFC 822
+// .eml files and optionally hands a copy to a local mbox or Maildir.
+package mailstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"goshs.de/goshs/v2/config"
+)
+
+// ErrNotFound is returned for unknown or malformed message IDs.
+var ErrNotFound = errors.New("message not found")
+
+var idPattern = regexp.MustCompile(`^[0-9]{14}-[0-9a-f]{8}$`)
+
+// Message describes a stored message. Envelope sender and recipients come
+// from the envelope file written by Save next to the message, never from its
+// headers, which the sender controls.
+type Message struct {
+	ID         string    `json:"id"`
+	From       string    `json:"from"`
+	To         []string  `json:"to"`
+	Subject    string    `json:"subject"`
+	Date       string    `json:"date,omitempty"`
+	Size       int64     `json:"size"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// envelope is kept in <id>.json next to <id>.eml.
+type envelope struct {
+	From string   `json:"from"`
+	To   []string `json:"to"`
+}
+
+// Store is a directory of .eml files.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Open returns the store in dir, creating it if needed. An empty dir selects
+// the mail directory below config.Dir().
+func Open(dir string) (*Store, error) {
+	if dir == "" {
+		base, err := config.Dir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(base, "mail")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating mail directory %s: %w", dir, err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Dir returns the directory the store writes to.
+func (s *Store) Dir() string { return s.dir }
+
+// Save writes raw to a new .eml file, prefixed with Return-Path and one
+// Delivered-To header per envelope recipient for mail clients, and the
+// envelope to its .json file.
+func (s *Store) Save(from string, to []string, raw []byte) (*Message, error) {
+	now := time.Now()
+	id := now.UTC().Format("20060102150405") + "-" + uuid.NewString()[:8]
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Return-Path: <%s>\r\n", from)
+	for _, rcpt := range to {
+		fmt.Fprintf(&buf, "Delivered-To: %s\r\n", rcpt)
+	}
+	buf.Write(raw)
+	env, err := json.Marshal(envelope{From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.WriteFile(s.envelopePath(id), env, 0600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(s.path(id), buf.Bytes(), 0600); err != nil {
+		os.Remove(s.envelopePath(id))
+		return nil, err
+	}
+	return s.stat(id)
+}
+
+// List returns all stored messages, newest first. A non-empty rcpt limits the
+// result to messages delivered to that address.
+func (s *Store) List(rcpt string) ([]*Message, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := []*Message{}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".eml")
+		if !ok || !idPattern.MatchString(id) {
+			continue
+		}
+		m, err := s.stat(id)
+		if err != nil {
+			continue
+		}
+		if rcpt != "" && !slices.ContainsFunc(m.To, func(addr string) bool { return strings.EqualFold(addr, rcpt) }) {
+			continue
+		}
+		msgs = append(msgs, m)
+	}
+	slices.SortFunc(msgs, func(a, b *Message) int { return strings.Compare(b.ID, a.ID) })
+	return msgs, nil
+}
+
+// Get returns the metadata of a single message.
+func (s *Store) Get(id string) (*Message, error) {
+	if !idPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	return s.stat(id)
+}
+
+// Raw returns the stored message as written to disk.
+func (s *Store) Raw(id string) ([]byte, error) {
+	if !idPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	raw, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return raw, err
+}
+
+// Delete removes a message.
+func (s *Store) Delete(id string) error {
+	if !idPattern.MatchString(id) {
+		return ErrNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(s.envelopePath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".eml")
+}
+
+func (s *Store) envelopePath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// envelope reads the envelope of a message. Messages without one, like
+// those copied into the directory by hand, have no recipients.
+func (s *Store) envelope(id string) (envelope, error) {
+	var env envelope
+	data, err := os.ReadFile(s.envelopePath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return env, nil
+	}
+	if err != nil {
+		return env, err
+	}
+	return env, json.Unmarshal(data, &env)
+}
+
+// stat reads the header block of a message to build its metadata.
+func (s *Store) stat(id string) (*Message, error) {
+	f, err := os.Open(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := mail.ReadMessage(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	env, err := s.envelope(id)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Message{
+		ID:         id,
+		From:       env.From,
+		To:         env.To,
+		Subject:    msg.Header.Get("Subject"),
+		Date:       msg.Header.Get("Date"),
+		Size:       info.Size(),
+		ReceivedAt: info.ModTime(),
+	}
+	if t, err := time.Parse("20060102150405", id[:14]); err == nil {
+		m.ReceivedAt = t
+	}
+	if m.To == nil {
+		m.To = []string{}
+	}
+	return m, nil
+}
@@ -0,0 +1,122 @@
+package mailstore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testMail = "From: alice@example.com\r\nTo: bob@corp.local\r\nSubject: Hello\r\nDate: Mon, 19 Oct 2026 10:00:00 +0000\r\n\r\nHi Bob\r\n"
+
+func TestOpen_CreatesDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	s, err := Open(dir)
+	require.NoError(t, err)
+	require.Equal(t, dir, s.Dir())
+
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	require.True(t, info.IsDir())
+}
+
+func TestSaveGetRaw(t *testing.T) {
+	s, err := Open(t.TempDir())
+	require.NoError(t, err)
+
+	m, err := s.Save("alice@example.com", []string{"bob@corp.local", "carol@corp.local"}, []byte(testMail))
+	require.NoError(t, err)
+	require.Regexp(t, idPattern, m.ID)
+	require.Equal(t, "alice@example.com", m.From)
+	require.Equal(t, []string{"bob@corp.local", "carol@corp.local"}, m.To)
+	require.Equal(t, "Hello", m.Subject)
+	require.NotEmpty(t, m.Date)
+
+	raw, err := s.Raw(m.ID)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(raw), "Return-Path: <alice@example.com>\r\nDelivered-To: bob@corp.local\r\n"))
+	require.True(t, strings.HasSuffix(string(raw), testMail))
+
+	got, err := s.Get(m.ID)
+	require.NoError(t, err)
+	require.Equal(t, m.ID, got.ID)
+	require.Equal(t, int64(len(raw)), got.Size)
+}
+
+func TestList_FilterAndOrder(t *testing.T) {
+	s, err := Open(t.TempDir())
+	require.NoError(t, err)
+
+	first, err := s.Save("a@example.com", []string{"bob@corp.local"}, []byte(testMail))
+	require.NoError(t, err)
+	_, err = s.Save("a@example.com", []string{"carol@corp.local"}, []byte(testMail))
+	require.NoError(t, err)
+	// Files that are not messages are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(s.Dir(), "notes.txt"), []byte("x"), 0600))
+
+	all, err := s.List("")
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	require.GreaterOrEqual(t, all[0].ID, all[1].ID)
+
+	bob, err := s.List("BOB@corp.local")
+	require.NoError(t, err)
+	require.Len(t, bob, 1)
+	require.Equal(t, first.ID, bob[0].ID)
+
+	none, err := s.List("nobody@corp.local")
+	require.NoError(t, err)
+	require.Empty(t, none)
+}
+
+func TestList_IgnoresSenderHeaders(t *testing.T) {
+	s, err := Open(t.TempDir())
+	require.NoError(t, err)
+
+	// The sender cannot deliver into other mailboxes by adding headers
+	spoofed := "Delivered-To: admin@corp.local\r\nReturn-Path: <boss@corp.local>\r\n" + testMail
+	m, err := s.Save("mallory@example.com", []string{"bob@corp.local"}, []byte(spoofed))
+	require.NoError(t, err)
+	require.Equal(t, "mallory@example.com", m.From)
+	require.Equal(t, []string{"bob@corp.local"}, m.To)
+
+	admin, err := s.List("admin@corp.local")
+	require.NoError(t, err)
+	require.Empty(t, admin)
+
+	// Messages without an envelope file have no recipients
+	require.NoError(t, os.WriteFile(filepath.Join(s.Dir(), "20260101000000-0123abcd.eml"), []byte(spoofed), 0600))
+	got, err := s.Get("20260101000000-0123abcd")
+	require.NoError(t, err)
+	require.Empty(t, got.To)
+	require.Empty(t, got.From)
+}
+
+func TestDelete(t *testing.T) {
+	s, err := Open(t.TempDir())
+	require.NoError(t, err)
+
+	m, err := s.Save("a@example.com", nil, []byte(testMail))
+	require.NoError(t, err)
+	require.NoError(t, s.Delete(m.ID))
+	require.ErrorIs(t, s.Delete(m.ID), ErrNotFound)
+	require.NoFileExists(t, filepath.Join(s.Dir(), m.ID+".json"))
+
+	_, err = s.Raw(m.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestInvalidIDs(t *testing.T) {
+	s, err := Open(t.TempDir())
+	require.NoError(t, err)
+
+	for _, id := range []string{"", "../../etc/passwd", "20260101000000-zzzzzzzz", "x.eml"} {
+		_, err := s.Raw(id)
+		require.ErrorIs(t, err, ErrNotFound, id)
+		_, err = s.Get(id)
+		require.ErrorIs(t, err, ErrNotFound, id)
+		require.ErrorIs(t, s.Delete(id), ErrNotFound, id)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"syscall"
 	"time"
 
+	"goshs.de/goshs/v2/ca"
 	"goshs.de/goshs/v2/config"
 	"goshs.de/goshs/v2/goshsversion"
 	"goshs.de/goshs/v2/logger"
@@ -32,12 +33,15 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Load config
-	if opts.ConfigFile != "" {
-		opts, err = config.LoadConfig(opts)
-		if err != nil {
-			logger.Fatalf("Failed to load config: %+v", err)
-		}
+	// Validate a config file and exit
+	if opts.CheckConfig != "" {
+		config.CheckCommand(opts.CheckConfig)
+	}
+
+	// Load config file and environment
+	opts, err = config.LoadConfig(opts)
+	if err != nil {
+		logger.Fatalf("Failed to load config: %+v", err)
 	}
 
 	// Ensure ~/.config/goshs exists
@@ -45,6 +49,16 @@ func main() {
 		logger.Warnf("Could not create config directory: %+v", err)
 	}
 
+	// Issue a client certificate and exit
+	if opts.ClientCert != "" {
+		ca.ClientCertCommand(opts.CADir, opts.ClientCert, opts.ClientCertOut, opts.ClientCertDays)
+	}
+
+	// Revoke a client certificate and exit
+	if opts.ClientCertRevoke != "" {
+		ca.RevokeCommand(opts.CADir, opts.CARevoked, opts.ClientCertRevoke)
+	}
+
 	// Sanitize webroot and check sanity
 	opts, err = sanity.Sanitize(opts)
 	if err != nil {
@@ -65,11 +79,19 @@ func main() {
 	logger.PrintBanner(goshsversion.GoshsVersion)
 
 	// Start all servers
-	shutdown := server.StartAll(opts)
+	shutdown, reloader := server.StartAll(opts)
 
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	<-done
+	// SIGHUP reloads the config file, CTRL+C and SIGTERM shut goshs down
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if _, err := reloader.Reload(); err != nil {
+			logger.Errorf("[CONFIG] Reload on SIGHUP failed: %+v", err)
+		}
+	}
 	logger.Infof("Received CTRL+C, shutting down gracefully...")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
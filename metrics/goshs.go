@@ -0,0 +1,52 @@
+package metrics
+
+// The metrics of goshs. Servers update them whether or not -metrics is
+// given, -metrics only serves them.
+var (
+	HTTPRequests = NewCounter("goshs_http_requests_total",
+		"HTTP and WebDAV requests by server, method and status.", "server", "method", "status")
+	HTTPSentBytes = NewCounter("goshs_http_sent_bytes_total",
+		"Bytes of HTTP and WebDAV response bodies by server.", "server")
+	UploadBytes = NewCounter("goshs_upload_bytes_total",
+		"Bytes of uploaded files by protocol.", "protocol")
+	Uploads = NewCounter("goshs_uploads_total",
+		"Uploaded files by protocol.", "protocol")
+	UploadDuration = NewHistogram("goshs_upload_duration_seconds",
+		"Duration of HTTP uploads.", 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900)
+
+	WebsocketClients = NewGauge("goshs_websocket_clients",
+		"Connected websocket clients of the web UI.")
+
+	Sessions = NewGauge("goshs_sessions",
+		"Open SFTP and SMB sessions by protocol.", "protocol")
+	SessionsTotal = NewCounter("goshs_sessions_total",
+		"SFTP and SMB sessions by protocol.", "protocol")
+
+	DNSQueries = NewCounter("goshs_dns_queries_total",
+		"DNS queries by type.", "type")
+	SMTPMessages = NewCounter("goshs_smtp_messages_total",
+		"Mails received by the SMTP server.")
+	LDAPBinds = NewCounter("goshs_ldap_binds_total",
+		"LDAP binds by mechanism.", "mechanism")
+
+	HashesCaptured = NewCounter("goshs_ntlm_hashes_captured_total",
+		"Captured NTLM hashes by protocol.", "protocol")
+	HashesCracked = NewCounter("goshs_ntlm_hashes_cracked_total",
+		"Cracked NTLM hashes by protocol.", "protocol")
+
+	CatcherListeners = NewGauge("goshs_catcher_listeners",
+		"Running reverse shell catcher listeners.")
+	CatcherSessions = NewGauge("goshs_catcher_sessions",
+		"Open reverse shell catcher sessions.")
+	CatcherSessionsTotal = NewCounter("goshs_catcher_sessions_total",
+		"Reverse shell catcher sessions.")
+)
+
+// CountHash counts an NTLM hash captured by protocol, and as cracked if the
+// built-in wordlist cracked it right away.
+func CountHash(protocol, cracked string) {
+	HashesCaptured.Inc(protocol)
+	if cracked != "" {
+		HashesCracked.Inc(protocol)
+	}
+}
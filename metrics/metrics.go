@@ -0,0 +1,277 @@
+// Package metrics keeps the counters, gauges and histograms of goshs and
+// serves them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metric is a registered counter, gauge or histogram.
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []metric
+)
+
+func register(m metric) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, m)
+}
+
+// series holds the values of a metric by their label values.
+type series struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newSeries(kind, name, help string, labels []string) *series {
+	s := &series{name: name, help: help, kind: kind, labels: labels, values: make(map[string]float64)}
+	if len(labels) == 0 {
+		// Metrics without labels are shown from the start
+		s.values[""] = 0
+	}
+	register(s)
+	return s
+}
+
+// key joins label values to the key of their series. Missing values are
+// empty, surplus values are dropped.
+func (s *series) key(values []string) string {
+	parts := make([]string, len(s.labels))
+	copy(parts, values)
+	return strings.Join(parts, "\xff")
+}
+
+func (s *series) add(v float64, values []string) {
+	k := s.key(values)
+	s.mu.Lock()
+	s.values[k] += v
+	s.mu.Unlock()
+}
+
+func (s *series) set(v float64, values []string) {
+	k := s.key(values)
+	s.mu.Lock()
+	s.values[k] = v
+	s.mu.Unlock()
+}
+
+func (s *series) get(values []string) float64 {
+	k := s.key(values)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[k]
+}
+
+func (s *series) write(w *bufio.Writer) {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	values := make([]float64, len(keys))
+	for i, k := range keys {
+		values[i] = s.values[k]
+	}
+	s.mu.Unlock()
+
+	writeHeader(w, s.name, s.help, s.kind)
+	for i, k := range keys {
+		var labels []string
+		if len(s.labels) > 0 {
+			labels = strings.Split(k, "\xff")
+		}
+		fmt.Fprintf(w, "%s%s %s\n", s.name, formatLabels(s.labels, labels), formatValue(values[i]))
+	}
+}
+
+// Counter is a value that only goes up, like the number of requests.
+type Counter struct {
+	s *series
+}
+
+// NewCounter registers a counter with the given label names.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{s: newSeries("counter", name, help, labels)}
+}
+
+// Inc adds one to the series of the label values.
+func (c *Counter) Inc(values ...string) {
+	c.s.add(1, values)
+}
+
+// Add adds v to the series of the label values. Negative values are ignored.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		return
+	}
+	c.s.add(v, values)
+}
+
+// Value returns the series of the label values.
+func (c *Counter) Value(values ...string) float64 {
+	return c.s.get(values)
+}
+
+// Gauge is a value that goes up and down, like the number of sessions.
+type Gauge struct {
+	s *series
+}
+
+// NewGauge registers a gauge with the given label names.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{s: newSeries("gauge", name, help, labels)}
+}
+
+// Inc adds one to the series of the label values.
+func (g *Gauge) Inc(values ...string) {
+	g.s.add(1, values)
+}
+
+// Dec subtracts one from the series of the label values.
+func (g *Gauge) Dec(values ...string) {
+	g.s.add(-1, values)
+}
+
+// Set sets the series of the label values to v.
+func (g *Gauge) Set(v float64, values ...string) {
+	g.s.set(v, values)
+}
+
+// Value returns the series of the label values.
+func (g *Gauge) Value(values ...string) float64 {
+	return g.s.get(values)
+}
+
+// Histogram counts observations, like durations, in buckets.
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with the given upper bounds of its
+// buckets. The +Inf bucket is added.
+func NewHistogram(name, help string, buckets ...float64) *Histogram {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	h := &Histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+	register(h)
+	return h
+}
+
+// Observe adds v to the histogram.
+func (h *Histogram) Observe(v float64) {
+	i, _ := slices.BinarySearch(h.buckets, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	counts := slices.Clone(h.counts)
+	count, sum := h.count, h.sum
+	h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	var cumulative uint64
+	for i, le := range h.buckets {
+		cumulative += counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", h.name, formatValue(le), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatValue(sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, count)
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Write writes all registered metrics in the Prometheus text format.
+func Write(w io.Writer) error {
+	registryMu.Lock()
+	metrics := slices.Clone(registry)
+	registryMu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves all registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_ = Write(w)
+	})
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	var b strings.Builder
+	require.NoError(t, Write(&b))
+	return b.String()
+}
+
+func TestCounter(t *testing.T) {
+	c := NewCounter("test_requests_total", "Requests.", "method", "status")
+	c.Inc("GET", "200")
+	c.Inc("GET", "200")
+	c.Add(3, "POST", `4"04`)
+	c.Add(-1, "GET", "200")
+
+	out := scrape(t)
+	require.Contains(t, out, "# HELP test_requests_total Requests.\n# TYPE test_requests_total counter\n")
+	require.Contains(t, out, `test_requests_total{method="GET",status="200"} 2`+"\n")
+	require.Contains(t, out, `test_requests_total{method="POST",status="4\"04"} 3`+"\n")
+	require.Equal(t, float64(2), c.Value("GET", "200"))
+}
+
+func TestGauge(t *testing.T) {
+	g := NewGauge("test_sessions", "Sessions.")
+	require.Contains(t, scrape(t), "test_sessions 0\n")
+
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	require.Contains(t, scrape(t), "test_sessions 1\n")
+	g.Set(7.5)
+	require.Equal(t, 7.5, g.Value())
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_duration_seconds", "Durations.", 1, 0.1)
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.Observe(0.5)
+	h.Observe(20)
+
+	out := scrape(t)
+	require.Contains(t, out, "# TYPE test_duration_seconds histogram\n"+
+		`test_duration_seconds_bucket{le="0.1"} 2`+"\n"+
+		`test_duration_seconds_bucket{le="1"} 3`+"\n"+
+		`test_duration_seconds_bucket{le="+Inf"} 4`+"\n"+
+		"test_duration_seconds_sum 20.65\n"+
+		"test_duration_seconds_count 4\n")
+	require.Equal(t, uint64(4), h.Count())
+}
+
+func TestMiddleware(t *testing.T) {
+	h := Middleware("test")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+
+	sent := HTTPSentBytes.Value("test")
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/", nil))
+
+	require.Equal(t, float64(1), HTTPRequests.Value("test", http.MethodGet, "200"))
+	require.Equal(t, float64(1), HTTPRequests.Value("test", http.MethodGet, "404"))
+	require.Equal(t, float64(1), HTTPRequests.Value("test", "other", "200"))
+	require.Equal(t, sent+10+float64(len("404 page not found\n")), HTTPSentBytes.Value("test"))
+}
+
+func TestHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	require.Contains(t, w.Body.String(), "# TYPE goshs_websocket_clients gauge")
+}
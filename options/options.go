@@ -5,14 +5,21 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/howeyc/gopass"
+	"github.com/skip2/go-qrcode"
+	"goshs.de/goshs/v2/apitoken"
 	"goshs.de/goshs/v2/completion"
+	"goshs.de/goshs/v2/duration"
 	"goshs.de/goshs/v2/goshsversion"
 	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/totp"
 	"goshs.de/goshs/v2/update"
 	"goshs.de/goshs/v2/utils"
+	"goshs.de/goshs/v2/webhook"
 )
 
 type Options struct {
@@ -25,6 +32,15 @@ type Options struct {
 	MyCert              string   // ""
 	MyP12               string   // ""
 	P12NoPass           bool     // false
+	SelfSignedHosts     string   // "" extra names for the self-signed certificate
+	CADir               string   // "" ~/.config/goshs/ca
+	ClientCert          string   // "" issue a client certificate for this name and exit
+	ClientCertOut       string   // "" <name>.p12
+	ClientCertDays      int      // 365
+	ClientCertRevoke    string   // "" revoke this serial and exit
+	CARevoked           string   // "" revoked.txt in -ca-dir with -ca self
+	CACRL               string   // ""
+	CAMap               string   // ""
 	CLI                 bool     // false
 	UploadFolder        string   // ""
 	LetsEncrypt         bool     // false
@@ -32,6 +48,16 @@ type Options struct {
 	Username            string   // "" will be constructed from BasicAuth
 	Password            string   // "" will be constructed from BasicAuth
 	CertAuth            string   // ""
+	UsersFile           string   // "" name:secret[:role[:home]] per line
+	OIDCIssuer          string   // ""
+	OIDCClientID        string   // ""
+	OIDCClientSecret    string   // ""
+	OIDCRedirectURL     string   // "" derived from the request
+	OIDCEmails          string   // "" comma separated, @domain for whole domains
+	OIDCGroups          string   // "" comma separated
+	TOTPFile            string   // "" name:secret per line, created on enrolment
+	TOTPBasicUpload     bool     // false
+	TokensFile          string   // "" hashed API tokens, created with the first token
 	WebDav              bool     // false
 	WebDavPort          int      // 8001
 	SFTP                bool     // false
@@ -49,38 +75,87 @@ type Options struct {
 	LEDomains           string   // ""
 	LEHTTPPort          string   //"80"
 	LETLSPort           string   // "443"
+	LEDirectory         string   // ""
+	LEACMECA            string   // ""
+	LEChallenges        string   // "http,tls"
 	Embedded            bool     // false
 	Output              string   // ""
+	LogFormat           string   // "text"
+	LogMaxSize          int      // 0 MB, no rotation by size
+	LogMaxAge           string   // "", no rotation by age
+	LogKeep             int      // 0, keep all rotated files
 	ConfigFile          string   // ""
 	ConfigPath          string   // "" Will be constructed from ConfigFile
+	CheckConfig         string   // "" validate this config file and exit
 	WebhookEnabled      bool     // false
 	WebhookURL          string   // ""
 	WebhookEvents       string   // "all"
 	WebhookProvider     string   // "Discord"
 	WebhookEventsParsed []string // []string{}
+	WebhookTemplate     string   // "" posts the event as JSON
+	WebhookHeaders      string   // "" comma separated "Name: value"
+	WebhookSecret       string   // ""
+	WebhookRetries      int      // 3
 	Whitelist           string   // ""
 	TrustedProxies      string   // ""
 	MDNS                bool     // false
 	Invisible           bool     // false
 	Tunnel              bool     // false
+	TunnelServer        string   // "" = localhost.run
+	TunnelUser          string   // "" = goshs
+	TunnelKey           string   // ""
+	TunnelHostKey       string   // "" = trust on first use
+	Relay               bool     // false
+	RelayPort           int      // 2222
+	RelayHTTPPort       int      // 8080
+	RelayDomain         string   // "" = no subdomains
+	RelayPorts          string   // "20000-20099"
+	RelayKeys           string   // ""
+	RelayHostKey        string   // "" = generated in the config directory
 	DNS                 bool     // false
 	DNSPort             int      // 8053
 	DNSIP               string   // "127.0.0.1"
 	SMTP                bool     // false
 	SMTPPort            int      // 2525
 	SMTPDomain          string   // ""
+	SMTPSPort           int      // 4465
+	SMTPMailDir         string   // "" = ~/.config/goshs/mail
+	SMTPForward         string   // "" mbox:<file> or maildir:<dir>
+	POP3                bool     // false
+	POP3Port            int      // 1110
+	IMAP                bool     // false
+	IMAPPort            int      // 1143
 	SMB                 bool     // false
 	SMBPort             int      // 445
 	SMBDomain           string   // ""
 	SMBShare            string   // ""
 	SMBWordlist         string   // ""
 	MaxUploadSize       int64    // 0 = unlimited
+	ShareFile           string   // "" shared links are kept in memory only
 	Catcher             bool     // false
 	LDAP                bool     // false
 	LDAPPort            int      // 389
 	LDAPJNDIEnabled     bool     // false — when true, use search baseDN as class name
 	LDAPJNDIBase        string   // "" auto-constructs from IP/port
 	LDAPWordlist        string   // "" optional wordlist path for NTLM hash cracking
+	WPAD                bool     // false
+	WPADPort            int      // 3128
+	WPADHost            string   // "" auto-detected from the interface the PAC is fetched on
+	WPADAuth            string   // "ntlm"
+	WPADForward         bool     // false — refuse requests after capture
+	CrackWorkers        int      // 0 = number of CPUs
+	CrackRules          string   // "" hashcat rule file applied to wordlist jobs, "builtin" for the default set
+	CrackMask           string   // "" mask tried in the background after capture
+	CrackMaskMaxLen     int      // 8
+	Metrics             bool     // false
+	MetricsPort         int      // 0 = served at /metrics of the web server
+
+	// Webhooks are further webhook destinations, only set by the config file
+	Webhooks []webhook.Destination
+
+	// Given are the fields set by flags on the command line, they win over
+	// the config file and the environment
+	Given map[string]bool
 }
 
 func Parse() (*Options, bool) {
@@ -88,6 +163,7 @@ func Parse() (*Options, bool) {
 	opts := &Options{}
 
 	flag.StringVar(&opts.ConfigFile, "C", "", "config")
+	flag.StringVar(&opts.CheckConfig, "check-config", "", "validate config file")
 	flag.StringVar(&opts.IP, "i", "0.0.0.0", "ip")
 	flag.StringVar(&opts.IP, "ip", "0.0.0.0", "ip")
 	flag.IntVar(&opts.Port, "p", 8000, "port")
@@ -106,10 +182,30 @@ func Parse() (*Options, bool) {
 	flag.StringVar(&opts.MyP12, "pkcs12", "", "server p12")
 	flag.BoolVar(&opts.P12NoPass, "p12np", false, "p12 no pass")
 	flag.BoolVar(&opts.P12NoPass, "p12-no-pass", false, "p12 no pass")
+	flag.StringVar(&opts.SelfSignedHosts, "ss-hosts", "", "self-signed hosts")
+	flag.StringVar(&opts.CADir, "ca-dir", "", "ca directory")
+	flag.StringVar(&opts.ClientCert, "client-cert", "", "issue client certificate")
+	flag.StringVar(&opts.ClientCertOut, "client-cert-out", "", "client certificate file")
+	flag.IntVar(&opts.ClientCertDays, "client-cert-days", 365, "client certificate validity")
+	flag.StringVar(&opts.ClientCertRevoke, "client-cert-revoke", "", "revoke client certificate")
+	flag.StringVar(&opts.CARevoked, "ca-revoked", "", "revoked serials file")
+	flag.StringVar(&opts.CACRL, "ca-crl", "", "ca crl file")
+	flag.StringVar(&opts.CAMap, "ca-map", "", "client certificate mapping file")
 	flag.StringVar(&opts.BasicAuth, "b", "", "basic auth")
 	flag.StringVar(&opts.BasicAuth, "basic-auth", "", "basic auth")
 	flag.StringVar(&opts.CertAuth, "ca", "", "cert auth")
 	flag.StringVar(&opts.CertAuth, "cert-auth", "", "cert auth")
+	flag.StringVar(&opts.UsersFile, "U", "", "users file")
+	flag.StringVar(&opts.UsersFile, "users", "", "users file")
+	flag.StringVar(&opts.OIDCIssuer, "oidc-issuer", "", "oidc issuer")
+	flag.StringVar(&opts.OIDCClientID, "oidc-client-id", "", "oidc client id")
+	flag.StringVar(&opts.OIDCClientSecret, "oidc-client-secret", "", "oidc client secret")
+	flag.StringVar(&opts.OIDCRedirectURL, "oidc-redirect-url", "", "oidc redirect url")
+	flag.StringVar(&opts.OIDCEmails, "oidc-emails", "", "oidc allowed emails")
+	flag.StringVar(&opts.OIDCGroups, "oidc-groups", "", "oidc allowed groups")
+	flag.StringVar(&opts.TOTPFile, "totp", "", "totp secrets file")
+	flag.BoolVar(&opts.TOTPBasicUpload, "totp-basic-upload", false, "allow basic auth uploads without totp")
+	flag.StringVar(&opts.TokensFile, "tokens", "", "api tokens file")
 	flag.BoolVar(&opts.WebDav, "w", false, "enable webdav")
 	flag.BoolVar(&opts.WebDav, "webdav", false, "enable webdav")
 	flag.IntVar(&opts.WebDavPort, "wp", 8001, "webdav port")
@@ -140,10 +236,19 @@ func Parse() (*Options, bool) {
 	flag.StringVar(&opts.LEHTTPPort, "le-http", "80", "")
 	flag.StringVar(&opts.LETLSPort, "slt", "443", "")
 	flag.StringVar(&opts.LETLSPort, "le-tls", "443", "")
+	flag.StringVar(&opts.LEDirectory, "sla", "", "")
+	flag.StringVar(&opts.LEDirectory, "le-acme-url", "", "")
+	flag.StringVar(&opts.LEACMECA, "le-acme-ca", "", "")
+	flag.StringVar(&opts.LEChallenges, "slc", "http,tls", "")
+	flag.StringVar(&opts.LEChallenges, "le-challenges", "http,tls", "")
 	flag.BoolVar(&opts.Embedded, "e", false, "")
 	flag.BoolVar(&opts.Embedded, "embedded", false, "")
 	flag.StringVar(&opts.Output, "o", "", "")
 	flag.StringVar(&opts.Output, "output", "", "")
+	flag.StringVar(&opts.LogFormat, "log-format", "text", "")
+	flag.IntVar(&opts.LogMaxSize, "log-max-size", 0, "")
+	flag.StringVar(&opts.LogMaxAge, "log-max-age", "", "")
+	flag.IntVar(&opts.LogKeep, "log-keep", 0, "")
 	flag.BoolVar(&opts.WebhookEnabled, "W", false, "")
 	flag.BoolVar(&opts.WebhookEnabled, "webhook", false, "")
 	flag.StringVar(&opts.WebhookURL, "Wu", "", "")
@@ -152,6 +257,10 @@ func Parse() (*Options, bool) {
 	flag.StringVar(&opts.WebhookEvents, "webhook-events", "all", "")
 	flag.StringVar(&opts.WebhookProvider, "Wp", "Discord", "")
 	flag.StringVar(&opts.WebhookProvider, "webhook-provider", "Discord", "")
+	flag.StringVar(&opts.WebhookTemplate, "webhook-template", "", "")
+	flag.StringVar(&opts.WebhookHeaders, "webhook-headers", "", "")
+	flag.StringVar(&opts.WebhookSecret, "webhook-secret", "", "")
+	flag.IntVar(&opts.WebhookRetries, "webhook-retries", 3, "")
 	flag.BoolVar(&opts.SFTP, "sftp", false, "sftp")
 	flag.IntVar(&opts.SFTPPort, "sp", 2022, "sftp port")
 	flag.IntVar(&opts.SFTPPort, "sftp-port", 2022, "sftp port")
@@ -167,10 +276,23 @@ func Parse() (*Options, bool) {
 	flag.StringVar(&opts.UploadFolder, "upload-folder", "", "")
 	flag.BoolVar(&opts.MDNS, "m", false, "Enable zeroconf mDNS registration")
 	flag.BoolVar(&opts.MDNS, "mdns", false, "Enable zeroconf mDNS registration")
+	flag.BoolVar(&opts.Metrics, "metrics", false, "Serve Prometheus metrics at /metrics")
+	flag.IntVar(&opts.MetricsPort, "metrics-port", 0, "Serve the metrics on their own port")
 	flag.BoolVar(&opts.Invisible, "I", false, "Enable invisible mode")
 	flag.BoolVar(&opts.Invisible, "invisible", false, "Enable invisible mode")
 	flag.BoolVar(&opts.Tunnel, "t", false, "Enable tunnel")
 	flag.BoolVar(&opts.Tunnel, "tunnel", false, "Enable tunnel")
+	flag.StringVar(&opts.TunnelServer, "tunnel-server", "", "goshs relay to open the tunnel on")
+	flag.StringVar(&opts.TunnelUser, "tunnel-user", "", "User of the goshs relay")
+	flag.StringVar(&opts.TunnelKey, "tunnel-key", "", "Private key for the goshs relay")
+	flag.StringVar(&opts.TunnelHostKey, "tunnel-host-key", "", "Pinned host key of the goshs relay")
+	flag.BoolVar(&opts.Relay, "relay", false, "Enable tunnel relay")
+	flag.IntVar(&opts.RelayPort, "relay-port", 2222, "Tunnel relay SSH port")
+	flag.IntVar(&opts.RelayHTTPPort, "relay-http-port", 8080, "Tunnel relay HTTP port of the subdomains")
+	flag.StringVar(&opts.RelayDomain, "relay-domain", "", "Domain the tunnel relay issues subdomains of")
+	flag.StringVar(&opts.RelayPorts, "relay-ports", "20000-20099", "Ports the tunnel relay issues")
+	flag.StringVar(&opts.RelayKeys, "relay-keys", "", "Authorized keys of the tunnel relay clients")
+	flag.StringVar(&opts.RelayHostKey, "relay-host-key", "", "Host key of the tunnel relay")
 	flag.BoolVar(&opts.DNS, "dns", false, "Enable DNS server")
 	flag.BoolVar(&opts.DNS, "dns-server", false, "Enable DNS server")
 	flag.IntVar(&opts.DNSPort, "dns-port", 8053, "DNS server port")
@@ -179,6 +301,15 @@ func Parse() (*Options, bool) {
 	flag.BoolVar(&opts.SMTP, "smtp-server", false, "Enable SMTP server")
 	flag.IntVar(&opts.SMTPPort, "smtp-port", 2525, "SMTP server port")
 	flag.StringVar(&opts.SMTPDomain, "smtp-domain", "", "SMTP server domain")
+	flag.IntVar(&opts.SMTPSPort, "smtps-port", 4465, "SMTPS (implicit TLS) port, 0 disables")
+	flag.StringVar(&opts.SMTPMailDir, "smtp-mail-dir", "", "Directory received mail is stored in as .eml")
+	flag.StringVar(&opts.SMTPForward, "smtp-forward", "", "Copy received mail to mbox:<file> or maildir:<dir>")
+	flag.BoolVar(&opts.POP3, "pop3", false, "Enable POP3 server")
+	flag.BoolVar(&opts.POP3, "pop3-server", false, "Enable POP3 server")
+	flag.IntVar(&opts.POP3Port, "pop3-port", 1110, "POP3 server port")
+	flag.BoolVar(&opts.IMAP, "imap", false, "Enable IMAP server")
+	flag.BoolVar(&opts.IMAP, "imap-server", false, "Enable IMAP server")
+	flag.IntVar(&opts.IMAPPort, "imap-port", 1143, "IMAP server port")
 	flag.BoolVar(&opts.SMB, "smb", false, "Enable SMB server")
 	flag.BoolVar(&opts.SMB, "smb-server", false, "Enable SMB server")
 	flag.IntVar(&opts.SMBPort, "smb-port", 445, "SMB server port")
@@ -187,14 +318,25 @@ func Parse() (*Options, bool) {
 	flag.StringVar(&opts.SMBWordlist, "smb-wordlist", "", "Wordlist file for SMB hash cracking")
 	flag.Int64Var(&opts.MaxUploadSize, "mu", 0, "Maximum upload size in bytes (0 = unlimited)")
 	flag.Int64Var(&opts.MaxUploadSize, "max-upload", 0, "Maximum upload size in bytes (0 = unlimited)")
+	flag.StringVar(&opts.ShareFile, "share-file", "", "Persist shared links in this file")
 	flag.BoolVar(&opts.Catcher, "catcher", false, "Enable reverse shell catcher")
 	flag.BoolVar(&opts.Catcher, "rc", false, "Enable reverse shell catcher")
 	flag.BoolVar(&opts.LDAP, "ldap", false, "Enable LDAP server")
 	flag.BoolVar(&opts.LDAP, "ldap-server", false, "Enable LDAP server")
 	flag.IntVar(&opts.LDAPPort, "ldap-port", 389, "LDAP server port")
 	flag.BoolVar(&opts.LDAPJNDIEnabled, "ldap-jndi", false, "Enable dynamic JNDI mode (baseDN becomes the class name)")
-	flag.StringVar(&opts.LDAPJNDIBase, "ldap-jndi-base", "", "JNDI codeBase URL override (default: auto from HTTP server)")
+	flag.StringVar(&opts.LDAPJNDIBase, "ldap-jndi-base", "", "JNDI codeBase URL override (default: auto from HTTP server or its tunnel)")
 	flag.StringVar(&opts.LDAPWordlist, "ldap-wordlist", "", "Wordlist file for LDAP NTLM hash cracking")
+	flag.BoolVar(&opts.WPAD, "wpad", false, "Enable WPAD proxy")
+	flag.BoolVar(&opts.WPAD, "wpad-server", false, "Enable WPAD proxy")
+	flag.IntVar(&opts.WPADPort, "wpad-port", 3128, "WPAD proxy port")
+	flag.StringVar(&opts.WPADHost, "wpad-host", "", "Proxy host announced in the PAC file")
+	flag.StringVar(&opts.WPADAuth, "wpad-auth", "ntlm", "WPAD proxy auth scheme (ntlm, basic)")
+	flag.BoolVar(&opts.WPADForward, "wpad-forward", false, "Forward proxied requests after capture")
+	flag.IntVar(&opts.CrackWorkers, "crack-workers", 0, "Number of hash cracking workers (0 = number of CPUs)")
+	flag.StringVar(&opts.CrackRules, "crack-rules", "", "Hashcat rule file for background cracking (or 'builtin')")
+	flag.StringVar(&opts.CrackMask, "crack-mask", "", "Mask to try in background cracking, e.g. ?u?l?l?l?d?d")
+	flag.IntVar(&opts.CrackMaskMaxLen, "crack-mask-max", 8, "Maximum number of mask positions")
 
 	// One-shot flags
 	upd := flag.Bool("update", false, "update")
@@ -204,13 +346,21 @@ func Parse() (*Options, bool) {
 	hashLong := flag.Bool("hash", false, "hash")
 	version := flag.Bool("v", false, "goshs version")
 	comp := flag.String("completion", "", "shell for completion (bash, fish, zsh)")
+	tokenCreate := flag.String("token-create", "", "create api token name:scope[:path]")
+	tokenExpiry := flag.String("token-expiry", "", "lifetime of the created api token")
+	tokenRevoke := flag.String("token-revoke", "", "revoke api token")
+	tokenList := flag.Bool("token-list", false, "list api tokens")
+	totpEnroll := flag.String("totp-enroll", "", "enroll a totp user")
 
 	flag.Usage = usage()
 
 	flag.Parse()
+	opts.Given = given(opts)
 
 	// Check and execute one-shot functions and execute -> early exit
 	oneShotFunctions(upd, hash, hashLong, version, comp)
+	tokenCommands(opts.TokensFile, *tokenCreate, *tokenExpiry, *tokenRevoke, *tokenList)
+	totpCommands(opts.TOTPFile, *totpEnroll, isSet("totp-enroll"))
 
 	// Check for print config flag
 	if *printConfig || *printConfigLong {
@@ -231,6 +381,32 @@ func Parse() (*Options, bool) {
 	return opts, false
 }
 
+// isSet reports whether the flag name is on the command line.
+func isSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// given returns the fields of opts set by the flags on the command line.
+func given(opts *Options) map[string]bool {
+	fields := map[uintptr]string{}
+	v := reflect.ValueOf(opts).Elem()
+	for i := range v.NumField() {
+		fields[v.Field(i).Addr().Pointer()] = v.Type().Field(i).Name
+	}
+
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		if name, ok := fields[reflect.ValueOf(f.Value).Pointer()]; ok {
+			set[name] = true
+		}
+	})
+	return set
+}
+
 func usage() func() {
 	return func() {
 		fmt.Printf(`
@@ -247,6 +423,7 @@ Web server options:
   -uo, --upload-only    Upload only mode, no download possible    (default: false)
   -uf, --upload-folder  Specify a different upload folder         (default: current working path)
   -mu, --max-upload     Maximum upload size in bytes, 0=unlimited (default: 0)
+  -share-file           Keep shared links in this file across restarts
   -nc, --no-clipboard   Disable the clipboard sharing             (default: false)
   -nd, --no-delete      Disable the delete option                 (default: false)
   -si, --silent         Running without dir listing               (default: false)
@@ -255,11 +432,24 @@ Web server options:
   --catcher, -rc        Enable reverse shell catcher              (default: false)
   -e,  --embedded       Show embedded files in UI                 (default: false)
   -o,  --output         Write output to logfile                   (default: false)
+  --log-format          Log format: text, json, clf or combined   (default: text)
+  --log-max-size        Rotate the logfile at this size in MB     (default: 0, off)
+  --log-max-age         Rotate the logfile at this age, like 24h or 7d
+  --log-keep            Number of rotated logfiles to keep        (default: 0, all)
   -t,  --tunnel         Enable tunnel                             (default: false)
+  -tunnel-server        Open the tunnel on this goshs relay (host:port)
+                        instead of localhost.run
+  -tunnel-user          User of the goshs relay                   (default: goshs)
+  -tunnel-key           Private key to log in to the goshs relay with
+  -tunnel-host-key      Pin the host key of the goshs relay, SHA256 fingerprint
+                        or public key             (default: trust on first use)
 
 TLS options:
   -s,     --ssl           Use TLS
-  -ss,    --self-signed   Use a self-signed certificate
+  -ss,    --self-signed   Use a self-signed certificate, issued by a CA kept in -ca-dir
+  -ss-hosts               Comma separated hostnames and IPs for the self-signed
+                          certificate next to the local addresses
+  -ca-dir                 Directory of the goshs CA   (default: ~/.config/goshs/ca)
   -sk,    --server-key    Path to server key
   -sc,    --server-cert   Path to server certificate
   -p12,   --pkcs12        Path to server p12
@@ -269,6 +459,11 @@ TLS options:
   -sle,   --le-email      Email to use with Let's Encrypt
   -slh,   --le-http       Port to use for Let's Encrypt HTTP Challenge	   (default: 80)
   -slt,   --le-tls        Port to use for Let's Encrypt TLS ALPN Challenge (default: 443)
+  -sla,   --le-acme-url   ACME directory URL, like a Pebble or step-ca instance
+                          (default: Let's Encrypt production)
+  -le-acme-ca             CA certificate to trust for the ACME server
+  -slc,   --le-challenges Challenges to solve: http, tls and dns, where dns
+                          needs -dns                (default: http,tls)
 
 SFTP server options:
   -sftp                        Activate SFTP server capabilities (default: false)
@@ -292,10 +487,54 @@ LDAP server options:
   -ldap-wordlist               Wordlist file for quick LDAP NTLM hash cracking
   Use -s -ss or -s -sc/-sk to enable LDAPS (TLS) on default port 636
 
+WPAD options:
+  -wpad, --wpad-server         Serve /wpad.dat and run a credential capturing proxy (default: false)
+  -wpad-port                   The port the WPAD proxy listens on       (default: 3128)
+  -wpad-host                   Proxy host announced in the PAC file     (default: auto)
+  -wpad-auth                   Proxy auth scheme to demand [ntlm, basic] (default: ntlm)
+  -wpad-forward                Forward requests after capture instead of refusing them
+
+Hash cracking options (SMB, LDAP, WPAD and SMTP captures):
+  -crack-workers               Number of cracking workers               (default: number of CPUs)
+  -crack-rules                 Hashcat rule file for wordlist jobs, or 'builtin'
+  -crack-mask                  Mask to try after capture, e.g. ?u?l?l?l?d?d
+  -crack-mask-max              Maximum number of mask positions          (default: 8)
+
 Authentication options:
   -b,  --basic-auth     Use basic authentication (user:pass - user can be empty)
-  -ca, --cert-auth      Use certificate based authentication - provide ca certificate
+  -ca, --cert-auth      Use certificate based authentication - provide ca certificate,
+                        or 'self' for the goshs CA in -ca-dir
+  -client-cert          Issue a client certificate (PKCS#12) for this name with the
+                        goshs CA and exit
+  -client-cert-out      File to write the client certificate to   (default: <name>.p12)
+  -client-cert-days     Validity of the client certificate        (default: 365)
+  -client-cert-revoke   Revoke the client certificate with this serial and exit
+  -ca-revoked           File with revoked client certificate serials, one per line
+                        (default: revoked.txt in -ca-dir with -ca self)
+  -ca-crl               CRL of the -ca certificate to reject revoked client certificates
+  -ca-map               File mapping client certificates to users, one
+                        "identity user [role]" per line - identity is the CN or a SAN,
+                        certificates without mapping are denied
+  -U,  --users          Users file with one name:hash:role[:home] per line for HTTP,
+                        WebDAV, SFTP and SMB - roles: read, upload, full, admin
   -H,  --hash           Hash a password for file based ACLs
+  -oidc-issuer          Log in to the web UI with this OpenID Connect issuer
+  -oidc-client-id       OIDC client id
+  -oidc-client-secret   OIDC client secret
+  -oidc-redirect-url    OIDC redirect URL     (default: <scheme>://<host>/?oidc-callback)
+  -oidc-emails          Comma separated emails allowed to log in, @domain for whole domains;
+                        only addresses with email_verified set by the issuer count
+  -oidc-groups          Comma separated groups claim values allowed to log in
+  -totp                 Require a TOTP code for web UI logins, secrets are kept in this
+                        file; users without a secret cannot log in
+  -totp-enroll          Enroll a user in the -totp file, print its QR code and exit
+  -totp-basic-upload    Still accept basic auth without TOTP for uploads (default: false)
+  -tokens               API tokens file, enables "Authorization: Bearer" for HTTP and WebDAV
+  -token-create         Create a token name:scope[:path] and exit, scopes: upload,
+                        read (optionally below path), events, catcher, metrics
+  -token-expiry         Lifetime of the created token, e.g. 12h or 30d (default: never)
+  -token-revoke         Revoke the named token and exit
+  -token-list           List the tokens and exit
 
 Connection restriction:
   -ipw, --ip-whitelist             Comma separated list of IPs to whitelist
@@ -308,22 +547,56 @@ Collaboration options:
   -smtp, --smtp-server         Enable SMTP server                  (default: false)
   -smtp-port, --smtp-port      SMTP server port                    (default: 2525)
   -smtp-domain, --smtp-domain  SMTP server domain                  (default: open relay)
+  -smtps-port, --smtps-port    SMTPS (implicit TLS) port, 0 disables (default: 4465)
+  -smtp-mail-dir               Directory mail is stored in as .eml (default: ~/.config/goshs/mail)
+  -smtp-forward                Copy mail to mbox:<file> or maildir:<dir> (default: none)
+  -pop3, --pop3-server         Enable POP3 read access to the mail     (default: false)
+  -pop3-port, --pop3-port      POP3 server port                    (default: 1110)
+  -imap, --imap-server         Enable IMAP read access to the mail     (default: false)
+  -imap-port, --imap-port      IMAP server port                    (default: 1143)
+                               POP3/IMAP login: <recipient address>*<user> with the -b or
+                               users file password (admins only); -s switches both to
+                               implicit TLS
+
+Tunnel relay options:
+  -relay                       Run an SSH server goshs clients open their tunnels on (default: false)
+  -relay-port                  The port the relay listens on           (default: 2222)
+  -relay-keys                  Authorized_keys file of the clients
+  -relay-host-key              SSH host key file      (default: ~/.config/goshs/relay_host_key)
+  -relay-domain                Issue <name>.<domain> subdomains for HTTP tunnels and report
+                               the URLs with this host         (default: ports only)
+  -relay-http-port             The port the subdomains are served on   (default: 8080)
+  -relay-ports                 Ports issued for the other tunnels      (default: 20000-20099)
 
 Webhook options:
   -W,  --webhook            Enable webhook support                      (default: false)
   -Wu, --webhook-url        URL to send webhook requests to
   -We, --webhook-events     Comma separated list of events to notify
                             [all, upload, delete, download, view, webdav,
-                            sftp, smb, dns, smtp, redirect, verbose]	(default: all)
-  -Wp, --webhook-provider   Webhook provider
-                            [Discord, Mattermost, Slack]                (default: Discord)
+                            sftp, smb, ldap, dns, smtp, wpad, redirect,
+                            catcher, verbose]	(default: all)
+  -Wp, --webhook-provider   Webhook provider [Discord, Mattermost, Slack,
+                            Teams, Telegram, ntfy, Gotify, Generic]     (default: Discord)
+                            Telegram: -Wu .../bot<token>/sendMessage?chat_id=<chat>
+  -webhook-template         Go text/template file for the Generic body  (default: event as JSON)
+  -webhook-headers          Comma separated "Name: value" headers for
+                            Generic, ntfy and Gotify
+  -webhook-secret           Sign Generic bodies with HMAC-SHA256 in the
+                            X-Goshs-Signature-256 header
+  -webhook-retries          Retries of a failed notification            (default: 3)
 
 Misc options:
-  -C  --config        Provide config file path                (default: false)
+  -C  --config        Provide config file path (JSON, YAML or TOML)
+                      reloaded on SIGHUP or POST /?config-api=reload
+      --check-config  Validate a config file and report unknown keys
+                      Keys can also be set as GOSHS_<KEY>, like GOSHS_SMB_PORT
   -P  --print-config  Print sample config to STDOUT           (default: false)
   -u  --user          Drop privs to user (unix only)          (default: current user)
       --update        Update goshs to most recent version
   -m  --mdns          Enable zeroconf mDNS registration       (default: false)
+      --metrics       Serve Prometheus metrics at /metrics,   (default: false)
+                      protected like the web UI, or with a metrics token
+      --metrics-port  Serve the metrics on their own port     (default: web port)
   -V  --verbose       Activate verbose log output             (default: false)
   -v                  Print the current goshs version
 
@@ -340,6 +613,11 @@ Usage examples:
   Start with basic auth:        	./goshs -b 'secret-user:$up3r$3cur3'
   Start with basic auth bcrypt hash:   	./goshs -b 'secret-user:$2a$14$ydRJ//Ob4SctB/D7o.rvU.LmPs/vwXkeXCbtpCqzgOJDSShLgiY52'
   Start with basic auth empty user:	./goshs -b ':$up3r$3cur3'
+  Start with a users file:		./goshs -U /path/to/users
+  Enroll a TOTP user:			./goshs -totp /path/to/totp-secrets -totp-enroll secret-user
+  Start with OIDC login:		./goshs -s -ss -oidc-issuer https://idp.example.com -oidc-client-id goshs -oidc-client-secret s3cret -oidc-emails @example.com
+  Start with TOTP login:		./goshs -s -ss -b 'secret-user:$up3r$3cur3' -totp /path/to/totp-secrets
+  Create an upload token:		./goshs -tokens /path/to/tokens.json -token-create loot:upload -token-expiry 7d
   Start with cli enabled:           	./goshs -b 'secret-user:$up3r$3cur3' -s -ss -c
 
 `, goshsversion.GoshsVersion, os.Args[0])
@@ -382,6 +660,98 @@ func oneShotFunctions(upd, hash, hashLong, version *bool, comp *string) {
 	}
 }
 
+// tokenCommands manages the API tokens in file and exits if one of the
+// token flags is given.
+func tokenCommands(file, create, expiry, revoke string, list bool) {
+	if create == "" && revoke == "" && !list {
+		return
+	}
+	if file == "" {
+		logger.Fatal("Managing API tokens needs the tokens file (-tokens).")
+	}
+	store, err := apitoken.Load(file)
+	if err != nil {
+		logger.Fatalf("error loading API tokens: %+v", err)
+	}
+
+	if create != "" {
+		name, rest, _ := strings.Cut(create, ":")
+		scopeName, path, _ := strings.Cut(rest, ":")
+		scope, err := apitoken.ParseScope(scopeName)
+		if err != nil {
+			logger.Fatalf("error creating API token: %+v", err)
+		}
+		ttl, err := duration.Parse(expiry)
+		if err != nil {
+			logger.Fatalf("error creating API token: %+v", err)
+		}
+		t, secret, err := apitoken.New(name, scope, path, ttl)
+		if err != nil {
+			logger.Fatalf("error creating API token: %+v", err)
+		}
+		if err := store.Add(t); err != nil {
+			logger.Fatalf("error creating API token: %+v", err)
+		}
+		fmt.Printf("Created %s token %s. It is only shown this once:\n%s\n", t.Scope, t.Name, secret)
+	}
+
+	if revoke != "" {
+		if err := store.Revoke(revoke); err != nil {
+			logger.Fatalf("error revoking API token %s: %+v", revoke, err)
+		}
+		fmt.Printf("Revoked token %s\n", revoke)
+	}
+
+	if list {
+		tokens, err := store.List()
+		if err != nil {
+			logger.Fatalf("error listing API tokens: %+v", err)
+		}
+		for _, t := range tokens {
+			expires := "never"
+			if !t.Expires.IsZero() {
+				expires = t.Expires.Local().Format(time.DateTime)
+				if t.Expired(time.Now()) {
+					expires += " (expired)"
+				}
+			}
+			fmt.Printf("%-20s %-8s %-20s expires: %s\n", t.Name, t.Scope, t.Path, expires)
+		}
+	}
+	os.Exit(0)
+}
+
+// totpCommands enrolls user in the TOTP secrets file and exits if
+// -totp-enroll is given, an empty user is the -b credential without user.
+// The QR code is shown once on the terminal.
+func totpCommands(file, user string, enroll bool) {
+	if !enroll {
+		return
+	}
+	if file == "" {
+		logger.Fatal("Enrolling a TOTP user needs the secrets file (-totp).")
+	}
+	store, err := totp.Load(file)
+	if err != nil {
+		logger.Fatalf("error loading TOTP secrets: %+v", err)
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		logger.Fatalf("error enrolling %s: %+v", user, err)
+	}
+	if err := store.Enroll(user, secret); err != nil {
+		logger.Fatalf("error enrolling %s: %+v", user, err)
+	}
+
+	uri := totp.URI("goshs", user, secret)
+	qr, err := qrcode.New(uri, qrcode.Medium)
+	if err != nil {
+		logger.Fatalf("error enrolling %s: %+v", user, err)
+	}
+	fmt.Printf("Enrolled %s. Scan the code with an authenticator app, it is only shown this once:\n%s\nSecret: %s\n", user, qr.ToSmallString(false), secret)
+	os.Exit(0)
+}
+
 func resolveInterface(ip string) string {
 	// If it parses as an IP address (v4 or v6), use it directly.
 	if net.ParseIP(ip) != nil {
@@ -5,13 +5,22 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
+	"goshs.de/goshs/v2/apitoken"
 	"goshs.de/goshs/v2/ca"
+	"goshs.de/goshs/v2/config"
+	"goshs.de/goshs/v2/duration"
 	"goshs.de/goshs/v2/goshsversion"
 	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/mailstore"
 	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/smbserver"
+	"goshs.de/goshs/v2/totp"
+	"goshs.de/goshs/v2/tunnel"
 	"goshs.de/goshs/v2/update"
+	"goshs.de/goshs/v2/users"
 )
 
 func Sanitize(opts *options.Options) (*options.Options, error) {
@@ -33,6 +42,20 @@ func Sanitize(opts *options.Options) (*options.Options, error) {
 }
 
 func Check(opts *options.Options) (*options.Options, error) {
+	// Log format first, so the following messages use it
+	if err := logger.SetFormat(opts.LogFormat); err != nil {
+		return opts, err
+	}
+	if opts.LogMaxSize < 0 || opts.LogKeep < 0 {
+		return opts, fmt.Errorf("-log-max-size and -log-keep cannot be negative")
+	}
+	if _, err := duration.Parse(opts.LogMaxAge); err != nil {
+		return opts, fmt.Errorf("-log-max-age: %w", err)
+	}
+	if opts.Output == "" && (opts.LogMaxSize > 0 || opts.LogMaxAge != "") {
+		logger.Warn("-log-max-size and -log-max-age only rotate the logfile of -o")
+	}
+
 	if opts.ConfigFile != "" {
 		if opts.Webroot == filepath.Dir(opts.ConfigPath) {
 			logger.Warn("You are hosting your config file in the webroot of goshs. This is not recommended.")
@@ -58,7 +81,143 @@ func Check(opts *options.Options) (*options.Options, error) {
 		opts.DNS = false
 		opts.SMTP = false
 		opts.LDAP = false
-		logger.Warn("Invisible mode activated, disabling SFTP, WebDAV, silent mode, DNS, SMTP, LDAP and mDNS support")
+		opts.WPAD = false
+		opts.POP3 = false
+		opts.IMAP = false
+		opts.Metrics = false
+		opts.MetricsPort = 0
+		logger.Warn("Invisible mode activated, disabling SFTP, WebDAV, silent mode, DNS, SMTP, POP3, IMAP, LDAP, WPAD, metrics and mDNS support")
+	}
+
+	// Sanity check for the WPAD proxy auth scheme
+	if auth := strings.ToLower(opts.WPADAuth); opts.WPAD && auth != "" && auth != "ntlm" && auth != "basic" {
+		logger.Fatal("The WPAD proxy auth scheme has to be either 'ntlm' or 'basic'.")
+	}
+
+	// Sanity check for background cracking attacks
+	if opts.CrackMask != "" {
+		if _, err := smbserver.ParseMask(opts.CrackMask, opts.CrackMaskMaxLen); err != nil {
+			logger.Fatalf("Invalid crack mask: %+v", err)
+		}
+	}
+	if opts.CrackRules != "" && opts.CrackRules != "builtin" {
+		if _, err := os.Stat(opts.CrackRules); err != nil {
+			logger.Fatalf("Cannot read crack rule file: %+v", err)
+		}
+	}
+
+	// Sanity check for SMTP mail forwarding
+	if opts.SMTPForward != "" {
+		if _, err := mailstore.ParseForward(opts.SMTPForward); err != nil {
+			logger.Fatalf("Invalid SMTP forward: %+v", err)
+		}
+	}
+
+	// The mailboxes are as protected as the web server
+	if (opts.POP3 || opts.IMAP) && opts.Password == "" && opts.UsersFile == "" && (opts.CertAuth != "" || opts.OIDCIssuer != "") {
+		logger.Fatal("POP3 and IMAP (-pop3, -imap) need basic auth (-b) or a users file (-U) next to cert or OIDC auth.")
+	}
+
+	// Sanity check for the users file
+	if opts.UsersFile != "" {
+		if strings.Trim(opts.BasicAuth, ":") != "" {
+			logger.Fatal("You can only use either basic auth (-b) or a users file (-U), not both.")
+		}
+		if _, err := users.Load(opts.UsersFile); err != nil {
+			logger.Fatalf("Invalid users file: %+v", err)
+		}
+	}
+
+	// Sanity check for OIDC login
+	if opts.OIDCIssuer != "" {
+		if opts.OIDCClientID == "" {
+			logger.Fatal("OIDC login (-oidc-issuer) needs a client id (-oidc-client-id).")
+		}
+		if opts.Invisible {
+			logger.Fatal("OIDC login (-oidc-issuer) cannot be combined with invisible mode (-I).")
+		}
+		if opts.OIDCEmails == "" && opts.OIDCGroups == "" && opts.UsersFile == "" {
+			logger.Fatalf("OIDC login needs -oidc-emails, -oidc-groups or a users file (-U), otherwise every user of %s gets in.", opts.OIDCIssuer)
+		}
+		if opts.WebDav || opts.SFTP || opts.SMB {
+			logger.Warn("OIDC only protects the web UI, WebDAV, SFTP and SMB are not covered by it.")
+		}
+	}
+
+	// Sanity check for TOTP login
+	if opts.TOTPFile != "" {
+		if opts.BasicAuth == "" && opts.UsersFile == "" {
+			logger.Fatal("TOTP login (-totp) needs basic auth (-b) or a users file (-U).")
+		}
+		if opts.OIDCIssuer != "" {
+			logger.Fatal("TOTP login (-totp) cannot be combined with OIDC login (-oidc-issuer).")
+		}
+		if opts.Invisible {
+			logger.Fatal("TOTP login (-totp) cannot be combined with invisible mode (-I).")
+		}
+		if _, err := totp.Load(opts.TOTPFile); err != nil {
+			logger.Fatalf("Invalid TOTP secrets file: %+v", err)
+		}
+		if opts.WebDav || opts.SFTP || opts.SMB {
+			logger.Warn("TOTP only protects the web UI, WebDAV, SFTP and SMB still log in with the password alone.")
+		}
+	} else if opts.TOTPBasicUpload {
+		logger.Warn("-totp-basic-upload has no effect without -totp.")
+	}
+
+	// Sanity check for API tokens
+	if opts.TokensFile != "" {
+		if _, err := apitoken.Load(opts.TokensFile); err != nil {
+			logger.Fatalf("Invalid API tokens file: %+v", err)
+		}
+		if opts.BasicAuth == "" && opts.UsersFile == "" && opts.OIDCIssuer == "" && opts.CertAuth == "" {
+			logger.Warn("API tokens (-tokens) restrict nothing without authentication, everyone has full access.")
+		}
+	}
+
+	// Sanity check for the metrics, a port of their own implies -metrics
+	if opts.MetricsPort != 0 {
+		if opts.MetricsPort < 0 || opts.MetricsPort > 65535 {
+			logger.Fatalf("Invalid metrics port %d", opts.MetricsPort)
+		}
+		if opts.MetricsPort == opts.Port || (opts.WebDav && opts.MetricsPort == opts.WebDavPort) {
+			logger.Fatal("The metrics port (-metrics-port) has to differ from the web and WebDAV ports.")
+		}
+		opts.Metrics = true
+	}
+	if opts.Metrics && opts.BasicAuth == "" && opts.UsersFile == "" && opts.OIDCIssuer == "" && opts.CertAuth == "" && opts.Whitelist == "" {
+		logger.Warn("The metrics (-metrics) are served to everyone without authentication or an IP whitelist.")
+	}
+
+	// Sanity check for the tunnel relay and the tunnel on a relay
+	if _, _, err := tunnel.ParsePortRange(opts.RelayPorts); err != nil {
+		logger.Fatalf("Invalid relay ports (-relay-ports): %+v", err)
+	}
+	if opts.Relay && opts.RelayKeys == "" {
+		logger.Fatal("The tunnel relay (-relay) needs the authorized keys of its clients (-relay-keys).")
+	}
+	if opts.Relay && opts.RelayDomain == "" && opts.RelayPorts == "" {
+		logger.Fatal("The tunnel relay (-relay) needs a domain (-relay-domain) or ports (-relay-ports) to issue.")
+	}
+	if opts.TunnelServer == "" && (opts.TunnelUser != "" || opts.TunnelKey != "" || opts.TunnelHostKey != "") {
+		logger.Warn("-tunnel-user, -tunnel-key and -tunnel-host-key are only used with -tunnel-server.")
+	}
+	if opts.TunnelServer != "" && !opts.Tunnel {
+		logger.Warn("-tunnel-server has no effect without the tunnel (-t).")
+	}
+
+	// Sanity check for persisted share links
+	if opts.ShareFile != "" && opts.BasicAuth == "" && opts.UsersFile == "" && opts.OIDCIssuer == "" && opts.CertAuth == "" {
+		logger.Warn("-share-file has no effect without authentication, sharing is disabled.")
+	}
+
+	// Sanity check for provider specific webhook settings
+	provider := strings.ToLower(opts.WebhookProvider)
+	if (opts.WebhookTemplate != "" || opts.WebhookSecret != "") && provider != "generic" && provider != "json" {
+		logger.Warn("-webhook-template and -webhook-secret are only used by the Generic webhook provider.")
+	}
+	if opts.WebhookHeaders != "" && !slices.Contains([]string{"generic", "json", "ntfy", "gotify"}, provider) {
+		logger.Warn("-webhook-headers is only used by the Generic, ntfy and Gotify webhook providers.")
 	}
 
 	// Sanity check for upload only vs read only
@@ -67,16 +226,16 @@ func Check(opts *options.Options) (*options.Options, error) {
 	}
 
 	// Sanity check if cli mode is combined with auth and tls
-	if opts.CLI && (!opts.SSL || opts.BasicAuth == "") {
+	if opts.CLI && (!opts.SSL || (opts.BasicAuth == "" && opts.UsersFile == "" && opts.OIDCIssuer == "")) {
 		if opts.CLI && (!opts.SSL || opts.CertAuth == "") {
-			logger.Fatal("With cli mode you need to enable basic/cert auth and tls for security reasons.")
+			logger.Fatal("With cli mode you need to enable basic/cert/OIDC auth and tls for security reasons.")
 		}
 	}
 
 	// Sanity check if catcher mode is combined with auth and tls
-	if opts.Catcher && (!opts.SSL || opts.BasicAuth == "") {
+	if opts.Catcher && (!opts.SSL || (opts.BasicAuth == "" && opts.UsersFile == "" && opts.OIDCIssuer == "")) {
 		if opts.Catcher && (!opts.SSL || opts.CertAuth == "") {
-			logger.Fatal("With catcher mode you need to enable basic/cert auth and tls for security reasons.")
+			logger.Fatal("With catcher mode you need to enable basic/cert/OIDC auth and tls for security reasons.")
 		}
 	}
 
@@ -85,9 +244,29 @@ func Check(opts *options.Options) (*options.Options, error) {
 		logger.Fatal("To use certificate based authentication with a CA cert you will need tls in any mode (-ss, -sk/-sc, -p12, -sl)")
 	}
 
+	// Revocations and mappings only apply to client certificates
+	if opts.CertAuth == "" && (opts.CARevoked != "" || opts.CACRL != "" || opts.CAMap != "") {
+		logger.Warn("-ca-revoked, -ca-crl and -ca-map have no effect without certificate based authentication (-ca)")
+	}
+
+	// Sanity check for the ACME challenges, dns is answered by the goshs DNS server
+	if opts.LetsEncrypt {
+		for _, c := range strings.Split(opts.LEChallenges, ",") {
+			switch strings.TrimSpace(c) {
+			case ca.ChallengeHTTP, ca.ChallengeTLS:
+			case ca.ChallengeDNS:
+				if !opts.DNS {
+					logger.Fatal("The dns challenge of -le-challenges needs the goshs DNS server (-dns) answering for your domains")
+				}
+			default:
+				logger.Fatalf("Unknown challenge %q in -le-challenges, use http, tls or dns", c)
+			}
+		}
+	}
+
 	// Sanity check either user:pass or keyfile when using sftp
-	if opts.SFTP && (opts.BasicAuth == "" && opts.SFTPKeyFile == "") {
-		logger.Fatal("When using SFTP you need to either specify an authorized keyfile using -sfk or username and password using -b")
+	if opts.SFTP && (opts.BasicAuth == "" && opts.UsersFile == "" && opts.SFTPKeyFile == "") {
+		logger.Fatal("When using SFTP you need to either specify an authorized keyfile using -sfk, username and password using -b or a users file using -U")
 	}
 
 	// Sanity check: empty username is not valid for SFTP password auth
@@ -120,9 +299,31 @@ func FurtherProcessing(opts *options.Options) (*options.Options, error) {
 		opts.Password = auth[1]
 	}
 
-	// If Let's Encrypt is in play we need to fetch the key and cert, write them to disc and set their path in MyKey and MyCert
+	// The self-signed CA is kept in -ca-dir and reused across restarts
+	if opts.CADir == "" {
+		base, err := config.Dir()
+		if err != nil {
+			return opts, err
+		}
+		opts.CADir = filepath.Join(base, "ca")
+	}
+	ca.Persist(opts.CADir, strings.Split(opts.SelfSignedHosts, ","))
+
+	// -ca self requires client certificates issued by that CA
+	if opts.CertAuth == "self" {
+		a, err := ca.Persisted()
+		if err != nil {
+			return opts, err
+		}
+		opts.CertAuth = a.CertFile()
+	}
+	if opts.CertAuth == ca.CertPath(opts.CADir) && opts.CARevoked == "" {
+		opts.CARevoked = filepath.Join(opts.CADir, ca.RevokedFile)
+	}
+
+	// If Let's Encrypt is in play the key and cert are written to disc on start and their path is set in MyKey and MyCert
 	if opts.LetsEncrypt {
-		ca.GetLECertificateAndKey(opts.LEEmail, strings.Split(opts.LEDomains, ","), opts.LEHTTPPort, opts.LETLSPort)
+		opts.LEEmail, opts.LEDomains = ca.AskLetsEncrypt(opts.LEEmail, opts.LEDomains)
 		opts.MyCert = "cert"
 		opts.MyKey = "key"
 	}
@@ -135,12 +336,14 @@ func FurtherProcessing(opts *options.Options) (*options.Options, error) {
 			opts.Output = filepath.Join(wd, opts.Output)
 		}
 
-		logFile, err := os.OpenFile(opts.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		maxAge, _ := duration.Parse(opts.LogMaxAge)
+		logFile, err := logger.OpenRotatingFile(opts.Output, int64(opts.LogMaxSize)*1024*1024, maxAge, opts.LogKeep)
 		if err != nil {
 			logger.Panicf("Cannot open file to write output logfile: %s - %+v", opts.Output, err)
 		}
 
-		multiWriter := io.MultiWriter(os.Stdout, logFile)
+		// The file gets the entries without the colours of the terminal
+		multiWriter := io.MultiWriter(os.Stdout, logger.WithoutColors(logFile))
 		logger.LogFile(multiWriter)
 	}
 
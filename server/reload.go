@@ -0,0 +1,196 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"goshs.de/goshs/v2/config"
+	"goshs.de/goshs/v2/httpserver"
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/users"
+	"goshs.de/goshs/v2/webhook"
+)
+
+// reloadable are the keys of the config file a reload applies to the
+// running servers. Every other key only changes with a restart.
+var reloadable = map[string]bool{
+	"whitelist":        true,
+	"trusted_proxies":  true,
+	"webhook_enabled":  true,
+	"webhook_url":      true,
+	"webhook_provider": true,
+	"webhook_events":   true,
+	"webhook_template": true,
+	"webhook_headers":  true,
+	"webhook_secret":   true,
+	"webhook_retries":  true,
+	"webhooks":         true,
+	"auth_username":    true,
+	"auth_password":    true,
+	"read_only":        true,
+	"upload_only":      true,
+	"no_delete":        true,
+	"max_upload_size":  true,
+	"verbose":          true,
+}
+
+// reconfigurable is a running server taking the options of a reload.
+type reconfigurable interface {
+	Reconfigure(opts *options.Options)
+}
+
+// Reloader applies a changed config file to the running servers, on SIGHUP
+// or via /?config-api=reload. The users file is read again as well.
+type Reloader struct {
+	mu       sync.Mutex
+	opts     options.Options // in effect
+	started  *config.Config  // the config file goshs started with
+	last     *config.Config  // the config file of the last reload
+	wl       *httpserver.Whitelist
+	webhook  *webhook.Switch
+	accounts *users.Users
+	servers  []reconfigurable
+}
+
+func newReloader(opts *options.Options, wl *httpserver.Whitelist, wh *webhook.Switch, accounts *users.Users) *Reloader {
+	r := &Reloader{opts: *opts, wl: wl, webhook: wh, accounts: accounts}
+	if opts.ConfigPath != "" {
+		cfg, err := config.Read(opts.ConfigPath)
+		if err != nil {
+			logger.Warnf("[CONFIG] Reading %s failed, reloads are disabled: %+v", opts.ConfigPath, err)
+			return r
+		}
+		r.started, r.last = cfg, cfg
+	}
+	return r
+}
+
+// add registers a server for the following reloads.
+func (r *Reloader) add(s reconfigurable) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.servers = append(r.servers, s)
+}
+
+// Reload reads the config file again and applies its reloadable keys. If
+// any of them is invalid nothing is applied.
+func (r *Reloader) Reload() (*config.Change, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.started == nil {
+		return nil, config.ErrNoConfigFile
+	}
+	cfg, err := config.Read(r.opts.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &config.Change{Applied: []string{}, Restart: []string{}}
+	for _, key := range config.Diff(r.started, cfg) {
+		if !reloadable[key] {
+			change.Restart = append(change.Restart, key)
+		}
+	}
+	for _, key := range config.Diff(r.last, cfg) {
+		if reloadable[key] {
+			change.Applied = append(change.Applied, key)
+		}
+	}
+
+	next, err := r.next(cfg, change)
+	if err != nil {
+		return nil, err
+	}
+	wl, err := newWhitelist(next)
+	if err != nil {
+		return nil, fmt.Errorf("whitelist: %w", err)
+	}
+	wh, err := newWebhook(next)
+	if err != nil {
+		return nil, fmt.Errorf("webhook: %w", err)
+	}
+	var accounts *users.Users
+	if r.accounts != nil {
+		if accounts, err = users.Load(next.UsersFile); err != nil {
+			return nil, fmt.Errorf("users file: %w", err)
+		}
+	}
+
+	// Everything is valid, swap it in
+	r.wl.Update(wl)
+	r.webhook.Set(wh)
+	if accounts != nil {
+		r.accounts.Replace(accounts)
+		if err := r.accounts.MakeHomes(next.Webroot); err != nil {
+			logger.Warnf("error creating home directories: %+v", err)
+		}
+	}
+	for _, s := range r.servers {
+		s.Reconfigure(next)
+	}
+	r.opts, r.last = *next, cfg
+
+	switch {
+	case len(change.Applied) > 0:
+		logger.Infof("[CONFIG] Reloaded %s, applied %s", r.opts.ConfigPath, strings.Join(change.Applied, ", "))
+	case accounts != nil:
+		logger.Infof("[CONFIG] Reloaded %s and the users file", r.opts.ConfigPath)
+	default:
+		logger.Infof("[CONFIG] Reloaded %s, nothing changed", r.opts.ConfigPath)
+	}
+	if len(change.Restart) > 0 {
+		logger.Warnf("[CONFIG] Changed in %s but only applied on a restart: %s", r.opts.ConfigPath, strings.Join(change.Restart, ", "))
+	}
+	return change, nil
+}
+
+// next returns the options in effect with the reloadable keys of cfg.
+func (r *Reloader) next(cfg *config.Config, change *config.Change) (*options.Options, error) {
+	fresh := r.opts
+	cfg.Apply(&fresh)
+
+	next := r.opts
+	next.Whitelist = fresh.Whitelist
+	next.TrustedProxies = fresh.TrustedProxies
+	next.WebhookEnabled = fresh.WebhookEnabled
+	next.WebhookURL = fresh.WebhookURL
+	next.WebhookProvider = fresh.WebhookProvider
+	next.WebhookEventsParsed = fresh.WebhookEventsParsed
+	next.WebhookTemplate = fresh.WebhookTemplate
+	next.WebhookHeaders = fresh.WebhookHeaders
+	next.WebhookSecret = fresh.WebhookSecret
+	next.WebhookRetries = fresh.WebhookRetries
+	next.Webhooks = fresh.Webhooks
+	next.ReadOnly = fresh.ReadOnly
+	next.UploadOnly = fresh.UploadOnly
+	next.NoDelete = fresh.NoDelete
+	next.MaxUploadSize = fresh.MaxUploadSize
+	next.Verbose = fresh.Verbose
+
+	if next.UploadOnly && next.ReadOnly {
+		return nil, fmt.Errorf("read_only and upload_only cannot be combined")
+	}
+
+	// Basic auth changes its credentials, switching it on or off takes a
+	// restart as the middlewares are set up on start
+	user, pass, _ := strings.Cut(fresh.BasicAuth, ":")
+	if (user != "" || pass != "") != (next.Username != "" || next.Password != "") {
+		change.Applied = slices.DeleteFunc(change.Applied, isAuthKey)
+		for _, key := range config.Diff(r.started, cfg) {
+			if isAuthKey(key) {
+				change.Restart = append(change.Restart, key)
+			}
+		}
+		return &next, nil
+	}
+	next.BasicAuth, next.Username, next.Password = fresh.BasicAuth, user, pass
+	return &next, nil
+}
+
+func isAuthKey(key string) bool {
+	return key == "auth_username" || key == "auth_password"
+}
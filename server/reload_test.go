@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/config"
+	"goshs.de/goshs/v2/httpserver"
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/webhook"
+)
+
+type fakeServer struct {
+	opts *options.Options
+}
+
+func (f *fakeServer) Reconfigure(opts *options.Options) { f.opts = opts }
+
+func writeConfig(t *testing.T, path string, cfg config.Config) {
+	t.Helper()
+	b, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+}
+
+func newTestReloader(t *testing.T, cfg config.Config) (*Reloader, *fakeServer, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "goshs.json")
+	writeConfig(t, path, cfg)
+	opts, err := config.LoadConfig(&options.Options{ConfigFile: path})
+	require.NoError(t, err)
+	opts.Username, opts.Password = cfg.AuthUsername, cfg.AuthPassword
+
+	wl, err := newWhitelist(opts)
+	require.NoError(t, err)
+	wh, err := newWebhook(opts)
+	require.NoError(t, err)
+	r := newReloader(opts, wl, webhook.NewSwitch(wh), nil)
+	srv := &fakeServer{}
+	r.add(srv)
+	return r, srv, path
+}
+
+func TestReloader_Apply(t *testing.T) {
+	cfg := config.Config{Port: 8000, AuthUsername: "admin", AuthPassword: "old", Whitelist: "192.168.0.0/24"}
+	r, srv, path := newTestReloader(t, cfg)
+	require.False(t, r.wl.IsAllowed("10.0.0.5"))
+
+	cfg.Port = 9000
+	cfg.AuthPassword = "new"
+	cfg.Whitelist = "10.0.0.0/8"
+	cfg.ReadOnly = true
+	cfg.WebhookEnabled, cfg.WebhookProvider, cfg.WebhookURL = true, "slack", "https://example.com/hook"
+	writeConfig(t, path, cfg)
+
+	change, err := r.Reload()
+	require.NoError(t, err)
+	require.Equal(t, []string{"auth_password", "read_only", "webhook_enabled", "webhook_url", "webhook_provider", "whitelist"}, change.Applied)
+	require.Equal(t, []string{"port"}, change.Restart)
+
+	require.True(t, r.wl.IsAllowed("10.0.0.5"))
+	require.True(t, r.webhook.GetEnabled())
+	require.Equal(t, "new", srv.opts.Password)
+	require.True(t, srv.opts.ReadOnly)
+	require.Equal(t, 8000, srv.opts.Port)
+
+	// Applied keys are not reported again, the restart is
+	change, err = r.Reload()
+	require.NoError(t, err)
+	require.Empty(t, change.Applied)
+	require.Equal(t, []string{"port"}, change.Restart)
+}
+
+func TestReloader_Invalid(t *testing.T) {
+	cfg := config.Config{Whitelist: "192.168.0.0/24"}
+	r, srv, path := newTestReloader(t, cfg)
+
+	cfg.Whitelist = "10.0.0.0/99"
+	cfg.ReadOnly = true
+	writeConfig(t, path, cfg)
+	_, err := r.Reload()
+	require.ErrorContains(t, err, "whitelist")
+	require.Nil(t, srv.opts)
+	require.False(t, r.wl.IsAllowed("10.0.0.5"))
+
+	cfg.Whitelist = ""
+	cfg.UploadOnly = true
+	writeConfig(t, path, cfg)
+	_, err = r.Reload()
+	require.Error(t, err)
+	require.Nil(t, srv.opts)
+}
+
+func TestReloader_AuthNeedsRestart(t *testing.T) {
+	cfg := config.Config{}
+	r, srv, path := newTestReloader(t, cfg)
+
+	cfg.AuthUsername, cfg.AuthPassword = "admin", "pw"
+	writeConfig(t, path, cfg)
+	change, err := r.Reload()
+	require.NoError(t, err)
+	require.Empty(t, change.Applied)
+	require.Equal(t, []string{"auth_username", "auth_password"}, change.Restart)
+	require.Empty(t, srv.opts.Username)
+}
+
+func TestReloader_NoConfigFile(t *testing.T) {
+	r := newReloader(&options.Options{}, &httpserver.Whitelist{}, webhook.NewSwitch(&webhook.DiscordWebhook{}), nil)
+	_, err := r.Reload()
+	require.ErrorIs(t, err, config.ErrNoConfigFile)
+}
@@ -2,70 +2,282 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"goshs.de/goshs/v2/acl"
+	"goshs.de/goshs/v2/apitoken"
+	"goshs.de/goshs/v2/ca"
 	"goshs.de/goshs/v2/clipboard"
 	"goshs.de/goshs/v2/dnsserver"
 	"goshs.de/goshs/v2/httpserver"
 	"goshs.de/goshs/v2/ldapserver"
 	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/mailserver"
+	"goshs.de/goshs/v2/mailstore"
 	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/service"
 	"goshs.de/goshs/v2/sftpserver"
 	"goshs.de/goshs/v2/smbserver"
 	"goshs.de/goshs/v2/smtpserver"
+	"goshs.de/goshs/v2/tunnel"
+	"goshs.de/goshs/v2/users"
 	"goshs.de/goshs/v2/utils"
 	"goshs.de/goshs/v2/webhook"
+	"goshs.de/goshs/v2/wpadserver"
 	"goshs.de/goshs/v2/ws"
 )
 
-func StartAll(opts *options.Options) func(context.Context) {
+// StartAll starts the servers of opts. It returns the func shutting them
+// down and the Reloader applying changes of the config file.
+func StartAll(opts *options.Options) (func(context.Context), *Reloader) {
 	// Init clipboard and hub
 	clip := clipboard.New()
 	hub := ws.NewHub(clip, opts.CLI)
 	go hub.Run()
 
 	// Whitelist and Webhook
-	wl, wh := registerWhitelistWebhook(opts)
+	wl, hook := registerWhitelistWebhook(opts)
+	var wh webhook.Webhook = hook
+
+	// Shared background cracker for every service capturing NTLM hashes
+	var cracker *smbserver.Cracker
+	if opts.SMB || opts.LDAP || opts.WPAD || opts.SMTP {
+		cracker = smbserver.NewCracker(opts, hub)
+	}
+
+	// Mail store shared by the SMTP server and the mailbox API
+	var mailbox *mailstore.Store
+	if opts.SMTP || opts.POP3 || opts.IMAP {
+		mb, err := mailstore.Open(opts.SMTPMailDir)
+		if err != nil {
+			logger.Warnf("error opening mail store, mail will not be persisted: %+v", err)
+		} else {
+			mailbox = mb
+		}
+	}
+
+	// Accounts shared by the file serving protocols
+	var accounts *users.Users
+	if opts.UsersFile != "" {
+		u, err := users.Load(opts.UsersFile)
+		if err != nil {
+			logger.Fatalf("error loading users file: %+v", err)
+		}
+		if err := u.MakeHomes(opts.Webroot); err != nil {
+			logger.Warnf("error creating home directories: %+v", err)
+		}
+		accounts = u
+	}
+
+	// A reload of the config file changes the servers registered here
+	reloader := newReloader(opts, wl, hook, accounts)
+
+	// .goshs files are cached once for all file serving protocols
+	aclStore := acl.NewStore()
+
+	// API tokens are shared by HTTP and WebDAV
+	var tokens *apitoken.Store
+	if opts.TokensFile != "" {
+		t, err := apitoken.Load(opts.TokensFile)
+		if err != nil {
+			logger.Fatalf("error loading API tokens: %+v", err)
+		}
+		tokens = t
+	}
+
+	// The protocol servers are registered whether they are enabled or not,
+	// the services API starts and stops them at runtime
+	services := service.NewRegistry()
+
+	// DNS starts first, it answers the DNS-01 challenges of Let's Encrypt
+	dnsSrv := dnsserver.NewDNSServer(opts, hub, &wh)
+	services.Register("dns", &dnsSrv.Port, dnsSrv)
+	if opts.DNS {
+		startService(services, "dns")
+	}
+
+	// Let's Encrypt certificates are in place before the listeners start
+	var acme *ca.LetsEncryptUser
+	if opts.LetsEncrypt {
+		acme = &ca.LetsEncryptUser{
+			Email:        opts.LEEmail,
+			HTTPPort:     opts.LEHTTPPort,
+			TLSPort:      opts.LETLSPort,
+			Domains:      strings.Split(opts.LEDomains, ","),
+			DirectoryURL: opts.LEDirectory,
+			CACert:       opts.LEACMECA,
+			Challenges:   strings.Split(opts.LEChallenges, ","),
+		}
+		if opts.DNS {
+			acme.DNS = dnsSrv
+		}
+		if err := acme.EnsureCertificate(opts.MyCert, opts.MyKey); err != nil {
+			logger.Fatalf("error requesting certificate from lets encrypt: %+v", err)
+		}
+	}
+
+	// The relay is registered with the other protocol servers below, the web
+	// server lists its tunnels
+	relaySrv := tunnel.NewRelay(opts)
 
 	// http
-	httpSrv := httpserver.NewHttpServer(opts, hub, clip, wl, *wh)
+	httpSrv := httpserver.NewHttpServer(opts, hub, clip, wl, wh)
+	httpSrv.Cracker = cracker
+	httpSrv.Mailbox = mailbox
+	httpSrv.Users = accounts
+	httpSrv.ACL = aclStore
+	httpSrv.Tokens = tokens
+	httpSrv.ShareFile = opts.ShareFile
+	if opts.SSL && (opts.SelfSigned || opts.CertAuth == ca.CertPath(opts.CADir)) {
+		// The persistent CA issues client certificates via /?ca-api
+		authority, err := ca.Persisted()
+		if err != nil {
+			logger.Fatalf("error opening the goshs CA: %+v", err)
+		}
+		httpSrv.CA = authority
+	}
+	revocations, certMap := loadClientCertPolicy(opts)
+	httpSrv.Revocations = revocations
+	httpSrv.CertMap = certMap
+	if opts.OIDCIssuer != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		oidcAuth, err := httpserver.NewOIDCAuth(ctx, opts)
+		cancel()
+		if err != nil {
+			logger.Fatalf("error setting up OIDC login: %+v", err)
+		}
+		httpSrv.OIDC = oidcAuth
+	}
+	if opts.TOTPFile != "" {
+		totpAuth, err := httpserver.NewTOTPAuth(opts)
+		if err != nil {
+			logger.Fatalf("error loading TOTP secrets: %+v", err)
+		}
+		httpSrv.TOTP = totpAuth
+	}
+	httpSrv.ReloadConfig = reloader.Reload
+	httpSrv.Services = services
+	httpSrv.Relay = relaySrv
+	reloader.add(httpSrv)
 	go httpSrv.Start("web")
 
+	// Renewals are picked up by the listeners without a restart. While goshs
+	// holds the TLS port it answers the TLS-ALPN-01 challenge itself.
+	if acme != nil {
+		if strconv.Itoa(opts.Port) == opts.LETLSPort {
+			pair, err := ca.SharedKeyPair(opts.MyCert, opts.MyKey)
+			if err != nil {
+				logger.Fatalf("error loading the lets encrypt certificate: %+v", err)
+			}
+			acme.Serving = pair
+		}
+		go acme.KeepRenewed(opts.MyCert, opts.MyKey)
+	}
+
 	// webdav
-	var webdavSrv *httpserver.FileServer
+	webdavSrv := httpserver.NewHttpServer(opts, hub, clip, wl, wh)
+	webdavSrv.WebdavPort = opts.WebDavPort
+	webdavSrv.Users = accounts
+	webdavSrv.ACL = aclStore
+	webdavSrv.Tokens = tokens
+	webdavSrv.Revocations = revocations
+	webdavSrv.CertMap = certMap
+	reloader.add(webdavSrv)
+	services.Register("webdav", &webdavSrv.WebdavPort, webdav{webdavSrv})
 	if opts.WebDav {
-		webdavSrv = httpserver.NewHttpServer(opts, hub, clip, wl, *wh)
-		webdavSrv.WebdavPort = opts.WebDavPort
-		go webdavSrv.Start("webdav")
+		startService(services, "webdav")
 	}
 
-	if opts.SFTP {
-		sftpSrv := sftpserver.NewSFTPServer(opts, wl, *wh)
-		go sftpSrv.Start()
+	// metrics on their own listener, protected like the web server
+	var metricsSrv *httpserver.FileServer
+	if opts.MetricsPort != 0 {
+		metricsSrv = httpserver.NewHttpServer(opts, hub, clip, wl, wh)
+		metricsSrv.Tunnel = false
+		metricsSrv.Users = accounts
+		metricsSrv.Tokens = tokens
+		metricsSrv.Revocations = revocations
+		metricsSrv.CertMap = certMap
+		metricsSrv.OIDC = httpSrv.OIDC
+		reloader.add(metricsSrv)
+		go metricsSrv.Start("metrics")
 	}
 
-	if opts.DNS {
-		dnsSrv := dnsserver.NewDNSServer(opts, hub, wh)
-		go dnsSrv.Start()
+	sftpSrv := sftpserver.NewSFTPServer(opts, wl, wh)
+	sftpSrv.Users = accounts
+	sftpSrv.ACL = aclStore
+	reloader.add(sftpSrv)
+	services.Register("sftp", &sftpSrv.Port, sftpSrv)
+	if opts.SFTP {
+		startService(services, "sftp")
 	}
 
+	smtpServer := smtpserver.NewSMTP(opts, hub, &wh)
+	smtpServer.Cracker = cracker
+	smtpServer.Mailbox = mailbox
+	if opts.SMTPForward != "" {
+		// Validated in sanity checks
+		smtpServer.Forward, _ = mailstore.ParseForward(opts.SMTPForward)
+	}
+	services.Register("smtp", &smtpServer.Port, smtpServer)
 	if opts.SMTP {
-		smtpServer := smtpserver.NewSMTP(opts, hub, wh)
-		go smtpServer.Start()
+		startService(services, "smtp")
 	}
 
+	smbServer := smbserver.NewSMBServer(opts, hub, &wh)
+	smbServer.Cracker = cracker
+	smbServer.Users = accounts
+	smbServer.ACL = aclStore
+	reloader.add(smbServer)
+	services.Register("smb", &smbServer.Port, smbServer)
 	if opts.SMB {
-		smbServer := smbserver.NewSMBServer(opts, hub, wh)
-		go smbServer.Start()
+		startService(services, "smb")
 	}
 
+	ldapSrv := ldapserver.NewLDAPServer(opts, hub, &wh)
+	ldapSrv.Cracker = cracker
+	ldapSrv.PublicURL = httpSrv.PublicURL
+	services.Register("ldap", &ldapSrv.Port, ldapSrv)
 	if opts.LDAP {
-		ldapSrv := ldapserver.NewLDAPServer(opts, hub, wh)
-		go ldapSrv.Start()
+		startService(services, "ldap")
+	}
+
+	wpadSrv := wpadserver.NewWPADServer(opts, hub, &wh)
+	wpadSrv.Cracker = cracker
+	services.Register("wpad", &wpadSrv.Port, wpadSrv)
+	if opts.WPAD {
+		startService(services, "wpad")
+	}
+
+	services.Register("relay", &relaySrv.Port, relaySrv)
+	if opts.Relay {
+		startService(services, "relay")
+	}
+
+	// POP3 and IMAP read the mail store, which is only open with a mail server
+	if mailbox != nil {
+		pop3Srv := mailserver.NewPOP3Server(opts, mailbox)
+		pop3Srv.Users = accounts
+		reloader.add(pop3Srv)
+		services.Register("pop3", &pop3Srv.Port, pop3Srv)
+		if opts.POP3 {
+			startService(services, "pop3")
+		}
+
+		imapSrv := mailserver.NewIMAPServer(opts, mailbox)
+		imapSrv.Users = accounts
+		reloader.add(imapSrv)
+		services.Register("imap", &imapSrv.Port, imapSrv)
+		if opts.IMAP {
+			startService(services, "imap")
+		}
 	}
 
 	// Zeroconf mDNS
 	if opts.MDNS {
-		err := utils.RegisterZeroconfMDNS(opts.SSL, opts.Port, opts.WebDav, opts.WebDavPort, opts.SFTP, opts.SFTPPort, opts.SMTP, opts.SMTPPort, opts.DNS, opts.DNSPort, opts.SMB, opts.SMBPort, opts.LDAP, opts.LDAPPort)
+		err := utils.RegisterZeroconfMDNS(opts.SSL, opts.Port, opts.WebDav, opts.WebDavPort, opts.SFTP, opts.SFTPPort, opts.SMTP, opts.SMTPPort, opts.DNS, opts.DNSPort, opts.SMB, opts.SMBPort, opts.LDAP, opts.LDAPPort, opts.POP3, opts.POP3Port, opts.IMAP, opts.IMAPPort)
 		if err != nil {
 			logger.Warnf("error registering zeroconf mDNS: %+v", err)
 		}
@@ -75,30 +287,114 @@ func StartAll(opts *options.Options) func(context.Context) {
 		if err := httpSrv.Shutdown(ctx); err != nil {
 			logger.Errorf("error shutting down HTTP server: %+v", err)
 		}
-		if webdavSrv != nil {
-			if err := webdavSrv.Shutdown(ctx); err != nil {
-				logger.Errorf("error shutting down WebDAV server: %+v", err)
+		services.Shutdown(ctx)
+		if metricsSrv != nil {
+			if err := metricsSrv.Shutdown(ctx); err != nil {
+				logger.Errorf("error shutting down metrics server: %+v", err)
 			}
 		}
+		if cracker != nil {
+			cracker.Stop()
+		}
+	}, reloader
+}
+
+// startService starts a server enabled by the options, goshs does not run
+// without it.
+func startService(services *service.Registry, name string) {
+	if err := services.Start(name, 0); err != nil {
+		logger.Fatalf("error starting %s server: %+v", name, err)
+	}
+}
+
+// webdav is the WebDAV file server as a service.
+type webdav struct {
+	*httpserver.FileServer
+}
+
+func (w webdav) Listen() error {
+	return w.FileServer.Listen("webdav")
+}
+
+// loadClientCertPolicy reads the revoked client certificates and the
+// mapping of client certificates to users.
+func loadClientCertPolicy(opts *options.Options) (*ca.Revocations, *ca.IdentityMap) {
+	if opts.CertAuth == "" {
+		return nil, nil
+	}
+	issuers, err := ca.ReadCertificates(opts.CertAuth)
+	if err != nil {
+		logger.Fatalf("error reading the ca certificate for cert based client authentication: %+v", err)
+	}
+	var revocations *ca.Revocations
+	if opts.CARevoked != "" || opts.CACRL != "" {
+		if revocations, err = ca.LoadRevocations(opts.CARevoked, opts.CACRL, issuers); err != nil {
+			logger.Fatalf("error loading revoked client certificates: %+v", err)
+		}
 	}
+	var certMap *ca.IdentityMap
+	if opts.CAMap != "" {
+		if certMap, err = ca.LoadIdentityMap(opts.CAMap); err != nil {
+			logger.Fatalf("error loading client certificate mapping: %+v", err)
+		}
+	}
+	return revocations, certMap
 }
 
-func registerWhitelistWebhook(opts *options.Options) (wl *httpserver.Whitelist, wh *webhook.Webhook) {
-	// Parse IP whitelist
-	enabled := false
+func registerWhitelistWebhook(opts *options.Options) (*httpserver.Whitelist, *webhook.Switch) {
 	if opts.Whitelist != "" {
 		logger.Infof("Whitelist activated: %+v", opts.Whitelist)
-		enabled = true
 	}
-
-	// Register Whitelist
-	wl, err := httpserver.NewIPWhitelist(opts.Whitelist, enabled, opts.TrustedProxies)
+	wl, err := newWhitelist(opts)
 	if err != nil {
 		logger.Warnf("Error parsing IP whitelist: %+v", err)
 	}
 
-	// Register webhook
-	webh := webhook.Register(opts.WebhookEnabled, opts.WebhookURL, opts.WebhookProvider, opts.WebhookEventsParsed)
+	wh, err := newWebhook(opts)
+	if err != nil {
+		logger.Fatalf("Error registering webhook: %+v", err)
+	}
+	if len(opts.Webhooks) > 0 {
+		logger.Infof("Webhook destinations from config file: %d", len(opts.Webhooks))
+	}
+
+	// A reload of the config file swaps the webhook behind the servers
+	return wl, webhook.NewSwitch(wh)
+}
 
-	return wl, webh
+// newWhitelist parses the IP whitelist and trusted proxies of opts.
+func newWhitelist(opts *options.Options) (*httpserver.Whitelist, error) {
+	return httpserver.NewIPWhitelist(opts.Whitelist, opts.Whitelist != "", opts.TrustedProxies)
+}
+
+// newWebhook registers the webhook of opts and the further destinations of
+// the config file.
+func newWebhook(opts *options.Options) (webhook.Webhook, error) {
+	onError := func(err error) {
+		logger.Errorf("Webhook notification dropped: %+v", err)
+	}
+	webh, err := webhook.New(opts.WebhookEnabled, opts.WebhookURL, opts.WebhookProvider, opts.WebhookEventsParsed, webhook.Settings{
+		Template: opts.WebhookTemplate,
+		Headers:  webhook.ParseHeaders(opts.WebhookHeaders),
+		Secret:   opts.WebhookSecret,
+		Retries:  opts.WebhookRetries,
+		OnError:  onError,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Webhooks) == 0 {
+		return *webh, nil
+	}
+
+	// Fan out to the destinations of the config file as well
+	multi := webhook.Multi{*webh}
+	for i, d := range opts.Webhooks {
+		dest, err := d.Register(onError)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %d (%s): %w", i+1, d.Provider, err)
+		}
+		multi = append(multi, dest)
+	}
+	return multi, nil
 }
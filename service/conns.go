@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Conns runs the accept loop of a server without one of its own and keeps
+// track of the open connections, so that Shutdown can wait for them.
+type Conns struct {
+	mu    sync.Mutex
+	ln    net.Listener
+	conns map[net.Conn]struct{}
+}
+
+// Serve accepts connections on ln in the background until Shutdown closes
+// it and handles each of them in its own goroutine. The connection is
+// closed after handle.
+func (c *Conns) Serve(ln net.Listener, handle func(net.Conn)) {
+	c.mu.Lock()
+	c.ln = ln
+	c.mu.Unlock()
+	go c.accept(ln, handle)
+}
+
+func (c *Conns) accept(ln net.Listener, handle func(net.Conn)) {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			// Like running out of file descriptors, try again shortly
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		c.mu.Lock()
+		if c.conns == nil {
+			c.conns = map[net.Conn]struct{}{}
+		}
+		c.conns[conn] = struct{}{}
+		c.mu.Unlock()
+
+		go func() {
+			defer c.forget(conn)
+			handle(conn)
+		}()
+	}
+}
+
+func (c *Conns) forget(conn net.Conn) {
+	_ = conn.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.conns, conn)
+}
+
+// Len returns the number of open connections.
+func (c *Conns) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.conns)
+}
+
+// Shutdown closes the listener and waits for the open connections to end.
+// Once ctx is done the remaining ones are closed.
+func (c *Conns) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	ln := c.ln
+	c.ln = nil
+	c.mu.Unlock()
+	if ln != nil {
+		if err := ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for c.Len() > 0 {
+		select {
+		case <-ctx.Done():
+			c.mu.Lock()
+			for conn := range c.conns {
+				_ = conn.Close()
+			}
+			c.mu.Unlock()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// Package service keeps track of the protocol servers of goshs, so that they
+// can be started, stopped and moved to another port while goshs runs.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"goshs.de/goshs/v2/logger"
+)
+
+var (
+	ErrUnknown        = errors.New("unknown service")
+	ErrRunning        = errors.New("service is already running")
+	ErrNotRunning     = errors.New("service is not running")
+	ErrPortOutOfRange = errors.New("port out of range")
+)
+
+// Server is a protocol server the registry controls. Listen binds the
+// listener and serves it in the background, it returns once the server
+// accepts connections. Shutdown stops accepting connections and waits for
+// the open ones until ctx is done. A server that was shut down listens
+// again on the next Listen.
+type Server interface {
+	Listen() error
+	Shutdown(ctx context.Context) error
+}
+
+// Status describes a service for the admin API.
+type Status struct {
+	Name    string    `json:"name"`
+	Running bool      `json:"running"`
+	Port    int       `json:"port"`
+	Since   time.Time `json:"since,omitzero"`
+	Error   string    `json:"error,omitempty"`
+}
+
+type service struct {
+	mu      sync.Mutex
+	name    string
+	port    *int // the port field of the server, only changed while stopped
+	srv     Server
+	running bool
+	since   time.Time
+	err     error // of the last start or stop
+}
+
+// Registry holds the services in the order they were registered.
+type Registry struct {
+	mu       sync.RWMutex
+	services []*service
+	watchers []func(Status)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds srv as name. port points to the port the server listens
+// on, a start on another port sets it.
+func (r *Registry) Register(name string, port *int, srv Server) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.services = append(r.services, &service{name: name, port: port, srv: srv})
+}
+
+// Watch calls fn with the new state of a service after each Start, Stop and
+// Restart.
+func (r *Registry) Watch(fn func(Status)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.watchers = append(r.watchers, fn)
+}
+
+// notify runs the watchers, the caller must not hold the lock of s.
+func (r *Registry) notify(s *service) {
+	r.mu.RLock()
+	watchers := r.watchers
+	r.mu.RUnlock()
+	st := s.status()
+	for _, fn := range watchers {
+		fn(st)
+	}
+}
+
+func (r *Registry) lookup(name string) (*service, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, s := range r.services {
+		if s.name == name {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknown, name)
+}
+
+// Start starts the service name on port, 0 keeps its port.
+func (r *Registry) Start(name string, port int) error {
+	s, err := r.lookup(name)
+	if err != nil {
+		return err
+	}
+	defer r.notify(s)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return ErrRunning
+	}
+	return s.start(port)
+}
+
+// Stop shuts the service name down.
+func (r *Registry) Stop(ctx context.Context, name string) error {
+	s, err := r.lookup(name)
+	if err != nil {
+		return err
+	}
+	defer r.notify(s)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return ErrNotRunning
+	}
+	return s.stop(ctx)
+}
+
+// Restart shuts the service name down if it is running and starts it again
+// on port, 0 keeps its port.
+func (r *Registry) Restart(ctx context.Context, name string, port int) error {
+	s, err := r.lookup(name)
+	if err != nil {
+		return err
+	}
+	defer r.notify(s)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		if err := s.stop(ctx); err != nil {
+			return err
+		}
+	}
+	return s.start(port)
+}
+
+// Status returns the state of every service.
+func (r *Registry) Status() []Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Status, len(r.services))
+	for i, s := range r.services {
+		list[i] = s.status()
+	}
+	return list
+}
+
+// Shutdown stops the running services at once and waits for them until ctx
+// is done.
+func (r *Registry) Shutdown(ctx context.Context) {
+	r.mu.RLock()
+	services := r.services
+	r.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, s := range services {
+		wg.Go(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if !s.running {
+				return
+			}
+			if err := s.stop(ctx); err != nil {
+				logger.Errorf("error shutting down %s server: %+v", s.name, err)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func (s *service) start(port int) error {
+	if port < 0 || port > 65535 {
+		return fmt.Errorf("%w: %d", ErrPortOutOfRange, port)
+	}
+	previous := *s.port
+	if port != 0 {
+		*s.port = port
+	}
+	if err := s.srv.Listen(); err != nil {
+		*s.port = previous
+		s.err = err
+		return err
+	}
+	s.running, s.since, s.err = true, time.Now(), nil
+	logger.Infof("[SERVICE] %s started on port %d", s.name, *s.port)
+	return nil
+}
+
+func (s *service) stop(ctx context.Context) error {
+	err := s.srv.Shutdown(ctx)
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		// The connections still open were closed, the server is down
+		logger.Warnf("[SERVICE] %s closed the open connections: %v", s.name, err)
+		err = nil
+	}
+	s.running, s.since, s.err = false, time.Time{}, err
+	logger.Infof("[SERVICE] %s stopped", s.name)
+	return err
+}
+
+func (s *service) status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := Status{Name: s.name, Running: s.running, Port: *s.port, Since: s.since}
+	if s.err != nil {
+		st.Error = s.err.Error()
+	}
+	return st
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer records the port it listens on.
+type fakeServer struct {
+	port      *int
+	listening []int
+	fail      error
+}
+
+func (f *fakeServer) Listen() error {
+	if f.fail != nil {
+		return f.fail
+	}
+	f.listening = append(f.listening, *f.port)
+	return nil
+}
+
+func (f *fakeServer) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	port := 8053
+	srv := &fakeServer{port: &port}
+	r := NewRegistry()
+	r.Register("dns", &port, srv)
+
+	require.NoError(t, r.Start("dns", 0))
+	require.ErrorIs(t, r.Start("dns", 0), ErrRunning)
+	status := r.Status()
+	require.Len(t, status, 1)
+	require.True(t, status[0].Running)
+	require.Equal(t, 8053, status[0].Port)
+	require.False(t, status[0].Since.IsZero())
+
+	// Restart moves it to another port
+	require.NoError(t, r.Restart(context.Background(), "dns", 5353))
+	require.Equal(t, []int{8053, 5353}, srv.listening)
+	require.Equal(t, 5353, r.Status()[0].Port)
+
+	require.NoError(t, r.Stop(context.Background(), "dns"))
+	require.ErrorIs(t, r.Stop(context.Background(), "dns"), ErrNotRunning)
+	require.False(t, r.Status()[0].Running)
+
+	require.ErrorIs(t, r.Start("smb", 0), ErrUnknown)
+	require.ErrorIs(t, r.Start("dns", 70000), ErrPortOutOfRange)
+
+	// A failed start keeps the port and reports the error
+	srv.fail = errors.New("address already in use")
+	require.Error(t, r.Start("dns", 53))
+	status = r.Status()
+	require.False(t, status[0].Running)
+	require.Equal(t, 5353, status[0].Port)
+	require.Equal(t, "address already in use", status[0].Error)
+}
+
+func TestRegistry_Watch(t *testing.T) {
+	port := 389
+	r := NewRegistry()
+	r.Register("ldap", &port, &fakeServer{port: &port})
+
+	var seen []Status
+	r.Watch(func(st Status) {
+		// The watcher may query the registry
+		require.Len(t, r.Status(), 1)
+		seen = append(seen, st)
+	})
+	require.NoError(t, r.Start("ldap", 0))
+	require.NoError(t, r.Restart(context.Background(), "ldap", 1389))
+	require.NoError(t, r.Stop(context.Background(), "ldap"))
+
+	require.Len(t, seen, 3)
+	require.True(t, seen[0].Running)
+	require.Equal(t, 389, seen[0].Port)
+	require.True(t, seen[1].Running)
+	require.Equal(t, 1389, seen[1].Port)
+	require.False(t, seen[2].Running)
+}
+
+func TestRegistry_Shutdown(t *testing.T) {
+	r := NewRegistry()
+	ports := []int{1, 2, 3}
+	for i, name := range []string{"smb", "ldap", "sftp"} {
+		r.Register(name, &ports[i], &fakeServer{port: &ports[i]})
+	}
+	require.NoError(t, r.Start("smb", 0))
+	require.NoError(t, r.Start("sftp", 0))
+
+	r.Shutdown(context.Background())
+	for _, s := range r.Status() {
+		require.False(t, s.Running, s.Name)
+	}
+}
+
+func TestConns(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var c Conns
+	c.Serve(ln, func(conn net.Conn) {
+		// Echo until the client or Shutdown closes the connection
+		buf := make([]byte, 16)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write(buf[:n])
+		}
+	})
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = conn.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, 1, c.Len())
+
+	// The open connection is closed once ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, c.Shutdown(ctx), context.DeadlineExceeded)
+	_, err = net.Dial("tcp", ln.Addr().String())
+	require.Error(t, err)
+	require.Eventually(t, func() bool { return c.Len() == 0 }, time.Second, 10*time.Millisecond)
+
+	// Without open connections Shutdown returns at once
+	ln, err = net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	c.Serve(ln, func(net.Conn) {})
+	require.NoError(t, c.Shutdown(context.Background()))
+}
@@ -0,0 +1,65 @@
+package sftpserver
+
+import (
+	"os"
+
+	"github.com/pkg/sftp"
+	"goshs.de/goshs/v2/acl"
+	"goshs.de/goshs/v2/logger"
+)
+
+// passwordKey stores the password of a connection in its ssh.Context so the
+// users of .goshs files can be checked.
+type passwordKey struct{}
+
+// aclMethod maps file commands and listings onto the method they are checked
+// as. Stat and friends return "" and are only subject to the block list.
+func aclMethod(r *sftp.Request) acl.Method {
+	switch r.Method {
+	case "List":
+		return acl.List
+	case "Remove", "Rmdir", "Rename":
+		return acl.Delete
+	case "Mkdir":
+		return acl.Mkdir
+	case "Setstat":
+		return acl.Upload
+	}
+	return ""
+}
+
+// checkACL evaluates the .goshs files below root for the request r of the
+// session described by id. A rename also needs upload access at the target.
+func (s *SFTPServer) checkACL(root, ip string, id acl.Request, r *sftp.Request, method acl.Method) error {
+	fullPath, err := sanitizePath(r.Filepath, root)
+	if err != nil {
+		// Rejected by the operation itself
+		return nil
+	}
+	info, statErr := os.Stat(fullPath)
+	isDir := statErr == nil && info.IsDir()
+
+	id.Method, id.Path, id.IsDir = method, fullPath, isDir || method == acl.Mkdir
+	d := s.ACL.Check(root, id)
+	if d == acl.Allowed && r.Method == "Rename" {
+		if target, err := sanitizePath(r.Target, root); err == nil {
+			id.Method, id.Path = acl.Upload, target
+			if isDir {
+				id.Method = acl.Mkdir
+			}
+			d = s.ACL.Check(root, id)
+		}
+	}
+
+	switch {
+	case d == acl.Hidden:
+		err = os.ErrNotExist
+	case method == "", d == acl.Allowed:
+		return nil
+	default:
+		err = os.ErrPermission
+	}
+	logger.LogSFTPRequestBlocked(r, ip, err)
+	s.HandleWebhookSend("sftp", r, ip, true)
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 
+	"goshs.de/goshs/v2/acl"
 	"goshs.de/goshs/v2/logger"
 	"github.com/pkg/sftp"
 )
@@ -12,19 +13,23 @@ import (
 type ReadOnlyHandler struct {
 	Root       string
 	ClientIP   string
+	Identity   acl.Request // session template for the .goshs checks
 	SFTPServer *SFTPServer
 }
 
 func (h *ReadOnlyHandler) GetHandler() sftp.Handlers {
 	return sftp.Handlers{
-		FileGet:  &ReadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, SFTPServer: h.SFTPServer},
-		FilePut:  &ReadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, SFTPServer: h.SFTPServer},
-		FileCmd:  &ReadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, SFTPServer: h.SFTPServer},
-		FileList: &ReadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, SFTPServer: h.SFTPServer},
+		FileGet:  &ReadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, Identity: h.Identity, SFTPServer: h.SFTPServer},
+		FilePut:  &ReadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, Identity: h.Identity, SFTPServer: h.SFTPServer},
+		FileCmd:  &ReadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, Identity: h.Identity, SFTPServer: h.SFTPServer},
+		FileList: &ReadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, Identity: h.Identity, SFTPServer: h.SFTPServer},
 	}
 }
 
 func (h *ReadOnlyHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	if err := h.SFTPServer.checkACL(h.Root, h.ClientIP, h.Identity, r, acl.Read); err != nil {
+		return nil, err
+	}
 	return readFile(h.Root, r, h.ClientIP, h.SFTPServer)
 }
 
@@ -35,6 +40,9 @@ func (h *ReadOnlyHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
 }
 
 func (h *ReadOnlyHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	if err := h.SFTPServer.checkACL(h.Root, h.ClientIP, h.Identity, r, aclMethod(r)); err != nil {
+		return nil, err
+	}
 	return listFile(h.Root, r, h.ClientIP, h.SFTPServer)
 }
 
@@ -48,15 +56,16 @@ func (h *ReadOnlyHandler) Filecmd(r *sftp.Request) error {
 type UploadOnlyHandler struct {
 	Root       string
 	ClientIP   string
+	Identity   acl.Request // session template for the .goshs checks
 	SFTPServer *SFTPServer
 }
 
 func (h *UploadOnlyHandler) GetHandler() sftp.Handlers {
 	return sftp.Handlers{
-		FileGet:  &UploadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, SFTPServer: h.SFTPServer},
-		FilePut:  &UploadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, SFTPServer: h.SFTPServer},
-		FileCmd:  &UploadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, SFTPServer: h.SFTPServer},
-		FileList: &UploadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, SFTPServer: h.SFTPServer},
+		FileGet:  &UploadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, Identity: h.Identity, SFTPServer: h.SFTPServer},
+		FilePut:  &UploadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, Identity: h.Identity, SFTPServer: h.SFTPServer},
+		FileCmd:  &UploadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, Identity: h.Identity, SFTPServer: h.SFTPServer},
+		FileList: &UploadOnlyHandler{Root: h.Root, ClientIP: h.ClientIP, Identity: h.Identity, SFTPServer: h.SFTPServer},
 	}
 }
 
@@ -67,10 +76,16 @@ func (h *UploadOnlyHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
 }
 
 func (h *UploadOnlyHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	if err := h.SFTPServer.checkACL(h.Root, h.ClientIP, h.Identity, r, acl.Upload); err != nil {
+		return nil, err
+	}
 	return writeFile(h.Root, r, h.ClientIP, h.SFTPServer)
 }
 
 func (h *UploadOnlyHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	if err := h.SFTPServer.checkACL(h.Root, h.ClientIP, h.Identity, r, aclMethod(r)); err != nil {
+		return nil, err
+	}
 	return listFile(h.Root, r, h.ClientIP, h.SFTPServer)
 }
 
@@ -84,30 +99,43 @@ func (h *UploadOnlyHandler) Filecmd(r *sftp.Request) error {
 type DefaultHandler struct {
 	Root       string
 	ClientIP   string
+	Identity   acl.Request // session template for the .goshs checks
 	SFTPServer *SFTPServer
 }
 
 func (h *DefaultHandler) GetHandler() sftp.Handlers {
 	return sftp.Handlers{
-		FileGet:  &DefaultHandler{Root: h.Root, ClientIP: h.ClientIP, SFTPServer: h.SFTPServer},
-		FilePut:  &DefaultHandler{Root: h.Root, ClientIP: h.ClientIP, SFTPServer: h.SFTPServer},
-		FileCmd:  &DefaultHandler{Root: h.Root, ClientIP: h.ClientIP, SFTPServer: h.SFTPServer},
-		FileList: &DefaultHandler{Root: h.Root, ClientIP: h.ClientIP, SFTPServer: h.SFTPServer},
+		FileGet:  &DefaultHandler{Root: h.Root, ClientIP: h.ClientIP, Identity: h.Identity, SFTPServer: h.SFTPServer},
+		FilePut:  &DefaultHandler{Root: h.Root, ClientIP: h.ClientIP, Identity: h.Identity, SFTPServer: h.SFTPServer},
+		FileCmd:  &DefaultHandler{Root: h.Root, ClientIP: h.ClientIP, Identity: h.Identity, SFTPServer: h.SFTPServer},
+		FileList: &DefaultHandler{Root: h.Root, ClientIP: h.ClientIP, Identity: h.Identity, SFTPServer: h.SFTPServer},
 	}
 }
 
 func (h *DefaultHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	if err := h.SFTPServer.checkACL(h.Root, h.ClientIP, h.Identity, r, acl.Read); err != nil {
+		return nil, err
+	}
 	return readFile(h.Root, r, h.ClientIP, h.SFTPServer)
 }
 
 func (h *DefaultHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	if err := h.SFTPServer.checkACL(h.Root, h.ClientIP, h.Identity, r, acl.Upload); err != nil {
+		return nil, err
+	}
 	return writeFile(h.Root, r, h.ClientIP, h.SFTPServer)
 }
 
 func (h *DefaultHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	if err := h.SFTPServer.checkACL(h.Root, h.ClientIP, h.Identity, r, aclMethod(r)); err != nil {
+		return nil, err
+	}
 	return listFile(h.Root, r, h.ClientIP, h.SFTPServer)
 }
 
 func (h *DefaultHandler) Filecmd(r *sftp.Request) error {
+	if err := h.SFTPServer.checkACL(h.Root, h.ClientIP, h.Identity, r, aclMethod(r)); err != nil {
+		return err
+	}
 	return cmdFile(h.Root, r, h.ClientIP, h.SFTPServer)
 }
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"goshs.de/goshs/v2/acl"
 	"goshs.de/goshs/v2/httpserver"
 	"goshs.de/goshs/v2/options"
 	"goshs.de/goshs/v2/webhook"
@@ -217,6 +218,36 @@ func TestDefaultHandler_Filecmd(t *testing.T) {
 	require.NoError(t, h.Filecmd(r))
 }
 
+// ─── .goshs ACL ───────────────────────────────────────────────────────────────
+
+func TestDefaultHandler_ACL(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "id.key"), []byte("key"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, acl.FileName), []byte(`{"block":["*.key"],"rules":[{"deny":["delete","upload"],"users":["bob"]}]}`), 0644))
+	srv := testSFTPServer(dir)
+	srv.ACL = acl.NewStore()
+	h := &DefaultHandler{Root: dir, ClientIP: "1.2.3.4", Identity: acl.Request{User: "bob"}, SFTPServer: srv}
+
+	_, err := h.Fileread(&sftp.Request{Method: "Get", Filepath: "/id.key"})
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = h.Filewrite(&sftp.Request{Method: "Put", Filepath: "/new.txt"})
+	require.ErrorIs(t, err, os.ErrPermission)
+	require.ErrorIs(t, h.Filecmd(&sftp.Request{Method: "Remove", Filepath: "/a.txt"}), os.ErrPermission)
+	require.FileExists(t, filepath.Join(dir, "a.txt"))
+
+	lister, err := h.Filelist(&sftp.Request{Method: "List", Filepath: "/"})
+	require.NoError(t, err)
+	infos := make([]fs.FileInfo, 10)
+	n, _ := lister.ListAt(infos, 0)
+	require.Equal(t, 1, n)
+	require.Equal(t, "a.txt", infos[0].Name())
+
+	// Other users are not affected by the rule
+	h.Identity.User = "alice"
+	require.NoError(t, h.Filecmd(&sftp.Request{Method: "Remove", Filepath: "/a.txt"}))
+}
+
 // ─── ListAt ───────────────────────────────────────────────────────────────────
 
 func TestListAt_Basic(t *testing.T) {
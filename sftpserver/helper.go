@@ -11,10 +11,14 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"goshs.de/goshs/v2/httpserver"
 	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/metrics"
 	"github.com/pkg/sftp"
 	gossh "golang.org/x/crypto/ssh"
 )
@@ -130,13 +134,15 @@ func listFile(root string, r *sftp.Request, ip string, sftpServer *SFTPServer) (
 			sftpServer.HandleWebhookSend("sftp", r, ip, true)
 			return nil, err
 		}
+		visible := sftpServer.ACL.Visible(root, fullPath)
+		infos = slices.DeleteFunc(infos, func(i fs.FileInfo) bool { return !visible(i.Name(), i.IsDir()) })
 
 		return &simpleListerAt{files: infos}, nil
 	}
 }
 
 // writeFile opens a file for writing
-func writeFile(root string, r *sftp.Request, ip string, sftpServer *SFTPServer) (*os.File, error) {
+func writeFile(root string, r *sftp.Request, ip string, sftpServer *SFTPServer) (*uploadFile, error) {
 	if runtime.GOOS == "windows" {
 		r.Filepath = rewritePathWindows(r.Filepath)
 	}
@@ -148,7 +154,32 @@ func writeFile(root string, r *sftp.Request, ip string, sftpServer *SFTPServer)
 	}
 	logger.LogSFTPRequest(r, ip)
 	sftpServer.HandleWebhookSend("sftp", r, ip, false)
-	return os.Create(fullPath)
+	f, err := os.Create(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	return &uploadFile{File: f}, nil
+}
+
+// uploadFile counts the bytes written to an uploaded file for the metrics.
+type uploadFile struct {
+	*os.File
+	written atomic.Int64
+	once    sync.Once
+}
+
+func (f *uploadFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(p, off)
+	f.written.Add(int64(n))
+	return n, err
+}
+
+func (f *uploadFile) Close() error {
+	f.once.Do(func() {
+		metrics.Uploads.Inc("sftp")
+		metrics.UploadBytes.Add(float64(f.written.Load()), "sftp")
+	})
+	return f.File.Close()
 }
 
 // cmdFile executes file commands like Stat, Lstat, Setstat, Rename, Rmdir, Mkdir, and Remove
@@ -274,25 +305,11 @@ func rewritePathWindows(path string) string {
 }
 
 func isAllowedIP(addr net.Addr, wl *httpserver.Whitelist) bool {
-	// If Whitelist disabled just serve
-	if !wl.Enabled {
-		return true
-	}
-
 	host, _, err := net.SplitHostPort(addr.String())
 	if err != nil {
 		host = addr.String()
 	}
 
-	ip := net.ParseIP(host)
-	if ip == nil {
-		return false
-	}
-	for _, net := range wl.Networks {
-		if net.Contains(ip) {
-			return true
-		}
-	}
-
-	return false
+	// A disabled whitelist allows every address
+	return wl.IsAllowed(host)
 }
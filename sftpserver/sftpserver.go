@@ -1,19 +1,25 @@
 package sftpserver
 
 import (
+	"context"
 	"crypto/subtle"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"strconv"
+	"sync"
 
 	"github.com/gliderlabs/ssh"
 	"github.com/pkg/sftp"
 	gossh "golang.org/x/crypto/ssh"
+	"goshs.de/goshs/v2/acl"
 	"goshs.de/goshs/v2/httpserver"
 	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/metrics"
 	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/users"
 	"goshs.de/goshs/v2/webhook"
 )
 
@@ -30,8 +36,15 @@ type SFTPServer struct {
 	HostKeyFile string
 	Webhook     webhook.Webhook
 	Whitelist   *httpserver.Whitelist
+	Users       *users.Users
+	ACL         *acl.Store
+	mu          sync.RWMutex // guards the options changed by Reconfigure
+	server      *ssh.Server  // of the last Listen
 }
 
+// accountKey stores the users file account of a connection in its ssh.Context.
+type accountKey struct{}
+
 func NewSFTPServer(opts *options.Options, wl *httpserver.Whitelist, webhook webhook.Webhook) *SFTPServer {
 	return &SFTPServer{
 		IP:          opts.IP,
@@ -48,12 +61,13 @@ func NewSFTPServer(opts *options.Options, wl *httpserver.Whitelist, webhook webh
 	}
 }
 
-// Start initializes and starts the SFTP server
-func (s *SFTPServer) Start() error {
+// Listen initializes the SFTP server, binds its listener and serves it in
+// the background
+func (s *SFTPServer) Listen() error {
 	var err error
 
 	// Define a simple password auth handler
-	sshServer := ssh.Server{
+	sshServer := &ssh.Server{
 		Addr: net.JoinHostPort(s.IP, strconv.Itoa(s.Port)),
 		Handler: func(s ssh.Session) {
 			// Deny default ssh connections
@@ -80,11 +94,29 @@ func (s *SFTPServer) Start() error {
 		}
 
 		sshServer.HostSigners = []ssh.Signer{private}
+	} else if s.server != nil {
+		// Keep the generated host key when listening again
+		sshServer.HostSigners = s.server.HostSigners
 	}
 
-	if s.Username != "" && s.Password != "" {
+	if s.Users != nil {
 		sshServer.PasswordHandler = func(ctx ssh.Context, password string) bool {
-			return subtle.ConstantTimeCompare([]byte(ctx.User()), []byte(s.Username)) == 1 && subtle.ConstantTimeCompare([]byte(password), []byte(s.Password)) == 1
+			acct := s.Users.Authenticate(ctx.User(), password)
+			if acct == nil {
+				return false
+			}
+			ctx.SetValue(accountKey{}, acct)
+			ctx.SetValue(passwordKey{}, password)
+			return true
+		}
+	} else if s.Username != "" && s.Password != "" {
+		sshServer.PasswordHandler = func(ctx ssh.Context, password string) bool {
+			username, pass := s.credentials()
+			if subtle.ConstantTimeCompare([]byte(ctx.User()), []byte(username)) != 1 || subtle.ConstantTimeCompare([]byte(password), []byte(pass)) != 1 {
+				return false
+			}
+			ctx.SetValue(passwordKey{}, password)
+			return true
 		}
 	}
 
@@ -95,7 +127,18 @@ func (s *SFTPServer) Start() error {
 			return err
 		}
 		sshServer.PublicKeyHandler = func(ctx ssh.Context, key ssh.PublicKey) bool {
-			return authorizedKeysMap[string(key.Marshal())]
+			if !authorizedKeysMap[string(key.Marshal())] {
+				return false
+			}
+			// With a users file the key only grants access to an existing account
+			if s.Users != nil {
+				acct := s.Users.Lookup(ctx.User())
+				if acct == nil {
+					return false
+				}
+				ctx.SetValue(accountKey{}, acct)
+			}
+			return true
 		}
 	}
 
@@ -105,28 +148,50 @@ func (s *SFTPServer) Start() error {
 			// Whitelist
 			if isAllowedIP(sess.RemoteAddr(), s.Whitelist) {
 				var server *sftp.RequestServer
+				// Accounts from the users file are confined to their home
+				// and restricted by their role on top of the global options
+				acct, _ := sess.Context().Value(accountKey{}).(*users.Account)
+				if acct == nil {
+					if s.Users != nil {
+						logger.Access{Protocol: "sftp", Client: sess.RemoteAddr().String(), User: sess.User(), Event: "denied", Status: 403}.Warnf("SFTP: %s has no account in the users file", sess.User())
+						return
+					}
+					acct = users.Unrestricted
+				}
+				root := acct.Root(s.Root)
+				identity := s.identity(sess)
+				defer logger.NameSession(sess.RemoteAddr().String(), identity.User)()
+				metrics.SessionsTotal.Inc("sftp")
+				metrics.Sessions.Inc("sftp")
+				defer metrics.Sessions.Dec("sftp")
 				// Set handler read only or upload only or default
-				if s.ReadOnly {
+				s.mu.RLock()
+				readOnly, uploadOnly := s.ReadOnly, s.UploadOnly
+				s.mu.RUnlock()
+				if readOnly || !acct.CanWrite() {
 					roHandler := &ReadOnlyHandler{
-						Root:       s.Root,
+						Root:       root,
 						ClientIP:   sess.RemoteAddr().String(),
+						Identity:   identity,
 						SFTPServer: s,
 					}
-					server = sftp.NewRequestServer(sess, roHandler.GetHandler(), sftp.WithStartDirectory(s.Root))
-				} else if s.UploadOnly {
+					server = sftp.NewRequestServer(sess, roHandler.GetHandler(), sftp.WithStartDirectory(root))
+				} else if uploadOnly || !acct.CanRead() {
 					uoHandler := &UploadOnlyHandler{
-						Root:       s.Root,
+						Root:       root,
 						ClientIP:   sess.RemoteAddr().String(),
+						Identity:   identity,
 						SFTPServer: s,
 					}
-					server = sftp.NewRequestServer(sess, uoHandler.GetHandler(), sftp.WithStartDirectory(s.Root))
+					server = sftp.NewRequestServer(sess, uoHandler.GetHandler(), sftp.WithStartDirectory(root))
 				} else {
 					dh := &DefaultHandler{
-						Root:       s.Root,
+						Root:       root,
 						ClientIP:   sess.RemoteAddr().String(),
+						Identity:   identity,
 						SFTPServer: s,
 					}
-					server = sftp.NewRequestServer(sess, dh.GetHandler(), sftp.WithStartDirectory(s.Root))
+					server = sftp.NewRequestServer(sess, dh.GetHandler(), sftp.WithStartDirectory(root))
 				}
 
 				if err := server.Serve(); err == io.EOF {
@@ -135,17 +200,72 @@ func (s *SFTPServer) Start() error {
 					logger.Errorf("SFTP server error: %+v", err)
 				}
 			} else {
-				logger.Warnf("[WHITELIST] SFTP access denied for IP: %v", sess.RemoteAddr())
+				logger.Access{Protocol: "sftp", Client: sess.RemoteAddr().String(), User: sess.User(), Event: "denied", Status: 403}.Warnf("[WHITELIST] SFTP access denied for IP: %v", sess.RemoteAddr())
 			}
 		},
 	}
 
+	ln, err := net.Listen("tcp", sshServer.Addr)
+	if err != nil {
+		return err
+	}
+	s.server = sshServer
+
 	logger.Infof("Starting SFTP server on port %s:%d", s.IP, s.Port)
-	logger.Fatal(sshServer.ListenAndServe())
+	go func() {
+		if err := sshServer.Serve(ln); !errors.Is(err, ssh.ErrServerClosed) {
+			logger.Errorf("SFTP server stopped: %+v", err)
+		}
+	}()
 
 	return nil
 }
 
+// Shutdown closes the listener and waits for the open sessions until ctx is
+// done, the remaining ones are closed then.
+func (s *SFTPServer) Shutdown(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		_ = s.server.Close()
+	}
+	return err
+}
+
+// Reconfigure applies the options a config reload changes to the running
+// server: the password login, read-only and upload-only. Open sessions keep
+// their mode.
+func (s *SFTPServer) Reconfigure(opts *options.Options) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Username = opts.Username
+	s.Password = opts.Password
+	s.ReadOnly = opts.ReadOnly
+	s.UploadOnly = opts.UploadOnly
+}
+
+func (s *SFTPServer) credentials() (string, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Username, s.Password
+}
+
+// identity describes the session for the .goshs checks. Without any
+// configured login the session is anonymous.
+func (s *SFTPServer) identity(sess ssh.Session) acl.Request {
+	id := acl.Request{Username: sess.User()}
+	id.Password, _ = sess.Context().Value(passwordKey{}).(string)
+	if host, _, err := net.SplitHostPort(sess.RemoteAddr().String()); err == nil {
+		id.IP = net.ParseIP(host)
+	}
+	if username, _ := s.credentials(); s.Users != nil || username != "" || s.KeyFile != "" {
+		id.User = sess.User()
+	}
+	return id
+}
+
 func (s *SFTPServer) HandleWebhookSend(event string, r *sftp.Request, ip string, blocked bool) {
 	var message string
 	if blocked {
@@ -164,5 +284,15 @@ func (s *SFTPServer) HandleWebhookSend(event string, r *sftp.Request, ip string,
 		}
 	}
 
-	logger.HandleWebhookSend(message, "sftp", s.Webhook)
+	e := webhook.NewEvent("sftp", message)
+	e.Remote = ip
+	e.Path = r.Filepath
+	e.Fields = map[string]string{"method": r.Method}
+	if r.Target != "" {
+		e.Fields["target"] = r.Target
+	}
+	if blocked {
+		e.Fields["blocked"] = "true"
+	}
+	logger.HandleWebhookEvent(e, s.Webhook)
 }
@@ -2,6 +2,7 @@ package sftpserver
 
 import (
 	"context"
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
@@ -27,20 +28,19 @@ var sftpserver *SFTPServer = &SFTPServer{
 	},
 }
 
-func TestStart(t *testing.T) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func TestListen(t *testing.T) {
+	// A stopped server listens again
+	for range 2 {
+		require.NoError(t, sftpserver.Listen())
 
-	done := make(chan struct{})
-
-	go func() {
-		err := sftpserver.Start()
+		conn, err := net.Dial("tcp", "127.0.0.1:2022")
 		require.NoError(t, err)
-	}()
-	// Wait for context timeout or server error
-	<-ctx.Done()
-	// Timeout reached, stop the server gracefully
-	close(done)
+		conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		require.NoError(t, sftpserver.Shutdown(ctx))
+		cancel()
+	}
 }
 
 func TestErrors(t *testing.T) {
@@ -58,7 +58,7 @@ func TestErrors(t *testing.T) {
 			Enabled: false,
 		},
 	}
-	err := server.Start()
+	err := server.Listen()
 	require.Error(t, err)
 
 	server = &SFTPServer{
@@ -75,7 +75,7 @@ func TestErrors(t *testing.T) {
 			Enabled: false,
 		},
 	}
-	err = server.Start()
+	err = server.Listen()
 	require.Error(t, err)
 }
 
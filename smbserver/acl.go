@@ -0,0 +1,44 @@
+package smbserver
+
+import (
+	"net"
+
+	"goshs.de/goshs/v2/acl"
+	"goshs.de/goshs/v2/logger"
+)
+
+// aclRequest describes an operation of the session of h for the .goshs
+// checks. NTLM does not reveal the password, so .goshs users cannot log in
+// over SMB and protected directories stay closed.
+func (s *SMBServer) aclRequest(cs *connState, h *smb2Hdr, method acl.Method, p string, isDir bool) acl.Request {
+	r := acl.Request{Method: method, Path: p, IsDir: isDir}
+	if cs.conn != nil {
+		if host, _, err := net.SplitHostPort(cs.conn.RemoteAddr().String()); err == nil {
+			r.IP = net.ParseIP(host)
+		}
+	}
+	if sess := s.getSession(h.SessionID); sess != nil && s.authRequired() {
+		sess.mu.RLock()
+		if sess.Authed {
+			r.User = sess.Username
+		}
+		sess.mu.RUnlock()
+	}
+	return r
+}
+
+// checkACL evaluates the .goshs files below root and returns the status to
+// answer with, or STATUS_SUCCESS. An empty method only applies the block list.
+func (s *SMBServer) checkACL(cs *connState, h *smb2Hdr, root string, method acl.Method, p string, isDir bool) uint32 {
+	switch s.ACL.Check(root, s.aclRequest(cs, h, method, p, isDir)) {
+	case acl.Allowed:
+		return STATUS_SUCCESS
+	case acl.Hidden:
+		return STATUS_OBJECT_NAME_NOT_FOUND
+	}
+	if method == "" {
+		return STATUS_SUCCESS
+	}
+	logger.Debugf("SMB: %s denied by ACL %s", method, p)
+	return STATUS_ACCESS_DENIED
+}
@@ -0,0 +1,709 @@
+package smbserver
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/metrics"
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/ws"
+)
+
+// CrackStatus is the lifecycle state of a crack job.
+type CrackStatus string
+
+const (
+	CrackQueued    CrackStatus = "queued"
+	CrackRunning   CrackStatus = "running"
+	CrackCracked   CrackStatus = "cracked"
+	CrackExhausted CrackStatus = "exhausted"
+	CrackCancelled CrackStatus = "cancelled"
+	CrackFailed    CrackStatus = "failed"
+)
+
+// progressInterval is how often running jobs report progress over the hub.
+var progressInterval = time.Second
+
+// CandidateSource produces password candidates for a crack job. Wordlists,
+// rule-mangled wordlists and masks implement it; new attack modes only need
+// to implement this interface.
+type CandidateSource interface {
+	// Keyspace returns the number of candidates, or -1 if unknown.
+	Keyspace() int64
+	// Generate sends candidates to out until exhausted or ctx is done.
+	Generate(ctx context.Context, out chan<- string) error
+}
+
+// CrackAttack describes what a job tries against a hash.
+type CrackAttack struct {
+	Wordlist string `json:"wordlist,omitempty"` // wordlist path, empty = built-in list
+	Rules    string `json:"rules,omitempty"`    // hashcat rule file, or "builtin"
+	Mask     string `json:"mask,omitempty"`     // mask attack, takes precedence over the wordlist
+}
+
+func (a CrackAttack) String() string {
+	if a.Mask != "" {
+		return "mask " + a.Mask
+	}
+	s := "built-in wordlist"
+	if a.Wordlist != "" {
+		s = "wordlist " + a.Wordlist
+	}
+	if a.Rules != "" {
+		s += " + rules " + a.Rules
+	}
+	return s
+}
+
+// CrackHash is a captured hash known to the cracker.
+type CrackHash struct {
+	ID          string    `json:"id"`
+	Origin      string    `json:"origin"`
+	Source      string    `json:"source"`
+	Username    string    `json:"username"`
+	Domain      string    `json:"domain"`
+	HashType    string    `json:"hashType"`
+	HashcatMode string    `json:"hashcatMode"`
+	Hash        string    `json:"hash"`
+	Password    string    `json:"password,omitempty"`
+	Captured    time.Time `json:"captured"`
+}
+
+// CrackJob is a snapshot of one attack against one captured hash.
+type CrackJob struct {
+	ID       string      `json:"id"`
+	HashID   string      `json:"hashId"`
+	Origin   string      `json:"origin"`
+	Username string      `json:"username"`
+	Domain   string      `json:"domain"`
+	Attack   CrackAttack `json:"attack"`
+	Status   CrackStatus `json:"status"`
+	Tried    int64       `json:"tried"`
+	Keyspace int64       `json:"keyspace"`
+	Password string      `json:"password,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Created  time.Time   `json:"created"`
+	Started  time.Time   `json:"started,omitzero"`
+	Finished time.Time   `json:"finished,omitzero"`
+}
+
+type crackTarget struct {
+	info    CrackHash
+	hash    CapturedHash
+	onCrack func(password string)
+}
+
+type crackJob struct {
+	CrackJob
+	tried  atomic.Int64
+	cancel context.CancelFunc
+}
+
+// Cracker runs crack jobs one after another, each on a pool of workers
+// verifying candidates in parallel. It is shared by every service that
+// captures NTLM hashes so any hash can be (re-)queued from one place.
+type Cracker struct {
+	Workers    int
+	Rules      string // rules applied to automatic wordlist jobs
+	Mask       string // mask tried automatically after capture
+	MaxMaskLen int
+	Hub        *ws.Hub
+
+	mu       sync.Mutex
+	hashes   map[string]*crackTarget
+	hashIDs  []string
+	jobs     map[string]*crackJob
+	jobIDs   []string
+	queue    []*crackJob
+	wake     chan struct{}
+	ctx      context.Context
+	stopFunc context.CancelFunc
+}
+
+func NewCracker(opts *options.Options, hub *ws.Hub) *Cracker {
+	workers := opts.CrackWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	maxLen := opts.CrackMaskMaxLen
+	if maxLen <= 0 {
+		maxLen = DefaultMaxMaskLength
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Cracker{
+		Workers:    workers,
+		Rules:      opts.CrackRules,
+		Mask:       opts.CrackMask,
+		MaxMaskLen: maxLen,
+		Hub:        hub,
+		hashes:     make(map[string]*crackTarget),
+		jobs:       make(map[string]*crackJob),
+		wake:       make(chan struct{}, 1),
+		ctx:        ctx,
+		stopFunc:   cancel,
+	}
+	go c.run()
+	return c
+}
+
+// Stop cancels the running job and stops the dispatcher.
+func (c *Cracker) Stop() {
+	c.stopFunc()
+}
+
+// Submit registers a captured hash and, unless it is already cracked, queues
+// the automatic attacks: the given wordlist (with the configured rules) and
+// the configured mask. onCrack is called whenever a job cracks the hash.
+// It returns the hash ID used to queue further jobs.
+func (c *Cracker) Submit(captured *CapturedHash, origin, source, cracked, wordlist string, onCrack func(password string)) string {
+	t := &crackTarget{
+		info: CrackHash{
+			ID:          newCrackID(),
+			Origin:      origin,
+			Source:      source,
+			Username:    captured.Username,
+			Domain:      captured.Domain,
+			HashType:    string(captured.Protocol),
+			HashcatMode: captured.HashcatMode,
+			Hash:        captured.HashcatLine,
+			Password:    cracked,
+			Captured:    time.Now(),
+		},
+		hash:    *captured,
+		onCrack: onCrack,
+	}
+
+	c.mu.Lock()
+	c.hashes[t.info.ID] = t
+	c.hashIDs = append(c.hashIDs, t.info.ID)
+	c.mu.Unlock()
+
+	if cracked != "" {
+		return t.info.ID
+	}
+
+	var attacks []CrackAttack
+	if wordlist != "" || c.Rules != "" {
+		attacks = append(attacks, CrackAttack{Wordlist: wordlist, Rules: c.Rules})
+	}
+	if c.Mask != "" {
+		attacks = append(attacks, CrackAttack{Mask: c.Mask})
+	}
+	for _, a := range attacks {
+		if _, err := c.Enqueue(t.info.ID, a); err != nil {
+			logger.Warnf("crack: cannot queue %s for %s\\%s: %v", a, captured.Domain, captured.Username, err)
+		}
+	}
+	return t.info.ID
+}
+
+// Enqueue queues a new job running attack against the hash hashID.
+func (c *Cracker) Enqueue(hashID string, attack CrackAttack) (CrackJob, error) {
+	if attack.Mask != "" {
+		if _, err := ParseMask(attack.Mask, c.MaxMaskLen); err != nil {
+			return CrackJob{}, err
+		}
+	}
+
+	c.mu.Lock()
+	t, ok := c.hashes[hashID]
+	if !ok {
+		c.mu.Unlock()
+		return CrackJob{}, fmt.Errorf("hash %s not found", hashID)
+	}
+	j := &crackJob{CrackJob: CrackJob{
+		ID:       newCrackID(),
+		HashID:   hashID,
+		Origin:   t.info.Origin,
+		Username: t.info.Username,
+		Domain:   t.info.Domain,
+		Attack:   attack,
+		Status:   CrackQueued,
+		Keyspace: -1,
+		Created:  time.Now(),
+	}}
+	c.jobs[j.ID] = j
+	c.jobIDs = append(c.jobIDs, j.ID)
+	c.queue = append(c.queue, j)
+	snap := j.snapshot()
+	c.mu.Unlock()
+
+	c.emit(snap, 0)
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return snap, nil
+}
+
+// Cancel stops a queued or running job.
+func (c *Cracker) Cancel(jobID string) error {
+	c.mu.Lock()
+	j, ok := c.jobs[jobID]
+	if !ok {
+		c.mu.Unlock()
+		return fmt.Errorf("job %s not found", jobID)
+	}
+	switch j.Status {
+	case CrackQueued:
+		c.removeQueued(j)
+		j.Status = CrackCancelled
+		j.Finished = time.Now()
+		snap := j.snapshot()
+		c.mu.Unlock()
+		c.emit(snap, 0)
+		return nil
+	case CrackRunning:
+		cancel := j.cancel
+		c.mu.Unlock()
+		cancel()
+		return nil
+	default:
+		c.mu.Unlock()
+		return fmt.Errorf("job %s is already %s", jobID, j.Status)
+	}
+}
+
+// Requeue queues a finished job again for the same hash. A nil attack reuses
+// the attack of the original job.
+func (c *Cracker) Requeue(jobID string, attack *CrackAttack) (CrackJob, error) {
+	c.mu.Lock()
+	j, ok := c.jobs[jobID]
+	if !ok {
+		c.mu.Unlock()
+		return CrackJob{}, fmt.Errorf("job %s not found", jobID)
+	}
+	if j.Status == CrackQueued || j.Status == CrackRunning {
+		c.mu.Unlock()
+		return CrackJob{}, fmt.Errorf("job %s is still %s", jobID, j.Status)
+	}
+	hashID, a := j.HashID, j.Attack
+	c.mu.Unlock()
+
+	if attack != nil {
+		a = *attack
+	}
+	return c.Enqueue(hashID, a)
+}
+
+// Job returns a snapshot of a single job.
+func (c *Cracker) Job(jobID string) (CrackJob, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	j, ok := c.jobs[jobID]
+	if !ok {
+		return CrackJob{}, false
+	}
+	return j.snapshot(), true
+}
+
+// Jobs returns snapshots of all jobs in creation order.
+func (c *Cracker) Jobs() []CrackJob {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]CrackJob, 0, len(c.jobIDs))
+	for _, id := range c.jobIDs {
+		out = append(out, c.jobs[id].snapshot())
+	}
+	return out
+}
+
+// Hashes returns all captured hashes in capture order.
+func (c *Cracker) Hashes() []CrackHash {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]CrackHash, 0, len(c.hashIDs))
+	for _, id := range c.hashIDs {
+		out = append(out, c.hashes[id].info)
+	}
+	return out
+}
+
+// snapshot copies the exported job state. Caller holds c.mu.
+func (j *crackJob) snapshot() CrackJob {
+	s := j.CrackJob
+	s.Tried = j.tried.Load()
+	return s
+}
+
+// removeQueued drops j from the queue. Caller holds c.mu.
+func (c *Cracker) removeQueued(j *crackJob) {
+	for i, q := range c.queue {
+		if q == j {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *Cracker) run() {
+	for {
+		c.mu.Lock()
+		var j *crackJob
+		if len(c.queue) > 0 {
+			j = c.queue[0]
+			c.queue = c.queue[1:]
+		}
+		c.mu.Unlock()
+
+		if j != nil {
+			c.runJob(j)
+			continue
+		}
+
+		select {
+		case <-c.wake:
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Cracker) runJob(j *crackJob) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+
+	c.mu.Lock()
+	if j.Status != CrackQueued {
+		// Cancelled between leaving the queue and starting.
+		c.mu.Unlock()
+		return
+	}
+	t := c.hashes[j.HashID]
+	if t.info.Password != "" {
+		// Another job got there first.
+		j.Status = CrackCancelled
+		j.Error = "hash already cracked"
+		j.Finished = time.Now()
+		snap := j.snapshot()
+		c.mu.Unlock()
+		c.emit(snap, 0)
+		return
+	}
+	j.Status = CrackRunning
+	j.Started = time.Now()
+	j.cancel = cancel
+	hash := t.hash
+	c.mu.Unlock()
+
+	src, err := c.candidates(&hash, j.Attack)
+	if err != nil {
+		c.finish(j, CrackFailed, "", err)
+		return
+	}
+	keyspace := src.Keyspace()
+	c.mu.Lock()
+	j.Keyspace = keyspace
+	snap := j.snapshot()
+	c.mu.Unlock()
+	c.emit(snap, 0)
+	logger.Infof("crack: job %s started against %s\\%s (%s)", j.ID, hash.Domain, hash.Username, j.Attack)
+
+	candidates := make(chan string, 4096)
+	found := make(chan string, 1)
+
+	var wg sync.WaitGroup
+	for range c.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pw := range candidates {
+				if ctx.Err() != nil {
+					continue // drain
+				}
+				if verifyCandidate(&hash, pw) {
+					select {
+					case found <- pw:
+					default:
+					}
+					cancel()
+				}
+				j.tried.Add(1)
+			}
+		}()
+	}
+
+	genErr := make(chan error, 1)
+	go func() {
+		genErr <- src.Generate(ctx, candidates)
+		close(candidates)
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+progress:
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			snap := j.snapshot()
+			c.mu.Unlock()
+			c.emit(snap, time.Since(j.Started))
+		case <-done:
+			break progress
+		}
+	}
+
+	select {
+	case pw := <-found:
+		c.finish(j, CrackCracked, pw, nil)
+		return
+	default:
+	}
+
+	err = <-genErr
+	switch {
+	case c.ctx.Err() != nil:
+		c.finish(j, CrackCancelled, "", errors.New("cracker stopped"))
+	case errors.Is(err, context.Canceled):
+		c.finish(j, CrackCancelled, "", nil)
+	case err != nil:
+		c.finish(j, CrackFailed, "", err)
+	default:
+		c.finish(j, CrackExhausted, "", nil)
+	}
+}
+
+func (c *Cracker) finish(j *crackJob, status CrackStatus, password string, err error) {
+	c.mu.Lock()
+	j.Status = status
+	j.Password = password
+	j.Finished = time.Now()
+	if err != nil {
+		j.Error = err.Error()
+	}
+	t := c.hashes[j.HashID]
+	var onCrack func(string)
+	var skipped []CrackJob
+	if status == CrackCracked {
+		if t.info.Password == "" {
+			metrics.HashesCracked.Inc(t.info.Origin)
+		}
+		t.info.Password = password
+		onCrack = t.onCrack
+		// Nothing left to do for the other jobs queued on this hash.
+		for _, q := range append([]*crackJob(nil), c.queue...) {
+			if q.HashID == j.HashID {
+				c.removeQueued(q)
+				q.Status = CrackCancelled
+				q.Error = "hash already cracked"
+				q.Finished = j.Finished
+				skipped = append(skipped, q.snapshot())
+			}
+		}
+	}
+	snap := j.snapshot()
+	c.mu.Unlock()
+
+	elapsed := snap.Finished.Sub(snap.Started)
+	switch status {
+	case CrackCracked:
+		logger.Infof("crack: job %s cracked %s\\%s — plaintext: %s (%s)", j.ID, snap.Domain, snap.Username, password, snap.Attack)
+	case CrackFailed:
+		logger.Warnf("crack: job %s failed: %v", j.ID, err)
+	default:
+		logger.Infof("crack: job %s %s after %d candidates in %s", j.ID, status, snap.Tried, elapsed.Round(time.Millisecond))
+	}
+
+	c.emit(snap, elapsed)
+	for _, s := range skipped {
+		c.emit(s, 0)
+	}
+	if onCrack != nil {
+		onCrack(password)
+	}
+}
+
+// emit broadcasts the job state. elapsed is the run time used for rate and ETA.
+func (c *Cracker) emit(j CrackJob, elapsed time.Duration) {
+	if c.Hub == nil {
+		return
+	}
+
+	var rate float64
+	eta := int64(-1)
+	if secs := elapsed.Seconds(); secs > 0 {
+		rate = float64(j.Tried) / secs
+	}
+	if j.Status == CrackRunning && rate > 0 && j.Keyspace >= 0 {
+		eta = int64(float64(j.Keyspace-j.Tried) / rate)
+	}
+
+	event := ws.CrackEvent{
+		Type:      "crack",
+		JobID:     j.ID,
+		HashID:    j.HashID,
+		Origin:    j.Origin,
+		Username:  j.Username,
+		Domain:    j.Domain,
+		Attack:    j.Attack.String(),
+		Status:    string(j.Status),
+		Tried:     j.Tried,
+		Keyspace:  j.Keyspace,
+		Rate:      rate,
+		ETA:       eta,
+		Password:  j.Password,
+		Error:     j.Error,
+		Timestamp: time.Now(),
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	c.Hub.Broadcast <- b
+}
+
+// candidates builds the candidate source for an attack.
+func (c *Cracker) candidates(hash *CapturedHash, a CrackAttack) (CandidateSource, error) {
+	if a.Mask != "" {
+		return ParseMask(a.Mask, c.MaxMaskLen)
+	}
+
+	var src CandidateSource
+	if a.Wordlist == "" {
+		src = wordSlice(buildDefaultWordlist(hash.Username, hash.Domain))
+	} else {
+		if _, err := os.Stat(a.Wordlist); err != nil {
+			return nil, err
+		}
+		src = &wordFile{path: a.Wordlist}
+	}
+
+	if a.Rules != "" {
+		rules, errs, err := LoadRules(a.Rules)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range errs {
+			logger.Debugf("crack: skipping rule in %s: %v", a.Rules, e)
+		}
+		if len(rules) == 0 {
+			return nil, fmt.Errorf("no usable rules in %s", a.Rules)
+		}
+		src = &ruleSource{base: src, rules: rules}
+	}
+	return src, nil
+}
+
+// wordSlice is an in-memory wordlist.
+type wordSlice []string
+
+func (w wordSlice) Keyspace() int64 { return int64(len(w)) }
+
+func (w wordSlice) Generate(ctx context.Context, out chan<- string) error {
+	for _, pw := range w {
+		select {
+		case out <- pw:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// wordFile streams a wordlist from disk line by line.
+type wordFile struct {
+	path string
+}
+
+// Keyspace counts the lines of the file, -1 if it cannot be read.
+func (w *wordFile) Keyspace() int64 {
+	f, err := os.Open(w.path)
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+
+	var n int64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		n++
+	}
+	if scanner.Err() != nil {
+		return -1
+	}
+	return n
+}
+
+func (w *wordFile) Generate(ctx context.Context, out chan<- string) error {
+	f, err := os.Open(w.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		select {
+		case out <- strings.TrimRight(scanner.Text(), "\r"):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return scanner.Err()
+}
+
+// ruleSource applies every rule to every word of its base source.
+type ruleSource struct {
+	base  CandidateSource
+	rules []Rule
+}
+
+func (r *ruleSource) Keyspace() int64 {
+	n := r.base.Keyspace()
+	if n < 0 {
+		return -1
+	}
+	return n * int64(len(r.rules))
+}
+
+func (r *ruleSource) Generate(ctx context.Context, out chan<- string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	words := make(chan string, 256)
+	baseErr := make(chan error, 1)
+	go func() {
+		baseErr <- r.base.Generate(ctx, words)
+		close(words)
+	}()
+
+	for word := range words {
+		for _, rule := range r.rules {
+			select {
+			case out <- rule.Apply(word):
+			case <-ctx.Done():
+				cancel()
+				for range words {
+				}
+				return ctx.Err()
+			}
+		}
+	}
+	return <-baseErr
+}
+
+func newCrackID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
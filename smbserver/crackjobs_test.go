@@ -0,0 +1,196 @@
+package smbserver
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/ws"
+)
+
+func newTestCracker(t *testing.T, opts *options.Options) (*Cracker, *ws.Hub) {
+	t.Helper()
+	hub := &ws.Hub{Broadcast: make(chan []byte, 1024)}
+	c := NewCracker(opts, hub)
+	t.Cleanup(c.Stop)
+	return c, hub
+}
+
+func waitForJob(t *testing.T, c *Cracker, id string, done func(CrackJob) bool) CrackJob {
+	t.Helper()
+	var job CrackJob
+	require.Eventually(t, func() bool {
+		var ok bool
+		job, ok = c.Job(id)
+		return ok && done(job)
+	}, 10*time.Second, 10*time.Millisecond)
+	return job
+}
+
+func finished(j CrackJob) bool {
+	return j.Status != CrackQueued && j.Status != CrackRunning
+}
+
+func crackEvents(hub *ws.Hub) []ws.CrackEvent {
+	var events []ws.CrackEvent
+	for {
+		select {
+		case raw := <-hub.Broadcast:
+			var e ws.CrackEvent
+			if err := json.Unmarshal(raw, &e); err == nil && e.Type == "crack" {
+				events = append(events, e)
+			}
+		default:
+			return events
+		}
+	}
+}
+
+func TestCracker_SubmitCrackedSkipsJobs(t *testing.T) {
+	c, _ := newTestCracker(t, &options.Options{CrackRules: "builtin"})
+	captured := makeNTLMv2CapturedHash("password", "alice", "CORP")
+
+	id := c.Submit(captured, "smb", "10.0.0.1:1234", "password", "", nil)
+	require.Len(t, c.Hashes(), 1)
+	require.Equal(t, id, c.Hashes()[0].ID)
+	require.Equal(t, "password", c.Hashes()[0].Password)
+	require.Empty(t, c.Jobs())
+}
+
+func TestCracker_RulesCrack(t *testing.T) {
+	c, hub := newTestCracker(t, &options.Options{CrackWorkers: 4, CrackRules: "builtin"})
+	captured := makeNTLMv2CapturedHash("Alice2025!", "alice", "CORP")
+
+	var mu sync.Mutex
+	var got string
+	c.Submit(captured, "smb", "10.0.0.1:1234", "", "", func(pw string) {
+		mu.Lock()
+		got = pw
+		mu.Unlock()
+	})
+
+	jobs := c.Jobs()
+	require.Len(t, jobs, 1)
+	job := waitForJob(t, c, jobs[0].ID, finished)
+	require.Equal(t, CrackCracked, job.Status)
+	require.Equal(t, "Alice2025!", job.Password)
+	require.Equal(t, "Alice2025!", c.Hashes()[0].Password)
+
+	mu.Lock()
+	require.Equal(t, "Alice2025!", got)
+	mu.Unlock()
+
+	events := crackEvents(hub)
+	require.NotEmpty(t, events)
+	last := events[len(events)-1]
+	require.Equal(t, "cracked", last.Status)
+	require.Equal(t, "smb", last.Origin)
+	require.Equal(t, "Alice2025!", last.Password)
+}
+
+func TestCracker_WordlistWithRules(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "words*.txt")
+	require.NoError(t, err)
+	_, err = f.WriteString("monkey\nautumn\nbanana\n")
+	require.NoError(t, err)
+	f.Close()
+
+	c, _ := newTestCracker(t, &options.Options{CrackWorkers: 2})
+	id := c.Submit(makeNTLMv2CapturedHash("Autumn1", "bob", "CORP"), "ldap", "10.0.0.2:389", "", "", nil)
+	require.Empty(t, c.Jobs(), "no automatic attack configured")
+
+	job, err := c.Enqueue(id, CrackAttack{Wordlist: f.Name(), Rules: "builtin"})
+	require.NoError(t, err)
+	job = waitForJob(t, c, job.ID, finished)
+	require.Equal(t, CrackCracked, job.Status)
+	require.Equal(t, "Autumn1", job.Password)
+	require.Equal(t, "ldap", job.Origin)
+}
+
+func TestCracker_MaskExhaustedThenRequeue(t *testing.T) {
+	c, hub := newTestCracker(t, &options.Options{CrackWorkers: 2, CrackMask: "x?d?d"})
+	id := c.Submit(makeNTLMv2CapturedHash("y42", "carol", "CORP"), "smb", "10.0.0.3:445", "", "", nil)
+
+	jobs := c.Jobs()
+	require.Len(t, jobs, 1)
+	job := waitForJob(t, c, jobs[0].ID, finished)
+	require.Equal(t, CrackExhausted, job.Status)
+	require.Equal(t, int64(100), job.Keyspace)
+	require.Equal(t, int64(100), job.Tried)
+
+	_, err := c.Requeue(job.ID, &CrackAttack{Mask: "?l?d?d"})
+	require.NoError(t, err)
+	jobs = c.Jobs()
+	require.Len(t, jobs, 2)
+	require.Equal(t, id, jobs[1].HashID)
+	job = waitForJob(t, c, jobs[1].ID, finished)
+	require.Equal(t, CrackCracked, job.Status)
+	require.Equal(t, "y42", job.Password)
+
+	for _, e := range crackEvents(hub) {
+		require.Equal(t, "carol", e.Username)
+	}
+}
+
+func TestCracker_CancelRunning(t *testing.T) {
+	progressInterval = 10 * time.Millisecond
+	defer func() { progressInterval = time.Second }()
+
+	c, hub := newTestCracker(t, &options.Options{CrackWorkers: 1})
+	id := c.Submit(makeNTLMv2CapturedHash("not-in-mask", "dave", "CORP"), "smb", "10.0.0.4:445", "", "", nil)
+
+	job, err := c.Enqueue(id, CrackAttack{Mask: "?a?a?a?a"})
+	require.NoError(t, err)
+	waitForJob(t, c, job.ID, func(j CrackJob) bool { return j.Status == CrackRunning && j.Tried > 0 })
+
+	// A second job waits behind the running one and can be cancelled while queued.
+	queued, err := c.Enqueue(id, CrackAttack{Mask: "?d"})
+	require.NoError(t, err)
+	require.NoError(t, c.Cancel(queued.ID))
+	queued, _ = c.Job(queued.ID)
+	require.Equal(t, CrackCancelled, queued.Status)
+
+	require.NoError(t, c.Cancel(job.ID))
+	job = waitForJob(t, c, job.ID, finished)
+	require.Equal(t, CrackCancelled, job.Status)
+	require.Less(t, job.Tried, job.Keyspace)
+
+	require.Error(t, c.Cancel(job.ID), "finished jobs cannot be cancelled")
+	_, err = c.Requeue(queued.ID, nil)
+	require.NoError(t, err)
+
+	var sawProgress bool
+	for _, e := range crackEvents(hub) {
+		if e.Status == "running" && e.Tried > 0 {
+			sawProgress = true
+			require.Equal(t, int64(95*95*95*95), e.Keyspace)
+			require.Greater(t, e.Rate, 0.0)
+		}
+	}
+	require.True(t, sawProgress)
+}
+
+func TestCracker_Errors(t *testing.T) {
+	c, _ := newTestCracker(t, &options.Options{})
+
+	_, err := c.Enqueue("missing", CrackAttack{})
+	require.Error(t, err)
+	require.Error(t, c.Cancel("missing"))
+	_, err = c.Requeue("missing", nil)
+	require.Error(t, err)
+
+	id := c.Submit(makeNTLMv2CapturedHash("x", "erin", "CORP"), "smb", "", "", "", nil)
+	_, err = c.Enqueue(id, CrackAttack{Mask: "?d?d?d?d?d?d?d?d?d"})
+	require.Error(t, err)
+
+	job, err := c.Enqueue(id, CrackAttack{Wordlist: "/nonexistent/words.txt"})
+	require.NoError(t, err)
+	job = waitForJob(t, c, job.ID, finished)
+	require.Equal(t, CrackFailed, job.Status)
+	require.NotEmpty(t, job.Error)
+}
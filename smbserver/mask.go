@@ -0,0 +1,107 @@
+package smbserver
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// DefaultMaxMaskLength caps how many positions a mask may have. Anything
+// longer is not realistically exhaustible by a CPU cracker.
+const DefaultMaxMaskLength = 8
+
+var maskCharsets = map[byte]string{
+	'l': "abcdefghijklmnopqrstuvwxyz",
+	'u': "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	'd': "0123456789",
+	'h': "0123456789abcdef",
+	'H': "0123456789ABCDEF",
+	's': " !\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~",
+}
+
+func init() {
+	maskCharsets['a'] = maskCharsets['l'] + maskCharsets['u'] + maskCharsets['d'] + maskCharsets['s']
+}
+
+// Mask is a parsed hashcat-style mask such as "?u?l?l?l?d?d".
+// Supported placeholders: ?l ?u ?d ?h ?H ?s ?a and ?? for a literal '?'.
+// Any other character is taken literally.
+type Mask struct {
+	raw       string
+	positions []string
+	keyspace  int64
+}
+
+// ParseMask parses mask and rejects it if it has more than maxLen positions
+// (0 selects DefaultMaxMaskLength).
+func ParseMask(mask string, maxLen int) (*Mask, error) {
+	if maxLen <= 0 {
+		maxLen = DefaultMaxMaskLength
+	}
+
+	m := &Mask{raw: mask, keyspace: 1}
+	for i := 0; i < len(mask); i++ {
+		if mask[i] != '?' {
+			m.positions = append(m.positions, mask[i:i+1])
+			continue
+		}
+		if i+1 >= len(mask) {
+			return nil, fmt.Errorf("mask %q ends with a dangling '?'", mask)
+		}
+		i++
+		if mask[i] == '?' {
+			m.positions = append(m.positions, "?")
+			continue
+		}
+		cs, ok := maskCharsets[mask[i]]
+		if !ok {
+			return nil, fmt.Errorf("mask %q: unknown charset ?%c", mask, mask[i])
+		}
+		m.positions = append(m.positions, cs)
+	}
+
+	if len(m.positions) == 0 {
+		return nil, fmt.Errorf("empty mask")
+	}
+	if len(m.positions) > maxLen {
+		return nil, fmt.Errorf("mask %q has %d positions, the limit is %d", mask, len(m.positions), maxLen)
+	}
+
+	for _, cs := range m.positions {
+		if m.keyspace > math.MaxInt64/int64(len(cs)) {
+			return nil, fmt.Errorf("mask %q keyspace is too large", mask)
+		}
+		m.keyspace *= int64(len(cs))
+	}
+	return m, nil
+}
+
+// String returns the mask as it was written.
+func (m *Mask) String() string { return m.raw }
+
+// Keyspace returns the number of candidates the mask produces.
+func (m *Mask) Keyspace() int64 { return m.keyspace }
+
+// Candidate returns the idx-th candidate of the mask, counting the last
+// position fastest.
+func (m *Mask) Candidate(idx int64) string {
+	buf := make([]byte, len(m.positions))
+	for i := len(m.positions) - 1; i >= 0; i-- {
+		cs := m.positions[i]
+		buf[i] = cs[idx%int64(len(cs))]
+		idx /= int64(len(cs))
+	}
+	return string(buf)
+}
+
+// Generate sends every candidate of the mask to out until exhausted or ctx is done.
+func (m *Mask) Generate(ctx context.Context, out chan<- string) error {
+	for i := int64(0); i < m.keyspace; i++ {
+		select {
+		case out <- m.Candidate(i):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package smbserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMask_Keyspace(t *testing.T) {
+	m, err := ParseMask("?u?l?d", 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(26*26*10), m.Keyspace())
+
+	m, err = ParseMask("ab?d", 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), m.Keyspace())
+
+	m, err = ParseMask("??", 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), m.Keyspace())
+	require.Equal(t, "?", m.Candidate(0))
+}
+
+func TestParseMask_Errors(t *testing.T) {
+	_, err := ParseMask("", 0)
+	require.Error(t, err)
+
+	_, err = ParseMask("abc?", 0)
+	require.Error(t, err)
+
+	_, err = ParseMask("?x", 0)
+	require.Error(t, err)
+
+	_, err = ParseMask("?d?d?d?d", 3)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "limit is 3")
+
+	_, err = ParseMask("?a?a?a?a?a?a?a?a?a", 0)
+	require.Error(t, err)
+}
+
+func TestMask_Candidates(t *testing.T) {
+	m, err := ParseMask("x?d", 0)
+	require.NoError(t, err)
+	require.Equal(t, "x0", m.Candidate(0))
+	require.Equal(t, "x9", m.Candidate(9))
+
+	out := make(chan string, 16)
+	require.NoError(t, m.Generate(context.Background(), out))
+	close(out)
+	var got []string
+	for c := range out {
+		got = append(got, c)
+	}
+	require.Equal(t, []string{"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7", "x8", "x9"}, got)
+}
+
+func TestMask_GenerateCancelled(t *testing.T) {
+	m, err := ParseMask("?d?d?d", 0)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, m.Generate(ctx, make(chan string)), context.Canceled)
+}
@@ -0,0 +1,351 @@
+package smbserver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Rule is a parsed hashcat-style mangling rule, e.g. "c $1 sa@".
+type Rule struct {
+	raw string
+	ops []ruleOp
+}
+
+type ruleOp struct {
+	fn   byte
+	args [2]byte
+}
+
+// ruleArgs lists the supported rule functions and how many argument bytes
+// each one takes. Semantics follow hashcat's rule engine.
+var ruleArgs = map[byte]int{
+	':':  0, // do nothing
+	'l':  0, // lowercase all
+	'u':  0, // uppercase all
+	'c':  0, // capitalize first, lowercase rest
+	'C':  0, // lowercase first, uppercase rest
+	't':  0, // toggle case of all
+	'T':  1, // toggle case at position N
+	'r':  0, // reverse
+	'd':  0, // duplicate word
+	'p':  1, // append duplicated word N times
+	'f':  0, // reflect (word + reversed word)
+	'{':  0, // rotate left
+	'}':  0, // rotate right
+	'$':  1, // append character X
+	'^':  1, // prepend character X
+	'[':  0, // delete first character
+	']':  0, // delete last character
+	'D':  1, // delete character at position N
+	'x':  2, // extract M characters starting at N
+	'O':  2, // omit M characters starting at N
+	'i':  2, // insert X at position N
+	'o':  2, // overwrite position N with X
+	'\'': 1, // truncate at position N
+	's':  2, // replace all X with Y
+	'@':  1, // purge all X
+	'z':  1, // duplicate first character N times
+	'Z':  1, // duplicate last character N times
+	'q':  0, // duplicate every character
+	'E':  0, // title case, words split on space
+}
+
+// DefaultRules is a small rule set covering the usual capitalisation,
+// suffix and leetspeak habits. Used when an attack asks for "builtin" rules.
+var DefaultRules = []string{
+	":",
+	"c",
+	"u",
+	"$1",
+	"$!",
+	"c $1",
+	"c $!",
+	"c $1 $!",
+	"$1 $2 $3",
+	"c $1 $2 $3",
+	"c $1 $2 $3 $!",
+	"$2 $0 $2 $5",
+	"c $2 $0 $2 $5",
+	"c $2 $0 $2 $5 $!",
+	"$2 $0 $2 $6",
+	"c $2 $0 $2 $6",
+	"c $2 $0 $2 $6 $!",
+	"sa@",
+	"se3",
+	"so0",
+	"si1",
+	"ss$",
+	"sa@ se3 so0",
+	"sa@ se3 so0 si1 ss$",
+	"c sa@ se3 so0",
+	"c sa@ se3 so0 $1",
+	"c sa@ se3 so0 $!",
+	"d",
+	"r",
+	"t",
+}
+
+// rulePos decodes a hashcat position character (0-9, A-Z).
+func rulePos(b byte) (int, bool) {
+	switch {
+	case b >= '0' && b <= '9':
+		return int(b - '0'), true
+	case b >= 'A' && b <= 'Z':
+		return int(b-'A') + 10, true
+	}
+	return 0, false
+}
+
+// ParseRule parses a single hashcat rule line. Functions may be separated by
+// spaces; a space is still a valid argument (e.g. "$ " appends a space).
+func ParseRule(line string) (Rule, error) {
+	r := Rule{raw: line}
+	for i := 0; i < len(line); {
+		fn := line[i]
+		if fn == ' ' || fn == '\t' {
+			i++
+			continue
+		}
+		n, ok := ruleArgs[fn]
+		if !ok {
+			return Rule{}, fmt.Errorf("unsupported rule function %q at offset %d", fn, i)
+		}
+		if i+1+n > len(line) {
+			return Rule{}, fmt.Errorf("rule function %q at offset %d is missing arguments", fn, i)
+		}
+		op := ruleOp{fn: fn}
+		copy(op.args[:], line[i+1:i+1+n])
+		if err := op.validate(); err != nil {
+			return Rule{}, err
+		}
+		r.ops = append(r.ops, op)
+		i += 1 + n
+	}
+	if len(r.ops) == 0 {
+		return Rule{}, fmt.Errorf("empty rule")
+	}
+	return r, nil
+}
+
+func (op ruleOp) validate() error {
+	needPos := 0
+	switch op.fn {
+	case 'T', 'p', 'D', '\'', 'z', 'Z', 'i', 'o':
+		needPos = 1
+	case 'x', 'O':
+		needPos = 2
+	}
+	for i := 0; i < needPos; i++ {
+		if _, ok := rulePos(op.args[i]); !ok {
+			return fmt.Errorf("rule function %q: invalid position %q", op.fn, op.args[i])
+		}
+	}
+	return nil
+}
+
+// String returns the rule as it was written.
+func (r Rule) String() string { return r.raw }
+
+// Apply mangles word according to the rule.
+func (r Rule) Apply(word string) string {
+	w := []byte(word)
+	for _, op := range r.ops {
+		w = op.apply(w)
+	}
+	return string(w)
+}
+
+func (op ruleOp) apply(w []byte) []byte {
+	n, _ := rulePos(op.args[0])
+	m, _ := rulePos(op.args[1])
+
+	switch op.fn {
+	case ':':
+	case 'l':
+		w = bytes.ToLower(w)
+	case 'u':
+		w = bytes.ToUpper(w)
+	case 'c':
+		w = bytes.ToLower(w)
+		if len(w) > 0 {
+			w[0] = toUpper(w[0])
+		}
+	case 'C':
+		w = bytes.ToUpper(w)
+		if len(w) > 0 {
+			w[0] = toLower(w[0])
+		}
+	case 't':
+		for i := range w {
+			w[i] = toggle(w[i])
+		}
+	case 'T':
+		if n < len(w) {
+			w[n] = toggle(w[n])
+		}
+	case 'r':
+		for i, j := 0, len(w)-1; i < j; i, j = i+1, j-1 {
+			w[i], w[j] = w[j], w[i]
+		}
+	case 'd':
+		w = append(w, w...)
+	case 'p':
+		base := append([]byte(nil), w...)
+		for i := 0; i < n; i++ {
+			w = append(w, base...)
+		}
+	case 'f':
+		rev := make([]byte, len(w))
+		for i := range w {
+			rev[len(w)-1-i] = w[i]
+		}
+		w = append(w, rev...)
+	case '{':
+		if len(w) > 1 {
+			w = append(w[1:], w[0])
+		}
+	case '}':
+		if len(w) > 1 {
+			last := w[len(w)-1]
+			w = append([]byte{last}, w[:len(w)-1]...)
+		}
+	case '$':
+		w = append(w, op.args[0])
+	case '^':
+		w = append([]byte{op.args[0]}, w...)
+	case '[':
+		if len(w) > 0 {
+			w = w[1:]
+		}
+	case ']':
+		if len(w) > 0 {
+			w = w[:len(w)-1]
+		}
+	case 'D':
+		if n < len(w) {
+			w = append(w[:n:n], w[n+1:]...)
+		}
+	case 'x':
+		if n < len(w) {
+			end := min(n+m, len(w))
+			w = w[n:end]
+		}
+	case 'O':
+		if n < len(w) {
+			end := min(n+m, len(w))
+			w = append(w[:n:n], w[end:]...)
+		}
+	case 'i':
+		if n <= len(w) {
+			out := make([]byte, 0, len(w)+1)
+			out = append(out, w[:n]...)
+			out = append(out, op.args[1])
+			w = append(out, w[n:]...)
+		}
+	case 'o':
+		if n < len(w) {
+			w[n] = op.args[1]
+		}
+	case '\'':
+		if n < len(w) {
+			w = w[:n]
+		}
+	case 's':
+		w = bytes.ReplaceAll(w, op.args[:1], op.args[1:2])
+	case '@':
+		w = bytes.ReplaceAll(w, op.args[:1], nil)
+	case 'z':
+		if len(w) > 0 {
+			w = append(bytes.Repeat(w[:1], n), w...)
+		}
+	case 'Z':
+		if len(w) > 0 {
+			w = append(w, bytes.Repeat(w[len(w)-1:], n)...)
+		}
+	case 'q':
+		out := make([]byte, 0, len(w)*2)
+		for _, b := range w {
+			out = append(out, b, b)
+		}
+		w = out
+	case 'E':
+		w = bytes.ToLower(w)
+		for i := range w {
+			if i == 0 || w[i-1] == ' ' {
+				w[i] = toUpper(w[i])
+			}
+		}
+	}
+	return w
+}
+
+func toUpper(b byte) byte {
+	if b >= 'a' && b <= 'z' {
+		return b - 32
+	}
+	return b
+}
+
+func toLower(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + 32
+	}
+	return b
+}
+
+func toggle(b byte) byte {
+	switch {
+	case b >= 'a' && b <= 'z':
+		return b - 32
+	case b >= 'A' && b <= 'Z':
+		return b + 32
+	}
+	return b
+}
+
+// ParseRules parses rule lines, skipping blanks and # comments. Lines with
+// unsupported functions are skipped and reported in the returned error slice.
+func ParseRules(lines []string) ([]Rule, []error) {
+	var rules []Rule
+	var errs []error
+	for i, line := range lines {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := ParseRule(line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", i+1, err))
+			continue
+		}
+		rules = append(rules, r)
+	}
+	return rules, errs
+}
+
+// LoadRules reads a hashcat rule file. "builtin" selects DefaultRules.
+func LoadRules(path string) ([]Rule, []error, error) {
+	if path == "builtin" {
+		rules, errs := ParseRules(DefaultRules)
+		return rules, errs, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	rules, errs := ParseRules(lines)
+	return rules, errs, nil
+}
@@ -0,0 +1,98 @@
+package smbserver
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleApply(t *testing.T) {
+	cases := []struct {
+		rule, word, want string
+	}{
+		{":", "Password", "Password"},
+		{"l", "PassWord", "password"},
+		{"u", "password", "PASSWORD"},
+		{"c", "pASSWORD", "Password"},
+		{"C", "password", "pASSWORD"},
+		{"t", "PassWord", "pASSwORD"},
+		{"T0", "password", "Password"},
+		{"r", "abc", "cba"},
+		{"d", "abc", "abcabc"},
+		{"p2", "ab", "ababab"},
+		{"f", "abc", "abccba"},
+		{"{", "abc", "bca"},
+		{"}", "abc", "cab"},
+		{"$1", "pass", "pass1"},
+		{"^!", "pass", "!pass"},
+		{"[", "pass", "ass"},
+		{"]", "pass", "pas"},
+		{"D1", "pass", "pss"},
+		{"x13", "password", "ass"},
+		{"O12", "password", "psword"},
+		{"i4!", "password", "pass!word"},
+		{"o0P", "password", "Password"},
+		{"'4", "password", "pass"},
+		{"sa@", "banana", "b@n@n@"},
+		{"@a", "banana", "bnn"},
+		{"z2", "abc", "aaabc"},
+		{"Z2", "abc", "abccc"},
+		{"q", "abc", "aabbcc"},
+		{"E", "hello world", "Hello World"},
+		{"$ ", "pass", "pass "},
+		{"c $2 $0 $2 $5", "summer", "Summer2025"},
+		{"csa@se3so0$!", "password", "P@ssw0rd!"},
+		{"TA", "short", "short"}, // out of range positions are ignored
+	}
+	for _, tc := range cases {
+		r, err := ParseRule(tc.rule)
+		require.NoError(t, err, tc.rule)
+		require.Equal(t, tc.want, r.Apply(tc.word), tc.rule)
+	}
+}
+
+func TestParseRule_Errors(t *testing.T) {
+	for _, line := range []string{"", "   ", "K", "$", "sa", "T!", "x1"} {
+		_, err := ParseRule(line)
+		require.Error(t, err, "rule %q", line)
+	}
+}
+
+func TestParseRules_SkipsCommentsAndBadLines(t *testing.T) {
+	rules, errs := ParseRules([]string{"# comment", "", "c", "K", "$1"})
+	require.Len(t, rules, 2)
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0].Error(), "line 4")
+}
+
+func TestDefaultRulesParse(t *testing.T) {
+	rules, errs := ParseRules(DefaultRules)
+	require.Empty(t, errs)
+	require.Len(t, rules, len(DefaultRules))
+}
+
+func TestLoadRules_File(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "rules*.rule")
+	require.NoError(t, err)
+	_, err = f.WriteString("c\r\n$1\n# skip\n")
+	require.NoError(t, err)
+	f.Close()
+
+	rules, errs, err := LoadRules(f.Name())
+	require.NoError(t, err)
+	require.Empty(t, errs)
+	require.Len(t, rules, 2)
+	require.Equal(t, "Admin", rules[0].Apply("admin"))
+}
+
+func TestLoadRules_Builtin(t *testing.T) {
+	rules, _, err := LoadRules("builtin")
+	require.NoError(t, err)
+	require.Len(t, rules, len(DefaultRules))
+}
+
+func TestLoadRules_Missing(t *testing.T) {
+	_, _, err := LoadRules("/nonexistent/rules.rule")
+	require.Error(t, err)
+}
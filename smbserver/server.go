@@ -1,6 +1,7 @@
 package smbserver
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/binary"
 	"encoding/json"
@@ -15,8 +16,12 @@ import (
 	"sync/atomic"
 	"time"
 
+	"goshs.de/goshs/v2/acl"
 	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/metrics"
 	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/service"
+	"goshs.de/goshs/v2/users"
 	"goshs.de/goshs/v2/webhook"
 	"goshs.de/goshs/v2/ws"
 )
@@ -34,11 +39,18 @@ type SMBServer struct {
 	ReadOnly   bool
 	UploadOnly bool
 	NoDelete   bool
-	Wordlist   string // optional wordlist path for quick hash cracking
+	Wordlist   string       // optional wordlist path for quick hash cracking
+	Cracker    *Cracker     // optional shared background cracker
+	Users      *users.Users // optional users file, replaces Username/Password
+	ACL        *acl.Store   // optional shared cache of .goshs files
 	Hub        *ws.Hub
 	WebHook    *webhook.Webhook
 
-	serverGUID    [16]byte // random, set once at Start
+	settingsMu sync.RWMutex // guards the options changed by Reconfigure
+
+	conns service.Conns
+
+	serverGUID    [16]byte // random, set at the first Listen
 	nextSessionID uint64   // server-wide session ID counter (atomic)
 
 	sessions        sync.Map // uint64 → *smbSession; server-wide so multi-connection clients work
@@ -81,25 +93,30 @@ func NewSMBServer(opts *options.Options, hub *ws.Hub, webHook *webhook.Webhook)
 	}
 }
 
-func (s *SMBServer) Start() {
-	if _, err := rand.Read(s.serverGUID[:]); err != nil {
-		logger.Fatalf("SMB: failed to generate server GUID: %v", err)
+// Listen binds the listener and serves SMB in the background.
+func (s *SMBServer) Listen() error {
+	// The GUID stays the same when the server listens again
+	if s.serverGUID == [16]byte{} {
+		if _, err := rand.Read(s.serverGUID[:]); err != nil {
+			return fmt.Errorf("failed to generate server GUID: %w", err)
+		}
 	}
 
 	addr := net.JoinHostPort(s.IP, strconv.Itoa(s.Port))
 	ln, err := net.Listen("tcp", addr)
 	if err != nil {
-		logger.Fatalf("SMB: failed to listen on %s: %v", addr, err)
+		return err
 	}
 	logger.Infof("SMB server listening on %s (\\\\%s\\%s) — hash capture active", addr, s.IP, s.ShareName)
 
-	for {
-		conn, err := ln.Accept()
-		if err != nil {
-			continue
-		}
-		go s.handleConn(conn)
-	}
+	s.conns.Serve(ln, s.handleConn)
+	return nil
+}
+
+// Shutdown closes the listener and waits for the open connections until
+// ctx is done.
+func (s *SMBServer) Shutdown(ctx context.Context) error {
+	return s.conns.Shutdown(ctx)
 }
 
 // ── Server-wide session management ─────────────────────────────────────────
@@ -147,6 +164,11 @@ func (s *SMBServer) handleConn(conn net.Conn) {
 		conn.Close()
 	}()
 
+	// A connection counts as one session, its SMB session IDs may outlive it
+	metrics.SessionsTotal.Inc("smb")
+	metrics.Sessions.Inc("smb")
+	defer metrics.Sessions.Dec("smb")
+
 	cs := newConnState()
 	cs.conn = conn
 	defer cs.closeAllHandles()
@@ -462,13 +484,14 @@ func (s *SMBServer) handleSessionSetup(cs *connState, h *smb2Hdr, buf []byte, re
 	// ── Pure anonymous: empty security blob ───────────────────────────────────
 	// Some clients (older smbclient, some fuse mounts) send zero bytes.
 	if len(secBlob) == 0 {
-		if s.Username != "" || s.Password != "" {
+		if s.authRequired() {
 			return errResp(h, STATUS_LOGON_FAILURE)
 		}
 		sess := s.getOrCreateSession(h.SessionID)
 		sess.mu.Lock()
 		sess.Authed = true
 		sess.Username = "anonymous"
+		sess.Account = users.Unrestricted
 		sess.mu.Unlock()
 		logger.Debugf("SMB: anonymous session (empty blob) from %s", remoteAddr)
 		resp := s.buildSessionSetupResp(h, h.SessionID, STATUS_SUCCESS, FinalToken(), SMB2_SESSION_FLAG_IS_GUEST)
@@ -602,13 +625,14 @@ func (s *SMBServer) handleSessionSetup(cs *connState, h *smb2Hdr, buf []byte, re
 		// Clients send this for anonymous access even after the full NTLM
 		// handshake (e.g. Nautilus with no credentials, smbclient with no -U).
 		if len(ntlmToken) < 24 || captured.Username == "" {
-			if s.Username != "" || s.Password != "" {
+			if s.authRequired() {
 				logger.Debugf("SMB: null session rejected (auth mode)")
 				return errResp(h, STATUS_LOGON_FAILURE)
 			}
 			sess.mu.Lock()
 			sess.Authed = true
 			sess.Username = "anonymous"
+			sess.Account = users.Unrestricted
 			sess.mu.Unlock()
 			logger.Debugf("SMB: null session accepted from %s", remoteAddr)
 			s.broadcastNTLMEvent(captured, remoteAddr, "")
@@ -657,10 +681,11 @@ func (s *SMBServer) handleSessionSetup(cs *connState, h *smb2Hdr, buf []byte, re
 		// ── Hash capture — always log/broadcast before any auth decision ──────
 		// Built-in list is ~100 candidates — always safe to run inline.
 		crackedPassword, _ := TryCrackDefault(captured)
+		metrics.CountHash("smb", crackedPassword)
 
 		s.broadcastNTLMEvent(captured, remoteAddr, crackedPassword)
-		logger.Infof("SMB: captured %s hash from %s\\%s at %s",
-			captured.Protocol, captured.Domain, captured.Username, remoteAddr)
+		logger.Access{Protocol: "smb", Client: remoteAddr, User: captured.Domain + "\\" + captured.Username, Event: "hash_capture", Method: string(captured.Protocol)}.
+			Infof("SMB: captured %s hash from %s\\%s at %s", captured.Protocol, captured.Domain, captured.Username, remoteAddr)
 		logger.Infof("SMB: hashcat (-m %s): %s", captured.HashcatMode, captured.HashcatLine)
 		if crackedPassword != "" {
 			logger.Infof("SMB: cracked %s\\%s — plaintext: %s", captured.Domain, captured.Username, crackedPassword)
@@ -669,10 +694,16 @@ func (s *SMBServer) handleSessionSetup(cs *connState, h *smb2Hdr, buf []byte, re
 		// File wordlist can be millions of entries — run in the background so the
 		// SESSION_SETUP response goes out immediately. If a match is found later
 		// it is logged and broadcast as a follow-up event.
-		if crackedPassword == "" && s.Wordlist != "" {
+		if s.Cracker != nil {
+			snap := *captured
+			s.Cracker.Submit(&snap, "smb", remoteAddr, crackedPassword, s.Wordlist, func(pw string) {
+				s.broadcastNTLMEvent(&snap, remoteAddr, pw)
+			})
+		} else if crackedPassword == "" && s.Wordlist != "" {
 			snap := *captured // copy; captured may be mutated after this goroutine starts
 			go func() {
 				if pw, ok := TryCrackFile(&snap, s.Wordlist); ok {
+					metrics.HashesCracked.Inc("smb")
 					logger.Infof("SMB: cracked %s\\%s — plaintext: %s (wordlist)", snap.Domain, snap.Username, pw)
 					s.broadcastNTLMEvent(&snap, remoteAddr, pw)
 				}
@@ -683,11 +714,27 @@ func (s *SMBServer) handleSessionSetup(cs *connState, h *smb2Hdr, buf []byte, re
 		// effectiveDomain tracks which domain string produced a valid response,
 		// so we use the same one when deriving the session signing key.
 		effectiveDomain := captured.Domain
-		if s.Username != "" || s.Password != "" {
+		username, password := s.credentials()
+		acct := users.Unrestricted
+		if s.Users != nil {
+			// Users file: NTLM is verified against the plaintext password of
+			// the account, so bcrypt hashed accounts cannot log in via SMB.
+			acct = s.Users.LookupFold(captured.Username)
+			if acct == nil {
+				logger.Debugf("SMB: unknown user %q", captured.Username)
+				return errResp(h, STATUS_LOGON_FAILURE)
+			}
+			var ok bool
+			if password, ok = acct.Plaintext(); !ok {
+				logger.Warnf("SMB: user %s has a bcrypt hash in the users file and cannot log in via SMB", acct.Name)
+				return errResp(h, STATUS_LOGON_FAILURE)
+			}
+		}
+		if s.authRequired() {
 			// Auth mode: check username and password.
 			// Do NOT check domain — clients send WORKGROUP, ".", or anything else.
-			if !strings.EqualFold(captured.Username, s.Username) {
-				logger.Debugf("SMB: username mismatch: got=%q expected=%q", captured.Username, s.Username)
+			if s.Users == nil && !strings.EqualFold(captured.Username, username) {
+				logger.Debugf("SMB: username mismatch: got=%q expected=%q", captured.Username, username)
 				return errResp(h, STATUS_LOGON_FAILURE)
 			}
 
@@ -695,15 +742,15 @@ func (s *SMBServer) handleSessionSetup(cs *connState, h *smb2Hdr, buf []byte, re
 			var verified bool
 			switch captured.Protocol {
 			case ProtoNTLMv1, ProtoNTLMv1ESS:
-				verified = NTLMv1Verify(captured, s.Password)
+				verified = NTLMv1Verify(captured, password)
 			default: // ProtoNTLMv2
 				// Many clients (smbclient, Windows local accounts) compute
 				// ResponseKeyNT with an empty UserDom. Try both domains.
-				verified = NTLMv2Verify(captured, s.Password)
+				verified = NTLMv2Verify(captured, password)
 				if !verified && captured.Domain != "" {
 					emptyCaptured := *captured
 					emptyCaptured.Domain = ""
-					verified = NTLMv2Verify(&emptyCaptured, s.Password)
+					verified = NTLMv2Verify(&emptyCaptured, password)
 					if verified {
 						effectiveDomain = ""
 					}
@@ -719,16 +766,16 @@ func (s *SMBServer) handleSessionSetup(cs *connState, h *smb2Hdr, buf []byte, re
 
 		// Derive SMB2 session signing key before locking so the lock is brief.
 		var signingKey []byte
-		if s.Password != "" {
+		if password != "" {
 			var err error
 			switch captured.Protocol {
 			case ProtoNTLMv2:
 				signingKey, err = DeriveNTLMv2SigningKey(
-					s.Password, captured.Username, effectiveDomain,
+					password, captured.Username, effectiveDomain,
 					captured.NTProofStr, captured.EncryptedRandomSessionKey,
 				)
 			case ProtoNTLMv1, ProtoNTLMv1ESS:
-				signingKey, err = DeriveNTLMv1SigningKey(s.Password, captured)
+				signingKey, err = DeriveNTLMv1SigningKey(password, captured)
 			}
 			if err == nil && len(signingKey) == 16 {
 				logger.Debugf("SMB: derived session signing key (%s) for user=%s", captured.Protocol, captured.Username)
@@ -742,6 +789,7 @@ func (s *SMBServer) handleSessionSetup(cs *connState, h *smb2Hdr, buf []byte, re
 		sess.Authed = true
 		sess.Username = captured.Username
 		sess.Domain = captured.Domain
+		sess.Account = acct
 		if len(signingKey) == 16 {
 			sess.SigningKey = signingKey
 		}
@@ -756,7 +804,7 @@ func (s *SMBServer) handleSessionSetup(cs *connState, h *smb2Hdr, buf []byte, re
 		// In auth mode (password verified) the signing key was derived above; use
 		// a normal (non-guest) session so signing works correctly.
 		sessFlags := uint16(0)
-		if s.Password == "" {
+		if password == "" {
 			sessFlags = SMB2_SESSION_FLAG_IS_GUEST
 		}
 		resp := s.buildSessionSetupResp(h, h.SessionID, STATUS_SUCCESS, spnegoFinal, sessFlags)
@@ -819,6 +867,7 @@ func (s *SMBServer) handleTreeConnect(cs *connState, h *smb2Hdr, buf []byte) []b
 	sess.mu.RLock()
 	authed := sess.Authed
 	username := sess.Username
+	root := sess.Account.Root(s.Root)
 	sess.mu.RUnlock()
 
 	logger.Debugf("TREE_CONNECT: session=%d user=%q authed=%v", h.SessionID, username, authed)
@@ -856,8 +905,8 @@ func (s *SMBServer) handleTreeConnect(cs *connState, h *smb2Hdr, buf []byte) []b
 	}
 
 	treeID := cs.newTreeID()
-	cs.addTree(&smbTree{ID: treeID, ShareName: s.ShareName, RootPath: s.Root})
-	logger.Infof("SMB: tree connected %s → %s (treeID=%d)", path, s.Root, treeID)
+	cs.addTree(&smbTree{ID: treeID, ShareName: s.ShareName, RootPath: root})
+	logger.Infof("SMB: tree connected %s → %s (treeID=%d)", path, root, treeID)
 	logger.Debugf("SMB: TREE_CONNECT: session=%d treeID=%d share=%q path=%s", h.SessionID, h.TreeID, shareName, path)
 
 	return s.buildTreeConnectResp(h, treeID, 1)
@@ -903,6 +952,7 @@ func (s *SMBServer) handleTreeDisconnect(cs *connState, h *smb2Hdr) []byte {
 // ── SMB2 Create ────────────────────────────────────────────────────────────
 
 func (s *SMBServer) handleCreate(cs *connState, h *smb2Hdr, buf []byte) []byte {
+	acc := s.access(h)
 	tree := cs.getTree(h.TreeID)
 	if tree == nil {
 		logger.Debugf("SMB: CREATE: invalid treeID=%d", h.TreeID)
@@ -1013,13 +1063,13 @@ func (s *SMBServer) handleCreate(cs *connState, h *smb2Hdr, buf []byte) []byte {
 	}
 
 	// READ-ONLY mode
-	if s.ReadOnly && (wantWrite || wantDelete) {
+	if acc.ReadOnly && (wantWrite || wantDelete) {
 		logger.Debugf("SMB: CREATE denied (read-only) %s", localPath)
 		return errResp(h, STATUS_ACCESS_DENIED)
 	}
 
 	// UPLOAD-ONLY mode
-	if s.UploadOnly {
+	if acc.UploadOnly {
 		// FILE_DELETE_ON_CLOSE explicitly requests deletion on close — block it.
 		// We do NOT block the DELETE access mask here: Windows opens directories
 		// with DELETE access when performing a rename (FileRenameInformation), and
@@ -1044,7 +1094,7 @@ func (s *SMBServer) handleCreate(cs *connState, h *smb2Hdr, buf []byte) []byte {
 	}
 
 	// NO-DELETE mode — same reasoning: block delete-on-close, not the DELETE mask.
-	if s.NoDelete && createOptions&FILE_DELETE_ON_CLOSE != 0 {
+	if acc.NoDelete && createOptions&FILE_DELETE_ON_CLOSE != 0 {
 		logger.Debugf("SMB: CREATE denied (no-delete, delete-on-close) %s", localPath)
 		return errResp(h, STATUS_ACCESS_DENIED)
 	}
@@ -1055,7 +1105,38 @@ func (s *SMBServer) handleCreate(cs *connState, h *smb2Hdr, buf []byte) []byte {
 
 	existing, statErr := os.Stat(localPath)
 
-	if s.ReadOnly {
+	// .goshs files: creating checks upload or mkdir, opening checks what the
+	// desired access allows; attribute-only opens just honour the block list
+	var methods []acl.Method
+	switch {
+	case statErr != nil && createDisp != FILE_OPEN:
+		methods = append(methods, acl.Upload)
+		if isDir {
+			methods[0] = acl.Mkdir
+		}
+	case isDir:
+		methods = append(methods, acl.List)
+	default:
+		if desiredAccess&FILE_READ_DATA != 0 {
+			methods = append(methods, acl.Read)
+		}
+		if wantWrite || createDisp == FILE_OVERWRITE || createDisp == FILE_OVERWRITE_IF || createDisp == FILE_SUPERSEDE {
+			methods = append(methods, acl.Upload)
+		}
+	}
+	if createOptions&FILE_DELETE_ON_CLOSE != 0 {
+		methods = append(methods, acl.Delete)
+	}
+	if len(methods) == 0 {
+		methods = append(methods, "")
+	}
+	for _, m := range methods {
+		if status := s.checkACL(cs, h, tree.RootPath, m, localPath, isDir); status != STATUS_SUCCESS {
+			return errResp(h, status)
+		}
+	}
+
+	if acc.ReadOnly {
 		switch createDisp {
 		case FILE_CREATE, FILE_OPEN_IF, FILE_OVERWRITE, FILE_OVERWRITE_IF, FILE_SUPERSEDE:
 			logger.Debugf("SMB: CREATE denied (read-only create/overwrite) %s", localPath)
@@ -1134,7 +1215,7 @@ func (s *SMBServer) handleCreate(cs *connState, h *smb2Hdr, buf []byte) []byte {
 	// Open file handle
 	if f == nil && !fi.IsDir() {
 		flags := os.O_RDONLY
-		if (wantWrite && !s.ReadOnly) || s.UploadOnly {
+		if (wantWrite && !acc.ReadOnly) || acc.UploadOnly {
 			flags = os.O_WRONLY
 		}
 		f, err = os.OpenFile(localPath, flags, 0644)
@@ -1148,7 +1229,7 @@ func (s *SMBServer) handleCreate(cs *connState, h *smb2Hdr, buf []byte) []byte {
 	}
 
 	hID := cs.newHandleID()
-	if s.ReadOnly && (createOptions&FILE_DELETE_ON_CLOSE != 0) {
+	if acc.ReadOnly && (createOptions&FILE_DELETE_ON_CLOSE != 0) {
 		return errResp(h, STATUS_ACCESS_DENIED)
 	}
 	handle := &smbHandle{
@@ -1237,7 +1318,7 @@ func (s *SMBServer) buildCreateResp(h *smb2Hdr, handle *smbHandle, fi os.FileInf
 	var ctxData []byte
 	inode := inodeNumber(fi)
 
-	maxAccess := s.maximalAccess(fi.IsDir())
+	maxAccess := s.maximalAccess(s.access(h), fi.IsDir())
 
 	switch {
 	case wantsMxAc && wantsQFid:
@@ -1298,20 +1379,69 @@ func buildQFidContext(inode uint64) []byte {
 	return ctx
 }
 
+// smbAccess is the operating mode applied to a session: the global options
+// combined with the role of its users file account.
+type smbAccess struct {
+	ReadOnly   bool
+	UploadOnly bool
+	NoDelete   bool
+}
+
+// authRequired reports whether sessions must present valid credentials.
+func (s *SMBServer) authRequired() bool {
+	username, password := s.credentials()
+	return username != "" || password != "" || s.Users != nil
+}
+
+// Reconfigure applies the options a config reload changes to the running
+// server: the credentials, read-only, upload-only and no-delete.
+func (s *SMBServer) Reconfigure(opts *options.Options) {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	s.Username = opts.Username
+	s.Password = opts.Password
+	s.ReadOnly = opts.ReadOnly
+	s.UploadOnly = opts.UploadOnly
+	s.NoDelete = opts.NoDelete
+}
+
+func (s *SMBServer) credentials() (string, string) {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.Username, s.Password
+}
+
+// access returns the operating mode for the session of h.
+func (s *SMBServer) access(h *smb2Hdr) smbAccess {
+	var acct *users.Account
+	if sess := s.getSession(h.SessionID); sess != nil {
+		sess.mu.RLock()
+		acct = sess.Account
+		sess.mu.RUnlock()
+	}
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return smbAccess{
+		ReadOnly:   s.ReadOnly || !acct.CanWrite(),
+		UploadOnly: s.UploadOnly || !acct.CanRead(),
+		NoDelete:   s.NoDelete || !acct.CanDelete(),
+	}
+}
+
 // maximalAccess returns the SMB2 MaximalAccess mask advertised in the MxAc
-// create context response, reflecting the server's current operating mode.
+// create context response, reflecting the operating mode of the session.
 //
 // isDir must be true when the handle refers to a directory. This matters for
 // upload-only mode: Windows uses the MxAc value to decide whether to attempt
 // a rename (FileRenameInformation requires DELETE access). Directories must
 // advertise DELETE so that the "New Folder → type name → Enter" flow works;
 // actual deletion is still blocked at the SetInfo/handleClose level.
-func (s *SMBServer) maximalAccess(isDir bool) uint32 {
+func (s *SMBServer) maximalAccess(acc smbAccess, isDir bool) uint32 {
 	switch {
-	case s.ReadOnly:
+	case acc.ReadOnly:
 		// Read + execute, no write or delete.
 		return 0x001200A9 // FILE_GENERIC_READ | FILE_EXECUTE
-	case s.UploadOnly:
+	case acc.UploadOnly:
 		if isDir {
 			// Full access for directories: Windows needs DELETE in MxAc to
 			// attempt rename. Deletion itself is blocked at the operation level.
@@ -1319,7 +1449,7 @@ func (s *SMBServer) maximalAccess(isDir bool) uint32 {
 		}
 		// Files: write-only, no read-data, no delete.
 		return 0x00120116 // FILE_GENERIC_WRITE (without DELETE)
-	case s.NoDelete:
+	case acc.NoDelete:
 		// Full access except DELETE (0x00010000).
 		return 0x001E01FF // FILE_ALL_ACCESS & ^DELETE
 	default:
@@ -1349,6 +1479,7 @@ func (s *SMBServer) buildPipeCreateResp(h *smb2Hdr, handle *smbHandle) []byte {
 const SMB2_CLOSE_FLAG_POSTQUERY_ATTRIB uint16 = 0x0001
 
 func (s *SMBServer) handleClose(cs *connState, h *smb2Hdr, buf []byte) []byte {
+	acc := s.access(h)
 	if len(buf) < 64+24 {
 		return errResp(h, STATUS_INVALID_PARAMETER)
 	}
@@ -1362,9 +1493,9 @@ func (s *SMBServer) handleClose(cs *connState, h *smb2Hdr, buf []byte) []byte {
 			handle.File.Close()
 		}
 		if handle.DeleteOnClose {
-			if s.UploadOnly || s.NoDelete {
+			if acc.UploadOnly || acc.NoDelete {
 				mode := "no-delete"
-				if s.UploadOnly {
+				if acc.UploadOnly {
 					mode = "upload-only"
 				}
 				logger.Debugf("SMB: delete denied (%s) %s", mode, handle.Path)
@@ -1435,6 +1566,7 @@ func (s *SMBServer) handleFlush(cs *connState, h *smb2Hdr) []byte {
 // ── SMB2 Read ──────────────────────────────────────────────────────────────
 
 func (s *SMBServer) handleRead(cs *connState, h *smb2Hdr, buf []byte) []byte {
+	acc := s.access(h)
 	if len(buf) < 64+48 {
 		return errResp(h, STATUS_INVALID_PARAMETER)
 	}
@@ -1486,7 +1618,7 @@ func (s *SMBServer) handleRead(cs *connState, h *smb2Hdr, buf []byte) []byte {
 	}
 
 	// Upload-only mode: file downloads are not permitted.
-	if s.UploadOnly {
+	if acc.UploadOnly {
 		logger.Debugf("SMB: READ denied (upload-only) %s", handle.Path)
 		return errResp(h, STATUS_ACCESS_DENIED)
 	}
@@ -1519,6 +1651,7 @@ func (s *SMBServer) handleRead(cs *connState, h *smb2Hdr, buf []byte) []byte {
 // ── SMB2 Write ─────────────────────────────────────────────────────────────
 
 func (s *SMBServer) handleWrite(cs *connState, h *smb2Hdr, buf []byte) []byte {
+	acc := s.access(h)
 	if len(buf) < 64+48 {
 		return errResp(h, STATUS_INVALID_PARAMETER)
 	}
@@ -1562,7 +1695,7 @@ func (s *SMBServer) handleWrite(cs *connState, h *smb2Hdr, buf []byte) []byte {
 		copy(resp[64:], respBody)
 		return resp
 	}
-	if s.ReadOnly {
+	if acc.ReadOnly {
 		return errResp(h, STATUS_ACCESS_DENIED)
 	}
 
@@ -1642,6 +1775,12 @@ func (s *SMBServer) handleQueryDir(cs *connState, h *smb2Hdr, buf []byte) []byte
 		outMax = 64 * 1024
 	}
 
+	// Hide names blocked by .goshs files
+	visible := func(string, bool) bool { return true }
+	if tree := cs.getTree(h.TreeID); tree != nil {
+		visible = s.ACL.Visible(tree.RootPath, handle.Path)
+	}
+
 	var outBuf []byte
 	prevOff := 0
 	count := 0
@@ -1673,7 +1812,7 @@ func (s *SMBServer) handleQueryDir(cs *connState, h *smb2Hdr, buf []byte) []byte
 		de := handle.DirEntries[handle.DirIndex]
 		handle.DirIndex++
 
-		if !matchPattern(handle.SearchPattern, de.Name()) {
+		if !matchPattern(handle.SearchPattern, de.Name()) || !visible(de.Name(), de.IsDir()) {
 			continue
 		}
 
@@ -2097,7 +2236,8 @@ func minimalSecurityDescriptor() []byte {
 // ── SMB2 SetInfo ───────────────────────────────────────────────────────────
 
 func (s *SMBServer) handleSetInfo(cs *connState, h *smb2Hdr, buf []byte) []byte {
-	if s.ReadOnly {
+	acc := s.access(h)
+	if acc.ReadOnly {
 		return errResp(h, STATUS_ACCESS_DENIED)
 	}
 	if len(buf) < 64+32 {
@@ -2157,10 +2297,15 @@ func (s *SMBServer) handleSetInfo(cs *connState, h *smb2Hdr, buf []byte) []byte
 
 		case FileDispositionInformation:
 			if len(infoBuf) >= 1 && infoBuf[0] != 0 {
-				if s.UploadOnly || s.NoDelete {
+				if acc.UploadOnly || acc.NoDelete {
 					logger.Debugf("SMB: SET_INFO FileDisposition denied (delete not allowed) %s", handle.Path)
 					return errResp(h, STATUS_ACCESS_DENIED)
 				}
+				if tree := cs.getTree(h.TreeID); tree != nil {
+					if status := s.checkACL(cs, h, tree.RootPath, acl.Delete, handle.Path, handle.IsDir); status != STATUS_SUCCESS {
+						return errResp(h, status)
+					}
+				}
 				if handle.IsDir {
 					entries, err := os.ReadDir(handle.Path)
 					if err != nil {
@@ -2177,7 +2322,7 @@ func (s *SMBServer) handleSetInfo(cs *connState, h *smb2Hdr, buf []byte) []byte
 			// In upload-only mode, only allow renaming items created in this session.
 			// Windows uses a fresh FILE_OPEN handle for the rename, so we check
 			// newlyCreatedPaths (path map) rather than the handle itself.
-			if s.UploadOnly {
+			if acc.UploadOnly {
 				if _, ok := s.newlyCreatedPaths.Load(handle.Path); !ok {
 					logger.Debugf("SMB: SET_INFO FileRename denied (upload-only, pre-existing item) %s", handle.Path)
 					return errResp(h, STATUS_ACCESS_DENIED)
@@ -2200,6 +2345,16 @@ func (s *SMBServer) handleSetInfo(cs *connState, h *smb2Hdr, buf []byte) []byte
 			if err != nil {
 				return errResp(h, STATUS_ACCESS_DENIED)
 			}
+			create := acl.Upload
+			if handle.IsDir {
+				create = acl.Mkdir
+			}
+			if status := s.checkACL(cs, h, tree.RootPath, acl.Delete, handle.Path, handle.IsDir); status != STATUS_SUCCESS {
+				return errResp(h, status)
+			}
+			if status := s.checkACL(cs, h, tree.RootPath, create, newPath, handle.IsDir); status != STATUS_SUCCESS {
+				return errResp(h, status)
+			}
 			oldPath := handle.Path
 			if err := os.Rename(oldPath, newPath); err != nil {
 				return errResp(h, STATUS_ACCESS_DENIED)
@@ -2587,6 +2742,19 @@ func (s *SMBServer) broadcastNTLMEvent(c *CapturedHash, source, crackedPassword
 			msg = fmt.Sprintf("%s\nCracked: %s", msg, crackedPassword)
 		}
 		msg = fmt.Sprintf("%s\n\n%s", msg, c.HashcatLine)
-		logger.HandleWebhookSend(msg, "smb", *s.WebHook)
+		e := webhook.NewEvent("smb", msg)
+		e.Remote = source
+		e.User = c.Username
+		e.Hashes = []string{c.HashcatLine}
+		e.Fields = map[string]string{
+			"domain":       c.Domain,
+			"workstation":  c.Workstation,
+			"hash_type":    hashType,
+			"hashcat_mode": hashcatMode,
+		}
+		if crackedPassword != "" {
+			e.Fields["password"] = crackedPassword
+		}
+		logger.HandleWebhookEvent(e, *s.WebHook)
 	}
 }
@@ -5,6 +5,8 @@ import (
 	"os"
 	"sync"
 	"sync/atomic"
+
+	"goshs.de/goshs/v2/users"
 )
 
 // smbSession tracks an authenticated (or anonymous) SMB2 session.
@@ -19,6 +21,7 @@ type smbSession struct {
 	Domain     string
 	Challenge  *NTLMChallenge // active challenge; nil after auth completes
 	SigningKey []byte         // 16-byte HMAC-SHA256 signing key; nil if not signing
+	Account    *users.Account // users.Unrestricted with -b or without auth, nil before auth
 }
 
 // smbTree tracks a connected SMB2 tree (share).
@@ -7,6 +7,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/acl"
+	"goshs.de/goshs/v2/users"
 )
 
 // ─── newConnState ─────────────────────────────────────────────────────────────
@@ -163,3 +165,50 @@ func TestFileIDFromBuf_TooShort(t *testing.T) {
 	// off+16 > len(buf), returns 0
 	require.Equal(t, uint64(0), fileIDFromBuf(buf, 0))
 }
+
+// ─── per-session access ───────────────────────────────────────────────────────
+
+func TestAccess_CombinesOptionsAndAccount(t *testing.T) {
+	s := &SMBServer{NoDelete: true}
+	h := &smb2Hdr{SessionID: 7}
+
+	// Unknown session and sessions without an account may do nothing
+	require.Equal(t, smbAccess{ReadOnly: true, UploadOnly: true, NoDelete: true}, s.access(h))
+	s.getOrCreateSession(7)
+	require.Equal(t, smbAccess{ReadOnly: true, UploadOnly: true, NoDelete: true}, s.access(h))
+
+	// -b and open mode use the global options
+	s.getSession(7).Account = users.Unrestricted
+	require.Equal(t, smbAccess{NoDelete: true}, s.access(h))
+
+	s.getSession(7).Account = &users.Account{Name: "bob", Role: users.RoleRead}
+	require.Equal(t, smbAccess{ReadOnly: true, NoDelete: true}, s.access(h))
+	require.Equal(t, uint32(0x001200A9), s.maximalAccess(s.access(h), false))
+
+	s.getSession(7).Account = &users.Account{Name: "up", Role: users.RoleUpload}
+	require.Equal(t, smbAccess{UploadOnly: true, NoDelete: true}, s.access(h))
+
+	s.NoDelete = false
+	s.getSession(7).Account = &users.Account{Name: "admin", Role: users.RoleAdmin}
+	require.Equal(t, smbAccess{}, s.access(h))
+	require.Equal(t, uint32(0x001F01FF), s.maximalAccess(s.access(h), true))
+}
+
+func TestCheckACL_SessionUser(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, acl.FileName), []byte(`{"block":["*.key"],"rules":[{"deny":["delete"],"users":["bob"]}]}`), 0644))
+	s := &SMBServer{Username: "bob", Password: "pw", ACL: acl.NewStore()}
+	cs := newConnState()
+	h := &smb2Hdr{SessionID: 7}
+	sess := s.getOrCreateSession(7)
+	sess.Authed = true
+	sess.Username = "bob"
+
+	file := filepath.Join(root, "a.txt")
+	require.Equal(t, STATUS_SUCCESS, s.checkACL(cs, h, root, acl.Read, file, false))
+	require.Equal(t, STATUS_ACCESS_DENIED, s.checkACL(cs, h, root, acl.Delete, file, false))
+	require.Equal(t, STATUS_OBJECT_NAME_NOT_FOUND, s.checkACL(cs, h, root, "", filepath.Join(root, "id.key"), false))
+
+	sess.Username = "alice"
+	require.Equal(t, STATUS_SUCCESS, s.checkACL(cs, h, root, acl.Delete, file, false))
+}
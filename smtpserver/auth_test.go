@@ -0,0 +1,270 @@
+package smtpserver
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/ca"
+	"goshs.de/goshs/v2/smbserver"
+	"goshs.de/goshs/v2/ws"
+)
+
+// ─── helpers ──────────────────────────────────────────────────────────────────
+
+func newAuthSession() (*Session, *ws.Hub) {
+	hub := &ws.Hub{Broadcast: make(chan []byte, 16)}
+	return &Session{hub: hub, realm: "CORP"}, hub
+}
+
+func credentialEvents(t *testing.T, hub *ws.Hub) []ws.CredentialEvent {
+	t.Helper()
+	var events []ws.CredentialEvent
+	for {
+		select {
+		case raw := <-hub.Broadcast:
+			var e ws.CredentialEvent
+			require.NoError(t, json.Unmarshal(raw, &e))
+			if e.Type == "credential" {
+				events = append(events, e)
+			}
+		default:
+			return events
+		}
+	}
+}
+
+func utf16le(s string) []byte {
+	runes := utf16.Encode([]rune(s))
+	buf := make([]byte, len(runes)*2)
+	for i, r := range runes {
+		binary.LittleEndian.PutUint16(buf[i*2:], r)
+	}
+	return buf
+}
+
+func buildNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(msg[8:], smbserver.NTLMSSP_NEGOTIATE)
+	binary.LittleEndian.PutUint32(msg[12:], 0x00088207)
+	return msg
+}
+
+// buildAuthMessage assembles a minimal NTLMv2 Type 3 message.
+func buildAuthMessage(username, domain, workstation string) []byte {
+	ntResp := make([]byte, 48)
+	for i := range ntResp {
+		ntResp[i] = byte(i)
+	}
+	fields := [][]byte{make([]byte, 24), ntResp, utf16le(domain), utf16le(username), utf16le(workstation), nil}
+
+	off := uint32(72)
+	msg := make([]byte, 72)
+	copy(msg, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(msg[8:], smbserver.NTLMSSP_AUTH)
+	for i, f := range fields {
+		hdr := 12 + i*8
+		binary.LittleEndian.PutUint16(msg[hdr:], uint16(len(f)))
+		binary.LittleEndian.PutUint16(msg[hdr+2:], uint16(len(f)))
+		binary.LittleEndian.PutUint32(msg[hdr+4:], off)
+		msg = append(msg, f...)
+		off += uint32(len(f))
+	}
+	return msg
+}
+
+// ─── mechanisms ───────────────────────────────────────────────────────────────
+
+func TestAuthMechanisms(t *testing.T) {
+	s := &Session{}
+	require.Equal(t, []string{"PLAIN", "LOGIN", "CRAM-MD5", "NTLM"}, s.AuthMechanisms())
+
+	_, err := s.Auth("GSSAPI")
+	require.Equal(t, smtp.ErrAuthUnknownMechanism, err)
+}
+
+func TestAuth_Plain(t *testing.T) {
+	s, hub := newAuthSession()
+	srv, err := s.Auth(sasl.Plain)
+	require.NoError(t, err)
+
+	_, done, err := srv.Next([]byte("\x00alice\x00Secret1"))
+	require.NoError(t, err)
+	require.True(t, done)
+
+	events := credentialEvents(t, hub)
+	require.Len(t, events, 1)
+	require.Equal(t, "smtp", events[0].Protocol)
+	require.Equal(t, "PLAIN", events[0].Mechanism)
+	require.Equal(t, "alice", events[0].Username)
+	require.Equal(t, "Secret1", events[0].Password)
+	require.False(t, events[0].TLS)
+}
+
+func TestAuth_Login(t *testing.T) {
+	s, hub := newAuthSession()
+	srv, err := s.Auth(sasl.Login)
+	require.NoError(t, err)
+
+	challenge, done, err := srv.Next(nil)
+	require.NoError(t, err)
+	require.False(t, done)
+	require.Equal(t, "Username:", string(challenge))
+
+	challenge, done, err = srv.Next([]byte("bob"))
+	require.NoError(t, err)
+	require.False(t, done)
+	require.Equal(t, "Password:", string(challenge))
+
+	_, done, err = srv.Next([]byte("hunter2"))
+	require.NoError(t, err)
+	require.True(t, done)
+
+	events := credentialEvents(t, hub)
+	require.Len(t, events, 1)
+	require.Equal(t, "LOGIN", events[0].Mechanism)
+	require.Equal(t, "bob", events[0].Username)
+	require.Equal(t, "hunter2", events[0].Password)
+}
+
+func TestAuth_LoginInitialResponse(t *testing.T) {
+	s, hub := newAuthSession()
+	srv, _ := s.Auth(sasl.Login)
+
+	challenge, done, err := srv.Next([]byte("bob"))
+	require.NoError(t, err)
+	require.False(t, done)
+	require.Equal(t, "Password:", string(challenge))
+
+	_, done, err = srv.Next([]byte("hunter2"))
+	require.NoError(t, err)
+	require.True(t, done)
+	require.Equal(t, "bob", credentialEvents(t, hub)[0].Username)
+}
+
+func TestAuth_CramMD5(t *testing.T) {
+	s, hub := newAuthSession()
+	srv, err := s.Auth("CRAM-MD5")
+	require.NoError(t, err)
+
+	challenge, done, err := srv.Next(nil)
+	require.NoError(t, err)
+	require.False(t, done)
+	require.True(t, strings.HasPrefix(string(challenge), "<"))
+	require.True(t, strings.HasSuffix(string(challenge), "@goshs>"))
+
+	mac := hmac.New(md5.New, []byte("tanstaaftanstaaf"))
+	mac.Write(challenge)
+	response := "carol " + hex.EncodeToString(mac.Sum(nil))
+
+	_, done, err = srv.Next([]byte(response))
+	require.NoError(t, err)
+	require.True(t, done)
+
+	events := credentialEvents(t, hub)
+	require.Len(t, events, 1)
+	require.Equal(t, "CRAM-MD5", events[0].Mechanism)
+	require.Equal(t, "carol", events[0].Username)
+	require.Empty(t, events[0].Password)
+	require.Equal(t, "10200", events[0].HashcatMode)
+	require.Equal(t, "$cram_md5$"+base64.StdEncoding.EncodeToString(challenge)+"$"+base64.StdEncoding.EncodeToString([]byte(response)), events[0].Hash)
+}
+
+func TestAuth_CramMD5Malformed(t *testing.T) {
+	s, hub := newAuthSession()
+	srv, _ := s.Auth("CRAM-MD5")
+	_, _, _ = srv.Next(nil)
+
+	_, _, err := srv.Next([]byte("carol"))
+	require.Error(t, err)
+	require.Empty(t, credentialEvents(t, hub))
+}
+
+func TestAuth_NTLM(t *testing.T) {
+	s, hub := newAuthSession()
+	srv, err := s.Auth("NTLM")
+	require.NoError(t, err)
+
+	challenge, done, err := srv.Next(nil)
+	require.NoError(t, err)
+	require.False(t, done)
+	require.Empty(t, challenge)
+
+	challenge, done, err = srv.Next(buildNegotiateMessage())
+	require.NoError(t, err)
+	require.False(t, done)
+	require.Equal(t, "NTLMSSP\x00", string(challenge[:8]))
+	require.Equal(t, smbserver.NTLMSSP_CHALLENGE, binary.LittleEndian.Uint32(challenge[8:12]))
+
+	_, done, err = srv.Next(buildAuthMessage("dave", "CORP", "WS01"))
+	require.NoError(t, err)
+	require.True(t, done)
+
+	events := credentialEvents(t, hub)
+	require.Len(t, events, 1)
+	require.Equal(t, "NTLM", events[0].Mechanism)
+	require.Equal(t, `CORP\dave`, events[0].Username)
+	require.Equal(t, "5600", events[0].HashcatMode)
+	require.True(t, strings.HasPrefix(events[0].Hash, "dave::CORP:"))
+}
+
+func TestAuth_NTLMAuthWithoutChallenge(t *testing.T) {
+	s, hub := newAuthSession()
+	srv, _ := s.Auth("NTLM")
+
+	_, _, err := srv.Next(buildAuthMessage("dave", "CORP", "WS01"))
+	require.Error(t, err)
+	require.Empty(t, credentialEvents(t, hub))
+}
+
+// ─── end to end ───────────────────────────────────────────────────────────────
+
+func TestSTARTTLS_CapturesAuth(t *testing.T) {
+	tlsConf, _, _, err := ca.Setup()
+	require.NoError(t, err)
+
+	hub := &ws.Hub{Broadcast: make(chan []byte, 16)}
+	srv := &SMTPServer{Hub: hub, Realm: "GOSHS", tlsConfig: tlsConf}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := srv.newServer(ln.Addr().String())
+	go func() { _ = s.Serve(ln) }()
+	t.Cleanup(func() { _ = s.Close() })
+
+	c, err := smtp.DialStartTLS(ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer c.Close()
+
+	ok, mechs := c.Extension("AUTH")
+	require.True(t, ok)
+	require.Contains(t, mechs, "CRAM-MD5")
+	require.NoError(t, c.Auth(sasl.NewLoginClient("erin", "pa55word")))
+	require.NoError(t, c.Quit())
+
+	events := credentialEvents(t, hub)
+	require.Len(t, events, 1)
+	require.Equal(t, "LOGIN", events[0].Mechanism)
+	require.Equal(t, "erin", events[0].Username)
+	require.Equal(t, "pa55word", events[0].Password)
+	require.True(t, events[0].TLS)
+	require.NotEmpty(t, events[0].Source)
+}
+
+func TestBuildTLSConfig_InvalidCert(t *testing.T) {
+	srv := &SMTPServer{MyCert: "/nonexistent.crt", MyKey: "/nonexistent.key"}
+	_, err := srv.buildTLSConfig()
+	require.Error(t, err)
+}
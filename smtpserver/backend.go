@@ -2,6 +2,8 @@ package smtpserver
 
 import (
 	"github.com/emersion/go-smtp"
+	"goshs.de/goshs/v2/mailstore"
+	"goshs.de/goshs/v2/smbserver"
 	"goshs.de/goshs/v2/webhook"
 	"goshs.de/goshs/v2/ws"
 )
@@ -10,8 +12,12 @@ type Backend struct {
 	Hub     *ws.Hub
 	WebHook *webhook.Webhook
 	Domain  string
+	Realm   string // NTLM target name
+	Cracker *smbserver.Cracker
+	Mailbox *mailstore.Store
+	Forward mailstore.Forwarder
 }
 
 func (b *Backend) NewSession(c *smtp.Conn) (smtp.Session, error) {
-	return &Session{hub: b.Hub, conn: c, webhook: b.WebHook, domain: b.Domain}, nil
+	return &Session{hub: b.Hub, conn: c, webhook: b.WebHook, domain: b.Domain, realm: b.Realm, cracker: b.Cracker, mailbox: b.Mailbox, forward: b.Forward}, nil
 }
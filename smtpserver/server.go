@@ -1,48 +1,150 @@
 package smtpserver
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"net"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/emersion/go-smtp"
+	"goshs.de/goshs/v2/ca"
 	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/mailstore"
 	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/smbserver"
 	"goshs.de/goshs/v2/smtpattach"
 	"goshs.de/goshs/v2/webhook"
 	"goshs.de/goshs/v2/ws"
 )
 
 type SMTPServer struct {
-	IP      string
-	Port    int
-	Hub     *ws.Hub
-	WebHook *webhook.Webhook
-	Domain  string
+	IP        string
+	Port      int
+	TLSPort   int // SMTPS (implicit TLS), 0 disables
+	Hub       *ws.Hub
+	WebHook   *webhook.Webhook
+	Domain    string
+	Realm     string
+	MyCert    string
+	MyKey     string
+	Cracker   *smbserver.Cracker
+	Mailbox   *mailstore.Store    // persists every message as .eml
+	Forward   mailstore.Forwarder // optional local mbox/Maildir copy
+	tlsConfig *tls.Config
+
+	mu        sync.Mutex
+	listening []listener
+	purge     sync.Once // of the cached attachments, running once for all starts
+}
+
+// listener is SMTP or SMTPS while listening.
+type listener struct {
+	server *smtp.Server
+	ln     net.Listener
 }
 
 func NewSMTP(opts *options.Options, hub *ws.Hub, wh *webhook.Webhook) *SMTPServer {
+	realm := strings.ToUpper(opts.SMBDomain)
+	if realm == "" {
+		realm = "GOSHS"
+	}
 	return &SMTPServer{
 		IP:      opts.IP,
 		Port:    opts.SMTPPort,
+		TLSPort: opts.SMTPSPort,
 		Domain:  opts.SMTPDomain,
+		Realm:   realm,
+		MyCert:  opts.MyCert,
+		MyKey:   opts.MyKey,
 		Hub:     hub,
 		WebHook: wh,
 	}
 }
 
-func (srv *SMTPServer) Start() {
-	be := &Backend{Hub: srv.Hub, WebHook: srv.WebHook}
+// buildTLSConfig uses the goshs certificate when one is given and falls back
+// to a certificate issued by the self-signed CA otherwise.
+func (srv *SMTPServer) buildTLSConfig() (*tls.Config, error) {
+	return ca.ServiceTLSConfig(srv.MyCert, srv.MyKey)
+}
+
+func (srv *SMTPServer) newServer(addr string) *smtp.Server {
+	be := &Backend{Hub: srv.Hub, WebHook: srv.WebHook, Domain: srv.Domain, Realm: srv.Realm, Cracker: srv.Cracker, Mailbox: srv.Mailbox, Forward: srv.Forward}
 	s := smtp.NewServer(be)
-	addr := net.JoinHostPort(srv.IP, strconv.Itoa(srv.Port))
 	s.Addr = addr
 	s.Domain = "goshs"
-	s.AllowInsecureAuth = true // catch-all, no real auth needed
+	s.AllowInsecureAuth = true  // catch-all, capture AUTH in plaintext as well
+	s.TLSConfig = srv.tlsConfig // advertises STARTTLS
+	return s
+}
+
+// Listen binds SMTP and, with a certificate, SMTPS and serves them in the
+// background.
+func (srv *SMTPServer) Listen() error {
+	tlsConf, err := srv.buildTLSConfig()
+	if err != nil {
+		logger.Warnf("SMTP TLS setup failed, STARTTLS and SMTPS disabled: %v", err)
+	}
+	srv.tlsConfig = tlsConf
+
+	addr := net.JoinHostPort(srv.IP, strconv.Itoa(srv.Port))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	listening := []listener{{srv.newServer(addr), ln}}
 	if srv.Domain != "" {
 		logger.Infof("SMTP catch-all listening on %s (restricting to @%s)", addr, srv.Domain)
 	} else {
 		logger.Infof("SMTP catch-all listening on %s (open relay)", addr)
 	}
-	go func() { _ = s.ListenAndServe() }()
-	go smtpattach.PurgeLoop(1 * time.Hour)
+	if srv.Mailbox != nil {
+		logger.Infof("SMTP storing mail in %s", srv.Mailbox.Dir())
+	}
+	if srv.Forward != nil {
+		logger.Infof("SMTP forwarding mail to %s", srv.Forward)
+	}
+
+	if srv.tlsConfig != nil && srv.TLSPort > 0 {
+		tlsAddr := net.JoinHostPort(srv.IP, strconv.Itoa(srv.TLSPort))
+		if tln, err := tls.Listen("tcp", tlsAddr, srv.tlsConfig); err != nil {
+			logger.Errorf("SMTPS server error: %v", err)
+		} else {
+			listening = append(listening, listener{srv.newServer(tlsAddr), tln})
+			logger.Infof("SMTPS catch-all listening on %s", tlsAddr)
+		}
+	}
+
+	srv.mu.Lock()
+	srv.listening = listening
+	srv.mu.Unlock()
+	for _, l := range listening {
+		go func() { _ = l.server.Serve(l.ln) }()
+	}
+
+	srv.purge.Do(func() { go smtpattach.PurgeLoop(1 * time.Hour) })
+	return nil
+}
+
+// Shutdown closes the listeners and waits for the open sessions until ctx
+// is done, the remaining ones are closed then.
+func (srv *SMTPServer) Shutdown(ctx context.Context) error {
+	srv.mu.Lock()
+	listening := srv.listening
+	srv.listening = nil
+	srv.mu.Unlock()
+
+	var errs []error
+	for _, l := range listening {
+		// Serve might not have taken the listener yet
+		_ = l.ln.Close()
+		if err := l.server.Shutdown(ctx); err != nil && !errors.Is(err, net.ErrClosed) {
+			_ = l.server.Close()
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
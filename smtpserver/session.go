@@ -15,9 +15,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/emersion/go-sasl"
 	"github.com/emersion/go-smtp"
 	"github.com/google/uuid"
 	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/mailstore"
+	"goshs.de/goshs/v2/metrics"
+	"goshs.de/goshs/v2/smbserver"
 	"goshs.de/goshs/v2/smtpattach"
 	"goshs.de/goshs/v2/webhook"
 	"goshs.de/goshs/v2/ws"
@@ -30,9 +34,17 @@ type Session struct {
 	from    string
 	to      []string
 	domain  string
+	realm   string
+	cracker *smbserver.Cracker
+	mailbox *mailstore.Store
+	forward mailstore.Forwarder
 }
 
-func (s *Session) AuthPlain(user, pass string) error { return nil } // accept all
+// AuthPlain records the credentials and accepts them.
+func (s *Session) AuthPlain(user, pass string) error {
+	s.captureCredential(sasl.Plain, user, pass, "", "")
+	return nil
+}
 
 func (s *Session) Mail(from string, _ *smtp.MailOptions) error {
 	s.from = from
@@ -60,38 +72,28 @@ func (s *Session) Data(r io.Reader) error {
 	if err != nil {
 		return err
 	}
-	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	event, err := ParseMessage(raw)
 	if err != nil {
 		return err
 	}
-
-	var (
-		plainBody   string
-		htmlBody    string
-		attachments []ws.SMTPAttachment
-	)
-
-	// Convert mail.Header to textproto.MIMEHeader (same underlying type)
-	topHeader := textproto.MIMEHeader(msg.Header)
-	walkPart(topHeader, msg.Body, &plainBody, &htmlBody, &attachments)
-
-	// Collect CC/BCC from headers
-	cc := parseAddressList(msg.Header.Get("Cc"))
-	bcc := parseAddressList(msg.Header.Get("Bcc"))
-
-	event := ws.SMTPEvent{
-		Type:        "smtp",
-		From:        s.from,
-		To:          s.to,
-		CC:          cc,
-		BCC:         bcc,
-		Subject:     msg.Header.Get("Subject"),
-		Body:        plainBody,
-		HTMLBody:    htmlBody,
-		RawHeader:   fmt.Sprintf("%v", msg.Header),
-		Attachments: attachments,
-		Timestamp:   time.Now(),
+	event.From = s.from
+	event.To = s.to
+	metrics.SMTPMessages.Inc()
+
+	if s.mailbox != nil {
+		m, err := s.mailbox.Save(s.from, s.to, raw)
+		if err != nil {
+			logger.Errorf("Error storing mail: %v", err)
+		} else {
+			event.ID = m.ID
+		}
 	}
+	if s.forward != nil {
+		if err := s.forward.Deliver(s.from, raw); err != nil {
+			logger.Errorf("Error forwarding mail to %s: %v", s.forward, err)
+		}
+	}
+
 	eventBytes, err := json.Marshal(event)
 	if err != nil {
 		logger.Errorf("Error marshalling dns query event: %v", err)
@@ -113,13 +115,50 @@ RawBody:
 %s
 
 HTMLBody:
-%s`, s.from, s.to, cc, bcc, msg.Header.Get("Subject"), len(attachments), plainBody, htmlBody)
+%s`, s.from, s.to, event.CC, event.BCC, event.Subject, len(event.Attachments), event.Body, event.HTMLBody)
 
 	logger.HandleWebhookSend(smtpWHMessage, "smtp", *s.webhook)
 
 	return nil
 }
 
+// ParseMessage parses a raw RFC 822 message into an SMTPEvent. Attachments
+// are put into the smtpattach store so they can be downloaded via ?smtp&id=.
+// The envelope (From, To) is left to the caller.
+func ParseMessage(raw []byte) (*ws.SMTPEvent, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		plainBody   string
+		htmlBody    string
+		attachments []ws.SMTPAttachment
+	)
+
+	// Convert mail.Header to textproto.MIMEHeader (same underlying type)
+	topHeader := textproto.MIMEHeader(msg.Header)
+	walkPart(topHeader, msg.Body, &plainBody, &htmlBody, &attachments)
+
+	// Collect CC/BCC from headers
+	cc := parseAddressList(msg.Header.Get("Cc"))
+	bcc := parseAddressList(msg.Header.Get("Bcc"))
+
+	event := &ws.SMTPEvent{
+		Type:        "smtp",
+		CC:          cc,
+		BCC:         bcc,
+		Subject:     msg.Header.Get("Subject"),
+		Body:        plainBody,
+		HTMLBody:    htmlBody,
+		RawHeader:   fmt.Sprintf("%v", msg.Header),
+		Attachments: attachments,
+		Timestamp:   time.Now(),
+	}
+	return event, nil
+}
+
 func walkPart(header textproto.MIMEHeader, body io.Reader, plain, html *string, attachments *[]ws.SMTPAttachment) {
 	ct := header.Get("Content-Type")
 	if ct == "" {
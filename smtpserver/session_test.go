@@ -3,11 +3,16 @@ package smtpserver
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"net/textproto"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"goshs.de/goshs/v2/mailstore"
+	"goshs.de/goshs/v2/webhook"
 	"goshs.de/goshs/v2/ws"
 )
 
@@ -227,3 +232,38 @@ func TestWalkPart_Attachment(t *testing.T) {
 	require.Len(t, atts, 1)
 	require.Equal(t, "doc.pdf", atts[0].Filename)
 }
+
+// ─── mail store ───────────────────────────────────────────────────────────────
+
+func TestData_StoresAndForwards(t *testing.T) {
+	mb, err := mailstore.Open(t.TempDir())
+	require.NoError(t, err)
+	mboxPath := filepath.Join(t.TempDir(), "goshs.mbox")
+
+	hub := &ws.Hub{Broadcast: make(chan []byte, 4)}
+	s := &Session{
+		hub:     hub,
+		webhook: webhook.Register(false, "", "discord", []string{}),
+		from:    "sender@example.com",
+		to:      []string{"rcpt@example.com"},
+		mailbox: mb,
+		forward: &mailstore.Mbox{Path: mboxPath},
+	}
+
+	msg := "From: sender@example.com\r\nTo: rcpt@example.com\r\nSubject: Stored\r\n\r\nHello\r\n"
+	require.NoError(t, s.Data(strings.NewReader(msg)))
+
+	var event ws.SMTPEvent
+	require.NoError(t, json.Unmarshal(<-hub.Broadcast, &event))
+	require.NotEmpty(t, event.ID)
+	require.Equal(t, "Stored", event.Subject)
+
+	msgs, err := mb.List("rcpt@example.com")
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, event.ID, msgs[0].ID)
+
+	mbox, err := os.ReadFile(mboxPath)
+	require.NoError(t, err)
+	require.Contains(t, string(mbox), "Subject: Stored")
+}
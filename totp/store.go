@@ -0,0 +1,135 @@
+package totp
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store is the secrets file, one
+//
+//	name:secret
+//
+// per line. Names match exactly like in the users file; the empty name
+// belongs to a -b credential without user. Enrolment rewrites the file with
+// mode 0600.
+type Store struct {
+	path string
+
+	mu      sync.Mutex
+	secrets map[string]string // keyed by name
+	used    map[string]int64  // last accepted time step per name
+}
+
+// Load reads the secrets file at path. A missing file is an empty store and
+// is created on the first enrolment.
+func Load(path string) (*Store, error) {
+	s := &Store{path: path, secrets: map[string]string{}, used: map[string]int64{}}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, secret, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s: line %d: expected name:secret", path, n)
+		}
+		if _, err := decode(secret); err != nil || secret == "" {
+			return nil, fmt.Errorf("%s: line %d: invalid secret", path, n)
+		}
+		s.secrets[name] = secret
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Enrolled reports whether name has a secret.
+func (s *Store) Enrolled(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.secrets[name]
+	return ok
+}
+
+// Verify checks code for name at t. Every time step is accepted only once,
+// so an observed code cannot be replayed.
+func (s *Store) Verify(name, code string, t time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secret, ok := s.secrets[name]
+	if !ok {
+		return false
+	}
+	step, ok := Validate(secret, code, t)
+	if !ok || step <= s.used[name] {
+		return false
+	}
+	s.used[name] = step
+	return true
+}
+
+// Enroll stores secret for name and rewrites the file. It fails if name is
+// enrolled already, so a second login cannot replace the secret.
+func (s *Store) Enroll(name, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.secrets[name]; ok {
+		return fmt.Errorf("%q is enrolled already", name)
+	}
+	s.secrets[name] = secret
+	if err := s.write(); err != nil {
+		delete(s.secrets, name)
+		return err
+	}
+	return nil
+}
+
+// write replaces the file atomically.
+func (s *Store) write() error {
+	names := make([]string, 0, len(s.secrets))
+	for name := range s.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("# goshs TOTP secrets - name:secret\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s:%s\n", name, s.secrets[name])
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".goshs-totp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
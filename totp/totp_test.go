@@ -0,0 +1,102 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode_RFC6238(t *testing.T) {
+	// Last six digits of the eight digit vectors in RFC 6238 appendix B
+	for unix, want := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		got, err := Code(rfcSecret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		require.Equal(t, want, got, "t=%d", unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := NewSecret()
+	require.NoError(t, err)
+	now := time.Unix(1_700_000_000, 0)
+
+	c, err := Code(secret, now)
+	require.NoError(t, err)
+	step, ok := Validate(secret, c, now)
+	require.True(t, ok)
+	require.Equal(t, now.Unix()/30, step)
+
+	// One period of drift is tolerated, two are not
+	_, ok = Validate(secret, c, now.Add(Period))
+	require.True(t, ok)
+	_, ok = Validate(secret, c, now.Add(2*Period))
+	require.False(t, ok)
+
+	_, ok = Validate(secret, "12345", now)
+	require.False(t, ok)
+	_, ok = Validate("not base32!", c, now)
+	require.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("goshs", "alice@example.com", "ABC"))
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", u.Scheme)
+	require.Equal(t, "totp", u.Host)
+	require.Equal(t, "/goshs:alice@example.com", u.Path)
+	require.Equal(t, "ABC", u.Query().Get("secret"))
+	require.Equal(t, "goshs", u.Query().Get("issuer"))
+}
+
+func TestStore(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "totp")
+	s, err := Load(p)
+	require.NoError(t, err)
+	require.False(t, s.Enrolled("alice"))
+
+	require.NoError(t, s.Enroll("alice", rfcSecret))
+	require.Error(t, s.Enroll("alice", rfcSecret))
+	fi, err := os.Stat(p)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	// Secrets survive a restart
+	s, err = Load(p)
+	require.NoError(t, err)
+	require.True(t, s.Enrolled("alice"))
+	require.False(t, s.Enrolled("Alice"))
+
+	now := time.Unix(1111111109, 0)
+	require.False(t, s.Verify("alice", "000000", now))
+	require.True(t, s.Verify("alice", "081804", now))
+	// The same code is not accepted twice
+	require.False(t, s.Verify("alice", "081804", now))
+	require.False(t, s.Verify("bob", "081804", now))
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "totp")
+	require.NoError(t, os.WriteFile(p, []byte("alice\n"), 0o600))
+	_, err := Load(p)
+	require.ErrorContains(t, err, "line 1")
+
+	require.NoError(t, os.WriteFile(p, []byte("# comment\nalice:"+strings.Repeat("1", 16)+"\n"), 0o600))
+	_, err = Load(p)
+	require.ErrorContains(t, err, "line 2")
+}
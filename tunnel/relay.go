@@ -0,0 +1,538 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	"goshs.de/goshs/v2/config"
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/service"
+)
+
+// Relay is the SSH server goshs clients open their tunnels on instead of
+// localhost.run. A forward of port 80 gets a subdomain of Domain, served on
+// HTTPPort. Every other forward, and port 80 without a Domain, gets a port
+// of PortMin-PortMax.
+type Relay struct {
+	IP             string
+	Port           int
+	HTTPPort       int
+	Domain         string
+	PortMin        int
+	PortMax        int
+	AuthorizedKeys string
+	HostKeyFile    string // "" keeps the key in the config directory
+
+	mu         sync.Mutex
+	server     *ssh.Server
+	http       *http.Server
+	subdomains map[string]*forward
+	ports      map[int]*forward
+}
+
+// RelayTunnel is a tunnel open on the relay.
+type RelayTunnel struct {
+	URL    string    `json:"url"`
+	User   string    `json:"user"`
+	Remote string    `json:"remote"`
+	Since  time.Time `json:"since"`
+}
+
+// forward is a tcpip-forward request a client made on the relay.
+type forward struct {
+	conn      *gossh.ServerConn
+	user      string
+	bindAddr  string
+	bindPort  uint32
+	port      int
+	subdomain string
+	url       string
+	since     time.Time
+	proxy     *httputil.ReverseProxy // of a subdomain
+	conns     service.Conns          // of a port
+}
+
+func NewRelay(opts *options.Options) *Relay {
+	// Validated in sanity checks
+	low, high, _ := ParsePortRange(opts.RelayPorts)
+	return &Relay{
+		IP:             opts.IP,
+		Port:           opts.RelayPort,
+		HTTPPort:       opts.RelayHTTPPort,
+		Domain:         strings.ToLower(opts.RelayDomain),
+		PortMin:        low,
+		PortMax:        high,
+		AuthorizedKeys: opts.RelayKeys,
+		HostKeyFile:    opts.RelayHostKey,
+	}
+}
+
+// ParsePortRange parses a port range like 20000-20099, "" is no range.
+func ParsePortRange(s string) (int, int, error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	first, last, _ := strings.Cut(s, "-")
+	low, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q", s)
+	}
+	high := low
+	if last != "" {
+		if high, err = strconv.Atoi(strings.TrimSpace(last)); err != nil {
+			return 0, 0, fmt.Errorf("invalid port range %q", s)
+		}
+	}
+	if low < 1 || high > 65535 || low > high {
+		return 0, 0, fmt.Errorf("invalid port range %q", s)
+	}
+	return low, high, nil
+}
+
+// Listen binds the SSH listener and, with a domain, the HTTP listener of
+// the subdomains and serves them in the background.
+func (r *Relay) Listen() error {
+	keys, err := loadAuthorizedKeys(r.AuthorizedKeys)
+	if err != nil {
+		return err
+	}
+	signer, err := r.hostKey()
+	if err != nil {
+		return err
+	}
+
+	server := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			_, _ = io.WriteString(s, "This server only accepts reverse tunnels.\n")
+			_ = s.Exit(1)
+		},
+		HostSigners: []ssh.Signer{signer},
+		PublicKeyHandler: func(ctx ssh.Context, key ssh.PublicKey) bool {
+			return keys[string(key.Marshal())]
+		},
+		RequestHandlers: map[string]ssh.RequestHandler{
+			"tcpip-forward":        r.handleForward,
+			"cancel-tcpip-forward": r.handleCancel,
+		},
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(r.IP, strconv.Itoa(r.Port)))
+	if err != nil {
+		return err
+	}
+
+	var httpServer *http.Server
+	if r.Domain != "" && r.HTTPPort != 0 {
+		httpLn, err := net.Listen("tcp", net.JoinHostPort(r.IP, strconv.Itoa(r.HTTPPort)))
+		if err != nil {
+			_ = ln.Close()
+			return err
+		}
+		httpServer = &http.Server{
+			Handler:           r,
+			ReadHeaderTimeout: 10 * time.Second, // Mitigate Slow Loris Attack
+			ErrorLog:          log.New(io.Discard, "", 0),
+		}
+		go func() {
+			if err := httpServer.Serve(httpLn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Errorf("error serving relay subdomains: %+v", err)
+			}
+		}()
+		logger.Infof("[RELAY] Serving subdomains of %s on port %d", r.Domain, r.HTTPPort)
+	}
+
+	r.mu.Lock()
+	r.server, r.http = server, httpServer
+	r.subdomains, r.ports = map[string]*forward{}, map[int]*forward{}
+	r.mu.Unlock()
+
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
+			logger.Errorf("error serving relay: %+v", err)
+		}
+	}()
+	logger.Infof("[RELAY] Pin the host key on the clients with -tunnel-host-key %s", gossh.FingerprintSHA256(signer.PublicKey()))
+	return nil
+}
+
+// Shutdown closes the tunnels and the connections of the clients. They are
+// open as long as their tunnels, so there is nothing to wait for.
+func (r *Relay) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	server, httpServer := r.server, r.http
+	forwards := make([]*forward, 0, len(r.subdomains)+len(r.ports))
+	for _, f := range r.subdomains {
+		forwards = append(forwards, f)
+	}
+	for _, f := range r.ports {
+		forwards = append(forwards, f)
+	}
+	r.mu.Unlock()
+
+	for _, f := range forwards {
+		r.close(f)
+	}
+
+	var errs []error
+	if httpServer != nil {
+		if err := httpServer.Shutdown(ctx); err != nil {
+			_ = httpServer.Close()
+			errs = append(errs, err)
+		}
+	}
+	if server != nil {
+		if err := server.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Tunnels returns the open tunnels, the oldest first.
+func (r *Relay) Tunnels() []RelayTunnel {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var list []RelayTunnel
+	for _, f := range r.subdomains {
+		list = append(list, f.info())
+	}
+	for _, f := range r.ports {
+		list = append(list, f.info())
+	}
+	slices.SortFunc(list, func(a, b RelayTunnel) int { return a.Since.Compare(b.Since) })
+	return list
+}
+
+// ServeHTTP passes requests for a subdomain through its tunnel.
+func (r *Relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	sub, ok := strings.CutSuffix(strings.ToLower(host), "."+r.Domain)
+
+	r.mu.Lock()
+	f := r.subdomains[sub]
+	r.mu.Unlock()
+	if !ok || f == nil {
+		http.Error(w, "no tunnel for "+host, http.StatusNotFound)
+		return
+	}
+	f.proxy.ServeHTTP(w, req)
+}
+
+func (r *Relay) handleForward(ctx ssh.Context, _ *ssh.Server, req *gossh.Request) (bool, []byte) {
+	var payload forwardRequest
+	if err := gossh.Unmarshal(req.Payload, &payload); err != nil {
+		return false, nil
+	}
+	conn, ok := ctx.Value(ssh.ContextKeyConn).(*gossh.ServerConn)
+	if !ok {
+		return false, nil
+	}
+
+	f := &forward{
+		conn:     conn,
+		user:     ctx.User(),
+		bindAddr: payload.BindAddr,
+		bindPort: payload.BindPort,
+		since:    time.Now(),
+	}
+	host := r.Domain
+	if host == "" {
+		// The address the client reached the relay on
+		host, _, _ = net.SplitHostPort(ctx.LocalAddr().String())
+	}
+	if err := r.open(f, host); err != nil {
+		logger.Warnf("[RELAY] %s@%s: %v", f.user, conn.RemoteAddr(), err)
+		return false, nil
+	}
+	go func() {
+		<-ctx.Done()
+		r.close(f)
+	}()
+
+	logger.Infof("[RELAY] %s@%s tunneled to %s", f.user, conn.RemoteAddr(), f.url)
+	return true, gossh.Marshal(forwardReply{Port: uint32(f.port), URL: f.url})
+}
+
+func (r *Relay) handleCancel(ctx ssh.Context, _ *ssh.Server, req *gossh.Request) (bool, []byte) {
+	var payload forwardRequest
+	if err := gossh.Unmarshal(req.Payload, &payload); err != nil {
+		return false, nil
+	}
+	conn, _ := ctx.Value(ssh.ContextKeyConn).(*gossh.ServerConn)
+
+	r.mu.Lock()
+	var found *forward
+	for _, f := range r.subdomains {
+		if f.matches(conn, payload) {
+			found = f
+		}
+	}
+	for _, f := range r.ports {
+		if f.matches(conn, payload) {
+			found = f
+		}
+	}
+	r.mu.Unlock()
+	if found == nil {
+		return false, nil
+	}
+	r.close(found)
+	return true, nil
+}
+
+// open issues f a subdomain or a port reachable on host.
+func (r *Relay) open(f *forward, host string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f.bindPort == 80 && r.Domain != "" && r.HTTPPort != 0 {
+		sub := r.freeSubdomain(strings.ToLower(f.bindAddr))
+		f.subdomain, f.port = sub, r.HTTPPort
+		f.url = "http://" + sub + "." + r.Domain
+		if r.HTTPPort != 80 {
+			f.url += ":" + strconv.Itoa(r.HTTPPort)
+		}
+		f.proxy = &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.Out.URL.Scheme = "http"
+				pr.Out.URL.Host = pr.In.Host
+				pr.Out.Host = pr.In.Host
+				pr.SetXForwarded()
+			},
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return f.dial(nil)
+				},
+			},
+			ErrorLog: log.New(io.Discard, "", 0),
+		}
+		r.subdomains[sub] = f
+		return nil
+	}
+
+	if r.PortMin == 0 {
+		return fmt.Errorf("no port range for port %d", f.bindPort)
+	}
+	// The requested port if it is free, the first free one otherwise
+	candidates := []int{int(f.bindPort)}
+	for port := r.PortMin; port <= r.PortMax; port++ {
+		candidates = append(candidates, port)
+	}
+	for _, port := range candidates {
+		if port < r.PortMin || port > r.PortMax || r.ports[port] != nil {
+			continue
+		}
+		ln, err := net.Listen("tcp", net.JoinHostPort(r.IP, strconv.Itoa(port)))
+		if err != nil {
+			continue
+		}
+		scheme := "tcp"
+		switch f.bindPort {
+		case 80:
+			scheme = "http"
+		case 443:
+			scheme = "https"
+		}
+		f.port = port
+		f.url = scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port))
+		f.conns.Serve(ln, f.handle)
+		r.ports[port] = f
+		return nil
+	}
+	return fmt.Errorf("no free port in %d-%d", r.PortMin, r.PortMax)
+}
+
+// close removes f from the relay and ends its connections.
+func (r *Relay) close(f *forward) {
+	r.mu.Lock()
+	if f.subdomain != "" && r.subdomains[f.subdomain] == f {
+		delete(r.subdomains, f.subdomain)
+	} else if r.ports[f.port] == f {
+		delete(r.ports, f.port)
+	} else {
+		r.mu.Unlock()
+		return
+	}
+	r.mu.Unlock()
+
+	if f.proxy != nil {
+		f.proxy.Transport.(*http.Transport).CloseIdleConnections()
+	}
+	// The tunnel is gone, a done context closes the open connections at once
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = f.conns.Shutdown(ctx)
+	logger.Infof("[RELAY] Tunnel %s closed", f.url)
+}
+
+// handle passes a connection to the port of f through the tunnel.
+func (f *forward) handle(conn net.Conn) {
+	ch, err := f.dial(conn.RemoteAddr())
+	if err != nil {
+		logger.Debugf("relay: opening channel failed: %v", err)
+		return
+	}
+	defer ch.Close()
+	join(ch, conn)
+}
+
+// dial opens a forwarded-tcpip channel to the client of f.
+func (f *forward) dial(origin net.Addr) (net.Conn, error) {
+	var originAddr string
+	var originPort int
+	if tcp, ok := origin.(*net.TCPAddr); ok {
+		originAddr, originPort = tcp.IP.String(), tcp.Port
+	}
+	// Clients match the channel against the port they asked for
+	port := f.bindPort
+	if port == 0 {
+		port = uint32(f.port)
+	}
+	ch, reqs, err := f.conn.OpenChannel("forwarded-tcpip", gossh.Marshal(forwardedChannel{
+		Addr:       f.bindAddr,
+		Port:       port,
+		OriginAddr: originAddr,
+		OriginPort: uint32(originPort),
+	}))
+	if err != nil {
+		return nil, err
+	}
+	go gossh.DiscardRequests(reqs)
+	return &channelConn{Channel: ch, local: f.conn.LocalAddr(), remote: f.conn.RemoteAddr()}, nil
+}
+
+func (f *forward) matches(conn *gossh.ServerConn, payload forwardRequest) bool {
+	return f.conn == conn && f.bindAddr == payload.BindAddr && f.bindPort == payload.BindPort
+}
+
+func (f *forward) info() RelayTunnel {
+	return RelayTunnel{URL: f.url, User: f.user, Remote: f.conn.RemoteAddr().String(), Since: f.since}
+}
+
+// channelConn is an SSH channel as net.Conn for the HTTP transport.
+type channelConn struct {
+	gossh.Channel
+	local, remote net.Addr
+}
+
+func (c *channelConn) LocalAddr() net.Addr              { return c.local }
+func (c *channelConn) RemoteAddr() net.Addr             { return c.remote }
+func (c *channelConn) SetDeadline(time.Time) error      { return nil }
+func (c *channelConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *channelConn) SetWriteDeadline(time.Time) error { return nil }
+
+// validSubdomain reports whether a client may ask for sub, a single label.
+func validSubdomain(sub string) bool {
+	if sub == "" || sub == "localhost" || len(sub) > 63 || sub[0] == '-' || sub[len(sub)-1] == '-' {
+		return false
+	}
+	for _, c := range sub {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// freeSubdomain returns sub if a client may have it and it is not in use,
+// otherwise a random subdomain that is not in use either. r.mu is held.
+func (r *Relay) freeSubdomain(sub string) string {
+	for !validSubdomain(sub) || r.subdomains[sub] != nil {
+		sub = randomSubdomain()
+	}
+	return sub
+}
+
+func randomSubdomain() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// hostKey loads the host key of the relay. Without HostKeyFile it is kept
+// in the config directory, so that the clients can pin it.
+func (r *Relay) hostKey() (gossh.Signer, error) {
+	file := r.HostKeyFile
+	if file == "" {
+		dir, err := config.Dir()
+		if err != nil {
+			return nil, err
+		}
+		file = filepath.Join(dir, "relay_host_key")
+		if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+			if err := generateHostKey(file); err != nil {
+				return nil, err
+			}
+			logger.Infof("[RELAY] Generated host key %s", file)
+		}
+	}
+
+	keyBytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading relay host key: %w", err)
+	}
+	signer, err := gossh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing relay host key: %w", err)
+	}
+	return signer, nil
+}
+
+func generateHostKey(file string) error {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	block, err := gossh.MarshalPrivateKey(priv, "goshs relay")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, pem.EncodeToMemory(block), 0600)
+}
+
+// loadAuthorizedKeys reads the keys of the clients allowed to open tunnels.
+func loadAuthorizedKeys(file string) (map[string]bool, error) {
+	if file == "" {
+		return nil, errors.New("the relay needs the authorized keys of its clients")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading relay authorized keys: %w", err)
+	}
+	keys := map[string]bool{}
+	for len(data) > 0 {
+		key, _, _, rest, err := gossh.ParseAuthorizedKey(data)
+		if err != nil {
+			break
+		}
+		keys[string(key.Marshal())] = true
+		data = rest
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys in %s", file)
+	}
+	return keys, nil
+}
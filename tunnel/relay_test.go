@@ -0,0 +1,270 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestParsePortRange(t *testing.T) {
+	low, high, err := ParsePortRange("20000-20099")
+	require.NoError(t, err)
+	require.Equal(t, 20000, low)
+	require.Equal(t, 20099, high)
+
+	low, high, err = ParsePortRange("9000")
+	require.NoError(t, err)
+	require.Equal(t, 9000, low)
+	require.Equal(t, 9000, high)
+
+	low, high, err = ParsePortRange("")
+	require.NoError(t, err)
+	require.Zero(t, low)
+	require.Zero(t, high)
+
+	for _, s := range []string{"a-b", "2-1", "0-10", "1-70000", "1-x"} {
+		_, _, err := ParsePortRange(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestValidSubdomain(t *testing.T) {
+	require.True(t, validSubdomain("goshs"))
+	require.True(t, validSubdomain("my-box1"))
+	require.False(t, validSubdomain(""))
+	require.False(t, validSubdomain("localhost"))
+	require.False(t, validSubdomain("-box"))
+	require.False(t, validSubdomain("a.b"))
+	require.False(t, validSubdomain("Box"))
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// writeKey writes a new private key to dir and returns its file and public key.
+func writeKey(t *testing.T, dir, name string) (string, gossh.PublicKey) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := gossh.MarshalPrivateKey(priv, name)
+	require.NoError(t, err)
+	file := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(block), 0600))
+	signer, err := gossh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return file, signer.PublicKey()
+}
+
+// newTestRelay starts a relay with a client key and returns it with the
+// tunnel config of the client.
+func newTestRelay(t *testing.T, domain string) (*Relay, Config) {
+	t.Helper()
+	dir := t.TempDir()
+	hostKeyFile, hostKey := writeKey(t, dir, "host_key")
+	clientKeyFile, clientKey := writeKey(t, dir, "client_key")
+	authorized := filepath.Join(dir, "authorized_keys")
+	require.NoError(t, os.WriteFile(authorized, gossh.MarshalAuthorizedKey(clientKey), 0600))
+
+	port := freePort(t)
+	relay := &Relay{
+		IP:             "127.0.0.1",
+		Port:           freePort(t),
+		HTTPPort:       freePort(t),
+		Domain:         domain,
+		PortMin:        port,
+		PortMax:        port,
+		AuthorizedKeys: authorized,
+		HostKeyFile:    hostKeyFile,
+	}
+	require.NoError(t, relay.Listen())
+	t.Cleanup(func() { _ = relay.Shutdown(context.Background()) })
+
+	return relay, Config{
+		Server:  net.JoinHostPort("127.0.0.1", strconv.Itoa(relay.Port)),
+		KeyFile: clientKeyFile,
+		HostKey: gossh.FingerprintSHA256(hostKey),
+	}
+}
+
+func localServer(t *testing.T) (string, int) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "hello from %s", r.Host)
+	}))
+	t.Cleanup(srv.Close)
+	addr := srv.Listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func TestRelay_FreeSubdomain(t *testing.T) {
+	r := &Relay{subdomains: map[string]*forward{"goshs": {}}}
+	require.Equal(t, "box", r.freeSubdomain("box"))
+
+	// Taken and invalid names are replaced by a random one that is free
+	for _, sub := range []string{"goshs", "", "Box"} {
+		got := r.freeSubdomain(sub)
+		require.Regexp(t, `^[0-9a-f]{8}$`, got)
+		require.Nil(t, r.subdomains[got])
+	}
+}
+
+func TestRelay_Subdomain(t *testing.T) {
+	relay, cfg := newTestRelay(t, "relay.test")
+	ip, port := localServer(t)
+
+	tun, err := Start(ip, port, cfg)
+	require.NoError(t, err)
+	require.Regexp(t, `^http://[0-9a-f]{8}\.relay\.test:`+strconv.Itoa(relay.HTTPPort)+`$`, tun.PublicURL)
+	require.Len(t, relay.Tunnels(), 1)
+	require.Equal(t, tun.PublicURL, relay.Tunnels()[0].URL)
+
+	host := tun.PublicURL[len("http://"):]
+	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:"+strconv.Itoa(relay.HTTPPort)+"/", nil)
+	require.NoError(t, err)
+	req.Host = host
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "hello from "+host, string(body))
+
+	// Unknown subdomains are not passed on
+	req.Host = "other.relay.test"
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// The tunnel is gone with its client
+	tun.Close()
+	require.Eventually(t, func() bool { return len(relay.Tunnels()) == 0 }, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestRelay_Port(t *testing.T) {
+	relay, cfg := newTestRelay(t, "")
+	ip, port := localServer(t)
+
+	tun, err := Start(ip, port, cfg)
+	require.NoError(t, err)
+	defer tun.Close()
+	require.Equal(t, "http://127.0.0.1:"+strconv.Itoa(relay.PortMin), tun.PublicURL)
+
+	resp, err := http.Get(tun.PublicURL)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, "hello from 127.0.0.1:"+strconv.Itoa(relay.PortMin), string(body))
+
+	// The only port is taken
+	_, err = Start(ip, port, cfg)
+	require.ErrorContains(t, err, "refused")
+}
+
+func TestRelay_Auth(t *testing.T) {
+	_, cfg := newTestRelay(t, "")
+	ip, port := localServer(t)
+
+	// A key the relay does not know
+	other, _ := writeKey(t, t.TempDir(), "other_key")
+	wrongKey := cfg
+	wrongKey.KeyFile = other
+	_, err := Start(ip, port, wrongKey)
+	require.Error(t, err)
+
+	// A host key other than the pinned one
+	_, otherHostKey := writeKey(t, t.TempDir(), "other_host_key")
+	wrongHost := cfg
+	wrongHost.HostKey = string(gossh.MarshalAuthorizedKey(otherHostKey))
+	_, err = Start(ip, port, wrongHost)
+	var mismatch *HostKeyMismatchError
+	require.ErrorAs(t, err, &mismatch)
+}
+
+func TestTunnel_Forward(t *testing.T) {
+	relay, cfg := newTestRelay(t, "relay.test")
+	ip, port := localServer(t)
+
+	tun, err := Start(ip, port, cfg)
+	require.NoError(t, err)
+	defer tun.Close()
+
+	// A line based server next to the web server
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = io.Copy(conn, conn)
+			conn.Close()
+		}
+	}()
+	echoPort := ln.Addr().(*net.TCPAddr).Port
+
+	endpoint, err := tun.Forward("ldap", "127.0.0.1", echoPort)
+	require.NoError(t, err)
+	require.Equal(t, "tcp://relay.test:"+strconv.Itoa(relay.PortMin), endpoint)
+	require.Len(t, relay.Tunnels(), 2)
+
+	// Forwarding again keeps the endpoint
+	again, err := tun.Forward("ldap", "127.0.0.1", echoPort)
+	require.NoError(t, err)
+	require.Equal(t, endpoint, again)
+	require.Equal(t, []Endpoint{
+		{Name: "web", Local: net.JoinHostPort(ip, strconv.Itoa(port)), URL: tun.PublicURL},
+		{Name: "ldap", Local: "127.0.0.1:" + strconv.Itoa(echoPort), URL: endpoint},
+	}, tun.Endpoints())
+
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(relay.PortMin))
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("ping\n"))
+	require.NoError(t, err)
+	line := make([]byte, 5)
+	_, err = io.ReadFull(conn, line)
+	require.NoError(t, err)
+	require.Equal(t, "ping\n", string(line))
+	conn.Close()
+
+	// The web server is still reached through its subdomain
+	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:"+strconv.Itoa(relay.HTTPPort)+"/", nil)
+	require.NoError(t, err)
+	req.Host = tun.PublicURL[len("http://"):]
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.NoError(t, tun.Unforward("ldap"))
+	require.Len(t, tun.Endpoints(), 1)
+	require.Eventually(t, func() bool { return len(relay.Tunnels()) == 1 }, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestTunnel_Forward_HTTPOnly(t *testing.T) {
+	// Tunnels on localhost.run run a session for the URL
+	tun := &Tunnel{session: &gossh.Session{}}
+	_, err := tun.Forward("ldap", "127.0.0.1", 389)
+	require.ErrorIs(t, err, ErrHTTPOnly)
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"goshs.de/goshs/v2/logger"
@@ -17,34 +18,115 @@ import (
 )
 
 // HostKeyMismatchError is returned by Start when the server presents a host
-// key that differs from the pinned key in known_hosts. Callers should treat
-// this as a fatal condition (possible MITM attack).
+// key that differs from the pinned key in known_hosts or the -tunnel-host-key.
+// Callers should treat this as a fatal condition (possible MITM attack).
 type HostKeyMismatchError struct {
 	Hostname       string
-	KnownHostsFile string
+	KnownHostsFile string // empty for a key pinned with Config.HostKey
 }
 
 func (e *HostKeyMismatchError) Error() string {
+	if e.KnownHostsFile == "" {
+		return fmt.Sprintf("ssh: host key mismatch for %s — possible MITM attack. "+
+			"The key does not match the pinned host key", e.Hostname)
+	}
 	return fmt.Sprintf(
 		"ssh: host key mismatch for %s — possible MITM attack. "+
-			"If localhost.run legitimately rotated its key, delete %s and reconnect",
+			"If the server legitimately rotated its key, delete %s and reconnect",
 		e.Hostname, e.KnownHostsFile,
 	)
 }
 
+// Config selects the SSH server a tunnel is opened on. Without Server the
+// tunnel goes to localhost.run.
+type Config struct {
+	Server         string // host:port of a goshs relay
+	User           string // login of the relay, "goshs" if empty
+	KeyFile        string // private key to log in to the relay with
+	HostKey        string // SHA256 fingerprint or authorized_keys line of the server
+	KnownHostsFile string // trust on first use when HostKey is empty
+	TLS            bool   // the local server speaks TLS
+}
+
+// forwardRequest is the payload of a tcpip-forward request (RFC 4254 7.1).
+type forwardRequest struct {
+	BindAddr string
+	BindPort uint32
+}
+
+// forwardReply answers a tcpip-forward request of a goshs relay. Next to the
+// bound port of RFC 4254 it carries the public URL of the tunnel.
+type forwardReply struct {
+	Port uint32
+	URL  string
+}
+
+// forwardedChannel is the payload of a forwarded-tcpip channel (RFC 4254 7.2).
+type forwardedChannel struct {
+	Addr       string
+	Port       uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
 type Tunnel struct {
 	PublicURL string
 	client    *ssh.Client
 	session   *ssh.Session
 	stop      chan struct{}
+
+	mu       sync.Mutex
+	forwards []*remoteForward // the web server first
+}
+
+// ErrHTTPOnly is returned by Forward for tunnels on localhost.run, which
+// only forwards the web server.
+var ErrHTTPOnly = errors.New("the tunnel only forwards HTTP, use a goshs relay to forward other ports")
+
+// Endpoint is a local port reachable through the tunnel.
+type Endpoint struct {
+	Name  string `json:"name"`
+	Local string `json:"local"`
+	URL   string `json:"url"`
+}
+
+// remoteForward maps the forwarded-tcpip channels of one tcpip-forward
+// request to a local port.
+type remoteForward struct {
+	Endpoint
+	request   forwardRequest
+	addr      string // address and port the channels are opened for
+	port      uint32
+	localIP   string
+	localPort int
+}
+
+func newRemoteForward(name, localIP string, localPort int, req forwardRequest, url string) *remoteForward {
+	return &remoteForward{
+		Endpoint: Endpoint{
+			Name:  name,
+			Local: net.JoinHostPort(localIP, strconv.Itoa(localPort)),
+			URL:   url,
+		},
+		request:   req,
+		addr:      req.BindAddr,
+		port:      req.BindPort,
+		localIP:   localIP,
+		localPort: localPort,
+	}
 }
 
 type closeWriter interface {
 	CloseWrite() error
 }
 
-func Start(localIP string, localPort int, knownHostsFile string) (*Tunnel, error) {
-	hostKeyCb, err := buildTOFUCallback(knownHostsFile)
+// Start opens a tunnel to localIP:localPort on the server of cfg.
+func Start(localIP string, localPort int, cfg Config) (*Tunnel, error) {
+	if cfg.Server != "" {
+		return startRelay(localIP, localPort, cfg)
+	}
+
+	hostKeyCb, err := buildTOFUCallback(cfg.KnownHostsFile)
 	if err != nil {
 		return nil, fmt.Errorf("setting up host key verification: %w", err)
 	}
@@ -73,10 +155,7 @@ func Start(localIP string, localPort int, knownHostsFile string) (*Tunnel, error
 
 	// Send the tcpip-forward global request directly instead of using
 	// client.Listen() — this avoids the address matching issue entirely
-	ok, _, err := client.SendRequest("tcpip-forward", true, ssh.Marshal(struct {
-		BindAddr string
-		BindPort uint32
-	}{"localhost", 80}))
+	ok, _, err := client.SendRequest("tcpip-forward", true, ssh.Marshal(forwardRequest{"localhost", 80}))
 	if err != nil || !ok {
 		client.Close()
 		return nil, fmt.Errorf("tcpip-forward request failed: %w", err)
@@ -135,7 +214,8 @@ func Start(localIP string, localPort int, knownHostsFile string) (*Tunnel, error
 			session:   session,
 			stop:      make(chan struct{}),
 		}
-		go t.accept(chanCh, localIP, localPort)
+		t.forwards = []*remoteForward{newRemoteForward("web", localIP, localPort, forwardRequest{"localhost", 80}, url)}
+		go t.accept(chanCh)
 		return t, nil
 	case err := <-errCh:
 		session.Close()
@@ -148,9 +228,186 @@ func Start(localIP string, localPort int, knownHostsFile string) (*Tunnel, error
 	}
 }
 
+// startRelay opens the tunnel on a goshs relay, which replies to the
+// tcpip-forward request with the public URL.
+func startRelay(localIP string, localPort int, cfg Config) (*Tunnel, error) {
+	var hostKeyCb ssh.HostKeyCallback
+	var err error
+	if cfg.HostKey != "" {
+		hostKeyCb, err = buildPinnedCallback(cfg.HostKey)
+	} else {
+		hostKeyCb, err = buildTOFUCallback(cfg.KnownHostsFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("setting up host key verification: %w", err)
+	}
+
+	var auth []ssh.AuthMethod
+	if cfg.KeyFile != "" {
+		keyBytes, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading tunnel key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(keyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing tunnel key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	user := cfg.User
+	if user == "" {
+		user = "goshs"
+	}
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCb,
+		Timeout:         10 * time.Second,
+	}
+
+	client, err := ssh.Dial("tcp", cfg.Server, config)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", cfg.Server, err)
+	}
+
+	chanCh := client.HandleChannelOpen("forwarded-tcpip")
+	if chanCh == nil {
+		client.Close()
+		return nil, fmt.Errorf("could not register forwarded-tcpip handler")
+	}
+
+	// Port 80 asks the relay for a subdomain, 443 for a port carrying TLS
+	bindPort := uint32(80)
+	if cfg.TLS {
+		bindPort = 443
+	}
+	req := forwardRequest{"localhost", bindPort}
+	ok, payload, err := client.SendRequest("tcpip-forward", true, ssh.Marshal(req))
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("tcpip-forward request failed: %w", err)
+	}
+	if !ok {
+		client.Close()
+		return nil, fmt.Errorf("relay %s refused the tunnel", cfg.Server)
+	}
+
+	var reply forwardReply
+	if err := ssh.Unmarshal(payload, &reply); err != nil || reply.URL == "" {
+		client.Close()
+		return nil, fmt.Errorf("%s is no goshs relay, it sent no tunnel URL", cfg.Server)
+	}
+
+	t := &Tunnel{
+		PublicURL: reply.URL,
+		client:    client,
+		stop:      make(chan struct{}),
+	}
+	t.forwards = []*remoteForward{newRemoteForward("web", localIP, localPort, req, reply.URL)}
+	go t.accept(chanCh)
+	return t, nil
+}
+
+// Forward opens another port of the relay to localIP:localPort and returns
+// its public URL. The forward is known by name, forwarding a name again moves
+// it to the new local port.
+func (t *Tunnel) Forward(name, localIP string, localPort int) (string, error) {
+	if t.session != nil {
+		return "", ErrHTTPOnly
+	}
+
+	t.mu.Lock()
+	for _, f := range t.forwards {
+		if f.Name == name && f.localIP == localIP && f.localPort == localPort {
+			t.mu.Unlock()
+			return f.URL, nil
+		}
+	}
+	t.mu.Unlock()
+	if err := t.Unforward(name); err != nil {
+		return "", err
+	}
+
+	// The relay serves ports 80 and 443 as HTTP, any other port from its range
+	bindPort := uint32(localPort)
+	if bindPort == 80 || bindPort == 443 {
+		bindPort = 0
+	}
+	req := forwardRequest{name, bindPort}
+	ok, payload, err := t.client.SendRequest("tcpip-forward", true, ssh.Marshal(req))
+	if err != nil {
+		return "", fmt.Errorf("tcpip-forward request failed: %w", err)
+	}
+	if !ok {
+		return "", fmt.Errorf("relay refused to forward %s", name)
+	}
+	var reply forwardReply
+	if err := ssh.Unmarshal(payload, &reply); err != nil || reply.URL == "" {
+		return "", fmt.Errorf("relay sent no URL for %s", name)
+	}
+
+	f := newRemoteForward(name, localIP, localPort, req, reply.URL)
+	if f.port == 0 {
+		f.port = reply.Port
+	}
+	t.mu.Lock()
+	t.forwards = append(t.forwards, f)
+	t.mu.Unlock()
+	return f.URL, nil
+}
+
+// Unforward closes the forward opened by Forward under name.
+func (t *Tunnel) Unforward(name string) error {
+	t.mu.Lock()
+	var found *remoteForward
+	for i, f := range t.forwards {
+		if i > 0 && f.Name == name {
+			found = f
+			t.forwards = append(t.forwards[:i:i], t.forwards[i+1:]...)
+			break
+		}
+	}
+	t.mu.Unlock()
+	if found == nil {
+		return nil
+	}
+	if _, _, err := t.client.SendRequest("cancel-tcpip-forward", true, ssh.Marshal(found.request)); err != nil {
+		return fmt.Errorf("cancel-tcpip-forward request failed: %w", err)
+	}
+	return nil
+}
+
+// Endpoints lists the web server and the forwards of the tunnel.
+func (t *Tunnel) Endpoints() []Endpoint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	endpoints := make([]Endpoint, 0, len(t.forwards))
+	for _, f := range t.forwards {
+		endpoints = append(endpoints, f.Endpoint)
+	}
+	return endpoints
+}
+
+// target returns the forward a channel was opened for. Channels the payload
+// does not match go to the web server, localhost.run sends its own values.
+func (t *Tunnel) target(extra []byte) *remoteForward {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var payload forwardedChannel
+	if err := ssh.Unmarshal(extra, &payload); err == nil {
+		for _, f := range t.forwards[1:] {
+			if f.addr == payload.Addr && f.port == payload.Port {
+				return f
+			}
+		}
+	}
+	return t.forwards[0]
+}
+
 // accept handles incoming forwarded-tcpip new channel requests directly,
 // bypassing the address matching in client.Listen()
-func (t *Tunnel) accept(chanCh <-chan ssh.NewChannel, localIP string, localPort int) {
+func (t *Tunnel) accept(chanCh <-chan ssh.NewChannel) {
 	for {
 		select {
 		case <-t.stop:
@@ -159,7 +416,8 @@ func (t *Tunnel) accept(chanCh <-chan ssh.NewChannel, localIP string, localPort
 			if !ok {
 				return
 			}
-			logger.Debugf("tunnel: incoming forwarded-tcpip channel")
+			f := t.target(newChan.ExtraData())
+			logger.Debugf("tunnel: incoming forwarded-tcpip channel for %s", f.Name)
 			ch, reqs, err := newChan.Accept()
 			if err != nil {
 				logger.Debugf("tunnel: accepting channel failed: %v", err)
@@ -167,7 +425,7 @@ func (t *Tunnel) accept(chanCh <-chan ssh.NewChannel, localIP string, localPort
 			}
 			// Discard channel-level requests (window adjustments etc.)
 			go ssh.DiscardRequests(reqs)
-			go proxy(ch, localIP, localPort)
+			go proxy(ch, f.localIP, f.localPort)
 		}
 	}
 }
@@ -215,14 +473,38 @@ func buildTOFUCallback(knownHostsFile string) (ssh.HostKeyCallback, error) {
 
 		fingerprint := ssh.FingerprintSHA256(key)
 		logger.Warnf("tunnel: pinned new host key for %s (%s) in %s", hostname, fingerprint, knownHostsFile)
-		logger.Warnf("tunnel: verify with: ssh-keyscan localhost.run 2>/dev/null | ssh-keygen -l -f -")
+		if host, port, err := net.SplitHostPort(hostname); err == nil {
+			logger.Warnf("tunnel: verify with: ssh-keyscan -p %s %s 2>/dev/null | ssh-keygen -l -f -", port, host)
+		}
+		return nil
+	}, nil
+}
+
+// buildPinnedCallback accepts only the host key pin, given as SHA256
+// fingerprint like ssh-keygen -l prints it or as authorized_keys line.
+func buildPinnedCallback(pin string) (ssh.HostKeyCallback, error) {
+	pin = strings.TrimSpace(pin)
+	if !strings.HasPrefix(pin, "SHA256:") {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pin))
+		if err != nil {
+			return nil, fmt.Errorf("parsing pinned host key: %w", err)
+		}
+		pin = ssh.FingerprintSHA256(key)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if ssh.FingerprintSHA256(key) != pin {
+			return &HostKeyMismatchError{Hostname: hostname}
+		}
 		return nil
 	}, nil
 }
 
 func (t *Tunnel) Close() {
 	close(t.stop)
-	t.session.Close()
+	if t.session != nil {
+		t.session.Close()
+	}
 	t.client.Close()
 }
 func proxy(remote ssh.Channel, localIP string, localPort int) {
@@ -236,7 +518,12 @@ func proxy(remote ssh.Channel, localIP string, localPort int) {
 	}
 	defer local.Close()
 	logger.Debugf("tunnel: proxy connection established, copying")
+	join(local, remote)
+}
 
+// join copies between local and remote until both directions are done. The end of
+// one direction is passed on as close write.
+func join(local, remote io.ReadWriter) {
 	done := make(chan struct{}, 2)
 
 	go func() {
@@ -0,0 +1,250 @@
+// Package users loads the accounts file shared by the HTTP, WebDAV, SFTP and
+// SMB servers. Each account has a role limiting what it may do and an
+// optional home directory below the webroot.
+package users
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Role is the access level of an account.
+type Role string
+
+const (
+	// RoleRead may list and download.
+	RoleRead Role = "read"
+	// RoleUpload may list and upload, but not download or delete.
+	RoleUpload Role = "upload"
+	// RoleFull may read, upload and delete.
+	RoleFull Role = "full"
+	// RoleAdmin has full file access plus the collaboration, catcher,
+	// cracking and mailbox APIs.
+	RoleAdmin Role = "admin"
+	// RoleNone has no file access. API tokens scoped to an administrative
+	// API act as it, they cannot be given in the users file.
+	RoleNone Role = "none"
+)
+
+// Account is one line of the users file.
+//
+// A nil *Account is allowed nothing, so a request that lost its account (e.g.
+// because it was removed by a reload) is denied rather than let through.
+type Account struct {
+	Name   string
+	Secret string // bcrypt hash or plaintext password
+	Role   Role
+	Home   string // relative to the webroot, "" for the webroot itself
+}
+
+// Unrestricted stands for the single -b credential or no auth at all. It is
+// allowed everything and must not be modified.
+var Unrestricted = &Account{Role: RoleAdmin}
+
+// CanRead reports whether the account may download files.
+func (a *Account) CanRead() bool {
+	return a != nil && a.Role != RoleUpload && a.Role != RoleNone
+}
+
+// CanWrite reports whether the account may upload files and create
+// directories.
+func (a *Account) CanWrite() bool {
+	return a != nil && a.Role != RoleRead && a.Role != RoleNone
+}
+
+// CanDelete reports whether the account may delete and rename files.
+func (a *Account) CanDelete() bool {
+	return a != nil && (a.Role == RoleFull || a.Role == RoleAdmin)
+}
+
+// IsAdmin reports whether the account may use the administrative APIs.
+func (a *Account) IsAdmin() bool {
+	return a != nil && a.Role == RoleAdmin
+}
+
+// Root returns the directory the account is confined to.
+func (a *Account) Root(webroot string) string {
+	if a == nil || a.Home == "" {
+		return webroot
+	}
+	return filepath.Join(webroot, a.Home)
+}
+
+// CheckPassword verifies password against the account secret.
+func (a *Account) CheckPassword(password string) bool {
+	if isBcrypt(a.Secret) {
+		return bcrypt.CompareHashAndPassword([]byte(a.Secret), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(a.Secret), []byte(password)) == 1
+}
+
+// Plaintext returns the plaintext password. NTLM needs it to verify a
+// response, so accounts with a bcrypt hash cannot log in via SMB.
+func (a *Account) Plaintext() (string, bool) {
+	if isBcrypt(a.Secret) {
+		return "", false
+	}
+	return a.Secret, true
+}
+
+func isBcrypt(s string) bool {
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
+
+// Users is the set of accounts read from a users file.
+type Users struct {
+	mu       sync.RWMutex
+	accounts map[string]*Account // keyed by lower case name
+}
+
+// Load reads the users file at path.
+func Load(path string) (*Users, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	u, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return u, nil
+}
+
+// Parse reads accounts in the form
+//
+//	name:secret[:role[:home]]
+//
+// one per line. Blank lines and lines starting with # are skipped. The
+// secret is a bcrypt hash as printed by goshs -H or a plaintext password
+// without colons; the role defaults to full.
+func Parse(r io.Reader) (*Users, error) {
+	u := &Users{accounts: map[string]*Account{}}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 4)
+		if len(fields) < 2 || fields[0] == "" || fields[1] == "" {
+			return nil, fmt.Errorf("line %d: expected name:secret[:role[:home]]", n)
+		}
+
+		a := &Account{Name: fields[0], Secret: fields[1], Role: RoleFull}
+		if len(fields) > 2 && fields[2] != "" {
+			a.Role = Role(strings.ToLower(fields[2]))
+			switch a.Role {
+			case RoleRead, RoleUpload, RoleFull, RoleAdmin:
+			default:
+				return nil, fmt.Errorf("line %d: unknown role %q", n, fields[2])
+			}
+		}
+		if len(fields) > 3 && fields[3] != "" {
+			home := filepath.Clean(filepath.FromSlash(strings.Trim(fields[3], "/")))
+			if !filepath.IsLocal(home) {
+				return nil, fmt.Errorf("line %d: home %q must be a subdirectory of the webroot", n, fields[3])
+			}
+			if home != "." {
+				a.Home = home
+			}
+		}
+
+		key := strings.ToLower(a.Name)
+		if _, dup := u.accounts[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate user %q", n, a.Name)
+		}
+		u.accounts[key] = a
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(u.accounts) == 0 {
+		return nil, fmt.Errorf("no accounts defined")
+	}
+	return u, nil
+}
+
+// Lookup returns the account with exactly the given name, or nil.
+func (u *Users) Lookup(name string) *Account {
+	if a := u.LookupFold(name); a != nil && a.Name == name {
+		return a
+	}
+	return nil
+}
+
+// LookupFold is Lookup ignoring case, as SMB treats user names.
+func (u *Users) LookupFold(name string) *Account {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.accounts[strings.ToLower(name)]
+}
+
+// Authenticate returns the account for name if password matches.
+func (u *Users) Authenticate(name, password string) *Account {
+	a := u.Lookup(name)
+	if a == nil || !a.CheckPassword(password) {
+		return nil
+	}
+	return a
+}
+
+// Accounts returns all accounts sorted by name.
+func (u *Users) Accounts() []*Account {
+	u.mu.RLock()
+	out := make([]*Account, 0, len(u.accounts))
+	for _, a := range u.accounts {
+		out = append(out, a)
+	}
+	u.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// MakeHomes creates missing home directories below webroot.
+func (u *Users) MakeHomes(webroot string) error {
+	for _, a := range u.Accounts() {
+		if a.Home == "" {
+			continue
+		}
+		if err := os.MkdirAll(a.Root(webroot), 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replace swaps the accounts of u for those of next, as a reload of the
+// users file does. Requests already logged in keep their account.
+func (u *Users) Replace(next *Users) {
+	next.mu.RLock()
+	accounts := next.accounts
+	next.mu.RUnlock()
+
+	u.mu.Lock()
+	u.accounts = accounts
+	u.mu.Unlock()
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying a.
+func NewContext(ctx context.Context, a *Account) context.Context {
+	return context.WithValue(ctx, contextKey{}, a)
+}
+
+// FromContext returns the account stored in ctx, or nil.
+func FromContext(ctx context.Context) *Account {
+	a, _ := ctx.Value(contextKey{}).(*Account)
+	return a
+}
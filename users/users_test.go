@@ -0,0 +1,133 @@
+package users
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestParse(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	u, err := Parse(strings.NewReader(`
+# team accounts
+alice:` + string(hash) + `:admin
+bob:plain:read:shared/bob
+carol:pw:UPLOAD:/drop/
+dave:pw
+`))
+	require.NoError(t, err)
+	require.Len(t, u.Accounts(), 4)
+
+	alice := u.Authenticate("alice", "s3cret")
+	require.NotNil(t, alice)
+	require.Equal(t, RoleAdmin, alice.Role)
+	require.Nil(t, u.Authenticate("alice", "wrong"))
+	_, ok := alice.Plaintext()
+	require.False(t, ok)
+
+	bob := u.Authenticate("bob", "plain")
+	require.NotNil(t, bob)
+	require.Equal(t, filepath.Join("shared", "bob"), bob.Home)
+	require.Equal(t, filepath.Join("/srv", "shared", "bob"), bob.Root("/srv"))
+	pw, ok := bob.Plaintext()
+	require.True(t, ok)
+	require.Equal(t, "plain", pw)
+
+	require.Equal(t, RoleUpload, u.Lookup("carol").Role)
+	require.Equal(t, "drop", u.Lookup("carol").Home)
+	require.Equal(t, RoleFull, u.Lookup("dave").Role)
+
+	require.Nil(t, u.Lookup("BOB"))
+	require.Equal(t, bob, u.LookupFold("BOB"))
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"# only comments\n",
+		"alice\n",
+		"alice:\n",
+		"alice:pw:root\n",
+		"alice:pw:read:../outside\n",
+		"alice:pw\nALICE:pw\n",
+	} {
+		_, err := Parse(strings.NewReader(in))
+		require.Error(t, err, in)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	cases := []struct {
+		role                         Role
+		read, write, remove, isAdmin bool
+	}{
+		{RoleRead, true, false, false, false},
+		{RoleUpload, false, true, false, false},
+		{RoleFull, true, true, true, false},
+		{RoleAdmin, true, true, true, true},
+	}
+	for _, c := range cases {
+		a := &Account{Role: c.role}
+		require.Equal(t, c.read, a.CanRead(), c.role)
+		require.Equal(t, c.write, a.CanWrite(), c.role)
+		require.Equal(t, c.remove, a.CanDelete(), c.role)
+		require.Equal(t, c.isAdmin, a.IsAdmin(), c.role)
+	}
+
+	var none *Account
+	require.False(t, none.CanRead())
+	require.False(t, none.CanWrite())
+	require.False(t, none.CanDelete())
+	require.False(t, none.IsAdmin())
+	require.Equal(t, "/srv", none.Root("/srv"))
+
+	require.True(t, Unrestricted.CanRead())
+	require.True(t, Unrestricted.CanWrite())
+	require.True(t, Unrestricted.CanDelete())
+	require.True(t, Unrestricted.IsAdmin())
+	require.Equal(t, "/srv", Unrestricted.Root("/srv"))
+}
+
+func TestLoadAndMakeHomes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "users")
+	require.NoError(t, os.WriteFile(path, []byte("bob:pw:read:team/bob\n"), 0600))
+
+	u, err := Load(path)
+	require.NoError(t, err)
+	require.NoError(t, u.MakeHomes(dir))
+	info, err := os.Stat(filepath.Join(dir, "team", "bob"))
+	require.NoError(t, err)
+	require.True(t, info.IsDir())
+
+	_, err = Load(filepath.Join(dir, "missing"))
+	require.Error(t, err)
+}
+
+func TestReplace(t *testing.T) {
+	u, err := Parse(strings.NewReader("alice:old:admin\nbob:pw\n"))
+	require.NoError(t, err)
+	next, err := Parse(strings.NewReader("alice:new:read\n"))
+	require.NoError(t, err)
+
+	u.Replace(next)
+	require.Nil(t, u.Authenticate("alice", "old"))
+	alice := u.Authenticate("alice", "new")
+	require.NotNil(t, alice)
+	require.Equal(t, RoleRead, alice.Role)
+	require.Nil(t, u.Lookup("bob"))
+	require.Len(t, u.Accounts(), 1)
+}
+
+func TestContext(t *testing.T) {
+	require.Nil(t, FromContext(context.Background()))
+	a := &Account{Name: "bob"}
+	require.Equal(t, a, FromContext(NewContext(context.Background(), a)))
+}
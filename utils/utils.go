@@ -98,7 +98,7 @@ func GenerateHashedPassword(password []byte) string {
 	return string(bytes)
 }
 
-func RegisterZeroconfMDNS(ssl bool, webPort int, webdav bool, webdavPort int, sftp bool, sftpPort int, smtp bool, smtpPort int, dns bool, dnsPort int, smb bool, smbPort int, ldap bool, ldapPort int) error {
+func RegisterZeroconfMDNS(ssl bool, webPort int, webdav bool, webdavPort int, sftp bool, sftpPort int, smtp bool, smtpPort int, dns bool, dnsPort int, smb bool, smbPort int, ldap bool, ldapPort int, pop3 bool, pop3Port int, imap bool, imapPort int) error {
 	// Register zeroconf mDNS
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -249,5 +249,49 @@ func RegisterZeroconfMDNS(ssl bool, webPort int, webdav bool, webdavPort int, sf
 		logger.Infof("mDNS service registered as ldap://%s.local:%d", hostname, ldapPort)
 	}
 
+	// Register pop3 if enabled
+	if pop3 {
+		serviceType, out = "_pop3._tcp", "pop3"
+		if ssl {
+			serviceType, out = "_pop3s._tcp", "pop3s"
+		}
+		zeroPOP3, err := zeroconf.Register(
+			"goshs POP3",
+			serviceType,
+			"local.",
+			pop3Port,
+			[]string{fmt.Sprintf("host=%s.local", hostname), fmt.Sprintf("version=%s", goshsversion.GoshsVersion)},
+			nil,
+		)
+		if err != nil {
+			return fmt.Errorf("zeroconf mDNS did not register successfully: %+v", err)
+		}
+		defer zeroPOP3.Shutdown()
+
+		logger.Infof("mDNS service registered as %s://%s.local:%d", out, hostname, pop3Port)
+	}
+
+	// Register imap if enabled
+	if imap {
+		serviceType, out = "_imap._tcp", "imap"
+		if ssl {
+			serviceType, out = "_imaps._tcp", "imaps"
+		}
+		zeroIMAP, err := zeroconf.Register(
+			"goshs IMAP",
+			serviceType,
+			"local.",
+			imapPort,
+			[]string{fmt.Sprintf("host=%s.local", hostname), fmt.Sprintf("version=%s", goshsversion.GoshsVersion)},
+			nil,
+		)
+		if err != nil {
+			return fmt.Errorf("zeroconf mDNS did not register successfully: %+v", err)
+		}
+		defer zeroIMAP.Shutdown()
+
+		logger.Infof("mDNS service registered as %s://%s.local:%d", out, hostname, imapPort)
+	}
+
 	return nil
 }
@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Event is the structured form of a notification. Providers implementing
+// EventSender receive it as a whole, all others only its Message.
+type Event struct {
+	Type    string            `json:"type"`   // upload, download, smb, ...
+	Source  string            `json:"source"` // the service that noticed it: web, sftp, smb, ...
+	Time    time.Time         `json:"time"`
+	Message string            `json:"message"`
+	Remote  string            `json:"remote,omitempty"` // client address
+	User    string            `json:"user,omitempty"`
+	Path    string            `json:"path,omitempty"`
+	Hashes  []string          `json:"hashes,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// EventSender is implemented by providers that send the structured event.
+type EventSender interface {
+	SendEvent(e Event) error
+}
+
+// NewEvent returns the event for a plain message. The source is taken from
+// a leading "[WEB]" style tag of the message and falls back to the type.
+func NewEvent(eventType string, message string) Event {
+	return Event{
+		Type:    eventType,
+		Source:  sourceOf(eventType, message),
+		Time:    time.Now().UTC(),
+		Message: message,
+	}
+}
+
+func sourceOf(eventType string, message string) string {
+	if strings.HasPrefix(message, "[") {
+		if end := strings.Index(message, "]"); end > 1 {
+			return strings.ToLower(message[1:end])
+		}
+	}
+	return eventType
+}
+
+// Title is a short heading for providers that show one.
+func (e Event) Title() string {
+	if e.Type == "" {
+		return "goshs"
+	}
+	return "goshs: " + e.Type
+}
+
+// Fact is a named detail of an event.
+type Fact struct {
+	Name  string
+	Value string
+}
+
+// Facts lists the details of the event apart from its message, the extra
+// fields sorted by name.
+func (e Event) Facts() []Fact {
+	var facts []Fact
+	for _, f := range []Fact{{"remote", e.Remote}, {"user", e.User}, {"path", e.Path}} {
+		if f.Value != "" {
+			facts = append(facts, f)
+		}
+	}
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		facts = append(facts, Fact{name, e.Fields[name]})
+	}
+	return facts
+}
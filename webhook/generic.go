@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body,
+// prefixed with "sha256=", when a secret is set.
+const SignatureHeader = "X-Goshs-Signature-256"
+
+// GenericWebhook posts the structured event as JSON, or the body rendered
+// from Template with the event as data, to any URL.
+type GenericWebhook struct {
+	Enabled  bool
+	Events   []string
+	URL      string
+	Template *template.Template
+	Headers  map[string]string
+	Secret   string
+}
+
+// ParseTemplate reads a text/template body for the generic provider. Next to
+// the builtins it knows json, which encodes its argument as JSON.
+func ParseTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(string(data))
+}
+
+func (g *GenericWebhook) Send(message string) error {
+	return g.SendEvent(NewEvent("", message))
+}
+
+func (g *GenericWebhook) SendEvent(e Event) error {
+	var body []byte
+	if g.Template != nil {
+		var buf bytes.Buffer
+		if err := g.Template.Execute(&buf, e); err != nil {
+			return fmt.Errorf("failed to render webhook template: %w", err)
+		}
+		body = buf.Bytes()
+	} else {
+		var err error
+		if body, err = json.Marshal(e); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, g.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "goshs")
+	for name, value := range g.Headers {
+		req.Header.Set(name, value)
+	}
+	if g.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(g.Secret))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	return do(req)
+}
+
+func (g *GenericWebhook) GetEnabled() bool {
+	return g.Enabled
+}
+
+func (g *GenericWebhook) GetEvents() []string {
+	return g.Events
+}
+
+func (g *GenericWebhook) Contains(event string) bool {
+	return slices.Contains(g.Events, event)
+}
+
+// ParseHeaders splits a comma separated list of "Name: value" headers.
+func ParseHeaders(list string) map[string]string {
+	headers := map[string]string{}
+	for header := range strings.SplitSeq(list, ",") {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			continue
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return headers
+}
@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEvent_Source(t *testing.T) {
+	require.Equal(t, "web", NewEvent("upload", "[WEB] File uploaded: /x").Source)
+	require.Equal(t, "smb", NewEvent("smb", "User: bob").Source)
+	require.Equal(t, "ldap", NewEvent("ldap", "[] odd").Source)
+}
+
+func TestGenericWebhook_SendEvent(t *testing.T) {
+	var got []byte
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	g := &GenericWebhook{
+		URL:     ts.URL,
+		Headers: ParseHeaders("Authorization: Bearer abc, X-Env: lab,broken"),
+		Secret:  "s3cret",
+	}
+	e := NewEvent("smb", "User: bob")
+	e.User = "bob"
+	e.Hashes = []string{"bob::CORP:1122"}
+	require.NoError(t, g.SendEvent(e))
+
+	var sent Event
+	require.NoError(t, json.Unmarshal(got, &sent))
+	require.Equal(t, "smb", sent.Type)
+	require.Equal(t, "bob", sent.User)
+	require.Equal(t, []string{"bob::CORP:1122"}, sent.Hashes)
+	require.Equal(t, "application/json", header.Get("Content-Type"))
+	require.Equal(t, "Bearer abc", header.Get("Authorization"))
+	require.Equal(t, "lab", header.Get("X-Env"))
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(got)
+	require.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), header.Get(SignatureHeader))
+}
+
+func TestGenericWebhook_Template(t *testing.T) {
+	var got []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "body.tmpl")
+	require.NoError(t, os.WriteFile(path, []byte(`{"summary":{{json .Message}},"who":"{{.User}}"}`), 0o600))
+	tmpl, err := ParseTemplate(path)
+	require.NoError(t, err)
+
+	g := &GenericWebhook{URL: ts.URL, Template: tmpl}
+	e := NewEvent("upload", `[WEB] File "a" uploaded`)
+	e.User = "alice"
+	require.NoError(t, g.SendEvent(e))
+	require.JSONEq(t, `{"summary":"[WEB] File \"a\" uploaded","who":"alice"}`, string(got))
+
+	require.NoError(t, g.Send("plain"))
+	require.JSONEq(t, `{"summary":"plain","who":""}`, string(got))
+}
+
+func TestRegister_Generic(t *testing.T) {
+	wh, err := New(true, "http://example.com", "Generic", []string{"upload"}, Settings{Secret: "x"})
+	require.NoError(t, err)
+	require.True(t, (*wh).GetEnabled())
+	q, ok := (*wh).(*Queue)
+	require.True(t, ok)
+	require.Equal(t, "x", q.Webhook.(*GenericWebhook).Secret)
+
+	_, err = New(true, "http://example.com", "generic", nil, Settings{Template: filepath.Join(t.TempDir(), "missing")})
+	require.Error(t, err)
+}
@@ -0,0 +1,43 @@
+package webhook
+
+import "slices"
+
+// GotifyWebhook posts to the message endpoint of a Gotify server. The
+// application token goes into the URL, https://host/message?token=<token>,
+// or an X-Gotify-Key header.
+type GotifyWebhook struct {
+	Enabled bool
+	Events  []string
+	URL     string
+	Headers map[string]string
+}
+
+func (g *GotifyWebhook) Send(message string) error {
+	return g.SendEvent(NewEvent("", message))
+}
+
+func (g *GotifyWebhook) SendEvent(e Event) error {
+	priority := 5
+	if len(e.Hashes) > 0 {
+		priority = 8
+	}
+	payload := map[string]any{
+		"title":    e.Title(),
+		"message":  e.Message,
+		"priority": priority,
+	}
+
+	return postJSONHeaders(g.URL, payload, g.Headers)
+}
+
+func (g *GotifyWebhook) GetEnabled() bool {
+	return g.Enabled
+}
+
+func (g *GotifyWebhook) GetEvents() []string {
+	return g.Events
+}
+
+func (g *GotifyWebhook) Contains(event string) bool {
+	return slices.Contains(g.Events, event)
+}
@@ -0,0 +1,108 @@
+package webhook
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// Destination is one entry of the webhooks list in the config file.
+type Destination struct {
+	Provider string   `json:"provider"`
+	URL      string   `json:"url"`
+	Events   []string `json:"events"`
+	Template string   `json:"template,omitempty"`
+	Headers  []string `json:"headers,omitempty"` // "Name: value"
+	Secret   string   `json:"secret,omitempty"`
+	Retries  *int     `json:"retries,omitempty"` // nil is DefaultRetries
+}
+
+// Register returns the webhook of the destination.
+func (d Destination) Register(onError func(error)) (Webhook, error) {
+	settings := Settings{
+		Template: d.Template,
+		Headers:  map[string]string{},
+		Secret:   d.Secret,
+		Retries:  DefaultRetries,
+		OnError:  onError,
+	}
+	for _, header := range d.Headers {
+		if name, value, ok := strings.Cut(header, ":"); ok && strings.TrimSpace(name) != "" {
+			settings.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	if d.Retries != nil {
+		settings.Retries = *d.Retries
+	}
+	events := make([]string, 0, len(d.Events))
+	for _, event := range d.Events {
+		events = append(events, strings.TrimSpace(strings.ToLower(event)))
+	}
+	if len(events) == 0 {
+		events = []string{"all"}
+	}
+
+	wh, err := New(true, d.URL, d.Provider, events, settings)
+	if err != nil {
+		return nil, err
+	}
+	return *wh, nil
+}
+
+// Wants reports whether wh is enabled and subscribed to event. "all"
+// covers every event but verbose.
+func Wants(wh Webhook, event string) bool {
+	if wh == nil || !wh.GetEnabled() {
+		return false
+	}
+	return wh.Contains(event) || (wh.Contains("all") && event != "verbose")
+}
+
+// Multi sends to several webhooks, each only the events it wants.
+type Multi []Webhook
+
+func (m Multi) Send(message string) error {
+	var errs []error
+	for _, wh := range m {
+		if wh.GetEnabled() {
+			errs = append(errs, wh.Send(message))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m Multi) SendEvent(e Event) error {
+	var errs []error
+	for _, wh := range m {
+		if !Wants(wh, e.Type) {
+			continue
+		}
+		if es, ok := wh.(EventSender); ok {
+			errs = append(errs, es.SendEvent(e))
+		} else {
+			errs = append(errs, wh.Send(e.Message))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m Multi) GetEnabled() bool {
+	return slices.ContainsFunc(m, Webhook.GetEnabled)
+}
+
+func (m Multi) GetEvents() []string {
+	var events []string
+	for _, wh := range m {
+		for _, event := range wh.GetEvents() {
+			if !slices.Contains(events, event) {
+				events = append(events, event)
+			}
+		}
+	}
+	return events
+}
+
+// Contains reports whether an enabled destination has event in its list.
+func (m Multi) Contains(event string) bool {
+	return slices.ContainsFunc(m, func(wh Webhook) bool { return wh.GetEnabled() && wh.Contains(event) })
+}
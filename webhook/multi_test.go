@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func counter(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var n atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.Add(1)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &n
+}
+
+func TestMulti_SendEvent(t *testing.T) {
+	private, privateHits := counter(t)
+	team, teamHits := counter(t)
+	m := Multi{
+		&DiscordWebhook{Enabled: false, Events: []string{"all"}},
+		&GenericWebhook{Enabled: true, URL: private.URL, Events: []string{"smb", "catcher"}},
+		&SlackWebhook{Enabled: true, URL: team.URL, Events: []string{"upload"}},
+	}
+
+	require.True(t, Wants(m, "smb"))
+	require.True(t, Wants(m, "upload"))
+	require.False(t, Wants(m, "dns"))
+	require.ElementsMatch(t, []string{"all", "smb", "catcher", "upload"}, m.GetEvents())
+
+	require.NoError(t, m.SendEvent(NewEvent("smb", "hash")))
+	require.NoError(t, m.SendEvent(NewEvent("catcher", "session")))
+	require.NoError(t, m.SendEvent(NewEvent("upload", "[WEB] File uploaded")))
+	require.NoError(t, m.SendEvent(NewEvent("dns", "[DNS] query")))
+	require.Equal(t, int32(2), privateHits.Load())
+	require.Equal(t, int32(1), teamHits.Load())
+
+	// Send without an event reaches every enabled destination
+	require.NoError(t, m.Send("hello"))
+	require.Equal(t, int32(3), privateHits.Load())
+	require.Equal(t, int32(2), teamHits.Load())
+}
+
+func TestMulti_Errors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+	ok, hits := counter(t)
+	m := Multi{
+		&SlackWebhook{Enabled: true, URL: ts.URL, Events: []string{"all"}},
+		&SlackWebhook{Enabled: true, URL: ok.URL, Events: []string{"all"}},
+	}
+	require.Error(t, m.SendEvent(NewEvent("upload", "x")))
+	require.Equal(t, int32(1), hits.Load())
+
+	require.False(t, Wants(Multi{}, "upload"))
+	require.False(t, Wants(nil, "upload"))
+}
+
+func TestDestination_Register(t *testing.T) {
+	retries := 0
+	wh, err := Destination{
+		Provider: "generic",
+		URL:      "http://example.com",
+		Events:   []string{" SMB ", "Catcher"},
+		Headers:  []string{"Authorization: Bearer a, b", "X-Env: lab"},
+		Retries:  &retries,
+	}.Register(nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"smb", "catcher"}, wh.GetEvents())
+	q := wh.(*Queue)
+	require.Equal(t, 0, q.Retries)
+	g := q.Webhook.(*GenericWebhook)
+	require.Equal(t, "Bearer a, b", g.Headers["Authorization"])
+	require.Equal(t, "lab", g.Headers["X-Env"])
+
+	wh, err = Destination{Provider: "slack", URL: "http://example.com"}.Register(nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"all"}, wh.GetEvents())
+	require.Equal(t, DefaultRetries, wh.(*Queue).Retries)
+
+	_, err = Destination{Provider: "telegram", URL: "http://example.com"}.Register(nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package webhook
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// NtfyWebhook publishes the message to an ntfy topic URL, such as
+// https://ntfy.sh/<topic>. Captured hashes are sent with high priority.
+type NtfyWebhook struct {
+	Enabled bool
+	Events  []string
+	URL     string
+	Headers map[string]string
+}
+
+func (n *NtfyWebhook) Send(message string) error {
+	return n.SendEvent(NewEvent("", message))
+}
+
+func (n *NtfyWebhook) SendEvent(e Event) error {
+	req, err := http.NewRequest(http.MethodPost, n.URL, strings.NewReader(e.Message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Title", e.Title())
+	if e.Type != "" {
+		req.Header.Set("Tags", e.Type)
+	}
+	if len(e.Hashes) > 0 {
+		req.Header.Set("Priority", "high")
+	}
+	for name, value := range n.Headers {
+		req.Header.Set(name, value)
+	}
+
+	return do(req)
+}
+
+func (n *NtfyWebhook) GetEnabled() bool {
+	return n.Enabled
+}
+
+func (n *NtfyWebhook) GetEvents() []string {
+	return n.Events
+}
+
+func (n *NtfyWebhook) Contains(event string) bool {
+	return slices.Contains(n.Events, event)
+}
@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type capture struct {
+	path   string
+	query  string
+	header http.Header
+	body   []byte
+}
+
+func standIn(t *testing.T) (*httptest.Server, *capture) {
+	t.Helper()
+	c := &capture{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.path = r.URL.Path
+		c.query = r.URL.RawQuery
+		c.header = r.Header
+		c.body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, c
+}
+
+func hashEvent() Event {
+	e := NewEvent("smb", "User: bob\n\nbob::CORP:1122")
+	e.Remote = "10.0.0.5"
+	e.User = "bob"
+	e.Hashes = []string{"bob::CORP:1122"}
+	e.Fields = map[string]string{"hashcat_mode": "5600", "domain": "CORP"}
+	return e
+}
+
+func TestTeamsWebhook_SendEvent(t *testing.T) {
+	ts, c := standIn(t)
+	require.NoError(t, (&TeamsWebhook{URL: ts.URL}).SendEvent(hashEvent()))
+
+	var payload struct {
+		Type        string `json:"type"`
+		Attachments []struct {
+			ContentType string `json:"contentType"`
+			Content     struct {
+				Type string           `json:"type"`
+				Body []map[string]any `json:"body"`
+			} `json:"content"`
+		} `json:"attachments"`
+	}
+	require.NoError(t, json.Unmarshal(c.body, &payload))
+	require.Equal(t, "message", payload.Type)
+	require.Len(t, payload.Attachments, 1)
+	card := payload.Attachments[0]
+	require.Equal(t, "application/vnd.microsoft.card.adaptive", card.ContentType)
+	require.Equal(t, "AdaptiveCard", card.Content.Type)
+	require.Equal(t, "goshs: smb", card.Content.Body[0]["text"])
+	require.Equal(t, "User: bob\n\nbob::CORP:1122", card.Content.Body[1]["text"])
+	facts := card.Content.Body[2]["facts"].([]any)
+	require.Len(t, facts, 4)
+	require.Equal(t, map[string]any{"title": "remote", "value": "10.0.0.5"}, facts[0])
+	require.Equal(t, map[string]any{"title": "domain", "value": "CORP"}, facts[2])
+
+	require.NoError(t, (&TeamsWebhook{URL: ts.URL}).Send("plain"))
+	require.NotContains(t, string(c.body), "FactSet")
+}
+
+func TestTelegramWebhook_SendEvent(t *testing.T) {
+	ts, c := standIn(t)
+	_, err := NewTelegramWebhook(ts.URL + "/bot123:abc/sendMessage")
+	require.Error(t, err)
+	tg, err := NewTelegramWebhook(ts.URL + "/bot123:abc/sendMessage?chat_id=-10042")
+	require.NoError(t, err)
+
+	require.NoError(t, tg.Send("[WEB] File uploaded: /tmp/a_b.txt (1.2 KB)!"))
+	require.Equal(t, "/bot123:abc/sendMessage", c.path)
+	require.Empty(t, c.query)
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(c.body, &payload))
+	require.Equal(t, "-10042", payload["chat_id"])
+	require.Equal(t, "MarkdownV2", payload["parse_mode"])
+	require.Equal(t, "*goshs*\n\\[WEB\\] File uploaded: /tmp/a\\_b\\.txt \\(1\\.2 KB\\)\\!", payload["text"])
+}
+
+func TestMarkdownV2(t *testing.T) {
+	require.Equal(t, "JSON \\*body\\*:\n```\n{\"a\": \"\\`x\\\\\"}\n```", markdownV2("JSON *body*:\n```{\"a\": \"`x\\\"}```"))
+	require.Equal(t, "open \\`\\`\\` block", markdownV2("open ``` block"))
+}
+
+func TestNtfyWebhook_SendEvent(t *testing.T) {
+	ts, c := standIn(t)
+	n := &NtfyWebhook{URL: ts.URL + "/goshs", Headers: map[string]string{"Authorization": "Bearer tk_x"}}
+	require.NoError(t, n.SendEvent(hashEvent()))
+	require.Equal(t, "/goshs", c.path)
+	require.Equal(t, "User: bob\n\nbob::CORP:1122", string(c.body))
+	require.Equal(t, "goshs: smb", c.header.Get("Title"))
+	require.Equal(t, "smb", c.header.Get("Tags"))
+	require.Equal(t, "high", c.header.Get("Priority"))
+	require.Equal(t, "Bearer tk_x", c.header.Get("Authorization"))
+
+	require.NoError(t, n.Send("plain"))
+	require.Empty(t, c.header.Get("Priority"))
+	require.Empty(t, c.header.Get("Tags"))
+}
+
+func TestGotifyWebhook_SendEvent(t *testing.T) {
+	ts, c := standIn(t)
+	g := &GotifyWebhook{URL: ts.URL + "/message?token=AbC"}
+	require.NoError(t, g.SendEvent(hashEvent()))
+	require.Equal(t, "/message", c.path)
+	require.Equal(t, "token=AbC", c.query)
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(c.body, &payload))
+	require.Equal(t, "goshs: smb", payload["title"])
+	require.Equal(t, float64(8), payload["priority"])
+
+	require.NoError(t, g.Send("[DNS] query"))
+	require.NoError(t, json.Unmarshal(c.body, &payload))
+	require.Equal(t, float64(5), payload["priority"])
+	require.Equal(t, "[DNS] query", payload["message"])
+}
+
+func TestRegister_NewProviders(t *testing.T) {
+	for _, provider := range []string{"teams", "Telegram", "ntfy", "gotify"} {
+		wh, err := New(true, "https://example.com/x?chat_id=1", provider, []string{"all"}, Settings{})
+		require.NoError(t, err, provider)
+		require.True(t, (*wh).GetEnabled(), provider)
+		require.True(t, (*wh).Contains("all"), provider)
+	}
+	_, err := New(true, "https://example.com/x", "telegram", nil, Settings{})
+	require.Error(t, err)
+}
@@ -0,0 +1,82 @@
+package webhook
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	queueSize      = 100
+	DefaultRetries = 3
+)
+
+var errQueueFull = errors.New("webhook queue is full, notification dropped")
+
+// Queue sends the notifications of a webhook in the background, so callers
+// never wait for the receiver, and retries failed ones with a doubling delay.
+type Queue struct {
+	Webhook
+	Retries int
+	Backoff time.Duration // delay before the first retry
+	OnError func(error)   // called once a notification is given up
+
+	once sync.Once
+	jobs chan func() error
+}
+
+func NewQueue(wh Webhook, retries int) *Queue {
+	return &Queue{
+		Webhook: wh,
+		Retries: retries,
+		Backoff: time.Second,
+	}
+}
+
+func (q *Queue) Send(message string) error {
+	return q.enqueue(func() error { return q.Webhook.Send(message) })
+}
+
+func (q *Queue) SendEvent(e Event) error {
+	if es, ok := q.Webhook.(EventSender); ok {
+		return q.enqueue(func() error { return es.SendEvent(e) })
+	}
+	return q.Send(e.Message)
+}
+
+func (q *Queue) enqueue(job func() error) error {
+	q.once.Do(func() {
+		q.jobs = make(chan func() error, queueSize)
+		go q.run()
+	})
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+func (q *Queue) run() {
+	for job := range q.jobs {
+		q.deliver(job)
+	}
+}
+
+func (q *Queue) deliver(job func() error) {
+	delay := q.Backoff
+	for attempt := 0; ; attempt++ {
+		err := job()
+		if err == nil {
+			return
+		}
+		if attempt >= q.Retries {
+			if q.OnError != nil {
+				q.OnError(err)
+			}
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
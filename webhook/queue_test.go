@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type stubWebhook struct {
+	DiscordWebhook
+	calls atomic.Int32
+	fails int32
+	sent  chan string
+}
+
+func (s *stubWebhook) Send(message string) error {
+	if s.calls.Add(1) <= s.fails {
+		return errors.New("receiver down")
+	}
+	s.sent <- message
+	return nil
+}
+
+func TestQueue_Retries(t *testing.T) {
+	stub := &stubWebhook{fails: 2, sent: make(chan string, 1)}
+	q := NewQueue(stub, 3)
+	q.Backoff = time.Millisecond
+
+	require.NoError(t, q.SendEvent(NewEvent("upload", "hello")))
+	select {
+	case msg := <-stub.sent:
+		require.Equal(t, "hello", msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification was not delivered")
+	}
+	require.Equal(t, int32(3), stub.calls.Load())
+}
+
+func TestQueue_GivesUp(t *testing.T) {
+	stub := &stubWebhook{fails: 100, sent: make(chan string, 1)}
+	q := NewQueue(stub, 2)
+	q.Backoff = time.Millisecond
+	dropped := make(chan error, 1)
+	q.OnError = func(err error) { dropped <- err }
+
+	require.NoError(t, q.Send("hello"))
+	select {
+	case err := <-dropped:
+		require.EqualError(t, err, "receiver down")
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification was not given up")
+	}
+	require.Equal(t, int32(3), stub.calls.Load())
+}
@@ -0,0 +1,51 @@
+package webhook
+
+import "sync"
+
+// Switch is a webhook whose destination can be replaced while the servers
+// holding it keep running, as a config reload does.
+type Switch struct {
+	mu sync.RWMutex
+	wh Webhook
+}
+
+func NewSwitch(wh Webhook) *Switch {
+	return &Switch{wh: wh}
+}
+
+// Set sends the following notifications to wh.
+func (s *Switch) Set(wh Webhook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wh = wh
+}
+
+func (s *Switch) current() Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.wh
+}
+
+func (s *Switch) Send(message string) error {
+	return s.current().Send(message)
+}
+
+func (s *Switch) SendEvent(e Event) error {
+	wh := s.current()
+	if es, ok := wh.(EventSender); ok {
+		return es.SendEvent(e)
+	}
+	return wh.Send(e.Message)
+}
+
+func (s *Switch) GetEnabled() bool {
+	return s.current().GetEnabled()
+}
+
+func (s *Switch) GetEvents() []string {
+	return s.current().GetEvents()
+}
+
+func (s *Switch) Contains(event string) bool {
+	return s.current().Contains(event)
+}
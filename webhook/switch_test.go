@@ -0,0 +1,23 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwitch(t *testing.T) {
+	first, firstHits := counter(t)
+	second, secondHits := counter(t)
+	s := NewSwitch(&GenericWebhook{Enabled: true, URL: first.URL, Events: []string{"upload"}})
+	require.True(t, Wants(s, "upload"))
+
+	require.NoError(t, s.SendEvent(NewEvent("upload", "[WEB] File uploaded")))
+	s.Set(&SlackWebhook{Enabled: true, URL: second.URL, Events: []string{"smb"}})
+	require.False(t, Wants(s, "upload"))
+	require.Equal(t, []string{"smb"}, s.GetEvents())
+	require.NoError(t, s.SendEvent(NewEvent("smb", "hash")))
+
+	require.Equal(t, int32(1), firstHits.Load())
+	require.Equal(t, int32(1), secondHits.Load())
+}
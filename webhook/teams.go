@@ -0,0 +1,71 @@
+package webhook
+
+import "slices"
+
+// TeamsWebhook posts an adaptive card to a Teams workflow or incoming
+// webhook URL.
+type TeamsWebhook struct {
+	Enabled bool
+	Events  []string
+	URL     string
+}
+
+func (t *TeamsWebhook) Send(message string) error {
+	return t.SendEvent(NewEvent("", message))
+}
+
+func (t *TeamsWebhook) SendEvent(e Event) error {
+	body := []map[string]any{
+		{
+			"type":   "TextBlock",
+			"text":   e.Title(),
+			"weight": "Bolder",
+			"size":   "Medium",
+		},
+		{
+			"type": "TextBlock",
+			"text": e.Message,
+			"wrap": true,
+		},
+	}
+
+	if facts := e.Facts(); len(facts) > 0 {
+		set := make([]map[string]string, 0, len(facts))
+		for _, f := range facts {
+			set = append(set, map[string]string{"title": f.Name, "value": f.Value})
+		}
+		body = append(body, map[string]any{
+			"type":  "FactSet",
+			"facts": set,
+		})
+	}
+
+	payload := map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{
+			{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]any{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body":    body,
+				},
+			},
+		},
+	}
+
+	return postJSON(t.URL, payload)
+}
+
+func (t *TeamsWebhook) GetEnabled() bool {
+	return t.Enabled
+}
+
+func (t *TeamsWebhook) GetEvents() []string {
+	return t.Events
+}
+
+func (t *TeamsWebhook) Contains(event string) bool {
+	return slices.Contains(t.Events, event)
+}
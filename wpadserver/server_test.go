@@ -0,0 +1,300 @@
+package wpadserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/require"
+
+	"goshs.de/goshs/v2/options"
+	"goshs.de/goshs/v2/smbserver"
+	"goshs.de/goshs/v2/webhook"
+	"goshs.de/goshs/v2/ws"
+)
+
+// ─── helpers ───────────────────────────────────────────────────────────────────
+
+func newTestHub() *ws.Hub {
+	return &ws.Hub{
+		Broadcast: make(chan []byte, 64),
+		HTTPLog:   ws.NewRingBuffer(100),
+		DNSLog:    ws.NewRingBuffer(100),
+		SMTPLog:   ws.NewRingBuffer(100),
+		SMBLog:    ws.NewRingBuffer(100),
+		LDAPLog:   ws.NewRingBuffer(100),
+	}
+}
+
+func drainBroadcast(hub *ws.Hub) []map[string]any {
+	var msgs []map[string]any
+	for {
+		select {
+		case raw := <-hub.Broadcast:
+			var m map[string]any
+			if err := json.Unmarshal(raw, &m); err == nil {
+				msgs = append(msgs, m)
+			}
+		default:
+			return msgs
+		}
+	}
+}
+
+func newTestServer(t *testing.T, auth string, forward bool) (*WPADServer, *ws.Hub, string) {
+	t.Helper()
+	hub := newTestHub()
+	srv := NewWPADServer(&options.Options{
+		IP:          "127.0.0.1",
+		WPADAuth:    auth,
+		WPADForward: forward,
+		SMBDomain:   "corp",
+	}, hub, nil)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv.Port = ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	require.NoError(t, srv.Listen())
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+	return srv, hub, ln.Addr().String()
+}
+
+// recordingWebhook keeps the events it is sent.
+type recordingWebhook struct {
+	mu     sync.Mutex
+	events []webhook.Event
+}
+
+func (r *recordingWebhook) Send(message string) error  { return nil }
+func (r *recordingWebhook) GetEnabled() bool           { return true }
+func (r *recordingWebhook) GetEvents() []string        { return []string{"all"} }
+func (r *recordingWebhook) Contains(event string) bool { return event == "all" }
+func (r *recordingWebhook) SendEvent(e webhook.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *recordingWebhook) sent() []webhook.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.events)
+}
+
+// proxyClient keeps a single TCP connection, which NTLM proxy auth requires.
+type proxyClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialProxy(t *testing.T, addr string) *proxyClient {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &proxyClient{conn: conn, br: bufio.NewReader(conn)}
+}
+
+func (c *proxyClient) do(t *testing.T, target, proxyAuth string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	require.NoError(t, err)
+	if proxyAuth != "" {
+		req.Header.Set("Proxy-Authorization", proxyAuth)
+	}
+	require.NoError(t, req.WriteProxy(c.conn))
+
+	resp, err := http.ReadResponse(c.br, req)
+	require.NoError(t, err)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func utf16le(s string) []byte {
+	runes := utf16.Encode([]rune(s))
+	buf := make([]byte, len(runes)*2)
+	for i, r := range runes {
+		binary.LittleEndian.PutUint16(buf[i*2:], r)
+	}
+	return buf
+}
+
+func buildNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(msg[8:], smbserver.NTLMSSP_NEGOTIATE)
+	binary.LittleEndian.PutUint32(msg[12:], 0x00088207)
+	return msg
+}
+
+// buildAuthMessage assembles a minimal NTLMv2 Type 3 message.
+func buildAuthMessage(username, domain, workstation string) []byte {
+	ntResp := make([]byte, 48) // 16 byte NTProofStr + blob, > 24 bytes means NTLMv2
+	for i := range ntResp {
+		ntResp[i] = byte(i)
+	}
+	fields := [][]byte{make([]byte, 24), ntResp, utf16le(domain), utf16le(username), utf16le(workstation), nil}
+
+	off := uint32(72)
+	msg := make([]byte, 72)
+	copy(msg, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(msg[8:], smbserver.NTLMSSP_AUTH)
+	for i, f := range fields {
+		hdr := 12 + i*8
+		binary.LittleEndian.PutUint16(msg[hdr:], uint16(len(f)))
+		binary.LittleEndian.PutUint16(msg[hdr+2:], uint16(len(f)))
+		binary.LittleEndian.PutUint32(msg[hdr+4:], off)
+		msg = append(msg, f...)
+		off += uint32(len(f))
+	}
+	return msg
+}
+
+// ─── tests ─────────────────────────────────────────────────────────────────────
+
+func TestGeneratePAC(t *testing.T) {
+	pac := string(GeneratePAC("10.0.0.5", 3128))
+	require.Contains(t, pac, "function FindProxyForURL(url, host)")
+	require.Contains(t, pac, `return "PROXY 10.0.0.5:3128; DIRECT";`)
+	require.Contains(t, pac, `host == "10.0.0.5"`)
+	require.Contains(t, pac, "isPlainHostName(host)")
+}
+
+func TestGeneratePAC_IPv6(t *testing.T) {
+	pac := string(GeneratePAC("fe80::1", 8080))
+	require.Contains(t, pac, `"PROXY [fe80::1]:8080; DIRECT"`)
+}
+
+func TestNewWPADServer_Defaults(t *testing.T) {
+	srv := NewWPADServer(&options.Options{WPADPort: 3128, WPADAuth: "bogus"}, nil, nil)
+	require.Equal(t, AuthNTLM, srv.Auth)
+	require.Equal(t, "GOSHS", srv.Realm)
+	require.Equal(t, 3128, srv.Port)
+
+	srv = NewWPADServer(&options.Options{WPADAuth: "BASIC", SMBDomain: "corp"}, nil, nil)
+	require.Equal(t, AuthBasic, srv.Auth)
+	require.Equal(t, "CORP", srv.Realm)
+}
+
+func TestProxy_DemandsNTLM(t *testing.T) {
+	_, hub, addr := newTestServer(t, AuthNTLM, false)
+	c := dialProxy(t, addr)
+
+	resp := c.do(t, "http://example.test/", "")
+	require.Equal(t, http.StatusProxyAuthRequired, resp.StatusCode)
+	require.Equal(t, "NTLM", resp.Header.Get("Proxy-Authenticate"))
+	require.Empty(t, drainBroadcast(hub))
+}
+
+func TestProxy_DemandsBasic(t *testing.T) {
+	_, _, addr := newTestServer(t, AuthBasic, false)
+	c := dialProxy(t, addr)
+
+	resp := c.do(t, "http://example.test/", "")
+	require.Equal(t, http.StatusProxyAuthRequired, resp.StatusCode)
+	require.Equal(t, `Basic realm="CORP"`, resp.Header.Get("Proxy-Authenticate"))
+}
+
+func TestProxy_NTLMCapture(t *testing.T) {
+	srv, hub, addr := newTestServer(t, AuthNTLM, false)
+	rec := &recordingWebhook{}
+	var wh webhook.Webhook = rec
+	srv.WebHook = &wh
+	c := dialProxy(t, addr)
+
+	// Leg 1: Type 1 → 407 carrying a Type 2 challenge
+	resp := c.do(t, "http://example.test/", "NTLM "+base64.StdEncoding.EncodeToString(buildNegotiateMessage()))
+	require.Equal(t, http.StatusProxyAuthRequired, resp.StatusCode)
+	scheme, token, ok := strings.Cut(resp.Header.Get("Proxy-Authenticate"), " ")
+	require.True(t, ok)
+	require.Equal(t, "NTLM", scheme)
+	challenge, err := base64.StdEncoding.DecodeString(token)
+	require.NoError(t, err)
+	require.Equal(t, "NTLMSSP\x00", string(challenge[:8]))
+	require.Equal(t, smbserver.NTLMSSP_CHALLENGE, binary.LittleEndian.Uint32(challenge[8:12]))
+
+	// Leg 2: Type 3 on the same connection → captured, then refused
+	resp = c.do(t, "http://example.test/", "NTLM "+base64.StdEncoding.EncodeToString(buildAuthMessage("alice", "CORP", "WS01")))
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	msgs := drainBroadcast(hub)
+	require.Len(t, msgs, 1)
+	require.Equal(t, "smb", msgs[0]["type"])
+	require.Equal(t, "wpad", msgs[0]["protocol"])
+	require.Equal(t, "alice", msgs[0]["username"])
+	require.Equal(t, "CORP", msgs[0]["domain"])
+	require.Equal(t, "WS01", msgs[0]["workstation"])
+	require.Equal(t, string(smbserver.ProtoNTLMv2), msgs[0]["hashType"])
+	require.Equal(t, "5600", msgs[0]["hashcatMode"])
+	require.Equal(t, strings.ToUpper(hex.EncodeToString(challenge[24:32])), msgs[0]["challenge"])
+
+	// The webhook gets the hash as a structured event
+	events := rec.sent()
+	require.Len(t, events, 1)
+	require.Equal(t, "wpad", events[0].Type)
+	require.Equal(t, "alice", events[0].User)
+	require.Equal(t, []string{msgs[0]["hash"].(string)}, events[0].Hashes)
+	require.Equal(t, "CORP", events[0].Fields["domain"])
+	require.Equal(t, "5600", events[0].Fields["hashcat_mode"])
+
+	// The connection stays authenticated, nothing is captured twice
+	resp = c.do(t, "http://example.test/other", "")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.Empty(t, drainBroadcast(hub))
+}
+
+func TestProxy_NTLMAuthWithoutChallenge(t *testing.T) {
+	_, hub, addr := newTestServer(t, AuthNTLM, false)
+	c := dialProxy(t, addr)
+
+	resp := c.do(t, "http://example.test/", "NTLM "+base64.StdEncoding.EncodeToString(buildAuthMessage("alice", "CORP", "WS01")))
+	require.Equal(t, http.StatusProxyAuthRequired, resp.StatusCode)
+	require.Empty(t, drainBroadcast(hub))
+}
+
+func TestProxy_BasicCaptureAndForward(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Empty(t, r.Header.Get("Proxy-Authorization"))
+		_, _ = w.Write([]byte("upstream ok"))
+	}))
+	defer upstream.Close()
+
+	_, hub, addr := newTestServer(t, AuthBasic, true)
+	c := dialProxy(t, addr)
+
+	creds := base64.StdEncoding.EncodeToString([]byte("bob:Secret1"))
+	req, err := http.NewRequest(http.MethodGet, upstream.URL+"/page", nil)
+	require.NoError(t, err)
+	req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	require.NoError(t, req.WriteProxy(c.conn))
+	resp, err := http.ReadResponse(c.br, req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "upstream ok", string(body))
+
+	msgs := drainBroadcast(hub)
+	require.Len(t, msgs, 1)
+	require.Equal(t, "http", msgs[0]["type"])
+	require.Contains(t, msgs[0]["body"], "bob:Secret1")
+}
@@ -19,6 +19,7 @@ type SMTPAttachment struct {
 
 type SMTPEvent struct {
 	Type        string           `json:"type"` // "smtp"
+	ID          string           `json:"id,omitempty"` // mail store ID, if persisted
 	From        string           `json:"from"`
 	To          []string         `json:"to"`
 	CC          []string         `json:"cc"`
@@ -42,6 +43,9 @@ type HTTPEvent struct {
 	UserAgent  string            `json:"useragent"`  // browser/user agent string
 	Status     int               `json:"status"`     // HTTP status code
 	Timestamp  time.Time         `json:"timestamp"`
+
+	User        string `json:"user,omitempty"`        // account of the request
+	Certificate string `json:"certificate,omitempty"` // client certificate identity
 }
 
 type LDAPEvent struct {
@@ -71,5 +75,38 @@ type NTLMEvent struct {
 	HashcatMode     string    `json:"hashcatMode"`     // hashcat mode (v2 5600, v1 5500, 3000 LM, 1000 NTLM)
 	CrackedPassword string    `json:"crackedPassword"` // plaintext password if cracked, empty otherwise
 	Source          string    `json:"source"`          // source
+	// Protocol names the capturing service when it is not SMB (e.g. "wpad")
+	Protocol        string    `json:"protocol,omitempty"`
 	Timestamp       time.Time `json:"timestamp"`
 }
+
+type CrackEvent struct {
+	Type      string    `json:"type"`     // "crack"
+	JobID     string    `json:"jobId"`    // crack job ID
+	HashID    string    `json:"hashId"`   // captured hash the job works on
+	Origin    string    `json:"origin"`   // capturing service: "smb", "ldap", "wpad"
+	Username  string    `json:"username"` // username of the captured hash
+	Domain    string    `json:"domain"`   // domain of the captured hash
+	Attack    string    `json:"attack"`   // human readable attack description
+	Status    string    `json:"status"`   // queued, running, cracked, exhausted, cancelled, failed
+	Tried     int64     `json:"tried"`    // candidates verified so far
+	Keyspace  int64     `json:"keyspace"` // total candidates, -1 if unknown
+	Rate      float64   `json:"rate"`     // candidates per second
+	ETA       int64     `json:"eta"`      // seconds remaining, -1 if unknown
+	Password  string    `json:"password,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type CredentialEvent struct {
+	Type        string    `json:"type"`                  // "credential"
+	Protocol    string    `json:"protocol"`              // capturing service, e.g. "smtp"
+	Mechanism   string    `json:"mechanism"`             // PLAIN, LOGIN, CRAM-MD5, NTLM …
+	Username    string    `json:"username"`              // username
+	Password    string    `json:"password,omitempty"`    // cleartext if the mechanism exposes it
+	Hash        string    `json:"hash,omitempty"`        // hashcat line for challenge-response mechanisms
+	HashcatMode string    `json:"hashcatMode,omitempty"` // hashcat mode for Hash
+	TLS         bool      `json:"tls"`                   // credentials were sent over TLS
+	Source      string    `json:"source"`                // client IP:port
+	Timestamp   time.Time `json:"timestamp"`
+}
@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"goshs.de/goshs/v2/clipboard"
+	"goshs.de/goshs/v2/metrics"
 )
 
 // Hub maintains the set of active clients and broadcasts messages to the
@@ -33,11 +34,12 @@ type Hub struct {
 	cliEnabled bool
 
 	// Ring BUffers - capped storage survives client reconnect
-	HTTPLog  *RingBuffer
-	DNSLog   *RingBuffer
-	SMTPLog  *RingBuffer
-	SMBLog   *RingBuffer
-	LDAPLog  *RingBuffer
+	HTTPLog *RingBuffer
+	DNSLog  *RingBuffer
+	SMTPLog *RingBuffer
+	SMBLog  *RingBuffer
+	LDAPLog *RingBuffer
+	CredLog *RingBuffer
 }
 
 // NewHub will create a new hub
@@ -54,6 +56,7 @@ func NewHub(cb *clipboard.Clipboard, cliEnabled bool) *Hub {
 		SMTPLog:    NewRingBuffer(1000),
 		SMBLog:     NewRingBuffer(1000),
 		LDAPLog:    NewRingBuffer(1000),
+		CredLog:    NewRingBuffer(1000),
 	}
 }
 
@@ -65,6 +68,7 @@ func (h *Hub) Run() {
 			h.mu.Lock()
 			h.clients[client] = true
 			h.mu.Unlock()
+			metrics.WebsocketClients.Inc()
 			// Send existing history to new client
 			go h.sendCatchup(client)
 
@@ -73,6 +77,7 @@ func (h *Hub) Run() {
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
 				close(client.send)
+				metrics.WebsocketClients.Dec()
 			}
 			h.mu.Unlock()
 
@@ -97,6 +102,7 @@ func (h *Hub) Run() {
 					if _, ok := h.clients[client]; ok {
 						delete(h.clients, client)
 						close(client.send)
+						metrics.WebsocketClients.Dec()
 					}
 				}
 				h.mu.Unlock()
@@ -125,17 +131,26 @@ func (h *Hub) classifyAndStore(msg []byte) {
 		h.SMBLog.Add(msg)
 	case "ldap":
 		h.LDAPLog.Add(msg)
+	case "credential":
+		if h.CredLog != nil {
+			h.CredLog.Add(msg)
+		}
 	}
 }
 
-// sendCatchup serialises up to 200 entries from each buffer and sends
-// them as a single "catchup" message to a newly connected client.
-func (h *Hub) sendCatchup(client *Client) {
+// Catchup serialises up to 200 entries from each buffer as a single
+// "catchup" message. Newly connected clients get it first, the events API
+// serves it for polling.
+func (h *Hub) Catchup() ([]byte, error) {
 	httpEntries := h.HTTPLog.Last(200)
 	dnsEntries := h.DNSLog.Last(200)
 	smtpEntries := h.SMTPLog.Last(200)
 	smbEntries := h.SMBLog.Last(200)
 	ldapEntries := h.LDAPLog.Last(200)
+	var credEntries [][]byte
+	if h.CredLog != nil {
+		credEntries = h.CredLog.Last(200)
+	}
 
 	// Marshal each slice of raw JSON messages into a JSON array
 	marshal := func(entries [][]byte) json.RawMessage {
@@ -155,14 +170,20 @@ func (h *Hub) sendCatchup(client *Client) {
 	}
 
 	payload := map[string]any{
-		"type": "catchup",
-		"http": marshal(httpEntries),
-		"dns":  marshal(dnsEntries),
-		"smtp": marshal(smtpEntries),
-		"smb":  marshal(smbEntries),
-		"ldap": marshal(ldapEntries),
+		"type":       "catchup",
+		"http":       marshal(httpEntries),
+		"dns":        marshal(dnsEntries),
+		"smtp":       marshal(smtpEntries),
+		"smb":        marshal(smbEntries),
+		"ldap":       marshal(ldapEntries),
+		"credential": marshal(credEntries),
 	}
-	data, err := json.Marshal(payload)
+	return json.Marshal(payload)
+}
+
+// sendCatchup sends the history to a newly connected client.
+func (h *Hub) sendCatchup(client *Client) {
+	data, err := h.Catchup()
 	if err != nil {
 		return
 	}